@@ -0,0 +1,111 @@
+// Package apierror defines the machine-readable error codes and the JSON error
+// envelope shared by the datas3t HTTP API and its client.
+package apierror
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type Code string
+
+const (
+	CodeInvalidRequest         Code = "invalid_request"
+	CodeValidationFailed       Code = "validation_failed"
+	CodeBucketNotFound         Code = "bucket_not_found"
+	CodeBucketAlreadyExists    Code = "bucket_already_exists"
+	CodeBucketInUse            Code = "bucket_in_use"
+	CodeDatas3tNotFound        Code = "datas3t_not_found"
+	CodeDatas3tAlreadyExists   Code = "datas3t_already_exists"
+	CodeDatas3tNotEmpty        Code = "datas3t_not_empty"
+	CodeDatarangeNotFound      Code = "datarange_not_found"
+	CodeDatarangeOverlap       Code = "datarange_overlap"
+	CodeDatarangeLeased        Code = "datarange_leased"
+	CodeDatarangeRestoring     Code = "datarange_restoring"
+	CodeDatapointsNotFound     Code = "datapoints_not_found"
+	CodeReplicaNotFound        Code = "replica_not_found"
+	CodeUploadNotFound         Code = "upload_not_found"
+	CodeUploadValidationFailed Code = "upload_validation_failed"
+	CodeRangeNotFullyCovered   Code = "range_not_fully_covered"
+	CodeInsufficientDataranges Code = "insufficient_dataranges"
+	CodeRequestTooLarge        Code = "request_too_large"
+	CodeInternal               Code = "internal_error"
+)
+
+// HTTPStatus returns the HTTP status code used when responding with this code
+func (c Code) HTTPStatus() int {
+	switch c {
+	case CodeInvalidRequest, CodeValidationFailed:
+		return http.StatusBadRequest
+	case CodeBucketNotFound, CodeDatas3tNotFound, CodeDatarangeNotFound, CodeDatapointsNotFound, CodeReplicaNotFound, CodeUploadNotFound:
+		return http.StatusNotFound
+	case CodeBucketAlreadyExists, CodeBucketInUse, CodeDatas3tAlreadyExists, CodeDatas3tNotEmpty, CodeDatarangeOverlap, CodeDatarangeLeased, CodeDatarangeRestoring:
+		return http.StatusConflict
+	case CodeUploadValidationFailed, CodeRangeNotFullyCovered, CodeInsufficientDataranges:
+		return http.StatusUnprocessableEntity
+	case CodeRequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error is an error carrying a machine-readable code.
+// Two errors are considered equal by errors.Is when their codes match, which lets
+// the sentinel values below be used to classify any wrapped *Error.
+type Error struct {
+	Code    Code   `json:"code"`
+	Message string `json:"message"`
+	err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.err
+}
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// New creates an error with the given code; the format supports %w
+func New(code Code, format string, args ...any) *Error {
+	return Wrap(code, fmt.Errorf(format, args...))
+}
+
+// Wrap attaches a code to an existing error
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, Message: err.Error(), err: err}
+}
+
+// Response is the JSON envelope returned by the API for every failed request
+type Response struct {
+	Error *Error `json:"error"`
+}
+
+var (
+	ErrInvalidRequest         = &Error{Code: CodeInvalidRequest, Message: "invalid request"}
+	ErrValidationFailed       = &Error{Code: CodeValidationFailed, Message: "validation failed"}
+	ErrBucketNotFound         = &Error{Code: CodeBucketNotFound, Message: "bucket not found"}
+	ErrBucketAlreadyExists    = &Error{Code: CodeBucketAlreadyExists, Message: "bucket already exists"}
+	ErrBucketInUse            = &Error{Code: CodeBucketInUse, Message: "bucket is used by datas3ts"}
+	ErrDatas3tNotFound        = &Error{Code: CodeDatas3tNotFound, Message: "datas3t not found"}
+	ErrDatas3tAlreadyExists   = &Error{Code: CodeDatas3tAlreadyExists, Message: "datas3t already exists"}
+	ErrDatas3tNotEmpty        = &Error{Code: CodeDatas3tNotEmpty, Message: "datas3t is not empty"}
+	ErrDatarangeNotFound      = &Error{Code: CodeDatarangeNotFound, Message: "datarange not found"}
+	ErrDatarangeOverlap       = &Error{Code: CodeDatarangeOverlap, Message: "datarange overlaps with existing dataranges"}
+	ErrDatarangeLeased        = &Error{Code: CodeDatarangeLeased, Message: "datarange is leased by another upload"}
+	ErrDatarangeRestoring     = &Error{Code: CodeDatarangeRestoring, Message: "archived datarange is being restored"}
+	ErrDatapointsNotFound     = &Error{Code: CodeDatapointsNotFound, Message: "no dataranges found for datapoints"}
+	ErrReplicaNotFound        = &Error{Code: CodeReplicaNotFound, Message: "datas3t has no replica"}
+	ErrUploadNotFound         = &Error{Code: CodeUploadNotFound, Message: "upload not found"}
+	ErrUploadValidationFailed = &Error{Code: CodeUploadValidationFailed, Message: "uploaded data failed validation"}
+	ErrRangeNotFullyCovered   = &Error{Code: CodeRangeNotFullyCovered, Message: "range is not fully covered by existing dataranges"}
+	ErrInsufficientDataranges = &Error{Code: CodeInsufficientDataranges, Message: "range must contain at least two dataranges"}
+	ErrRequestTooLarge        = &Error{Code: CodeRequestTooLarge, Message: "request body is too large"}
+	ErrInternal               = &Error{Code: CodeInternal, Message: "internal error"}
+)
@@ -0,0 +1,64 @@
+package apierror_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/draganm/datas3t/apierror"
+)
+
+func TestErrorsIsMatchesByCode(t *testing.T) {
+	err := fmt.Errorf("failed to start upload: %w", apierror.New(apierror.CodeDatas3tNotFound, "datas3t '%s' does not exist", "foo"))
+
+	if !errors.Is(err, apierror.ErrDatas3tNotFound) {
+		t.Fatalf("expected error to match ErrDatas3tNotFound")
+	}
+
+	if errors.Is(err, apierror.ErrBucketNotFound) {
+		t.Fatalf("did not expect error to match ErrBucketNotFound")
+	}
+
+	var apiErr *apierror.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected error to be an *apierror.Error")
+	}
+
+	if apiErr.Message != "datas3t 'foo' does not exist" {
+		t.Fatalf("unexpected message: %s", apiErr.Message)
+	}
+}
+
+func TestWrapKeepsCause(t *testing.T) {
+	cause := errors.New("boom")
+	err := apierror.Wrap(apierror.CodeValidationFailed, fmt.Errorf("bad input: %w", cause))
+
+	if !errors.Is(err, cause) {
+		t.Fatalf("expected wrapped cause to be reachable")
+	}
+
+	if !errors.Is(err, apierror.ErrValidationFailed) {
+		t.Fatalf("expected error to match ErrValidationFailed")
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	cases := map[apierror.Code]int{
+		apierror.CodeValidationFailed:     http.StatusBadRequest,
+		apierror.CodeDatas3tNotFound:      http.StatusNotFound,
+		apierror.CodeDatarangeOverlap:     http.StatusConflict,
+		apierror.CodeDatarangeLeased:      http.StatusConflict,
+		apierror.CodeDatarangeRestoring:   http.StatusConflict,
+		apierror.CodeReplicaNotFound:      http.StatusNotFound,
+		apierror.CodeRangeNotFullyCovered: http.StatusUnprocessableEntity,
+		apierror.CodeInternal:             http.StatusInternalServerError,
+		apierror.Code("unknown"):          http.StatusInternalServerError,
+	}
+
+	for code, expected := range cases {
+		if code.HTTPStatus() != expected {
+			t.Errorf("%s: expected %d, got %d", code, expected, code.HTTPStatus())
+		}
+	}
+}
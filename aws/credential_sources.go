@@ -0,0 +1,144 @@
+package aws
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// CredentialFileScheme prefixes credentials read from a file, e.g.
+	// file:///run/secrets/s3-secret-key
+	CredentialFileScheme = "file://"
+
+	// CredentialEnvScheme prefixes credentials read from an environment variable of the
+	// server, e.g. env:DATAS3T_S3_SECRET_KEY
+	CredentialEnvScheme = "env:"
+
+	// maxCredentialFileSize is the size of the largest credential file read
+	maxCredentialFileSize = 64 * 1024
+)
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// IsCredentialReference reports whether a credential refers to a file or an environment
+// variable instead of holding the value
+func IsCredentialReference(value string) bool {
+	return strings.HasPrefix(value, CredentialFileScheme) || strings.HasPrefix(value, CredentialEnvScheme)
+}
+
+// ValidateCredentialReference checks the syntax of a credential reference, credentials
+// holding their value are always valid
+func ValidateCredentialReference(value string) error {
+	switch {
+	case strings.HasPrefix(value, CredentialFileScheme):
+		path := strings.TrimPrefix(value, CredentialFileScheme)
+		if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+			return fmt.Errorf("credential file reference %q must name a clean absolute path", value)
+		}
+	case strings.HasPrefix(value, CredentialEnvScheme):
+		name := strings.TrimPrefix(value, CredentialEnvScheme)
+		if !envNameRegex.MatchString(name) {
+			return fmt.Errorf("credential environment reference %q must name a valid environment variable", value)
+		}
+	}
+
+	return nil
+}
+
+// CredentialSources limits where credential references are resolved from. References
+// are followed by the server on behalf of API clients, so files are only read below
+// FilesDir and environment variables are only read when their name starts with EnvPrefix.
+// The zero value resolves no references.
+type CredentialSources struct {
+	// FilesDir is the directory credential files are read from, file references are
+	// refused when it is empty
+	FilesDir string
+	// EnvPrefix is the prefix of the environment variables credentials are read from,
+	// environment references are refused when it is empty
+	EnvPrefix string
+}
+
+// Resolve returns the value of a credential, reading it from the file or environment
+// variable it refers to. Credentials holding their value are returned unchanged.
+func (s CredentialSources) Resolve(value string) (string, error) {
+	err := ValidateCredentialReference(value)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(value, CredentialFileScheme):
+		return s.resolveFile(strings.TrimPrefix(value, CredentialFileScheme))
+	case strings.HasPrefix(value, CredentialEnvScheme):
+		return s.resolveEnv(strings.TrimPrefix(value, CredentialEnvScheme))
+	default:
+		return value, nil
+	}
+}
+
+func (s CredentialSources) resolveFile(path string) (string, error) {
+	if s.FilesDir == "" {
+		return "", fmt.Errorf("credential file references are not enabled on this server")
+	}
+
+	// Resolve symlinks on both sides, Kubernetes mounts secrets as symlinks into a
+	// timestamped directory
+	dir, err := filepath.EvalSymlinks(s.FilesDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve credential files directory: %w", err)
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve credential file %s: %w", path, err)
+	}
+
+	rel, err := filepath.Rel(dir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("credential file %s is not in the credential files directory %s", path, s.FilesDir)
+	}
+
+	f, err := os.Open(resolved)
+	if err != nil {
+		return "", fmt.Errorf("failed to open credential file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, maxCredentialFileSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read credential file %s: %w", path, err)
+	}
+
+	if len(content) > maxCredentialFileSize {
+		return "", fmt.Errorf("credential file %s is larger than %d bytes", path, maxCredentialFileSize)
+	}
+
+	// Secret files usually end with a newline
+	credential := strings.TrimSpace(string(content))
+	if credential == "" {
+		return "", fmt.Errorf("credential file %s is empty", path)
+	}
+
+	return credential, nil
+}
+
+func (s CredentialSources) resolveEnv(name string) (string, error) {
+	if s.EnvPrefix == "" {
+		return "", fmt.Errorf("credential environment references are not enabled on this server")
+	}
+
+	if !strings.HasPrefix(name, s.EnvPrefix) {
+		return "", fmt.Errorf("credential environment variable %s does not start with %s", name, s.EnvPrefix)
+	}
+
+	credential, found := os.LookupEnv(name)
+	if !found || credential == "" {
+		return "", fmt.Errorf("credential environment variable %s is not set", name)
+	}
+
+	return credential, nil
+}
@@ -0,0 +1,11 @@
+package aws
+
+import "time"
+
+const (
+	// DefaultPresignExpiry is how long presigned URLs stay valid unless configured otherwise
+	DefaultPresignExpiry = 24 * time.Hour
+
+	// MaxPresignExpiry is the longest validity S3 accepts for URLs presigned with SigV4
+	MaxPresignExpiry = 7 * 24 * time.Hour
+)
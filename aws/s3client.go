@@ -41,13 +41,54 @@ func (a *SlogAWSAdapter) Logf(classification logging.Classification, format stri
 	}
 }
 
+const (
+	// DefaultRegion is the region of buckets that do not configure one
+	DefaultRegion = "us-east-1"
+
+	// AddressingStylePath addresses buckets in the path of the endpoint URL, as needed by
+	// most S3 compatible stores
+	AddressingStylePath = "path"
+
+	// AddressingStyleVirtual addresses buckets in the host name of the endpoint URL, as
+	// AWS expects
+	AddressingStyleVirtual = "virtual"
+
+	// CredentialModeStatic authenticates with the configured access key, secret key and
+	// optional session token
+	CredentialModeStatic = "static"
+
+	// CredentialModeAmbient authenticates with the credential chain of the server:
+	// environment variables, shared config, web identity and instance profile
+	CredentialModeAmbient = "ambient"
+)
+
+// RequestTimeout bounds the HTTP requests of S3 clients, except for the operations
+// passed WithoutRequestTimeout
+const RequestTimeout = 30 * time.Second
+
+// transferHTTPClient sends the requests of operations without a request timeout
+var transferHTTPClient = &http.Client{}
+
+// WithoutRequestTimeout is an option of S3 operations transferring or copying object
+// data, whose duration grows with the size of the data. Their requests are bounded by
+// the deadline of their context instead of RequestTimeout.
+func WithoutRequestTimeout(o *s3.Options) {
+	o.HTTPClient = transferHTTPClient
+}
+
 // S3ClientConfig contains configuration for creating an S3 client
 type S3ClientConfig struct {
-	AccessKey string
-	SecretKey string
-	Endpoint  string
-	Region    string
-	Logger    *slog.Logger
+	AccessKey       string
+	SecretKey       string
+	SessionToken    string
+	Endpoint        string
+	Region          string
+	AddressingStyle string // AddressingStylePath unless set
+	CredentialMode  string // CredentialModeStatic unless set
+	// CredentialSources limits where the credentials referring to files or environment
+	// variables are read from
+	CredentialSources CredentialSources
+	Logger            *slog.Logger
 }
 
 // CreateS3Client creates an S3 client with consistent logging integration and configuration
@@ -55,7 +96,7 @@ func CreateS3Client(ctx context.Context, cfg S3ClientConfig) (*s3.Client, error)
 	// Set default region if not provided
 	region := cfg.Region
 	if region == "" {
-		region = "us-east-1"
+		region = DefaultRegion
 	}
 
 	// Normalize endpoint to ensure it has proper protocol scheme
@@ -67,13 +108,18 @@ func CreateS3Client(ctx context.Context, cfg S3ClientConfig) (*s3.Client, error)
 
 	var configOptions []func(*config.LoadOptions) error
 
-	// Add credentials if provided
-	if cfg.AccessKey != "" && cfg.SecretKey != "" {
+	// Add credentials if provided, the ambient mode leaves them to the default credential chain
+	if cfg.CredentialMode != CredentialModeAmbient && cfg.AccessKey != "" && cfg.SecretKey != "" {
+		accessKey, secretKey, sessionToken, err := cfg.resolveCredentials()
+		if err != nil {
+			return nil, err
+		}
+
 		configOptions = append(configOptions,
 			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-				cfg.AccessKey,
-				cfg.SecretKey,
-				"", // token
+				accessKey,
+				secretKey,
+				sessionToken,
 			)),
 		)
 	}
@@ -84,7 +130,7 @@ func CreateS3Client(ctx context.Context, cfg S3ClientConfig) (*s3.Client, error)
 	// Set HTTP client with timeout
 	configOptions = append(configOptions,
 		config.WithHTTPClient(&http.Client{
-			Timeout: 30 * time.Second, // 30 second timeout for all HTTP operations
+			Timeout: RequestTimeout,
 		}),
 	)
 
@@ -107,10 +153,34 @@ func CreateS3Client(ctx context.Context, cfg S3ClientConfig) (*s3.Client, error)
 	if endpoint != "" {
 		s3Options = append(s3Options, func(o *s3.Options) {
 			o.BaseEndpoint = aws.String(endpoint)
-			o.UsePathStyle = true // Use path-style addressing for custom S3 endpoints
 		})
 	}
 
+	// Use path-style addressing unless virtual-hosted addressing is asked for
+	s3Options = append(s3Options, func(o *s3.Options) {
+		o.UsePathStyle = cfg.AddressingStyle != AddressingStyleVirtual
+	})
+
 	s3Client := s3.NewFromConfig(awsCfg, s3Options...)
 	return s3Client, nil
 }
+
+// resolveCredentials reads the credentials referring to files or environment variables
+func (cfg S3ClientConfig) resolveCredentials() (accessKey, secretKey, sessionToken string, err error) {
+	accessKey, err = cfg.CredentialSources.Resolve(cfg.AccessKey)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to resolve access key: %w", err)
+	}
+
+	secretKey, err = cfg.CredentialSources.Resolve(cfg.SecretKey)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to resolve secret key: %w", err)
+	}
+
+	sessionToken, err = cfg.CredentialSources.Resolve(cfg.SessionToken)
+	if err != nil {
+		return "", "", "", fmt.Errorf("failed to resolve session token: %w", err)
+	}
+
+	return accessKey, secretKey, sessionToken, nil
+}
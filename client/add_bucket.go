@@ -35,7 +35,7 @@ func (c *Client) AddBucket(ctx context.Context, bucket *BucketInfo) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("failed to add bucket: %s", resp.Status)
+		return fmt.Errorf("failed to add bucket: %w", newAPIError(resp))
 	}
 
 	return nil
@@ -35,7 +35,7 @@ func (c *Client) AddDatas3t(ctx context.Context, datas3t *AddDatas3tRequest) err
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("failed to add datas3t: %s", resp.Status)
+		return fmt.Errorf("failed to add datas3t: %w", newAPIError(resp))
 	}
 
 	return nil
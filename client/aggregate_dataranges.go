@@ -12,6 +12,7 @@ import (
 	"sync"
 
 	"github.com/cenkalti/backoff/v4"
+	"github.com/draganm/datas3t/crypto"
 	"github.com/draganm/datas3t/tarindex"
 	"golang.org/x/sync/errgroup"
 )
@@ -42,7 +43,9 @@ func DefaultAggregateOptions() *AggregateOptions {
 	}
 }
 
-// AggregateDataRanges combines multiple existing dataranges into a single aggregate datarange
+// AggregateDataRanges combines multiple existing dataranges into a single aggregate datarange.
+// The datapoints of encrypted dataranges are decrypted and encrypted again with the data key
+// of the aggregate.
 func (c *Client) AggregateDataRanges(ctx context.Context, datas3tName string, firstDatapointIndex, lastDatapointIndex uint64, opts *AggregateOptions) (err error) {
 	if opts == nil {
 		opts = DefaultAggregateOptions()
@@ -98,9 +101,22 @@ func (c *Client) AggregateDataRanges(ctx context.Context, datas3tName string, fi
 	}
 	tracker.nextStep()
 
+	// The aggregate of encrypted dataranges gets a data key of its own
+	var dataCipher *crypto.DataCipher
+	var wrappedDataKey string
+	for _, source := range sourceData {
+		if source.WrappedDataKey != "" {
+			dataCipher, wrappedDataKey, err = c.newDataKey()
+			if err != nil {
+				return err
+			}
+			break
+		}
+	}
+
 	// Phase 3: Merge TAR files and create aggregate index
 	tracker.reportProgress(PhaseMergingTars, "Merging TAR files", 0)
-	aggregatedTarFile, aggregatedIndex, err := c.mergeTarFiles(sourceData, opts.TempDir, tracker)
+	aggregatedTarFile, aggregatedIndex, err := c.mergeTarFiles(sourceData, dataCipher, opts.TempDir, tracker)
 	if err != nil {
 		return fmt.Errorf("failed to merge TAR files: %w", err)
 	}
@@ -121,20 +137,20 @@ func (c *Client) AggregateDataRanges(ctx context.Context, datas3tName string, fi
 	var uploadIDs []string
 	if aggregateResp.UseDirectPut {
 		// Direct PUT for small aggregates
-		err = c.uploadAggregateDataDirectPutFromFile(ctx, aggregateResp.PresignedDataPutURL, aggregatedTarFile, opts.MaxRetries, tracker)
+		err = c.uploadAggregateDataDirectPutFromFile(ctx, aggregateResp.PresignedDataPutURL, aggregateResp.PutHeaders, aggregatedTarFile, opts.MaxRetries, tracker)
 		if err != nil {
 			return fmt.Errorf("failed to upload aggregate data: %w", err)
 		}
 	} else {
 		// Multipart upload for large aggregates
-		uploadIDs, err = c.uploadAggregateDataMultipartFromFile(ctx, aggregateResp.PresignedMultipartUploadPutURLs, aggregatedTarFile, opts, tracker)
+		uploadIDs, err = c.uploadAggregateDataMultipartFromFile(ctx, aggregateResp.PresignedMultipartUploadPutURLs, aggregateResp.PartHeaders, aggregatedTarFile, opts, tracker)
 		if err != nil {
 			return fmt.Errorf("failed to upload aggregate data: %w", err)
 		}
 	}
 
 	// Upload aggregate index
-	err = uploadIndexWithRetry(ctx, aggregateResp.PresignedIndexPutURL, aggregatedIndex, opts.MaxRetries, tracker)
+	err = uploadIndexWithRetry(ctx, aggregateResp.PresignedIndexPutURL, aggregateResp.PutHeaders, aggregatedIndex, opts.MaxRetries, tracker)
 	if err != nil {
 		return fmt.Errorf("failed to upload aggregate index: %w", err)
 	}
@@ -145,6 +161,7 @@ func (c *Client) AggregateDataRanges(ctx context.Context, datas3tName string, fi
 	completeReq := &CompleteAggregateRequest{
 		AggregateUploadID: aggregateResp.AggregateUploadID,
 		UploadIDs:         uploadIDs,
+		WrappedDataKey:    wrappedDataKey,
 	}
 
 	err = c.CompleteAggregate(ctx, completeReq)
@@ -165,6 +182,9 @@ type sourceDataInfo struct {
 	MaxDatapoint int64
 	Data         []byte
 	Index        []byte
+
+	// WrappedDataKey is set for encrypted dataranges
+	WrappedDataKey string
 }
 
 // downloadSourceDataranges downloads all source dataranges in parallel
@@ -182,13 +202,13 @@ func (c *Client) downloadSourceDataranges(ctx context.Context, sources []Dataran
 		i, source := i, source // capture loop variables
 		g.Go(func() error {
 			// Download data
-			dataBytes, err := c.downloadWithRetry(ctx, source.PresignedDataURL, opts.MaxRetries)
+			dataBytes, err := c.downloadWithRetry(ctx, source.PresignedDataURL, source.Headers, opts.MaxRetries)
 			if err != nil {
 				return fmt.Errorf("failed to download data for datarange %d: %w", source.DatarangeID, err)
 			}
 
 			// Download index
-			indexBytes, err := c.downloadWithRetry(ctx, source.PresignedIndexURL, opts.MaxRetries)
+			indexBytes, err := c.downloadWithRetry(ctx, source.PresignedIndexURL, source.Headers, opts.MaxRetries)
 			if err != nil {
 				return fmt.Errorf("failed to download index for datarange %d: %w", source.DatarangeID, err)
 			}
@@ -199,6 +219,8 @@ func (c *Client) downloadSourceDataranges(ctx context.Context, sources []Dataran
 				MaxDatapoint: source.MaxDatapointKey,
 				Data:         dataBytes,
 				Index:        indexBytes,
+
+				WrappedDataKey: source.WrappedDataKey,
 			}
 
 			// Update progress
@@ -226,11 +248,17 @@ func (c *Client) downloadSourceDataranges(ctx context.Context, sources []Dataran
 }
 
 // downloadWithRetry downloads data from a URL with retry logic
-func (c *Client) downloadWithRetry(ctx context.Context, url string, maxRetries int) ([]byte, error) {
+func (c *Client) downloadWithRetry(ctx context.Context, url string, headers map[string]string, maxRetries int) ([]byte, error) {
 	var data []byte
 
 	operation := func() error {
-		resp, err := http.Get(url)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+		if err != nil {
+			return err
+		}
+		setPresignedHeaders(req, headers)
+
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return err
 		}
@@ -259,8 +287,10 @@ func (c *Client) downloadWithRetry(ctx context.Context, url string, maxRetries i
 	return data, nil
 }
 
-// mergeTarFiles combines multiple TAR files into a single TAR with continuous datapoint indices
-func (c *Client) mergeTarFiles(sources []sourceDataInfo, tempDir string, tracker *progressTracker) (*os.File, []byte, error) {
+// mergeTarFiles combines multiple TAR files into a single TAR with continuous datapoint indices.
+// With a data cipher, the content of the encrypted sources is encrypted again with it.
+// Encrypted content keeps its size, so the aggregate has the size of its sources.
+func (c *Client) mergeTarFiles(sources []sourceDataInfo, dataCipher *crypto.DataCipher, tempDir string, tracker *progressTracker) (*os.File, []byte, error) {
 	// Create temporary file for aggregated tar
 	tempFile, err := os.CreateTemp(tempDir, "aggregate-*.tar")
 	if err != nil {
@@ -276,6 +306,14 @@ func (c *Client) mergeTarFiles(sources []sourceDataInfo, tempDir string, tracker
 		reader := bytes.NewReader(source.Data)
 		tr := tar.NewReader(reader)
 
+		var sourceCipher *crypto.DataCipher
+		if dataCipher != nil {
+			sourceCipher, err = c.unwrapDataKey(source.WrappedDataKey)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to unwrap data key of datarange %d: %w", source.DatarangeID, err)
+			}
+		}
+
 		for {
 			header, err := tr.Next()
 			if err == io.EOF {
@@ -291,7 +329,7 @@ func (c *Client) mergeTarFiles(sources []sourceDataInfo, tempDir string, tracker
 			}
 
 			// Extract original datapoint key from filename for validation
-			_, err = extractDatapointKeyFromFileName(header.Name)
+			key, err := extractDatapointKeyFromFileName(header.Name)
 			if err != nil {
 				return nil, nil, fmt.Errorf("invalid filename in source TAR: %w", err)
 			}
@@ -302,6 +340,16 @@ func (c *Client) mergeTarFiles(sources []sourceDataInfo, tempDir string, tracker
 				return nil, nil, fmt.Errorf("failed to write tar header: %w", err)
 			}
 
+			if dataCipher != nil {
+				err = reencryptDatapoint(tw, tr, sourceCipher, uint64(key-source.MinDatapoint), dataCipher, uint64(key-sources[0].MinDatapoint))
+				if err != nil {
+					return nil, nil, fmt.Errorf("failed to encrypt datapoint %d: %w", key, err)
+				}
+
+				currentDatapoint++
+				continue
+			}
+
 			// Copy file content
 			_, err = io.Copy(tw, tr)
 			if err != nil {
@@ -348,8 +396,29 @@ func (c *Client) mergeTarFiles(sources []sourceDataInfo, tempDir string, tracker
 	return tempFile, indexData, nil
 }
 
+// reencryptDatapoint decrypts the content of a datapoint read from r at its position in the
+// source datarange and writes it to w encrypted at its position in the aggregate
+func reencryptDatapoint(w io.Writer, r io.Reader, sourceCipher *crypto.DataCipher, sourcePosition uint64, dataCipher *crypto.DataCipher, position uint64) error {
+	ciphertext, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("failed to read file content: %w", err)
+	}
+
+	plaintext, err := sourceCipher.Decrypt(sourcePosition, ciphertext)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(dataCipher.Encrypt(position, plaintext))
+	if err != nil {
+		return fmt.Errorf("failed to write file content: %w", err)
+	}
+
+	return nil
+}
+
 // uploadAggregateDataDirectPutFromFile uploads aggregate data from a file using direct PUT
-func (c *Client) uploadAggregateDataDirectPutFromFile(ctx context.Context, url string, file *os.File, maxRetries int, tracker *progressTracker) error {
+func (c *Client) uploadAggregateDataDirectPutFromFile(ctx context.Context, url string, headers map[string]string, file *os.File, maxRetries int, tracker *progressTracker) error {
 	operation := func() error {
 		// Get file size for content length
 		fileInfo, err := file.Stat()
@@ -368,6 +437,7 @@ func (c *Client) uploadAggregateDataDirectPutFromFile(ctx context.Context, url s
 			return err
 		}
 		req.ContentLength = fileInfo.Size()
+		setPresignedHeaders(req, headers)
 
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
@@ -393,7 +463,7 @@ func (c *Client) uploadAggregateDataDirectPutFromFile(ctx context.Context, url s
 }
 
 // uploadAggregateDataMultipartFromFile uploads aggregate data from a file using multipart upload
-func (c *Client) uploadAggregateDataMultipartFromFile(ctx context.Context, urls []string, file *os.File, opts *AggregateOptions, tracker *progressTracker) ([]string, error) {
+func (c *Client) uploadAggregateDataMultipartFromFile(ctx context.Context, urls []string, headers map[string]string, file *os.File, opts *AggregateOptions, tracker *progressTracker) ([]string, error) {
 	numParts := len(urls)
 	if numParts == 0 {
 		return nil, fmt.Errorf("no upload URLs provided")
@@ -433,7 +503,7 @@ func (c *Client) uploadAggregateDataMultipartFromFile(ctx context.Context, urls
 			}
 
 			// Upload chunk with retry
-			etag, err := c.uploadChunkFromFileWithRetry(ctx, url, file, offset, partSize, opts.MaxRetries, tracker, i+1, numParts)
+			etag, err := c.uploadChunkFromFileWithRetry(ctx, url, headers, file, offset, partSize, opts.MaxRetries, tracker, i+1, numParts)
 			if err != nil {
 				return fmt.Errorf("failed to upload part %d: %w", i+1, err)
 			}
@@ -451,7 +521,7 @@ func (c *Client) uploadAggregateDataMultipartFromFile(ctx context.Context, urls
 }
 
 // uploadChunkFromFileWithRetry uploads a single chunk from a file with retry logic for aggregate data
-func (c *Client) uploadChunkFromFileWithRetry(ctx context.Context, url string, file *os.File, offset, size int64, maxRetries int, tracker *progressTracker, partNum, totalParts int) (string, error) {
+func (c *Client) uploadChunkFromFileWithRetry(ctx context.Context, url string, headers map[string]string, file *os.File, offset, size int64, maxRetries int, tracker *progressTracker, partNum, totalParts int) (string, error) {
 	var etag string
 
 	operation := func() error {
@@ -463,6 +533,7 @@ func (c *Client) uploadChunkFromFileWithRetry(ctx context.Context, url string, f
 			return err
 		}
 		req.ContentLength = size
+		setPresignedHeaders(req, headers)
 
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
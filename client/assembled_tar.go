@@ -0,0 +1,102 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"sort"
+
+	"github.com/draganm/datas3t/tarindex"
+)
+
+// assembledTar is a tar archive that is assembled while it is read. Only the header
+// blocks are kept in memory, the content of every file is read from its source.
+type assembledTar struct {
+	entries []assembledTarEntry
+	index   []byte
+	size    int64
+}
+
+type assembledTarEntry struct {
+	// header holds all header blocks of the entry, including extended headers
+	header         []byte
+	headerPosition int64
+	size           int64
+	// readContent fills p with the content of the file at off
+	readContent func(p []byte, off int64) error
+}
+
+func (e *assembledTarEntry) contentPosition() int64 {
+	return e.headerPosition + int64(len(e.header))
+}
+
+func (e *assembledTarEntry) end() int64 {
+	return e.contentPosition() + (e.size+tarBlockSize-1)/tarBlockSize*tarBlockSize
+}
+
+// add appends a file to the archive and to its index
+func (t *assembledTar) add(header []byte, size int64, readContent func(p []byte, off int64) error) {
+	t.entries = append(t.entries, assembledTarEntry{
+		header:         header,
+		headerPosition: t.size,
+		size:           size,
+		readContent:    readContent,
+	})
+	t.index = tarindex.AppendIndexEntry(t.index, t.size, uint16(len(header)/tarBlockSize), size)
+	t.size = t.entries[len(t.entries)-1].end()
+}
+
+// close terminates the archive after the last file
+func (t *assembledTar) close() {
+	// Two zero blocks terminate the archive
+	t.size += 2 * tarBlockSize
+}
+
+func (t *assembledTar) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	// First entry that ends after off
+	entry := sort.Search(len(t.entries), func(i int) bool {
+		return t.entries[i].end() > off
+	})
+
+	n := 0
+	for n < len(p) && off < t.size {
+		var read int
+		switch {
+		case entry == len(t.entries):
+			// End of archive blocks
+			read = int(min(int64(len(p)-n), t.size-off))
+			clear(p[n : n+read])
+		case off < t.entries[entry].contentPosition():
+			e := &t.entries[entry]
+			read = copy(p[n:], e.header[off-e.headerPosition:])
+		case off < t.entries[entry].contentPosition()+t.entries[entry].size:
+			e := &t.entries[entry]
+			contentOffset := off - e.contentPosition()
+			read = int(min(int64(len(p)-n), e.size-contentOffset))
+			err := e.readContent(p[n:n+read], contentOffset)
+			if err != nil {
+				return n, err
+			}
+		default:
+			// Padding up to the next block
+			read = int(min(int64(len(p)-n), t.entries[entry].end()-off))
+			clear(p[n : n+read])
+		}
+
+		n += read
+		off += int64(read)
+
+		if entry < len(t.entries) && off >= t.entries[entry].end() {
+			entry++
+		}
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
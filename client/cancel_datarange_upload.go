@@ -30,9 +30,10 @@ func (c *Client) CancelDatarangeUpload(ctx context.Context, r *CancelUploadReque
 	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to cancel datarange upload: %s", resp.Status)
+		return fmt.Errorf("failed to cancel datarange upload: %w", newAPIError(resp))
 	}
 
 	return nil
@@ -0,0 +1,53 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// CheckReadiness queries the server's readiness endpoint. A not-ready server
+// responds with 503 and still returns the report describing the failed checks.
+func (c *Client) CheckReadiness(ctx context.Context, checkBuckets bool) (*ReadinessReport, error) {
+	ur, err := url.JoinPath(c.baseURL, "readyz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	u, err := url.Parse(ur)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	if checkBuckets {
+		q := u.Query()
+		q.Set("check_buckets", "true")
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check readiness: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, fmt.Errorf("failed to check readiness: %w", newAPIError(resp))
+	}
+
+	var report ReadinessReport
+	err = json.NewDecoder(resp.Body).Decode(&report)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &report, nil
+}
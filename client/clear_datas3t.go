@@ -39,7 +39,7 @@ func (c *Client) ClearDatas3t(ctx context.Context, req *ClearDatas3tRequest) (*C
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to clear datas3t: %s", resp.Status)
+		return nil, fmt.Errorf("failed to clear datas3t: %w", newAPIError(resp))
 	}
 
 	var response ClearDatas3tResponse
@@ -1,7 +1,12 @@
 package client
 
+import "github.com/draganm/datas3t/crypto"
+
 type Client struct {
 	baseURL string
+
+	// dataKeys wraps the data keys of encrypted datas3ts, see SetDataEncryptionKey
+	dataKeys *crypto.CredentialEncryptor
 }
 
 func NewClient(baseURL string) *Client {
@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 )
@@ -36,8 +35,7 @@ func (c *Client) CompleteAggregate(ctx context.Context, r *CompleteAggregateRequ
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("failed to complete aggregate: %s: %s", resp.Status, string(body))
+		return fmt.Errorf("failed to complete aggregate: %w", newAPIError(resp))
 	}
 
 	return nil
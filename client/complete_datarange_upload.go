@@ -35,7 +35,7 @@ func (c *Client) CompleteDatarangeUpload(ctx context.Context, r *CompleteUploadR
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to complete datarange upload: %s", resp.Status)
+		return fmt.Errorf("failed to complete datarange upload: %w", newAPIError(resp))
 	}
 
 	return nil
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/draganm/datas3t/crypto"
+)
+
+// ErrDataEncryptionKeyRequired is returned when datapoints of an encrypted datas3t are
+// uploaded or downloaded by a client without a data encryption key
+var ErrDataEncryptionKeyRequired = errors.New("datas3t is encrypted, a data encryption key is required")
+
+// SetDataEncryptionKey sets the base64-encoded key the data keys of encrypted datas3ts are
+// wrapped with. Every datarange uploaded to an encrypted datas3t has a random data key
+// its datapoint content is encrypted with; the key only leaves the client wrapped.
+// Data keys wrapped with one of the decryption keys, e.g. before the key was rotated,
+// are unwrapped as well. It must be called before the client is used.
+func (c *Client) SetDataEncryptionKey(base64Key string, decryptionKeys ...string) error {
+	dataKeys, err := crypto.NewCredentialEncryptor(base64Key)
+	if err != nil {
+		return fmt.Errorf("invalid data encryption key: %w", err)
+	}
+
+	err = dataKeys.AddDecryptionKeys(decryptionKeys...)
+	if err != nil {
+		return err
+	}
+
+	c.dataKeys = dataKeys
+	return nil
+}
+
+// datas3tEncrypted reports whether the content of the datapoints uploaded to a datas3t
+// has to be encrypted. Without a data encryption key the server is left to refuse
+// uploads to encrypted datas3ts.
+func (c *Client) datas3tEncrypted(ctx context.Context, datas3tName string) (bool, error) {
+	if c.dataKeys == nil {
+		return false, nil
+	}
+
+	datas3ts, err := c.ListDatas3tsWithOptions(ctx, &ListDatas3tsRequest{NamePrefix: datas3tName})
+	if err != nil {
+		return false, fmt.Errorf("failed to look up datas3t %s: %w", datas3tName, err)
+	}
+
+	for _, datas3t := range datas3ts {
+		if datas3t.Datas3tName == datas3tName {
+			return datas3t.Encrypted, nil
+		}
+	}
+
+	// Uploading to a missing datas3t fails with ErrDatas3tNotFound
+	return false, nil
+}
+
+// newDataKey generates the data key of a datarange and returns its cipher and the
+// wrapped key stored with the datarange
+func (c *Client) newDataKey() (*crypto.DataCipher, string, error) {
+	if c.dataKeys == nil {
+		return nil, "", ErrDataEncryptionKeyRequired
+	}
+
+	dataKey, err := crypto.NewDataKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	wrapped, err := c.dataKeys.WrapDataKey(dataKey)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	dataCipher, err := crypto.NewDataCipher(dataKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return dataCipher, wrapped, nil
+}
+
+// unwrapDataKey returns the cipher of a wrapped data key
+func (c *Client) unwrapDataKey(wrapped string) (*crypto.DataCipher, error) {
+	if c.dataKeys == nil {
+		return nil, ErrDataEncryptionKeyRequired
+	}
+
+	dataKey, err := c.dataKeys.UnwrapDataKey(wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto.NewDataCipher(dataKey)
+}
+
+// DatapointDecrypter decrypts the files read from the download segments of encrypted
+// dataranges. Files of dataranges that are not encrypted are returned unchanged.
+type DatapointDecrypter struct {
+	client   *Client
+	segments []DownloadSegment
+	ciphers  map[string]*crypto.DataCipher
+}
+
+// NewDatapointDecrypter creates a decrypter for the files of download segments returned
+// by PreSignDownloadForDatapoints
+func (c *Client) NewDatapointDecrypter(segments []DownloadSegment) *DatapointDecrypter {
+	return &DatapointDecrypter{
+		client:   c,
+		segments: segments,
+		ciphers:  map[string]*crypto.DataCipher{},
+	}
+}
+
+// Encrypted reports whether any of the segments belongs to an encrypted datarange
+func (d *DatapointDecrypter) Encrypted() bool {
+	for _, segment := range d.segments {
+		if segment.WrappedDataKey != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Decrypt returns the decrypted content of the file with the given name
+func (d *DatapointDecrypter) Decrypt(name string, content []byte) ([]byte, error) {
+	if !d.Encrypted() {
+		return content, nil
+	}
+
+	key, err := extractDatapointKeyFromFileName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename '%s': %w", name, err)
+	}
+
+	// The segments are ordered by the first datapoint key of their datarange
+	i := sort.Search(len(d.segments), func(i int) bool {
+		return d.segments[i].DatarangeMinDatapointKey > key
+	}) - 1
+	if i < 0 {
+		return nil, fmt.Errorf("datapoint %d is not part of any download segment", key)
+	}
+
+	segment := d.segments[i]
+	if segment.WrappedDataKey == "" {
+		return content, nil
+	}
+
+	dataCipher, found := d.ciphers[segment.WrappedDataKey]
+	if !found {
+		dataCipher, err = d.client.unwrapDataKey(segment.WrappedDataKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap data key of %s: %w", segment.ObjectKey, err)
+		}
+		d.ciphers[segment.WrappedDataKey] = dataCipher
+	}
+
+	plaintext, err := dataCipher.Decrypt(uint64(key-segment.DatarangeMinDatapointKey), content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt datapoint %d: %w", key, err)
+	}
+
+	return plaintext, nil
+}
+
+// decryptTar copies the TAR archive read from r to w with the content of every file decrypted
+func (d *DatapointDecrypter) decryptTar(w io.Writer, r io.Reader) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar entry: %w", err)
+		}
+
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("failed to read content of %s: %w", header.Name, err)
+		}
+
+		content, err = d.Decrypt(header.Name, content)
+		if err != nil {
+			return err
+		}
+
+		header.Size = int64(len(content))
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to write tar header of %s: %w", header.Name, err)
+		}
+
+		_, err = tw.Write(content)
+		if err != nil {
+			return fmt.Errorf("failed to write content of %s: %w", header.Name, err)
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close tar writer: %w", err)
+	}
+
+	return nil
+}
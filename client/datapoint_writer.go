@@ -0,0 +1,448 @@
+package client
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draganm/datas3t/tarindex"
+	"golang.org/x/sync/errgroup"
+)
+
+// ErrDatapointWriterClosed is returned when writing to a closed DatapointWriter
+var ErrDatapointWriterClosed = errors.New("datapoint writer is closed")
+
+// DatapointWriterOptions configures when a DatapointWriter cuts a datarange and how it uploads it
+type DatapointWriterOptions struct {
+	// MaxDatarangeSize cuts the current datarange once its tar archive reaches this many bytes (default: 256MB)
+	MaxDatarangeSize int64
+	// MaxDatapoints cuts the current datarange once it holds this many datapoints (default: unlimited)
+	MaxDatapoints int
+	// MaxDatarangeAge cuts the current datarange this long after its first datapoint was written (default: never)
+	MaxDatarangeAge time.Duration
+	// MaxConcurrentUploads bounds the number of dataranges uploaded in the background at the same time.
+	// Writes block while this many uploads are in flight (default: 2)
+	MaxConcurrentUploads int
+	// TempDir is the directory for the tar archives being written (default: os.TempDir())
+	TempDir string
+	// UploadOptions configures the upload of each datarange (default: DefaultUploadOptions())
+	UploadOptions *UploadOptions
+	// Append lets the server allocate the keys of each datarange when it is uploaded.
+	// Datapoints are then written with AppendDatapoint instead of WriteDatapoint.
+	Append bool
+	// OnDatarangeUploaded is called after a datarange has been uploaded successfully
+	OnDatarangeUploaded func(firstDatapoint, lastDatapoint uint64)
+}
+
+// DefaultDatapointWriterOptions returns sensible default options
+func DefaultDatapointWriterOptions() *DatapointWriterOptions {
+	return &DatapointWriterOptions{
+		MaxDatarangeSize:     256 * 1024 * 1024,
+		MaxConcurrentUploads: 2,
+		UploadOptions:        DefaultUploadOptions(),
+	}
+}
+
+// DatapointWriter accepts datapoints one at a time, writes them into a tar archive with
+// an incrementally built index and uploads the archive as a datarange whenever a size,
+// count or age threshold is reached. Datapoints must be written in increasing key order;
+// a gap between two consecutive keys starts a new datarange. In append mode the datapoints
+// are numbered by the server instead, in the order in which they were written.
+type DatapointWriter struct {
+	client      *Client
+	datas3tName string
+	opts        DatapointWriterOptions
+
+	// mu is held while writing, cutting and waiting for uploads. Background uploads
+	// never take it.
+	mu      sync.Mutex
+	current *pendingDatarange
+	lastKey *uint64
+	closed  bool
+
+	// cutErr is the error of a datarange that could not be finished, its datapoints are
+	// lost and the writer is unusable
+	cutErr error
+
+	ctx       context.Context
+	uploads   *errgroup.Group
+	uploadCtx context.Context
+}
+
+// pendingDatarange is the tar archive of the datarange currently being written
+type pendingDatarange struct {
+	file     *os.File
+	counter  *countingWriter
+	tw       *tar.Writer
+	index    []byte
+	firstKey uint64
+	count    uint64
+	timer    *time.Timer
+}
+
+type countingWriter struct {
+	w *os.File
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// NewDatapointWriter creates a writer that uploads the written datapoints to the given datas3t.
+// Close must be called to upload the last datarange and wait for all uploads to finish.
+func (c *Client) NewDatapointWriter(ctx context.Context, datas3tName string, opts *DatapointWriterOptions) (*DatapointWriter, error) {
+	if datas3tName == "" {
+		return nil, ValidationError(fmt.Errorf("datas3t name is required"))
+	}
+
+	defaults := DefaultDatapointWriterOptions()
+	if opts == nil {
+		opts = defaults
+	}
+
+	o := *opts
+	if o.MaxDatarangeSize <= 0 {
+		o.MaxDatarangeSize = defaults.MaxDatarangeSize
+	}
+	if o.MaxConcurrentUploads <= 0 {
+		o.MaxConcurrentUploads = defaults.MaxConcurrentUploads
+	}
+	if o.UploadOptions == nil {
+		o.UploadOptions = defaults.UploadOptions
+	}
+	if o.MaxDatapoints < 0 {
+		return nil, ValidationError(fmt.Errorf("max datapoints cannot be negative"))
+	}
+
+	w := &DatapointWriter{
+		client:      c,
+		datas3tName: datas3tName,
+		opts:        o,
+		ctx:         ctx,
+	}
+	w.resetUploads()
+
+	return w, nil
+}
+
+// resetUploads starts a new group for background uploads. An errgroup's context is
+// cancelled once Wait returns, so a group cannot be reused after waiting for it.
+func (w *DatapointWriter) resetUploads() {
+	w.uploads, w.uploadCtx = errgroup.WithContext(w.ctx)
+	w.uploads.SetLimit(w.opts.MaxConcurrentUploads)
+}
+
+// validateExtension ensures that "%020d.<extension>" is a valid datapoint file name
+// that fits into a single tar header block.
+func validateExtension(extension string) error {
+	if extension == "" {
+		return fmt.Errorf("extension is required")
+	}
+
+	if len(extension) > 79 {
+		return fmt.Errorf("extension cannot be longer than 79 characters")
+	}
+
+	if strings.ContainsAny(extension, "/\x00") {
+		return fmt.Errorf("extension cannot contain '/' or NUL characters")
+	}
+
+	return nil
+}
+
+// WriteDatapoint adds a datapoint with the given key, file extension (e.g. "json") and content.
+// It returns the error of a failed background upload, after which the writer is unusable.
+func (w *DatapointWriter) WriteDatapoint(key uint64, extension string, data []byte) error {
+	if w.opts.Append {
+		return ValidationError(fmt.Errorf("datapoint keys are allocated by the server in append mode, use AppendDatapoint"))
+	}
+
+	err := validateExtension(extension)
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err = w.checkWritableLocked()
+	if err != nil {
+		return err
+	}
+
+	if w.lastKey != nil && key <= *w.lastKey {
+		return ValidationError(fmt.Errorf("datapoint key %d must be greater than the previous key %d", key, *w.lastKey))
+	}
+
+	// Dataranges must be contiguous, a gap ends the current datarange
+	if w.current != nil && key != *w.lastKey+1 {
+		err = w.cutLocked()
+		if err != nil {
+			return err
+		}
+	}
+
+	if w.current == nil {
+		err = w.startLocked(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = w.current.writeDatapoint(key, extension, data)
+	if err != nil {
+		return err
+	}
+	w.lastKey = &key
+
+	return w.cutIfFullLocked()
+}
+
+// AppendDatapoint adds a datapoint with the given file extension (e.g. "json") and content
+// to a writer in append mode. The server assigns the keys when the datarange is uploaded,
+// they are reported through OnDatarangeUploaded.
+func (w *DatapointWriter) AppendDatapoint(extension string, data []byte) error {
+	if !w.opts.Append {
+		return ValidationError(fmt.Errorf("the writer is not in append mode, use WriteDatapoint"))
+	}
+
+	err := validateExtension(extension)
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	err = w.checkWritableLocked()
+	if err != nil {
+		return err
+	}
+
+	if w.current == nil {
+		err = w.startLocked(0)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Keys are relative to the datarange and renamed to the allocated keys while uploading
+	err = w.current.writeDatapoint(w.current.count, extension, data)
+	if err != nil {
+		return err
+	}
+
+	return w.cutIfFullLocked()
+}
+
+func (w *DatapointWriter) checkWritableLocked() error {
+	if w.closed {
+		return ErrDatapointWriterClosed
+	}
+
+	if w.cutErr != nil {
+		return w.cutErr
+	}
+
+	if w.uploadCtx.Err() != nil {
+		return fmt.Errorf("background upload failed: %w", context.Cause(w.uploadCtx))
+	}
+
+	return nil
+}
+
+func (w *DatapointWriter) cutIfFullLocked() error {
+	if w.current.counter.n >= w.opts.MaxDatarangeSize ||
+		(w.opts.MaxDatapoints > 0 && w.current.count >= uint64(w.opts.MaxDatapoints)) {
+		return w.cutLocked()
+	}
+
+	return nil
+}
+
+// Flush uploads the current datarange, even if no threshold was reached, and waits
+// until all dataranges written so far are uploaded.
+func (w *DatapointWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrDatapointWriterClosed
+	}
+
+	return w.flushLocked()
+}
+
+// Close uploads the current datarange and waits for all background uploads to finish.
+func (w *DatapointWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrDatapointWriterClosed
+	}
+	w.closed = true
+
+	return w.flushLocked()
+}
+
+func (w *DatapointWriter) flushLocked() error {
+	// The datapoints of a failed cut are lost, the uploads in flight are still waited for
+	err := w.cutErr
+	if err == nil {
+		err = w.cutLocked()
+	}
+
+	waitErr := w.uploads.Wait()
+	if waitErr != nil {
+		// Keep the failed group so that further writes report the error
+		return errors.Join(err, fmt.Errorf("background upload failed: %w", waitErr))
+	}
+
+	w.resetUploads()
+
+	return err
+}
+
+func (w *DatapointWriter) startLocked(firstKey uint64) error {
+	file, err := os.CreateTemp(w.opts.TempDir, "datas3t-datarange-*.tar")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary tar file: %w", err)
+	}
+
+	counter := &countingWriter{w: file}
+	current := &pendingDatarange{
+		file:     file,
+		counter:  counter,
+		tw:       tar.NewWriter(counter),
+		firstKey: firstKey,
+	}
+
+	if w.opts.MaxDatarangeAge > 0 {
+		current.timer = time.AfterFunc(w.opts.MaxDatarangeAge, func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+
+			// The datarange may have been cut in the meantime
+			if w.current != current {
+				return
+			}
+
+			// A failed cut is recorded and reported by the next write, flush or close
+			_ = w.cutLocked()
+		})
+	}
+
+	w.current = current
+	return nil
+}
+
+func (p *pendingDatarange) writeDatapoint(key uint64, extension string, data []byte) error {
+	headerPosition := p.counter.n
+
+	err := p.tw.WriteHeader(&tar.Header{
+		Name:     fmt.Sprintf("%020d.%s", key, extension),
+		Size:     int64(len(data)),
+		Mode:     0644,
+		Typeflag: tar.TypeReg,
+		Format:   tar.FormatUSTAR,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write tar header: %w", err)
+	}
+
+	_, err = p.tw.Write(data)
+	if err != nil {
+		return fmt.Errorf("failed to write datapoint content: %w", err)
+	}
+
+	// Write the padding now so that the next header position is known
+	err = p.tw.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush tar writer: %w", err)
+	}
+
+	p.index = tarindex.AppendIndexEntry(p.index, headerPosition, 1, int64(len(data)))
+	p.count++
+
+	return nil
+}
+
+func (p *pendingDatarange) discard() {
+	p.file.Close()
+	os.Remove(p.file.Name())
+}
+
+// cutLocked finishes the current datarange and hands it over to a background upload
+func (w *DatapointWriter) cutLocked() error {
+	current := w.current
+	if current == nil {
+		return nil
+	}
+	w.current = nil
+
+	if current.timer != nil {
+		current.timer.Stop()
+	}
+
+	err := current.tw.Close()
+	if err != nil {
+		current.discard()
+		w.cutErr = fmt.Errorf("failed to finish tar archive of %d datapoints: %w", current.count, err)
+		return w.cutErr
+	}
+
+	ctx := w.uploadCtx
+	opts := w.opts
+
+	if ctx.Err() != nil {
+		current.discard()
+		return fmt.Errorf("background upload failed: %w", context.Cause(ctx))
+	}
+
+	// Blocks while MaxConcurrentUploads uploads are in flight
+	w.uploads.Go(func() error {
+		defer current.discard()
+
+		uploadReq := &UploadDatarangeRequest{
+			Datas3tName:        w.datas3tName,
+			DataSize:           uint64(current.counter.n),
+			NumberOfDatapoints: current.count,
+			Append:             opts.Append,
+		}
+		if !opts.Append {
+			uploadReq.FirstDatapointIndex = current.firstKey
+		}
+
+		firstKey, err := w.client.uploadIndexedDatarange(
+			ctx,
+			uploadReq,
+			current.file,
+			current.index,
+			opts.UploadOptions,
+			newProgressTracker(opts.UploadOptions.ProgressCallback, current.counter.n),
+		)
+		if err != nil {
+			if opts.Append {
+				return fmt.Errorf("failed to append %d datapoints: %w", current.count, err)
+			}
+			return fmt.Errorf("failed to upload datapoints %d-%d: %w", current.firstKey, current.firstKey+current.count-1, err)
+		}
+
+		if opts.OnDatarangeUploaded != nil {
+			opts.OnDatarangeUploaded(firstKey, firstKey+current.count-1)
+		}
+
+		return nil
+	})
+
+	return nil
+}
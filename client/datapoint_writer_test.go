@@ -0,0 +1,340 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUploadServer accepts direct PUT datarange uploads and records the dataranges that
+// were started
+type fakeUploadServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	dataranges []UploadDatarangeRequest
+	failStart  bool
+	// blockPuts holds uploads of objects until it is closed
+	blockPuts chan struct{}
+}
+
+func newFakeUploadServer(t *testing.T) *fakeUploadServer {
+	f := &fakeUploadServer{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/upload-datarange", func(w http.ResponseWriter, r *http.Request) {
+		var req UploadDatarangeRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if f.failStart {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"error":{"code":"internal_error","message":"start failed"}}`)
+			return
+		}
+
+		f.dataranges = append(f.dataranges, req)
+
+		json.NewEncoder(w).Encode(UploadDatarangeResponse{
+			DatarangeID:          int64(len(f.dataranges)),
+			FirstDatapointIndex:  req.FirstDatapointIndex,
+			UseDirectPut:         true,
+			PresignedDataPutURL:  f.URL + "/objects/data",
+			PresignedIndexPutURL: f.URL + "/objects/index",
+		})
+	})
+	mux.HandleFunc("PUT /objects/", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		blockPuts := f.blockPuts
+		f.mu.Unlock()
+
+		if blockPuts != nil {
+			<-blockPuts
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /api/v1/upload-datarange/complete", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /api/v1/upload-datarange/cancel", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// uploaded returns the first datapoint and number of datapoints of the started uploads,
+// ordered by their first datapoint as uploads run concurrently
+func (f *fakeUploadServer) uploaded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	dataranges := slices.Clone(f.dataranges)
+	slices.SortFunc(dataranges, func(a, b UploadDatarangeRequest) int {
+		return cmp.Compare(a.FirstDatapointIndex, b.FirstDatapointIndex)
+	})
+
+	var result []string
+	for _, datarange := range dataranges {
+		result = append(result, fmt.Sprintf("%d+%d", datarange.FirstDatapointIndex, datarange.NumberOfDatapoints))
+	}
+
+	return result
+}
+
+func newTestDatapointWriter(t *testing.T, server *fakeUploadServer, opts *DatapointWriterOptions) *DatapointWriter {
+	opts.TempDir = t.TempDir()
+	opts.UploadOptions = DefaultUploadOptions()
+	opts.UploadOptions.MaxRetries = 0
+
+	w, err := NewClient(server.URL).NewDatapointWriter(context.Background(), "test-datas3t", opts)
+	if err != nil {
+		t.Fatalf("NewDatapointWriter failed: %v", err)
+	}
+
+	return w
+}
+
+func writeDatapoints(t *testing.T, w *DatapointWriter, first, last uint64) {
+	for key := first; key <= last; key++ {
+		err := w.WriteDatapoint(key, "txt", []byte(fmt.Sprintf("datapoint %d", key)))
+		if err != nil {
+			t.Fatalf("WriteDatapoint %d failed: %v", key, err)
+		}
+	}
+}
+
+// waitForFailedCut waits until the age timer failed to cut the current datarange
+func waitForFailedCut(t *testing.T, w *DatapointWriter) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w.mu.Lock()
+		cutErr := w.cutErr
+		w.mu.Unlock()
+		if cutErr != nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("datarange was not cut after its max age")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDatapointWriterCutsAtMaxDatapoints(t *testing.T) {
+	server := newFakeUploadServer(t)
+	w := newTestDatapointWriter(t, server, &DatapointWriterOptions{MaxDatapoints: 3})
+
+	writeDatapoints(t, w, 0, 6)
+
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got := strings.Join(server.uploaded(), ",")
+	if got != "0+3,3+3,6+1" {
+		t.Errorf("unexpected dataranges %s", got)
+	}
+}
+
+func TestDatapointWriterCutsAtMaxDatarangeSize(t *testing.T) {
+	server := newFakeUploadServer(t)
+
+	// Every datapoint takes a header block and a block of content
+	w := newTestDatapointWriter(t, server, &DatapointWriterOptions{MaxDatarangeSize: 2 * 1024})
+
+	writeDatapoints(t, w, 10, 14)
+
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got := strings.Join(server.uploaded(), ",")
+	if got != "10+2,12+2,14+1" {
+		t.Errorf("unexpected dataranges %s", got)
+	}
+}
+
+func TestDatapointWriterCutsAtMaxDatarangeAge(t *testing.T) {
+	server := newFakeUploadServer(t)
+
+	uploaded := make(chan uint64, 1)
+	w := newTestDatapointWriter(t, server, &DatapointWriterOptions{
+		MaxDatarangeAge: 50 * time.Millisecond,
+		OnDatarangeUploaded: func(firstDatapoint, lastDatapoint uint64) {
+			uploaded <- lastDatapoint
+		},
+	})
+
+	writeDatapoints(t, w, 0, 1)
+
+	select {
+	case last := <-uploaded:
+		if last != 1 {
+			t.Errorf("expected datapoints 0-1 to be uploaded, got 0-%d", last)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("datarange was not cut after its max age")
+	}
+
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	got := strings.Join(server.uploaded(), ",")
+	if got != "0+2" {
+		t.Errorf("unexpected dataranges %s", got)
+	}
+}
+
+func TestDatapointWriterReportsFailedAgeCut(t *testing.T) {
+	server := newFakeUploadServer(t)
+	w := newTestDatapointWriter(t, server, &DatapointWriterOptions{MaxDatarangeAge: 50 * time.Millisecond})
+
+	writeDatapoints(t, w, 0, 1)
+
+	// Finishing the tar archive fails once its file is closed
+	w.mu.Lock()
+	w.current.file.Close()
+	w.mu.Unlock()
+
+	waitForFailedCut(t, w)
+
+	err := w.WriteDatapoint(2, "txt", []byte("datapoint 2"))
+	if err == nil || !strings.Contains(err.Error(), "failed to finish tar archive") {
+		t.Errorf("expected WriteDatapoint to report the failed cut, got %v", err)
+	}
+
+	err = w.Flush()
+	if err == nil || !strings.Contains(err.Error(), "failed to finish tar archive") {
+		t.Errorf("expected Flush to report the failed cut, got %v", err)
+	}
+
+	err = w.Close()
+	if err == nil || !strings.Contains(err.Error(), "failed to finish tar archive") {
+		t.Errorf("expected Close to report the failed cut, got %v", err)
+	}
+
+	if uploaded := server.uploaded(); len(uploaded) != 0 {
+		t.Errorf("expected no uploads, got %v", uploaded)
+	}
+}
+
+func TestDatapointWriterCloseAfterFailedCutWaitsForUploads(t *testing.T) {
+	server := newFakeUploadServer(t)
+	blockPuts := make(chan struct{})
+	server.blockPuts = blockPuts
+	releasePuts := sync.OnceFunc(func() { close(blockPuts) })
+	t.Cleanup(releasePuts)
+
+	uploaded := make(chan uint64, 1)
+	w := newTestDatapointWriter(t, server, &DatapointWriterOptions{
+		MaxDatapoints:   2,
+		MaxDatarangeAge: 50 * time.Millisecond,
+		OnDatarangeUploaded: func(firstDatapoint, lastDatapoint uint64) {
+			uploaded <- lastDatapoint
+		},
+	})
+
+	// The first datarange is cut and its upload blocks
+	writeDatapoints(t, w, 0, 2)
+
+	// Finishing the tar archive of the second datarange fails once its file is closed
+	w.mu.Lock()
+	w.current.file.Close()
+	w.mu.Unlock()
+
+	waitForFailedCut(t, w)
+
+	closed := make(chan error, 1)
+	go func() {
+		closed <- w.Close()
+	}()
+
+	select {
+	case err := <-closed:
+		t.Fatalf("Close returned while an upload was in flight: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	releasePuts()
+
+	select {
+	case err := <-closed:
+		if err == nil || !strings.Contains(err.Error(), "failed to finish tar archive") {
+			t.Errorf("expected Close to report the failed cut, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Close did not return after the upload finished")
+	}
+
+	select {
+	case last := <-uploaded:
+		if last != 1 {
+			t.Errorf("expected datapoints 0-1 to be uploaded, got 0-%d", last)
+		}
+	default:
+		t.Errorf("expected the in-flight upload to finish before Close returned")
+	}
+}
+
+func TestDatapointWriterReportsFailedUpload(t *testing.T) {
+	server := newFakeUploadServer(t)
+	server.failStart = true
+	w := newTestDatapointWriter(t, server, &DatapointWriterOptions{MaxDatapoints: 1})
+
+	writeDatapoints(t, w, 0, 0)
+
+	err := w.Flush()
+	if !errors.Is(err, ErrInternal) {
+		t.Errorf("expected Flush to report the failed upload, got %v", err)
+	}
+
+	err = w.WriteDatapoint(1, "txt", []byte("datapoint 1"))
+	if !errors.Is(err, ErrInternal) {
+		t.Errorf("expected WriteDatapoint to report the failed upload, got %v", err)
+	}
+
+	err = w.Close()
+	if !errors.Is(err, ErrInternal) {
+		t.Errorf("expected Close to report the failed upload, got %v", err)
+	}
+}
+
+func TestDatapointWriterRejectsWritesAfterClose(t *testing.T) {
+	server := newFakeUploadServer(t)
+	w := newTestDatapointWriter(t, server, &DatapointWriterOptions{})
+
+	err := w.Close()
+	if err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	err = w.WriteDatapoint(0, "txt", []byte("datapoint 0"))
+	if !errors.Is(err, ErrDatapointWriterClosed) {
+		t.Errorf("expected ErrDatapointWriterClosed, got %v", err)
+	}
+}
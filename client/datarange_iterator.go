@@ -14,7 +14,8 @@ const (
 )
 
 // DatapointIterator creates an iterator that progressively loads chunks of max 5MB
-// and yields individual datapoint file contents from the tar stream
+// and yields individual datapoint file contents from the tar stream. The content of
+// encrypted dataranges is decrypted.
 func (c *Client) DatapointIterator(ctx context.Context, datas3tName string, firstDatapoint, lastDatapoint uint64) iter.Seq2[[]byte, error] {
 	return func(yield func([]byte, error) bool) {
 		// Get presigned download URLs for the datapoints
@@ -35,12 +36,14 @@ func (c *Client) DatapointIterator(ctx context.Context, datas3tName string, firs
 			return
 		}
 
-		// Pass download segments directly to newDatarangeReader
-		r := newDatarangeReader(ctx, MaxChunkSize, resp.DownloadSegments)
+		// Stream the download segments, refreshing their URLs if they expire
+		urls := c.downloadSegmentURLs(datas3tName, resp.DownloadSegments, 0)
+		r := newDatarangeReader(ctx, MaxChunkSize, resp.DownloadSegments, urls)
 		tr := tar.NewReader(r)
+		decrypter := c.NewDatapointDecrypter(resp.DownloadSegments)
 
 		for {
-			_, err := tr.Next()
+			header, err := tr.Next()
 			if err == io.EOF {
 				break
 			}
@@ -53,6 +56,11 @@ func (c *Client) DatapointIterator(ctx context.Context, datas3tName string, firs
 				yield(nil, err)
 				return
 			}
+			data, err = decrypter.Decrypt(header.Name, data)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
 			if !yield(data, nil) {
 				return
 			}
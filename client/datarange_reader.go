@@ -16,62 +16,84 @@ func (dr datarangeReader) Read(p []byte) (n int, err error) {
 	return dr(p)
 }
 
-func newDatarangeReader(ctx context.Context, chunkSize uint64, segments []DownloadSegment) io.Reader {
-	remainingSegments := slices.Clone(segments)
+// newDatarangeReader streams the segments in chunks of at most chunkSize bytes. The
+// presigned URL and headers of the i-th segment are those of the i-th segment of urls.
+func newDatarangeReader(ctx context.Context, chunkSize uint64, segments []DownloadSegment, urls *segmentURLs) io.Reader {
+	segments = slices.Clone(segments)
+	currentSegmentIndex := 0
 	readAheadBuffer := []byte{}
 
-	fillBuffer := func() error {
-		if len(remainingSegments) == 0 {
-			return io.EOF
-		}
-
-		currentSegment := &remainingSegments[0]
-
-		// Parse the current segment's range
-		start, end, err := parseRangeHeader(currentSegment.Range)
-		if err != nil {
-			return fmt.Errorf("failed to parse range header %s: %w", currentSegment.Range, err)
-		}
-
-		req, err := http.NewRequestWithContext(ctx, "GET", currentSegment.PresignedURL, nil)
+	fetch := func(url string, headers map[string]string, start, end uint64) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return err
 		}
-
-		if (end - start + 1) > chunkSize {
-			readAheadBuffer = make([]byte, chunkSize)
-			// Update the segment's range for the next read
-			newStart := start + chunkSize
-			currentSegment.Range = fmt.Sprintf("bytes=%d-%d", newStart, end)
-			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+chunkSize-1))
-		} else {
-			readAheadBuffer = make([]byte, end-start+1)
-			// Remove this segment since we're reading it completely
-			remainingSegments = remainingSegments[1:]
-			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
-		}
+		setPresignedHeaders(req, headers)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
 
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			return err
+			return bucketRequestError(ctx, err)
 		}
 
 		defer resp.Body.Close()
 
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("HTTP %d: %w", resp.StatusCode, errBucketUnavailable)
+		}
+
 		switch resp.StatusCode {
 		case http.StatusPartialContent:
 		case http.StatusOK:
+		case http.StatusForbidden:
+			return fmt.Errorf("HTTP %d: %w", resp.StatusCode, errPresignedURLRejected)
 		default:
 			return fmt.Errorf("expected status code %d, got %d", http.StatusPartialContent, resp.StatusCode)
 		}
 
-		n, err := io.ReadFull(resp.Body, readAheadBuffer)
+		buffer := make([]byte, end-start+1)
+		n, err := io.ReadFull(resp.Body, buffer)
+		if err != nil {
+			return err
+		}
+
+		if n != len(buffer) {
+			return fmt.Errorf("expected to read %d bytes, got %d", len(buffer), n)
+		}
+
+		readAheadBuffer = buffer
+
+		return nil
+	}
+
+	fillBuffer := func() error {
+		if currentSegmentIndex == len(segments) {
+			return io.EOF
+		}
+
+		currentSegment := &segments[currentSegmentIndex]
+
+		// Parse the current segment's range
+		start, end, err := parseRangeHeader(currentSegment.Range)
+		if err != nil {
+			return fmt.Errorf("failed to parse range header %s: %w", currentSegment.Range, err)
+		}
+
+		chunkEnd := min(end, start+chunkSize-1)
+
+		err = urls.do(ctx, currentSegmentIndex, func(segment DownloadSegment) error {
+			return fetch(segment.PresignedURL, segment.Headers, start, chunkEnd)
+		})
 		if err != nil {
 			return err
 		}
 
-		if n != len(readAheadBuffer) {
-			return fmt.Errorf("expected to read %d bytes, got %d", len(readAheadBuffer), n)
+		if chunkEnd < end {
+			// Update the segment's range for the next read
+			currentSegment.Range = fmt.Sprintf("bytes=%d-%d", chunkEnd+1, end)
+		} else {
+			// Move on since this segment has been read completely
+			currentSegmentIndex++
 		}
 
 		return nil
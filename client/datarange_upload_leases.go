@@ -0,0 +1,130 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// RenewDatarangeUploadLease extends the lease of a pending upload, or takes a lease for
+// an upload that was started without one or whose lease has expired.
+func (c *Client) RenewDatarangeUploadLease(ctx context.Context, r *RenewLeaseRequest) (*RenewLeaseResponse, error) {
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "upload-datarange", "renew-lease")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ur, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to renew datarange upload lease: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to renew datarange upload lease: %w", newAPIError(resp))
+	}
+
+	var response RenewLeaseResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
+
+// ListDatarangeUploadLeases returns the active leases of the pending uploads of a datas3t
+func (c *Client) ListDatarangeUploadLeases(ctx context.Context, datas3tName string) ([]LeaseInfo, error) {
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "upload-datarange", "leases")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	u, err := url.Parse(ur)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("datas3t_name", datas3tName)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list datarange upload leases: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list datarange upload leases: %w", newAPIError(resp))
+	}
+
+	var response ListLeasesResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return response.Leases, nil
+}
+
+// keepLeaseAlive renews the lease of an upload every half lease duration until stop is
+// called. The returned context is cancelled when the lease cannot be renewed anymore,
+// which aborts the upload before another producer's upload of the same range is wasted.
+func (c *Client) keepLeaseAlive(ctx context.Context, datarangeUploadID int64, leaseDuration time.Duration) (context.Context, func()) {
+	leaseCtx, cancel := context.WithCancelCause(ctx)
+	done := make(chan struct{})
+
+	go func() {
+		ticker := time.NewTicker(leaseDuration / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-leaseCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			_, err := c.RenewDatarangeUploadLease(leaseCtx, &RenewLeaseRequest{
+				DatarangeUploadID:    datarangeUploadID,
+				LeaseDurationSeconds: int64(leaseDuration / time.Second),
+			})
+			// Network and server failures are retried with the next tick, the lease is
+			// still valid for another half lease duration
+			var apiErr *APIError
+			if errors.As(err, &apiErr) && !apiErr.Temporary() {
+				cancel(fmt.Errorf("failed to renew lease: %w", err))
+				return
+			}
+		}
+	}()
+
+	return leaseCtx, func() {
+		close(done)
+		cancel(nil)
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type DeleteBucketRequest struct {
+	Name string `json:"name"`
+}
+
+type DeleteBucketResponse struct{}
+
+func (r *DeleteBucketRequest) Validate() error {
+	if r.Name == "" {
+		return ValidationError(fmt.Errorf("name is required"))
+	}
+	return nil
+}
+
+// DeleteBucket removes a bucket configuration. It fails with ErrBucketInUse while
+// datas3ts use the bucket.
+func (c *Client) DeleteBucket(ctx context.Context, req *DeleteBucketRequest) (*DeleteBucketResponse, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "buckets")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal delete request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "DELETE", ur, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete bucket: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to delete bucket: %w", newAPIError(resp))
+	}
+
+	var response DeleteBucketResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode delete response: %w", err)
+	}
+
+	return &response, nil
+}
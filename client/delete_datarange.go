@@ -33,7 +33,7 @@ func (c *Client) DeleteDatarange(ctx context.Context, r *DeleteDatarangeRequest)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to delete datarange: %s", resp.Status)
+		return fmt.Errorf("failed to delete datarange: %w", newAPIError(resp))
 	}
 
 	return nil
@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 )
@@ -18,7 +17,7 @@ type DeleteDatas3tResponse struct{}
 
 func (r *DeleteDatas3tRequest) Validate() error {
 	if r.Name == "" {
-		return fmt.Errorf("name is required")
+		return ValidationError(fmt.Errorf("name is required"))
 	}
 	return nil
 }
@@ -52,19 +51,8 @@ func (c *Client) DeleteDatas3t(ctx context.Context, req *DeleteDatas3tRequest) (
 
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusConflict {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("cannot delete datas3t: %s", string(bodyBytes))
-	}
-
-	if resp.StatusCode == http.StatusNotFound {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("datas3t not found: %s", string(bodyBytes))
-	}
-
 	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to delete datas3t (status %d): %s", resp.StatusCode, string(bodyBytes))
+		return nil, fmt.Errorf("failed to delete datas3t: %w", newAPIError(resp))
 	}
 
 	var response DeleteDatas3tResponse
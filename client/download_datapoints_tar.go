@@ -21,7 +21,7 @@ const (
 
 // downloadChunk represents a chunk to be downloaded
 type downloadChunk struct {
-	URL        string
+	Segment    int // Index of the download segment the chunk belongs to
 	StartByte  int64
 	EndByte    int64
 	FileOffset int64
@@ -33,6 +33,15 @@ type DownloadOptions struct {
 	MaxParallelism int   // Maximum number of concurrent downloads (default: 4)
 	MaxRetries     int   // Maximum number of retry attempts per chunk (default: 3)
 	ChunkSize      int64 // Size of each chunk in bytes (default: 5MB)
+
+	// PresignExpiry is how long the presigned download URLs stay valid, they are
+	// refreshed when they expire (default: server setting)
+	PresignExpiry time.Duration
+
+	// UseReplica downloads from the replica of the datas3t, e.g. while its bucket is
+	// unavailable. Without it only dataranges the bucket fails for are served from the
+	// replica, and downloads fail over to it once requests to the bucket fail.
+	UseReplica bool
 }
 
 // DefaultDownloadOptions returns sensible default options
@@ -86,7 +95,7 @@ func (c *Client) createChunksForSegments(segments []DownloadSegment, chunkSize i
 	var chunks []downloadChunk
 	var currentFileOffset int64
 
-	for _, segment := range segments {
+	for segmentIndex, segment := range segments {
 		segmentSize, err := c.parseSegmentSize(segment.Range)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse segment range: %w", err)
@@ -111,7 +120,7 @@ func (c *Client) createChunksForSegments(segments []DownloadSegment, chunkSize i
 			actualChunkSize := chunkEndByte - currentByte + 1
 
 			chunks = append(chunks, downloadChunk{
-				URL:        segment.PresignedURL,
+				Segment:    segmentIndex,
 				StartByte:  currentByte,
 				EndByte:    chunkEndByte,
 				FileOffset: currentChunkFileOffset,
@@ -133,7 +142,8 @@ func (c *Client) DownloadDatapointsTar(ctx context.Context, datas3tName string,
 	return c.DownloadDatapointsTarWithOptions(ctx, datas3tName, firstDatapoint, lastDatapoint, outputPath, nil)
 }
 
-// DownloadDatapointsTarWithOptions downloads a range of datapoints as a TAR file with configurable options
+// DownloadDatapointsTarWithOptions downloads a range of datapoints as a TAR file with configurable options.
+// Encrypted datapoints are downloaded next to the output file and decrypted into it.
 func (c *Client) DownloadDatapointsTarWithOptions(ctx context.Context, datas3tName string, firstDatapoint, lastDatapoint uint64, outputPath string, opts *DownloadOptions) error {
 	if opts == nil {
 		opts = DefaultDownloadOptions()
@@ -144,6 +154,11 @@ func (c *Client) DownloadDatapointsTarWithOptions(ctx context.Context, datas3tNa
 		Datas3tName:    datas3tName,
 		FirstDatapoint: firstDatapoint,
 		LastDatapoint:  lastDatapoint,
+		UseReplica:     opts.UseReplica,
+	}
+
+	if opts.PresignExpiry > 0 {
+		req.PresignExpirySeconds = int64(max(opts.PresignExpiry, time.Second) / time.Second)
 	}
 
 	resp, err := c.PreSignDownloadForDatapoints(ctx, req)
@@ -167,11 +182,18 @@ func (c *Client) DownloadDatapointsTarWithOptions(ctx context.Context, datas3tNa
 		totalSize += chunk.Size
 	}
 
+	decrypter := c.NewDatapointDecrypter(resp.DownloadSegments)
+	downloadPath := outputPath
+	if decrypter.Encrypted() {
+		downloadPath = outputPath + ".encrypted"
+		defer os.Remove(downloadPath)
+	}
+
 	// 4. Create output file and pre-allocate space (including termination blocks)
 	finalSize := totalSize + 1024 // Add space for TAR termination blocks
-	outputFile, err := os.Create(outputPath)
+	outputFile, err := os.Create(downloadPath)
 	if err != nil {
-		return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
+		return fmt.Errorf("failed to create output file %s: %w", downloadPath, err)
 	}
 	defer outputFile.Close()
 
@@ -182,6 +204,8 @@ func (c *Client) DownloadDatapointsTarWithOptions(ctx context.Context, datas3tNa
 	}
 
 	// 5. Download all chunks in parallel using errgroup
+	urls := c.downloadSegmentURLs(datas3tName, resp.DownloadSegments, req.PresignExpirySeconds)
+
 	g, ctx := errgroup.WithContext(ctx)
 	g.SetLimit(opts.MaxParallelism)
 
@@ -189,7 +213,9 @@ func (c *Client) DownloadDatapointsTarWithOptions(ctx context.Context, datas3tNa
 		chunk := chunk // capture loop variable
 
 		g.Go(func() error {
-			return c.downloadChunkWithRetry(ctx, chunk, outputFile, opts.MaxRetries)
+			return urls.do(ctx, chunk.Segment, func(segment DownloadSegment) error {
+				return c.downloadChunkWithRetry(ctx, segment.PresignedURL, segment.Headers, chunk, outputFile, opts.MaxRetries)
+			})
 		})
 	}
 
@@ -206,16 +232,33 @@ func (c *Client) DownloadDatapointsTarWithOptions(ctx context.Context, datas3tNa
 		return fmt.Errorf("failed to write TAR termination blocks: %w", err)
 	}
 
+	if decrypter.Encrypted() {
+		// 7. Decrypt the downloaded datapoints into the output file
+		decryptedFile, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to create output file %s: %w", outputPath, err)
+		}
+		defer decryptedFile.Close()
+
+		err = decrypter.decryptTar(decryptedFile, io.NewSectionReader(outputFile, 0, finalSize))
+		if err != nil {
+			return fmt.Errorf("failed to decrypt datapoints: %w", err)
+		}
+
+		return decryptedFile.Close()
+	}
+
 	return nil
 }
 
-// downloadChunkWithRetry downloads a single chunk with exponential backoff retry
-func (c *Client) downloadChunkWithRetry(ctx context.Context, chunk downloadChunk, outputFile *os.File, maxRetries int) error {
+// downloadChunkWithRetry downloads a single chunk from url with exponential backoff retry
+func (c *Client) downloadChunkWithRetry(ctx context.Context, url string, headers map[string]string, chunk downloadChunk, outputFile *os.File, maxRetries int) error {
 	operation := func() error {
-		req, err := http.NewRequestWithContext(ctx, "GET", chunk.URL, nil)
+		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 		if err != nil {
 			return err
 		}
+		setPresignedHeaders(req, headers)
 
 		// Set the Range header for this chunk
 		rangeHeader := fmt.Sprintf("bytes=%d-%d", chunk.StartByte, chunk.EndByte)
@@ -223,16 +266,23 @@ func (c *Client) downloadChunkWithRetry(ctx context.Context, chunk downloadChunk
 
 		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
-			return err
+			return bucketRequestError(ctx, err)
 		}
 		defer resp.Body.Close()
 
 		// Check for successful response (206 Partial Content for range requests)
 		if resp.StatusCode != http.StatusPartialContent {
-			// Handle retryable errors
-			if resp.StatusCode >= 500 || resp.StatusCode == 429 {
+			// Handle retryable errors, failing buckets are failed over by the caller
+			if resp.StatusCode >= 500 {
+				return fmt.Errorf("HTTP %d: %w", resp.StatusCode, errBucketUnavailable)
+			}
+			if resp.StatusCode == 429 {
 				return fmt.Errorf("HTTP %d", resp.StatusCode)
 			}
+			// An expired URL is refreshed by the caller
+			if resp.StatusCode == http.StatusForbidden {
+				return backoff.Permanent(fmt.Errorf("HTTP %d: %w", resp.StatusCode, errPresignedURLRejected))
+			}
 			// Non-retryable error - wrap with Permanent to stop retrying
 			body, _ := io.ReadAll(resp.Body)
 			return backoff.Permanent(fmt.Errorf("unexpected HTTP status: %s, body: %s", resp.Status, string(body)))
@@ -0,0 +1,260 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/draganm/datas3t/crypto"
+)
+
+// encryptedTar is an indexed tar archive with the content of every file encrypted with
+// the data key of its datarange. The files keep their names and offsets in the archive
+// only change by the size of the encrypted content, so the archive and its index are
+// assembled upfront and the content is encrypted while it is read.
+type encryptedTar struct {
+	*assembledTar
+	wrappedDataKey string
+	dataCipher     *crypto.DataCipher
+}
+
+// encryptedTarFile is a file of an encryptedTar. The chunk read last is kept, as parts
+// and buffers rarely end on chunk boundaries.
+type encryptedTarFile struct {
+	archive         *encryptedTar
+	r               io.ReaderAt
+	name            string
+	contentPosition int64
+	size            int64
+	position        uint64
+
+	mu         sync.Mutex
+	chunk      int64
+	ciphertext []byte
+}
+
+// newEncryptedTar encrypts the files of the indexed tar archive in file with a new data
+// key. The position of a file in its datarange is the index entry it belongs to when
+// the files are numbered in archive order, e.g. in append mode, and the offset of its key
+// from the first key otherwise.
+func (c *Client) newEncryptedTar(file io.ReaderAt, index []byte, numberedInArchiveOrder bool) (*encryptedTar, error) {
+	dataCipher, wrappedDataKey, err := c.newDataKey()
+	if err != nil {
+		return nil, err
+	}
+
+	numEntries := len(index) / 16
+	headers := make([]*tar.Header, numEntries)
+	contentPositions := make([]int64, numEntries)
+	keys := make([]int64, numEntries)
+
+	for i := range numEntries {
+		entry := index[i*16 : i*16+16]
+		headerPosition := int64(binary.BigEndian.Uint64(entry[0:8]))
+		headerBlocks := int64(binary.BigEndian.Uint16(entry[8:10]))
+
+		headerData := make([]byte, headerBlocks*tarBlockSize)
+		_, err := file.ReadAt(headerData, headerPosition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar header of entry %d: %w", i, err)
+		}
+
+		header, err := tar.NewReader(bytes.NewReader(headerData)).Next()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse tar header of entry %d: %w", i, err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("entry '%s' is not a regular file", header.Name)
+		}
+
+		key, err := extractDatapointKeyFromFileName(header.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filename '%s': %w", header.Name, err)
+		}
+
+		headers[i] = header
+		contentPositions[i] = headerPosition + int64(len(headerData))
+		keys[i] = key
+	}
+
+	if numEntries == 0 {
+		return nil, fmt.Errorf("no files found in tar archive")
+	}
+
+	firstKey := keys[0]
+	for _, key := range keys {
+		firstKey = min(firstKey, key)
+	}
+
+	t := &encryptedTar{
+		assembledTar:   &assembledTar{},
+		wrappedDataKey: wrappedDataKey,
+		dataCipher:     dataCipher,
+	}
+
+	for i, header := range headers {
+		f := &encryptedTarFile{
+			archive:         t,
+			r:               file,
+			name:            header.Name,
+			contentPosition: contentPositions[i],
+			size:            header.Size,
+			position:        uint64(keys[i] - firstKey),
+			chunk:           -1,
+		}
+		if numberedInArchiveOrder {
+			f.position = uint64(i)
+		}
+
+		encryptedHeader := *header
+		encryptedHeader.Size = crypto.EncryptedSize(header.Size)
+
+		var buf bytes.Buffer
+		err := tar.NewWriter(&buf).WriteHeader(&encryptedHeader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create tar header for '%s': %w", header.Name, err)
+		}
+
+		t.add(buf.Bytes(), encryptedHeader.Size, f.readAt)
+	}
+
+	t.close()
+
+	return t, nil
+}
+
+// useDataKey encrypts the archive with a wrapped data key instead of its own, e.g. the
+// key of a resumed upload. It must be called before the archive is read.
+func (t *encryptedTar) useDataKey(c *Client, wrappedDataKey string) error {
+	dataCipher, err := c.unwrapDataKey(wrappedDataKey)
+	if err != nil {
+		return fmt.Errorf("failed to unwrap data key of the upload: %w", err)
+	}
+
+	t.dataCipher = dataCipher
+	t.wrappedDataKey = wrappedDataKey
+	return nil
+}
+
+// readAt fills p with the encrypted content of the file at off
+func (f *encryptedTarFile) readAt(p []byte, off int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for len(p) > 0 {
+		chunk := off / crypto.EncryptedChunkSize
+		if chunk != f.chunk {
+			err := f.encryptChunk(chunk)
+			if err != nil {
+				return err
+			}
+		}
+
+		n := copy(p, f.ciphertext[off-chunk*crypto.EncryptedChunkSize:])
+		p = p[n:]
+		off += int64(n)
+	}
+
+	return nil
+}
+
+func (f *encryptedTarFile) encryptChunk(chunk int64) error {
+	start := chunk * crypto.DataChunkSize
+	end := min(start+crypto.DataChunkSize, f.size)
+
+	plaintext := make([]byte, end-start)
+	_, err := f.r.ReadAt(plaintext, f.contentPosition+start)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("content of '%s' is truncated: %w", f.name, io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read content of '%s': %w", f.name, err)
+	}
+
+	final := chunk == crypto.NumDataChunks(f.size)-1
+	f.ciphertext = f.archive.dataCipher.EncryptChunk(f.ciphertext[:0], f.position, uint32(chunk), final, plaintext)
+	f.chunk = chunk
+
+	return nil
+}
+
+// newEncryptingTarReader returns the TAR archive read from r with the content of every
+// file encrypted with a new data key, see encryptTarStream, and the wrapped data key.
+// The returned reader must be closed.
+func (c *Client) newEncryptingTarReader(r io.Reader) (io.ReadCloser, string, error) {
+	dataCipher, wrappedDataKey, err := c.newDataKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(encryptTarStream(pw, r, dataCipher))
+	}()
+
+	return pr, wrappedDataKey, nil
+}
+
+// encryptTarStream copies the TAR archive read from r to w with the content of every file
+// encrypted. The files must have contiguous keys in ascending order, their position is
+// the offset from the key of the first file. The zero padding some tar implementations
+// write after the end of the archive is dropped.
+func encryptTarStream(w io.Writer, r io.Reader, dataCipher *crypto.DataCipher) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+
+	var firstKey int64
+	for i := 0; ; i++ {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar entry: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return fmt.Errorf("entry '%s' is not a regular file", header.Name)
+		}
+
+		key, err := extractDatapointKeyFromFileName(header.Name)
+		if err != nil {
+			return fmt.Errorf("invalid filename '%s': %w", header.Name, err)
+		}
+
+		if i == 0 {
+			firstKey = key
+		} else if key != firstKey+int64(i) {
+			return fmt.Errorf("gap in datapoint sequence: expected %d, found %d", firstKey+int64(i), key)
+		}
+
+		size := header.Size
+		header.Size = crypto.EncryptedSize(size)
+		err = tw.WriteHeader(header)
+		if err != nil {
+			return fmt.Errorf("failed to write tar header of %s: %w", header.Name, err)
+		}
+
+		err = dataCipher.EncryptStream(tw, tr, uint64(i), size)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := checkZeroPadding(r)
+	if err != nil {
+		return err
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close tar writer: %w", err)
+	}
+
+	return nil
+}
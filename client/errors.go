@@ -0,0 +1,102 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/draganm/datas3t/apierror"
+)
+
+// Sentinel errors for the error codes returned by the server, usable with errors.Is
+var (
+	ErrInvalidRequest         = apierror.ErrInvalidRequest
+	ErrValidationFailed       = apierror.ErrValidationFailed
+	ErrBucketNotFound         = apierror.ErrBucketNotFound
+	ErrBucketAlreadyExists    = apierror.ErrBucketAlreadyExists
+	ErrBucketInUse            = apierror.ErrBucketInUse
+	ErrDatas3tNotFound        = apierror.ErrDatas3tNotFound
+	ErrDatas3tAlreadyExists   = apierror.ErrDatas3tAlreadyExists
+	ErrDatas3tNotEmpty        = apierror.ErrDatas3tNotEmpty
+	ErrDatarangeNotFound      = apierror.ErrDatarangeNotFound
+	ErrDatarangeOverlap       = apierror.ErrDatarangeOverlap
+	ErrDatarangeLeased        = apierror.ErrDatarangeLeased
+	ErrDatarangeRestoring     = apierror.ErrDatarangeRestoring
+	ErrDatapointsNotFound     = apierror.ErrDatapointsNotFound
+	ErrReplicaNotFound        = apierror.ErrReplicaNotFound
+	ErrUploadNotFound         = apierror.ErrUploadNotFound
+	ErrUploadValidationFailed = apierror.ErrUploadValidationFailed
+	ErrRangeNotFullyCovered   = apierror.ErrRangeNotFullyCovered
+	ErrInsufficientDataranges = apierror.ErrInsufficientDataranges
+	ErrRequestTooLarge        = apierror.ErrRequestTooLarge
+	ErrInternal               = apierror.ErrInternal
+)
+
+// APIError is returned when the server responds with an error status.
+// It matches the sentinel errors above through errors.Is and can be
+// extracted with errors.As to inspect the status code.
+type APIError struct {
+	StatusCode int
+	Code       apierror.Code
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%s (status %d)", e.Message, e.StatusCode)
+	}
+	return fmt.Sprintf("%s (status %d, code %s)", e.Message, e.StatusCode, e.Code)
+}
+
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*apierror.Error)
+	return ok && e.Code != "" && t.Code == e.Code
+}
+
+// Temporary reports whether the request may succeed when retried
+func (e *APIError) Temporary() bool {
+	return e.StatusCode >= 500 || e.StatusCode == http.StatusTooManyRequests
+}
+
+// IsTemporary reports whether err is an APIError for a transient server failure
+func IsTemporary(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Temporary()
+	}
+	return false
+}
+
+// newAPIError builds an APIError from an unsuccessful response, falling back to
+// the raw body for responses that don't carry the JSON error envelope
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+
+	var envelope apierror.Response
+	err := json.Unmarshal(body, &envelope)
+	if err == nil && envelope.Error != nil && envelope.Error.Code != "" {
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Code:       envelope.Error.Code,
+			Message:    envelope.Error.Message,
+		}
+	}
+
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = resp.Status
+	}
+
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    message,
+	}
+	if resp.StatusCode >= 500 {
+		apiErr.Code = apierror.CodeInternal
+	}
+
+	return apiErr
+}
@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// GetDatapointGaps returns the ranges of datapoint keys missing between the
+// lowest and the highest datapoint of a datas3t.
+func (c *Client) GetDatapointGaps(ctx context.Context, datas3tName string) (*GetDatapointGapsResponse, error) {
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "datapoint-gaps")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	// Add query parameter
+	u, err := url.Parse(ur)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("datas3t_name", datas3tName)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datapoint gaps: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get datapoint gaps: %w", newAPIError(resp))
+	}
+
+	var response GetDatapointGapsResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
@@ -39,7 +39,7 @@ func (c *Client) GetDatapointsBitmap(ctx context.Context, datas3tName string) (*
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get datapoints bitmap: %s", resp.Status)
+		return nil, fmt.Errorf("failed to get datapoints bitmap: %w", newAPIError(resp))
 	}
 
 	// Read raw bitmap bytes
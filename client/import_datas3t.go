@@ -35,7 +35,7 @@ func (c *Client) ImportDatas3t(ctx context.Context, req *ImportDatas3tRequest) (
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to import datas3t: %s", resp.Status)
+		return nil, fmt.Errorf("failed to import datas3t: %w", newAPIError(resp))
 	}
 
 	var response ImportDatas3tResponse
@@ -27,7 +27,7 @@ func (c *Client) ListBuckets(ctx context.Context) ([]*BucketListInfo, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to list buckets: %s", resp.Status)
+		return nil, fmt.Errorf("failed to list buckets: %w", newAPIError(resp))
 	}
 
 	var buckets []*BucketListInfo
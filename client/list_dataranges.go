@@ -6,30 +6,65 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"time"
 )
 
+// ListDataranges returns all dataranges of a datas3t ordered by datapoint key,
+// following the server's pagination until the last page.
 func (c *Client) ListDataranges(ctx context.Context, datas3tName string) ([]DatarangeInfo, error) {
+	return c.ListAllDataranges(ctx, &ListDatarangesRequest{Datas3tName: datas3tName})
+}
+
+// ListAllDataranges returns every datarange matching the request, fetching
+// one page after the other starting at req.Cursor.
+func (c *Client) ListAllDataranges(ctx context.Context, req *ListDatarangesRequest) ([]DatarangeInfo, error) {
+	pageReq := *req
+	dataranges := []DatarangeInfo{}
+
+	for {
+		page, err := c.ListDatarangesPage(ctx, &pageReq)
+		if err != nil {
+			return nil, err
+		}
+
+		dataranges = append(dataranges, page.Dataranges...)
+
+		if page.NextCursor == "" {
+			return dataranges, nil
+		}
+
+		pageReq.Cursor = page.NextCursor
+	}
+}
+
+// ListDatarangesPage returns a single page of dataranges matching the request.
+// Pass the returned NextCursor as req.Cursor to fetch the following page.
+func (c *Client) ListDatarangesPage(ctx context.Context, req *ListDatarangesRequest) (*ListDatarangesResponse, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, err
+	}
+
 	ur, err := url.JoinPath(c.baseURL, "api", "v1", "dataranges")
 	if err != nil {
 		return nil, fmt.Errorf("failed to join path: %w", err)
 	}
 
-	// Add query parameter
+	// Add query parameters
 	u, err := url.Parse(ur)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse URL: %w", err)
 	}
 
-	q := u.Query()
-	q.Set("datas3t_name", datas3tName)
-	u.RawQuery = q.Encode()
+	u.RawQuery = req.queryValues().Encode()
 
-	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := http.DefaultClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list dataranges: %w", err)
 	}
@@ -37,7 +72,7 @@ func (c *Client) ListDataranges(ctx context.Context, datas3tName string) ([]Data
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to list dataranges: %s", resp.Status)
+		return nil, fmt.Errorf("failed to list dataranges: %w", newAPIError(resp))
 	}
 
 	var response ListDatarangesResponse
@@ -46,5 +81,43 @@ func (c *Client) ListDataranges(ctx context.Context, datas3tName string) ([]Data
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	return response.Dataranges, nil
-}
\ No newline at end of file
+	return &response, nil
+}
+
+func (r *ListDatarangesRequest) queryValues() url.Values {
+	q := url.Values{}
+	q.Set("datas3t_name", r.Datas3tName)
+
+	setInt64 := func(name string, v *int64) {
+		if v != nil {
+			q.Set(name, strconv.FormatInt(*v, 10))
+		}
+	}
+	setInt64("from_datapoint_key", r.FromDatapointKey)
+	setInt64("to_datapoint_key", r.ToDatapointKey)
+	setInt64("min_size_bytes", r.MinSizeBytes)
+	setInt64("max_size_bytes", r.MaxSizeBytes)
+
+	setTime := func(name string, v *time.Time) {
+		if v != nil {
+			q.Set(name, v.Format(time.RFC3339Nano))
+		}
+	}
+	setTime("created_after", r.CreatedAfter)
+	setTime("created_before", r.CreatedBefore)
+
+	if r.SortBy != "" {
+		q.Set("sort_by", r.SortBy)
+	}
+	if r.SortOrder != "" {
+		q.Set("sort_order", r.SortOrder)
+	}
+	if r.Limit > 0 {
+		q.Set("limit", strconv.Itoa(r.Limit))
+	}
+	if r.Cursor != "" {
+		q.Set("cursor", r.Cursor)
+	}
+
+	return q
+}
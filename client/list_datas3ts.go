@@ -9,17 +9,26 @@ import (
 )
 
 func (c *Client) ListDatas3ts(ctx context.Context) ([]Datas3tInfo, error) {
+	return c.ListDatas3tsWithOptions(ctx, &ListDatas3tsRequest{})
+}
+
+// ListDatas3tsWithOptions lists the datas3ts matching the request filters.
+func (c *Client) ListDatas3tsWithOptions(ctx context.Context, req *ListDatas3tsRequest) ([]Datas3tInfo, error) {
 	ur, err := url.JoinPath(c.baseURL, "api", "v1", "datas3ts")
 	if err != nil {
 		return nil, fmt.Errorf("failed to join path: %w", err)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", ur, nil)
+	if req.NamePrefix != "" {
+		ur += "?" + url.Values{"name_prefix": {req.NamePrefix}}.Encode()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "GET", ur, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := http.DefaultClient.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list datas3ts: %w", err)
 	}
@@ -27,7 +36,7 @@ func (c *Client) ListDatas3ts(ctx context.Context) ([]Datas3tInfo, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to list datas3ts: %s", resp.Status)
+		return nil, fmt.Errorf("failed to list datas3ts: %w", newAPIError(resp))
 	}
 
 	var datas3ts []Datas3tInfo
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// OriginalNamePAXRecord is the PAX record holding the name a file had in the uploaded
+// archive before it was renamed to its datapoint key. It is returned with the tar header
+// of the datapoint on download.
+const OriginalNamePAXRecord = "DATAS3T.original_name"
+
+// mappedFile is a regular file of an archive whose names are not datapoint keys
+type mappedFile struct {
+	header          *tar.Header
+	contentPosition int64
+	key             uint64
+}
+
+// newMappedTar renames the files of the tar archive in file to datapoint keys. Without a
+// mapping the files are numbered in archive order starting at firstKey, otherwise the key
+// of every file is looked up by its name. Directories are skipped. The renamed archive is
+// assembled while it is read, the content of the files is read from file.
+func newMappedTar(file io.ReaderAt, size int64, mapping map[string]uint64, firstKey uint64) (*assembledTar, *TarInfo, error) {
+	reader := io.NewSectionReader(file, 0, size)
+	tr := tar.NewReader(reader)
+
+	var files []mappedFile
+	seen := map[string]bool{}
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read tar entry: %w", err)
+		}
+
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("unsupported tar entry '%s': only regular files and directories are allowed", header.Name)
+		}
+
+		if seen[header.Name] {
+			return nil, nil, fmt.Errorf("duplicate file '%s' in tar archive", header.Name)
+		}
+		seen[header.Name] = true
+
+		key := firstKey + uint64(len(files))
+		if mapping != nil {
+			var ok bool
+			key, ok = mapping[header.Name]
+			if !ok {
+				return nil, nil, fmt.Errorf("no datapoint key mapped for file '%s'", header.Name)
+			}
+		}
+
+		// The tar reader stops at the content of the file
+		contentPosition, err := reader.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get content position of '%s': %w", header.Name, err)
+		}
+
+		files = append(files, mappedFile{
+			header:          header,
+			contentPosition: contentPosition,
+			key:             key,
+		})
+	}
+
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no files found in tar archive")
+	}
+
+	for name := range mapping {
+		if !seen[name] {
+			return nil, nil, fmt.Errorf("mapped file '%s' not found in tar archive", name)
+		}
+	}
+
+	slices.SortFunc(files, func(a, b mappedFile) int {
+		return cmp.Compare(a.key, b.key)
+	})
+
+	first := files[0].key
+	if files[len(files)-1].key > math.MaxInt64 {
+		return nil, nil, fmt.Errorf("datapoint key %d is too large", files[len(files)-1].key)
+	}
+
+	for i, f := range files {
+		expectedKey := first + uint64(i)
+		if f.key != expectedKey {
+			return nil, nil, fmt.Errorf("gap in datapoint sequence: expected %d, found %d for file '%s'", expectedKey, f.key, f.header.Name)
+		}
+	}
+
+	t := &assembledTar{}
+	for _, f := range files {
+		header, err := mappedFileHeader(f)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		contentPosition := f.contentPosition
+		name := f.header.Name
+		t.add(header, f.header.Size, func(p []byte, off int64) error {
+			_, err := file.ReadAt(p, contentPosition+off)
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("content of '%s' is truncated: %w", name, io.ErrUnexpectedEOF)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read content of '%s': %w", name, err)
+			}
+			return nil
+		})
+	}
+
+	t.close()
+
+	return t, &TarInfo{
+		FirstDatapointIndex: int64(first),
+		NumDatapoints:       len(files),
+	}, nil
+}
+
+// mappedFileHeader returns the header blocks of a renamed file. The original name is
+// kept in a PAX record.
+func mappedFileHeader(f mappedFile) ([]byte, error) {
+	extension := strings.TrimPrefix(path.Ext(f.header.Name), ".")
+	if extension == "" {
+		extension = "bin"
+	}
+
+	err := validateExtension(extension)
+	if err != nil {
+		return nil, fmt.Errorf("invalid extension of '%s': %w", f.header.Name, err)
+	}
+
+	var buf bytes.Buffer
+	err = tar.NewWriter(&buf).WriteHeader(&tar.Header{
+		Name:       fmt.Sprintf("%020d.%s", f.key, extension),
+		Size:       f.header.Size,
+		Mode:       f.header.Mode,
+		ModTime:    f.header.ModTime.Truncate(time.Second),
+		Typeflag:   tar.TypeReg,
+		PAXRecords: map[string]string{OriginalNamePAXRecord: f.header.Name},
+		Format:     tar.FormatPAX,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tar header for '%s': %w", f.header.Name, err)
+	}
+
+	return buf.Bytes(), nil
+}
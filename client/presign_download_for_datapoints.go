@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 )
@@ -36,8 +35,7 @@ func (c *Client) PreSignDownloadForDatapoints(ctx context.Context, r *PreSignDow
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to presign download for datapoints: %s: %s", resp.Status, string(body))
+		return nil, fmt.Errorf("failed to presign download for datapoints: %w", newAPIError(resp))
 	}
 
 	var respBody PreSignDownloadForDatapointsResponse
@@ -0,0 +1,205 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+// errPresignedURLRejected is returned when S3 rejects a presigned URL with 403 Forbidden,
+// which is what it answers once the URL has expired
+var errPresignedURLRejected = errors.New("presigned URL was rejected")
+
+// errBucketUnavailable is returned when the bucket behind a presigned URL fails with a
+// server error or cannot be reached
+var errBucketUnavailable = errors.New("bucket is unavailable")
+
+// refreshableURLs holds presigned URLs that are re-issued by the server when S3 rejects
+// them. Concurrent operations failing with the same generation of URLs share one refresh.
+type refreshableURLs struct {
+	mu         sync.Mutex
+	urls       []string
+	generation int
+
+	// refresh returns new URLs, an empty entry keeps the current URL
+	refresh func(ctx context.Context) ([]string, error)
+}
+
+func newRefreshableURLs(urls []string, refresh func(ctx context.Context) ([]string, error)) *refreshableURLs {
+	return &refreshableURLs{
+		urls:    urls,
+		refresh: refresh,
+	}
+}
+
+func (r *refreshableURLs) get(i int) (string, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.urls[i], r.generation
+}
+
+// refreshAfter re-issues the URLs unless they were refreshed since generation
+func (r *refreshableURLs) refreshAfter(ctx context.Context, generation int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.generation != generation {
+		return nil
+	}
+
+	urls, err := r.refresh(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(urls) != len(r.urls) {
+		return fmt.Errorf("expected %d refreshed URLs, got %d", len(r.urls), len(urls))
+	}
+
+	for i, url := range urls {
+		if url != "" {
+			r.urls[i] = url
+		}
+	}
+	r.generation++
+
+	return nil
+}
+
+// do runs op with the i-th URL. If S3 rejects the URL, the URLs are refreshed and op is
+// run once more with the new URL.
+func (r *refreshableURLs) do(ctx context.Context, i int, op func(url string) error) error {
+	url, generation := r.get(i)
+	err := op(url)
+	if !errors.Is(err, errPresignedURLRejected) {
+		return err
+	}
+
+	refreshErr := r.refreshAfter(ctx, generation)
+	if refreshErr != nil {
+		return fmt.Errorf("%w (refreshing the presigned URLs failed: %w)", err, refreshErr)
+	}
+
+	url, _ = r.get(i)
+	return op(url)
+}
+
+// bucketRequestError marks an error of a request to a presigned URL as the bucket being
+// unavailable, unless the request was canceled
+func bucketRequestError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", errBucketUnavailable, err)
+}
+
+// segmentURLs holds the download segments of a datas3t along with their presigned URLs and
+// headers. URLs rejected by S3 are re-presigned by the server. When the bucket of the
+// datas3t is unavailable, all segments are presigned from its replica instead.
+type segmentURLs struct {
+	mu         sync.Mutex
+	segments   []DownloadSegment
+	generation int
+	// useReplica is set once the segments were failed over to the replica
+	useReplica bool
+
+	// refresh presigns the segments again, from the replica if useReplica is set
+	refresh func(ctx context.Context, segments []DownloadSegment, useReplica bool) ([]DownloadSegment, error)
+}
+
+// downloadSegmentURLs wraps the segments so that their URLs are re-presigned by the server
+// once they expire or their bucket fails
+func (c *Client) downloadSegmentURLs(datas3tName string, segments []DownloadSegment, presignExpirySeconds int64) *segmentURLs {
+	return &segmentURLs{
+		segments: slices.Clone(segments),
+		refresh: func(ctx context.Context, segments []DownloadSegment, useReplica bool) ([]DownloadSegment, error) {
+			resp, err := c.RefreshDownloadSegments(ctx, &RefreshDownloadSegmentsRequest{
+				Datas3tName:          datas3tName,
+				Segments:             segments,
+				PresignExpirySeconds: presignExpirySeconds,
+				UseReplica:           useReplica,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return resp.DownloadSegments, nil
+		},
+	}
+}
+
+func (s *segmentURLs) get(i int) (DownloadSegment, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.segments[i], s.generation
+}
+
+// refreshAfter presigns the segments again unless they were refreshed since generation.
+// With failover they are presigned from the replica, unless that already happened.
+func (s *segmentURLs) refreshAfter(ctx context.Context, generation int, failover bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.generation != generation && (!failover || s.useReplica) {
+		return nil
+	}
+
+	useReplica := s.useReplica || failover
+	refreshed, err := s.refresh(ctx, slices.Clone(s.segments), useReplica)
+	if err != nil {
+		return err
+	}
+
+	if len(refreshed) != len(s.segments) {
+		return fmt.Errorf("expected %d refreshed segments, got %d", len(s.segments), len(refreshed))
+	}
+
+	for i, segment := range refreshed {
+		s.segments[i].PresignedURL = segment.PresignedURL
+		s.segments[i].Headers = segment.Headers
+		s.segments[i].Replica = segment.Replica
+	}
+	s.useReplica = useReplica
+	s.generation++
+
+	return nil
+}
+
+// do runs op with the i-th segment. If S3 rejects its URL, the segments are presigned
+// again, and if the bucket of a segment not served from the replica is unavailable, they
+// are presigned from the replica. op is then run once more with the new segment.
+func (s *segmentURLs) do(ctx context.Context, i int, op func(segment DownloadSegment) error) error {
+	segment, generation := s.get(i)
+	err := op(segment)
+
+	var failover bool
+	switch {
+	case errors.Is(err, errPresignedURLRejected):
+	case errors.Is(err, errBucketUnavailable) && !segment.Replica:
+		failover = true
+	default:
+		return err
+	}
+
+	refreshErr := s.refreshAfter(ctx, generation, failover)
+	if refreshErr != nil {
+		return fmt.Errorf("%w (refreshing the presigned URLs failed: %w)", err, refreshErr)
+	}
+
+	segment, _ = s.get(i)
+	return op(segment)
+}
+
+// setPresignedHeaders adds the headers the server returned along with a presigned URL,
+// e.g. the server-side encryption settings of the bucket, to a request to the URL
+func setPresignedHeaders(req *http.Request, headers map[string]string) {
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeReplicatedDatas3t serves the datapoints of a datas3t whose bucket became unreachable
+// after the download was presigned, while its replica still serves the data object
+type fakeReplicatedDatas3t struct {
+	*httptest.Server
+
+	mu               sync.Mutex
+	replicaRefreshes int
+}
+
+func newFakeReplicatedDatas3t(t *testing.T, data []byte) *fakeReplicatedDatas3t {
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "data.tar", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(replica.Close)
+
+	// The primary bucket is gone once the index is cached and the URLs are presigned
+	primary := httptest.NewServer(http.NotFoundHandler())
+	primaryURL := primary.URL + "/data.tar"
+	primary.Close()
+
+	f := &fakeReplicatedDatas3t{}
+
+	segments := func(url string, replica bool) []DownloadSegment {
+		return []DownloadSegment{{
+			PresignedURL: url,
+			Range:        fmt.Sprintf("bytes=0-%d", len(data)-1),
+			ObjectKey:    "data.tar",
+			Replica:      replica,
+		}}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/download", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(PreSignDownloadForDatapointsResponse{
+			DownloadSegments: segments(primaryURL, false),
+		})
+	})
+	mux.HandleFunc("POST /api/v1/download/refresh", func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshDownloadSegmentsRequest
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !req.UseReplica {
+			json.NewEncoder(w).Encode(PreSignDownloadForDatapointsResponse{
+				DownloadSegments: segments(primaryURL, false),
+			})
+			return
+		}
+
+		f.mu.Lock()
+		f.replicaRefreshes++
+		f.mu.Unlock()
+
+		json.NewEncoder(w).Encode(PreSignDownloadForDatapointsResponse{
+			DownloadSegments: segments(replica.URL+"/data.tar", true),
+		})
+	})
+
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeReplicatedDatas3t) refreshesFromReplica() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.replicaRefreshes
+}
+
+func testDatarangeTar(t *testing.T, contents ...string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i, content := range contents {
+		err := tw.WriteHeader(&tar.Header{
+			Name: fmt.Sprintf("%020d.txt", i),
+			Mode: 0o644,
+			Size: int64(len(content)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tw.Write([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The data object of a datarange has no end of archive blocks
+	err := tw.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestDownloadDatapointsTarFailsOverToReplica(t *testing.T) {
+	data := testDatarangeTar(t, "datapoint 0", "datapoint 1")
+	server := newFakeReplicatedDatas3t(t, data)
+
+	opts := DefaultDownloadOptions()
+	opts.MaxRetries = 0
+	outputPath := filepath.Join(t.TempDir(), "datapoints.tar")
+
+	err := NewClient(server.URL).DownloadDatapointsTarWithOptions(context.Background(), "test-datas3t", 0, 1, outputPath, opts)
+	if err != nil {
+		t.Fatalf("DownloadDatapointsTarWithOptions failed: %v", err)
+	}
+
+	downloaded, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(downloaded, data) {
+		t.Errorf("expected the datapoints of the replica to be downloaded")
+	}
+
+	if refreshes := server.refreshesFromReplica(); refreshes != 1 {
+		t.Errorf("expected the segments to be presigned from the replica once, got %d", refreshes)
+	}
+}
+
+func TestDatapointIteratorFailsOverToReplica(t *testing.T) {
+	server := newFakeReplicatedDatas3t(t, testDatarangeTar(t, "datapoint 0", "datapoint 1"))
+
+	var got []string
+	for data, err := range NewClient(server.URL).DatapointIterator(context.Background(), "test-datas3t", 0, 1) {
+		if err != nil {
+			t.Fatalf("DatapointIterator failed: %v", err)
+		}
+		got = append(got, string(data))
+	}
+
+	if strings.Join(got, ",") != "datapoint 0,datapoint 1" {
+		t.Errorf("unexpected datapoints %q", got)
+	}
+
+	if refreshes := server.refreshesFromReplica(); refreshes != 1 {
+		t.Errorf("expected the segments to be presigned from the replica once, got %d", refreshes)
+	}
+}
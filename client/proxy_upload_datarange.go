@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// ProxyUploadDatarange uploads a TAR archive through the server, for clients that cannot
+// reach S3. The server indexes the archive, uploads it to S3 and registers the datarange
+// in a single request. A size of -1 means that the size of body is not known.
+// The archives of encrypted datas3ts are encrypted while they are sent, their files must
+// then be regular files with contiguous keys in ascending order.
+func (c *Client) ProxyUploadDatarange(ctx context.Context, datas3tName string, body io.Reader, size int64) (*ProxyUploadResponse, error) {
+	encrypted, err := c.datas3tEncrypted(ctx, datas3tName)
+	if err != nil {
+		return nil, err
+	}
+
+	if !encrypted {
+		return c.proxyUploadDatarange(ctx, datas3tName, "", body, size)
+	}
+
+	encryptedBody, wrappedDataKey, err := c.newEncryptingTarReader(body)
+	if err != nil {
+		return nil, err
+	}
+	defer encryptedBody.Close()
+
+	// The size of the encrypted archive is only known once it has been read
+	return c.proxyUploadDatarange(ctx, datas3tName, wrappedDataKey, encryptedBody, -1)
+}
+
+// proxyUploadDatarange uploads a TAR archive through the server. The content of the archives
+// of encrypted datas3ts is encrypted with the wrapped data key.
+func (c *Client) proxyUploadDatarange(ctx context.Context, datas3tName, wrappedDataKey string, body io.Reader, size int64) (*ProxyUploadResponse, error) {
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "upload-datarange", "proxy")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	u, err := url.Parse(ur)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("datas3t_name", datas3tName)
+	if wrappedDataKey != "" {
+		q.Set("wrapped_data_key", wrappedDataKey)
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "POST", u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-tar")
+	if size >= 0 {
+		req.ContentLength = size
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to proxy datarange upload: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to proxy datarange upload: %w", newAPIError(resp))
+	}
+
+	var response ProxyUploadResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
@@ -0,0 +1,50 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// RefreshDownloadSegments presigns new URLs for download segments returned earlier, keeping
+// their byte ranges. It fails with ErrDatarangeNotFound if a datarange no longer exists.
+func (c *Client) RefreshDownloadSegments(ctx context.Context, r *RefreshDownloadSegmentsRequest) (*PreSignDownloadForDatapointsResponse, error) {
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "download", "refresh")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", ur, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh download segments: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to refresh download segments: %w", newAPIError(resp))
+	}
+
+	var respBody PreSignDownloadForDatapointsResponse
+	err = json.NewDecoder(resp.Body).Decode(&respBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &respBody, nil
+}
@@ -0,0 +1,140 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+const tarBlockSize = 512
+
+// rekeyedTar is a view of an indexed tar archive in which the file of the n-th index
+// entry is renamed to "%020d.<extension>" of firstKey+n. The datapoint part of the name
+// always has 20 digits, so renaming only rewrites the name and checksum of each header
+// block and keeps every offset of the archive and its index intact.
+type rekeyedTar struct {
+	r        io.ReaderAt
+	index    []byte
+	firstKey uint64
+}
+
+func (t *rekeyedTar) numEntries() int {
+	return len(t.index) / 16
+}
+
+// headerPosition returns the position of the header block holding the name of the file,
+// which follows the extended headers of the entry, if there are any
+func (t *rekeyedTar) headerPosition(entry int) int64 {
+	position := int64(binary.BigEndian.Uint64(t.index[entry*16 : entry*16+8]))
+	headerBlocks := int64(binary.BigEndian.Uint16(t.index[entry*16+8 : entry*16+10]))
+	if headerBlocks > 1 {
+		position += (headerBlocks - 1) * tarBlockSize
+	}
+
+	return position
+}
+
+// checkRekeyable returns an error when an entry of the indexed tar archive is named by
+// its extended headers, e.g. a PAX path record or a GNU long name, as readers of the
+// archive use that name rather than the one in the header block renamed by rekeyedTar.
+func checkRekeyable(r io.ReaderAt, index []byte) error {
+	t := &rekeyedTar{r: r, index: index}
+	for entry := range t.numEntries() {
+		position := int64(binary.BigEndian.Uint64(index[entry*16 : entry*16+8]))
+		headerData := make([]byte, t.headerPosition(entry)+tarBlockSize-position)
+		_, err := r.ReadAt(headerData, position)
+		if err != nil {
+			return fmt.Errorf("failed to read tar header of entry %d: %w", entry, err)
+		}
+
+		header, err := tar.NewReader(bytes.NewReader(headerData)).Next()
+		if err != nil {
+			return fmt.Errorf("failed to parse tar header of entry %d: %w", entry, err)
+		}
+
+		name, _, _ := bytes.Cut(headerData[len(headerData)-tarBlockSize:][:100], []byte{0})
+		if header.Name != string(name) {
+			return fmt.Errorf("entry '%s' cannot be renamed: its name does not fit into the tar header", header.Name)
+		}
+	}
+
+	return nil
+}
+
+func (t *rekeyedTar) ReadAt(p []byte, off int64) (int, error) {
+	n, err := t.r.ReadAt(p, off)
+	end := off + int64(n)
+
+	// First header block that ends after off
+	entry := sort.Search(t.numEntries(), func(i int) bool {
+		return t.headerPosition(i)+tarBlockSize > off
+	})
+
+	for ; entry < t.numEntries(); entry++ {
+		pos := t.headerPosition(entry)
+		if pos >= end {
+			break
+		}
+
+		key := t.firstKey + uint64(entry)
+
+		// Rewrite headers that were read completely in place
+		if pos >= off && pos+tarBlockSize <= end {
+			rekeyErr := rekeyTarHeader(p[pos-off:pos-off+tarBlockSize], key)
+			if rekeyErr != nil {
+				return 0, fmt.Errorf("failed to rename tar entry %d: %w", entry, rekeyErr)
+			}
+			continue
+		}
+
+		header := make([]byte, tarBlockSize)
+		_, readErr := t.r.ReadAt(header, pos)
+		if readErr != nil {
+			return 0, fmt.Errorf("failed to read tar header of entry %d: %w", entry, readErr)
+		}
+
+		rekeyErr := rekeyTarHeader(header, key)
+		if rekeyErr != nil {
+			return 0, fmt.Errorf("failed to rename tar entry %d: %w", entry, rekeyErr)
+		}
+
+		start := max(pos, off)
+		stop := min(pos+tarBlockSize, end)
+		copy(p[start-off:stop-off], header[start-pos:stop-pos])
+	}
+
+	return n, err
+}
+
+// rekeyTarHeader replaces the datapoint key in the name of a tar header block and
+// updates the header checksum.
+func rekeyTarHeader(header []byte, key uint64) error {
+	// The name field holds "%020d.<extension>" when the name fits into a single header
+	name := header[0:100]
+	for _, b := range name[:20] {
+		if b < '0' || b > '9' {
+			return fmt.Errorf("file name does not start with a 20 digit datapoint key")
+		}
+	}
+	if name[20] != '.' {
+		return fmt.Errorf("file name has no extension after the datapoint key")
+	}
+
+	copy(name[:20], fmt.Sprintf("%020d", key))
+
+	// The checksum is computed with the checksum field itself set to spaces
+	checksum := header[148:156]
+	copy(checksum, "        ")
+
+	var sum int64
+	for _, b := range header {
+		sum += int64(b)
+	}
+
+	copy(checksum, fmt.Sprintf("%06o\x00 ", sum))
+
+	return nil
+}
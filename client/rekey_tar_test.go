@@ -0,0 +1,74 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/draganm/datas3t/tarindex"
+)
+
+func TestCheckRekeyable(t *testing.T) {
+	longName := fmt.Sprintf("%020d.%s.txt", 1, strings.Repeat("x", 100))
+
+	tests := []struct {
+		name    string
+		header  tar.Header
+		wantErr bool
+	}{
+		{
+			name:   "ustar name",
+			header: tar.Header{Name: fmt.Sprintf("%020d.txt", 1), Format: tar.FormatUSTAR},
+		},
+		{
+			name:   "PAX records without a path",
+			header: tar.Header{Name: fmt.Sprintf("%020d.txt", 1), PAXRecords: map[string]string{"comment": "datapoint"}, Format: tar.FormatPAX},
+		},
+		{
+			name:    "PAX path",
+			header:  tar.Header{Name: longName, Format: tar.FormatPAX},
+			wantErr: true,
+		},
+		{
+			name:    "GNU long name",
+			header:  tar.Header{Name: longName, Format: tar.FormatGNU},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			header := tt.header
+			header.Mode = 0o644
+			header.Size = 4
+			err := tw.WriteHeader(&header)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = tw.Write([]byte("data"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = tw.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			index, err := tarindex.IndexTar(bytes.NewReader(buf.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = checkRekeyable(bytes.NewReader(buf.Bytes()), index)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkRekeyable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// SetReplica mirrors a datas3t into a second bucket. The server copies its dataranges to
+// the bucket and downloads fail over to it when the bucket of the datas3t fails.
+// Setting a different bucket starts the replication over.
+func (c *Client) SetReplica(ctx context.Context, req *SetReplicaRequest) error {
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+
+	return c.sendReplicaRequest(ctx, "PUT", req, "set replica")
+}
+
+// RemoveReplica stops replicating a datas3t, the copies of its dataranges are deleted from
+// the bucket of the replica
+func (c *Client) RemoveReplica(ctx context.Context, req *RemoveReplicaRequest) error {
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+
+	return c.sendReplicaRequest(ctx, "DELETE", req, "remove replica")
+}
+
+func (c *Client) sendReplicaRequest(ctx context.Context, method string, req any, action string) error {
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "datas3ts", "replica")
+	if err != nil {
+		return fmt.Errorf("failed to join path: %w", err)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s request: %w", action, err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, ur, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to %s: %w", action, newAPIError(resp))
+	}
+
+	return nil
+}
+
+// ListReplicas returns the replicas of all datas3ts with their replication progress
+func (c *Client) ListReplicas(ctx context.Context) ([]ReplicaInfo, error) {
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "datas3ts", "replicas")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", ur, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicas: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list replicas: %w", newAPIError(resp))
+	}
+
+	var replicas []ReplicaInfo
+	err = json.NewDecoder(resp.Body).Decode(&replicas)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return replicas, nil
+}
+
+// GetReplicationStatus returns the replication status of every datarange of a datas3t, it
+// fails with ErrReplicaNotFound when the datas3t is not replicated
+func (c *Client) GetReplicationStatus(ctx context.Context, datas3tName string) (*ReplicationStatusResponse, error) {
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "datas3ts", "replica", "status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	u, err := url.Parse(ur)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("datas3t_name", datas3tName)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replication status: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get replication status: %w", newAPIError(resp))
+	}
+
+	var response ReplicationStatusResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
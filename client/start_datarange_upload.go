@@ -5,7 +5,6 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"net/url"
 )
@@ -36,8 +35,7 @@ func (c *Client) StartDatarangeUpload(ctx context.Context, r *UploadDatarangeReq
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("failed to start datarange upload: %s: %s", resp.Status, string(body))
+		return nil, fmt.Errorf("failed to start datarange upload: %w", newAPIError(resp))
 	}
 
 	var respBody UploadDatarangeResponse
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// SetStorageClassRules replaces the storage class rules of a datas3t, an empty list of
+// rules removes them. Dataranges are never moved back to warmer storage classes.
+func (c *Client) SetStorageClassRules(ctx context.Context, req *SetStorageClassRulesRequest) error {
+	if err := req.Validate(); err != nil {
+		return fmt.Errorf("invalid request: %w", err)
+	}
+
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "datas3ts", "storage-class-rules")
+	if err != nil {
+		return fmt.Errorf("failed to join path: %w", err)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal storage class rules: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "PUT", ur, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("failed to set storage class rules: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("failed to set storage class rules: %w", newAPIError(resp))
+	}
+
+	return nil
+}
+
+// GetStorageClassRules returns the storage class rules of a datas3t
+func (c *Client) GetStorageClassRules(ctx context.Context, datas3tName string) (*StorageClassRulesResponse, error) {
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "datas3ts", "storage-class-rules")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	u, err := url.Parse(ur)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	q := u.Query()
+	q.Set("datas3t_name", datas3tName)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage class rules: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get storage class rules: %w", newAPIError(resp))
+	}
+
+	var response StorageClassRulesResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &response, nil
+}
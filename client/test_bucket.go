@@ -0,0 +1,80 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type TestBucketRequest struct {
+	Name string `json:"name"`
+}
+
+// PermissionCheck reports whether the bucket granted one permission: list, write, read
+// or delete
+type PermissionCheck struct {
+	Permission string `json:"permission"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+}
+
+type TestBucketResponse struct {
+	Checks []PermissionCheck `json:"checks"`
+	// OK is true when every check passed
+	OK bool `json:"ok"`
+}
+
+func (r *TestBucketRequest) Validate() error {
+	if r.Name == "" {
+		return ValidationError(fmt.Errorf("name is required"))
+	}
+	return nil
+}
+
+// TestBucket checks the list, write, read and delete permissions of a bucket. Failed
+// checks are reported in the response rather than as an error.
+func (c *Client) TestBucket(ctx context.Context, req *TestBucketRequest) (*TestBucketResponse, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "buckets", "test")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal test request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", ur, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to test bucket: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to test bucket: %w", newAPIError(resp))
+	}
+
+	var response TestBucketResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode test response: %w", err)
+	}
+
+	return &response, nil
+}
@@ -4,22 +4,45 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
 )
 
 // Bucket-related types (from server/bucket)
 
 type BucketInfo struct {
-	Name      string `json:"name"`
-	Endpoint  string `json:"endpoint"`
-	Bucket    string `json:"bucket"`
-	AccessKey string `json:"access_key"`
-	SecretKey string `json:"secret_key"`
+	Name            string `json:"name"`
+	Endpoint        string `json:"endpoint"`
+	Bucket          string `json:"bucket"`
+	// AccessKey, SecretKey and SessionToken hold the credential, or refer to a file
+	// (file:///path) or an environment variable (env:NAME) the server reads it from
+	AccessKey       string `json:"access_key"`
+	SecretKey       string `json:"secret_key"`
+	SessionToken    string `json:"session_token,omitempty"`    // Optional STS session token of the static credentials
+	Region          string `json:"region,omitempty"`           // Default: us-east-1
+	AddressingStyle string `json:"addressing_style,omitempty"` // "path" (default) or "virtual"
+	CredentialMode  string `json:"credential_mode,omitempty"`  // "static" (default) or "ambient" to use the server's credential chain
+	KeyPrefix       string `json:"key_prefix,omitempty"`       // Optional prefix of every object key, e.g. "tenant-a/"
+	// SSEMode sets the server-side encryption S3 applies to the objects: "sse-s3",
+	// "sse-kms" or "sse-c". Empty leaves it to the default encryption of the bucket.
+	SSEMode     string `json:"sse_mode,omitempty"`
+	SSEKMSKeyID string `json:"sse_kms_key_id,omitempty"` // KMS key of "sse-kms", the default key of the account if empty
+	// SSECustomerKey is the base64-encoded 256-bit key of "sse-c", or a reference like the
+	// credentials
+	SSECustomerKey string `json:"sse_customer_key,omitempty"`
 }
 
 type BucketListInfo struct {
-	Name     string `json:"name"`
-	Endpoint string `json:"endpoint"`
-	Bucket   string `json:"bucket"`
+	Name            string `json:"name"`
+	Endpoint        string `json:"endpoint"`
+	Bucket          string `json:"bucket"`
+	Region          string `json:"region"`
+	AddressingStyle string `json:"addressing_style"`
+	CredentialMode  string `json:"credential_mode"`
+	KeyPrefix       string `json:"key_prefix"`
+	SSEMode         string `json:"sse_mode"`
+	SSEKMSKeyID     string `json:"sse_kms_key_id"`
 }
 
 // Dataranges-related types (from server/dataranges)
@@ -29,6 +52,26 @@ type UploadDatarangeRequest struct {
 	DataSize            uint64 `json:"data_size"`
 	NumberOfDatapoints  uint64 `json:"number_of_datapoints"`
 	FirstDatapointIndex uint64 `json:"first_datapoint_index"`
+
+	// Append lets the server allocate the keys, the response contains the first allocated key
+	Append bool `json:"append,omitempty"`
+
+	// LeaseDurationSeconds takes an exclusive lease on the datapoint range, see RenewDatarangeUploadLease
+	LeaseDurationSeconds int64 `json:"lease_duration_seconds,omitempty"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid (default: server setting)
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+
+	// Stream starts an upload of unknown size, see UploadDataRangeStream
+	Stream bool `json:"stream,omitempty"`
+
+	// Replace swaps the upload in for the existing dataranges of its datapoint range when it
+	// completes. They must lie within the range and cover every datapoint of it.
+	Replace bool `json:"replace,omitempty"`
+
+	// WrappedDataKey is the wrapped data key the content is encrypted with, required by
+	// encrypted datas3ts, see SetDataEncryptionKey
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
 }
 
 type UploadDatarangeResponse struct {
@@ -44,12 +87,118 @@ type UploadDatarangeResponse struct {
 	PresignedDataPutURL string `json:"presigned_data_put_url,omitempty"`
 	
 	// Common fields
-	PresignedIndexPutURL string `json:"presigned_index_put_url"`
+	PresignedIndexPutURL  string    `json:"presigned_index_put_url"`
+	PresignedURLsExpireAt time.Time `json:"presigned_urls_expire_at"`
+
+	// Headers the requests to the data and index put URLs and to the multipart upload URLs
+	// must send, e.g. the server-side encryption settings of the bucket
+	PutHeaders  map[string]string `json:"put_headers,omitempty"`
+	PartHeaders map[string]string `json:"part_headers,omitempty"`
+
+	// Set when the upload took a lease
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+}
+
+type RenewLeaseRequest struct {
+	DatarangeUploadID    int64 `json:"datarange_upload_id"`
+	LeaseDurationSeconds int64 `json:"lease_duration_seconds"`
+}
+
+type RenewLeaseResponse struct {
+	DatarangeUploadID int64     `json:"datarange_upload_id"`
+	LeaseExpiresAt    time.Time `json:"lease_expires_at"`
+}
+
+type ListLeasesResponse struct {
+	Leases []LeaseInfo `json:"leases"`
+}
+
+type LeaseInfo struct {
+	DatarangeUploadID   int64     `json:"datarange_upload_id"`
+	FirstDatapointIndex int64     `json:"first_datapoint_index"`
+	LastDatapointIndex  int64     `json:"last_datapoint_index"`
+	LeaseExpiresAt      time.Time `json:"lease_expires_at"`
+}
+
+type ResumeUploadRequest struct {
+	DatarangeUploadID int64 `json:"datarange_upload_id"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid (default: server setting)
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+}
+
+type UploadedPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+type PartUploadURL struct {
+	PartNumber int32  `json:"part_number"`
+	URL        string `json:"url"`
+}
+
+type ResumeUploadResponse struct {
+	DatarangeID         int64  `json:"datarange_id"`
+	ObjectKey           string `json:"object_key"`
+	FirstDatapointIndex uint64 `json:"first_datapoint_index"`
+	NumberOfDatapoints  uint64 `json:"number_of_datapoints"`
+	DataSize            uint64 `json:"data_size"`
+	UseDirectPut        bool   `json:"use_direct_put"`
+
+	// Streamed uploads request their part URLs with PresignUploadParts
+	Streamed bool `json:"streamed,omitempty"`
+
+	// WrappedDataKey is the data key the upload was started with
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
+
+	// For multipart uploads: the parts already stored and fresh URLs for the others
+	NumberOfParts     int             `json:"number_of_parts,omitempty"`
+	UploadedParts     []UploadedPart  `json:"uploaded_parts"`
+	PresignedPartURLs []PartUploadURL `json:"presigned_part_urls,omitempty"`
+
+	// For direct PUT uploads
+	PresignedDataPutURL string `json:"presigned_data_put_url,omitempty"`
+
+	PresignedIndexPutURL  string    `json:"presigned_index_put_url"`
+	PresignedURLsExpireAt time.Time `json:"presigned_urls_expire_at"`
+
+	// Headers the requests to the data and index put URLs and to the part URLs must send
+	PutHeaders  map[string]string `json:"put_headers,omitempty"`
+	PartHeaders map[string]string `json:"part_headers,omitempty"`
 }
 
 type CompleteUploadRequest struct {
 	DatarangeUploadID int64    `json:"datarange_upload_id"`
 	UploadIDs         []string `json:"upload_ids,omitempty"` // For multipart uploads
+
+	// Declared when completing a streamed upload
+	DataSize            uint64 `json:"data_size,omitempty"`
+	FirstDatapointIndex uint64 `json:"first_datapoint_index,omitempty"`
+	NumberOfDatapoints  uint64 `json:"number_of_datapoints,omitempty"`
+}
+
+type PresignUploadPartsRequest struct {
+	DatarangeUploadID int64 `json:"datarange_upload_id"`
+	FirstPartNumber   int32 `json:"first_part_number"`
+	NumberOfParts     int32 `json:"number_of_parts"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid (default: server setting)
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+}
+
+type PresignUploadPartsResponse struct {
+	PresignedPartURLs     []PartUploadURL `json:"presigned_part_urls"`
+	PresignedURLsExpireAt time.Time       `json:"presigned_urls_expire_at"`
+
+	// PartHeaders must be sent with the requests to the part URLs
+	PartHeaders map[string]string `json:"part_headers,omitempty"`
+}
+
+type ProxyUploadResponse struct {
+	FirstDatapointIndex uint64 `json:"first_datapoint_index"`
+	NumberOfDatapoints  uint64 `json:"number_of_datapoints"`
+	DataSize            uint64 `json:"data_size"`
 }
 
 type CancelUploadRequest struct {
@@ -74,6 +223,11 @@ type StartAggregateResponse struct {
 	PresignedMultipartUploadPutURLs []string `json:"presigned_multipart_upload_urls,omitempty"`
 	PresignedDataPutURL             string   `json:"presigned_data_put_url,omitempty"`
 	PresignedIndexPutURL            string   `json:"presigned_index_put_url"`
+
+	// Headers the requests to the data and index put URLs and to the multipart upload URLs
+	// must send
+	PutHeaders  map[string]string `json:"put_headers,omitempty"`
+	PartHeaders map[string]string `json:"part_headers,omitempty"`
 }
 
 type DatarangeDownloadURL struct {
@@ -85,20 +239,34 @@ type DatarangeDownloadURL struct {
 	SizeBytes         int64  `json:"size_bytes"`
 	PresignedDataURL  string `json:"presigned_data_url"`
 	PresignedIndexURL string `json:"presigned_index_url"`
+
+	// WrappedDataKey is set for encrypted dataranges
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
+
+	// Headers must be sent with the requests to the presigned URLs
+	Headers map[string]string `json:"headers,omitempty"`
 }
 
 type DatarangeInfo struct {
-	DatarangeID     int64  `json:"datarange_id"`
-	DataObjectKey   string `json:"data_object_key"`
-	IndexObjectKey  string `json:"index_object_key"`
-	MinDatapointKey int64  `json:"min_datapoint_key"`
-	MaxDatapointKey int64  `json:"max_datapoint_key"`
-	SizeBytes       int64  `json:"size_bytes"`
+	DatarangeID     int64     `json:"datarange_id"`
+	DataObjectKey   string    `json:"data_object_key"`
+	IndexObjectKey  string    `json:"index_object_key"`
+	MinDatapointKey int64     `json:"min_datapoint_key"`
+	MaxDatapointKey int64     `json:"max_datapoint_key"`
+	SizeBytes       int64     `json:"size_bytes"`
+	CreatedAt       time.Time `json:"created_at"`
+
+	// StorageClass is the storage class of the data object, e.g. GLACIER once a
+	// storage class rule moved it
+	StorageClass string `json:"storage_class,omitempty"`
 }
 
 type CompleteAggregateRequest struct {
 	AggregateUploadID int64    `json:"aggregate_upload_id"`
 	UploadIDs         []string `json:"upload_ids,omitempty"` // For multipart uploads
+
+	// WrappedDataKey is the data key the aggregate is encrypted with, required by encrypted datas3ts
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
 }
 
 type CancelAggregateRequest struct {
@@ -111,12 +279,46 @@ type DeleteDatarangeRequest struct {
 	LastDatapointKey  uint64 `json:"last_datapoint_key"`
 }
 
+const (
+	SortByKey       = "key"
+	SortBySize      = "size"
+	SortByCreatedAt = "created_at"
+
+	SortOrderAsc  = "asc"
+	SortOrderDesc = "desc"
+)
+
 type ListDatarangesRequest struct {
 	Datas3tName string `json:"datas3t_name"`
+
+	// Only return dataranges overlapping [FromDatapointKey, ToDatapointKey]
+	FromDatapointKey *int64 `json:"from_datapoint_key,omitempty"`
+	ToDatapointKey   *int64 `json:"to_datapoint_key,omitempty"`
+
+	// Only return dataranges with a size within [MinSizeBytes, MaxSizeBytes]
+	MinSizeBytes *int64 `json:"min_size_bytes,omitempty"`
+	MaxSizeBytes *int64 `json:"max_size_bytes,omitempty"`
+
+	// Only return dataranges created in [CreatedAfter, CreatedBefore)
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+
+	SortBy    string `json:"sort_by,omitempty"`    // key (default), size or created_at
+	SortOrder string `json:"sort_order,omitempty"` // asc (default) or desc
+
+	Limit  int    `json:"limit,omitempty"`  // page size, the server default is used when 0
+	Cursor string `json:"cursor,omitempty"` // NextCursor of the previous page
 }
 
 type ListDatarangesResponse struct {
 	Dataranges []DatarangeInfo `json:"dataranges"`
+	// NextCursor is set when more dataranges are available
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type ListDatas3tsRequest struct {
+	// NamePrefix restricts the result to datas3ts whose name starts with it
+	NamePrefix string `json:"name_prefix,omitempty"`
 }
 
 // Datas3t-related types (from server/datas3t)
@@ -124,6 +326,10 @@ type ListDatarangesResponse struct {
 type AddDatas3tRequest struct {
 	Name   string `json:"name"`
 	Bucket string `json:"bucket"`
+
+	// Encrypted requires the content of every datapoint to be encrypted by the clients,
+	// see SetDataEncryptionKey. It cannot be changed once the datas3t exists.
+	Encrypted bool `json:"encrypted,omitempty"`
 }
 
 type ImportDatas3tRequest struct {
@@ -152,6 +358,84 @@ type Datas3tInfo struct {
 	LowestDatapoint  int64  `json:"lowest_datapoint"`
 	HighestDatapoint int64  `json:"highest_datapoint"`
 	TotalBytes       int64  `json:"total_bytes"`
+	Encrypted        bool   `json:"encrypted"`
+}
+
+type DatapointGap struct {
+	FirstDatapointKey int64 `json:"first_datapoint_key"`
+	LastDatapointKey  int64 `json:"last_datapoint_key"`
+	MissingDatapoints int64 `json:"missing_datapoints"`
+}
+
+type GetDatapointGapsResponse struct {
+	Datas3tName       string         `json:"datas3t_name"`
+	DatarangeCount    int64          `json:"datarange_count"`
+	LowestDatapoint   int64          `json:"lowest_datapoint"`
+	HighestDatapoint  int64          `json:"highest_datapoint"`
+	MissingDatapoints int64          `json:"missing_datapoints"`
+	Gaps              []DatapointGap `json:"gaps"`
+}
+
+// StorageClassRule moves the dataranges of a datas3t to a colder storage class once they
+// match all of its conditions
+type StorageClassRule struct {
+	StorageClass string `json:"storage_class"`
+
+	// MinAgeDays matches dataranges created at least this many days ago
+	MinAgeDays *int32 `json:"min_age_days,omitempty"`
+
+	// MinKeysBehind matches dataranges whose max datapoint key is at least this many keys
+	// behind the newest datapoint of the datas3t
+	MinKeysBehind *int64 `json:"min_keys_behind,omitempty"`
+}
+
+type SetStorageClassRulesRequest struct {
+	Datas3tName string             `json:"datas3t_name"`
+	Rules       []StorageClassRule `json:"rules"`
+}
+
+type StorageClassRulesResponse struct {
+	Datas3tName string             `json:"datas3t_name"`
+	Rules       []StorageClassRule `json:"rules"`
+}
+
+// SetReplicaRequest mirrors a datas3t into a second bucket configuration, possibly of
+// another provider
+type SetReplicaRequest struct {
+	Datas3tName string `json:"datas3t_name"`
+	Bucket      string `json:"bucket"`
+}
+
+type RemoveReplicaRequest struct {
+	Datas3tName string `json:"datas3t_name"`
+}
+
+// ReplicaInfo summarizes the replica of a datas3t. Dataranges neither replicated nor
+// failed are pending.
+type ReplicaInfo struct {
+	Datas3tName          string    `json:"datas3t_name"`
+	Bucket               string    `json:"bucket"`
+	CreatedAt            time.Time `json:"created_at"`
+	TotalDataranges      int64     `json:"total_dataranges"`
+	ReplicatedDataranges int64     `json:"replicated_dataranges"`
+	FailedDataranges     int64     `json:"failed_dataranges"`
+}
+
+// DatarangeReplication is the replication status of a datarange: "pending", "replicated"
+// or "failed", failed copies are retried
+type DatarangeReplication struct {
+	MinDatapointKey int64      `json:"min_datapoint_key"`
+	MaxDatapointKey int64      `json:"max_datapoint_key"`
+	Status          string     `json:"status"`
+	Attempts        int32      `json:"attempts"`
+	LastError       string     `json:"last_error,omitempty"`
+	ReplicatedAt    *time.Time `json:"replicated_at,omitempty"`
+}
+
+type ReplicationStatusResponse struct {
+	Datas3tName string                 `json:"datas3t_name"`
+	Bucket      string                 `json:"bucket"`
+	Dataranges  []DatarangeReplication `json:"dataranges"`
 }
 
 // Download-related types (from server/download)
@@ -160,20 +444,77 @@ type PreSignDownloadForDatapointsRequest struct {
 	Datas3tName    string `json:"datas3t_name"`
 	FirstDatapoint uint64 `json:"first_datapoint"`
 	LastDatapoint  uint64 `json:"last_datapoint"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid (default: server setting)
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+
+	// UseReplica serves all segments from the replica of the datas3t, e.g. while its
+	// bucket is unavailable. Without it only dataranges the bucket fails for are served
+	// from the replica.
+	UseReplica bool `json:"use_replica,omitempty"`
 }
 
 type DownloadSegment struct {
 	PresignedURL string `json:"presigned_url"`
 	Range        string `json:"range"`
+	ObjectKey    string `json:"object_key"`
+
+	// DatarangeMinDatapointKey is the first datapoint key of the datarange of the segment
+	DatarangeMinDatapointKey int64 `json:"datarange_min_datapoint_key,omitempty"`
+
+	// WrappedDataKey is set for the segments of encrypted dataranges
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
+
+	// Headers must be sent with the request to the presigned URL, e.g. the SSE-C key of
+	// the bucket
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Replica is set for segments served from the replica of the datas3t
+	Replica bool `json:"replica,omitempty"`
 }
 
 type PreSignDownloadForDatapointsResponse struct {
-	DownloadSegments []DownloadSegment `json:"download_segments"`
+	DownloadSegments      []DownloadSegment `json:"download_segments"`
+	PresignedURLsExpireAt time.Time         `json:"presigned_urls_expire_at"`
+}
+
+type RefreshDownloadSegmentsRequest struct {
+	Datas3tName string            `json:"datas3t_name"`
+	Segments    []DownloadSegment `json:"segments"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid (default: server setting)
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+
+	// UseReplica refreshes all segments from the replica of the datas3t
+	UseReplica bool `json:"use_replica,omitempty"`
+}
+
+// Health-related types (from server/health)
+
+type CheckResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type ReadinessReport struct {
+	Ready  bool          `json:"ready"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type VersionInfo struct {
+	Version             string `json:"version"`
+	SchemaVersion       int64  `json:"schema_version"`
+	SchemaDirty         bool   `json:"schema_dirty"`
+	LatestSchemaVersion int64  `json:"latest_schema_version"`
 }
 
 // Error types
 
-type ValidationError error
+// ValidationError marks err as a client-side validation failure; it matches ErrValidationFailed
+func ValidationError(err error) error {
+	return apierror.Wrap(apierror.CodeValidationFailed, err)
+}
 
 // Validation functions and constants
 
@@ -237,6 +578,47 @@ func (r *ClearDatas3tRequest) Validate() error {
 	return nil
 }
 
+// Validate validates the SetStorageClassRulesRequest struct
+func (r *SetStorageClassRulesRequest) Validate() error {
+	if !datas3tNameRegex.MatchString(r.Datas3tName) {
+		return ValidationError(fmt.Errorf("invalid datas3t name: %s", r.Datas3tName))
+	}
+
+	for i, rule := range r.Rules {
+		if rule.StorageClass == "" {
+			return ValidationError(fmt.Errorf("storage class of rule %d is required", i))
+		}
+
+		if rule.MinAgeDays == nil && rule.MinKeysBehind == nil {
+			return ValidationError(fmt.Errorf("rule %d needs min age days or min keys behind", i))
+		}
+	}
+
+	return nil
+}
+
+// Validate validates the SetReplicaRequest struct
+func (r *SetReplicaRequest) Validate() error {
+	if !datas3tNameRegex.MatchString(r.Datas3tName) {
+		return ValidationError(fmt.Errorf("invalid datas3t name: %s", r.Datas3tName))
+	}
+
+	if r.Bucket == "" {
+		return ValidationError(fmt.Errorf("bucket is required"))
+	}
+
+	return nil
+}
+
+// Validate validates the RemoveReplicaRequest struct
+func (r *RemoveReplicaRequest) Validate() error {
+	if !datas3tNameRegex.MatchString(r.Datas3tName) {
+		return ValidationError(fmt.Errorf("invalid datas3t name: %s", r.Datas3tName))
+	}
+
+	return nil
+}
+
 // Validate validates the PreSignDownloadForDatapointsRequest struct
 func (r *PreSignDownloadForDatapointsRequest) Validate() error {
 	if r.Datas3tName == "" {
@@ -264,6 +646,14 @@ func (r *UploadDatarangeRequest) Validate() error {
 		return ValidationError(fmt.Errorf("number of datapoints must be greater than 0"))
 	}
 
+	if r.Append && r.FirstDatapointIndex != 0 {
+		return ValidationError(fmt.Errorf("first datapoint index cannot be set in append mode"))
+	}
+
+	if r.LeaseDurationSeconds < 0 {
+		return ValidationError(fmt.Errorf("lease duration cannot be negative"))
+	}
+
 	return nil
 }
 
@@ -299,5 +689,29 @@ func (r *ListDatarangesRequest) Validate() error {
 		return ValidationError(fmt.Errorf("datas3t name is required"))
 	}
 
+	if r.FromDatapointKey != nil && r.ToDatapointKey != nil && *r.FromDatapointKey > *r.ToDatapointKey {
+		return ValidationError(fmt.Errorf("from datapoint key (%d) cannot be greater than to datapoint key (%d)", *r.FromDatapointKey, *r.ToDatapointKey))
+	}
+
+	if r.MinSizeBytes != nil && r.MaxSizeBytes != nil && *r.MinSizeBytes > *r.MaxSizeBytes {
+		return ValidationError(fmt.Errorf("min size (%d) cannot be greater than max size (%d)", *r.MinSizeBytes, *r.MaxSizeBytes))
+	}
+
+	switch r.SortBy {
+	case "", SortByKey, SortBySize, SortByCreatedAt:
+	default:
+		return ValidationError(fmt.Errorf("sort by must be one of %q, %q or %q", SortByKey, SortBySize, SortByCreatedAt))
+	}
+
+	switch r.SortOrder {
+	case "", SortOrderAsc, SortOrderDesc:
+	default:
+		return ValidationError(fmt.Errorf("sort order must be %q or %q", SortOrderAsc, SortOrderDesc))
+	}
+
+	if r.Limit < 0 {
+		return ValidationError(fmt.Errorf("limit cannot be negative"))
+	}
+
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// UpdateBucketRequest changes the configuration of an existing bucket. Fields left nil
+// keep their stored value. Changing the access or secret key drops the stored session
+// token unless a new one is given, and switching to the ambient credential mode drops
+// the stored keys. Changing the SSE mode drops a KMS key ID or customer key the new mode
+// does not use. The key prefix and the SSE-C customer key cannot change while datas3ts use
+// the bucket.
+type UpdateBucketRequest struct {
+	Name            string  `json:"name"`
+	Endpoint        *string `json:"endpoint,omitempty"`
+	Bucket          *string `json:"bucket,omitempty"`
+	AccessKey       *string `json:"access_key,omitempty"`
+	SecretKey       *string `json:"secret_key,omitempty"`
+	SessionToken    *string `json:"session_token,omitempty"`
+	Region          *string `json:"region,omitempty"`
+	AddressingStyle *string `json:"addressing_style,omitempty"`
+	CredentialMode  *string `json:"credential_mode,omitempty"`
+	KeyPrefix       *string `json:"key_prefix,omitempty"`
+	SSEMode         *string `json:"sse_mode,omitempty"`
+	SSEKMSKeyID     *string `json:"sse_kms_key_id,omitempty"`
+	SSECustomerKey  *string `json:"sse_customer_key,omitempty"`
+}
+
+func (r *UpdateBucketRequest) Validate() error {
+	if r.Name == "" {
+		return ValidationError(fmt.Errorf("name is required"))
+	}
+	return nil
+}
+
+// UpdateBucket changes the configuration of a bucket and returns the updated
+// configuration. The server tests the connection before storing the change.
+func (c *Client) UpdateBucket(ctx context.Context, req *UpdateBucketRequest) (*BucketListInfo, error) {
+	err := req.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	ur, err := url.JoinPath(c.baseURL, "api", "v1", "buckets")
+	if err != nil {
+		return nil, fmt.Errorf("failed to join path: %w", err)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal update request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "PUT", ur, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update bucket: %w", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to update bucket: %w", newAPIError(resp))
+	}
+
+	var response BucketListInfo
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode update response: %w", err)
+	}
+
+	return &response, nil
+}
@@ -4,9 +4,11 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -48,9 +50,18 @@ type ProgressCallback func(info ProgressInfo)
 
 // UploadOptions configures the upload behavior
 type UploadOptions struct {
-	MaxParallelism   int              // Maximum number of concurrent uploads (default: 4)
-	MaxRetries       int              // Maximum number of retry attempts per chunk (default: 3)
-	ProgressCallback ProgressCallback // Optional progress callback
+	MaxParallelism     int               // Maximum number of concurrent uploads (default: 4)
+	MaxRetries         int               // Maximum number of retry attempts per chunk (default: 3)
+	ProgressCallback   ProgressCallback  // Optional progress callback
+	LeaseDuration      time.Duration     // Take an exclusive lease on the datapoint range, renewed until the upload finishes (default: no lease)
+	StateFile          string            // Persist the upload progress to this file and resume the upload recorded in it (default: no state file)
+	PresignExpiry      time.Duration     // How long the presigned upload URLs stay valid, they are refreshed when they expire (default: server setting)
+	StreamPartSize     int               // Size of the parts UploadDataRangeStream uploads, at least MinStreamPartSize (default: DefaultStreamPartSize)
+	ProxyThroughServer bool              // Send the archive to the server, which uploads it to S3, for clients that cannot reach S3 (default: upload to S3 directly)
+	AssignKeys         bool              // Number the files of the archive in archive order starting at FirstDatapoint instead of taking the keys from their names (default: names are keys)
+	FirstDatapoint     uint64            // Key of the first file when AssignKeys is set, must be 0 in append mode
+	KeyMapping         map[string]uint64 // Datapoint key of every file of the archive by its name, an alternative to AssignKeys (default: names are keys)
+	Replace            bool              // Atomically replace the existing dataranges of the datapoint range, which must lie within it and cover all of it (default: the range must be free)
 }
 
 // DefaultUploadOptions returns sensible default options
@@ -111,7 +122,7 @@ func (pt *progressTracker) reportProgress(phase ProgressPhase, currentStep strin
 
 	if elapsed > 0 && pt.completedBytes > 0 {
 		speed = float64(pt.completedBytes) / elapsed.Seconds()
-		if speed > 0 {
+		if speed > 0 && pt.totalBytes > 0 {
 			remainingBytes := pt.totalBytes - pt.completedBytes
 			eta = time.Duration(float64(remainingBytes) / speed * float64(time.Second))
 		}
@@ -139,101 +150,358 @@ func (pt *progressTracker) nextStep() {
 }
 
 func (c *Client) UploadDataRangeFile(ctx context.Context, datas3tName string, file io.ReaderAt, size int64, opts *UploadOptions) error {
+	_, err := c.uploadDataRangeFile(ctx, datas3tName, file, size, false, opts)
+	return err
+}
+
+// AppendDataRangeFile uploads a TAR file in append mode: the server allocates the next
+// contiguous keys of the datas3t and the files of the archive are renamed to them while
+// uploading. The archive must contain contiguous datapoints, typically numbered from
+// 00000000000000000000.<extension>. It returns the key of the first uploaded datapoint.
+func (c *Client) AppendDataRangeFile(ctx context.Context, datas3tName string, file io.ReaderAt, size int64, opts *UploadOptions) (uint64, error) {
+	return c.uploadDataRangeFile(ctx, datas3tName, file, size, true, opts)
+}
+
+func (c *Client) uploadDataRangeFile(ctx context.Context, datas3tName string, file io.ReaderAt, size int64, appendMode bool, opts *UploadOptions) (uint64, error) {
 	if opts == nil {
 		opts = DefaultUploadOptions()
 	}
 
+	if opts.ProxyThroughServer {
+		switch {
+		case appendMode:
+			return 0, ValidationError(fmt.Errorf("proxied uploads cannot be appended"))
+		case opts.LeaseDuration != 0:
+			return 0, ValidationError(fmt.Errorf("proxied uploads cannot take a lease"))
+		case opts.StateFile != "":
+			return 0, ValidationError(fmt.Errorf("proxied uploads cannot be resumed from a state file"))
+		case opts.Replace:
+			return 0, ValidationError(fmt.Errorf("proxied uploads cannot replace dataranges"))
+		}
+	}
+
+	if appendMode && opts.Replace {
+		return 0, ValidationError(fmt.Errorf("appended uploads cannot replace dataranges"))
+	}
+
+	mapKeys := opts.AssignKeys || opts.KeyMapping != nil
+	switch {
+	case opts.AssignKeys && opts.KeyMapping != nil:
+		return 0, ValidationError(fmt.Errorf("keys are either assigned in archive order or taken from the key mapping"))
+	case appendMode && opts.KeyMapping != nil:
+		return 0, ValidationError(fmt.Errorf("keys are allocated by the server in append mode and cannot be mapped"))
+	case appendMode && opts.FirstDatapoint != 0:
+		return 0, ValidationError(fmt.Errorf("keys are allocated by the server in append mode, the first datapoint cannot be set"))
+	}
+
 	// Create progress tracker
 	tracker := newProgressTracker(opts.ProgressCallback, size)
 
 	// Phase 1: Analyze TAR file to extract datapoint information
-	tracker.reportProgress(PhaseAnalyzing, "Analyzing TAR file structure", 0)
-	tarInfo, err := analyzeTarFile(file, size)
-	if err != nil {
-		return fmt.Errorf("failed to analyze tar file: %w", err)
+	var tarInfo *TarInfo
+	var indexData []byte
+	var err error
+	if mapKeys {
+		tracker.reportProgress(PhaseAnalyzing, "Assigning datapoint keys", 0)
+		var archive *assembledTar
+		archive, tarInfo, err = newMappedTar(file, size, opts.KeyMapping, opts.FirstDatapoint)
+		if err != nil {
+			return 0, fmt.Errorf("failed to assign datapoint keys: %w", err)
+		}
+
+		// The files are renamed while the archive is read, its index is built upfront
+		file, size, indexData = archive, archive.size, archive.index
+		tracker.totalBytes = size
+	} else {
+		tracker.reportProgress(PhaseAnalyzing, "Analyzing TAR file structure", 0)
+		tarInfo, err = analyzeTarFile(file, size)
+		if err != nil {
+			return 0, fmt.Errorf("failed to analyze tar file: %w", err)
+		}
 	}
 	tracker.nextStep()
 
+	if opts.ProxyThroughServer {
+		return c.proxyUploadDataRangeFile(ctx, datas3tName, file, size, indexData, tracker)
+	}
+
 	// Phase 2: Generate TAR index
-	tracker.reportProgress(PhaseIndexing, "Generating TAR index", 0)
-	indexData, err := generateTarIndex(file, size)
-	if err != nil {
-		return fmt.Errorf("failed to generate tar index: %w", err)
+	if indexData == nil {
+		tracker.reportProgress(PhaseIndexing, "Generating TAR index", 0)
+		indexData, err = generateTarIndex(file, size)
+		if err != nil {
+			return 0, fmt.Errorf("failed to generate tar index: %w", err)
+		}
 	}
 	tracker.nextStep()
 
-	// Phase 3: Start upload
-	tracker.reportProgress(PhaseStarting, "Starting upload session", 0)
 	uploadReq := &UploadDatarangeRequest{
-		Datas3tName:         datas3tName,
-		DataSize:            uint64(size),
-		NumberOfDatapoints:  uint64(tarInfo.NumDatapoints),
-		FirstDatapointIndex: uint64(tarInfo.FirstDatapointIndex),
+		Datas3tName:        datas3tName,
+		DataSize:           uint64(size),
+		NumberOfDatapoints: uint64(tarInfo.NumDatapoints),
+		Append:             appendMode,
+		Replace:            opts.Replace,
+	}
+	if !appendMode {
+		uploadReq.FirstDatapointIndex = uint64(tarInfo.FirstDatapointIndex)
+	}
+
+	return c.uploadIndexedDatarange(ctx, uploadReq, file, indexData, opts, tracker)
+}
+
+// proxyUploadDataRangeFile sends an analyzed tar archive to the server, which indexes it
+// and uploads it to S3. The index of archives with mapped keys is known already, the
+// archives of encrypted datas3ts are indexed to be encrypted. It returns the key of the
+// first uploaded datapoint.
+func (c *Client) proxyUploadDataRangeFile(ctx context.Context, datas3tName string, file io.ReaderAt, size int64, indexData []byte, tracker *progressTracker) (uint64, error) {
+	encrypted, err := c.datas3tEncrypted(ctx, datas3tName)
+	if err != nil {
+		return 0, err
+	}
+
+	var wrappedDataKey string
+	if encrypted {
+		if indexData == nil {
+			indexData, err = generateTarIndex(file, size)
+			if err != nil {
+				return 0, fmt.Errorf("failed to generate tar index: %w", err)
+			}
+		}
+
+		archive, err := c.newEncryptedTar(file, indexData, false)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt tar archive: %w", err)
+		}
+
+		file, size, wrappedDataKey = archive, archive.size, archive.wrappedDataKey
+		tracker.totalBytes = size
+	}
+
+	tracker.nextStep()
+	tracker.reportProgress(PhaseUploading, "Uploading through the server", 0)
+
+	body := &progressReader{
+		r:       io.NewSectionReader(file, 0, size),
+		tracker: tracker,
 	}
 
-	uploadResp, err := c.StartDatarangeUpload(ctx, uploadReq)
+	resp, err := c.proxyUploadDatarange(ctx, datas3tName, wrappedDataKey, body, size)
 	if err != nil {
-		return fmt.Errorf("failed to start upload: %w", err)
+		return 0, err
 	}
 	tracker.nextStep()
 
+	tracker.reportProgress(PhaseCompleting, "Upload completed", 0)
+
+	return resp.FirstDatapointIndex, nil
+}
+
+// progressReader reports the bytes read from r as upload progress
+type progressReader struct {
+	r       io.Reader
+	tracker *progressTracker
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.tracker.reportProgress(PhaseUploading, "Uploading through the server", int64(n))
+	return n, err
+}
+
+// uploadIndexedDatarange uploads a tar archive whose index and datapoint range are already known.
+// In append mode the files of the archive are renamed to the keys allocated by the server.
+// The content of the files is encrypted when the datas3t is encrypted.
+// With a state file, an interrupted upload is resumed instead of started again.
+// It returns the key of the first uploaded datapoint.
+func (c *Client) uploadIndexedDatarange(ctx context.Context, uploadReq *UploadDatarangeRequest, file io.ReaderAt, indexData []byte, opts *UploadOptions, tracker *progressTracker) (_ uint64, err error) {
+	encrypted, err := c.datas3tEncrypted(ctx, uploadReq.Datas3tName)
+	if err != nil {
+		return 0, err
+	}
+
+	if uploadReq.Append {
+		err = checkRekeyable(file, indexData)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var archive *encryptedTar
+	if encrypted {
+		archive, err = c.newEncryptedTar(file, indexData, uploadReq.Append)
+		if err != nil {
+			return 0, fmt.Errorf("failed to encrypt tar archive: %w", err)
+		}
+
+		file, indexData = archive, archive.index
+		uploadReq.DataSize = uint64(archive.size)
+		uploadReq.WrappedDataKey = archive.wrappedDataKey
+		tracker.totalBytes = archive.size
+	}
+
+	size := int64(uploadReq.DataSize)
+
+	if opts.LeaseDuration > 0 {
+		uploadReq.LeaseDurationSeconds = int64(max(opts.LeaseDuration, time.Second) / time.Second)
+	}
+
+	if opts.PresignExpiry > 0 {
+		uploadReq.PresignExpirySeconds = int64(max(opts.PresignExpiry, time.Second) / time.Second)
+	}
+
+	var state *uploadState
+	if opts.StateFile != "" {
+		state, err = loadUploadState(opts.StateFile)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if state != nil {
+		err = state.matches(uploadReq, indexData)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// Phase 3: Start or resume upload
+	var session *uploadSession
+	if state != nil {
+		tracker.reportProgress(PhaseStarting, "Resuming upload session", 0)
+		session, err = c.resumeUploadSession(ctx, state, uploadReq.LeaseDurationSeconds, uploadReq.PresignExpirySeconds)
+		if errors.Is(err, ErrUploadNotFound) {
+			// The upload was completed, cancelled or cleaned up since the state was saved
+			state = nil
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to resume upload: %w", err)
+		}
+
+		// The parts already stored are encrypted with the data key the upload was started with
+		if session != nil && archive != nil && session.wrappedDataKey != archive.wrappedDataKey {
+			err = archive.useDataKey(c, session.wrappedDataKey)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if session == nil {
+		tracker.reportProgress(PhaseStarting, "Starting upload session", 0)
+		uploadResp, err := c.StartDatarangeUpload(ctx, uploadReq)
+		if err != nil {
+			return 0, fmt.Errorf("failed to start upload: %w", err)
+		}
+		session = c.newUploadSession(uploadResp, uploadReq.PresignExpirySeconds)
+
+		if opts.StateFile != "" {
+			state = newUploadState(opts.StateFile, uploadReq, indexData, uploadResp)
+			err = state.save()
+			if err != nil {
+				c.CancelDatarangeUpload(ctx, &CancelUploadRequest{DatarangeUploadID: session.datarangeID}) // Best effort, ignore error
+				return 0, err
+			}
+		}
+	}
+	tracker.nextStep()
+
+	// Without a state file the upload cannot be resumed, so it is cancelled on failure
+	cancelUpload := func() {
+		if state != nil {
+			return
+		}
+		cancelReq := &CancelUploadRequest{
+			DatarangeUploadID: session.datarangeID,
+		}
+		c.CancelDatarangeUpload(ctx, cancelReq) // Best effort, ignore error
+	}
+
+	if session.leased {
+		leaseCtx, stopRenewing := c.keepLeaseAlive(ctx, session.datarangeID, time.Duration(uploadReq.LeaseDurationSeconds)*time.Second)
+		defer stopRenewing()
+
+		// Report why the upload was aborted rather than a bare context error
+		defer func() {
+			if err != nil && context.Cause(leaseCtx) != nil && ctx.Err() == nil {
+				err = fmt.Errorf("%w: %w", err, context.Cause(leaseCtx))
+			}
+		}()
+
+		ctx = leaseCtx
+	}
+
+	if uploadReq.Append {
+		file = &rekeyedTar{
+			r:        file,
+			index:    indexData,
+			firstKey: session.firstDatapointIndex,
+		}
+	}
+
 	// Phase 4: Upload data
 	tracker.reportProgress(PhaseUploading, "Uploading data", 0)
 	var uploadIDs []string
-	if uploadResp.UseDirectPut {
+	if session.useDirectPut {
 		// Direct PUT for small files
-		err = uploadDataDirectPut(ctx, uploadResp.PresignedDataPutURL, file, size, opts.MaxRetries, tracker)
+		err = session.urls.do(ctx, session.dataURLIndex(), func(url string) error {
+			return uploadDataDirectPut(ctx, url, session.putHeaders, file, size, opts.MaxRetries, tracker)
+		})
 		if err != nil {
-			// Cancel upload on failure
-			cancelReq := &CancelUploadRequest{
-				DatarangeUploadID: uploadResp.DatarangeID,
-			}
-			c.CancelDatarangeUpload(ctx, cancelReq) // Best effort, ignore error
-			return fmt.Errorf("failed to upload data: %w", err)
+			cancelUpload()
+			return 0, fmt.Errorf("failed to upload data: %w", err)
 		}
 	} else {
+		var onPartUploaded func(partNumber int32, etag string) error
+		if state != nil {
+			onPartUploaded = state.recordPart
+		}
+
 		// Multipart upload for large files
-		uploadIDs, err = uploadDataMultipart(ctx, uploadResp.PresignedMultipartUploadPutURLs, file, size, opts, tracker)
+		uploadIDs, err = uploadDataMultipart(ctx, session.urls, session.partHeaders, session.etags, file, size, opts, tracker, onPartUploaded)
 		if err != nil {
-			// Cancel upload on failure
-			cancelReq := &CancelUploadRequest{
-				DatarangeUploadID: uploadResp.DatarangeID,
-			}
-			c.CancelDatarangeUpload(ctx, cancelReq) // Best effort, ignore error
-			return fmt.Errorf("failed to upload data: %w", err)
+			cancelUpload()
+			return 0, fmt.Errorf("failed to upload data: %w", err)
 		}
 	}
 	tracker.nextStep()
 
 	// Phase 5: Upload index
 	tracker.reportProgress(PhaseUploadingIndex, "Uploading index", 0)
-	err = uploadIndexWithRetry(ctx, uploadResp.PresignedIndexPutURL, indexData, opts.MaxRetries, tracker)
+	err = session.urls.do(ctx, session.indexURLIndex(), func(url string) error {
+		return uploadIndexWithRetry(ctx, url, session.putHeaders, indexData, opts.MaxRetries, tracker)
+	})
 	if err != nil {
-		// Cancel upload on failure
-		cancelReq := &CancelUploadRequest{
-			DatarangeUploadID: uploadResp.DatarangeID,
-		}
-		c.CancelDatarangeUpload(ctx, cancelReq) // Best effort, ignore error
-		return fmt.Errorf("failed to upload index: %w", err)
+		cancelUpload()
+		return 0, fmt.Errorf("failed to upload index: %w", err)
 	}
 	tracker.nextStep()
 
 	// Phase 6: Complete upload
 	tracker.reportProgress(PhaseCompleting, "Completing upload", 0)
 	completeReq := &CompleteUploadRequest{
-		DatarangeUploadID: uploadResp.DatarangeID,
+		DatarangeUploadID: session.datarangeID,
 		UploadIDs:         uploadIDs, // ETags for multipart, empty for direct PUT
 	}
 
 	err = c.CompleteDatarangeUpload(ctx, completeReq)
+	if errors.Is(err, ErrUploadValidationFailed) && state != nil {
+		// The server has discarded the upload, there is nothing left to resume
+		state.remove()
+	}
 	if err != nil {
-		return fmt.Errorf("failed to complete upload: %w", err)
+		return 0, fmt.Errorf("failed to complete upload: %w", err)
 	}
 	tracker.nextStep()
 
+	if state != nil {
+		err = state.remove()
+		if err != nil {
+			return 0, err
+		}
+	}
+
 	// Final progress report
 	tracker.reportProgress(PhaseCompleting, "Upload completed successfully", 0)
-	return nil
+	return session.firstDatapointIndex, nil
 }
 
 // TarInfo contains metadata extracted from analyzing the TAR file
@@ -350,7 +618,7 @@ func generateTarIndex(file io.ReaderAt, size int64) ([]byte, error) {
 }
 
 // uploadDataDirectPut handles direct PUT upload for small files
-func uploadDataDirectPut(ctx context.Context, url string, file io.ReaderAt, size int64, maxRetries int, tracker *progressTracker) error {
+func uploadDataDirectPut(ctx context.Context, url string, headers map[string]string, file io.ReaderAt, size int64, maxRetries int, tracker *progressTracker) error {
 	operation := func() error {
 		// Create reader for entire file
 		reader := io.NewSectionReader(file, 0, size)
@@ -361,6 +629,7 @@ func uploadDataDirectPut(ctx context.Context, url string, file io.ReaderAt, size
 			return err
 		}
 		req.ContentLength = size
+		setPresignedHeaders(req, headers)
 
 		// Execute request
 		resp, err := http.DefaultClient.Do(req)
@@ -380,6 +649,11 @@ func uploadDataDirectPut(ctx context.Context, url string, file io.ReaderAt, size
 			return fmt.Errorf("HTTP %d", resp.StatusCode)
 		}
 
+		// An expired URL is refreshed by the caller
+		if resp.StatusCode == http.StatusForbidden {
+			return backoff.Permanent(fmt.Errorf("HTTP %d: %w", resp.StatusCode, errPresignedURLRejected))
+		}
+
 		// Non-retryable error - wrap with Permanent to stop retrying
 		return backoff.Permanent(fmt.Errorf("HTTP %d", resp.StatusCode))
 	}
@@ -393,9 +667,11 @@ func uploadDataDirectPut(ctx context.Context, url string, file io.ReaderAt, size
 	return nil
 }
 
-// uploadDataMultipart handles multipart upload for large files
-func uploadDataMultipart(ctx context.Context, urls []string, file io.ReaderAt, size int64, opts *UploadOptions, tracker *progressTracker) ([]string, error) {
-	numParts := len(urls)
+// uploadDataMultipart handles multipart upload for large files. The URL of the i-th part is
+// the i-th entry of urls, requests to it send headers. Parts that already have an ETag in etags are skipped,
+// onPartUploaded is called for every other part once it is stored.
+func uploadDataMultipart(ctx context.Context, urls *refreshableURLs, headers map[string]string, etags []string, file io.ReaderAt, size int64, opts *UploadOptions, tracker *progressTracker, onPartUploaded func(partNumber int32, etag string) error) ([]string, error) {
+	numParts := len(etags)
 	if numParts == 0 {
 		return nil, fmt.Errorf("no upload URLs provided")
 	}
@@ -408,34 +684,69 @@ func uploadDataMultipart(ctx context.Context, urls []string, file io.ReaderAt, s
 	// The last part can be smaller and will contain any remainder
 	standardPartSize := int64(minPartSize)
 
+	partBounds := func(i int) (int64, int64) {
+		offset := int64(i) * standardPartSize
+		partSize := standardPartSize
+
+		// Handle the last part - it gets all remaining data
+		if i == numParts-1 {
+			partSize = size - offset
+		}
+
+		// Safety check: ensure we don't exceed file boundaries
+		if offset+partSize > size {
+			partSize = size - offset
+		}
+
+		return offset, partSize
+	}
+
+	var resumedParts int
+	var resumedBytes int64
+	for i, etag := range etags {
+		if etag != "" {
+			_, partSize := partBounds(i)
+			resumedParts++
+			resumedBytes += partSize
+		}
+	}
+	if resumedParts > 0 {
+		tracker.reportProgress(PhaseUploading, fmt.Sprintf("Resuming after %d of %d parts", resumedParts, numParts), resumedBytes)
+	}
+
 	// Use errgroup with parallelism limit
 	g, ctx := errgroup.WithContext(ctx)
 	g.SetLimit(opts.MaxParallelism)
 
-	etags := make([]string, numParts)
-	for i, url := range urls {
-		i, url := i, url // capture loop variables
+	etags = slices.Clone(etags)
+	for i := range etags {
+		if etags[i] != "" {
+			continue
+		}
+
+		i := i // capture loop variable
 		g.Go(func() error {
 			// Calculate this part's boundaries
-			offset := int64(i) * standardPartSize
-			partSize := standardPartSize
-
-			// Handle the last part - it gets all remaining data
-			if i == numParts-1 {
-				partSize = size - offset
-			}
-
-			// Safety check: ensure we don't exceed file boundaries
-			if offset+partSize > size {
-				partSize = size - offset
-			}
-
-			// Upload chunk with retry
-			etag, err := uploadChunkWithRetry(ctx, url, file, offset, partSize, opts.MaxRetries, tracker, i+1, numParts)
+			offset, partSize := partBounds(i)
+
+			// Upload chunk with retry, refreshing the URL if it has expired
+			var etag string
+			err := urls.do(ctx, i, func(url string) error {
+				var err error
+				etag, err = uploadChunkWithRetry(ctx, url, headers, file, offset, partSize, opts.MaxRetries, tracker, i+1, numParts)
+				return err
+			})
 			if err != nil {
 				return fmt.Errorf("failed to upload part %d: %w", i+1, err)
 			}
 			etags[i] = etag
+
+			if onPartUploaded != nil {
+				err = onPartUploaded(int32(i+1), etag)
+				if err != nil {
+					return fmt.Errorf("failed to record part %d: %w", i+1, err)
+				}
+			}
 			return nil
 		})
 	}
@@ -449,7 +760,7 @@ func uploadDataMultipart(ctx context.Context, urls []string, file io.ReaderAt, s
 }
 
 // uploadChunkWithRetry uploads a single chunk with exponential backoff retry
-func uploadChunkWithRetry(ctx context.Context, url string, file io.ReaderAt, offset, size int64, maxRetries int, tracker *progressTracker, partNum, totalParts int) (string, error) {
+func uploadChunkWithRetry(ctx context.Context, url string, headers map[string]string, file io.ReaderAt, offset, size int64, maxRetries int, tracker *progressTracker, partNum, totalParts int) (string, error) {
 	var etag string
 
 	operation := func() error {
@@ -462,6 +773,7 @@ func uploadChunkWithRetry(ctx context.Context, url string, file io.ReaderAt, off
 			return err
 		}
 		req.ContentLength = size
+		setPresignedHeaders(req, headers)
 
 		// Execute request
 		resp, err := http.DefaultClient.Do(req)
@@ -474,6 +786,10 @@ func uploadChunkWithRetry(ctx context.Context, url string, file io.ReaderAt, off
 			etag = resp.Header.Get("ETag")
 			// Report progress for this chunk
 			stepInfo := fmt.Sprintf("Uploading part %d of %d", partNum, totalParts)
+			if totalParts == 0 {
+				// The number of parts of a stream is not known upfront
+				stepInfo = fmt.Sprintf("Uploading part %d", partNum)
+			}
 			tracker.reportProgress(PhaseUploading, stepInfo, size)
 			return nil
 		}
@@ -483,6 +799,11 @@ func uploadChunkWithRetry(ctx context.Context, url string, file io.ReaderAt, off
 			return fmt.Errorf("HTTP %d", resp.StatusCode)
 		}
 
+		// An expired URL is refreshed by the caller
+		if resp.StatusCode == http.StatusForbidden {
+			return backoff.Permanent(fmt.Errorf("HTTP %d: %w", resp.StatusCode, errPresignedURLRejected))
+		}
+
 		// Non-retryable error - wrap with Permanent to stop retrying
 		return backoff.Permanent(fmt.Errorf("HTTP %d", resp.StatusCode))
 	}
@@ -497,7 +818,7 @@ func uploadChunkWithRetry(ctx context.Context, url string, file io.ReaderAt, off
 }
 
 // uploadIndexWithRetry uploads the tar index with retry logic
-func uploadIndexWithRetry(ctx context.Context, url string, indexData []byte, maxRetries int, tracker *progressTracker) error {
+func uploadIndexWithRetry(ctx context.Context, url string, headers map[string]string, indexData []byte, maxRetries int, tracker *progressTracker) error {
 	operation := func() error {
 		// Create HTTP request
 		req, err := http.NewRequestWithContext(ctx, "PUT", url, bytes.NewReader(indexData))
@@ -505,6 +826,7 @@ func uploadIndexWithRetry(ctx context.Context, url string, indexData []byte, max
 			return err
 		}
 		req.ContentLength = int64(len(indexData))
+		setPresignedHeaders(req, headers)
 
 		// Execute request
 		resp, err := http.DefaultClient.Do(req)
@@ -524,6 +846,11 @@ func uploadIndexWithRetry(ctx context.Context, url string, indexData []byte, max
 			return fmt.Errorf("HTTP %d", resp.StatusCode)
 		}
 
+		// An expired URL is refreshed by the caller
+		if resp.StatusCode == http.StatusForbidden {
+			return backoff.Permanent(fmt.Errorf("HTTP %d: %w", resp.StatusCode, errPresignedURLRejected))
+		}
+
 		// Non-retryable error - wrap with Permanent to stop retrying
 		return backoff.Permanent(fmt.Errorf("HTTP %d", resp.StatusCode))
 	}
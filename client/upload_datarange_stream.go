@@ -0,0 +1,428 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/draganm/datas3t/tarindex"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// DefaultStreamPartSize is the size of the parts a stream is uploaded in
+	DefaultStreamPartSize = 20 * 1024 * 1024
+	// MinStreamPartSize is the smallest part size S3 accepts for all but the last part
+	MinStreamPartSize = 5 * 1024 * 1024
+
+	// maxStreamParts is the maximum number of parts of a multipart upload
+	maxStreamParts = 10000
+	// streamPresignBatch is the number of part URLs requested at once
+	streamPresignBatch = 100
+)
+
+// UploadDataRangeStream uploads a TAR archive of unknown size, e.g. one piped to stdin.
+// The archive is indexed while it is read and uploaded in parts of
+// UploadOptions.StreamPartSize, so at most MaxParallelism+1 parts are held in memory.
+// Its size and datapoint range are declared to the server once the stream has ended.
+// The files of the archive must be regular files with contiguous keys in ascending order.
+// The archives of encrypted datas3ts are encrypted while they are read.
+// Streamed uploads cannot take a lease or be resumed from a state file.
+func (c *Client) UploadDataRangeStream(ctx context.Context, datas3tName string, r io.Reader, opts *UploadOptions) (err error) {
+	if opts == nil {
+		opts = DefaultUploadOptions()
+	}
+
+	partSize := opts.StreamPartSize
+	if partSize == 0 {
+		partSize = DefaultStreamPartSize
+	}
+
+	switch {
+	case partSize < MinStreamPartSize:
+		return ValidationError(fmt.Errorf("stream part size must be at least %d bytes", MinStreamPartSize))
+	case opts.LeaseDuration > 0:
+		return ValidationError(fmt.Errorf("streamed uploads cannot take a lease"))
+	case opts.StateFile != "":
+		return ValidationError(fmt.Errorf("streamed uploads cannot be resumed from a state file"))
+	case opts.Replace:
+		return ValidationError(fmt.Errorf("streamed uploads cannot replace dataranges"))
+	case opts.AssignKeys || opts.KeyMapping != nil:
+		return ValidationError(fmt.Errorf("streamed uploads cannot assign datapoint keys, the file names must be keys"))
+	}
+
+	tracker := newProgressTracker(opts.ProgressCallback, 0)
+	tracker.totalSteps = 4 // Total phases: start, upload, upload_index, complete
+
+	uploadReq := &UploadDatarangeRequest{
+		Datas3tName: datas3tName,
+		Stream:      true,
+	}
+
+	encrypted, err := c.datas3tEncrypted(ctx, datas3tName)
+	if err != nil {
+		return err
+	}
+
+	if encrypted {
+		encryptedStream, wrappedDataKey, err := c.newEncryptingTarReader(r)
+		if err != nil {
+			return err
+		}
+		defer encryptedStream.Close()
+
+		r = encryptedStream
+		uploadReq.WrappedDataKey = wrappedDataKey
+	}
+	if opts.PresignExpiry > 0 {
+		uploadReq.PresignExpirySeconds = int64(max(opts.PresignExpiry, time.Second) / time.Second)
+	}
+
+	// Phase 1: Start upload
+	tracker.reportProgress(PhaseStarting, "Starting upload session", 0)
+	uploadResp, err := c.StartDatarangeUpload(ctx, uploadReq)
+	if err != nil {
+		return fmt.Errorf("failed to start upload: %w", err)
+	}
+	tracker.nextStep()
+
+	defer func() {
+		if err != nil {
+			c.CancelDatarangeUpload(ctx, &CancelUploadRequest{DatarangeUploadID: uploadResp.DatarangeID}) // Best effort, ignore error
+		}
+	}()
+
+	// Phase 2: Index and upload data
+	tracker.reportProgress(PhaseUploading, "Uploading data", 0)
+	partURLs := &streamPartURLs{
+		client:               c,
+		datarangeID:          uploadResp.DatarangeID,
+		presignExpirySeconds: uploadReq.PresignExpirySeconds,
+		urls:                 map[int32]string{},
+	}
+
+	uploader := newStreamPartUploader(ctx, partURLs, partSize, opts, tracker)
+	stream, err := indexTarStream(io.TeeReader(r, uploader), r)
+	if err == nil {
+		uploader.close()
+	}
+
+	// A failed part upload stops reading the stream, so it is reported first
+	uploadIDs, uploadErr := uploader.wait()
+	if uploadErr != nil {
+		return fmt.Errorf("failed to upload data: %w", uploadErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read tar stream: %w", err)
+	}
+	tracker.nextStep()
+
+	// Phase 3: Upload index
+	tracker.reportProgress(PhaseUploadingIndex, "Uploading index", 0)
+	indexURL := newRefreshableURLs([]string{uploadResp.PresignedIndexPutURL}, func(ctx context.Context) ([]string, error) {
+		resp, err := c.ResumeDatarangeUpload(ctx, &ResumeUploadRequest{
+			DatarangeUploadID:    uploadResp.DatarangeID,
+			PresignExpirySeconds: uploadReq.PresignExpirySeconds,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return []string{resp.PresignedIndexPutURL}, nil
+	})
+	err = indexURL.do(ctx, 0, func(url string) error {
+		return uploadIndexWithRetry(ctx, url, uploadResp.PutHeaders, stream.index, opts.MaxRetries, tracker)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload index: %w", err)
+	}
+	tracker.nextStep()
+
+	// Phase 4: Complete upload
+	tracker.reportProgress(PhaseCompleting, "Completing upload", 0)
+	err = c.CompleteDatarangeUpload(ctx, &CompleteUploadRequest{
+		DatarangeUploadID:   uploadResp.DatarangeID,
+		UploadIDs:           uploadIDs,
+		DataSize:            uint64(stream.size),
+		FirstDatapointIndex: stream.firstDatapointIndex,
+		NumberOfDatapoints:  stream.numberOfDatapoints,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+	tracker.nextStep()
+
+	tracker.reportProgress(PhaseCompleting, "Upload completed successfully", 0)
+	return nil
+}
+
+// indexedTarStream describes a TAR archive that was indexed while it was read
+type indexedTarStream struct {
+	index               []byte
+	size                int64
+	firstDatapointIndex uint64
+	numberOfDatapoints  uint64
+}
+
+// indexTarStream reads a TAR archive from r and indexes it. The archive ends with its
+// end-of-archive marker; the record padding some tar implementations write after it is
+// read from rest, which must not be part of the uploaded data.
+func indexTarStream(r io.Reader, rest io.Reader) (*indexedTarStream, error) {
+	counter := &countingReader{r: r}
+	tr := tar.NewReader(counter)
+	stream := &indexedTarStream{}
+
+	for {
+		// The padding of the previous file is only read by the next call to Next
+		headerPosition := stream.size
+
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar entry: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("entry '%s' is not a regular file", header.Name)
+		}
+
+		// Extended headers, e.g. the PAX records of the original name, precede the header
+		contentPosition := counter.n
+		headerBlocks := uint16((contentPosition - headerPosition) / tarBlockSize)
+
+		key, err := extractDatapointKeyFromFileName(header.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filename '%s': %w", header.Name, err)
+		}
+
+		if stream.numberOfDatapoints == 0 {
+			stream.firstDatapointIndex = uint64(key)
+		} else if uint64(key) != stream.firstDatapointIndex+stream.numberOfDatapoints {
+			return nil, fmt.Errorf("gap in datapoint sequence: expected %d, found %d", stream.firstDatapointIndex+stream.numberOfDatapoints, key)
+		}
+
+		stream.index = tarindex.AppendIndexEntry(stream.index, headerPosition, headerBlocks, header.Size)
+		stream.numberOfDatapoints++
+
+		_, err = io.Copy(io.Discard, tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file content: %w", err)
+		}
+
+		stream.size = contentPosition + (header.Size+tarBlockSize-1)/tarBlockSize*tarBlockSize
+	}
+
+	if stream.numberOfDatapoints == 0 {
+		return nil, fmt.Errorf("no valid datapoint files found in tar archive")
+	}
+
+	// The archive ends with two zero blocks
+	stream.size += 2 * tarBlockSize
+	if counter.n != stream.size {
+		return nil, fmt.Errorf("tar archive does not end with an end-of-archive marker")
+	}
+
+	err := checkZeroPadding(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	return stream, nil
+}
+
+// checkZeroPadding drains r, which may only contain zeros
+func checkZeroPadding(r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return fmt.Errorf("unexpected data after the end of the tar archive")
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read the end of the tar archive: %w", err)
+		}
+	}
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// streamPartURLs presigns the part URLs of a streamed upload in batches as they are needed
+type streamPartURLs struct {
+	client               *Client
+	datarangeID          int64
+	presignExpirySeconds int64
+
+	mu      sync.Mutex
+	urls    map[int32]string
+	headers map[string]string
+}
+
+// get returns the URL of a part and the headers to send with it. A URL that S3 rejected
+// is passed as rejected, which presigns it again.
+func (s *streamPartURLs) get(ctx context.Context, partNumber int32, rejected string) (string, map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	url, found := s.urls[partNumber]
+	if found && url != rejected {
+		return url, s.headers, nil
+	}
+
+	resp, err := s.client.PresignUploadParts(ctx, &PresignUploadPartsRequest{
+		DatarangeUploadID:    s.datarangeID,
+		FirstPartNumber:      partNumber,
+		NumberOfParts:        min(streamPresignBatch, maxStreamParts-partNumber+1),
+		PresignExpirySeconds: s.presignExpirySeconds,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	for _, part := range resp.PresignedPartURLs {
+		s.urls[part.PartNumber] = part.URL
+	}
+	s.headers = resp.PartHeaders
+
+	url, found = s.urls[partNumber]
+	if !found {
+		return "", nil, fmt.Errorf("server returned no URL for part %d", partNumber)
+	}
+
+	return url, s.headers, nil
+}
+
+// streamPartUploader cuts the bytes written to it into parts and uploads them in the background
+type streamPartUploader struct {
+	ctx      context.Context
+	g        *errgroup.Group
+	urls     *streamPartURLs
+	partSize int
+	opts     *UploadOptions
+	tracker  *progressTracker
+
+	buf   []byte
+	etags []string
+	mu    sync.Mutex
+}
+
+func newStreamPartUploader(ctx context.Context, urls *streamPartURLs, partSize int, opts *UploadOptions, tracker *progressTracker) *streamPartUploader {
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(opts.MaxParallelism, 1))
+
+	return &streamPartUploader{
+		ctx:      ctx,
+		g:        g,
+		urls:     urls,
+		partSize: partSize,
+		opts:     opts,
+		tracker:  tracker,
+		buf:      make([]byte, 0, partSize),
+	}
+}
+
+// Write buffers p and starts the upload of every completed part. It fails once an
+// upload has failed, which stops reading the stream.
+func (u *streamPartUploader) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) > 0 {
+		n := min(len(p), u.partSize-len(u.buf))
+		u.buf = append(u.buf, p[:n]...)
+		p = p[n:]
+
+		if len(u.buf) == u.partSize {
+			err := u.flush()
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// close uploads the buffered bytes as the last part
+func (u *streamPartUploader) close() {
+	if len(u.buf) > 0 || len(u.etags) == 0 {
+		u.flush()
+	}
+}
+
+func (u *streamPartUploader) flush() error {
+	err := u.ctx.Err()
+	if err != nil {
+		return err
+	}
+
+	if len(u.etags) == maxStreamParts {
+		return fmt.Errorf("stream exceeds %d parts of %d bytes, use a larger part size", maxStreamParts, u.partSize)
+	}
+
+	u.mu.Lock()
+	u.etags = append(u.etags, "")
+	partNumber := int32(len(u.etags))
+	u.mu.Unlock()
+
+	part := u.buf
+	u.buf = make([]byte, 0, u.partSize)
+
+	u.g.Go(func() error {
+		etag, err := u.uploadPart(partNumber, part)
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+		}
+
+		u.mu.Lock()
+		u.etags[partNumber-1] = etag
+		u.mu.Unlock()
+		return nil
+	})
+
+	return nil
+}
+
+// uploadPart uploads a part, presigning its URL once more if S3 rejects it
+func (u *streamPartUploader) uploadPart(partNumber int32, part []byte) (string, error) {
+	var rejected string
+	for attempt := 0; ; attempt++ {
+		url, headers, err := u.urls.get(u.ctx, partNumber, rejected)
+		if err != nil {
+			return "", err
+		}
+
+		etag, err := uploadChunkWithRetry(u.ctx, url, headers, bytes.NewReader(part), 0, int64(len(part)), u.opts.MaxRetries, u.tracker, int(partNumber), 0)
+		if errors.Is(err, errPresignedURLRejected) && attempt == 0 {
+			rejected = url
+			continue
+		}
+		return etag, err
+	}
+}
+
+// wait waits for all parts to be uploaded and returns their ETags
+func (u *streamPartUploader) wait() ([]string, error) {
+	err := u.g.Wait()
+	if err != nil {
+		return nil, fmt.Errorf("multipart upload failed: %w", err)
+	}
+
+	return u.etags, nil
+}
@@ -0,0 +1,365 @@
+package client
+
+import (
+	"archive/tar"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadDirOptions configures how UploadDir turns the files of a directory into dataranges
+type UploadDirOptions struct {
+	// AssignKeys numbers the files with sequential keys starting at FirstDatapoint, in the
+	// sorted order of their paths. Without it every file must be named %020d.<extension>
+	// and its key is taken from the name.
+	AssignKeys bool
+	// FirstDatapoint is the key of the first file when AssignKeys is set
+	FirstDatapoint uint64
+	// Append lets the server allocate the keys of each datarange. The files are numbered
+	// in the sorted order of their paths, as with AssignKeys.
+	Append bool
+	// MaxDatarangeSize splits the files into dataranges whose tar archives are at most this
+	// many bytes, unless a single file is larger (default: 256MB)
+	MaxDatarangeSize int64
+	// UploadOptions configures the upload of each datarange (default: DefaultUploadOptions()).
+	// State files are not supported, an interrupted directory upload is started again.
+	UploadOptions *UploadOptions
+	// OnDatarangeUploaded is called after a datarange has been uploaded successfully
+	OnDatarangeUploaded func(firstDatapoint, lastDatapoint uint64)
+}
+
+// DefaultUploadDirOptions returns sensible default options
+func DefaultUploadDirOptions() *UploadDirOptions {
+	return &UploadDirOptions{
+		MaxDatarangeSize: 256 * 1024 * 1024,
+		UploadOptions:    DefaultUploadOptions(),
+	}
+}
+
+// UploadedFile maps a file of an uploaded directory to the datapoint it was stored as
+type UploadedFile struct {
+	Path string `json:"path"` // Relative to the directory, with forward slashes
+	Key  uint64 `json:"key"`
+	Name string `json:"name"` // Name of the datapoint in the datas3t, %020d.<extension>
+}
+
+// dirFile is a regular file found in the uploaded directory
+type dirFile struct {
+	path      string
+	relPath   string
+	size      int64
+	modTime   time.Time
+	key       uint64
+	extension string
+}
+
+// UploadDir uploads all regular files below dir, including subdirectories, as datapoints.
+// The tar archive of each datarange is assembled on the fly while it is uploaded, so no
+// temporary archive is written. A new datarange is started whenever MaxDatarangeSize would
+// be exceeded and at every gap between the keys of named files.
+//
+// It returns the datapoint of every uploaded file. When an upload fails, the files of the
+// dataranges uploaded before are returned together with the error.
+func (c *Client) UploadDir(ctx context.Context, datas3tName, dir string, opts *UploadDirOptions) ([]UploadedFile, error) {
+	if datas3tName == "" {
+		return nil, ValidationError(fmt.Errorf("datas3t name is required"))
+	}
+
+	defaults := DefaultUploadDirOptions()
+	if opts == nil {
+		opts = defaults
+	}
+
+	o := *opts
+	if o.MaxDatarangeSize <= 0 {
+		o.MaxDatarangeSize = defaults.MaxDatarangeSize
+	}
+	if o.UploadOptions == nil {
+		o.UploadOptions = defaults.UploadOptions
+	}
+	if o.UploadOptions.StateFile != "" {
+		return nil, ValidationError(fmt.Errorf("state files are not supported when uploading a directory"))
+	}
+	if o.UploadOptions.Replace {
+		return nil, ValidationError(fmt.Errorf("directory uploads cannot replace dataranges"))
+	}
+	if o.UploadOptions.AssignKeys || o.UploadOptions.KeyMapping != nil {
+		return nil, ValidationError(fmt.Errorf("keys of a directory upload are assigned with UploadDirOptions.AssignKeys"))
+	}
+	if o.Append && o.AssignKeys {
+		return nil, ValidationError(fmt.Errorf("keys are allocated by the server in append mode and cannot be assigned"))
+	}
+
+	files, err := scanDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files found in %s", dir)
+	}
+
+	if o.AssignKeys || o.Append {
+		err = assignDirKeys(files, o.FirstDatapoint)
+	} else {
+		files, err = keysFromDirFileNames(files)
+	}
+	if err != nil {
+		return nil, ValidationError(err)
+	}
+
+	uploaded := make([]UploadedFile, 0, len(files))
+	for _, group := range splitDirFiles(files, o.MaxDatarangeSize) {
+		archive, index, err := newDirTar(group, o.Append)
+		if err != nil {
+			return uploaded, err
+		}
+
+		uploadReq := &UploadDatarangeRequest{
+			Datas3tName:        datas3tName,
+			DataSize:           uint64(archive.size),
+			NumberOfDatapoints: uint64(len(group)),
+			Append:             o.Append,
+		}
+		if !o.Append {
+			uploadReq.FirstDatapointIndex = group[0].key
+		}
+
+		firstKey, err := c.uploadIndexedDatarange(
+			ctx,
+			uploadReq,
+			archive,
+			index,
+			o.UploadOptions,
+			newProgressTracker(o.UploadOptions.ProgressCallback, archive.size),
+		)
+		if err != nil {
+			return uploaded, fmt.Errorf("failed to upload %s to %s: %w", group[0].relPath, group[len(group)-1].relPath, err)
+		}
+
+		for i, file := range group {
+			key := firstKey + uint64(i)
+			uploaded = append(uploaded, UploadedFile{
+				Path: file.relPath,
+				Key:  key,
+				Name: fmt.Sprintf("%020d.%s", key, file.extension),
+			})
+		}
+
+		if o.OnDatarangeUploaded != nil {
+			o.OnDatarangeUploaded(firstKey, firstKey+uint64(len(group))-1)
+		}
+	}
+
+	return uploaded, nil
+}
+
+// scanDir lists the regular files below dir sorted by their relative paths
+func scanDir(dir string) ([]dirFile, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+
+	var files []dirFile
+
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return fmt.Errorf("%s is not a regular file", path)
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, dirFile{
+			path:    path,
+			relPath: filepath.ToSlash(relPath),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan directory %s: %w", dir, err)
+	}
+
+	slices.SortFunc(files, func(a, b dirFile) int {
+		return strings.Compare(a.relPath, b.relPath)
+	})
+
+	return files, nil
+}
+
+// assignDirKeys numbers the files in order, keeping the extension of their names.
+// Files without an extension are stored as "bin".
+func assignDirKeys(files []dirFile, firstKey uint64) error {
+	for i := range files {
+		extension := strings.TrimPrefix(filepath.Ext(files[i].relPath), ".")
+		if extension == "" {
+			extension = "bin"
+		}
+
+		err := validateExtension(extension)
+		if err != nil {
+			return fmt.Errorf("file %s: %w", files[i].relPath, err)
+		}
+
+		files[i].key = firstKey + uint64(i)
+		files[i].extension = extension
+	}
+
+	return nil
+}
+
+// keysFromDirFileNames takes the keys from the %020d.<extension> file names and sorts
+// the files by key
+func keysFromDirFileNames(files []dirFile) ([]dirFile, error) {
+	for i := range files {
+		name := filepath.Base(files[i].path)
+		if !isValidFileName(name) {
+			return nil, fmt.Errorf("file %s is not named %%020d.<extension>, assign keys to upload arbitrarily named files", files[i].relPath)
+		}
+
+		key, err := strconv.ParseUint(name[:20], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("file %s: invalid datapoint key: %w", files[i].relPath, err)
+		}
+
+		extension := name[21:]
+		err = validateExtension(extension)
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %w", files[i].relPath, err)
+		}
+
+		files[i].key = key
+		files[i].extension = extension
+	}
+
+	slices.SortStableFunc(files, func(a, b dirFile) int {
+		return cmp.Compare(a.key, b.key)
+	})
+
+	for i := 1; i < len(files); i++ {
+		if files[i].key == files[i-1].key {
+			return nil, fmt.Errorf("files %s and %s have the same datapoint key %d", files[i-1].relPath, files[i].relPath, files[i].key)
+		}
+	}
+
+	return files, nil
+}
+
+// dirTarEntrySize is the number of bytes a file occupies in a tar archive
+func dirTarEntrySize(size int64) int64 {
+	return tarBlockSize + (size+tarBlockSize-1)/tarBlockSize*tarBlockSize
+}
+
+// splitDirFiles groups files sorted by key into contiguous dataranges of at most maxSize bytes
+func splitDirFiles(files []dirFile, maxSize int64) [][]dirFile {
+	var groups [][]dirFile
+	var current []dirFile
+	var currentSize int64
+
+	for _, file := range files {
+		entrySize := dirTarEntrySize(file.size)
+
+		if len(current) > 0 {
+			last := current[len(current)-1]
+			if file.key != last.key+1 || currentSize+entrySize+2*tarBlockSize > maxSize {
+				groups = append(groups, current)
+				current = nil
+				currentSize = 0
+			}
+		}
+
+		current = append(current, file)
+		currentSize += entrySize
+	}
+
+	return append(groups, current)
+}
+
+// newDirTar lays out the archive of a datarange and builds its index. In append mode the
+// files are numbered from 0, they are renamed to the allocated keys while uploading.
+func newDirTar(files []dirFile, appendMode bool) (*assembledTar, []byte, error) {
+	t := &assembledTar{}
+
+	for i, file := range files {
+		key := file.key
+		if appendMode {
+			key = uint64(i)
+		}
+
+		var buf bytes.Buffer
+		err := tar.NewWriter(&buf).WriteHeader(&tar.Header{
+			Name:     fmt.Sprintf("%020d.%s", key, file.extension),
+			Size:     file.size,
+			Mode:     0644,
+			ModTime:  file.modTime.Truncate(time.Second),
+			Typeflag: tar.TypeReg,
+			Format:   tar.FormatUSTAR,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create tar header for %s: %w", file.relPath, err)
+		}
+
+		if buf.Len() != tarBlockSize {
+			return nil, nil, fmt.Errorf("tar header of %s does not fit into a single block", file.relPath)
+		}
+
+		t.add(buf.Bytes(), file.size, file.readAt)
+	}
+
+	t.close()
+
+	return t, t.index, nil
+}
+
+// readAt fills p with the content of the file at off. The file is opened for every read,
+// so that an archive of many files does not keep them all open.
+func (f *dirFile) readAt(p []byte, off int64) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", f.path, err)
+	}
+	defer file.Close()
+
+	_, err = file.ReadAt(p, off)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("file %s changed while uploading: %w", f.path, io.ErrUnexpectedEOF)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", f.path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,292 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// uploadState is the progress of an upload persisted to UploadOptions.StateFile, so
+// that the upload can be resumed after the client was restarted. It is written after
+// every uploaded part and removed once the upload is completed.
+type uploadState struct {
+	Datas3tName         string `json:"datas3t_name"`
+	DataSize            uint64 `json:"data_size"`
+	NumberOfDatapoints  uint64 `json:"number_of_datapoints"`
+	Append              bool   `json:"append,omitempty"`
+	FirstDatapointIndex uint64 `json:"first_datapoint_index"`
+
+	// IndexChecksum detects a resume with a different archive of the same size
+	IndexChecksum string `json:"index_checksum"`
+
+	DatarangeUploadID int64            `json:"datarange_upload_id"`
+	PartETags         map[int32]string `json:"part_etags,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+func newUploadState(path string, uploadReq *UploadDatarangeRequest, indexData []byte, uploadResp *UploadDatarangeResponse) *uploadState {
+	return &uploadState{
+		Datas3tName:         uploadReq.Datas3tName,
+		DataSize:            uploadReq.DataSize,
+		NumberOfDatapoints:  uploadReq.NumberOfDatapoints,
+		Append:              uploadReq.Append,
+		FirstDatapointIndex: uploadResp.FirstDatapointIndex,
+		IndexChecksum:       indexChecksum(indexData),
+		DatarangeUploadID:   uploadResp.DatarangeID,
+		PartETags:           map[int32]string{},
+		path:                path,
+	}
+}
+
+// loadUploadState reads the state file at path. It returns nil when there is no state
+// file, i.e. when there is no upload to resume.
+func loadUploadState(path string) (*uploadState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload state: %w", err)
+	}
+
+	state := &uploadState{path: path}
+	err = json.Unmarshal(data, state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse upload state %s: %w", path, err)
+	}
+
+	if state.PartETags == nil {
+		state.PartETags = map[int32]string{}
+	}
+
+	return state, nil
+}
+
+func indexChecksum(indexData []byte) string {
+	sum := sha256.Sum256(indexData)
+	return hex.EncodeToString(sum[:])
+}
+
+// matches checks that the state belongs to an upload of the same archive
+func (s *uploadState) matches(uploadReq *UploadDatarangeRequest, indexData []byte) error {
+	switch {
+	case s.Datas3tName != uploadReq.Datas3tName:
+		return fmt.Errorf("upload state %s belongs to an upload to datas3t %s", s.path, s.Datas3tName)
+	case s.Append != uploadReq.Append:
+		return fmt.Errorf("upload state %s belongs to an upload with append mode %t", s.path, s.Append)
+	case s.DataSize != uploadReq.DataSize,
+		s.NumberOfDatapoints != uploadReq.NumberOfDatapoints,
+		!s.Append && s.FirstDatapointIndex != uploadReq.FirstDatapointIndex,
+		s.IndexChecksum != indexChecksum(indexData):
+		return fmt.Errorf("upload state %s belongs to the upload of a different file", s.path)
+	}
+	return nil
+}
+
+// recordPart stores the ETag of an uploaded part and persists the state
+func (s *uploadState) recordPart(partNumber int32, etag string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.PartETags[partNumber] = etag
+	return s.saveLocked()
+}
+
+func (s *uploadState) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.saveLocked()
+}
+
+// saveLocked replaces the state file atomically, so that a crash while saving
+// leaves the previous state intact
+func (s *uploadState) saveLocked() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload state: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create upload state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write upload state: %w", err)
+	}
+
+	err = tmp.Sync()
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync upload state: %w", err)
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close upload state file: %w", err)
+	}
+
+	err = os.Rename(tmp.Name(), s.path)
+	if err != nil {
+		return fmt.Errorf("failed to replace upload state: %w", err)
+	}
+
+	return nil
+}
+
+func (s *uploadState) remove() error {
+	err := os.Remove(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove upload state: %w", err)
+	}
+	return nil
+}
+
+// uploadSession holds the presigned URLs of a started or resumed upload
+type uploadSession struct {
+	datarangeID         int64
+	firstDatapointIndex uint64
+	useDirectPut        bool
+	leased              bool
+
+	// wrappedDataKey is the data key the content of a resumed upload is encrypted with
+	wrappedDataKey string
+
+	// putHeaders and partHeaders must be sent with the requests to the data and index
+	// URLs and to the part URLs
+	putHeaders  map[string]string
+	partHeaders map[string]string
+
+	// etags has an entry for every part of a multipart upload, set for the parts
+	// that are already uploaded
+	etags []string
+
+	// urls holds the URL of every part followed by the data and the index URL.
+	// Parts that are already uploaded have an empty URL.
+	urls *refreshableURLs
+}
+
+func (s *uploadSession) dataURLIndex() int {
+	return len(s.etags)
+}
+
+func (s *uploadSession) indexURLIndex() int {
+	return len(s.etags) + 1
+}
+
+func (c *Client) newUploadSession(resp *UploadDatarangeResponse, presignExpirySeconds int64) *uploadSession {
+	numParts := len(resp.PresignedMultipartUploadPutURLs)
+
+	urls := make([]string, 0, numParts+2)
+	urls = append(urls, resp.PresignedMultipartUploadPutURLs...)
+	urls = append(urls, resp.PresignedDataPutURL, resp.PresignedIndexPutURL)
+
+	return &uploadSession{
+		datarangeID:         resp.DatarangeID,
+		firstDatapointIndex: resp.FirstDatapointIndex,
+		useDirectPut:        resp.UseDirectPut,
+		leased:              resp.LeaseExpiresAt != nil,
+		putHeaders:          resp.PutHeaders,
+		partHeaders:         resp.PartHeaders,
+		etags:               make([]string, numParts),
+		urls:                newRefreshableURLs(urls, c.uploadURLRefresher(resp.DatarangeID, numParts, presignExpirySeconds)),
+	}
+}
+
+// uploadURLRefresher re-presigns the URLs of an upload through the resume endpoint, which
+// only returns URLs for the parts that are not stored yet
+func (c *Client) uploadURLRefresher(datarangeID int64, numParts int, presignExpirySeconds int64) func(ctx context.Context) ([]string, error) {
+	return func(ctx context.Context) ([]string, error) {
+		resp, err := c.ResumeDatarangeUpload(ctx, &ResumeUploadRequest{
+			DatarangeUploadID:    datarangeID,
+			PresignExpirySeconds: presignExpirySeconds,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return resumedUploadURLs(resp, numParts)
+	}
+}
+
+func resumedUploadURLs(resp *ResumeUploadResponse, numParts int) ([]string, error) {
+	urls := make([]string, numParts+2)
+	for _, part := range resp.PresignedPartURLs {
+		if part.PartNumber < 1 || int(part.PartNumber) > numParts {
+			return nil, fmt.Errorf("server returned an URL for part %d of %d", part.PartNumber, numParts)
+		}
+		urls[part.PartNumber-1] = part.URL
+	}
+	urls[numParts] = resp.PresignedDataPutURL
+	urls[numParts+1] = resp.PresignedIndexPutURL
+
+	return urls, nil
+}
+
+// resumeUploadSession continues the upload recorded in state. The parts listed by the
+// server are the ones stored in S3; the ETags recorded locally guard against parts that
+// were replaced since this client uploaded them.
+func (c *Client) resumeUploadSession(ctx context.Context, state *uploadState, leaseDurationSeconds, presignExpirySeconds int64) (*uploadSession, error) {
+	resp, err := c.ResumeDatarangeUpload(ctx, &ResumeUploadRequest{
+		DatarangeUploadID:    state.DatarangeUploadID,
+		PresignExpirySeconds: presignExpirySeconds,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	urls, err := resumedUploadURLs(resp, resp.NumberOfParts)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &uploadSession{
+		datarangeID:         resp.DatarangeID,
+		firstDatapointIndex: resp.FirstDatapointIndex,
+		useDirectPut:        resp.UseDirectPut,
+		wrappedDataKey:      resp.WrappedDataKey,
+		putHeaders:          resp.PutHeaders,
+		partHeaders:         resp.PartHeaders,
+		etags:               make([]string, resp.NumberOfParts),
+		urls:                newRefreshableURLs(urls, c.uploadURLRefresher(resp.DatarangeID, resp.NumberOfParts, presignExpirySeconds)),
+	}
+
+	for _, part := range resp.UploadedParts {
+		if part.PartNumber < 1 || int(part.PartNumber) > resp.NumberOfParts {
+			continue
+		}
+
+		// A part missing from the state was stored just before the client stopped
+		recorded, ok := state.PartETags[part.PartNumber]
+		if ok && recorded != part.ETag {
+			return nil, fmt.Errorf("part %d of upload %d has changed since it was uploaded", part.PartNumber, state.DatarangeUploadID)
+		}
+
+		session.etags[part.PartNumber-1] = part.ETag
+	}
+
+	if leaseDurationSeconds > 0 {
+		_, err = c.RenewDatarangeUploadLease(ctx, &RenewLeaseRequest{
+			DatarangeUploadID:    resp.DatarangeID,
+			LeaseDurationSeconds: leaseDurationSeconds,
+		})
+		if err != nil {
+			return nil, err
+		}
+		session.leased = true
+	}
+
+	return session, nil
+}
@@ -29,6 +29,10 @@ func Command() *cli.Command {
 				Usage:    "Bucket configuration name",
 				Required: true,
 			},
+			&cli.BoolFlag{
+				Name:  "encrypted",
+				Usage: "Require the content of every datapoint to be encrypted by the clients with a data encryption key, cannot be changed later",
+			},
 		},
 		Action: addDatas3tAction,
 	}
@@ -38,8 +42,9 @@ func addDatas3tAction(c *cli.Context) error {
 	clientInstance := client.NewClient(c.String("server-url"))
 
 	req := &client.AddDatas3tRequest{
-		Name:   c.String("name"),
-		Bucket: c.String("bucket"),
+		Name:      c.String("name"),
+		Bucket:    c.String("bucket"),
+		Encrypted: c.Bool("encrypted"),
 	}
 
 	err := clientInstance.AddDatas3t(context.Background(), req)
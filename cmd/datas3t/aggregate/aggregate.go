@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/cmd/datas3t/dataencryption"
 	"github.com/urfave/cli/v2"
 )
 
@@ -111,7 +112,7 @@ This operation:
 
 The operation validates that the datapoint range is fully covered by existing dataranges
 with no gaps before proceeding.`,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "server-url",
 				Value:   "http://localhost:8765",
@@ -143,13 +144,17 @@ with no gaps before proceeding.`,
 				Usage: "Maximum number of retry attempts per operation",
 				Value: 3,
 			},
-		},
+		}, dataencryption.Flags()...),
 		Action: aggregateAction,
 	}
 }
 
 func aggregateAction(c *cli.Context) error {
 	clientInstance := client.NewClient(c.String("server-url"))
+	err := dataencryption.Configure(c, clientInstance)
+	if err != nil {
+		return err
+	}
 
 	datas3tName := c.String("datas3t")
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/storage"
 	"github.com/urfave/cli/v2"
 )
 
@@ -26,7 +27,7 @@ func Command() *cli.Command {
 			},
 			&cli.StringFlag{
 				Name:     "endpoint",
-				Usage:    "S3 endpoint (include https:// for TLS)",
+				Usage:    "S3 endpoint (include https:// for TLS), or file:///path for a local directory",
 				Required: true,
 			},
 			&cli.StringFlag{
@@ -35,14 +36,46 @@ func Command() *cli.Command {
 				Required: true,
 			},
 			&cli.StringFlag{
-				Name:     "access-key",
-				Usage:    "S3 access key",
-				Required: true,
+				Name:  "access-key",
+				Usage: "S3 access key, or file:///path or env:NAME the server reads it from (required unless the endpoint is local)",
 			},
 			&cli.StringFlag{
-				Name:     "secret-key",
-				Usage:    "S3 secret key",
-				Required: true,
+				Name:  "secret-key",
+				Usage: "S3 secret key, or file:///path or env:NAME the server reads it from (required unless the endpoint is local)",
+			},
+			&cli.StringFlag{
+				Name:  "session-token",
+				Usage: "STS session token of temporary credentials, or file:///path or env:NAME the server reads it from",
+			},
+			&cli.StringFlag{
+				Name:  "region",
+				Usage: "S3 region (default: us-east-1)",
+			},
+			&cli.StringFlag{
+				Name:  "addressing-style",
+				Value: "path",
+				Usage: "Address the bucket in the URL path (path) or host name (virtual)",
+			},
+			&cli.StringFlag{
+				Name:  "credential-mode",
+				Value: "static",
+				Usage: "Authenticate with the given keys (static) or the credential chain of the server (ambient)",
+			},
+			&cli.StringFlag{
+				Name:  "key-prefix",
+				Usage: "Prefix of the object keys in the bucket, to share one bucket between environments or tenants",
+			},
+			&cli.StringFlag{
+				Name:  "sse-mode",
+				Usage: "Server-side encryption of the objects: sse-s3, sse-kms or sse-c (default: the default encryption of the bucket)",
+			},
+			&cli.StringFlag{
+				Name:  "sse-kms-key-id",
+				Usage: "KMS key of the sse-kms mode (default: the AWS managed key of the account)",
+			},
+			&cli.StringFlag{
+				Name:  "sse-customer-key",
+				Usage: "Base64-encoded 256-bit key of the sse-c mode, or file:///path or env:NAME the server reads it from",
 			},
 		},
 		Action: addBucketAction,
@@ -52,12 +85,24 @@ func Command() *cli.Command {
 func addBucketAction(c *cli.Context) error {
 	clientInstance := client.NewClient(c.String("server-url"))
 
+	if !storage.IsLocalEndpoint(c.String("endpoint")) && c.String("credential-mode") == "static" && (c.String("access-key") == "" || c.String("secret-key") == "") {
+		return fmt.Errorf("--access-key and --secret-key are required for S3 endpoints with the static credential mode")
+	}
+
 	bucketInfo := &client.BucketInfo{
-		Name:      c.String("name"),
-		Endpoint:  c.String("endpoint"),
-		Bucket:    c.String("bucket"),
-		AccessKey: c.String("access-key"),
-		SecretKey: c.String("secret-key"),
+		Name:            c.String("name"),
+		Endpoint:        c.String("endpoint"),
+		Bucket:          c.String("bucket"),
+		AccessKey:       c.String("access-key"),
+		SecretKey:       c.String("secret-key"),
+		SessionToken:    c.String("session-token"),
+		Region:          c.String("region"),
+		AddressingStyle: c.String("addressing-style"),
+		CredentialMode:  c.String("credential-mode"),
+		KeyPrefix:       c.String("key-prefix"),
+		SSEMode:         c.String("sse-mode"),
+		SSEKMSKeyID:     c.String("sse-kms-key-id"),
+		SSECustomerKey:  c.String("sse-customer-key"),
 	}
 
 	err := clientInstance.AddBucket(context.Background(), bucketInfo)
@@ -2,7 +2,10 @@ package bucket
 
 import (
 	bucketadd "github.com/draganm/datas3t/cmd/datas3t/bucket/add"
+	bucketdelete "github.com/draganm/datas3t/cmd/datas3t/bucket/delete"
 	bucketlist "github.com/draganm/datas3t/cmd/datas3t/bucket/list"
+	buckettest "github.com/draganm/datas3t/cmd/datas3t/bucket/test"
+	bucketupdate "github.com/draganm/datas3t/cmd/datas3t/bucket/update"
 	"github.com/urfave/cli/v2"
 )
 
@@ -13,6 +16,9 @@ func Command() *cli.Command {
 		Subcommands: []*cli.Command{
 			bucketadd.Command(),
 			bucketlist.Command(),
+			bucketupdate.Command(),
+			bucketdelete.Command(),
+			buckettest.Command(),
 		},
 	}
 }
\ No newline at end of file
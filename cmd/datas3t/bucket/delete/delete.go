@@ -0,0 +1,83 @@
+package bucketdelete
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "delete",
+		Usage: "Delete an S3 bucket configuration that no datas3t uses",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "Bucket configuration name to delete",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "Skip confirmation prompt",
+			},
+		},
+		Action: deleteBucketAction,
+	}
+}
+
+func deleteBucketAction(c *cli.Context) error {
+	bucketName := c.String("name")
+	force := c.Bool("force")
+
+	// Show confirmation prompt unless --force is used
+	if !force {
+		fmt.Printf("WARNING: This will delete the bucket configuration '%s'.\n", bucketName)
+		fmt.Printf("Note: No datas3t may use the bucket and no objects may wait for deletion. Objects stored in the bucket are not deleted.\n\n")
+		fmt.Printf("Are you sure you want to proceed? (y/N): ")
+
+		reader := bufio.NewReader(os.Stdin)
+		input, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read user input: %w", err)
+		}
+
+		input = strings.TrimSpace(strings.ToLower(input))
+		if input != "y" && input != "yes" {
+			fmt.Println("Operation cancelled.")
+			return nil
+		}
+	}
+
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	_, err := clientInstance.DeleteBucket(context.Background(), &client.DeleteBucketRequest{
+		Name: bucketName,
+	})
+	if err != nil {
+		if errors.Is(err, client.ErrBucketInUse) {
+			fmt.Printf("Error: Cannot delete bucket configuration '%s' because it is in use: %v\n", bucketName, err)
+			fmt.Printf("Hint: Clear and delete the datas3ts of the bucket and wait for the deletion of its objects, then try deleting again.\n")
+			return fmt.Errorf("bucket is in use")
+		}
+		if errors.Is(err, client.ErrBucketNotFound) {
+			return fmt.Errorf("bucket configuration '%s' does not exist", bucketName)
+		}
+		return fmt.Errorf("failed to delete bucket: %w", err)
+	}
+
+	fmt.Printf("Successfully deleted bucket configuration '%s'\n", bucketName)
+
+	return nil
+}
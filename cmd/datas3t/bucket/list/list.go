@@ -51,6 +51,20 @@ func listBucketsAction(c *cli.Context) error {
 		fmt.Printf("Endpoint: %s\n", b.Endpoint)
 		fmt.Printf("Bucket: %s\n", b.Bucket)
 		fmt.Printf("Use TLS: %t\n", bucket.IsEndpointTLS(b.Endpoint))
+		if b.Region != "" {
+			fmt.Printf("Region: %s\n", b.Region)
+		}
+		fmt.Printf("Addressing Style: %s\n", b.AddressingStyle)
+		fmt.Printf("Credential Mode: %s\n", b.CredentialMode)
+		if b.KeyPrefix != "" {
+			fmt.Printf("Key Prefix: %s\n", b.KeyPrefix)
+		}
+		if b.SSEMode != "" {
+			fmt.Printf("Server-Side Encryption: %s\n", b.SSEMode)
+		}
+		if b.SSEKMSKeyID != "" {
+			fmt.Printf("SSE KMS Key ID: %s\n", b.SSEKMSKeyID)
+		}
 		fmt.Println()
 	}
 
@@ -0,0 +1,58 @@
+package buckettest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "test",
+		Usage: "Check the list, write, read and delete permissions of an S3 bucket configuration",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "Bucket configuration name",
+				Required: true,
+			},
+		},
+		Action: testBucketAction,
+	}
+}
+
+func testBucketAction(c *cli.Context) error {
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	bucketName := c.String("name")
+
+	result, err := clientInstance.TestBucket(context.Background(), &client.TestBucketRequest{
+		Name: bucketName,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to test bucket: %w", err)
+	}
+
+	fmt.Printf("Permissions of bucket configuration '%s':\n", bucketName)
+	for _, check := range result.Checks {
+		if check.OK {
+			fmt.Printf("  %-7s OK\n", check.Permission)
+		} else {
+			fmt.Printf("  %-7s FAILED: %s\n", check.Permission, check.Error)
+		}
+	}
+
+	if !result.OK {
+		return fmt.Errorf("bucket configuration '%s' is missing permissions", bucketName)
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package bucketupdate
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "update",
+		Usage: "Update an S3 bucket configuration, settings that are not given are kept",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "name",
+				Usage:    "Bucket configuration name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "endpoint",
+				Usage: "S3 endpoint (include https:// for TLS), or file:///path for a local directory",
+			},
+			&cli.StringFlag{
+				Name:  "bucket",
+				Usage: "S3 bucket name",
+			},
+			&cli.StringFlag{
+				Name:  "access-key",
+				Usage: "S3 access key, or file:///path or env:NAME the server reads it from. Changing the keys drops the stored session token",
+			},
+			&cli.StringFlag{
+				Name:  "secret-key",
+				Usage: "S3 secret key, or file:///path or env:NAME the server reads it from. Changing the keys drops the stored session token",
+			},
+			&cli.StringFlag{
+				Name:  "session-token",
+				Usage: "STS session token of temporary credentials, or file:///path or env:NAME the server reads it from",
+			},
+			&cli.StringFlag{
+				Name:  "region",
+				Usage: "S3 region",
+			},
+			&cli.StringFlag{
+				Name:  "addressing-style",
+				Usage: "Address the bucket in the URL path (path) or host name (virtual)",
+			},
+			&cli.StringFlag{
+				Name:  "credential-mode",
+				Usage: "Authenticate with the given keys (static) or the credential chain of the server (ambient)",
+			},
+			&cli.StringFlag{
+				Name:  "key-prefix",
+				Usage: "Prefix of the object keys in the bucket, only while no datas3t uses the bucket",
+			},
+			&cli.StringFlag{
+				Name:  "sse-mode",
+				Usage: "Server-side encryption of new objects: sse-s3, sse-kms, sse-c or empty for the default encryption of the bucket",
+			},
+			&cli.StringFlag{
+				Name:  "sse-kms-key-id",
+				Usage: "KMS key of the sse-kms mode",
+			},
+			&cli.StringFlag{
+				Name:  "sse-customer-key",
+				Usage: "Base64-encoded 256-bit key of the sse-c mode, or file:///path or env:NAME the server reads it from, only while no datas3t uses the bucket",
+			},
+		},
+		Action: updateBucketAction,
+	}
+}
+
+func updateBucketAction(c *cli.Context) error {
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	req := &client.UpdateBucketRequest{
+		Name: c.String("name"),
+	}
+
+	// Only the settings given on the command line are sent to the server
+	settings := map[string]**string{
+		"endpoint":         &req.Endpoint,
+		"bucket":           &req.Bucket,
+		"access-key":       &req.AccessKey,
+		"secret-key":       &req.SecretKey,
+		"session-token":    &req.SessionToken,
+		"region":           &req.Region,
+		"addressing-style": &req.AddressingStyle,
+		"credential-mode":  &req.CredentialMode,
+		"key-prefix":       &req.KeyPrefix,
+		"sse-mode":         &req.SSEMode,
+		"sse-kms-key-id":   &req.SSEKMSKeyID,
+		"sse-customer-key": &req.SSECustomerKey,
+	}
+
+	changed := 0
+	for flag, setting := range settings {
+		if !c.IsSet(flag) {
+			continue
+		}
+		value := c.String(flag)
+		*setting = &value
+		changed++
+	}
+
+	if changed == 0 {
+		return fmt.Errorf("nothing to update, give at least one setting to change")
+	}
+
+	updated, err := clientInstance.UpdateBucket(context.Background(), req)
+	if err != nil {
+		return fmt.Errorf("failed to update bucket: %w", err)
+	}
+
+	fmt.Printf("Successfully updated bucket configuration '%s'\n", updated.Name)
+	fmt.Printf("  Endpoint: %s\n", updated.Endpoint)
+	fmt.Printf("  Bucket: %s\n", updated.Bucket)
+	if updated.Region != "" {
+		fmt.Printf("  Region: %s\n", updated.Region)
+	}
+	fmt.Printf("  Addressing Style: %s\n", updated.AddressingStyle)
+	fmt.Printf("  Credential Mode: %s\n", updated.CredentialMode)
+	if updated.KeyPrefix != "" {
+		fmt.Printf("  Key Prefix: %s\n", updated.KeyPrefix)
+	}
+	if updated.SSEMode != "" {
+		fmt.Printf("  Server-Side Encryption: %s\n", updated.SSEMode)
+	}
+	if updated.SSEKMSKeyID != "" {
+		fmt.Printf("  SSE KMS Key ID: %s\n", updated.SSEKMSKeyID)
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"strings"
 
 	"github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/cmd/datas3t/dataencryption"
 	"github.com/klauspost/compress/zstd"
 	"github.com/urfave/cli/v2"
 )
@@ -22,14 +23,14 @@ func Command() *cli.Command {
 	return &cli.Command{
 		Name:  "cat-range",
 		Usage: "Print contents of datapoints in a range",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "server-url",
 				Value:   "http://localhost:8765",
 				Usage:   "Server URL",
 				EnvVars: []string{"DATAS3T_SERVER_URL"},
 			},
-		},
+		}, dataencryption.Flags()...),
 		ArgsUsage: "<datas3t-name> <first-datapoint> <last-datapoint>",
 		Action:    catRangeAction,
 	}
@@ -60,6 +61,11 @@ func catRangeAction(c *cli.Context) error {
 
 	client := client.NewClient(c.String("server-url"))
 
+	err = dataencryption.Configure(c, client)
+	if err != nil {
+		return err
+	}
+
 	// Create custom iterator that gives us filenames and content
 	for filename, content := range datapointIteratorWithFilenames(client, context.Background(), datas3tName, first, last) {
 		decompressed, err := decompressContent(content, filename)
@@ -97,6 +103,7 @@ func datapointIteratorWithFilenames(c *client.Client, ctx context.Context, datas
 		// Create a reader from the download segments
 		reader := createSimpleReader(ctx, resp.DownloadSegments)
 		tarReader := tar.NewReader(reader)
+		decrypter := c.NewDatapointDecrypter(resp.DownloadSegments)
 
 		for {
 			header, err := tarReader.Next()
@@ -116,6 +123,10 @@ func datapointIteratorWithFilenames(c *client.Client, ctx context.Context, datas
 			if err != nil {
 				return // Can't yield error in this iterator pattern
 			}
+			data, err = decrypter.Decrypt(header.Name, data)
+			if err != nil {
+				return // Can't yield error in this iterator pattern
+			}
 			if !yield(filename, data) {
 				return
 			}
@@ -145,6 +156,10 @@ func (sr *segmentReader) Read(p []byte) (n int, err error) {
 		if err != nil {
 			return 0, err
 		}
+
+		for name, value := range sr.segment.Headers {
+			req.Header.Set(name, value)
+		}
 		
 		if sr.segment.Range != "" {
 			req.Header.Set("Range", sr.segment.Range)
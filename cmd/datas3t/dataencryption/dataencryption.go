@@ -0,0 +1,32 @@
+package dataencryption
+
+import (
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+// Flags returns the flags of the key the data keys of encrypted datas3ts are wrapped with
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "data-encryption-key",
+			Usage:   "Base64-encoded key the data keys of encrypted datas3ts are wrapped with (32 bytes)",
+			EnvVars: []string{"DATAS3T_DATA_ENCRYPTION_KEY"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "data-decryption-keys",
+			Usage:   "Base64-encoded keys data keys were wrapped with before a key rotation, comma-separated",
+			EnvVars: []string{"DATAS3T_DATA_DECRYPTION_KEYS"},
+		},
+	}
+}
+
+// Configure sets the data encryption key of the client when one was given
+func Configure(c *cli.Context, cl *client.Client) error {
+	key := c.String("data-encryption-key")
+	if key == "" {
+		return nil
+	}
+
+	return cl.SetDataEncryptionKey(key, c.StringSlice("data-decryption-keys")...)
+}
@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/cmd/datas3t/dataencryption"
 	"github.com/urfave/cli/v2"
 )
 
@@ -13,7 +14,7 @@ func Command() *cli.Command {
 	return &cli.Command{
 		Name:  "download-tar",
 		Usage: "Download a range of datapoints as a TAR file",
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "server-url",
 				Value:   "http://localhost:8765",
@@ -55,13 +56,25 @@ func Command() *cli.Command {
 				Usage: "Size of each download chunk in bytes",
 				Value: 5 * 1024 * 1024, // 5MB
 			},
-		},
+			&cli.DurationFlag{
+				Name:  "presign-expiry",
+				Usage: "How long the presigned download URLs stay valid, expired URLs are refreshed (default: server setting)",
+			},
+			&cli.BoolFlag{
+				Name:  "use-replica",
+				Usage: "Download from the replica of the datas3t, e.g. while its bucket is unavailable",
+			},
+		}, dataencryption.Flags()...),
 		Action: downloadTarAction,
 	}
 }
 
 func downloadTarAction(c *cli.Context) error {
 	clientInstance := client.NewClient(c.String("server-url"))
+	err := dataencryption.Configure(c, clientInstance)
+	if err != nil {
+		return err
+	}
 
 	datas3tName := c.String("datas3t")
 	outputPath := c.String("output")
@@ -86,7 +99,15 @@ func downloadTarAction(c *cli.Context) error {
 
 	fmt.Printf("Downloading datapoints %d-%d from datas3t '%s' to '%s'...\n", firstDatapoint, lastDatapoint, datas3tName, outputPath)
 
-	err = clientInstance.DownloadDatapointsTarWithOptions(context.Background(), datas3tName, firstDatapoint, lastDatapoint, outputPath, nil)
+	opts := &client.DownloadOptions{
+		MaxParallelism: c.Int("max-parallelism"),
+		MaxRetries:     c.Int("max-retries"),
+		ChunkSize:      c.Int64("chunk-size"),
+		PresignExpiry:  c.Duration("presign-expiry"),
+		UseReplica:     c.Bool("use-replica"),
+	}
+
+	err = clientInstance.DownloadDatapointsTarWithOptions(context.Background(), datas3tName, firstDatapoint, lastDatapoint, outputPath, opts)
 	if err != nil {
 		return fmt.Errorf("failed to download datapoints: %w", err)
 	}
@@ -0,0 +1,63 @@
+package leases
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "leases",
+		Usage: "List the active leases of pending datarange uploads",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "datas3t",
+				Usage:    "Datas3t name",
+				Required: true,
+			},
+		},
+		Action: listLeasesAction,
+	}
+}
+
+func listLeasesAction(c *cli.Context) error {
+	clientInstance := client.NewClient(c.String("server-url"))
+	datas3tName := c.String("datas3t")
+
+	leases, err := clientInstance.ListDatarangeUploadLeases(context.Background(), datas3tName)
+	if err != nil {
+		return fmt.Errorf("failed to list leases: %w", err)
+	}
+
+	if len(leases) == 0 {
+		fmt.Printf("No active leases for datas3t '%s'\n", datas3tName)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(w, "UPLOAD ID\tRANGE\tEXPIRES")
+	fmt.Fprintln(w, "---------\t-----\t-------")
+
+	for _, lease := range leases {
+		rangeStr := fmt.Sprintf("%d-%d", lease.FirstDatapointIndex, lease.LastDatapointIndex)
+		fmt.Fprintf(w, "%d\t%s\t%s\n", lease.DatarangeUploadID, rangeStr, lease.LeaseExpiresAt.Format(time.RFC3339))
+	}
+
+	w.Flush()
+
+	fmt.Printf("\nTotal leases: %d\n", len(leases))
+	return nil
+}
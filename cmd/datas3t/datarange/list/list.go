@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"text/tabwriter"
+	"time"
 
 	"github.com/draganm/datas3t/client"
 	"github.com/urfave/cli/v2"
@@ -13,7 +14,7 @@ import (
 func Command() *cli.Command {
 	return &cli.Command{
 		Name:  "list",
-		Usage: "List all dataranges of a datas3t",
+		Usage: "List dataranges of a datas3t",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "server-url",
@@ -26,6 +27,49 @@ func Command() *cli.Command {
 				Usage:    "Datas3t name",
 				Required: true,
 			},
+			&cli.Int64Flag{
+				Name:  "from-key",
+				Usage: "Only list dataranges containing datapoint keys at or after this key",
+			},
+			&cli.Int64Flag{
+				Name:  "to-key",
+				Usage: "Only list dataranges containing datapoint keys at or before this key",
+			},
+			&cli.Int64Flag{
+				Name:  "min-size",
+				Usage: "Only list dataranges of at least this many bytes",
+			},
+			&cli.Int64Flag{
+				Name:  "max-size",
+				Usage: "Only list dataranges of at most this many bytes",
+			},
+			&cli.TimestampFlag{
+				Name:   "created-after",
+				Usage:  "Only list dataranges created at or after this time (RFC 3339)",
+				Layout: time.RFC3339,
+			},
+			&cli.TimestampFlag{
+				Name:   "created-before",
+				Usage:  "Only list dataranges created before this time (RFC 3339)",
+				Layout: time.RFC3339,
+			},
+			&cli.StringFlag{
+				Name:  "sort",
+				Value: client.SortByKey,
+				Usage: "Sort by key, size or created_at",
+			},
+			&cli.BoolFlag{
+				Name:  "desc",
+				Usage: "Sort in descending order",
+			},
+			&cli.IntFlag{
+				Name:  "limit",
+				Usage: "Maximum number of dataranges to list (0 lists all)",
+			},
+			&cli.StringFlag{
+				Name:  "cursor",
+				Usage: "Continue listing from a cursor printed by a previous --limit invocation",
+			},
 		},
 		Action: listDatarangesAction,
 	}
@@ -35,10 +79,48 @@ func listDatarangesAction(c *cli.Context) error {
 	clientInstance := client.NewClient(c.String("server-url"))
 	datas3tName := c.String("datas3t")
 
-	// List dataranges
-	dataranges, err := clientInstance.ListDataranges(context.Background(), datas3tName)
-	if err != nil {
-		return fmt.Errorf("failed to list dataranges: %w", err)
+	req := &client.ListDatarangesRequest{
+		Datas3tName:   datas3tName,
+		SortBy:        c.String("sort"),
+		CreatedAfter:  c.Timestamp("created-after"),
+		CreatedBefore: c.Timestamp("created-before"),
+		Cursor:        c.String("cursor"),
+	}
+
+	for flag, target := range map[string]**int64{
+		"from-key": &req.FromDatapointKey,
+		"to-key":   &req.ToDatapointKey,
+		"min-size": &req.MinSizeBytes,
+		"max-size": &req.MaxSizeBytes,
+	} {
+		if c.IsSet(flag) {
+			value := c.Int64(flag)
+			*target = &value
+		}
+	}
+
+	if c.Bool("desc") {
+		req.SortOrder = client.SortOrderDesc
+	}
+
+	// List dataranges, either a single page or everything matching the filters
+	var dataranges []client.DatarangeInfo
+	var nextCursor string
+
+	if c.Int("limit") > 0 {
+		req.Limit = c.Int("limit")
+		page, err := clientInstance.ListDatarangesPage(context.Background(), req)
+		if err != nil {
+			return fmt.Errorf("failed to list dataranges: %w", err)
+		}
+		dataranges = page.Dataranges
+		nextCursor = page.NextCursor
+	} else {
+		var err error
+		dataranges, err = clientInstance.ListAllDataranges(context.Background(), req)
+		if err != nil {
+			return fmt.Errorf("failed to list dataranges: %w", err)
+		}
 	}
 
 	if len(dataranges) == 0 {
@@ -48,20 +130,24 @@ func listDatarangesAction(c *cli.Context) error {
 
 	// Create a tabwriter for formatted output
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	defer w.Flush()
 
 	// Print header
-	fmt.Fprintln(w, "ID\tRANGE\tSIZE\tOBJECT KEY")
-	fmt.Fprintln(w, "---\t-----\t----\t----------")
+	fmt.Fprintln(w, "ID\tRANGE\tSIZE\tCREATED\tSTORAGE CLASS\tOBJECT KEY")
+	fmt.Fprintln(w, "---\t-----\t----\t-------\t-------------\t----------")
 
 	// Print each datarange
 	for _, dr := range dataranges {
 		rangeStr := fmt.Sprintf("%d-%d", dr.MinDatapointKey, dr.MaxDatapointKey)
 		sizeStr := formatSize(dr.SizeBytes)
-		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", dr.DatarangeID, rangeStr, sizeStr, dr.DataObjectKey)
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", dr.DatarangeID, rangeStr, sizeStr, dr.CreatedAt.Format(time.RFC3339), dr.StorageClass, dr.DataObjectKey)
 	}
 
+	w.Flush()
+
 	fmt.Printf("\nTotal dataranges: %d\n", len(dataranges))
+	if nextCursor != "" {
+		fmt.Printf("More dataranges available, continue with --cursor %s\n", nextCursor)
+	}
 	return nil
 }
 
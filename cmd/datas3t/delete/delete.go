@@ -3,6 +3,7 @@ package datasetdelete
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -69,12 +70,12 @@ func deleteDatas3tAction(c *cli.Context) error {
 	_, err := clientInstance.DeleteDatas3t(context.Background(), req)
 	if err != nil {
 		// Provide helpful error messages
-		if strings.Contains(err.Error(), "cannot delete datas3t") && strings.Contains(err.Error(), "contains") {
+		if errors.Is(err, client.ErrDatas3tNotEmpty) {
 			fmt.Printf("Error: Cannot delete datas3t '%s' because it contains dataranges.\n", datas3tName)
 			fmt.Printf("Hint: Use 'datas3t clear --name %s' to remove all dataranges first, then try deleting again.\n", datas3tName)
 			return fmt.Errorf("datas3t is not empty")
 		}
-		if strings.Contains(err.Error(), "does not exist") || strings.Contains(err.Error(), "not found") {
+		if errors.Is(err, client.ErrDatas3tNotFound) {
 			return fmt.Errorf("datas3t '%s' does not exist", datas3tName)
 		}
 		return fmt.Errorf("failed to delete datas3t: %w", err)
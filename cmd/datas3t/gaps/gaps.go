@@ -0,0 +1,76 @@
+package gaps
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "gaps",
+		Usage: "Print the datapoint key ranges missing from a datas3t",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output as JSON",
+			},
+		},
+		ArgsUsage: "<datas3t-name>",
+		Action:    gapsAction,
+	}
+}
+
+func gapsAction(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return fmt.Errorf("expected 1 argument: <datas3t-name>")
+	}
+
+	datas3tName := c.Args().Get(0)
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	response, err := clientInstance.GetDatapointGaps(context.Background(), datas3tName)
+	if err != nil {
+		return fmt.Errorf("failed to get gaps: %w", err)
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(response)
+	}
+
+	if response.DatarangeCount == 0 {
+		fmt.Printf("Datas3t '%s' has no dataranges\n", datas3tName)
+		return nil
+	}
+
+	fmt.Printf("Datapoint range: %d - %d\n", response.LowestDatapoint, response.HighestDatapoint)
+
+	if len(response.Gaps) == 0 {
+		fmt.Println("No gaps found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIRST\tLAST\tMISSING")
+	fmt.Fprintln(w, "-----\t----\t-------")
+	for _, gap := range response.Gaps {
+		fmt.Fprintf(w, "%d\t%d\t%d\n", gap.FirstDatapointKey, gap.LastDatapointKey, gap.MissingDatapoints)
+	}
+	w.Flush()
+
+	fmt.Printf("\nTotal gaps: %d, missing datapoints: %d\n", len(response.Gaps), response.MissingDatapoints)
+	return nil
+}
@@ -13,7 +13,7 @@ import (
 func Command() *cli.Command {
 	return &cli.Command{
 		Name:  "list",
-		Usage: "List all datas3ts",
+		Usage: "List datas3ts",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "server-url",
@@ -21,6 +21,10 @@ func Command() *cli.Command {
 				Usage:   "Server URL",
 				EnvVars: []string{"DATAS3T_SERVER_URL"},
 			},
+			&cli.StringFlag{
+				Name:  "prefix",
+				Usage: "Only list datas3ts whose name starts with this prefix",
+			},
 			&cli.BoolFlag{
 				Name:  "json",
 				Usage: "Output as JSON",
@@ -31,9 +35,11 @@ func Command() *cli.Command {
 }
 
 func listDatas3tsAction(c *cli.Context) error {
-	client := client.NewClient(c.String("server-url"))
+	clientInstance := client.NewClient(c.String("server-url"))
 
-	datas3ts, err := client.ListDatas3ts(context.Background())
+	datas3ts, err := clientInstance.ListDatas3tsWithOptions(context.Background(), &client.ListDatas3tsRequest{
+		NamePrefix: c.String("prefix"),
+	})
 	if err != nil {
 		return fmt.Errorf("failed to list datas3ts: %w", err)
 	}
@@ -54,6 +60,9 @@ func listDatas3tsAction(c *cli.Context) error {
 			fmt.Printf("Datapoint Range: %d - %d\n", d.LowestDatapoint, d.HighestDatapoint)
 		}
 		fmt.Printf("Total Size: %d bytes\n", d.TotalBytes)
+		if d.Encrypted {
+			fmt.Printf("Encrypted: yes\n")
+		}
 		fmt.Println()
 	}
 
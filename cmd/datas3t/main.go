@@ -14,19 +14,27 @@ import (
 	datasetclear "github.com/draganm/datas3t/cmd/datas3t/clear"
 	"github.com/draganm/datas3t/cmd/datas3t/datarange"
 	datasetdelete "github.com/draganm/datas3t/cmd/datas3t/delete"
+	"github.com/draganm/datas3t/cmd/datas3t/gaps"
 	"github.com/draganm/datas3t/cmd/datas3t/importcmd"
 	datasetlist "github.com/draganm/datas3t/cmd/datas3t/list"
 	"github.com/draganm/datas3t/cmd/datas3t/optimize"
 	"github.com/draganm/datas3t/cmd/datas3t/optimizeall"
+	"github.com/draganm/datas3t/cmd/datas3t/replica"
+	"github.com/draganm/datas3t/cmd/datas3t/rotatekey"
 	"github.com/draganm/datas3t/cmd/datas3t/server"
+	"github.com/draganm/datas3t/cmd/datas3t/storageclassrules"
+	"github.com/draganm/datas3t/cmd/datas3t/uploaddir"
 	"github.com/draganm/datas3t/cmd/datas3t/uploadtar"
+	"github.com/draganm/datas3t/cmd/datas3t/versioncmd"
+	"github.com/draganm/datas3t/version"
 	"github.com/urfave/cli/v2"
 )
 
 func main() {
 	app := &cli.App{
-		Name:  "datas3t",
-		Usage: "datas3t server and utilities",
+		Name:    "datas3t",
+		Usage:   "datas3t server and utilities",
+		Version: version.Get(),
 		Commands: []*cli.Command{
 			server.Command(),
 			{
@@ -40,6 +48,7 @@ to encrypt S3 credentials stored in the database.
 Keep this key secure and backed up - if you lose it, you won't be able to decrypt your stored credentials!`,
 				Action: keygenAction,
 			},
+			rotatekey.Command(),
 			bucket.Command(),
 			datasetadd.Command(),
 			datasetclear.Command(),
@@ -48,10 +57,15 @@ Keep this key secure and backed up - if you lose it, you won't be able to decryp
 			catrange.Command(),
 			importcmd.Command(),
 			datarange.Command(),
+			gaps.Command(),
+			storageclassrules.Command(),
+			replica.Command(),
 			uploadtar.Command(),
+			uploaddir.Command(),
 			aggregate.Command(),
 			optimize.Command(),
 			optimizeall.Command(),
+			versioncmd.Command(),
 		},
 	}
 
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/cmd/datas3t/dataencryption"
 	"github.com/urfave/cli/v2"
 )
 
@@ -109,7 +110,7 @@ This command uses greedy optimization rules in priority order:
 2. Aggregate <10MB dataranges into 10-100MB range
 3. Aggregate 10-100MB dataranges into >100MB range  
 4. Aggregate 100MB-1GB dataranges into 1-5GB range`,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "server-url",
 				Value:   "http://localhost:8765",
@@ -125,13 +126,18 @@ This command uses greedy optimization rules in priority order:
 				Name:  "dry-run",
 				Usage: "Show optimization recommendations without executing them",
 			},
-		},
+		}, dataencryption.Flags()...),
 		Action: func(c *cli.Context) error {
 
 			ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 			defer cancel()
 
 			clientInstance := client.NewClient(c.String("server-url"))
+			err := dataencryption.Configure(c, clientInstance)
+			if err != nil {
+				return err
+			}
+
 			datas3tName := c.String("datas3t")
 			isDryRun := c.Bool("dry-run")
 
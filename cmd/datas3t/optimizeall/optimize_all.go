@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/cmd/datas3t/dataencryption"
 	"github.com/draganm/datas3t/cmd/datas3t/optimize"
 	"github.com/urfave/cli/v2"
 )
@@ -95,7 +96,7 @@ It will:
 - Continue cycling until interrupted
 - Log all operations in structured JSON format using slog
 - Provide periodic progress updates during aggregation operations`,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "server-url",
 				Value:   "http://localhost:8765",
@@ -118,7 +119,7 @@ It will:
 				Value: 5 * time.Minute,
 				Usage: "Duration to wait when no optimizations are possible",
 			},
-		},
+		}, dataencryption.Flags()...),
 		Action: func(c *cli.Context) error {
 			// Setup structured JSON logging
 			logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
@@ -130,6 +131,11 @@ It will:
 			defer cancel()
 
 			clientInstance := client.NewClient(c.String("server-url"))
+			err := dataencryption.Configure(c, clientInstance)
+			if err != nil {
+				return err
+			}
+
 			tempDir := c.String("temp-dir")
 			if tempDir == "" {
 				tempDir = os.TempDir()
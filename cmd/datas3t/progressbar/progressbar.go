@@ -0,0 +1,121 @@
+package progressbar
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/draganm/datas3t/client"
+)
+
+// ProgressBar renders the progress of an upload as a single terminal line
+type ProgressBar struct {
+	mu            sync.Mutex
+	width         int
+	lastPrintTime time.Time
+	lastOutput    string
+}
+
+// New creates a new progress bar with the specified width
+func New(width int) *ProgressBar {
+	if width < 20 {
+		width = 60 // default width
+	}
+	return &ProgressBar{
+		width: width,
+	}
+}
+
+// Update updates the progress bar display, it is meant to be used as client.ProgressCallback
+func (pb *ProgressBar) Update(info client.ProgressInfo) {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+
+	// Throttle updates to avoid screen flicker (max 10 updates per second)
+	now := time.Now()
+	if now.Sub(pb.lastPrintTime) < 100*time.Millisecond && info.PercentComplete < 100 {
+		return
+	}
+	pb.lastPrintTime = now
+
+	// Create progress bar visualization
+	progressWidth := pb.width - 20 // Leave space for percentage and other info
+	filled := int(info.PercentComplete * float64(progressWidth) / 100.0)
+	if filled > progressWidth {
+		filled = progressWidth
+	}
+
+	bar := strings.Repeat("█", filled) + strings.Repeat("▒", progressWidth-filled)
+
+	// Format data sizes
+	totalMB := float64(info.TotalBytes) / (1024 * 1024)
+	completedMB := float64(info.CompletedBytes) / (1024 * 1024)
+
+	// Format speed
+	var speedStr string
+	if info.Speed > 0 {
+		speedMB := info.Speed / (1024 * 1024)
+		speedStr = fmt.Sprintf("%.1f MB/s", speedMB)
+	} else {
+		speedStr = "--.- MB/s"
+	}
+
+	// Format ETA
+	var etaStr string
+	if info.EstimatedETA > 0 {
+		if info.EstimatedETA < time.Minute {
+			etaStr = fmt.Sprintf("%ds", int(info.EstimatedETA.Seconds()))
+		} else if info.EstimatedETA < time.Hour {
+			etaStr = fmt.Sprintf("%dm%ds", int(info.EstimatedETA.Minutes()), int(info.EstimatedETA.Seconds())%60)
+		} else {
+			etaStr = fmt.Sprintf("%dh%dm", int(info.EstimatedETA.Hours()), int(info.EstimatedETA.Minutes())%60)
+		}
+	} else {
+		etaStr = "--:--"
+	}
+
+	// Format phase-specific message
+	var phaseMsg string
+	switch info.Phase {
+	case client.PhaseAnalyzing:
+		phaseMsg = "Analyzing TAR file..."
+	case client.PhaseIndexing:
+		phaseMsg = "Generating index..."
+	case client.PhaseStarting:
+		phaseMsg = info.CurrentStep + "..."
+	case client.PhaseUploading:
+		phaseMsg = info.CurrentStep
+	case client.PhaseUploadingIndex:
+		phaseMsg = "Uploading index..."
+	case client.PhaseCompleting:
+		phaseMsg = "Completing upload..."
+	}
+
+	// Build the output line
+	var output string
+	if info.Phase == client.PhaseUploading && info.TotalBytes == 0 {
+		// The size of a stream is not known until it has been read
+		output = fmt.Sprintf("\r%.1f MB uploaded %s - %s", completedMB, speedStr, phaseMsg)
+	} else if info.Phase == client.PhaseUploading || info.PercentComplete > 0 {
+		output = fmt.Sprintf("\r[%s] %5.1f%% (%.1f/%.1f MB) %s ETA: %s - %s",
+			bar, info.PercentComplete, completedMB, totalMB, speedStr, etaStr, phaseMsg)
+	} else {
+		output = fmt.Sprintf("\r%s", phaseMsg)
+	}
+
+	// Clear previous line if new output is shorter
+	if len(output) < len(pb.lastOutput) {
+		fmt.Print("\r" + strings.Repeat(" ", len(pb.lastOutput)) + "\r")
+	}
+
+	fmt.Print(output)
+	pb.lastOutput = output
+}
+
+// Finish completes the progress bar
+func (pb *ProgressBar) Finish() {
+	pb.mu.Lock()
+	defer pb.mu.Unlock()
+	fmt.Println() // Move to next line
+}
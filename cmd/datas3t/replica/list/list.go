@@ -0,0 +1,70 @@
+package list
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "List the replicas of datas3ts with their replication progress",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output as JSON",
+			},
+		},
+		Action: listAction,
+	}
+}
+
+func listAction(c *cli.Context) error {
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	replicas, err := clientInstance.ListReplicas(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to list replicas: %w", err)
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(replicas)
+	}
+
+	if len(replicas) == 0 {
+		fmt.Println("No datas3ts are replicated")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATAS3T\tBUCKET\tREPLICATED\tFAILED\tCREATED")
+	fmt.Fprintln(w, "-------\t------\t----------\t------\t-------")
+	for _, replica := range replicas {
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d\t%s\n",
+			replica.Datas3tName,
+			replica.Bucket,
+			replica.ReplicatedDataranges,
+			replica.TotalDataranges,
+			replica.FailedDataranges,
+			replica.CreatedAt.Format(time.RFC3339),
+		)
+	}
+	w.Flush()
+
+	return nil
+}
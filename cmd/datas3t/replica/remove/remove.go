@@ -0,0 +1,44 @@
+package remove
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "remove",
+		Usage: "Stop replicating a datas3t and delete the copies of its dataranges",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "datas3t",
+				Usage:    "Datas3t name",
+				Required: true,
+			},
+		},
+		Action: removeAction,
+	}
+}
+
+func removeAction(c *cli.Context) error {
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	err := clientInstance.RemoveReplica(context.Background(), &client.RemoveReplicaRequest{
+		Datas3tName: c.String("datas3t"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove replica: %w", err)
+	}
+
+	fmt.Printf("Removed replica of datas3t '%s'\n", c.String("datas3t"))
+	return nil
+}
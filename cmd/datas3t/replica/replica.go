@@ -0,0 +1,22 @@
+package replica
+
+import (
+	replicalist "github.com/draganm/datas3t/cmd/datas3t/replica/list"
+	replicaremove "github.com/draganm/datas3t/cmd/datas3t/replica/remove"
+	replicaset "github.com/draganm/datas3t/cmd/datas3t/replica/set"
+	replicastatus "github.com/draganm/datas3t/cmd/datas3t/replica/status"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "replica",
+		Usage: "Manage the replicas datas3ts are mirrored into for disaster recovery",
+		Subcommands: []*cli.Command{
+			replicaset.Command(),
+			replicaremove.Command(),
+			replicalist.Command(),
+			replicastatus.Command(),
+		},
+	}
+}
@@ -0,0 +1,53 @@
+package set
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "set",
+		Usage: "Mirror a datas3t into a second bucket",
+		Description: `The server copies the dataranges of the datas3t to the bucket, which may be at
+another provider. Downloads fail over to the replica when the bucket of the datas3t
+fails. Setting a different bucket starts the replication over.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "datas3t",
+				Usage:    "Datas3t name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "bucket",
+				Usage:    "Name of the bucket configuration the datas3t is copied to",
+				Required: true,
+			},
+		},
+		Action: setAction,
+	}
+}
+
+func setAction(c *cli.Context) error {
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	err := clientInstance.SetReplica(context.Background(), &client.SetReplicaRequest{
+		Datas3tName: c.String("datas3t"),
+		Bucket:      c.String("bucket"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set replica: %w", err)
+	}
+
+	fmt.Printf("Datas3t '%s' is replicated to bucket '%s'\n", c.String("datas3t"), c.String("bucket"))
+	return nil
+}
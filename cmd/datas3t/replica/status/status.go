@@ -0,0 +1,76 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "status",
+		Usage: "Show the replication status of the dataranges of a datas3t",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "datas3t",
+				Usage:    "Datas3t name",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output as JSON",
+			},
+		},
+		Action: statusAction,
+	}
+}
+
+func statusAction(c *cli.Context) error {
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	response, err := clientInstance.GetReplicationStatus(context.Background(), c.String("datas3t"))
+	if err != nil {
+		return fmt.Errorf("failed to get replication status: %w", err)
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(response)
+	}
+
+	fmt.Printf("Datas3t '%s' is replicated to bucket '%s'\n\n", response.Datas3tName, response.Bucket)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATAPOINTS\tSTATUS\tATTEMPTS\tREPLICATED AT\tLAST ERROR")
+	fmt.Fprintln(w, "----------\t------\t--------\t-------------\t----------")
+	for _, datarange := range response.Dataranges {
+		replicatedAt := "-"
+		if datarange.ReplicatedAt != nil {
+			replicatedAt = datarange.ReplicatedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d-%d\t%s\t%d\t%s\t%s\n",
+			datarange.MinDatapointKey,
+			datarange.MaxDatapointKey,
+			datarange.Status,
+			datarange.Attempts,
+			replicatedAt,
+			datarange.LastError,
+		)
+	}
+	w.Flush()
+
+	return nil
+}
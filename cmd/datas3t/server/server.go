@@ -10,10 +10,15 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
+	awsutil "github.com/draganm/datas3t/aws"
 	"github.com/draganm/datas3t/httpapi"
 	"github.com/draganm/datas3t/postgresstore"
 	"github.com/draganm/datas3t/server"
+	"github.com/draganm/datas3t/server/dataranges"
+	"github.com/draganm/datas3t/server/replication"
+	"github.com/draganm/datas3t/server/tiering"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
 	"github.com/golang-migrate/migrate/v4/source/iofs"
@@ -58,6 +63,67 @@ func Command() *cli.Command {
 				Required: true,
 				EnvVars:  []string{"ENCRYPTION_KEY"},
 			},
+			&cli.StringSliceFlag{
+				Name:    "decryption-keys",
+				Usage:   "Base64-encoded keys S3 credentials were encrypted with before a key rotation, comma-separated",
+				EnvVars: []string{"DECRYPTION_KEYS"},
+			},
+			&cli.StringFlag{
+				Name:    "credential-files-dir",
+				Usage:   "Directory bucket credentials referring to files (file://) are read from, such references are refused unless set",
+				EnvVars: []string{"CREDENTIAL_FILES_DIR"},
+			},
+			&cli.StringFlag{
+				Name:    "credential-env-prefix",
+				Usage:   "Prefix of the environment variables bucket credentials referring to environment variables (env:) are read from, such references are refused unless set",
+				EnvVars: []string{"CREDENTIAL_ENV_PREFIX"},
+			},
+			&cli.DurationFlag{
+				Name:    "presign-expiry",
+				Value:   awsutil.DefaultPresignExpiry,
+				Usage:   "How long presigned upload and download URLs stay valid unless a request asks otherwise (at most 168h)",
+				EnvVars: []string{"PRESIGN_EXPIRY"},
+			},
+			&cli.Int64Flag{
+				Name:    "max-proxy-upload-size",
+				Value:   dataranges.DefaultMaxProxyUploadSize,
+				Usage:   "Largest TAR archive in bytes accepted by the proxied upload endpoint",
+				EnvVars: []string{"MAX_PROXY_UPLOAD_SIZE"},
+			},
+			&cli.StringFlag{
+				Name:    "public-url",
+				Usage:   "URL clients reach the server at, presigned URLs of local buckets point to it (defaults to http:// and the address to bind to)",
+				EnvVars: []string{"PUBLIC_URL"},
+			},
+			&cli.StringFlag{
+				Name:    "local-storage-signing-key",
+				Usage:   "Base64-encoded key presigned URLs of local buckets are signed with (default: derived from the encryption key, so rotating it invalidates them)",
+				EnvVars: []string{"LOCAL_STORAGE_SIGNING_KEY"},
+			},
+			&cli.IntFlag{
+				Name:    "max-proxy-uploads",
+				Value:   dataranges.DefaultMaxProxyUploads,
+				Usage:   "Number of proxied uploads running at the same time, further uploads wait",
+				EnvVars: []string{"MAX_PROXY_UPLOADS"},
+			},
+			&cli.DurationFlag{
+				Name:    "tiering-interval",
+				Value:   tiering.DefaultInterval,
+				Usage:   "How often dataranges are moved to colder storage classes according to the storage class rules of their datas3ts",
+				EnvVars: []string{"TIERING_INTERVAL"},
+			},
+			&cli.IntFlag{
+				Name:    "restore-days",
+				Value:   tiering.DefaultRestoreDays,
+				Usage:   "Number of days the copies of archived dataranges restored for downloads and aggregations are kept",
+				EnvVars: []string{"RESTORE_DAYS"},
+			},
+			&cli.DurationFlag{
+				Name:    "replication-interval",
+				Value:   replication.DefaultInterval,
+				Usage:   "How often new dataranges are copied to the replicas of their datas3ts",
+				EnvVars: []string{"REPLICATION_INTERVAL"},
+			},
 		},
 		Action: serverAction,
 	}
@@ -71,6 +137,47 @@ func serverAction(c *cli.Context) error {
 	cacheDir := c.String("cache-dir")
 	maxCacheSize := c.Int64("max-cache-size")
 	encryptionKey := c.String("encryption-key")
+	decryptionKeys := c.StringSlice("decryption-keys")
+	credentialSources := awsutil.CredentialSources{
+		FilesDir:  c.String("credential-files-dir"),
+		EnvPrefix: c.String("credential-env-prefix"),
+	}
+	presignExpiry := c.Duration("presign-expiry")
+	maxProxyUploadSize := c.Int64("max-proxy-upload-size")
+	maxProxyUploads := c.Int("max-proxy-uploads")
+	publicURL := c.String("public-url")
+	localStorageSigningKey := c.String("local-storage-signing-key")
+	tieringInterval := c.Duration("tiering-interval")
+	restoreDays := c.Int("restore-days")
+	replicationInterval := c.Duration("replication-interval")
+
+	if presignExpiry < time.Second || presignExpiry > awsutil.MaxPresignExpiry {
+		return fmt.Errorf("presign-expiry must be between 1s and %s", awsutil.MaxPresignExpiry)
+	}
+
+	if maxProxyUploadSize < 1 {
+		return fmt.Errorf("max-proxy-upload-size must be positive")
+	}
+
+	if maxProxyUploads < 1 {
+		return fmt.Errorf("max-proxy-uploads must be at least 1")
+	}
+
+	if tieringInterval < time.Minute {
+		return fmt.Errorf("tiering-interval must be at least 1m")
+	}
+
+	if restoreDays < 1 || restoreDays > 30000 {
+		return fmt.Errorf("restore-days must be between 1 and 30000")
+	}
+
+	if replicationInterval < time.Second {
+		return fmt.Errorf("replication-interval must be at least 1s")
+	}
+
+	if publicURL == "" {
+		publicURL = defaultPublicURL(addr)
+	}
 
 	ctx, cancel := signal.NotifyContext(c.Context, os.Interrupt, os.Kill)
 	defer cancel()
@@ -119,9 +226,37 @@ func serverAction(c *cli.Context) error {
 		return fmt.Errorf("failed to create server: %w", err)
 	}
 
+	err = s.AddDecryptionKeys(decryptionKeys...)
+	if err != nil {
+		return err
+	}
+
+	s.SetPresignExpiry(presignExpiry)
+	s.SetMaxProxyUploadSize(maxProxyUploadSize)
+	s.SetMaxProxyUploads(maxProxyUploads)
+	s.SetPublicURL(publicURL)
+
+	if localStorageSigningKey != "" {
+		err = s.SetLocalStorageSigningKey(localStorageSigningKey)
+		if err != nil {
+			return fmt.Errorf("invalid local-storage-signing-key: %w", err)
+		}
+	}
+
+	s.SetCredentialSources(credentialSources)
+	s.SetTieringInterval(tieringInterval)
+	s.SetRestoreDays(int32(restoreDays))
+	s.SetReplicationInterval(replicationInterval)
+
 	// Start the key deletion worker
 	s.StartKeyDeletionWorker(ctx, logger)
 
+	// Start moving dataranges to colder storage classes
+	s.StartTieringWorker(ctx, logger)
+
+	// Start copying dataranges to the replicas of their datas3ts
+	s.StartReplicationWorker(ctx, logger)
+
 	mux := httpapi.NewHTTPAPI(s, logger)
 
 	srv := &http.Server{
@@ -134,3 +269,13 @@ func serverAction(c *cli.Context) error {
 
 	return srv.Serve(l)
 }
+
+// defaultPublicURL returns the URL of the server when it is reached at the address it
+// binds to, using localhost when the address has no host
+func defaultPublicURL(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "http://localhost" + addr
+	}
+
+	return "http://" + addr
+}
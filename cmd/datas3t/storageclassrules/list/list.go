@@ -0,0 +1,75 @@
+package list
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "list",
+		Usage: "List the storage class rules of a datas3t",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "datas3t",
+				Usage:    "Datas3t name",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output as JSON",
+			},
+		},
+		Action: listAction,
+	}
+}
+
+func listAction(c *cli.Context) error {
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	response, err := clientInstance.GetStorageClassRules(context.Background(), c.String("datas3t"))
+	if err != nil {
+		return fmt.Errorf("failed to get storage class rules: %w", err)
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(response)
+	}
+
+	if len(response.Rules) == 0 {
+		fmt.Printf("Datas3t '%s' has no storage class rules\n", response.Datas3tName)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STORAGE CLASS\tMIN AGE DAYS\tMIN KEYS BEHIND")
+	fmt.Fprintln(w, "-------------\t------------\t---------------")
+	for _, rule := range response.Rules {
+		minAgeDays := "-"
+		if rule.MinAgeDays != nil {
+			minAgeDays = fmt.Sprint(*rule.MinAgeDays)
+		}
+		minKeysBehind := "-"
+		if rule.MinKeysBehind != nil {
+			minKeysBehind = fmt.Sprint(*rule.MinKeysBehind)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", rule.StorageClass, minAgeDays, minKeysBehind)
+	}
+	w.Flush()
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package set
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "set",
+		Usage: "Replace the storage class rules of a datas3t",
+		Description: `Each --rule moves the dataranges matching all of its conditions to a storage class:
+
+  --rule GLACIER:min-age-days=90
+  --rule DEEP_ARCHIVE:min-age-days=365,min-keys-behind=1000000
+
+Dataranges in GLACIER or DEEP_ARCHIVE are restored when they are downloaded, which
+can take hours. Removing rules does not move dataranges back.`,
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "datas3t",
+				Usage:    "Datas3t name",
+				Required: true,
+			},
+			&cli.StringSliceFlag{
+				Name:  "rule",
+				Usage: "Rule as STORAGE_CLASS:condition=value[,condition=value], conditions are min-age-days and min-keys-behind",
+			},
+			&cli.BoolFlag{
+				Name:  "clear",
+				Usage: "Remove all storage class rules",
+			},
+		},
+		Action: setAction,
+	}
+}
+
+func setAction(c *cli.Context) error {
+	rules := []client.StorageClassRule{}
+	for _, rule := range c.StringSlice("rule") {
+		parsed, err := parseRule(rule)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, parsed)
+	}
+
+	if len(rules) == 0 && !c.Bool("clear") {
+		return fmt.Errorf("either --rule or --clear is required")
+	}
+
+	if len(rules) > 0 && c.Bool("clear") {
+		return fmt.Errorf("--rule and --clear cannot be used together")
+	}
+
+	clientInstance := client.NewClient(c.String("server-url"))
+
+	err := clientInstance.SetStorageClassRules(context.Background(), &client.SetStorageClassRulesRequest{
+		Datas3tName: c.String("datas3t"),
+		Rules:       rules,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set storage class rules: %w", err)
+	}
+
+	fmt.Printf("Set %d storage class rules of datas3t '%s'\n", len(rules), c.String("datas3t"))
+	return nil
+}
+
+// parseRule parses a rule like GLACIER:min-age-days=90,min-keys-behind=1000
+func parseRule(rule string) (client.StorageClassRule, error) {
+	storageClass, conditions, found := strings.Cut(rule, ":")
+	if !found || storageClass == "" || conditions == "" {
+		return client.StorageClassRule{}, fmt.Errorf("invalid rule %q, expected STORAGE_CLASS:condition=value", rule)
+	}
+
+	parsed := client.StorageClassRule{StorageClass: strings.ToUpper(storageClass)}
+	for _, condition := range strings.Split(conditions, ",") {
+		name, value, found := strings.Cut(condition, "=")
+		if !found {
+			return client.StorageClassRule{}, fmt.Errorf("invalid condition %q of rule %q, expected condition=value", condition, rule)
+		}
+
+		switch name {
+		case "min-age-days":
+			days, err := strconv.ParseInt(value, 10, 32)
+			if err != nil {
+				return client.StorageClassRule{}, fmt.Errorf("invalid min-age-days of rule %q: %w", rule, err)
+			}
+			minAgeDays := int32(days)
+			parsed.MinAgeDays = &minAgeDays
+		case "min-keys-behind":
+			keys, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return client.StorageClassRule{}, fmt.Errorf("invalid min-keys-behind of rule %q: %w", rule, err)
+			}
+			parsed.MinKeysBehind = &keys
+		default:
+			return client.StorageClassRule{}, fmt.Errorf("unknown condition %q of rule %q, expected min-age-days or min-keys-behind", name, rule)
+		}
+	}
+
+	return parsed, nil
+}
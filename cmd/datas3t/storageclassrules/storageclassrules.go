@@ -0,0 +1,18 @@
+package storageclassrules
+
+import (
+	storageclassruleslist "github.com/draganm/datas3t/cmd/datas3t/storageclassrules/list"
+	storageclassrulesset "github.com/draganm/datas3t/cmd/datas3t/storageclassrules/set"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "storage-class-rules",
+		Usage: "Manage the rules moving dataranges of a datas3t to colder storage classes",
+		Subcommands: []*cli.Command{
+			storageclassrulesset.Command(),
+			storageclassruleslist.Command(),
+		},
+	}
+}
@@ -0,0 +1,150 @@
+package uploaddir
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/cmd/datas3t/dataencryption"
+	"github.com/draganm/datas3t/cmd/datas3t/progressbar"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "upload-dir",
+		Usage: "Upload the files of a directory as dataranges without building a TAR file first",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.StringFlag{
+				Name:     "datas3t",
+				Usage:    "Datas3t name",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "dir",
+				Usage:    "Directory to upload, including its subdirectories",
+				Required: true,
+			},
+			&cli.BoolFlag{
+				Name:  "assign-keys",
+				Usage: "Number the files in sorted path order instead of taking the keys from %020d.<extension> file names",
+			},
+			&cli.Uint64Flag{
+				Name:  "first-datapoint",
+				Usage: "Key of the first file when assigning keys",
+			},
+			&cli.BoolFlag{
+				Name:  "append",
+				Usage: "Let the server allocate the next datapoint keys, the files are numbered in sorted path order",
+			},
+			&cli.Int64Flag{
+				Name:  "max-datarange-size",
+				Usage: "Split the files into dataranges of at most this many bytes",
+				Value: 256 * 1024 * 1024, // 256MB
+			},
+			&cli.StringFlag{
+				Name:  "mapping-report",
+				Usage: "Write the datapoint key and name of every uploaded file to this JSON file",
+			},
+			&cli.IntFlag{
+				Name:  "max-parallelism",
+				Usage: "Maximum number of concurrent uploads",
+				Value: 6,
+			},
+			&cli.IntFlag{
+				Name:  "max-retries",
+				Usage: "Maximum number of retry attempts per chunk",
+				Value: 3,
+			},
+			&cli.DurationFlag{
+				Name:  "lease",
+				Usage: "Take an exclusive lease on the datapoint range of each datarange for this long, renewed until its upload finishes (e.g. 10m)",
+			},
+			&cli.DurationFlag{
+				Name:  "presign-expiry",
+				Usage: "How long the presigned upload URLs stay valid, expired URLs are refreshed (default: server setting)",
+			},
+		}, dataencryption.Flags()...),
+		Action: uploadDirAction,
+	}
+}
+
+func uploadDirAction(c *cli.Context) error {
+	clientInstance := client.NewClient(c.String("server-url"))
+	err := dataencryption.Configure(c, clientInstance)
+	if err != nil {
+		return err
+	}
+
+	dir := c.String("dir")
+	datas3tName := c.String("datas3t")
+
+	if c.IsSet("first-datapoint") && !c.Bool("assign-keys") {
+		return fmt.Errorf("--first-datapoint requires --assign-keys")
+	}
+
+	fmt.Printf("Uploading the files of '%s' to datas3t '%s'...\n", dir, datas3tName)
+
+	progressBar := progressbar.New(80)
+
+	opts := &client.UploadDirOptions{
+		AssignKeys:       c.Bool("assign-keys"),
+		FirstDatapoint:   c.Uint64("first-datapoint"),
+		Append:           c.Bool("append"),
+		MaxDatarangeSize: c.Int64("max-datarange-size"),
+		UploadOptions: &client.UploadOptions{
+			MaxParallelism:   c.Int("max-parallelism"),
+			MaxRetries:       c.Int("max-retries"),
+			ProgressCallback: progressBar.Update,
+			LeaseDuration:    c.Duration("lease"),
+			PresignExpiry:    c.Duration("presign-expiry"),
+		},
+		OnDatarangeUploaded: func(firstDatapoint, lastDatapoint uint64) {
+			progressBar.Finish()
+			fmt.Printf("Uploaded datapoints %d-%d\n", firstDatapoint, lastDatapoint)
+		},
+	}
+
+	uploaded, err := clientInstance.UploadDir(context.Background(), datas3tName, dir, opts)
+
+	// Report the files that were uploaded, also when a later datarange failed
+	var reportErr error
+	if c.String("mapping-report") != "" && len(uploaded) > 0 {
+		reportErr = writeMappingReport(c.String("mapping-report"), uploaded)
+	}
+
+	if err != nil {
+		progressBar.Finish()
+		return errors.Join(fmt.Errorf("failed to upload directory: %w", err), reportErr)
+	}
+
+	if reportErr != nil {
+		return reportErr
+	}
+
+	fmt.Printf("Successfully uploaded %d files to datas3t '%s'\n", len(uploaded), datas3tName)
+	return nil
+}
+
+func writeMappingReport(path string, uploaded []client.UploadedFile) error {
+	data, err := json.MarshalIndent(uploaded, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal mapping report: %w", err)
+	}
+
+	err = os.WriteFile(path, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write mapping report: %w", err)
+	}
+
+	return nil
+}
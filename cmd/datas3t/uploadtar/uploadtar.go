@@ -2,129 +2,23 @@ package uploadtar
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"strings"
-	"sync"
-	"time"
 
 	"github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/cmd/datas3t/dataencryption"
+	"github.com/draganm/datas3t/cmd/datas3t/progressbar"
 	"github.com/urfave/cli/v2"
 )
 
-// progressBar implements a simple terminal progress bar
-type progressBar struct {
-	mu            sync.Mutex
-	width         int
-	lastPrintTime time.Time
-	lastOutput    string
-}
-
-// newProgressBar creates a new progress bar with the specified width
-func newProgressBar(width int) *progressBar {
-	if width < 20 {
-		width = 60 // default width
-	}
-	return &progressBar{
-		width: width,
-	}
-}
-
-// update updates the progress bar display
-func (pb *progressBar) update(info client.ProgressInfo) {
-	pb.mu.Lock()
-	defer pb.mu.Unlock()
-
-	// Throttle updates to avoid screen flicker (max 10 updates per second)
-	now := time.Now()
-	if now.Sub(pb.lastPrintTime) < 100*time.Millisecond && info.PercentComplete < 100 {
-		return
-	}
-	pb.lastPrintTime = now
-
-	// Create progress bar visualization
-	progressWidth := pb.width - 20 // Leave space for percentage and other info
-	filled := int(info.PercentComplete * float64(progressWidth) / 100.0)
-	if filled > progressWidth {
-		filled = progressWidth
-	}
-
-	bar := strings.Repeat("█", filled) + strings.Repeat("▒", progressWidth-filled)
-
-	// Format data sizes
-	totalMB := float64(info.TotalBytes) / (1024 * 1024)
-	completedMB := float64(info.CompletedBytes) / (1024 * 1024)
-
-	// Format speed
-	var speedStr string
-	if info.Speed > 0 {
-		speedMB := info.Speed / (1024 * 1024)
-		speedStr = fmt.Sprintf("%.1f MB/s", speedMB)
-	} else {
-		speedStr = "--.- MB/s"
-	}
-
-	// Format ETA
-	var etaStr string
-	if info.EstimatedETA > 0 {
-		if info.EstimatedETA < time.Minute {
-			etaStr = fmt.Sprintf("%ds", int(info.EstimatedETA.Seconds()))
-		} else if info.EstimatedETA < time.Hour {
-			etaStr = fmt.Sprintf("%dm%ds", int(info.EstimatedETA.Minutes()), int(info.EstimatedETA.Seconds())%60)
-		} else {
-			etaStr = fmt.Sprintf("%dh%dm", int(info.EstimatedETA.Hours()), int(info.EstimatedETA.Minutes())%60)
-		}
-	} else {
-		etaStr = "--:--"
-	}
-
-	// Format phase-specific message
-	var phaseMsg string
-	switch info.Phase {
-	case client.PhaseAnalyzing:
-		phaseMsg = "Analyzing TAR file..."
-	case client.PhaseIndexing:
-		phaseMsg = "Generating index..."
-	case client.PhaseStarting:
-		phaseMsg = "Starting upload session..."
-	case client.PhaseUploading:
-		phaseMsg = info.CurrentStep
-	case client.PhaseUploadingIndex:
-		phaseMsg = "Uploading index..."
-	case client.PhaseCompleting:
-		phaseMsg = "Completing upload..."
-	}
-
-	// Build the output line
-	var output string
-	if info.Phase == client.PhaseUploading || info.PercentComplete > 0 {
-		output = fmt.Sprintf("\r[%s] %5.1f%% (%.1f/%.1f MB) %s ETA: %s - %s",
-			bar, info.PercentComplete, completedMB, totalMB, speedStr, etaStr, phaseMsg)
-	} else {
-		output = fmt.Sprintf("\r%s", phaseMsg)
-	}
-
-	// Clear previous line if new output is shorter
-	if len(output) < len(pb.lastOutput) {
-		fmt.Print("\r" + strings.Repeat(" ", len(pb.lastOutput)) + "\r")
-	}
-
-	fmt.Print(output)
-	pb.lastOutput = output
-}
-
-// finish completes the progress bar
-func (pb *progressBar) finish() {
-	pb.mu.Lock()
-	defer pb.mu.Unlock()
-	fmt.Println() // Move to next line
-}
-
 func Command() *cli.Command {
 	return &cli.Command{
-		Name:  "upload-tar",
-		Usage: "Upload a TAR file as a datarange",
-		Flags: []cli.Flag{
+		Name:      "upload-tar",
+		Usage:     "Upload a TAR file as a datarange",
+		ArgsUsage: "[- to read the TAR archive from stdin]",
+		Flags: append([]cli.Flag{
 			&cli.StringFlag{
 				Name:    "server-url",
 				Value:   "http://localhost:8765",
@@ -137,9 +31,8 @@ func Command() *cli.Command {
 				Required: true,
 			},
 			&cli.StringFlag{
-				Name:     "file",
-				Usage:    "Path to TAR file to upload",
-				Required: true,
+				Name:  "file",
+				Usage: "Path to TAR file to upload, - reads the TAR archive from stdin",
 			},
 			&cli.IntFlag{
 				Name:  "max-parallelism",
@@ -151,17 +44,97 @@ func Command() *cli.Command {
 				Usage: "Maximum number of retry attempts per chunk",
 				Value: 3,
 			},
-		},
+			&cli.BoolFlag{
+				Name:  "append",
+				Usage: "Let the server allocate the next datapoint keys and rename the TAR entries to them while uploading",
+			},
+			&cli.DurationFlag{
+				Name:  "lease",
+				Usage: "Take an exclusive lease on the datapoint range for this long, renewed until the upload finishes (e.g. 10m)",
+			},
+			&cli.BoolFlag{
+				Name:  "resume",
+				Usage: "Continue the interrupted upload recorded in the state file",
+			},
+			&cli.StringFlag{
+				Name:  "state-file",
+				Usage: "File recording the upload progress until the upload completes (default: <file>.upload-state.json)",
+			},
+			&cli.DurationFlag{
+				Name:  "presign-expiry",
+				Usage: "How long the presigned upload URLs stay valid, expired URLs are refreshed (default: server setting)",
+			},
+			&cli.IntFlag{
+				Name:  "stream-part-size",
+				Usage: "Size of the parts a TAR archive read from stdin is uploaded in, at least 5MB",
+				Value: client.DefaultStreamPartSize,
+			},
+			&cli.BoolFlag{
+				Name:  "proxy",
+				Usage: "Send the TAR archive to the server, which uploads it to S3, when S3 cannot be reached from this host",
+			},
+			&cli.BoolFlag{
+				Name:  "assign-keys",
+				Usage: "Number the files in archive order instead of requiring %020d.<extension> names, the original names are kept in the TAR headers",
+			},
+			&cli.Uint64Flag{
+				Name:  "first-datapoint",
+				Usage: "Key of the first file with --assign-keys",
+			},
+			&cli.BoolFlag{
+				Name:  "replace",
+				Usage: "Atomically replace the existing dataranges of the datapoint range, which must lie within it and cover all of it",
+			},
+			&cli.StringFlag{
+				Name:  "key-mapping",
+				Usage: "JSON file mapping the name of every file in the archive to its datapoint key, the original names are kept in the TAR headers",
+			},
+		}, dataencryption.Flags()...),
 		Action: uploadTarAction,
 	}
 }
 
 func uploadTarAction(c *cli.Context) error {
 	clientInstance := client.NewClient(c.String("server-url"))
+	err := dataencryption.Configure(c, clientInstance)
+	if err != nil {
+		return err
+	}
 
 	filePath := c.String("file")
+	if filePath == "" {
+		filePath = c.Args().First()
+	}
 	datas3tName := c.String("datas3t")
 
+	switch {
+	case filePath == "":
+		return fmt.Errorf("either --file or - to read from stdin is required")
+	case filePath == "-":
+		return uploadStdin(c, clientInstance, datas3tName)
+	}
+
+	if c.Bool("proxy") {
+		for _, flag := range []string{"append", "lease", "resume", "state-file", "replace"} {
+			if c.IsSet(flag) {
+				return fmt.Errorf("--%s cannot be used with --proxy", flag)
+			}
+		}
+	}
+
+	if c.Bool("replace") && c.Bool("append") {
+		return fmt.Errorf("--replace cannot be used with --append")
+	}
+
+	if c.IsSet("first-datapoint") && !c.Bool("assign-keys") {
+		return fmt.Errorf("--first-datapoint requires --assign-keys")
+	}
+
+	keyMapping, err := readKeyMapping(c.String("key-mapping"))
+	if err != nil {
+		return err
+	}
+
 	// Open the file
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -175,24 +148,107 @@ func uploadTarAction(c *cli.Context) error {
 		return fmt.Errorf("failed to get file info: %w", err)
 	}
 
+	// Proxied uploads run in a single request and cannot be resumed
+	var stateFile string
+	if !c.Bool("proxy") {
+		stateFile = c.String("state-file")
+		if stateFile == "" {
+			stateFile = filePath + ".upload-state.json"
+		}
+
+		_, err = os.Stat(stateFile)
+		switch {
+		case err == nil && !c.Bool("resume"):
+			return fmt.Errorf("a previous upload of '%s' was interrupted, continue it with --resume or remove '%s'", filePath, stateFile)
+		case err != nil && !errors.Is(err, os.ErrNotExist):
+			return fmt.Errorf("failed to check upload state: %w", err)
+		}
+	}
+
 	fmt.Printf("Uploading '%s' to datas3t '%s' (size: %.1f MB)...\n",
 		filePath, datas3tName, float64(fileInfo.Size())/(1024*1024))
 
 	// Create progress bar
-	progressBar := newProgressBar(80)
+	progressBar := progressbar.New(80)
 
 	// Set up upload options with progress callback
 	opts := &client.UploadOptions{
-		MaxParallelism:   c.Int("max-parallelism"),
-		MaxRetries:       c.Int("max-retries"),
-		ProgressCallback: progressBar.update,
+		MaxParallelism:     c.Int("max-parallelism"),
+		MaxRetries:         c.Int("max-retries"),
+		ProgressCallback:   progressBar.Update,
+		LeaseDuration:      c.Duration("lease"),
+		StateFile:          stateFile,
+		PresignExpiry:      c.Duration("presign-expiry"),
+		ProxyThroughServer: c.Bool("proxy"),
+		AssignKeys:         c.Bool("assign-keys"),
+		FirstDatapoint:     c.Uint64("first-datapoint"),
+		KeyMapping:         keyMapping,
+		Replace:            c.Bool("replace"),
+	}
+
+	if c.Bool("append") {
+		firstDatapoint, err := clientInstance.AppendDataRangeFile(context.Background(), datas3tName, file, fileInfo.Size(), opts)
+
+		progressBar.Finish()
+
+		if err != nil {
+			return fmt.Errorf("failed to append datarange: %w", err)
+		}
+
+		fmt.Printf("Successfully appended datarange to datas3t '%s' starting at datapoint %d\n", datas3tName, firstDatapoint)
+		return nil
 	}
 
 	// Start upload with progress tracking
 	err = clientInstance.UploadDataRangeFile(context.Background(), datas3tName, file, fileInfo.Size(), opts)
 
 	// Finish progress bar
-	progressBar.finish()
+	progressBar.Finish()
+
+	if err != nil {
+		return fmt.Errorf("failed to upload datarange: %w", err)
+	}
+
+	fmt.Printf("Successfully uploaded datarange to datas3t '%s'\n", datas3tName)
+	return nil
+}
+
+// uploadStdin uploads a TAR archive piped to stdin. Its size is not known upfront, so
+// it is indexed while being uploaded and cannot be resumed.
+func uploadStdin(c *cli.Context, clientInstance *client.Client, datas3tName string) error {
+	for _, flag := range []string{"append", "lease", "resume", "state-file", "assign-keys", "first-datapoint", "key-mapping", "replace"} {
+		if c.IsSet(flag) {
+			return fmt.Errorf("--%s cannot be used when reading from stdin", flag)
+		}
+	}
+
+	if c.Bool("proxy") {
+		fmt.Printf("Uploading stdin to datas3t '%s' through the server...\n", datas3tName)
+
+		resp, err := clientInstance.ProxyUploadDatarange(context.Background(), datas3tName, os.Stdin, -1)
+		if err != nil {
+			return fmt.Errorf("failed to upload datarange: %w", err)
+		}
+
+		fmt.Printf("Successfully uploaded %d datapoints starting at datapoint %d to datas3t '%s'\n", resp.NumberOfDatapoints, resp.FirstDatapointIndex, datas3tName)
+		return nil
+	}
+
+	fmt.Printf("Uploading stdin to datas3t '%s'...\n", datas3tName)
+
+	progressBar := progressbar.New(80)
+
+	opts := &client.UploadOptions{
+		MaxParallelism:   c.Int("max-parallelism"),
+		MaxRetries:       c.Int("max-retries"),
+		ProgressCallback: progressBar.Update,
+		PresignExpiry:    c.Duration("presign-expiry"),
+		StreamPartSize:   c.Int("stream-part-size"),
+	}
+
+	err := clientInstance.UploadDataRangeStream(context.Background(), datas3tName, os.Stdin, opts)
+
+	progressBar.Finish()
 
 	if err != nil {
 		return fmt.Errorf("failed to upload datarange: %w", err)
@@ -200,4 +256,29 @@ func uploadTarAction(c *cli.Context) error {
 
 	fmt.Printf("Successfully uploaded datarange to datas3t '%s'\n", datas3tName)
 	return nil
-}
\ No newline at end of file
+}
+
+// readKeyMapping reads a JSON object mapping file names in the archive to datapoint keys.
+// An empty path means no mapping.
+func readKeyMapping(path string) (map[string]uint64, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key mapping: %w", err)
+	}
+
+	var mapping map[string]uint64
+	err = json.Unmarshal(data, &mapping)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key mapping '%s': %w", path, err)
+	}
+
+	if mapping == nil {
+		return nil, fmt.Errorf("key mapping '%s' must be a JSON object of file names to datapoint keys", path)
+	}
+
+	return mapping, nil
+}
@@ -0,0 +1,72 @@
+package versioncmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/version"
+	"github.com/urfave/cli/v2"
+)
+
+func Command() *cli.Command {
+	return &cli.Command{
+		Name:  "version",
+		Usage: "Show the CLI version and the version of the server",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "server-url",
+				Value:   "http://localhost:8765",
+				Usage:   "Server URL",
+				EnvVars: []string{"DATAS3T_SERVER_URL"},
+			},
+			&cli.BoolFlag{
+				Name:  "client-only",
+				Usage: "Only show the CLI version without contacting the server",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "Output as JSON",
+			},
+		},
+		Action: versionAction,
+	}
+}
+
+type versionOutput struct {
+	Client string              `json:"client"`
+	Server *client.VersionInfo `json:"server,omitempty"`
+}
+
+func versionAction(c *cli.Context) error {
+	out := versionOutput{Client: version.Get()}
+
+	if !c.Bool("client-only") {
+		cl := client.NewClient(c.String("server-url"))
+
+		info, err := cl.GetVersion(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to get server version: %w", err)
+		}
+		out.Server = info
+	}
+
+	if c.Bool("json") {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(out)
+	}
+
+	fmt.Printf("Client Version: %s\n", out.Client)
+	if out.Server != nil {
+		fmt.Printf("Server Version: %s\n", out.Server.Version)
+		fmt.Printf("Schema Version: %d (latest %d)\n", out.Server.SchemaVersion, out.Server.LatestSchemaVersion)
+		if out.Server.SchemaDirty {
+			fmt.Println("Schema is dirty: a migration failed and needs manual intervention")
+		}
+	}
+
+	return nil
+}
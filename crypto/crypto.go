@@ -6,41 +6,125 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"strings"
 )
 
-// CredentialEncryptor handles encryption and decryption of S3 credentials
-type CredentialEncryptor struct {
+// keyIDSeparator separates the key ID from the encrypted value. It is not part of the
+// base64 alphabet, values without it were encrypted before key IDs were introduced.
+const keyIDSeparator = ":"
+
+// encryptionKey is a derived AES-256 key and the ID embedded in the values it encrypts
+type encryptionKey struct {
+	id  string
 	key []byte
 }
 
+// CredentialEncryptor handles encryption and decryption of S3 credentials. Values are
+// encrypted with the active key, and decrypted with whichever known key encrypted them.
+type CredentialEncryptor struct {
+	key encryptionKey
+	// decryptionKeys holds the active key followed by the keys added with AddDecryptionKeys
+	decryptionKeys []encryptionKey
+}
+
+// CredentialDecrypter decrypts the stored credentials of buckets when their stores are
+// opened. It is implemented by CredentialEncryptor.
+type CredentialDecrypter interface {
+	DecryptCredentials(encryptedAccessKey, encryptedSecretKey string) (accessKey, secretKey string, err error)
+	Decrypt(encrypted string) (string, error)
+}
+
 // NewCredentialEncryptor creates a new encryptor from a base64-encoded key
 func NewCredentialEncryptor(base64Key string) (*CredentialEncryptor, error) {
+	key, err := deriveKey(base64Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CredentialEncryptor{
+		key:            key,
+		decryptionKeys: []encryptionKey{key},
+	}, nil
+}
+
+// deriveKey derives the AES-256 key and its ID from a base64-encoded key
+func deriveKey(base64Key string) (encryptionKey, error) {
 	if base64Key == "" {
-		return nil, fmt.Errorf("encryption key cannot be empty")
+		return encryptionKey{}, fmt.Errorf("encryption key cannot be empty")
 	}
 
 	key, err := base64.StdEncoding.DecodeString(base64Key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decode base64 key: %w", err)
+		return encryptionKey{}, fmt.Errorf("failed to decode base64 key: %w", err)
 	}
 
 	// Derive a 32-byte key using SHA-256
 	hash := sha256.Sum256(key)
 
-	return &CredentialEncryptor{
+	// The ID is a hash of the derived key, so it identifies the key without revealing it
+	id := sha256.Sum256(append([]byte("datas3t key id:"), hash[:]...))
+
+	return encryptionKey{
+		id:  hex.EncodeToString(id[:8]),
 		key: hash[:],
 	}, nil
 }
 
-// Encrypt encrypts a credential string using AES-256-GCM
+// AddDecryptionKeys adds base64-encoded keys that values can be decrypted with but are
+// no longer encrypted with, such as the keys used before a key rotation
+func (ce *CredentialEncryptor) AddDecryptionKeys(base64Keys ...string) error {
+	for _, base64Key := range base64Keys {
+		key, err := deriveKey(base64Key)
+		if err != nil {
+			return fmt.Errorf("invalid decryption key: %w", err)
+		}
+
+		if ce.findKey(key.id) != nil {
+			continue
+		}
+
+		ce.decryptionKeys = append(ce.decryptionKeys, key)
+	}
+
+	return nil
+}
+
+// KeyID returns the ID of the active key, embedded in every value it encrypts
+func (ce *CredentialEncryptor) KeyID() string {
+	return ce.key.id
+}
+
+// EncryptedWithActiveKey reports whether an encrypted value was encrypted with the active
+// key. Empty values need no key and are reported as encrypted with it.
+func (ce *CredentialEncryptor) EncryptedWithActiveKey(encrypted string) bool {
+	if encrypted == "" {
+		return true
+	}
+
+	id, _, found := strings.Cut(encrypted, keyIDSeparator)
+	return found && id == ce.key.id
+}
+
+func (ce *CredentialEncryptor) findKey(id string) *encryptionKey {
+	for i := range ce.decryptionKeys {
+		if ce.decryptionKeys[i].id == id {
+			return &ce.decryptionKeys[i]
+		}
+	}
+	return nil
+}
+
+// Encrypt encrypts a credential string using AES-256-GCM with the active key. The result
+// is prefixed with the ID of the key.
 func (ce *CredentialEncryptor) Encrypt(plaintext string) (string, error) {
 	if plaintext == "" {
 		return "", nil // Empty strings remain empty
 	}
 
-	block, err := aes.NewCipher(ce.key)
+	block, err := aes.NewCipher(ce.key.key)
 	if err != nil {
 		return "", fmt.Errorf("failed to create cipher: %w", err)
 	}
@@ -60,23 +144,56 @@ func (ce *CredentialEncryptor) Encrypt(plaintext string) (string, error) {
 	// Encrypt the plaintext
 	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
 
-	// Return base64-encoded result (nonce + ciphertext)
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	// Return the key ID and the base64-encoded result (nonce + ciphertext)
+	return ce.key.id + keyIDSeparator + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// Decrypt decrypts a credential string using AES-256-GCM
-func (ce *CredentialEncryptor) Decrypt(encryptedBase64 string) (string, error) {
-	if encryptedBase64 == "" {
+// Decrypt decrypts a credential string using AES-256-GCM with the key whose ID it is
+// prefixed with. Values encrypted before key IDs were introduced are decrypted with the
+// first known key that authenticates them.
+func (ce *CredentialEncryptor) Decrypt(encrypted string) (string, error) {
+	if encrypted == "" {
 		return "", nil // Empty strings remain empty
 	}
 
+	id, encryptedBase64, found := strings.Cut(encrypted, keyIDSeparator)
+	if !found {
+		return ce.decryptLegacy(encrypted)
+	}
+
+	key := ce.findKey(id)
+	if key == nil {
+		return "", fmt.Errorf("value was encrypted with unknown key %s", id)
+	}
+
 	// Decode from base64
 	ciphertext, err := base64.StdEncoding.DecodeString(encryptedBase64)
 	if err != nil {
 		return "", fmt.Errorf("failed to decode base64: %w", err)
 	}
 
-	block, err := aes.NewCipher(ce.key)
+	return decrypt(key.key, ciphertext)
+}
+
+// decryptLegacy decrypts a value without a key ID by trying every known key
+func (ce *CredentialEncryptor) decryptLegacy(encryptedBase64 string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(encryptedBase64)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+
+	for _, key := range ce.decryptionKeys {
+		plaintext, err := decrypt(key.key, ciphertext)
+		if err == nil {
+			return plaintext, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to decrypt: no known key decrypts the value")
+}
+
+func decrypt(key, ciphertext []byte) (string, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", fmt.Errorf("failed to create cipher: %w", err)
 	}
@@ -3,6 +3,7 @@ package crypto
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"strings"
 	"testing"
 )
 
@@ -191,3 +192,184 @@ func TestUniqueEncryption(t *testing.T) {
 		t.Error("Both encrypted values should decrypt to the original plaintext")
 	}
 }
+
+func generateTestKey(t *testing.T) string {
+	t.Helper()
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// legacyEncrypt encrypts like encryptors did before key IDs were introduced
+func legacyEncrypt(t *testing.T, encryptor *CredentialEncryptor, plaintext string) string {
+	t.Helper()
+
+	encrypted, err := encryptor.Encrypt(plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, legacy, found := strings.Cut(encrypted, keyIDSeparator)
+	if !found {
+		t.Fatalf("Encrypted value %q has no key ID", encrypted)
+	}
+	return legacy
+}
+
+func TestKeyIDIsEmbedded(t *testing.T) {
+	keyBase64 := generateTestKey(t)
+
+	encryptor, err := NewCredentialEncryptor(keyBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sameKeyEncryptor, err := NewCredentialEncryptor(keyBase64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherEncryptor, err := NewCredentialEncryptor(generateTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if encryptor.KeyID() != sameKeyEncryptor.KeyID() {
+		t.Errorf("Same key should have the same ID, got %q and %q", encryptor.KeyID(), sameKeyEncryptor.KeyID())
+	}
+
+	if encryptor.KeyID() == otherEncryptor.KeyID() {
+		t.Error("Different keys should have different IDs")
+	}
+
+	encrypted, err := encryptor.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(encrypted, encryptor.KeyID()+keyIDSeparator) {
+		t.Errorf("Encrypted value %q should start with the key ID %q", encrypted, encryptor.KeyID())
+	}
+
+	if !encryptor.EncryptedWithActiveKey(encrypted) {
+		t.Error("Value should be reported as encrypted with the active key")
+	}
+
+	if otherEncryptor.EncryptedWithActiveKey(encrypted) {
+		t.Error("Value should not be reported as encrypted with another key")
+	}
+
+	_, err = otherEncryptor.Decrypt(encrypted)
+	if err == nil || !strings.Contains(err.Error(), encryptor.KeyID()) {
+		t.Errorf("Expected an unknown key error naming %q, got %v", encryptor.KeyID(), err)
+	}
+}
+
+func TestDecryptionKeys(t *testing.T) {
+	oldKey := generateTestKey(t)
+	newKey := generateTestKey(t)
+
+	oldEncryptor, err := NewCredentialEncryptor(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encryptedWithOldKey, err := oldEncryptor.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := NewCredentialEncryptor(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = rotated.AddDecryptionKeys(oldKey, newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err := rotated.Decrypt(encryptedWithOldKey)
+	if err != nil {
+		t.Fatalf("Decrypt with old key failed: %v", err)
+	}
+
+	if decrypted != "secret" {
+		t.Errorf("Expected %q, got %q", "secret", decrypted)
+	}
+
+	if rotated.EncryptedWithActiveKey(encryptedWithOldKey) {
+		t.Error("Value encrypted with the old key should not be reported as encrypted with the active key")
+	}
+
+	reencrypted, err := rotated.Encrypt(decrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(reencrypted, rotated.KeyID()+keyIDSeparator) {
+		t.Errorf("Values should be encrypted with the active key, got %q", reencrypted)
+	}
+
+	_, err = oldEncryptor.Decrypt(reencrypted)
+	if err == nil {
+		t.Error("Expected error decrypting a value encrypted with the new key using only the old key")
+	}
+
+	err = rotated.AddDecryptionKeys("invalid-base64!")
+	if err == nil {
+		t.Error("Expected error for invalid decryption key")
+	}
+}
+
+func TestDecryptLegacyValues(t *testing.T) {
+	oldKey := generateTestKey(t)
+
+	oldEncryptor, err := NewCredentialEncryptor(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := legacyEncrypt(t, oldEncryptor, "secret")
+
+	decrypted, err := oldEncryptor.Decrypt(legacy)
+	if err != nil {
+		t.Fatalf("Decrypt of legacy value failed: %v", err)
+	}
+
+	if decrypted != "secret" {
+		t.Errorf("Expected %q, got %q", "secret", decrypted)
+	}
+
+	if oldEncryptor.EncryptedWithActiveKey(legacy) {
+		t.Error("Legacy value should not be reported as encrypted with the active key")
+	}
+
+	rotated, err := NewCredentialEncryptor(generateTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = rotated.Decrypt(legacy)
+	if err == nil {
+		t.Error("Expected error decrypting a legacy value without its key")
+	}
+
+	err = rotated.AddDecryptionKeys(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decrypted, err = rotated.Decrypt(legacy)
+	if err != nil {
+		t.Fatalf("Decrypt of legacy value with decryption key failed: %v", err)
+	}
+
+	if decrypted != "secret" {
+		t.Errorf("Expected %q, got %q", "secret", decrypted)
+	}
+}
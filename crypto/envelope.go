@@ -0,0 +1,221 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+const (
+	// DataKeySize is the size of the AES-256 keys the content of datapoints is encrypted with
+	DataKeySize = 32
+
+	// DataChunkSize is the size of the plaintext chunks datapoint content is encrypted in.
+	// Every chunk is authenticated on its own, so a datapoint is decrypted without reading
+	// the whole datarange.
+	DataChunkSize = 64 * 1024
+
+	// dataChunkTagSize is the size of the authentication tag following every chunk
+	dataChunkTagSize = 16
+
+	// EncryptedChunkSize is the size of an encrypted chunk of DataChunkSize bytes
+	EncryptedChunkSize = DataChunkSize + dataChunkTagSize
+)
+
+// NewDataKey generates a random data key
+func NewDataKey() ([]byte, error) {
+	dataKey := make([]byte, DataKeySize)
+	_, err := io.ReadFull(rand.Reader, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	return dataKey, nil
+}
+
+// WrapDataKey encrypts a data key with the active key, the wrapped key is stored next
+// to the data it encrypts
+func (ce *CredentialEncryptor) WrapDataKey(dataKey []byte) (string, error) {
+	if len(dataKey) != DataKeySize {
+		return "", fmt.Errorf("data key must be %d bytes, got %d", DataKeySize, len(dataKey))
+	}
+
+	return ce.Encrypt(base64.StdEncoding.EncodeToString(dataKey))
+}
+
+// UnwrapDataKey decrypts a data key wrapped with WrapDataKey by any of the known keys
+func (ce *CredentialEncryptor) UnwrapDataKey(wrapped string) ([]byte, error) {
+	if wrapped == "" {
+		return nil, fmt.Errorf("wrapped data key cannot be empty")
+	}
+
+	encoded, err := ce.Decrypt(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	dataKey, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode data key: %w", err)
+	}
+
+	if len(dataKey) != DataKeySize {
+		return nil, fmt.Errorf("data key must be %d bytes, got %d", DataKeySize, len(dataKey))
+	}
+
+	return dataKey, nil
+}
+
+// DataCipher encrypts the content of the datapoints of a datarange with its data key.
+// Content is split into chunks of DataChunkSize, each sealed with AES-256-GCM under a
+// nonce made of the position of the datapoint in its datarange and the number of the
+// chunk. The last chunk is sealed as such, so truncated content fails to decrypt.
+// Empty content is sealed as a single empty chunk.
+type DataCipher struct {
+	gcm cipher.AEAD
+}
+
+// NewDataCipher creates a cipher for the datapoints encrypted with a data key
+func NewDataCipher(dataKey []byte) (*DataCipher, error) {
+	if len(dataKey) != DataKeySize {
+		return nil, fmt.Errorf("data key must be %d bytes, got %d", DataKeySize, len(dataKey))
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	return &DataCipher{gcm: gcm}, nil
+}
+
+// NumDataChunks returns the number of chunks content of size bytes is encrypted in
+func NumDataChunks(size int64) int64 {
+	return max(1, (size+DataChunkSize-1)/DataChunkSize)
+}
+
+// EncryptedSize returns the size of content of size bytes once encrypted
+func EncryptedSize(size int64) int64 {
+	return size + NumDataChunks(size)*dataChunkTagSize
+}
+
+// DecryptedSize returns the size of encrypted content once decrypted
+func DecryptedSize(encryptedSize int64) (int64, error) {
+	fullChunks := encryptedSize / EncryptedChunkSize
+	rest := encryptedSize % EncryptedChunkSize
+
+	size := fullChunks * DataChunkSize
+	if rest > 0 {
+		size += rest - dataChunkTagSize
+	}
+
+	if size < 0 || EncryptedSize(size) != encryptedSize {
+		return 0, fmt.Errorf("%d bytes is not the size of encrypted content", encryptedSize)
+	}
+
+	return size, nil
+}
+
+// chunkNonce returns the nonce of a chunk of the datapoint at position
+func chunkNonce(position uint64, chunk uint32) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[0:8], position)
+	binary.BigEndian.PutUint32(nonce[8:12], chunk)
+	return nonce
+}
+
+// chunkAdditionalData marks the last chunk of a datapoint
+func chunkAdditionalData(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// EncryptChunk appends a chunk of the content of the datapoint at position, encrypted,
+// to dst. Chunks other than the final one must be DataChunkSize long.
+func (dc *DataCipher) EncryptChunk(dst []byte, position uint64, chunk uint32, final bool, plaintext []byte) []byte {
+	return dc.gcm.Seal(dst, chunkNonce(position, chunk), plaintext, chunkAdditionalData(final))
+}
+
+// DecryptChunk appends a decrypted chunk of the content of the datapoint at position to dst
+func (dc *DataCipher) DecryptChunk(dst []byte, position uint64, chunk uint32, final bool, ciphertext []byte) ([]byte, error) {
+	plaintext, err := dc.gcm.Open(dst, chunkNonce(position, chunk), ciphertext, chunkAdditionalData(final))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt chunk %d of datapoint %d: %w", chunk, position, err)
+	}
+
+	return plaintext, nil
+}
+
+// Encrypt encrypts the content of the datapoint at position
+func (dc *DataCipher) Encrypt(position uint64, plaintext []byte) []byte {
+	size := int64(len(plaintext))
+	chunks := NumDataChunks(size)
+	ciphertext := make([]byte, 0, EncryptedSize(size))
+
+	for chunk := range chunks {
+		start := chunk * DataChunkSize
+		end := min(start+DataChunkSize, size)
+		ciphertext = dc.EncryptChunk(ciphertext, position, uint32(chunk), chunk == chunks-1, plaintext[start:end])
+	}
+
+	return ciphertext
+}
+
+// Decrypt decrypts the content of the datapoint at position
+func (dc *DataCipher) Decrypt(position uint64, ciphertext []byte) ([]byte, error) {
+	size, err := DecryptedSize(int64(len(ciphertext)))
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := NumDataChunks(size)
+	plaintext := make([]byte, 0, size)
+
+	for chunk := range chunks {
+		start := chunk * EncryptedChunkSize
+		end := min(start+EncryptedChunkSize, int64(len(ciphertext)))
+		plaintext, err = dc.DecryptChunk(plaintext, position, uint32(chunk), chunk == chunks-1, ciphertext[start:end])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return plaintext, nil
+}
+
+// EncryptStream encrypts size bytes of content of the datapoint at position read from r
+// and writes them to w, holding a single chunk in memory
+func (dc *DataCipher) EncryptStream(w io.Writer, r io.Reader, position uint64, size int64) error {
+	chunks := NumDataChunks(size)
+	plaintext := make([]byte, min(size, DataChunkSize))
+	ciphertext := make([]byte, 0, len(plaintext)+dataChunkTagSize)
+
+	for chunk := range chunks {
+		n := min(size-chunk*DataChunkSize, DataChunkSize)
+
+		_, err := io.ReadFull(r, plaintext[:n])
+		if err != nil {
+			return fmt.Errorf("failed to read chunk %d of datapoint %d: %w", chunk, position, err)
+		}
+
+		ciphertext = dc.EncryptChunk(ciphertext[:0], position, uint32(chunk), chunk == chunks-1, plaintext[:n])
+
+		_, err = w.Write(ciphertext)
+		if err != nil {
+			return fmt.Errorf("failed to write chunk %d of datapoint %d: %w", chunk, position, err)
+		}
+	}
+
+	return nil
+}
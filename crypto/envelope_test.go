@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func newTestDataCipher(t *testing.T) *DataCipher {
+	t.Helper()
+
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataCipher, err := NewDataCipher(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dataCipher
+}
+
+func TestDataCipherRoundTrip(t *testing.T) {
+	dataCipher := newTestDataCipher(t)
+
+	for _, size := range []int{0, 1, DataChunkSize - 1, DataChunkSize, DataChunkSize + 1, 3*DataChunkSize + 17} {
+		plaintext := make([]byte, size)
+		_, err := rand.Read(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ciphertext := dataCipher.Encrypt(7, plaintext)
+		if int64(len(ciphertext)) != EncryptedSize(int64(size)) {
+			t.Errorf("Size %d: expected %d encrypted bytes, got %d", size, EncryptedSize(int64(size)), len(ciphertext))
+		}
+
+		decryptedSize, err := DecryptedSize(int64(len(ciphertext)))
+		if err != nil || decryptedSize != int64(size) {
+			t.Errorf("Size %d: DecryptedSize returned %d, %v", size, decryptedSize, err)
+		}
+
+		var streamed bytes.Buffer
+		err = dataCipher.EncryptStream(&streamed, bytes.NewReader(plaintext), 7, int64(size))
+		if err != nil {
+			t.Fatalf("Size %d: EncryptStream failed: %v", size, err)
+		}
+
+		if !bytes.Equal(streamed.Bytes(), ciphertext) {
+			t.Errorf("Size %d: EncryptStream and Encrypt produced different ciphertexts", size)
+		}
+
+		decrypted, err := dataCipher.Decrypt(7, ciphertext)
+		if err != nil {
+			t.Fatalf("Size %d: Decrypt failed: %v", size, err)
+		}
+
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("Size %d: decrypted content differs from the plaintext", size)
+		}
+	}
+}
+
+func TestDataCipherRejectsTampering(t *testing.T) {
+	dataCipher := newTestDataCipher(t)
+
+	plaintext := bytes.Repeat([]byte("datapoint"), DataChunkSize/4)
+	ciphertext := dataCipher.Encrypt(3, plaintext)
+
+	_, err := dataCipher.Decrypt(4, ciphertext)
+	if err == nil {
+		t.Error("Expected error when decrypting at another position")
+	}
+
+	// Dropping the last chunk leaves a valid size, but no chunk sealed as the last one
+	_, err = dataCipher.Decrypt(3, ciphertext[:DataChunkSize+dataChunkTagSize])
+	if err == nil {
+		t.Error("Expected error for truncated content")
+	}
+
+	tampered := bytes.Clone(ciphertext)
+	tampered[10] ^= 1
+	_, err = dataCipher.Decrypt(3, tampered)
+	if err == nil {
+		t.Error("Expected error for modified content")
+	}
+
+	_, err = newTestDataCipher(t).Decrypt(3, ciphertext)
+	if err == nil {
+		t.Error("Expected error when decrypting with another data key")
+	}
+}
+
+func TestDecryptedSizeRejectsInvalidSizes(t *testing.T) {
+	for _, size := range []int64{0, dataChunkTagSize - 1, DataChunkSize + dataChunkTagSize + dataChunkTagSize} {
+		_, err := DecryptedSize(size)
+		if err == nil {
+			t.Errorf("Expected error for encrypted size %d", size)
+		}
+	}
+}
+
+func TestWrapDataKey(t *testing.T) {
+	oldKey := generateTestKey(t)
+
+	oldEncryptor, err := NewCredentialEncryptor(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataKey, err := NewDataKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrapped, err := oldEncryptor.WrapDataKey(dataKey)
+	if err != nil {
+		t.Fatalf("WrapDataKey failed: %v", err)
+	}
+
+	// Data keys wrapped before a key rotation are unwrapped with the decryption keys
+	encryptor, err := NewCredentialEncryptor(generateTestKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = encryptor.UnwrapDataKey(wrapped)
+	if err == nil {
+		t.Error("Expected error when unwrapping with an unknown key")
+	}
+
+	err = encryptor.AddDecryptionKeys(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unwrapped, err := encryptor.UnwrapDataKey(wrapped)
+	if err != nil {
+		t.Fatalf("UnwrapDataKey failed: %v", err)
+	}
+
+	if !bytes.Equal(unwrapped, dataKey) {
+		t.Error("Unwrapped data key differs from the wrapped one")
+	}
+
+	_, err = encryptor.WrapDataKey(dataKey[:16])
+	if err == nil {
+		t.Error("Expected error for a data key of the wrong size")
+	}
+}
@@ -3,6 +3,11 @@ package datas3t_test
 import (
 	"archive/tar"
 	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -13,13 +18,20 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/RoaringBitmap/roaring/roaring64"
 	"github.com/draganm/datas3t"
+	"github.com/draganm/datas3t/apierror"
 	datas3tclient "github.com/draganm/datas3t/client"
+	"github.com/draganm/datas3t/httpapi"
 	"github.com/draganm/datas3t/tarindex"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	legacyrouter "github.com/getkin/kin-openapi/routers/legacy"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -268,6 +280,94 @@ func extractFilesFromTar(tarData []byte, filesMap map[string][]byte) error {
 	return nil
 }
 
+// openAPIValidatingTransport validates every request to and response from the datas3t
+// server against the OpenAPI spec. Requests to other hosts (e.g. presigned S3 URLs) are
+// passed through unchanged.
+type openAPIValidatingTransport struct {
+	baseURL string
+	router  routers.Router
+	next    http.RoundTripper
+
+	mu         sync.Mutex
+	errors     []error
+	operations map[string]bool
+}
+
+func (t *openAPIValidatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasPrefix(req.URL.String(), t.baseURL) {
+		return t.next.RoundTrip(req)
+	}
+
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		reqBody, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	t.validate(req, reqBody, resp, respBody)
+
+	return resp, nil
+}
+
+func (t *openAPIValidatingTransport) validate(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	validationReq := req.Clone(req.Context())
+	validationReq.Body = io.NopCloser(bytes.NewReader(reqBody))
+
+	route, pathParams, err := t.router.FindRoute(validationReq)
+	if err != nil {
+		t.errors = append(t.errors, fmt.Errorf("%s %s: no route in spec: %w", req.Method, req.URL.Path, err))
+		return
+	}
+
+	t.operations[req.Method+" "+route.Path] = true
+
+	requestInput := &openapi3filter.RequestValidationInput{
+		Request:    validationReq,
+		PathParams: pathParams,
+		Route:      route,
+		Options:    &openapi3filter.Options{MultiError: true},
+	}
+
+	// Invalid requests are sent deliberately to check error responses, so only
+	// responses to valid requests are checked against the success schemas
+	if resp.StatusCode < 400 {
+		err = openapi3filter.ValidateRequest(req.Context(), requestInput)
+		if err != nil {
+			t.errors = append(t.errors, fmt.Errorf("%s %s: invalid request: %w", req.Method, req.URL.Path, err))
+		}
+	}
+
+	err = openapi3filter.ValidateResponse(req.Context(), &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: requestInput,
+		Status:                 resp.StatusCode,
+		Header:                 resp.Header,
+		Body:                   io.NopCloser(bytes.NewReader(respBody)),
+		Options:                &openapi3filter.Options{MultiError: true, IncludeResponseStatus: true},
+	})
+	if err != nil {
+		t.errors = append(t.errors, fmt.Errorf("%s %s (%d): invalid response: %w", req.Method, req.URL.Path, resp.StatusCode, err))
+	}
+}
+
 var _ = Describe("End-to-End Server Test", func() {
 	var (
 		pgContainer          *tc_postgres.PostgresContainer
@@ -1720,6 +1820,76 @@ var _ = Describe("End-to-End Server Test", func() {
 		// Total should be 100 + 500 + 1000 + 50 + 300 = 1950
 		Expect(totalDatapoints).To(Equal(int64(1950)))
 
+		// Step 5a: Page through the dataranges and apply filters
+		logger.Info("Step 5a: Testing pagination and filters")
+
+		page, err := client.ListDatarangesPage(ctx, &datas3tclient.ListDatarangesRequest{
+			Datas3tName: testDatas3tName,
+			Limit:       2,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Dataranges).To(HaveLen(2))
+		Expect(page.NextCursor).NotTo(BeEmpty())
+		Expect(page.Dataranges[0].MinDatapointKey).To(Equal(int64(0)))
+
+		page, err = client.ListDatarangesPage(ctx, &datas3tclient.ListDatarangesRequest{
+			Datas3tName: testDatas3tName,
+			Limit:       2,
+			Cursor:      page.NextCursor,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Dataranges).To(HaveLen(2))
+		Expect(page.Dataranges[0].MinDatapointKey).To(Equal(int64(600)))
+
+		fromKey, toKey := int64(500), int64(1600)
+		filtered, err := client.ListAllDataranges(ctx, &datas3tclient.ListDatarangesRequest{
+			Datas3tName:      testDatas3tName,
+			FromDatapointKey: &fromKey,
+			ToDatapointKey:   &toKey,
+			SortBy:           datas3tclient.SortBySize,
+			SortOrder:        datas3tclient.SortOrderDesc,
+			Limit:            1,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(filtered).To(HaveLen(3))
+		Expect(filtered[0].MinDatapointKey).To(Equal(int64(600)))  // Largest: 1000 files
+		Expect(filtered[2].MinDatapointKey).To(Equal(int64(1600))) // Smallest: 50 files
+
+		cmd = exec.Command(cliPath, "datarange", "list", "--datas3t", testDatas3tName, "--limit", "3")
+		cmd.Env = append(os.Environ(), "DATAS3T_SERVER_URL="+serverBaseURL)
+
+		output, err = cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(ContainSubstring("Total dataranges: 3"))
+		Expect(string(output)).To(ContainSubstring("--cursor"))
+
+		datas3ts, err := client.ListDatas3tsWithOptions(ctx, &datas3tclient.ListDatas3tsRequest{NamePrefix: testDatas3tName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(datas3ts).To(HaveLen(1))
+
+		datas3ts, err = client.ListDatas3tsWithOptions(ctx, &datas3tclient.ListDatas3tsRequest{NamePrefix: "no-such-prefix"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(datas3ts).To(BeEmpty())
+
+		// Step 5b: Find the missing datapoints between 1649 and 2000
+		logger.Info("Step 5b: Testing gaps")
+
+		gaps, err := client.GetDatapointGaps(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gaps.LowestDatapoint).To(Equal(int64(0)))
+		Expect(gaps.HighestDatapoint).To(Equal(int64(2299)))
+		Expect(gaps.Gaps).To(Equal([]datas3tclient.DatapointGap{
+			{FirstDatapointKey: 1650, LastDatapointKey: 1999, MissingDatapoints: 350},
+		}))
+
+		cmd = exec.Command(cliPath, "gaps", testDatas3tName)
+		cmd.Env = append(os.Environ(), "DATAS3T_SERVER_URL="+serverBaseURL)
+
+		output, err = cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(output)).To(MatchRegexp(`1650\s+1999\s+350`))
+		Expect(string(output)).To(ContainSubstring("Total gaps: 1, missing datapoints: 350"))
+
 		// Step 6: Test list command with non-existent datas3t
 		logger.Info("Step 6: Testing list command with non-existent datas3t")
 
@@ -2877,4 +3047,1685 @@ var _ = Describe("End-to-End Server Test", func() {
 			"final_datapoint_count", bitmap.GetCardinality())
 	})
 
+	It("should return structured errors that the client can classify", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		// Unknown bucket when adding a datas3t
+		err := client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: "missing-bucket",
+		})
+		Expect(err).To(MatchError(datas3tclient.ErrBucketNotFound))
+
+		var apiErr *datas3tclient.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(apiErr.Code).To(Equal(apierror.CodeBucketNotFound))
+
+		err = client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Adding the same datas3t twice conflicts
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).To(MatchError(datas3tclient.ErrDatas3tAlreadyExists))
+
+		// Unknown datas3t when starting an upload
+		_, err = client.StartDatarangeUpload(ctx, &datas3tclient.UploadDatarangeRequest{
+			Datas3tName:         "missing-datas3t",
+			DataSize:            1024,
+			NumberOfDatapoints:  10,
+			FirstDatapointIndex: 0,
+		})
+		Expect(err).To(MatchError(datas3tclient.ErrDatas3tNotFound))
+
+		// Overlapping datarange
+		tarData, _ := createTestTarWithIndex(10, 0)
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.StartDatarangeUpload(ctx, &datas3tclient.UploadDatarangeRequest{
+			Datas3tName:         testDatas3tName,
+			DataSize:            1024,
+			NumberOfDatapoints:  10,
+			FirstDatapointIndex: 5,
+		})
+		Expect(err).To(MatchError(datas3tclient.ErrDatarangeOverlap))
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(http.StatusConflict))
+		Expect(datas3tclient.IsTemporary(err)).To(BeFalse())
+
+		// Aggregation of a single datarange
+		_, err = client.StartAggregate(ctx, &datas3tclient.StartAggregateRequest{
+			Datas3tName:         testDatas3tName,
+			FirstDatapointIndex: 0,
+			LastDatapointIndex:  9,
+		})
+		Expect(err).To(MatchError(datas3tclient.ErrInsufficientDataranges))
+
+		// Deleting a non-empty datas3t
+		_, err = client.DeleteDatas3t(ctx, &datas3tclient.DeleteDatas3tRequest{Name: testDatas3tName})
+		Expect(err).To(MatchError(datas3tclient.ErrDatas3tNotEmpty))
+
+		// Deleting a missing datarange
+		err = client.DeleteDatarange(ctx, &datas3tclient.DeleteDatarangeRequest{
+			Datas3tName:       testDatas3tName,
+			FirstDatapointKey: 100,
+			LastDatapointKey:  200,
+		})
+		Expect(err).To(MatchError(datas3tclient.ErrDatarangeNotFound))
+
+		// Raw responses use the JSON error envelope
+		resp, err := http.Post(serverBaseURL+"/api/v1/datas3ts", "application/json", strings.NewReader("{not json"))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+
+		var envelope apierror.Response
+		err = json.NewDecoder(resp.Body).Decode(&envelope)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(envelope.Error.Code).To(Equal(apierror.CodeInvalidRequest))
+		Expect(envelope.Error.Message).NotTo(BeEmpty())
+	})
+
+	It("should serve responses that conform to the OpenAPI spec", func(ctx SpecContext) {
+		doc, err := openapi3.NewLoader().LoadFromData(httpapi.OpenAPISpec)
+		Expect(err).NotTo(HaveOccurred())
+		doc.Servers = openapi3.Servers{{URL: serverBaseURL}}
+
+		router, err := legacyrouter.NewRouter(doc)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Proxied uploads send the TAR archive as the raw request body
+		openapi3filter.RegisterBodyDecoder("application/x-tar", openapi3filter.FileBodyDecoder)
+		DeferCleanup(func() {
+			openapi3filter.UnregisterBodyDecoder("application/x-tar")
+		})
+
+		transport := &openAPIValidatingTransport{
+			baseURL:    serverBaseURL,
+			router:     router,
+			next:       http.DefaultTransport,
+			operations: map[string]bool{},
+		}
+
+		originalTransport := http.DefaultClient.Transport
+		http.DefaultClient.Transport = transport
+		DeferCleanup(func() {
+			http.DefaultClient.Transport = originalTransport
+		})
+
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		// Probes, version and the spec itself
+		for _, path := range []string{"/healthz", "/readyz", "/readyz?check_buckets=true", "/api/v1/version", "/api/v1/openapi.json"} {
+			resp, err := http.DefaultClient.Get(serverBaseURL + path)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+		}
+
+		// Buckets
+		err = client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.ListBuckets(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		region := "us-east-1"
+		_, err = client.UpdateBucket(ctx, &datas3tclient.UpdateBucketRequest{
+			Name:   testBucketConfigName,
+			Region: &region,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.TestBucket(ctx, &datas3tclient.TestBucketRequest{Name: testBucketConfigName})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Datas3ts
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.ListDatas3ts(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.DeleteBucket(ctx, &datas3tclient.DeleteBucketRequest{Name: testBucketConfigName})
+		Expect(err).To(MatchError(datas3tclient.ErrBucketInUse))
+
+		// Uploads (start + complete through the upload helper, start + cancel directly)
+		for i := 0; i < 2; i++ {
+			tarData, _ := createTestTarWithIndex(10, int64(i*10))
+			err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), nil)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		upload, err := client.StartDatarangeUpload(ctx, &datas3tclient.UploadDatarangeRequest{
+			Datas3tName:          testDatas3tName,
+			DataSize:             1024,
+			NumberOfDatapoints:   10,
+			FirstDatapointIndex:  100,
+			LeaseDurationSeconds: 60,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.ListDatarangeUploadLeases(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.RenewDatarangeUploadLease(ctx, &datas3tclient.RenewLeaseRequest{
+			DatarangeUploadID:    upload.DatarangeID,
+			LeaseDurationSeconds: 60,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.ResumeDatarangeUpload(ctx, &datas3tclient.ResumeUploadRequest{DatarangeUploadID: upload.DatarangeID})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.CancelDatarangeUpload(ctx, &datas3tclient.CancelUploadRequest{DatarangeUploadID: upload.DatarangeID})
+		Expect(err).NotTo(HaveOccurred())
+
+		streamed, err := client.StartDatarangeUpload(ctx, &datas3tclient.UploadDatarangeRequest{
+			Datas3tName: testDatas3tName,
+			Stream:      true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.PresignUploadParts(ctx, &datas3tclient.PresignUploadPartsRequest{
+			DatarangeUploadID: streamed.DatarangeID,
+			FirstPartNumber:   1,
+			NumberOfParts:     2,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.CancelDatarangeUpload(ctx, &datas3tclient.CancelUploadRequest{DatarangeUploadID: streamed.DatarangeID})
+		Expect(err).NotTo(HaveOccurred())
+
+		proxiedTar, _ := createTestTarWithIndex(10, 20)
+		_, err = client.ProxyUploadDatarange(ctx, testDatas3tName, bytes.NewReader(proxiedTar), int64(len(proxiedTar)))
+		Expect(err).NotTo(HaveOccurred())
+
+		// Reads
+		_, err = client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.GetDatapointsBitmap(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.GetDatapointGaps(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+
+		presigned, err := client.PreSignDownloadForDatapoints(ctx, &datas3tclient.PreSignDownloadForDatapointsRequest{
+			Datas3tName:    testDatas3tName,
+			FirstDatapoint: 0,
+			LastDatapoint:  19,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.RefreshDownloadSegments(ctx, &datas3tclient.RefreshDownloadSegmentsRequest{
+			Datas3tName: testDatas3tName,
+			Segments:    presigned.DownloadSegments,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Aggregation (start + cancel directly, start + complete through the aggregate helper)
+		aggregate, err := client.StartAggregate(ctx, &datas3tclient.StartAggregateRequest{
+			Datas3tName:         testDatas3tName,
+			FirstDatapointIndex: 0,
+			LastDatapointIndex:  19,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.CancelAggregate(ctx, &datas3tclient.CancelAggregateRequest{AggregateUploadID: aggregate.AggregateUploadID})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AggregateDataRanges(ctx, testDatas3tName, 0, 19, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Error responses
+		_, err = client.StartDatarangeUpload(ctx, &datas3tclient.UploadDatarangeRequest{
+			Datas3tName:         testDatas3tName,
+			DataSize:            1024,
+			NumberOfDatapoints:  10,
+			FirstDatapointIndex: 0,
+		})
+		Expect(err).To(MatchError(datas3tclient.ErrDatarangeOverlap))
+
+		_, err = client.DeleteDatas3t(ctx, &datas3tclient.DeleteDatas3tRequest{Name: testDatas3tName})
+		Expect(err).To(MatchError(datas3tclient.ErrDatas3tNotEmpty))
+
+		// Deletion
+		err = client.DeleteDatarange(ctx, &datas3tclient.DeleteDatarangeRequest{
+			Datas3tName:       testDatas3tName,
+			FirstDatapointKey: 0,
+			LastDatapointKey:  19,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.ImportDatas3t(ctx, &datas3tclient.ImportDatas3tRequest{BucketName: testBucketConfigName})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.ClearDatas3t(ctx, &datas3tclient.ClearDatas3tRequest{Name: testDatas3tName})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.DeleteDatas3t(ctx, &datas3tclient.DeleteDatas3tRequest{Name: testDatas3tName})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.DeleteBucket(ctx, &datas3tclient.DeleteBucketRequest{Name: testBucketConfigName})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(transport.errors).To(BeEmpty())
+
+		// Every documented operation must have been exercised
+		for path, item := range doc.Paths.Map() {
+			for method := range item.Operations() {
+				Expect(transport.operations).To(HaveKey(method+" "+path), "operation %s %s was not exercised", method, path)
+			}
+		}
+	})
+
+	It("should stream datapoints through a DatapointWriter", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 1: Cut dataranges by count and at gaps in the key sequence
+		var uploadedMu sync.Mutex
+		var uploaded [][2]uint64
+
+		writer, err := client.NewDatapointWriter(ctx, testDatas3tName, &datas3tclient.DatapointWriterOptions{
+			MaxDatapoints:        100,
+			MaxConcurrentUploads: 2,
+			TempDir:              tempDir,
+			OnDatarangeUploaded: func(first, last uint64) {
+				uploadedMu.Lock()
+				defer uploadedMu.Unlock()
+				uploaded = append(uploaded, [2]uint64{first, last})
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		writeRange := func(first, last uint64) {
+			for key := first; key <= last; key++ {
+				err := writer.WriteDatapoint(key, "txt", []byte(fmt.Sprintf("datapoint %d", key)))
+				Expect(err).NotTo(HaveOccurred())
+			}
+		}
+
+		writeRange(0, 249)
+		writeRange(300, 349)
+
+		err = writer.WriteDatapoint(349, "txt", []byte("duplicate"))
+		Expect(err).To(MatchError(datas3tclient.ErrValidationFailed))
+
+		err = writer.Close()
+		Expect(err).NotTo(HaveOccurred())
+
+		err = writer.WriteDatapoint(350, "txt", []byte("too late"))
+		Expect(err).To(MatchError(datas3tclient.ErrDatapointWriterClosed))
+
+		Expect(uploaded).To(ConsistOf(
+			[2]uint64{0, 99},
+			[2]uint64{100, 199},
+			[2]uint64{200, 249},
+			[2]uint64{300, 349},
+		))
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(4))
+
+		// Temporary tar files are removed after the upload
+		tarFiles, err := filepath.Glob(filepath.Join(tempDir, "datas3t-datarange-*.tar"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tarFiles).To(BeEmpty())
+
+		// Step 2: The uploaded datapoints can be read back in order
+		key := uint64(200)
+		for content, err := range client.DatapointIterator(ctx, testDatas3tName, 200, 349) {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(fmt.Sprintf("datapoint %d", key)))
+			key++
+			if key == 250 {
+				key = 300
+			}
+		}
+		Expect(key).To(Equal(uint64(350)))
+
+		// Step 3: Cut dataranges by age without closing the writer
+		writer, err = client.NewDatapointWriter(ctx, testDatas3tName, &datas3tclient.DatapointWriterOptions{
+			MaxDatarangeAge: 500 * time.Millisecond,
+			TempDir:         tempDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		writeRange(1000, 1009)
+
+		Eventually(func() ([]datas3tclient.DatarangeInfo, error) {
+			return client.ListDataranges(ctx, testDatas3tName)
+		}).WithTimeout(30 * time.Second).Should(HaveLen(5))
+
+		// Step 4: Flush uploads a partially filled datarange
+		writeRange(1010, 1014)
+
+		err = writer.Flush()
+		Expect(err).NotTo(HaveOccurred())
+
+		dataranges, err = client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(6))
+		Expect(dataranges[5].MinDatapointKey).To(Equal(int64(1010)))
+		Expect(dataranges[5].MaxDatapointKey).To(Equal(int64(1014)))
+
+		err = writer.Close()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should append dataranges with server-allocated datapoint keys", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 1: Appending to an empty datas3t starts at key 0, the TAR keys are only relative
+		tarData, _ := createTestTarWithIndex(100, 5000)
+		first, err := client.AppendDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(first).To(Equal(uint64(0)))
+
+		// Step 2: Appends continue after explicitly keyed dataranges
+		tarData, _ = createTestTarWithIndex(50, 200)
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		tarFile := filepath.Join(tempDir, "append.tar")
+		tarData, _ = createTestTarWithIndex(30, 0)
+		err = os.WriteFile(tarFile, tarData, 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = runCLICommand(cliPath, "upload-tar",
+			"--datas3t", testDatas3tName,
+			"--file", tarFile,
+			"--append",
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 3: Concurrent appending writers get disjoint key blocks
+		var uploadedMu sync.Mutex
+		var uploaded [][2]uint64
+
+		var wg sync.WaitGroup
+		for w := 0; w < 3; w++ {
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+
+				writer, err := client.NewDatapointWriter(ctx, testDatas3tName, &datas3tclient.DatapointWriterOptions{
+					MaxDatapoints: 10,
+					TempDir:       tempDir,
+					Append:        true,
+					OnDatarangeUploaded: func(first, last uint64) {
+						uploadedMu.Lock()
+						defer uploadedMu.Unlock()
+						uploaded = append(uploaded, [2]uint64{first, last})
+					},
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				err = writer.WriteDatapoint(1, "txt", []byte("explicit key"))
+				Expect(err).To(MatchError(datas3tclient.ErrValidationFailed))
+
+				for i := 0; i < 20; i++ {
+					err = writer.AppendDatapoint("txt", []byte("appended"))
+					Expect(err).NotTo(HaveOccurred())
+				}
+
+				err = writer.Close()
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		Expect(uploaded).To(HaveLen(6))
+		for _, r := range uploaded {
+			Expect(r[1] - r[0]).To(Equal(uint64(9)))
+		}
+
+		// Step 4: All dataranges are contiguous and do not overlap
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(9))
+		Expect(dataranges[0].MinDatapointKey).To(Equal(int64(0)))
+		Expect(dataranges[0].MaxDatapointKey).To(Equal(int64(99)))
+		Expect(dataranges[1].MinDatapointKey).To(Equal(int64(200)))
+		Expect(dataranges[2].MinDatapointKey).To(Equal(int64(250)))
+		Expect(dataranges[2].MaxDatapointKey).To(Equal(int64(279)))
+		for i := 3; i < len(dataranges); i++ {
+			Expect(dataranges[i].MinDatapointKey).To(Equal(dataranges[i-1].MaxDatapointKey + 1))
+		}
+
+		// Step 5: The renamed datapoints are stored under the allocated keys
+		downloadedTar := filepath.Join(tempDir, "appended.tar")
+		err = runCLICommand(cliPath, "datarange", "download-tar",
+			"--datas3t", testDatas3tName,
+			"--first-datapoint", "0",
+			"--last-datapoint", "99",
+			"--output", downloadedTar,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		downloaded, err := os.ReadFile(downloadedTar)
+		Expect(err).NotTo(HaveOccurred())
+
+		tr := tar.NewReader(bytes.NewReader(downloaded))
+		for i := 0; i < 100; i++ {
+			header, err := tr.Next()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(header.Name).To(Equal(fmt.Sprintf("%020d.txt", i)))
+
+			content, err := io.ReadAll(tr)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(HavePrefix(fmt.Sprintf("Content of file %d - ", 5000+i)))
+		}
+	})
+
+	It("should reject overlapping uploads while a range is leased", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 1: A producer leases datapoints 0-99
+		upload, err := client.StartDatarangeUpload(ctx, &datas3tclient.UploadDatarangeRequest{
+			Datas3tName:          testDatas3tName,
+			DataSize:             1024,
+			NumberOfDatapoints:   100,
+			FirstDatapointIndex:  0,
+			LeaseDurationSeconds: 60,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(upload.LeaseExpiresAt).NotTo(BeNil())
+
+		leases, err := client.ListDatarangeUploadLeases(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leases).To(HaveLen(1))
+		Expect(leases[0].DatarangeUploadID).To(Equal(upload.DatarangeID))
+		Expect(leases[0].LastDatapointIndex).To(Equal(int64(99)))
+
+		err = runCLICommand(cliPath, "datarange", "leases", "--datas3t", testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 2: Another producer cannot start an overlapping upload
+		tarData, _ := createTestTarWithIndex(20, 90)
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), nil)
+		Expect(err).To(MatchError(datas3tclient.ErrDatarangeLeased))
+
+		var apiErr *datas3tclient.APIError
+		Expect(errors.As(err, &apiErr)).To(BeTrue())
+		Expect(apiErr.StatusCode).To(Equal(http.StatusConflict))
+
+		// Step 3: The lease can be renewed and is released on cancel
+		renewed, err := client.RenewDatarangeUploadLease(ctx, &datas3tclient.RenewLeaseRequest{
+			DatarangeUploadID:    upload.DatarangeID,
+			LeaseDurationSeconds: 120,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(renewed.LeaseExpiresAt).To(BeTemporally(">", *upload.LeaseExpiresAt))
+
+		err = client.CancelDatarangeUpload(ctx, &datas3tclient.CancelUploadRequest{DatarangeUploadID: upload.DatarangeID})
+		Expect(err).NotTo(HaveOccurred())
+
+		leases, err = client.ListDatarangeUploadLeases(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leases).To(BeEmpty())
+
+		// Step 4: An upload taking a lease releases it on completion
+		opts := datas3tclient.DefaultUploadOptions()
+		opts.LeaseDuration = 2 * time.Second
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		leases, err = client.ListDatarangeUploadLeases(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(leases).To(BeEmpty())
+
+		tarFile := filepath.Join(tempDir, "leased.tar")
+		tarData, _ = createTestTarWithIndex(10, 200)
+		err = os.WriteFile(tarFile, tarData, 0644)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = runCLICommand(cliPath, "upload-tar",
+			"--datas3t", testDatas3tName,
+			"--file", tarFile,
+			"--lease", "1m",
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(2))
+	})
+
+	It("should resume an interrupted multipart upload", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 1: Create a TAR file that is uploaded in 3 parts
+		var tarBuf bytes.Buffer
+		tw := tar.NewWriter(&tarBuf)
+		for i := 0; i < 3; i++ {
+			content := bytes.Repeat([]byte{byte('a' + i)}, 15*1024*1024)
+			err = tw.WriteHeader(&tar.Header{
+				Name: fmt.Sprintf("%020d.bin", i),
+				Size: int64(len(content)),
+				Mode: 0644,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			_, err = tw.Write(content)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+
+		tarFile := filepath.Join(tempDir, "resumable.tar")
+		err = os.WriteFile(tarFile, tarBuf.Bytes(), 0644)
+		Expect(err).NotTo(HaveOccurred())
+		stateFile := tarFile + ".upload-state.json"
+
+		// Step 2: Interrupt the upload once the first part is stored
+		uploadCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		opts := datas3tclient.DefaultUploadOptions()
+		opts.MaxParallelism = 1
+		opts.StateFile = stateFile
+		opts.ProgressCallback = func(info datas3tclient.ProgressInfo) {
+			if strings.HasPrefix(info.CurrentStep, "Uploading part") {
+				cancel()
+			}
+		}
+
+		err = client.UploadDataRangeFile(uploadCtx, testDatas3tName, bytes.NewReader(tarBuf.Bytes()), int64(tarBuf.Len()), opts)
+		Expect(err).To(HaveOccurred())
+
+		state, err := os.ReadFile(stateFile)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(state)).To(ContainSubstring(`"1":`))
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(BeEmpty())
+
+		// Step 3: The CLI refuses to start over while the state file exists
+		err = runCLICommand(cliPath, "upload-tar",
+			"--datas3t", testDatas3tName,
+			"--file", tarFile,
+		)
+		Expect(err).To(HaveOccurred())
+
+		// Step 4: Resuming uploads only the missing parts and completes the upload
+		err = runCLICommand(cliPath, "upload-tar",
+			"--datas3t", testDatas3tName,
+			"--file", tarFile,
+			"--resume",
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = os.Stat(stateFile)
+		Expect(os.IsNotExist(err)).To(BeTrue())
+
+		dataranges, err = client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(1))
+		Expect(dataranges[0].SizeBytes).To(Equal(int64(tarBuf.Len())))
+
+		// Step 5: The assembled datarange contains all datapoints
+		downloadedTar := filepath.Join(tempDir, "resumed.tar")
+		err = runCLICommand(cliPath, "datarange", "download-tar",
+			"--datas3t", testDatas3tName,
+			"--first-datapoint", "0",
+			"--last-datapoint", "2",
+			"--output", downloadedTar,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		downloaded, err := os.ReadFile(downloadedTar)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bytes.Equal(downloaded[:tarBuf.Len()-1024], tarBuf.Bytes()[:tarBuf.Len()-1024])).To(BeTrue())
+	})
+
+	It("should refresh presigned URLs once they have expired", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 1: Let the upload URLs expire before the data is uploaded
+		tarData, _ := createTestTarWithIndex(10, 0)
+
+		opts := datas3tclient.DefaultUploadOptions()
+		opts.PresignExpiry = time.Second
+		opts.ProgressCallback = func(info datas3tclient.ProgressInfo) {
+			if info.CurrentStep == "Uploading data" {
+				time.Sleep(2 * time.Second)
+			}
+		}
+
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(1))
+
+		// Step 2: Expired download URLs are rejected by S3 and can be re-presigned
+		presigned, err := client.PreSignDownloadForDatapoints(ctx, &datas3tclient.PreSignDownloadForDatapointsRequest{
+			Datas3tName:          testDatas3tName,
+			FirstDatapoint:       0,
+			LastDatapoint:        9,
+			PresignExpirySeconds: 1,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(presigned.DownloadSegments).To(HaveLen(1))
+
+		time.Sleep(2 * time.Second)
+
+		getSegment := func(segment datas3tclient.DownloadSegment) int {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, segment.PresignedURL, nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Range", segment.Range)
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		Expect(getSegment(presigned.DownloadSegments[0])).To(Equal(http.StatusForbidden))
+
+		refreshed, err := client.RefreshDownloadSegments(ctx, &datas3tclient.RefreshDownloadSegmentsRequest{
+			Datas3tName: testDatas3tName,
+			Segments:    presigned.DownloadSegments,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(refreshed.DownloadSegments).To(HaveLen(1))
+		Expect(refreshed.DownloadSegments[0].Range).To(Equal(presigned.DownloadSegments[0].Range))
+		Expect(getSegment(refreshed.DownloadSegments[0])).To(Equal(http.StatusPartialContent))
+	})
+
+	It("should upload the files of a directory", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		writeFile := func(path string, content string) {
+			err := os.MkdirAll(filepath.Dir(path), 0755)
+			Expect(err).NotTo(HaveOccurred())
+			err = os.WriteFile(path, []byte(content), 0644)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// Step 1: Named files take their keys from the names, a gap starts a new datarange
+		namedDir := filepath.Join(tempDir, "named")
+		for _, key := range []int{0, 1, 2, 3, 4, 10, 11} {
+			dir := namedDir
+			if key >= 10 {
+				dir = filepath.Join(namedDir, "later")
+			}
+			writeFile(filepath.Join(dir, fmt.Sprintf("%020d.txt", key)), fmt.Sprintf("named %d", key))
+		}
+
+		var uploadedRanges [][2]uint64
+		opts := datas3tclient.DefaultUploadDirOptions()
+		opts.OnDatarangeUploaded = func(first, last uint64) {
+			uploadedRanges = append(uploadedRanges, [2]uint64{first, last})
+		}
+
+		files, err := client.UploadDir(ctx, testDatas3tName, namedDir, opts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(7))
+		Expect(files[5]).To(Equal(datas3tclient.UploadedFile{
+			Path: "later/00000000000000000010.txt",
+			Key:  10,
+			Name: "00000000000000000010.txt",
+		}))
+		Expect(uploadedRanges).To(Equal([][2]uint64{{0, 4}, {10, 11}}))
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(2))
+
+		// Step 2: Arbitrarily named files are rejected unless keys are assigned
+		arbitraryDir := filepath.Join(tempDir, "arbitrary")
+		names := []string{"b/report.json", "a.csv", "c", "b/image.png", "d.txt"}
+		for _, name := range names {
+			writeFile(filepath.Join(arbitraryDir, name), strings.Repeat(name, 200))
+		}
+
+		_, err = client.UploadDir(ctx, testDatas3tName, arbitraryDir, nil)
+		Expect(err).To(MatchError(datas3tclient.ErrValidationFailed))
+
+		// Step 3: The CLI assigns keys in sorted path order and splits by size
+		mappingFile := filepath.Join(tempDir, "mapping.json")
+		err = runCLICommand(cliPath, "upload-dir",
+			"--datas3t", testDatas3tName,
+			"--dir", arbitraryDir,
+			"--assign-keys",
+			"--first-datapoint", "100",
+			"--max-datarange-size", "6000",
+			"--mapping-report", mappingFile,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		mappingData, err := os.ReadFile(mappingFile)
+		Expect(err).NotTo(HaveOccurred())
+
+		var mapping []datas3tclient.UploadedFile
+		err = json.Unmarshal(mappingData, &mapping)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(mapping).To(Equal([]datas3tclient.UploadedFile{
+			{Path: "a.csv", Key: 100, Name: "00000000000000000100.csv"},
+			{Path: "b/image.png", Key: 101, Name: "00000000000000000101.png"},
+			{Path: "b/report.json", Key: 102, Name: "00000000000000000102.json"},
+			{Path: "c", Key: 103, Name: "00000000000000000103.bin"},
+			{Path: "d.txt", Key: 104, Name: "00000000000000000104.txt"},
+		}))
+
+		dataranges, err = client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(5))
+
+		// Step 4: The datapoints hold the content of the files
+		var contents []string
+		for content, err := range client.DatapointIterator(ctx, testDatas3tName, 100, 104) {
+			Expect(err).NotTo(HaveOccurred())
+			contents = append(contents, string(content))
+		}
+		Expect(contents).To(Equal([]string{
+			strings.Repeat("a.csv", 200),
+			strings.Repeat("b/image.png", 200),
+			strings.Repeat("b/report.json", 200),
+			strings.Repeat("c", 200),
+			strings.Repeat("d.txt", 200),
+		}))
+
+		key := 0
+		for content, err := range client.DatapointIterator(ctx, testDatas3tName, 0, 11) {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(fmt.Sprintf("named %d", key)))
+			key++
+			if key == 5 {
+				key = 10
+			}
+		}
+		Expect(key).To(Equal(12))
+	})
+
+	It("should upload TAR archives of unknown size from a stream", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		contentOf := func(key int) []byte {
+			return bytes.Repeat([]byte(fmt.Sprintf("%08d", key)), 128*1024) // 1MB
+		}
+
+		buildTar := func(firstKey, numFiles int) []byte {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			for key := firstKey; key < firstKey+numFiles; key++ {
+				content := contentOf(key)
+				err := tw.WriteHeader(&tar.Header{
+					Name: fmt.Sprintf("%020d.bin", key),
+					Size: int64(len(content)),
+					Mode: 0644,
+				})
+				Expect(err).NotTo(HaveOccurred())
+				_, err = tw.Write(content)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(tw.Close()).To(Succeed())
+			return buf.Bytes()
+		}
+
+		// Step 1: The client uploads a stream in several parts
+		tarData := buildTar(0, 12)
+		pr, pw := io.Pipe()
+		go func() {
+			_, err := pw.Write(tarData)
+			pw.CloseWithError(err)
+		}()
+
+		opts := datas3tclient.DefaultUploadOptions()
+		opts.StreamPartSize = datas3tclient.MinStreamPartSize
+		err = client.UploadDataRangeStream(ctx, testDatas3tName, pr, opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 2: The CLI reads stdin, ignoring the record padding written by tar
+		stdinTar := buildTar(12, 3)
+		stdinTar = append(stdinTar, make([]byte, 10240-len(stdinTar)%10240)...)
+
+		cmd := exec.Command(cliPath, "upload-tar", "--datas3t", testDatas3tName, "-")
+		cmd.Stdin = bytes.NewReader(stdinTar)
+		cmd.Stdout = GinkgoWriter
+		cmd.Stderr = GinkgoWriter
+		Expect(cmd.Run()).To(Succeed())
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(2))
+
+		key := 0
+		for content, err := range client.DatapointIterator(ctx, testDatas3tName, 0, 14) {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(content).To(Equal(contentOf(key)))
+			key++
+		}
+		Expect(key).To(Equal(15))
+
+		// Step 3: A stream with a gap in its keys is rejected and the upload cancelled
+		var gapBuf bytes.Buffer
+		tw := tar.NewWriter(&gapBuf)
+		for _, key := range []int{20, 22} {
+			content := contentOf(key)
+			Expect(tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("%020d.bin", key), Size: int64(len(content)), Mode: 0644})).To(Succeed())
+			_, err = tw.Write(content)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+
+		err = client.UploadDataRangeStream(ctx, testDatas3tName, bytes.NewReader(gapBuf.Bytes()), nil)
+		Expect(err).To(MatchError(ContainSubstring("gap in datapoint sequence")))
+
+		dataranges, err = client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(2))
+	})
+
+	It("should upload TAR archives through the server", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 1: The client sends a file to the server instead of S3
+		tarData, _ := createTestTarWithIndex(10, 0)
+
+		opts := datas3tclient.DefaultUploadOptions()
+		opts.ProxyThroughServer = true
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 2: The CLI sends stdin to the server
+		stdinTar, _ := createTestTarWithIndex(10, 10)
+
+		cmd := exec.Command(cliPath, "upload-tar", "--datas3t", testDatas3tName, "--proxy", "-")
+		cmd.Stdin = bytes.NewReader(stdinTar)
+		cmd.Stdout = GinkgoWriter
+		cmd.Stderr = GinkgoWriter
+		Expect(cmd.Run()).To(Succeed())
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(2))
+
+		key := 0
+		for _, err := range client.DatapointIterator(ctx, testDatas3tName, 0, 19) {
+			Expect(err).NotTo(HaveOccurred())
+			key++
+		}
+		Expect(key).To(Equal(20))
+
+		// Step 3: An archive that is not a valid TAR archive is rejected
+		_, err = client.ProxyUploadDatarange(ctx, testDatas3tName, bytes.NewReader(bytes.Repeat([]byte("x"), 2048)), 2048)
+		Expect(err).To(MatchError(datas3tclient.ErrValidationFailed))
+
+		// Step 4: Options that need an upload to S3 are rejected
+		opts.StateFile = filepath.Join(tempDir, "state.json")
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), opts)
+		Expect(err).To(MatchError(datas3tclient.ErrValidationFailed))
+	})
+
+	It("should replace dataranges atomically", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, first := range []int64{0, 10} {
+			tarData, _ := createTestTarWithIndex(10, first)
+			err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), nil)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// Step 1: Both dataranges are replaced by corrected datapoints in one swap
+		var corrected bytes.Buffer
+		tw := tar.NewWriter(&corrected)
+		for i := range 20 {
+			content := []byte(fmt.Sprintf("corrected %d", i))
+			Expect(tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("fixed_%d.txt", i), Size: int64(len(content)), Mode: 0644})).To(Succeed())
+			_, err = tw.Write(content)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+
+		opts := datas3tclient.DefaultUploadOptions()
+		opts.AssignKeys = true
+		opts.Replace = true
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(corrected.Bytes()), int64(corrected.Len()), opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(1))
+		Expect(dataranges[0].MinDatapointKey).To(Equal(int64(0)))
+		Expect(dataranges[0].MaxDatapointKey).To(Equal(int64(19)))
+
+		key := 0
+		for content, err := range client.DatapointIterator(ctx, testDatas3tName, 0, 19) {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(Equal(fmt.Sprintf("corrected %d", key)))
+			key++
+		}
+		Expect(key).To(Equal(20))
+
+		// Step 2: The CLI replaces the exact range of the datarange
+		tarData, _ := createTestTarWithIndex(20, 0)
+		tarPath := filepath.Join(tempDir, "replacement.tar")
+		Expect(os.WriteFile(tarPath, tarData, 0644)).To(Succeed())
+
+		err = runCLICommand(cliPath, "upload-tar", "--datas3t", testDatas3tName, "--file", tarPath, "--replace")
+		Expect(err).NotTo(HaveOccurred())
+
+		key = 0
+		for content, err := range client.DatapointIterator(ctx, testDatas3tName, 0, 19) {
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(content)).To(HavePrefix(fmt.Sprintf("Content of file %d - ", key)))
+			key++
+		}
+		Expect(key).To(Equal(20))
+
+		// Step 3: A range that is not fully covered by existing dataranges cannot be replaced
+		tarData, _ = createTestTarWithIndex(25, 0)
+		opts = datas3tclient.DefaultUploadOptions()
+		opts.Replace = true
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), opts)
+		Expect(err).To(MatchError(datas3tclient.ErrRangeNotFullyCovered))
+
+		dataranges, err = client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(1))
+	})
+
+	It("should upload TAR archives with arbitrary file names under assigned keys", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// The long name needs a PAX header spanning several blocks
+		longName := "images/" + strings.Repeat("long_name_", 20) + ".png"
+		names := []string{"images/cat_001.jpg", longName, "README"}
+
+		createTar := func() []byte {
+			var buf bytes.Buffer
+			tw := tar.NewWriter(&buf)
+			Expect(tw.WriteHeader(&tar.Header{Name: "images/", Typeflag: tar.TypeDir, Mode: 0755})).To(Succeed())
+			for _, name := range names {
+				content := []byte("content of " + name)
+				Expect(tw.WriteHeader(&tar.Header{Name: name, Size: int64(len(content)), Mode: 0644, Typeflag: tar.TypeReg})).To(Succeed())
+				_, err := tw.Write(content)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(tw.Close()).To(Succeed())
+			return buf.Bytes()
+		}
+
+		downloadHeaders := func(first, last uint64) map[string]string {
+			outputPath := filepath.Join(tempDir, fmt.Sprintf("download-%d.tar", first))
+			Expect(client.DownloadDatapointsTar(ctx, testDatas3tName, first, last, outputPath)).To(Succeed())
+
+			downloaded, err := os.ReadFile(outputPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			originalNames := map[string]string{}
+			tr := tar.NewReader(bytes.NewReader(downloaded))
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				Expect(err).NotTo(HaveOccurred())
+
+				content, err := io.ReadAll(tr)
+				Expect(err).NotTo(HaveOccurred())
+
+				originalName := header.PAXRecords[datas3tclient.OriginalNamePAXRecord]
+				Expect(string(content)).To(Equal("content of " + originalName))
+				originalNames[header.Name] = originalName
+			}
+			return originalNames
+		}
+
+		// Step 1: The files are numbered in archive order, directories are skipped
+		tarData := createTar()
+		opts := datas3tclient.DefaultUploadOptions()
+		opts.AssignKeys = true
+		opts.FirstDatapoint = 100
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), opts)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(downloadHeaders(100, 102)).To(Equal(map[string]string{
+			"00000000000000000100.jpg": "images/cat_001.jpg",
+			"00000000000000000101.png": longName,
+			"00000000000000000102.bin": "README",
+		}))
+
+		// Step 2: The CLI takes the keys from a mapping file
+		tarPath := filepath.Join(tempDir, "named.tar")
+		Expect(os.WriteFile(tarPath, tarData, 0644)).To(Succeed())
+
+		mapping, err := json.Marshal(map[string]uint64{"images/cat_001.jpg": 105, longName: 104, "README": 103})
+		Expect(err).NotTo(HaveOccurred())
+		mappingPath := filepath.Join(tempDir, "mapping.json")
+		Expect(os.WriteFile(mappingPath, mapping, 0644)).To(Succeed())
+
+		err = runCLICommand(cliPath, "upload-tar", "--datas3t", testDatas3tName, "--file", tarPath, "--key-mapping", mappingPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(downloadHeaders(103, 105)).To(Equal(map[string]string{
+			"00000000000000000103.bin": "README",
+			"00000000000000000104.png": longName,
+			"00000000000000000105.jpg": "images/cat_001.jpg",
+		}))
+
+		// Step 3: Every file of the archive needs a mapped key
+		opts = datas3tclient.DefaultUploadOptions()
+		opts.KeyMapping = map[string]uint64{"README": 106}
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), opts)
+		Expect(err).To(MatchError(ContainSubstring("no datapoint key mapped")))
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(2))
+	})
+
+	It("should store dataranges in a local directory", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		// Step 1: A bucket is a directory below the directory of a file:// endpoint
+		storageDir := filepath.Join(tempDir, "storage")
+		Expect(os.MkdirAll(storageDir, 0o755)).To(Succeed())
+
+		err := client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:     testBucketConfigName,
+			Endpoint: "file://" + storageDir,
+			Bucket:   "local-bucket",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:     "relative-local-bucket",
+			Endpoint: "file://relative/path",
+			Bucket:   "local-bucket",
+		})
+		Expect(err).To(MatchError(datas3tclient.ErrValidationFailed))
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:   testDatas3tName,
+			Bucket: testBucketConfigName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 2: Uploads go to the server through presigned URLs, directly and in parts
+		tarData, _ := createTestTarWithIndex(10, 0)
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), datas3tclient.DefaultUploadOptions())
+		Expect(err).NotTo(HaveOccurred())
+
+		streamTar, _ := createTestTarWithIndex(10, 10)
+		err = client.UploadDataRangeStream(ctx, testDatas3tName, bytes.NewReader(streamTar), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		objects, err := filepath.Glob(filepath.Join(storageDir, "local-bucket", "datas3t", testDatas3tName, "dataranges", "*.tar"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(objects).To(HaveLen(2))
+
+		// Step 3: Downloads are served by the server
+		key := 0
+		for _, err := range client.DatapointIterator(ctx, testDatas3tName, 0, 19) {
+			Expect(err).NotTo(HaveOccurred())
+			key++
+		}
+		Expect(key).To(Equal(20))
+
+		outputPath := filepath.Join(tempDir, "local.tar")
+		err = client.DownloadDatapointsTar(ctx, testDatas3tName, 5, 14, outputPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Step 4: Aggregation replaces the dataranges and their objects are deleted
+		err = client.AggregateDataRanges(ctx, testDatas3tName, 0, 19, datas3tclient.DefaultAggregateOptions())
+		Expect(err).NotTo(HaveOccurred())
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(1))
+
+		Eventually(func() ([]string, error) {
+			return filepath.Glob(filepath.Join(storageDir, "local-bucket", "datas3t", testDatas3tName, "dataranges", "*.tar"))
+		}, 30*time.Second, time.Second).Should(HaveLen(1))
+
+		// Step 5: Objects placed in the directory are imported
+		datarangesDir := filepath.Join(storageDir, "local-bucket", "datas3t", testDatas3tName, "dataranges")
+		copiedDir := filepath.Join(storageDir, "local-bucket", "datas3t", "copied-datas3t", "dataranges")
+		Expect(os.MkdirAll(copiedDir, 0o755)).To(Succeed())
+
+		entries, err := os.ReadDir(datarangesDir)
+		Expect(err).NotTo(HaveOccurred())
+		for _, entry := range entries {
+			data, err := os.ReadFile(filepath.Join(datarangesDir, entry.Name()))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(os.WriteFile(filepath.Join(copiedDir, entry.Name()), data, 0o644)).To(Succeed())
+		}
+
+		imported, err := client.ImportDatas3t(ctx, &datas3tclient.ImportDatas3tRequest{BucketName: testBucketConfigName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imported.ImportedDatas3ts).To(ConsistOf("copied-datas3t"))
+
+		key = 0
+		for _, err := range client.DatapointIterator(ctx, "copied-datas3t", 0, 19) {
+			Expect(err).NotTo(HaveOccurred())
+			key++
+		}
+		Expect(key).To(Equal(20))
+
+		// Step 6: Readiness checks reach local buckets
+		report, err := client.CheckReadiness(ctx, true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(report.Ready).To(BeTrue())
+	})
+
+	It("should update, test and delete bucket configurations using CLI", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		// Step 1: Add the bucket configuration and check its permissions
+		err := runCLICommand(cliPath, "bucket", "add",
+			"--name", testBucketConfigName,
+			"--endpoint", "http://"+minioEndpoint,
+			"--bucket", testBucketName,
+			"--access-key", minioAccessKey,
+			"--secret-key", minioSecretKey,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		cmd := exec.Command(cliPath, "bucket", "test", "--name", testBucketConfigName)
+		cmd.Env = append(os.Environ(), "DATAS3T_SERVER_URL="+serverBaseURL)
+		output, err := cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(output))
+		for _, permission := range []string{"list", "write", "read", "delete"} {
+			Expect(string(output)).To(MatchRegexp(`%s\s+OK`, permission))
+		}
+
+		// The probe object is removed again
+		minioClient, err := miniogo.New(minioHost, &miniogo.Options{
+			Creds:  miniocreds.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+			Secure: false,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		objects := minioClient.ListObjects(ctx, testBucketName, miniogo.ListObjectsOptions{Prefix: "datas3t-bucket-test/", Recursive: true})
+		for object := range objects {
+			Expect(object.Err).NotTo(HaveOccurred())
+			Fail("probe object was left in the bucket: " + object.Key)
+		}
+
+		// Step 2: Updates that fail the connection test are not stored
+		wrongSecret := "wrong-secret-key"
+		_, err = client.UpdateBucket(ctx, &datas3tclient.UpdateBucketRequest{
+			Name:      testBucketConfigName,
+			SecretKey: &wrongSecret,
+		})
+		Expect(err).To(MatchError(datas3tclient.ErrValidationFailed))
+
+		result, err := client.TestBucket(ctx, &datas3tclient.TestBucketRequest{Name: testBucketConfigName})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.OK).To(BeTrue())
+
+		// Step 3: Rotate the credentials and change the region, other settings are kept
+		err = runCLICommand(cliPath, "bucket", "update",
+			"--name", testBucketConfigName,
+			"--access-key", minioAccessKey,
+			"--secret-key", minioSecretKey,
+			"--region", "us-east-1",
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		buckets, err := client.ListBuckets(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buckets).To(HaveLen(1))
+		Expect(buckets[0].Region).To(Equal("us-east-1"))
+		Expect(buckets[0].Endpoint).To(Equal("http://" + minioEndpoint))
+		Expect(buckets[0].AddressingStyle).To(Equal("path"))
+
+		err = runCLICommand(cliPath, "bucket", "update", "--name", testBucketConfigName)
+		Expect(err).To(HaveOccurred())
+
+		region := "us-east-1"
+		_, err = client.UpdateBucket(ctx, &datas3tclient.UpdateBucketRequest{Name: "non-existent-bucket", Region: &region})
+		Expect(err).To(MatchError(datas3tclient.ErrBucketNotFound))
+
+		// Step 4: Buckets used by datas3ts cannot be deleted
+		err = runCLICommand(cliPath, "add",
+			"--name", testDatas3tName,
+			"--bucket", testBucketConfigName,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = runCLICommand(cliPath, "bucket", "delete", "--name", testBucketConfigName, "--force")
+		Expect(err).To(HaveOccurred())
+
+		_, err = client.DeleteBucket(ctx, &datas3tclient.DeleteBucketRequest{Name: testBucketConfigName})
+		Expect(err).To(MatchError(datas3tclient.ErrBucketInUse))
+
+		// Step 5: Once the datas3t is deleted, so can be the bucket
+		_, err = client.DeleteDatas3t(ctx, &datas3tclient.DeleteDatas3tRequest{Name: testDatas3tName})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = runCLICommand(cliPath, "bucket", "delete", "--name", testBucketConfigName, "--force")
+		Expect(err).NotTo(HaveOccurred())
+
+		buckets, err = client.ListBuckets(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buckets).To(BeEmpty())
+
+		_, err = client.TestBucket(ctx, &datas3tclient.TestBucketRequest{Name: testBucketConfigName})
+		Expect(err).To(MatchError(datas3tclient.ErrBucketNotFound))
+
+		_, err = client.DeleteBucket(ctx, &datas3tclient.DeleteBucketRequest{Name: testBucketConfigName})
+		Expect(err).To(MatchError(datas3tclient.ErrBucketNotFound))
+	})
+
+	It("should share one bucket between key prefixes", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		// Step 1: Configure the bucket twice, under different key prefixes
+		for _, tenant := range []string{"tenant-a", "tenant-b"} {
+			err := runCLICommand(cliPath, "bucket", "add",
+				"--name", tenant+"-config",
+				"--endpoint", "http://"+minioEndpoint,
+				"--bucket", testBucketName,
+				"--access-key", minioAccessKey,
+				"--secret-key", minioSecretKey,
+				"--key-prefix", tenant,
+			)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+				Name:   tenant + "-datas3t",
+				Bucket: tenant + "-config",
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		buckets, err := client.ListBuckets(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(buckets).To(HaveLen(2))
+		Expect(buckets[0].KeyPrefix).To(Equal("tenant-a/"))
+
+		// Step 2: Uploads and aggregates store their objects below the key prefix
+		for i := 0; i < 2; i++ {
+			tarData, _ := createTestTarWithIndex(10, int64(i*10))
+			err = client.UploadDataRangeFile(ctx, "tenant-a-datas3t", bytes.NewReader(tarData), int64(len(tarData)), nil)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		tarData, _ := createTestTarWithIndex(10, 0)
+		err = client.UploadDataRangeFile(ctx, "tenant-b-datas3t", bytes.NewReader(tarData), int64(len(tarData)), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AggregateDataRanges(ctx, "tenant-a-datas3t", 0, 19, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		minioClient, err := miniogo.New(minioHost, &miniogo.Options{
+			Creds:  miniocreds.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+			Secure: false,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		listKeys := func(prefix, suffix string) []string {
+			keys := []string{}
+			for object := range minioClient.ListObjects(ctx, testBucketName, miniogo.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+				Expect(object.Err).NotTo(HaveOccurred())
+				if strings.HasSuffix(object.Key, suffix) {
+					keys = append(keys, object.Key)
+				}
+			}
+			return keys
+		}
+
+		Expect(listKeys("datas3t/", "")).To(BeEmpty())
+		Expect(listKeys("tenant-b/datas3t/tenant-b-datas3t/dataranges/", ".tar")).To(HaveLen(1))
+
+		// The data and index objects of the aggregated dataranges are deleted below the key prefix
+		Eventually(func() []string {
+			return listKeys("tenant-a/datas3t/tenant-a-datas3t/dataranges/", "")
+		}, 30*time.Second, time.Second).Should(HaveLen(2))
+
+		// Step 3: Downloads read the objects below the key prefix
+		key := 0
+		for _, err := range client.DatapointIterator(ctx, "tenant-a-datas3t", 0, 19) {
+			Expect(err).NotTo(HaveOccurred())
+			key++
+		}
+		Expect(key).To(Equal(20))
+
+		// Step 4: Importing a key prefix only finds the datas3ts below it
+		_, err = client.ClearDatas3t(ctx, &datas3tclient.ClearDatas3tRequest{Name: "tenant-b-datas3t"})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = client.DeleteDatas3t(ctx, &datas3tclient.DeleteDatas3tRequest{Name: "tenant-b-datas3t"})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Copy the objects of tenant-a below the key prefix of tenant-b
+		for object := range minioClient.ListObjects(ctx, testBucketName, miniogo.ListObjectsOptions{Prefix: "tenant-a/datas3t/tenant-a-datas3t/dataranges/", Recursive: true}) {
+			Expect(object.Err).NotTo(HaveOccurred())
+			_, err = minioClient.CopyObject(ctx,
+				miniogo.CopyDestOptions{Bucket: testBucketName, Object: strings.Replace(object.Key, "tenant-a/datas3t/tenant-a-datas3t/", "tenant-b/datas3t/tenant-b-imported/", 1)},
+				miniogo.CopySrcOptions{Bucket: testBucketName, Object: object.Key},
+			)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		imported, err := client.ImportDatas3t(ctx, &datas3tclient.ImportDatas3tRequest{BucketName: "tenant-b-config"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(imported.ImportedDatas3ts).To(ConsistOf("tenant-b-imported"))
+
+		// Step 5: The key prefix cannot change while datas3ts use the bucket
+		err = runCLICommand(cliPath, "bucket", "update", "--name", "tenant-b-config", "--key-prefix", "tenant-c")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("should encrypt the content of datapoints on the client", func(ctx SpecContext) {
+		client := datas3tclient.NewClient(serverBaseURL)
+
+		keyBytes := make([]byte, 32)
+		_, err := rand.Read(keyBytes)
+		Expect(err).NotTo(HaveOccurred())
+		dataEncryptionKey := base64.StdEncoding.EncodeToString(keyBytes)
+
+		Expect(client.SetDataEncryptionKey(dataEncryptionKey)).To(Succeed())
+
+		err = client.AddBucket(ctx, &datas3tclient.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  "http://" + minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = client.AddDatas3t(ctx, &datas3tclient.AddDatas3tRequest{
+			Name:      testDatas3tName,
+			Bucket:    testBucketConfigName,
+			Encrypted: true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		datas3ts, err := client.ListDatas3ts(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(datas3ts).To(HaveLen(1))
+		Expect(datas3ts[0].Encrypted).To(BeTrue())
+
+		// Step 1: Files, streams and the datapoint writer encrypt the content they upload
+		tarData, _ := createTestTarWithIndex(10, 0)
+		err = client.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(tarData), int64(len(tarData)), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		streamData, _ := createTestTarWithIndex(10, 10)
+		err = client.UploadDataRangeStream(ctx, testDatas3tName, bytes.NewReader(streamData), nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		writer, err := client.NewDatapointWriter(ctx, testDatas3tName, &datas3tclient.DatapointWriterOptions{
+			TempDir: tempDir,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		for key := uint64(20); key < 30; key++ {
+			Expect(writer.WriteDatapoint(key, "txt", []byte(fmt.Sprintf("Content of file %d - written", key)))).To(Succeed())
+		}
+		Expect(writer.Close()).To(Succeed())
+
+		tarFile := filepath.Join(tempDir, "encrypted.tar")
+		cliData, _ := createTestTarWithIndex(10, 30)
+		Expect(os.WriteFile(tarFile, cliData, 0644)).To(Succeed())
+
+		err = runCLICommand(cliPath, "upload-tar",
+			"--datas3t", testDatas3tName,
+			"--file", tarFile,
+			"--data-encryption-key", dataEncryptionKey,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		dataranges, err := client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(4))
+
+		// Step 2: The bucket only holds encrypted content
+		download, err := client.PreSignDownloadForDatapoints(ctx, &datas3tclient.PreSignDownloadForDatapointsRequest{
+			Datas3tName:    testDatas3tName,
+			FirstDatapoint: 0,
+			LastDatapoint:  39,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		for _, segment := range download.DownloadSegments {
+			Expect(segment.WrappedDataKey).NotTo(BeEmpty())
+
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, segment.PresignedURL, nil)
+			Expect(err).NotTo(HaveOccurred())
+			req.Header.Set("Range", segment.Range)
+
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).NotTo(HaveOccurred())
+			stored, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(stored)).NotTo(ContainSubstring("Content of file"))
+		}
+
+		// Step 3: Downloads decrypt the content transparently, also after aggregation
+		expectDecrypted := func() {
+			key := 0
+			for content, err := range client.DatapointIterator(ctx, testDatas3tName, 0, 39) {
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(HavePrefix(fmt.Sprintf("Content of file %d - ", key)))
+				key++
+			}
+			Expect(key).To(Equal(40))
+		}
+
+		expectDecrypted()
+
+		err = client.AggregateDataRanges(ctx, testDatas3tName, 0, 39, &datas3tclient.AggregateOptions{TempDir: tempDir})
+		Expect(err).NotTo(HaveOccurred())
+
+		dataranges, err = client.ListDataranges(ctx, testDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataranges).To(HaveLen(1))
+
+		expectDecrypted()
+
+		downloadedTar := filepath.Join(tempDir, "decrypted.tar")
+		err = runCLICommand(cliPath, "datarange", "download-tar",
+			"--datas3t", testDatas3tName,
+			"--first-datapoint", "5",
+			"--last-datapoint", "14",
+			"--output", downloadedTar,
+			"--data-encryption-key", dataEncryptionKey,
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		downloaded, err := os.ReadFile(downloadedTar)
+		Expect(err).NotTo(HaveOccurred())
+
+		files := map[string][]byte{}
+		Expect(extractFilesFromTar(downloaded, files)).To(Succeed())
+		Expect(files).To(HaveLen(10))
+		Expect(string(files[fmt.Sprintf("%020d.txt", 5)])).To(HavePrefix("Content of file 5 - "))
+
+		// Step 4: Clients without the key can neither upload nor read datapoints
+		keyless := datas3tclient.NewClient(serverBaseURL)
+
+		moreData, _ := createTestTarWithIndex(10, 40)
+		err = keyless.UploadDataRangeFile(ctx, testDatas3tName, bytes.NewReader(moreData), int64(len(moreData)), nil)
+		Expect(err).To(MatchError(datas3tclient.ErrValidationFailed))
+
+		for _, err := range keyless.DatapointIterator(ctx, testDatas3tName, 0, 0) {
+			Expect(err).To(MatchError(datas3tclient.ErrDataEncryptionKeyRequired))
+		}
+	})
 })
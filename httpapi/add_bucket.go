@@ -2,9 +2,9 @@ package httpapi
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/server/bucket"
 )
 
@@ -12,19 +12,13 @@ func (a *api) addBucket(w http.ResponseWriter, r *http.Request) {
 	var req bucket.BucketInfo
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
 		return
 	}
 
 	err = a.s.AddBucket(r.Context(), a.log, &req)
 	if err != nil {
-		var validationErr bucket.ValidationError
-		if errors.As(err, &validationErr) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/server/dataranges"
 )
 
@@ -11,13 +12,13 @@ func (a *api) cancelDatarangeUpload(w http.ResponseWriter, r *http.Request) {
 	req := &dataranges.CancelUploadRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
 		return
 	}
 
 	err = a.s.CancelDatarangeUpload(r.Context(), a.log, req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 
@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/dataranges"
+)
+
+func (a *api) renewDatarangeUploadLease(w http.ResponseWriter, r *http.Request) {
+	req := &dataranges.RenewLeaseRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	resp, err := a.s.RenewDatarangeUploadLease(r.Context(), a.log, req)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (a *api) listDatarangeUploadLeases(w http.ResponseWriter, r *http.Request) {
+	req := &dataranges.ListLeasesRequest{
+		Datas3tName: r.URL.Query().Get("datas3t_name"),
+	}
+
+	resp, err := a.s.ListDatarangeLeases(r.Context(), a.log, req)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+}
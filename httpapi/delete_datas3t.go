@@ -2,10 +2,9 @@ package httpapi
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
-	"strings"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/server/datas3t"
 )
 
@@ -13,33 +12,13 @@ func (a *api) deleteDatas3t(w http.ResponseWriter, r *http.Request) {
 	var req datas3t.DeleteDatas3tRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		var validationErr datas3t.ValidationError
-		if errors.As(err, &validationErr) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
 		return
 	}
 
 	response, err := a.s.DeleteDatas3t(r.Context(), a.log, &req)
 	if err != nil {
-		var validationErr datas3t.ValidationError
-		if errors.As(err, &validationErr) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		// Check if error is about non-empty datas3t
-		if strings.Contains(err.Error(), "cannot delete datas3t") && strings.Contains(err.Error(), "contains") {
-			http.Error(w, err.Error(), http.StatusConflict)
-			return
-		}
-		// Check if datas3t doesn't exist
-		if strings.Contains(err.Error(), "does not exist") {
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 
@@ -0,0 +1,36 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+)
+
+// writeError responds with the JSON error envelope. The code, and with it the HTTP
+// status, is taken from the first *apierror.Error in the chain; any other error is
+// reported as an internal error.
+func (a *api) writeError(w http.ResponseWriter, err error) {
+	code := apierror.CodeInternal
+
+	var apiErr *apierror.Error
+	if errors.As(err, &apiErr) {
+		code = apiErr.Code
+	}
+
+	a.writeErrorCode(w, code, err.Error())
+}
+
+func (a *api) writeErrorCode(w http.ResponseWriter, code apierror.Code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code.HTTPStatus())
+
+	err := json.NewEncoder(w).Encode(apierror.Response{
+		Error: &apierror.Error{Code: code, Message: message},
+	})
+	if err != nil {
+		a.log.Error("Failed to write error response", "error", err)
+	}
+}
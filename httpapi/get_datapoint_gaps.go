@@ -0,0 +1,29 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+)
+
+func (a *api) getDatapointGaps(w http.ResponseWriter, r *http.Request) {
+	datas3tName := r.URL.Query().Get("datas3t_name")
+	if datas3tName == "" {
+		a.writeErrorCode(w, apierror.CodeValidationFailed, "datas3t_name query parameter is required")
+		return
+	}
+
+	response, err := a.s.GetDatapointGaps(r.Context(), a.log, datas3tName)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+}
@@ -2,18 +2,20 @@ package httpapi
 
 import (
 	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
 )
 
 func (a *api) getDatapointsBitmap(w http.ResponseWriter, r *http.Request) {
 	datas3tName := r.URL.Query().Get("datas3t_name")
 	if datas3tName == "" {
-		http.Error(w, "datas3t_name query parameter is required", http.StatusBadRequest)
+		a.writeErrorCode(w, apierror.CodeValidationFailed, "datas3t_name query parameter is required")
 		return
 	}
 
 	bitmap, err := a.s.GetDatapointsBitmap(r.Context(), a.log, datas3tName)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 
@@ -23,7 +25,7 @@ func (a *api) getDatapointsBitmap(w http.ResponseWriter, r *http.Request) {
 	// Serialize bitmap to bytes
 	bitmapBytes, err := bitmap.ToBytes()
 	if err != nil {
-		http.Error(w, "failed to serialize bitmap", http.StatusInternalServerError)
+		a.writeErrorCode(w, apierror.CodeInternal, "failed to serialize bitmap")
 		return
 	}
 
@@ -0,0 +1,21 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+func (a *api) getVersion(w http.ResponseWriter, r *http.Request) {
+	info, err := a.s.GetVersion(r.Context(), a.log)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(info)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+}
@@ -0,0 +1,37 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/health"
+)
+
+func (a *api) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (a *api) readyz(w http.ResponseWriter, r *http.Request) {
+	req := &health.ReadinessRequest{}
+
+	checkBuckets := r.URL.Query().Get("check_buckets")
+	if checkBuckets != "" {
+		v, err := strconv.ParseBool(checkBuckets)
+		if err != nil {
+			a.writeErrorCode(w, apierror.CodeValidationFailed, "invalid check_buckets query parameter")
+			return
+		}
+		req.CheckBuckets = v
+	}
+
+	report := a.s.CheckReadiness(r.Context(), a.log, req)
+
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
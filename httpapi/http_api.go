@@ -21,23 +21,50 @@ func NewHTTPAPI(s *server.Server, log *slog.Logger) *http.ServeMux {
 	webHandler := webui.NewHandler(s, log)
 	mux.HandleFunc("GET /", webHandler.IndexPage)
 
+	// Probe routes
+	mux.HandleFunc("GET /healthz", a.healthz)
+	mux.HandleFunc("GET /readyz", a.readyz)
+
 	// API routes
+	mux.HandleFunc("GET /api/v1/openapi.json", a.getOpenAPISpec)
+	mux.HandleFunc("GET /api/v1/version", a.getVersion)
 	mux.HandleFunc("GET /api/v1/buckets", a.listBuckets)
 	mux.HandleFunc("POST /api/v1/buckets", a.addBucket)
+	mux.HandleFunc("PUT /api/v1/buckets", a.updateBucket)
+	mux.HandleFunc("DELETE /api/v1/buckets", a.deleteBucket)
+	mux.HandleFunc("POST /api/v1/buckets/test", a.testBucket)
 	mux.HandleFunc("GET /api/v1/datas3ts", a.listDatas3ts)
 	mux.HandleFunc("POST /api/v1/datas3ts", a.addDatas3t)
 	mux.HandleFunc("POST /api/v1/datas3ts/import", a.importDatas3t)
 	mux.HandleFunc("POST /api/v1/datas3ts/clear", a.clearDatas3t)
 	mux.HandleFunc("DELETE /api/v1/datas3ts", a.deleteDatas3t)
+	mux.HandleFunc("GET /api/v1/datas3ts/storage-class-rules", a.getStorageClassRules)
+	mux.HandleFunc("PUT /api/v1/datas3ts/storage-class-rules", a.setStorageClassRules)
+	mux.HandleFunc("GET /api/v1/datas3ts/replicas", a.listReplicas)
+	mux.HandleFunc("PUT /api/v1/datas3ts/replica", a.setReplica)
+	mux.HandleFunc("DELETE /api/v1/datas3ts/replica", a.removeReplica)
+	mux.HandleFunc("GET /api/v1/datas3ts/replica/status", a.getReplicationStatus)
 	mux.HandleFunc("POST /api/v1/upload-datarange", a.startDatarangeUpload)
 	mux.HandleFunc("POST /api/v1/upload-datarange/complete", a.completeDatarangeUpload)
 	mux.HandleFunc("POST /api/v1/upload-datarange/cancel", a.cancelDatarangeUpload)
+	mux.HandleFunc("POST /api/v1/upload-datarange/resume", a.resumeDatarangeUpload)
+	mux.HandleFunc("POST /api/v1/upload-datarange/presign-parts", a.presignDatarangeUploadParts)
+	mux.HandleFunc("POST /api/v1/upload-datarange/proxy", a.proxyDatarangeUpload)
+	mux.HandleFunc("POST /api/v1/upload-datarange/renew-lease", a.renewDatarangeUploadLease)
+	mux.HandleFunc("GET /api/v1/upload-datarange/leases", a.listDatarangeUploadLeases)
 	mux.HandleFunc("POST /api/v1/aggregate", a.startAggregate)
 	mux.HandleFunc("POST /api/v1/aggregate/complete", a.completeAggregate)
 	mux.HandleFunc("POST /api/v1/aggregate/cancel", a.cancelAggregate)
 	mux.HandleFunc("POST /api/v1/datarange/delete", a.deleteDatarange)
 	mux.HandleFunc("GET /api/v1/dataranges", a.listDataranges)
 	mux.HandleFunc("POST /api/v1/download", a.presignDownloadForDatapoints)
+	mux.HandleFunc("POST /api/v1/download/refresh", a.refreshDownloadSegments)
 	mux.HandleFunc("GET /api/v1/datapoints-bitmap", a.getDatapointsBitmap)
+	mux.HandleFunc("GET /api/v1/datapoint-gaps", a.getDatapointGaps)
+
+	// Presigned URLs of local buckets
+	mux.HandleFunc("GET /api/v1/local-storage/{key...}", a.localStorage)
+	mux.HandleFunc("PUT /api/v1/local-storage/{key...}", a.localStorage)
+	mux.HandleFunc("DELETE /api/v1/local-storage/{key...}", a.localStorage)
 	return mux
 }
@@ -2,9 +2,9 @@ package httpapi
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/server/datas3t"
 )
 
@@ -12,23 +12,13 @@ func (a *api) importDatas3t(w http.ResponseWriter, r *http.Request) {
 	var req datas3t.ImportDatas3tRequest
 	err := json.NewDecoder(r.Body).Decode(&req)
 	if err != nil {
-		var validationErr datas3t.ValidationError
-		if errors.As(err, &validationErr) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
 		return
 	}
 
 	response, err := a.s.ImportDatas3t(r.Context(), a.log, &req)
 	if err != nil {
-		var validationErr datas3t.ValidationError
-		if errors.As(err, &validationErr) {
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 
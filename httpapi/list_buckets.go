@@ -8,14 +8,14 @@ import (
 func (a *api) listBuckets(w http.ResponseWriter, r *http.Request) {
 	buckets, err := a.s.ListBuckets(r.Context(), a.log)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(buckets)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 }
@@ -2,32 +2,112 @@ package httpapi
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/server/dataranges"
 )
 
 func (a *api) listDataranges(w http.ResponseWriter, r *http.Request) {
-	datas3tName := r.URL.Query().Get("datas3t_name")
+	query := r.URL.Query()
+
+	datas3tName := query.Get("datas3t_name")
 	if datas3tName == "" {
-		http.Error(w, "datas3t_name query parameter is required", http.StatusBadRequest)
+		a.writeErrorCode(w, apierror.CodeValidationFailed, "datas3t_name query parameter is required")
 		return
 	}
 
-	req := &dataranges.ListDatarangesRequest{
-		Datas3tName: datas3tName,
+	req, err := parseListDatarangesQuery(query)
+	if err != nil {
+		a.writeErrorCode(w, apierror.CodeValidationFailed, err.Error())
+		return
 	}
 
 	response, err := a.s.ListDataranges(r.Context(), a.log, req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
-}
\ No newline at end of file
+}
+
+func parseListDatarangesQuery(query url.Values) (*dataranges.ListDatarangesRequest, error) {
+	req := &dataranges.ListDatarangesRequest{
+		Datas3tName: query.Get("datas3t_name"),
+		SortBy:      query.Get("sort_by"),
+		SortOrder:   query.Get("sort_order"),
+		Cursor:      query.Get("cursor"),
+	}
+
+	var err error
+
+	for name, target := range map[string]**int64{
+		"from_datapoint_key": &req.FromDatapointKey,
+		"to_datapoint_key":   &req.ToDatapointKey,
+		"min_size_bytes":     &req.MinSizeBytes,
+		"max_size_bytes":     &req.MaxSizeBytes,
+	} {
+		*target, err = optionalInt64Param(query, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name, target := range map[string]**time.Time{
+		"created_after":  &req.CreatedAfter,
+		"created_before": &req.CreatedBefore,
+	} {
+		*target, err = optionalTimeParam(query, name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	limit := query.Get("limit")
+	if limit != "" {
+		req.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit: %w", err)
+		}
+	}
+
+	return req, nil
+}
+
+func optionalInt64Param(query url.Values, name string) (*int64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	return &parsed, nil
+}
+
+func optionalTimeParam(query url.Values, name string) (*time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s, expected RFC 3339 timestamp: %w", name, err)
+	}
+
+	return &parsed, nil
+}
@@ -3,19 +3,25 @@ package httpapi
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/draganm/datas3t/server/datas3t"
 )
 
 func (a *api) listDatas3ts(w http.ResponseWriter, r *http.Request) {
-	datas3ts, err := a.s.ListDatas3ts(r.Context(), a.log)
+	req := &datas3t.ListDatas3tsRequest{
+		NamePrefix: r.URL.Query().Get("name_prefix"),
+	}
+
+	datas3ts, err := a.s.ListDatas3ts(r.Context(), a.log, req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(datas3ts)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		a.writeError(w, err)
 		return
 	}
 }
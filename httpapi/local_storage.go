@@ -0,0 +1,7 @@
+package httpapi
+
+import "net/http"
+
+func (a *api) localStorage(w http.ResponseWriter, r *http.Request) {
+	a.s.ServeLocalStorage(a.log, w, r)
+}
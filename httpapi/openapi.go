@@ -0,0 +1,16 @@
+package httpapi
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OpenAPISpec is the OpenAPI 3 document describing every route of the HTTP API
+//
+//go:embed openapi.json
+var OpenAPISpec []byte
+
+func (a *api) getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(OpenAPISpec)
+}
@@ -0,0 +1,143 @@
+package httpapi_test
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/draganm/datas3t/httpapi"
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(httpapi.OpenAPISpec)
+	if err != nil {
+		t.Fatalf("failed to load OpenAPI spec: %v", err)
+	}
+
+	err = doc.Validate(context.Background())
+	if err != nil {
+		t.Fatalf("OpenAPI spec is invalid: %v", err)
+	}
+
+	return doc
+}
+
+// registeredRoutes returns the patterns passed to mux.HandleFunc in http_api.go
+func registeredRoutes(t *testing.T) []string {
+	t.Helper()
+
+	f, err := parser.ParseFile(token.NewFileSet(), "http_api.go", nil, 0)
+	if err != nil {
+		t.Fatalf("failed to parse http_api.go: %v", err)
+	}
+
+	var routes []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || sel.Sel.Name != "HandleFunc" {
+			return true
+		}
+
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok {
+			return true
+		}
+
+		pattern, err := strconv.Unquote(lit.Value)
+		if err != nil {
+			t.Fatalf("failed to unquote route pattern %s: %v", lit.Value, err)
+		}
+
+		routes = append(routes, pattern)
+		return true
+	})
+
+	return routes
+}
+
+func TestOpenAPISpecDocumentsAllRoutes(t *testing.T) {
+	doc := loadSpec(t)
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	for _, route := range registeredRoutes(t) {
+		if route == "GET /" {
+			// Web UI
+			continue
+		}
+
+		if strings.Contains(route, " /api/v1/local-storage/") {
+			// Presigned URLs of local buckets, signed by the server and not called directly
+			continue
+		}
+
+		if !documented[route] {
+			t.Errorf("route %q is not documented in openapi.json", route)
+		}
+	}
+}
+
+func TestOpenAPISpecOperationsAreRouted(t *testing.T) {
+	doc := loadSpec(t)
+	mux := httpapi.NewHTTPAPI(nil, slog.Default())
+
+	var operations []string
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			operations = append(operations, method+" "+path)
+		}
+	}
+	sort.Strings(operations)
+
+	for _, operation := range operations {
+		method, path, _ := strings.Cut(operation, " ")
+
+		req := httptest.NewRequest(method, path, nil)
+		_, pattern := mux.Handler(req)
+		if pattern != operation {
+			t.Errorf("operation %q is routed to %q", operation, pattern)
+		}
+	}
+}
+
+func TestOpenAPISpecIsServed(t *testing.T) {
+	mux := httpapi.NewHTTPAPI(nil, slog.Default())
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	if rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected content type %q", rec.Header().Get("Content-Type"))
+	}
+
+	_, err := openapi3.NewLoader().LoadFromData(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("served document is not a valid OpenAPI document: %v", err)
+	}
+}
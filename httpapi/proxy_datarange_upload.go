@@ -0,0 +1,32 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/dataranges"
+)
+
+func (a *api) proxyDatarangeUpload(w http.ResponseWriter, r *http.Request) {
+	datas3tName := r.URL.Query().Get("datas3t_name")
+	if datas3tName == "" {
+		a.writeErrorCode(w, apierror.CodeValidationFailed, "datas3t_name query parameter is required")
+		return
+	}
+
+	req := &dataranges.ProxyUploadRequest{
+		Datas3tName:    datas3tName,
+		WrappedDataKey: r.URL.Query().Get("wrapped_data_key"),
+	}
+
+	resp, err := a.s.ProxyUploadDatarange(r.Context(), a.log, req, r.Body)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,31 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/download"
+)
+
+func (a *api) refreshDownloadSegments(w http.ResponseWriter, r *http.Request) {
+	req := &download.RefreshDownloadSegmentsRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	resp, err := a.s.RefreshDownloadSegments(r.Context(), a.log, *req)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+}
@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/datas3t"
+)
+
+func (a *api) setReplica(w http.ResponseWriter, r *http.Request) {
+	var req datas3t.SetReplicaRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	err = a.s.SetReplica(r.Context(), a.log, &req)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) removeReplica(w http.ResponseWriter, r *http.Request) {
+	var req datas3t.RemoveReplicaRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	err = a.s.RemoveReplica(r.Context(), a.log, &req)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) listReplicas(w http.ResponseWriter, r *http.Request) {
+	replicas, err := a.s.ListReplicas(r.Context(), a.log)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(replicas)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+}
+
+func (a *api) getReplicationStatus(w http.ResponseWriter, r *http.Request) {
+	datas3tName := r.URL.Query().Get("datas3t_name")
+	if datas3tName == "" {
+		a.writeErrorCode(w, apierror.CodeValidationFailed, "datas3t_name query parameter is required")
+		return
+	}
+
+	response, err := a.s.GetReplicationStatus(r.Context(), a.log, datas3tName)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+}
@@ -0,0 +1,28 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/dataranges"
+)
+
+func (a *api) resumeDatarangeUpload(w http.ResponseWriter, r *http.Request) {
+	req := &dataranges.ResumeUploadRequest{}
+	err := json.NewDecoder(r.Body).Decode(req)
+	if err != nil {
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	resp, err := a.s.ResumeDatarangeUpload(r.Context(), a.log, req)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -2,9 +2,9 @@ package httpapi
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/server/dataranges"
 )
 
@@ -13,31 +13,23 @@ func (a *api) startAggregate(w http.ResponseWriter, r *http.Request) {
 	req := &dataranges.StartAggregateRequest{}
 	err := json.NewDecoder(r.Body).Decode(req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
 		return
 	}
 
 	err = req.Validate(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		a.writeError(w, err)
 		return
 	}
 
 	resp, err := a.s.StartAggregate(r.Context(), a.log, req)
-	switch {
-	case errors.Is(err, dataranges.ErrInsufficientDataranges):
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	case errors.Is(err, dataranges.ErrRangeNotFullyCovered):
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
-	case err != nil:
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if err != nil {
+		a.writeError(w, err)
 		return
-	default:
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(resp)
 	}
 
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(resp)
 }
\ No newline at end of file
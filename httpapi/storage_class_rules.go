@@ -0,0 +1,47 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/datas3t"
+)
+
+func (a *api) setStorageClassRules(w http.ResponseWriter, r *http.Request) {
+	var req datas3t.SetStorageClassRulesRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	err = a.s.SetStorageClassRules(r.Context(), a.log, &req)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) getStorageClassRules(w http.ResponseWriter, r *http.Request) {
+	datas3tName := r.URL.Query().Get("datas3t_name")
+	if datas3tName == "" {
+		a.writeErrorCode(w, apierror.CodeValidationFailed, "datas3t_name query parameter is required")
+		return
+	}
+
+	response, err := a.s.GetStorageClassRules(r.Context(), a.log, datas3tName)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+}
@@ -0,0 +1,28 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/bucket"
+)
+
+func (a *api) testBucket(w http.ResponseWriter, r *http.Request) {
+	var req bucket.TestBucketRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		a.writeErrorCode(w, apierror.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	response, err := a.s.TestBucket(r.Context(), a.log, &req)
+	if err != nil {
+		a.writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -6,8 +6,13 @@ import (
 
 	"github.com/draganm/datas3t/server"
 	"github.com/draganm/datas3t/server/dataranges"
+	"github.com/draganm/datas3t/server/datas3t"
 )
 
+// maxChartDataranges bounds the number of dataranges fetched per datas3t for the
+// size chart, so that the page stays fast for datas3ts with many dataranges.
+const maxChartDataranges = 500
+
 type Handler struct {
 	server *server.Server
 	log    *slog.Logger
@@ -18,7 +23,9 @@ func NewHandler(s *server.Server, log *slog.Logger) *Handler {
 }
 
 func (h *Handler) IndexPage(w http.ResponseWriter, r *http.Request) {
-	datas3ts, err := h.server.ListDatas3ts(r.Context(), h.log)
+	datas3ts, err := h.server.ListDatas3ts(r.Context(), h.log, &datas3t.ListDatas3tsRequest{
+		NamePrefix: r.URL.Query().Get("prefix"),
+	})
 	if err != nil {
 		h.log.Error("Failed to list datas3ts", "error", err)
 		http.Error(w, "Failed to load datas3ts", http.StatusInternalServerError)
@@ -30,6 +37,7 @@ func (h *Handler) IndexPage(w http.ResponseWriter, r *http.Request) {
 	for _, d := range datas3ts {
 		req := &dataranges.ListDatarangesRequest{
 			Datas3tName: d.Datas3tName,
+			Limit:       maxChartDataranges,
 		}
 		resp, err := h.server.ListDataranges(r.Context(), h.log, req)
 		if err != nil {
@@ -0,0 +1,2 @@
+-- Remove append-mode key allocation
+ALTER TABLE datas3ts DROP COLUMN IF EXISTS next_datapoint_key;
@@ -0,0 +1,9 @@
+-- Track the next datapoint key handed out to append-mode uploads
+ALTER TABLE datas3ts ADD COLUMN IF NOT EXISTS next_datapoint_key BIGINT NOT NULL DEFAULT 0;
+
+-- Start appending after the dataranges that already exist
+UPDATE datas3ts
+SET next_datapoint_key = COALESCE(
+    (SELECT MAX(dr.max_datapoint_key) + 1 FROM dataranges dr WHERE dr.datas3t_id = datas3ts.id),
+    0
+);
@@ -0,0 +1,3 @@
+-- Remove datarange upload leases
+DROP INDEX IF EXISTS idx_datarange_uploads_leases;
+ALTER TABLE datarange_uploads DROP COLUMN IF EXISTS lease_expires_at;
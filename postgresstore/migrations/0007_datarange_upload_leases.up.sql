@@ -0,0 +1,6 @@
+-- Optional exclusive lease of a pending upload on its datapoint key range
+ALTER TABLE datarange_uploads ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_datarange_uploads_leases
+ON datarange_uploads(datas3t_id, lease_expires_at)
+WHERE lease_expires_at IS NOT NULL;
@@ -0,0 +1,2 @@
+-- Remove streamed datarange uploads
+ALTER TABLE datarange_uploads DROP COLUMN IF EXISTS streamed;
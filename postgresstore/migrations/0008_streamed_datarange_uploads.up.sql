@@ -0,0 +1,2 @@
+-- Streamed uploads declare their size and datapoint range only when they are completed
+ALTER TABLE datarange_uploads ADD COLUMN IF NOT EXISTS streamed BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,2 @@
+-- Remove replacing datarange uploads
+ALTER TABLE datarange_uploads DROP COLUMN IF EXISTS replaced_datarange_ids;
@@ -0,0 +1,3 @@
+-- Uploads that replace the existing dataranges of their datapoint range record the replaced
+-- dataranges, NULL for uploads that do not replace any
+ALTER TABLE datarange_uploads ADD COLUMN IF NOT EXISTS replaced_datarange_ids BIGINT[];
@@ -0,0 +1,5 @@
+-- Remove the connection settings of S3 buckets
+ALTER TABLE s3_buckets DROP COLUMN IF EXISTS credential_mode;
+ALTER TABLE s3_buckets DROP COLUMN IF EXISTS session_token;
+ALTER TABLE s3_buckets DROP COLUMN IF EXISTS addressing_style;
+ALTER TABLE s3_buckets DROP COLUMN IF EXISTS region;
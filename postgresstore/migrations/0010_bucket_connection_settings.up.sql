@@ -0,0 +1,9 @@
+-- Connection settings of S3 buckets. An empty region means us-east-1, the session token is
+-- encrypted like the access and secret keys, the ambient credential mode ignores the keys
+-- and uses the credential chain of the server (environment, web identity, instance profile)
+ALTER TABLE s3_buckets ADD COLUMN IF NOT EXISTS region VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE s3_buckets ADD COLUMN IF NOT EXISTS addressing_style VARCHAR(16) NOT NULL DEFAULT 'path'
+    CHECK (addressing_style IN ('path', 'virtual'));
+ALTER TABLE s3_buckets ADD COLUMN IF NOT EXISTS session_token VARCHAR(8192) NOT NULL DEFAULT '';
+ALTER TABLE s3_buckets ADD COLUMN IF NOT EXISTS credential_mode VARCHAR(16) NOT NULL DEFAULT 'static'
+    CHECK (credential_mode IN ('static', 'ambient'));
@@ -0,0 +1,4 @@
+-- Remove the key prefix of S3 buckets
+ALTER TABLE s3_buckets DROP CONSTRAINT IF EXISTS s3_buckets_endpoint_bucket_key_prefix_key;
+ALTER TABLE s3_buckets ADD CONSTRAINT s3_buckets_endpoint_bucket_key UNIQUE (endpoint, bucket);
+ALTER TABLE s3_buckets DROP COLUMN IF EXISTS key_prefix;
@@ -0,0 +1,6 @@
+-- Prefix of the object keys datas3t stores in a bucket, so several environments or tenants
+-- can share one bucket. A non-empty prefix ends with a slash. The same bucket may be
+-- configured once per prefix.
+ALTER TABLE s3_buckets ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(1024) NOT NULL DEFAULT '';
+ALTER TABLE s3_buckets DROP CONSTRAINT IF EXISTS s3_buckets_endpoint_bucket_key;
+ALTER TABLE s3_buckets ADD CONSTRAINT s3_buckets_endpoint_bucket_key_prefix_key UNIQUE (endpoint, bucket, key_prefix);
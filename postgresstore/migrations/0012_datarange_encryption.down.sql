@@ -0,0 +1,4 @@
+-- Remove client-side encryption of datapoint content
+ALTER TABLE dataranges DROP COLUMN IF EXISTS wrapped_data_key;
+ALTER TABLE datarange_uploads DROP COLUMN IF EXISTS wrapped_data_key;
+ALTER TABLE datas3ts DROP COLUMN IF EXISTS encrypted;
@@ -0,0 +1,6 @@
+-- Client-side encryption of datapoint content. The content of every datarange of an
+-- encrypted datas3t is encrypted with a data key of its own, which is stored wrapped with
+-- a key only the clients hold. The server never sees the data keys.
+ALTER TABLE datas3ts ADD COLUMN IF NOT EXISTS encrypted BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE datarange_uploads ADD COLUMN IF NOT EXISTS wrapped_data_key VARCHAR(1024) NOT NULL DEFAULT '';
+ALTER TABLE dataranges ADD COLUMN IF NOT EXISTS wrapped_data_key VARCHAR(1024) NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- Remove the server-side encryption settings of S3 buckets
+ALTER TABLE s3_buckets DROP COLUMN IF EXISTS sse_customer_key;
+ALTER TABLE s3_buckets DROP COLUMN IF EXISTS sse_kms_key_id;
+ALTER TABLE s3_buckets DROP COLUMN IF EXISTS sse_mode;
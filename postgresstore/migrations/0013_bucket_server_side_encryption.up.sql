@@ -0,0 +1,7 @@
+-- Server-side encryption S3 applies to the objects datas3t writes to a bucket. An empty
+-- mode leaves it to the default encryption of the bucket. The SSE-C customer key is
+-- encrypted like the access and secret keys.
+ALTER TABLE s3_buckets ADD COLUMN IF NOT EXISTS sse_mode VARCHAR(16) NOT NULL DEFAULT ''
+    CHECK (sse_mode IN ('', 'sse-s3', 'sse-kms', 'sse-c'));
+ALTER TABLE s3_buckets ADD COLUMN IF NOT EXISTS sse_kms_key_id VARCHAR(2048) NOT NULL DEFAULT '';
+ALTER TABLE s3_buckets ADD COLUMN IF NOT EXISTS sse_customer_key VARCHAR(8192) NOT NULL DEFAULT '';
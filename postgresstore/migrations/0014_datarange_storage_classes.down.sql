@@ -0,0 +1,5 @@
+-- Remove storage class tiering of dataranges
+DROP TABLE IF EXISTS storage_class_rules;
+ALTER TABLE dataranges DROP COLUMN IF EXISTS restore_expires_at;
+ALTER TABLE dataranges DROP COLUMN IF EXISTS restore_requested_at;
+ALTER TABLE dataranges DROP COLUMN IF EXISTS storage_class;
@@ -0,0 +1,19 @@
+-- Storage classes of the data objects of dataranges. Rules move the dataranges of a
+-- datas3t to colder storage classes once they are old enough or far enough behind the
+-- newest datapoint. Objects of archived classes have to be restored before they can be
+-- downloaded, the restore columns track the temporary copies.
+ALTER TABLE dataranges ADD COLUMN IF NOT EXISTS storage_class VARCHAR(32) NOT NULL DEFAULT 'STANDARD';
+ALTER TABLE dataranges ADD COLUMN IF NOT EXISTS restore_requested_at TIMESTAMP;
+ALTER TABLE dataranges ADD COLUMN IF NOT EXISTS restore_expires_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS storage_class_rules (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    datas3t_id BIGINT NOT NULL,
+    storage_class VARCHAR(32) NOT NULL,
+    min_age_days INTEGER,
+    min_keys_behind BIGINT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (datas3t_id) REFERENCES datas3ts(id) ON DELETE CASCADE,
+    UNIQUE (datas3t_id, storage_class),
+    CHECK (min_age_days IS NOT NULL OR min_keys_behind IS NOT NULL)
+);
@@ -0,0 +1,3 @@
+-- Remove the replicas of datas3ts
+DROP TABLE IF EXISTS datarange_replications;
+DROP TABLE IF EXISTS datas3t_replicas;
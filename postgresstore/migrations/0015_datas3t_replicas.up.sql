@@ -0,0 +1,32 @@
+-- Replicas of datas3ts in a second bucket, e.g. of another provider, for disaster
+-- recovery. The replication worker copies every datarange of a datas3t to the bucket of
+-- its replica under the key prefix of that bucket and records the outcome per datarange.
+-- Downloads fail over to replicated copies when the bucket of the datas3t fails.
+CREATE TABLE IF NOT EXISTS datas3t_replicas (
+    id BIGINT GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY,
+    datas3t_id BIGINT NOT NULL UNIQUE,
+    s3_bucket_id BIGINT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (datas3t_id) REFERENCES datas3ts(id) ON DELETE CASCADE,
+    FOREIGN KEY (s3_bucket_id) REFERENCES s3_buckets(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_datas3t_replicas_s3_bucket_id ON datas3t_replicas(s3_bucket_id);
+
+CREATE TABLE IF NOT EXISTS datarange_replications (
+    datarange_id BIGINT NOT NULL,
+    replica_id BIGINT NOT NULL,
+    data_object_key VARCHAR(1024) NOT NULL,
+    index_object_key VARCHAR(1024) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    replicated_at TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (datarange_id, replica_id),
+    FOREIGN KEY (datarange_id) REFERENCES dataranges(id) ON DELETE CASCADE,
+    FOREIGN KEY (replica_id) REFERENCES datas3t_replicas(id) ON DELETE CASCADE,
+    CHECK (status IN ('pending', 'replicated', 'failed'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_datarange_replications_replica_id ON datarange_replications(replica_id);
@@ -23,37 +23,66 @@ type AggregateUpload struct {
 }
 
 type Datarange struct {
-	ID              int64
-	Datas3tID       int64
-	DataObjectKey   string
-	IndexObjectKey  string
-	MinDatapointKey int64
-	MaxDatapointKey int64
-	SizeBytes       int64
-	CreatedAt       pgtype.Timestamp
-	UpdatedAt       pgtype.Timestamp
+	ID                 int64
+	Datas3tID          int64
+	DataObjectKey      string
+	IndexObjectKey     string
+	MinDatapointKey    int64
+	MaxDatapointKey    int64
+	SizeBytes          int64
+	CreatedAt          pgtype.Timestamp
+	UpdatedAt          pgtype.Timestamp
+	WrappedDataKey     string
+	StorageClass       string
+	RestoreRequestedAt pgtype.Timestamp
+	RestoreExpiresAt   pgtype.Timestamp
+}
+
+type DatarangeReplication struct {
+	DatarangeID    int64
+	ReplicaID      int64
+	DataObjectKey  string
+	IndexObjectKey string
+	Status         string
+	Attempts       int32
+	LastError      string
+	ReplicatedAt   pgtype.Timestamp
+	UpdatedAt      pgtype.Timestamp
 }
 
 type DatarangeUpload struct {
-	ID                  int64
-	Datas3tID           int64
-	UploadID            string
-	DataObjectKey       string
-	IndexObjectKey      string
-	FirstDatapointIndex int64
-	NumberOfDatapoints  int64
-	DataSize            int64
-	CreatedAt           pgtype.Timestamp
-	UpdatedAt           pgtype.Timestamp
+	ID                   int64
+	Datas3tID            int64
+	UploadID             string
+	DataObjectKey        string
+	IndexObjectKey       string
+	FirstDatapointIndex  int64
+	NumberOfDatapoints   int64
+	DataSize             int64
+	CreatedAt            pgtype.Timestamp
+	UpdatedAt            pgtype.Timestamp
+	LeaseExpiresAt       pgtype.Timestamp
+	Streamed             bool
+	ReplacedDatarangeIds []int64
+	WrappedDataKey       string
 }
 
 type Datas3t struct {
-	ID            int64
-	Name          string
-	S3BucketID    int64
-	UploadCounter int64
-	CreatedAt     pgtype.Timestamp
-	UpdatedAt     pgtype.Timestamp
+	ID               int64
+	Name             string
+	S3BucketID       int64
+	UploadCounter    int64
+	CreatedAt        pgtype.Timestamp
+	UpdatedAt        pgtype.Timestamp
+	NextDatapointKey int64
+	Encrypted        bool
+}
+
+type Datas3tReplica struct {
+	ID         int64
+	Datas3tID  int64
+	S3BucketID int64
+	CreatedAt  pgtype.Timestamp
 }
 
 type ObjectsToDelete struct {
@@ -66,12 +95,29 @@ type ObjectsToDelete struct {
 }
 
 type S3Bucket struct {
-	ID        int64
-	Name      string
-	Endpoint  string
-	Bucket    string
-	AccessKey string
-	SecretKey string
-	CreatedAt pgtype.Timestamp
-	UpdatedAt pgtype.Timestamp
+	ID              int64
+	Name            string
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	CreatedAt       pgtype.Timestamp
+	UpdatedAt       pgtype.Timestamp
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
+	KeyPrefix       string
+	SseMode         string
+	SseKmsKeyID     string
+	SseCustomerKey  string
+}
+
+type StorageClassRule struct {
+	ID            int64
+	Datas3tID     int64
+	StorageClass  string
+	MinAgeDays    *int32
+	MinKeysBehind *int64
+	CreatedAt     pgtype.Timestamp
 }
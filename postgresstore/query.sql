@@ -10,6 +10,7 @@ FROM datas3ts;
 SELECT 
     d.name as datas3t_name,
     s.name as bucket_name,
+    d.encrypted,
     COALESCE(COUNT(dr.id), 0) as datarange_count,
     COALESCE(SUM(dr.max_datapoint_key - dr.min_datapoint_key + 1), 0) as total_datapoints,
     COALESCE(MIN(dr.min_datapoint_key), 0) as lowest_datapoint,
@@ -18,7 +19,8 @@ SELECT
 FROM datas3ts d
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
 LEFT JOIN dataranges dr ON d.id = dr.datas3t_id
-GROUP BY d.id, d.name, s.name
+WHERE starts_with(d.name, @name_prefix::text)
+GROUP BY d.id, d.name, s.name, d.encrypted
 ORDER BY d.name;
 
 -- name: BucketExists :one
@@ -31,13 +33,20 @@ SELECT DISTINCT name
 FROM s3_buckets;
 
 -- name: ListAllBuckets :many
-SELECT name, endpoint, bucket
+SELECT name, endpoint, bucket, region, addressing_style, credential_mode, key_prefix, sse_mode, sse_kms_key_id
+FROM s3_buckets
+ORDER BY name;
+
+-- name: ListAllBucketsWithCredentials :many
+SELECT name, endpoint, bucket, access_key, secret_key, region, addressing_style, session_token, credential_mode, key_prefix
 FROM s3_buckets
 ORDER BY name;
 
 -- name: GetDatas3tWithBucket :one
-SELECT d.id, d.name, d.s3_bucket_id, d.upload_counter,
-       s.endpoint, s.bucket, s.access_key, s.secret_key
+SELECT d.id, d.name, d.s3_bucket_id, d.upload_counter, d.encrypted,
+       s.endpoint, s.bucket, s.access_key, s.secret_key,
+       s.region, s.addressing_style, s.session_token, s.credential_mode, s.key_prefix,
+       s.sse_mode, s.sse_kms_key_id, s.sse_customer_key
 FROM datas3ts d
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
 WHERE d.name = $1;
@@ -56,9 +65,39 @@ WHERE datas3t_id = $1
   AND first_datapoint_index < $2
   AND (first_datapoint_index + number_of_datapoints - 1) >= $3;
 
+-- name: GetOverlappingDatarangeLease :one
+-- Returns the active lease of another upload that overlaps the given datapoint key range
+SELECT id, first_datapoint_index, number_of_datapoints, lease_expires_at
+FROM datarange_uploads
+WHERE datas3t_id = @datas3t_id
+  AND id <> @exclude_upload_id::bigint
+  AND lease_expires_at > CURRENT_TIMESTAMP
+  AND first_datapoint_index <= @last_datapoint_index::bigint
+  AND (first_datapoint_index + number_of_datapoints - 1) >= @first_datapoint_index::bigint
+ORDER BY first_datapoint_index
+LIMIT 1;
+
+-- name: SetDatarangeUploadLease :one
+UPDATE datarange_uploads
+SET lease_expires_at = CURRENT_TIMESTAMP + make_interval(secs => @lease_duration_seconds::bigint),
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = @id
+RETURNING lease_expires_at;
+
+-- name: ListActiveDatarangeLeases :many
+SELECT du.id, du.first_datapoint_index, du.number_of_datapoints, du.lease_expires_at
+FROM datarange_uploads du
+JOIN datas3ts d ON du.datas3t_id = d.id
+WHERE d.name = @datas3t_name
+  AND du.lease_expires_at > CURRENT_TIMESTAMP
+ORDER BY du.first_datapoint_index, du.id;
+
+-- name: LockDatas3t :exec
+SELECT id FROM datas3ts WHERE id = $1 FOR UPDATE;
+
 -- name: CreateDatarange :one
-INSERT INTO dataranges (datas3t_id, data_object_key, index_object_key, min_datapoint_key, max_datapoint_key, size_bytes)
-VALUES (@datas3t_id, @data_object_key, @index_object_key, @min_datapoint_key, @max_datapoint_key, @size_bytes)
+INSERT INTO dataranges (datas3t_id, data_object_key, index_object_key, min_datapoint_key, max_datapoint_key, size_bytes, wrapped_data_key)
+VALUES (@datas3t_id, @data_object_key, @index_object_key, @min_datapoint_key, @max_datapoint_key, @size_bytes, @wrapped_data_key)
 RETURNING id;
 
 -- name: CreateDatarangeUpload :one
@@ -69,11 +108,25 @@ INSERT INTO datarange_uploads (
     index_object_key,
     first_datapoint_index, 
     number_of_datapoints, 
-    data_size
+    data_size,
+    streamed,
+    replaced_datarange_ids,
+    wrapped_data_key
 )
-VALUES (@datas3t_id, @upload_id, @data_object_key, @index_object_key, @first_datapoint_index, @number_of_datapoints, @data_size)
+VALUES (@datas3t_id, @upload_id, @data_object_key, @index_object_key, @first_datapoint_index, @number_of_datapoints, @data_size, @streamed, @replaced_datarange_ids, @wrapped_data_key)
 RETURNING id;
 
+-- name: DeclareStreamedDatarangeUpload :exec
+UPDATE datarange_uploads
+SET first_datapoint_index = @first_datapoint_index,
+    number_of_datapoints = @number_of_datapoints,
+    data_size = @data_size,
+    data_object_key = @data_object_key,
+    index_object_key = @index_object_key,
+    streamed = false,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = @id AND streamed;
+
 -- name: GetDatarangeUploadWithDetails :one
 SELECT 
     du.id, 
@@ -84,12 +137,23 @@ SELECT
     du.data_size,
     du.data_object_key, 
     du.index_object_key,
+    du.streamed,
+    du.replaced_datarange_ids,
+    du.wrapped_data_key,
     d.name as datas3t_name, 
     d.s3_bucket_id,
     s.endpoint, 
     s.bucket, 
     s.access_key, 
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.key_prefix,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
 FROM datarange_uploads du
 JOIN datas3ts d ON du.datas3t_id = d.id
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
@@ -114,7 +178,11 @@ SELECT
     s.endpoint,
     s.bucket,
     s.access_key,
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode
 FROM objects_to_delete otd
 JOIN s3_buckets s ON otd.s3_bucket_id = s.id
 WHERE otd.object_name IS NOT NULL
@@ -146,13 +214,21 @@ INSERT INTO s3_buckets (
         endpoint,
         bucket,
         access_key,
-        secret_key
+        secret_key,
+        region,
+        addressing_style,
+        session_token,
+        credential_mode,
+        key_prefix,
+        sse_mode,
+        sse_kms_key_id,
+        sse_customer_key
     )
-VALUES ($1, $2, $3, $4, $5);
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13);
 
 -- name: AddDatas3t :exec
-INSERT INTO datas3ts (name, s3_bucket_id) 
-SELECT @datas3t_name, id 
+INSERT INTO datas3ts (name, s3_bucket_id, encrypted) 
+SELECT @datas3t_name, id, @encrypted
 FROM s3_buckets 
 WHERE s3_buckets.name = @bucket_name;
 
@@ -203,11 +279,21 @@ SELECT
     dr.min_datapoint_key,
     dr.max_datapoint_key,
     dr.size_bytes,
+    dr.wrapped_data_key,
+    dr.storage_class,
+    dr.restore_expires_at,
     d.name as datas3t_name,
     s.endpoint,
     s.bucket,
     s.access_key,
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
 FROM dataranges dr
 JOIN datas3ts d ON dr.datas3t_id = d.id
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
@@ -223,6 +309,20 @@ SET upload_counter = upload_counter + 1,
 WHERE id = $1
 RETURNING upload_counter;
 
+-- name: AllocateDatapointKeys :one
+-- Reserves the next number_of_datapoints keys of a datas3t for an append-mode upload.
+-- Allocation starts after the highest allocated, stored or pending key and is
+-- serialized by the row lock on the datas3t.
+UPDATE datas3ts
+SET next_datapoint_key = GREATEST(
+        next_datapoint_key,
+        (SELECT COALESCE(MAX(dr.max_datapoint_key) + 1, 0) FROM dataranges dr WHERE dr.datas3t_id = datas3ts.id),
+        (SELECT COALESCE(MAX(du.first_datapoint_index + du.number_of_datapoints), 0) FROM datarange_uploads du WHERE du.datas3t_id = datas3ts.id)
+    ) + @number_of_datapoints::bigint,
+    updated_at = CURRENT_TIMESTAMP
+WHERE datas3ts.id = @id
+RETURNING (next_datapoint_key - @number_of_datapoints::bigint)::bigint AS first_datapoint_key;
+
 -- name: GetDatarangeByExactRange :one
 SELECT 
     dr.id,
@@ -236,7 +336,11 @@ SELECT
     s.endpoint,
     s.bucket,
     s.access_key,
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode
 FROM dataranges dr
 JOIN datas3ts d ON dr.datas3t_id = d.id
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
@@ -250,18 +354,88 @@ FROM dataranges dr
 JOIN datas3ts d ON dr.datas3t_id = d.id
 WHERE d.name = $1;
 
--- name: ListDatarangesForDatas3t :many
-SELECT 
-    dr.id,
-    dr.data_object_key,
-    dr.index_object_key,
-    dr.min_datapoint_key,
-    dr.max_datapoint_key,
-    dr.size_bytes
+-- name: GetDatapointKeyRange :one
+SELECT
+    COUNT(dr.id)::bigint AS datarange_count,
+    COALESCE(MIN(dr.min_datapoint_key), 0)::bigint AS lowest_datapoint,
+    COALESCE(MAX(dr.max_datapoint_key), 0)::bigint AS highest_datapoint,
+    COALESCE(SUM(dr.max_datapoint_key - dr.min_datapoint_key + 1), 0)::bigint AS total_datapoints
 FROM dataranges dr
 JOIN datas3ts d ON dr.datas3t_id = d.id
-WHERE d.name = $1
-ORDER BY dr.min_datapoint_key;
+WHERE d.name = @datas3t_name;
+
+-- name: GetDatapointGaps :many
+-- Returns the missing datapoint key intervals between the lowest and the highest
+-- datapoint key of a datas3t. The running maximum guards against overlapping ranges.
+WITH ordered AS (
+    SELECT
+        dr.min_datapoint_key,
+        MAX(dr.max_datapoint_key) OVER (
+            ORDER BY dr.min_datapoint_key
+            ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+        ) AS previous_max_key
+    FROM dataranges dr
+    JOIN datas3ts d ON dr.datas3t_id = d.id
+    WHERE d.name = @datas3t_name
+)
+SELECT
+    (previous_max_key + 1)::bigint AS first_missing_key,
+    (min_datapoint_key - 1)::bigint AS last_missing_key
+FROM ordered
+WHERE previous_max_key IS NOT NULL
+  AND min_datapoint_key > previous_max_key + 1
+ORDER BY min_datapoint_key;
+
+-- name: ListDatarangesPage :many
+-- Keyset pagination over the dataranges of a datas3t. Rows are ordered by
+-- (sort_value, id), where sort_value is the min datapoint key, the size or the
+-- creation time (in microseconds since epoch) depending on sort_by.
+-- The cursor is the (sort_value, id) of the last row of the previous page.
+WITH filtered AS (
+    SELECT
+        dr.id,
+        dr.data_object_key,
+        dr.index_object_key,
+        dr.min_datapoint_key,
+        dr.max_datapoint_key,
+        dr.size_bytes,
+        dr.created_at,
+        dr.storage_class,
+        (CASE @sort_by::text
+            WHEN 'size' THEN dr.size_bytes
+            WHEN 'created_at' THEN COALESCE((EXTRACT(EPOCH FROM dr.created_at) * 1000000)::bigint, 0)
+            ELSE dr.min_datapoint_key
+        END)::bigint AS sort_value
+    FROM dataranges dr
+    JOIN datas3ts d ON dr.datas3t_id = d.id
+    WHERE d.name = @datas3t_name
+      AND (sqlc.narg(from_datapoint_key)::bigint IS NULL OR dr.max_datapoint_key >= sqlc.narg(from_datapoint_key)::bigint)
+      AND (sqlc.narg(to_datapoint_key)::bigint IS NULL OR dr.min_datapoint_key <= sqlc.narg(to_datapoint_key)::bigint)
+      AND (sqlc.narg(min_size_bytes)::bigint IS NULL OR dr.size_bytes >= sqlc.narg(min_size_bytes)::bigint)
+      AND (sqlc.narg(max_size_bytes)::bigint IS NULL OR dr.size_bytes <= sqlc.narg(max_size_bytes)::bigint)
+      AND (sqlc.narg(created_after)::timestamp IS NULL OR dr.created_at >= sqlc.narg(created_after)::timestamp)
+      AND (sqlc.narg(created_before)::timestamp IS NULL OR dr.created_at < sqlc.narg(created_before)::timestamp)
+)
+SELECT
+    id,
+    data_object_key,
+    index_object_key,
+    min_datapoint_key,
+    max_datapoint_key,
+    size_bytes,
+    created_at,
+    storage_class,
+    sort_value
+FROM filtered
+WHERE sqlc.narg(cursor_sort_value)::bigint IS NULL
+   OR (@descending::boolean AND (sort_value, id) < (sqlc.narg(cursor_sort_value)::bigint, @cursor_id::bigint))
+   OR (NOT @descending::boolean AND (sort_value, id) > (sqlc.narg(cursor_sort_value)::bigint, @cursor_id::bigint))
+ORDER BY
+    CASE WHEN @descending::boolean THEN sort_value END DESC,
+    CASE WHEN @descending::boolean THEN id END DESC,
+    sort_value ASC,
+    id ASC
+LIMIT @page_limit::int;
 
 -- name: CheckFullDatarangeCoverage :one
 -- Check if a datapoint range is fully covered by existing dataranges with no gaps
@@ -307,6 +481,9 @@ SELECT
     dr.min_datapoint_key,
     dr.max_datapoint_key,
     dr.size_bytes,
+    dr.wrapped_data_key,
+    dr.storage_class,
+    dr.restore_expires_at,
     d.name as datas3t_name,
     s.id as s3_bucket_id,
     s.endpoint,
@@ -348,10 +525,18 @@ SELECT
     au.index_object_key,
     d.name as datas3t_name,
     d.s3_bucket_id,
+    d.encrypted,
     s.endpoint,
     s.bucket,
     s.access_key,
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
 FROM aggregate_uploads au
 JOIN datas3ts d ON au.datas3t_id = d.id
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
@@ -360,11 +545,65 @@ WHERE au.id = $1;
 -- name: DeleteAggregateUpload :exec
 DELETE FROM aggregate_uploads WHERE id = $1;
 
+-- name: UpdateBucket :exec
+UPDATE s3_buckets
+SET endpoint = $2,
+    bucket = $3,
+    access_key = $4,
+    secret_key = $5,
+    region = $6,
+    addressing_style = $7,
+    session_token = $8,
+    credential_mode = $9,
+    key_prefix = $10,
+    sse_mode = $11,
+    sse_kms_key_id = $12,
+    sse_customer_key = $13,
+    updated_at = CURRENT_TIMESTAMP
+WHERE name = $1;
+
+-- name: LockBucket :one
+SELECT id
+FROM s3_buckets
+WHERE name = $1
+FOR UPDATE;
+
+-- name: CountDatas3tsForBucket :one
+-- Counts the datas3ts storing their dataranges or their replica in a bucket
+SELECT count(*)
+FROM datas3ts d
+WHERE d.s3_bucket_id = $1
+   OR EXISTS (SELECT 1 FROM datas3t_replicas r WHERE r.datas3t_id = d.id AND r.s3_bucket_id = $1);
+
+-- name: CountObjectsToDeleteForBucket :one
+SELECT count(*)
+FROM objects_to_delete
+WHERE s3_bucket_id = $1;
+
+-- name: DeleteBucket :exec
+DELETE FROM s3_buckets WHERE id = $1;
+
+-- name: LockAllBucketCredentials :many
+SELECT id, name, access_key, secret_key, session_token, sse_customer_key
+FROM s3_buckets
+ORDER BY id
+FOR UPDATE;
+
+-- name: UpdateBucketCredentials :exec
+UPDATE s3_buckets
+SET access_key = $2,
+    secret_key = $3,
+    session_token = $4,
+    sse_customer_key = $5,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1;
+
 -- name: DeleteDatarangesByIDs :exec
 DELETE FROM dataranges WHERE id = ANY($1::BIGINT[]);
 
 -- name: GetBucketCredentials :one
-SELECT id, name, endpoint, bucket, access_key, secret_key
+SELECT id, name, endpoint, bucket, access_key, secret_key, region, addressing_style, session_token, credential_mode, key_prefix,
+       sse_mode, sse_kms_key_id, sse_customer_key
 FROM s3_buckets
 WHERE name = $1;
 
@@ -400,4 +639,258 @@ WHERE d.name = $1;
 SELECT id FROM datas3ts WHERE name = $1;
 
 -- name: DeleteDatas3t :exec
-DELETE FROM datas3ts WHERE name = $1;
\ No newline at end of file
+DELETE FROM datas3ts WHERE name = $1;
+-- name: GetDatarangesByDataObjectKeys :many
+SELECT 
+    dr.id,
+    dr.data_object_key,
+    dr.min_datapoint_key,
+    dr.wrapped_data_key,
+    dr.storage_class,
+    dr.restore_expires_at,
+    d.name as datas3t_name,
+    s.endpoint,
+    s.bucket,
+    s.access_key,
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
+FROM dataranges dr
+JOIN datas3ts d ON dr.datas3t_id = d.id
+JOIN s3_buckets s ON d.s3_bucket_id = s.id
+WHERE d.name = @datas3t_name
+  AND dr.data_object_key = ANY(@data_object_keys::text[]);
+
+-- name: DeleteStorageClassRules :exec
+DELETE FROM storage_class_rules WHERE datas3t_id = $1;
+
+-- name: InsertStorageClassRule :exec
+INSERT INTO storage_class_rules (datas3t_id, storage_class, min_age_days, min_keys_behind)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetStorageClassRules :many
+SELECT id, datas3t_id, storage_class, min_age_days, min_keys_behind, created_at
+FROM storage_class_rules
+WHERE datas3t_id = $1
+ORDER BY id;
+
+-- name: ListStorageClassRules :many
+SELECT
+    r.id,
+    r.datas3t_id,
+    r.storage_class,
+    r.min_age_days,
+    r.min_keys_behind,
+    d.name as datas3t_name,
+    s.endpoint,
+    s.bucket,
+    s.access_key,
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
+FROM storage_class_rules r
+JOIN datas3ts d ON r.datas3t_id = d.id
+JOIN s3_buckets s ON d.s3_bucket_id = s.id
+ORDER BY r.datas3t_id, r.id;
+
+-- name: GetDatarangesForStorageClassRule :many
+-- Returns the dataranges of a datas3t in one of the given warmer storage classes that
+-- are older than created_before and whose max datapoint key is at least min_keys_behind
+-- keys behind the newest datapoint of the datas3t. Sources of ongoing aggregations are
+-- skipped, as they are about to be read.
+SELECT dr.id, dr.data_object_key, dr.size_bytes, dr.storage_class
+FROM dataranges dr
+WHERE dr.datas3t_id = @datas3t_id
+  AND dr.storage_class = ANY(@warmer_storage_classes::text[])
+  AND (sqlc.narg(created_before)::timestamp IS NULL OR dr.created_at < sqlc.narg(created_before)::timestamp)
+  AND (sqlc.narg(min_keys_behind)::bigint IS NULL OR dr.max_datapoint_key <= (
+      SELECT MAX(newest.max_datapoint_key) FROM dataranges newest WHERE newest.datas3t_id = @datas3t_id
+  ) - sqlc.narg(min_keys_behind)::bigint)
+  AND NOT EXISTS (
+      SELECT 1 FROM aggregate_uploads au
+      WHERE au.datas3t_id = dr.datas3t_id AND dr.id = ANY(au.source_datarange_ids)
+  )
+ORDER BY dr.min_datapoint_key
+LIMIT @max_dataranges::int;
+
+-- name: SetDatarangeStorageClass :exec
+UPDATE dataranges
+SET storage_class = @storage_class,
+    restore_requested_at = NULL,
+    restore_expires_at = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = @id;
+
+-- name: SetDatarangeRestoreRequested :exec
+UPDATE dataranges SET restore_requested_at = CURRENT_TIMESTAMP WHERE id = $1;
+
+-- name: SetDatarangeRestoreExpiresAt :exec
+UPDATE dataranges SET restore_expires_at = @restore_expires_at WHERE id = @id;
+
+-- name: GetDatas3tReplica :one
+SELECT r.id, r.s3_bucket_id, s.name as bucket_name
+FROM datas3t_replicas r
+JOIN s3_buckets s ON r.s3_bucket_id = s.id
+WHERE r.datas3t_id = $1;
+
+-- name: InsertDatas3tReplica :exec
+INSERT INTO datas3t_replicas (datas3t_id, s3_bucket_id)
+VALUES ($1, $2);
+
+-- name: DeleteDatas3tReplica :exec
+DELETE FROM datas3t_replicas WHERE id = $1;
+
+-- name: ScheduleReplicaObjectsForDeletion :exec
+-- Schedules the copies of all dataranges of a replica for deletion from its bucket
+INSERT INTO objects_to_delete (presigned_delete_url, s3_bucket_id, object_name)
+SELECT '', r.s3_bucket_id, unnest(ARRAY[drr.data_object_key, drr.index_object_key])
+FROM datarange_replications drr
+JOIN datas3t_replicas r ON drr.replica_id = r.id
+WHERE r.id = $1;
+
+-- name: ScheduleDatarangeReplicasForDeletion :exec
+-- Schedules the copies of dataranges in the replicas of their datas3t for deletion,
+-- copies that are still being written are included
+INSERT INTO objects_to_delete (presigned_delete_url, s3_bucket_id, object_name)
+SELECT '', r.s3_bucket_id, unnest(ARRAY[drr.data_object_key, drr.index_object_key])
+FROM datarange_replications drr
+JOIN datas3t_replicas r ON drr.replica_id = r.id
+WHERE drr.datarange_id = ANY($1::BIGINT[]);
+
+-- name: ListDatas3tReplicas :many
+SELECT
+    d.name as datas3t_name,
+    s.name as bucket_name,
+    r.created_at,
+    COUNT(dr.id) as total_dataranges,
+    COUNT(drr.datarange_id) FILTER (WHERE drr.status = 'replicated') as replicated_dataranges,
+    COUNT(drr.datarange_id) FILTER (WHERE drr.status = 'failed') as failed_dataranges
+FROM datas3t_replicas r
+JOIN datas3ts d ON r.datas3t_id = d.id
+JOIN s3_buckets s ON r.s3_bucket_id = s.id
+LEFT JOIN dataranges dr ON dr.datas3t_id = d.id
+LEFT JOIN datarange_replications drr ON drr.datarange_id = dr.id AND drr.replica_id = r.id
+GROUP BY r.id, d.name, s.name, r.created_at
+ORDER BY d.name;
+
+-- name: ListDatarangeReplications :many
+-- Returns the replication status of every datarange of a datas3t with a replica,
+-- dataranges the worker has not picked up yet are pending
+SELECT
+    dr.id as datarange_id,
+    dr.min_datapoint_key,
+    dr.max_datapoint_key,
+    COALESCE(drr.status, 'pending')::VARCHAR as status,
+    COALESCE(drr.attempts, 0)::INT as attempts,
+    COALESCE(drr.last_error, '')::TEXT as last_error,
+    drr.replicated_at
+FROM datas3t_replicas r
+JOIN datas3ts d ON r.datas3t_id = d.id
+JOIN dataranges dr ON dr.datas3t_id = d.id
+LEFT JOIN datarange_replications drr ON drr.datarange_id = dr.id AND drr.replica_id = r.id
+WHERE d.name = $1
+ORDER BY dr.min_datapoint_key;
+
+-- name: GetDatarangesToReplicate :many
+-- Returns dataranges not yet copied to the replica of their datas3t. Failed copies and
+-- copies abandoned by a stopped worker are returned again once their last attempt is
+-- older than retry_before.
+SELECT
+    dr.id,
+    dr.data_object_key,
+    dr.index_object_key,
+    dr.size_bytes,
+    dr.storage_class,
+    r.id as replica_id,
+    d.name as datas3t_name,
+    s.key_prefix,
+    s.endpoint,
+    s.bucket,
+    s.access_key,
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key,
+    rs.key_prefix as replica_key_prefix,
+    rs.endpoint as replica_endpoint,
+    rs.bucket as replica_bucket,
+    rs.access_key as replica_access_key,
+    rs.secret_key as replica_secret_key,
+    rs.region as replica_region,
+    rs.addressing_style as replica_addressing_style,
+    rs.session_token as replica_session_token,
+    rs.credential_mode as replica_credential_mode,
+    rs.sse_mode as replica_sse_mode,
+    rs.sse_kms_key_id as replica_sse_kms_key_id,
+    rs.sse_customer_key as replica_sse_customer_key
+FROM datas3t_replicas r
+JOIN datas3ts d ON r.datas3t_id = d.id
+JOIN s3_buckets s ON d.s3_bucket_id = s.id
+JOIN s3_buckets rs ON r.s3_bucket_id = rs.id
+JOIN dataranges dr ON dr.datas3t_id = d.id
+LEFT JOIN datarange_replications drr ON drr.datarange_id = dr.id AND drr.replica_id = r.id
+WHERE drr.datarange_id IS NULL
+   OR (drr.status <> 'replicated' AND drr.updated_at < @retry_before::timestamp)
+ORDER BY dr.id
+LIMIT @max_dataranges::int;
+
+-- name: StartDatarangeReplication :exec
+INSERT INTO datarange_replications (datarange_id, replica_id, data_object_key, index_object_key, status, attempts)
+VALUES (@datarange_id, @replica_id, @data_object_key, @index_object_key, 'pending', 1)
+ON CONFLICT (datarange_id, replica_id) DO UPDATE
+SET status = 'pending',
+    attempts = datarange_replications.attempts + 1,
+    updated_at = CURRENT_TIMESTAMP;
+
+-- name: SetDatarangeReplicated :execrows
+UPDATE datarange_replications
+SET status = 'replicated',
+    last_error = '',
+    replicated_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE datarange_id = @datarange_id AND replica_id = @replica_id;
+
+-- name: SetDatarangeReplicationFailed :exec
+UPDATE datarange_replications
+SET status = 'failed',
+    last_error = @last_error,
+    updated_at = CURRENT_TIMESTAMP
+WHERE datarange_id = @datarange_id AND replica_id = @replica_id;
+
+-- name: GetDatarangeReplicas :many
+-- Returns the copies of dataranges in the replicas of their datas3t, downloads fail over
+-- to them when the bucket of the datas3t fails
+SELECT
+    drr.datarange_id,
+    drr.data_object_key,
+    drr.index_object_key,
+    s.endpoint,
+    s.bucket,
+    s.access_key,
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
+FROM datarange_replications drr
+JOIN datas3t_replicas r ON drr.replica_id = r.id
+JOIN s3_buckets s ON r.s3_bucket_id = s.id
+WHERE drr.datarange_id = ANY($1::BIGINT[])
+  AND drr.status = 'replicated';
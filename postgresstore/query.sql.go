@@ -7,6 +7,8 @@ package postgresstore
 
 import (
 	"context"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 const addBucket = `-- name: AddBucket :exec
@@ -15,17 +17,33 @@ INSERT INTO s3_buckets (
         endpoint,
         bucket,
         access_key,
-        secret_key
+        secret_key,
+        region,
+        addressing_style,
+        session_token,
+        credential_mode,
+        key_prefix,
+        sse_mode,
+        sse_kms_key_id,
+        sse_customer_key
     )
-VALUES ($1, $2, $3, $4, $5)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 `
 
 type AddBucketParams struct {
-	Name      string
-	Endpoint  string
-	Bucket    string
-	AccessKey string
-	SecretKey string
+	Name            string
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
+	KeyPrefix       string
+	SseMode         string
+	SseKmsKeyID     string
+	SseCustomerKey  string
 }
 
 func (q *Queries) AddBucket(ctx context.Context, arg AddBucketParams) error {
@@ -35,6 +53,14 @@ func (q *Queries) AddBucket(ctx context.Context, arg AddBucketParams) error {
 		arg.Bucket,
 		arg.AccessKey,
 		arg.SecretKey,
+		arg.Region,
+		arg.AddressingStyle,
+		arg.SessionToken,
+		arg.CredentialMode,
+		arg.KeyPrefix,
+		arg.SseMode,
+		arg.SseKmsKeyID,
+		arg.SseCustomerKey,
 	)
 	return err
 }
@@ -67,19 +93,20 @@ func (q *Queries) AddDatarangeUpload(ctx context.Context, arg AddDatarangeUpload
 }
 
 const addDatas3t = `-- name: AddDatas3t :exec
-INSERT INTO datas3ts (name, s3_bucket_id) 
-SELECT $1, id 
+INSERT INTO datas3ts (name, s3_bucket_id, encrypted) 
+SELECT $1, id, $2
 FROM s3_buckets 
-WHERE s3_buckets.name = $2
+WHERE s3_buckets.name = $3
 `
 
 type AddDatas3tParams struct {
 	Datas3tName string
+	Encrypted   bool
 	BucketName  string
 }
 
 func (q *Queries) AddDatas3t(ctx context.Context, arg AddDatas3tParams) error {
-	_, err := q.db.Exec(ctx, addDatas3t, arg.Datas3tName, arg.BucketName)
+	_, err := q.db.Exec(ctx, addDatas3t, arg.Datas3tName, arg.Encrypted, arg.BucketName)
 	return err
 }
 
@@ -133,6 +160,33 @@ func (q *Queries) AllDatas3ts(ctx context.Context) ([]string, error) {
 	return items, nil
 }
 
+const allocateDatapointKeys = `-- name: AllocateDatapointKeys :one
+UPDATE datas3ts
+SET next_datapoint_key = GREATEST(
+        next_datapoint_key,
+        (SELECT COALESCE(MAX(dr.max_datapoint_key) + 1, 0) FROM dataranges dr WHERE dr.datas3t_id = datas3ts.id),
+        (SELECT COALESCE(MAX(du.first_datapoint_index + du.number_of_datapoints), 0) FROM datarange_uploads du WHERE du.datas3t_id = datas3ts.id)
+    ) + $1::bigint,
+    updated_at = CURRENT_TIMESTAMP
+WHERE datas3ts.id = $2
+RETURNING (next_datapoint_key - $1::bigint)::bigint AS first_datapoint_key
+`
+
+type AllocateDatapointKeysParams struct {
+	NumberOfDatapoints int64
+	ID                 int64
+}
+
+// Reserves the next number_of_datapoints keys of a datas3t for an append-mode upload.
+// Allocation starts after the highest allocated, stored or pending key and is
+// serialized by the row lock on the datas3t.
+func (q *Queries) AllocateDatapointKeys(ctx context.Context, arg AllocateDatapointKeysParams) (int64, error) {
+	row := q.db.QueryRow(ctx, allocateDatapointKeys, arg.NumberOfDatapoints, arg.ID)
+	var first_datapoint_key int64
+	err := row.Scan(&first_datapoint_key)
+	return first_datapoint_key, err
+}
+
 const bucketExists = `-- name: BucketExists :one
 SELECT count(*) > 0
 FROM s3_buckets
@@ -333,6 +387,21 @@ func (q *Queries) CountDatarangesForDatas3t(ctx context.Context, name string) (i
 	return column_1, err
 }
 
+const countDatas3tsForBucket = `-- name: CountDatas3tsForBucket :one
+SELECT count(*)
+FROM datas3ts d
+WHERE d.s3_bucket_id = $1
+   OR EXISTS (SELECT 1 FROM datas3t_replicas r WHERE r.datas3t_id = d.id AND r.s3_bucket_id = $1)
+`
+
+// Counts the datas3ts storing their dataranges or their replica in a bucket
+func (q *Queries) CountDatas3tsForBucket(ctx context.Context, s3BucketID int64) (int64, error) {
+	row := q.db.QueryRow(ctx, countDatas3tsForBucket, s3BucketID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countKeysToDelete = `-- name: CountKeysToDelete :one
 SELECT count(*)
 FROM objects_to_delete
@@ -357,6 +426,19 @@ func (q *Queries) CountObjectsToDelete(ctx context.Context) (int64, error) {
 	return count, err
 }
 
+const countObjectsToDeleteForBucket = `-- name: CountObjectsToDeleteForBucket :one
+SELECT count(*)
+FROM objects_to_delete
+WHERE s3_bucket_id = $1
+`
+
+func (q *Queries) CountObjectsToDeleteForBucket(ctx context.Context, s3BucketID *int64) (int64, error) {
+	row := q.db.QueryRow(ctx, countObjectsToDeleteForBucket, s3BucketID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createAggregateUpload = `-- name: CreateAggregateUpload :one
 INSERT INTO aggregate_uploads (
     datas3t_id,
@@ -400,8 +482,8 @@ func (q *Queries) CreateAggregateUpload(ctx context.Context, arg CreateAggregate
 }
 
 const createDatarange = `-- name: CreateDatarange :one
-INSERT INTO dataranges (datas3t_id, data_object_key, index_object_key, min_datapoint_key, max_datapoint_key, size_bytes)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO dataranges (datas3t_id, data_object_key, index_object_key, min_datapoint_key, max_datapoint_key, size_bytes, wrapped_data_key)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
 RETURNING id
 `
 
@@ -412,6 +494,7 @@ type CreateDatarangeParams struct {
 	MinDatapointKey int64
 	MaxDatapointKey int64
 	SizeBytes       int64
+	WrappedDataKey  string
 }
 
 func (q *Queries) CreateDatarange(ctx context.Context, arg CreateDatarangeParams) (int64, error) {
@@ -422,6 +505,7 @@ func (q *Queries) CreateDatarange(ctx context.Context, arg CreateDatarangeParams
 		arg.MinDatapointKey,
 		arg.MaxDatapointKey,
 		arg.SizeBytes,
+		arg.WrappedDataKey,
 	)
 	var id int64
 	err := row.Scan(&id)
@@ -436,20 +520,26 @@ INSERT INTO datarange_uploads (
     index_object_key,
     first_datapoint_index, 
     number_of_datapoints, 
-    data_size
+    data_size,
+    streamed,
+    replaced_datarange_ids,
+    wrapped_data_key
 )
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 RETURNING id
 `
 
 type CreateDatarangeUploadParams struct {
-	Datas3tID           int64
-	UploadID            string
-	DataObjectKey       string
-	IndexObjectKey      string
-	FirstDatapointIndex int64
-	NumberOfDatapoints  int64
-	DataSize            int64
+	Datas3tID            int64
+	UploadID             string
+	DataObjectKey        string
+	IndexObjectKey       string
+	FirstDatapointIndex  int64
+	NumberOfDatapoints   int64
+	DataSize             int64
+	Streamed             bool
+	ReplacedDatarangeIds []int64
+	WrappedDataKey       string
 }
 
 func (q *Queries) CreateDatarangeUpload(ctx context.Context, arg CreateDatarangeUploadParams) (int64, error) {
@@ -461,6 +551,9 @@ func (q *Queries) CreateDatarangeUpload(ctx context.Context, arg CreateDatarange
 		arg.FirstDatapointIndex,
 		arg.NumberOfDatapoints,
 		arg.DataSize,
+		arg.Streamed,
+		arg.ReplacedDatarangeIds,
+		arg.WrappedDataKey,
 	)
 	var id int64
 	err := row.Scan(&id)
@@ -479,6 +572,39 @@ func (q *Queries) Datas3tExists(ctx context.Context) (bool, error) {
 	return column_1, err
 }
 
+const declareStreamedDatarangeUpload = `-- name: DeclareStreamedDatarangeUpload :exec
+UPDATE datarange_uploads
+SET first_datapoint_index = $1,
+    number_of_datapoints = $2,
+    data_size = $3,
+    data_object_key = $4,
+    index_object_key = $5,
+    streamed = false,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $6 AND streamed
+`
+
+type DeclareStreamedDatarangeUploadParams struct {
+	FirstDatapointIndex int64
+	NumberOfDatapoints  int64
+	DataSize            int64
+	DataObjectKey       string
+	IndexObjectKey      string
+	ID                  int64
+}
+
+func (q *Queries) DeclareStreamedDatarangeUpload(ctx context.Context, arg DeclareStreamedDatarangeUploadParams) error {
+	_, err := q.db.Exec(ctx, declareStreamedDatarangeUpload,
+		arg.FirstDatapointIndex,
+		arg.NumberOfDatapoints,
+		arg.DataSize,
+		arg.DataObjectKey,
+		arg.IndexObjectKey,
+		arg.ID,
+	)
+	return err
+}
+
 const deleteAggregateUpload = `-- name: DeleteAggregateUpload :exec
 DELETE FROM aggregate_uploads WHERE id = $1
 `
@@ -488,6 +614,15 @@ func (q *Queries) DeleteAggregateUpload(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteBucket = `-- name: DeleteBucket :exec
+DELETE FROM s3_buckets WHERE id = $1
+`
+
+func (q *Queries) DeleteBucket(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteBucket, id)
+	return err
+}
+
 const deleteDatarange = `-- name: DeleteDatarange :exec
 DELETE FROM dataranges WHERE id = $1
 `
@@ -524,6 +659,15 @@ func (q *Queries) DeleteDatas3t(ctx context.Context, name string) error {
 	return err
 }
 
+const deleteDatas3tReplica = `-- name: DeleteDatas3tReplica :exec
+DELETE FROM datas3t_replicas WHERE id = $1
+`
+
+func (q *Queries) DeleteDatas3tReplica(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, deleteDatas3tReplica, id)
+	return err
+}
+
 const deleteKeysToDelete = `-- name: DeleteKeysToDelete :exec
 DELETE FROM objects_to_delete WHERE id = ANY($1::BIGINT[])
 `
@@ -542,6 +686,15 @@ func (q *Queries) DeleteObjectsToDelete(ctx context.Context, dollar_1 []int64) e
 	return err
 }
 
+const deleteStorageClassRules = `-- name: DeleteStorageClassRules :exec
+DELETE FROM storage_class_rules WHERE datas3t_id = $1
+`
+
+func (q *Queries) DeleteStorageClassRules(ctx context.Context, datas3tID int64) error {
+	_, err := q.db.Exec(ctx, deleteStorageClassRules, datas3tID)
+	return err
+}
+
 const getAggregateUploadWithDetails = `-- name: GetAggregateUploadWithDetails :one
 SELECT 
     au.id,
@@ -555,10 +708,18 @@ SELECT
     au.index_object_key,
     d.name as datas3t_name,
     d.s3_bucket_id,
+    d.encrypted,
     s.endpoint,
     s.bucket,
     s.access_key,
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
 FROM aggregate_uploads au
 JOIN datas3ts d ON au.datas3t_id = d.id
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
@@ -577,10 +738,18 @@ type GetAggregateUploadWithDetailsRow struct {
 	IndexObjectKey      string
 	Datas3tName         string
 	S3BucketID          int64
+	Encrypted           bool
 	Endpoint            string
 	Bucket              string
 	AccessKey           string
 	SecretKey           string
+	Region              string
+	AddressingStyle     string
+	SessionToken        string
+	CredentialMode      string
+	SseMode             string
+	SseKmsKeyID         string
+	SseCustomerKey      string
 }
 
 func (q *Queries) GetAggregateUploadWithDetails(ctx context.Context, id int64) (GetAggregateUploadWithDetailsRow, error) {
@@ -598,10 +767,18 @@ func (q *Queries) GetAggregateUploadWithDetails(ctx context.Context, id int64) (
 		&i.IndexObjectKey,
 		&i.Datas3tName,
 		&i.S3BucketID,
+		&i.Encrypted,
 		&i.Endpoint,
 		&i.Bucket,
 		&i.AccessKey,
 		&i.SecretKey,
+		&i.Region,
+		&i.AddressingStyle,
+		&i.SessionToken,
+		&i.CredentialMode,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKey,
 	)
 	return i, err
 }
@@ -687,18 +864,27 @@ func (q *Queries) GetAllDataranges(ctx context.Context) ([]GetAllDatarangesRow,
 }
 
 const getBucketCredentials = `-- name: GetBucketCredentials :one
-SELECT id, name, endpoint, bucket, access_key, secret_key
+SELECT id, name, endpoint, bucket, access_key, secret_key, region, addressing_style, session_token, credential_mode, key_prefix,
+       sse_mode, sse_kms_key_id, sse_customer_key
 FROM s3_buckets
 WHERE name = $1
 `
 
 type GetBucketCredentialsRow struct {
-	ID        int64
-	Name      string
-	Endpoint  string
-	Bucket    string
-	AccessKey string
-	SecretKey string
+	ID              int64
+	Name            string
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
+	KeyPrefix       string
+	SseMode         string
+	SseKmsKeyID     string
+	SseCustomerKey  string
 }
 
 func (q *Queries) GetBucketCredentials(ctx context.Context, name string) (GetBucketCredentialsRow, error) {
@@ -711,6 +897,92 @@ func (q *Queries) GetBucketCredentials(ctx context.Context, name string) (GetBuc
 		&i.Bucket,
 		&i.AccessKey,
 		&i.SecretKey,
+		&i.Region,
+		&i.AddressingStyle,
+		&i.SessionToken,
+		&i.CredentialMode,
+		&i.KeyPrefix,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKey,
+	)
+	return i, err
+}
+
+const getDatapointGaps = `-- name: GetDatapointGaps :many
+WITH ordered AS (
+    SELECT
+        dr.min_datapoint_key,
+        MAX(dr.max_datapoint_key) OVER (
+            ORDER BY dr.min_datapoint_key
+            ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING
+        ) AS previous_max_key
+    FROM dataranges dr
+    JOIN datas3ts d ON dr.datas3t_id = d.id
+    WHERE d.name = $1
+)
+SELECT
+    (previous_max_key + 1)::bigint AS first_missing_key,
+    (min_datapoint_key - 1)::bigint AS last_missing_key
+FROM ordered
+WHERE previous_max_key IS NOT NULL
+  AND min_datapoint_key > previous_max_key + 1
+ORDER BY min_datapoint_key
+`
+
+type GetDatapointGapsRow struct {
+	FirstMissingKey int64
+	LastMissingKey  int64
+}
+
+// Returns the missing datapoint key intervals between the lowest and the highest
+// datapoint key of a datas3t. The running maximum guards against overlapping ranges.
+func (q *Queries) GetDatapointGaps(ctx context.Context, datas3tName string) ([]GetDatapointGapsRow, error) {
+	rows, err := q.db.Query(ctx, getDatapointGaps, datas3tName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDatapointGapsRow
+	for rows.Next() {
+		var i GetDatapointGapsRow
+		if err := rows.Scan(&i.FirstMissingKey, &i.LastMissingKey); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDatapointKeyRange = `-- name: GetDatapointKeyRange :one
+SELECT
+    COUNT(dr.id)::bigint AS datarange_count,
+    COALESCE(MIN(dr.min_datapoint_key), 0)::bigint AS lowest_datapoint,
+    COALESCE(MAX(dr.max_datapoint_key), 0)::bigint AS highest_datapoint,
+    COALESCE(SUM(dr.max_datapoint_key - dr.min_datapoint_key + 1), 0)::bigint AS total_datapoints
+FROM dataranges dr
+JOIN datas3ts d ON dr.datas3t_id = d.id
+WHERE d.name = $1
+`
+
+type GetDatapointKeyRangeRow struct {
+	DatarangeCount   int64
+	LowestDatapoint  int64
+	HighestDatapoint int64
+	TotalDatapoints  int64
+}
+
+func (q *Queries) GetDatapointKeyRange(ctx context.Context, datas3tName string) (GetDatapointKeyRangeRow, error) {
+	row := q.db.QueryRow(ctx, getDatapointKeyRange, datas3tName)
+	var i GetDatapointKeyRangeRow
+	err := row.Scan(
+		&i.DatarangeCount,
+		&i.LowestDatapoint,
+		&i.HighestDatapoint,
+		&i.TotalDatapoints,
 	)
 	return i, err
 }
@@ -728,7 +1000,11 @@ SELECT
     s.endpoint,
     s.bucket,
     s.access_key,
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode
 FROM dataranges dr
 JOIN datas3ts d ON dr.datas3t_id = d.id
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
@@ -756,6 +1032,10 @@ type GetDatarangeByExactRangeRow struct {
 	Bucket          string
 	AccessKey       string
 	SecretKey       string
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
 }
 
 func (q *Queries) GetDatarangeByExactRange(ctx context.Context, arg GetDatarangeByExactRangeParams) (GetDatarangeByExactRangeRow, error) {
@@ -774,6 +1054,10 @@ func (q *Queries) GetDatarangeByExactRange(ctx context.Context, arg GetDatarange
 		&i.Bucket,
 		&i.AccessKey,
 		&i.SecretKey,
+		&i.Region,
+		&i.AddressingStyle,
+		&i.SessionToken,
+		&i.CredentialMode,
 	)
 	return i, err
 }
@@ -809,6 +1093,83 @@ func (q *Queries) GetDatarangeFields(ctx context.Context) ([]GetDatarangeFieldsR
 	return items, nil
 }
 
+const getDatarangeReplicas = `-- name: GetDatarangeReplicas :many
+SELECT
+    drr.datarange_id,
+    drr.data_object_key,
+    drr.index_object_key,
+    s.endpoint,
+    s.bucket,
+    s.access_key,
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
+FROM datarange_replications drr
+JOIN datas3t_replicas r ON drr.replica_id = r.id
+JOIN s3_buckets s ON r.s3_bucket_id = s.id
+WHERE drr.datarange_id = ANY($1::BIGINT[])
+  AND drr.status = 'replicated'
+`
+
+type GetDatarangeReplicasRow struct {
+	DatarangeID     int64
+	DataObjectKey   string
+	IndexObjectKey  string
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
+	SseMode         string
+	SseKmsKeyID     string
+	SseCustomerKey  string
+}
+
+// Returns the copies of dataranges in the replicas of their datas3t, downloads fail over
+// to them when the bucket of the datas3t fails
+func (q *Queries) GetDatarangeReplicas(ctx context.Context, dollar_1 []int64) ([]GetDatarangeReplicasRow, error) {
+	rows, err := q.db.Query(ctx, getDatarangeReplicas, dollar_1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDatarangeReplicasRow
+	for rows.Next() {
+		var i GetDatarangeReplicasRow
+		if err := rows.Scan(
+			&i.DatarangeID,
+			&i.DataObjectKey,
+			&i.IndexObjectKey,
+			&i.Endpoint,
+			&i.Bucket,
+			&i.AccessKey,
+			&i.SecretKey,
+			&i.Region,
+			&i.AddressingStyle,
+			&i.SessionToken,
+			&i.CredentialMode,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getDatarangeUploadIDs = `-- name: GetDatarangeUploadIDs :many
 SELECT upload_id
 FROM datarange_uploads
@@ -844,12 +1205,23 @@ SELECT
     du.data_size,
     du.data_object_key, 
     du.index_object_key,
+    du.streamed,
+    du.replaced_datarange_ids,
+    du.wrapped_data_key,
     d.name as datas3t_name, 
     d.s3_bucket_id,
     s.endpoint, 
     s.bucket, 
     s.access_key, 
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.key_prefix,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
 FROM datarange_uploads du
 JOIN datas3ts d ON du.datas3t_id = d.id
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
@@ -857,20 +1229,31 @@ WHERE du.id = $1
 `
 
 type GetDatarangeUploadWithDetailsRow struct {
-	ID                  int64
-	Datas3tID           int64
-	UploadID            string
-	FirstDatapointIndex int64
-	NumberOfDatapoints  int64
-	DataSize            int64
-	DataObjectKey       string
-	IndexObjectKey      string
-	Datas3tName         string
-	S3BucketID          int64
-	Endpoint            string
-	Bucket              string
-	AccessKey           string
-	SecretKey           string
+	ID                   int64
+	Datas3tID            int64
+	UploadID             string
+	FirstDatapointIndex  int64
+	NumberOfDatapoints   int64
+	DataSize             int64
+	DataObjectKey        string
+	IndexObjectKey       string
+	Streamed             bool
+	ReplacedDatarangeIds []int64
+	WrappedDataKey       string
+	Datas3tName          string
+	S3BucketID           int64
+	Endpoint             string
+	Bucket               string
+	AccessKey            string
+	SecretKey            string
+	Region               string
+	AddressingStyle      string
+	SessionToken         string
+	CredentialMode       string
+	KeyPrefix            string
+	SseMode              string
+	SseKmsKeyID          string
+	SseCustomerKey       string
 }
 
 func (q *Queries) GetDatarangeUploadWithDetails(ctx context.Context, id int64) (GetDatarangeUploadWithDetailsRow, error) {
@@ -885,16 +1268,119 @@ func (q *Queries) GetDatarangeUploadWithDetails(ctx context.Context, id int64) (
 		&i.DataSize,
 		&i.DataObjectKey,
 		&i.IndexObjectKey,
+		&i.Streamed,
+		&i.ReplacedDatarangeIds,
+		&i.WrappedDataKey,
 		&i.Datas3tName,
 		&i.S3BucketID,
 		&i.Endpoint,
 		&i.Bucket,
 		&i.AccessKey,
 		&i.SecretKey,
+		&i.Region,
+		&i.AddressingStyle,
+		&i.SessionToken,
+		&i.CredentialMode,
+		&i.KeyPrefix,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKey,
 	)
 	return i, err
 }
 
+const getDatarangesByDataObjectKeys = `-- name: GetDatarangesByDataObjectKeys :many
+SELECT 
+    dr.id,
+    dr.data_object_key,
+    dr.min_datapoint_key,
+    dr.wrapped_data_key,
+    dr.storage_class,
+    dr.restore_expires_at,
+    d.name as datas3t_name,
+    s.endpoint,
+    s.bucket,
+    s.access_key,
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
+FROM dataranges dr
+JOIN datas3ts d ON dr.datas3t_id = d.id
+JOIN s3_buckets s ON d.s3_bucket_id = s.id
+WHERE d.name = $1
+  AND dr.data_object_key = ANY($2::text[])
+`
+
+type GetDatarangesByDataObjectKeysParams struct {
+	Datas3tName    string
+	DataObjectKeys []string
+}
+
+type GetDatarangesByDataObjectKeysRow struct {
+	ID               int64
+	DataObjectKey    string
+	MinDatapointKey  int64
+	WrappedDataKey   string
+	StorageClass     string
+	RestoreExpiresAt pgtype.Timestamp
+	Datas3tName      string
+	Endpoint         string
+	Bucket           string
+	AccessKey        string
+	SecretKey        string
+	Region           string
+	AddressingStyle  string
+	SessionToken     string
+	CredentialMode   string
+	SseMode          string
+	SseKmsKeyID      string
+	SseCustomerKey   string
+}
+
+func (q *Queries) GetDatarangesByDataObjectKeys(ctx context.Context, arg GetDatarangesByDataObjectKeysParams) ([]GetDatarangesByDataObjectKeysRow, error) {
+	rows, err := q.db.Query(ctx, getDatarangesByDataObjectKeys, arg.Datas3tName, arg.DataObjectKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDatarangesByDataObjectKeysRow
+	for rows.Next() {
+		var i GetDatarangesByDataObjectKeysRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DataObjectKey,
+			&i.MinDatapointKey,
+			&i.WrappedDataKey,
+			&i.StorageClass,
+			&i.RestoreExpiresAt,
+			&i.Datas3tName,
+			&i.Endpoint,
+			&i.Bucket,
+			&i.AccessKey,
+			&i.SecretKey,
+			&i.Region,
+			&i.AddressingStyle,
+			&i.SessionToken,
+			&i.CredentialMode,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getDatarangesForDatapoints = `-- name: GetDatarangesForDatapoints :many
 SELECT 
     dr.id,
@@ -903,11 +1389,21 @@ SELECT
     dr.min_datapoint_key,
     dr.max_datapoint_key,
     dr.size_bytes,
+    dr.wrapped_data_key,
+    dr.storage_class,
+    dr.restore_expires_at,
     d.name as datas3t_name,
     s.endpoint,
     s.bucket,
     s.access_key,
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
 FROM dataranges dr
 JOIN datas3ts d ON dr.datas3t_id = d.id
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
@@ -924,17 +1420,27 @@ type GetDatarangesForDatapointsParams struct {
 }
 
 type GetDatarangesForDatapointsRow struct {
-	ID              int64
-	DataObjectKey   string
-	IndexObjectKey  string
-	MinDatapointKey int64
-	MaxDatapointKey int64
-	SizeBytes       int64
-	Datas3tName     string
-	Endpoint        string
-	Bucket          string
-	AccessKey       string
-	SecretKey       string
+	ID               int64
+	DataObjectKey    string
+	IndexObjectKey   string
+	MinDatapointKey  int64
+	MaxDatapointKey  int64
+	SizeBytes        int64
+	WrappedDataKey   string
+	StorageClass     string
+	RestoreExpiresAt pgtype.Timestamp
+	Datas3tName      string
+	Endpoint         string
+	Bucket           string
+	AccessKey        string
+	SecretKey        string
+	Region           string
+	AddressingStyle  string
+	SessionToken     string
+	CredentialMode   string
+	SseMode          string
+	SseKmsKeyID      string
+	SseCustomerKey   string
 }
 
 func (q *Queries) GetDatarangesForDatapoints(ctx context.Context, arg GetDatarangesForDatapointsParams) ([]GetDatarangesForDatapointsRow, error) {
@@ -953,11 +1459,21 @@ func (q *Queries) GetDatarangesForDatapoints(ctx context.Context, arg GetDataran
 			&i.MinDatapointKey,
 			&i.MaxDatapointKey,
 			&i.SizeBytes,
+			&i.WrappedDataKey,
+			&i.StorageClass,
+			&i.RestoreExpiresAt,
 			&i.Datas3tName,
 			&i.Endpoint,
 			&i.Bucket,
 			&i.AccessKey,
 			&i.SecretKey,
+			&i.Region,
+			&i.AddressingStyle,
+			&i.SessionToken,
+			&i.CredentialMode,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKey,
 		); err != nil {
 			return nil, err
 		}
@@ -1001,6 +1517,73 @@ func (q *Queries) GetDatarangesForDatas3t(ctx context.Context, name string) ([]G
 	return items, nil
 }
 
+const getDatarangesForStorageClassRule = `-- name: GetDatarangesForStorageClassRule :many
+SELECT dr.id, dr.data_object_key, dr.size_bytes, dr.storage_class
+FROM dataranges dr
+WHERE dr.datas3t_id = $1
+  AND dr.storage_class = ANY($2::text[])
+  AND ($3::timestamp IS NULL OR dr.created_at < $3::timestamp)
+  AND ($4::bigint IS NULL OR dr.max_datapoint_key <= (
+      SELECT MAX(newest.max_datapoint_key) FROM dataranges newest WHERE newest.datas3t_id = $1
+  ) - $4::bigint)
+  AND NOT EXISTS (
+      SELECT 1 FROM aggregate_uploads au
+      WHERE au.datas3t_id = dr.datas3t_id AND dr.id = ANY(au.source_datarange_ids)
+  )
+ORDER BY dr.min_datapoint_key
+LIMIT $5::int
+`
+
+type GetDatarangesForStorageClassRuleParams struct {
+	Datas3tID            int64
+	WarmerStorageClasses []string
+	CreatedBefore        pgtype.Timestamp
+	MinKeysBehind        *int64
+	MaxDataranges        int32
+}
+
+type GetDatarangesForStorageClassRuleRow struct {
+	ID            int64
+	DataObjectKey string
+	SizeBytes     int64
+	StorageClass  string
+}
+
+// Returns the dataranges of a datas3t in one of the given warmer storage classes that
+// are older than created_before and whose max datapoint key is at least min_keys_behind
+// keys behind the newest datapoint of the datas3t. Sources of ongoing aggregations are
+// skipped, as they are about to be read.
+func (q *Queries) GetDatarangesForStorageClassRule(ctx context.Context, arg GetDatarangesForStorageClassRuleParams) ([]GetDatarangesForStorageClassRuleRow, error) {
+	rows, err := q.db.Query(ctx, getDatarangesForStorageClassRule,
+		arg.Datas3tID,
+		arg.WarmerStorageClasses,
+		arg.CreatedBefore,
+		arg.MinKeysBehind,
+		arg.MaxDataranges,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDatarangesForStorageClassRuleRow
+	for rows.Next() {
+		var i GetDatarangesForStorageClassRuleRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DataObjectKey,
+			&i.SizeBytes,
+			&i.StorageClass,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getDatarangesInRange = `-- name: GetDatarangesInRange :many
 SELECT 
     dr.id,
@@ -1009,6 +1592,9 @@ SELECT
     dr.min_datapoint_key,
     dr.max_datapoint_key,
     dr.size_bytes,
+    dr.wrapped_data_key,
+    dr.storage_class,
+    dr.restore_expires_at,
     d.name as datas3t_name,
     s.id as s3_bucket_id,
     s.endpoint,
@@ -1031,18 +1617,21 @@ type GetDatarangesInRangeParams struct {
 }
 
 type GetDatarangesInRangeRow struct {
-	ID              int64
-	DataObjectKey   string
-	IndexObjectKey  string
-	MinDatapointKey int64
-	MaxDatapointKey int64
-	SizeBytes       int64
-	Datas3tName     string
-	S3BucketID      int64
-	Endpoint        string
-	Bucket          string
-	AccessKey       string
-	SecretKey       string
+	ID               int64
+	DataObjectKey    string
+	IndexObjectKey   string
+	MinDatapointKey  int64
+	MaxDatapointKey  int64
+	SizeBytes        int64
+	WrappedDataKey   string
+	StorageClass     string
+	RestoreExpiresAt pgtype.Timestamp
+	Datas3tName      string
+	S3BucketID       int64
+	Endpoint         string
+	Bucket           string
+	AccessKey        string
+	SecretKey        string
 }
 
 func (q *Queries) GetDatarangesInRange(ctx context.Context, arg GetDatarangesInRangeParams) ([]GetDatarangesInRangeRow, error) {
@@ -1061,6 +1650,9 @@ func (q *Queries) GetDatarangesInRange(ctx context.Context, arg GetDatarangesInR
 			&i.MinDatapointKey,
 			&i.MaxDatapointKey,
 			&i.SizeBytes,
+			&i.WrappedDataKey,
+			&i.StorageClass,
+			&i.RestoreExpiresAt,
 			&i.Datas3tName,
 			&i.S3BucketID,
 			&i.Endpoint,
@@ -1078,6 +1670,145 @@ func (q *Queries) GetDatarangesInRange(ctx context.Context, arg GetDatarangesInR
 	return items, nil
 }
 
+const getDatarangesToReplicate = `-- name: GetDatarangesToReplicate :many
+SELECT
+    dr.id,
+    dr.data_object_key,
+    dr.index_object_key,
+    dr.size_bytes,
+    dr.storage_class,
+    r.id as replica_id,
+    d.name as datas3t_name,
+    s.key_prefix,
+    s.endpoint,
+    s.bucket,
+    s.access_key,
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key,
+    rs.key_prefix as replica_key_prefix,
+    rs.endpoint as replica_endpoint,
+    rs.bucket as replica_bucket,
+    rs.access_key as replica_access_key,
+    rs.secret_key as replica_secret_key,
+    rs.region as replica_region,
+    rs.addressing_style as replica_addressing_style,
+    rs.session_token as replica_session_token,
+    rs.credential_mode as replica_credential_mode,
+    rs.sse_mode as replica_sse_mode,
+    rs.sse_kms_key_id as replica_sse_kms_key_id,
+    rs.sse_customer_key as replica_sse_customer_key
+FROM datas3t_replicas r
+JOIN datas3ts d ON r.datas3t_id = d.id
+JOIN s3_buckets s ON d.s3_bucket_id = s.id
+JOIN s3_buckets rs ON r.s3_bucket_id = rs.id
+JOIN dataranges dr ON dr.datas3t_id = d.id
+LEFT JOIN datarange_replications drr ON drr.datarange_id = dr.id AND drr.replica_id = r.id
+WHERE drr.datarange_id IS NULL
+   OR (drr.status <> 'replicated' AND drr.updated_at < $1::timestamp)
+ORDER BY dr.id
+LIMIT $2::int
+`
+
+type GetDatarangesToReplicateParams struct {
+	RetryBefore   pgtype.Timestamp
+	MaxDataranges int32
+}
+
+type GetDatarangesToReplicateRow struct {
+	ID                     int64
+	DataObjectKey          string
+	IndexObjectKey         string
+	SizeBytes              int64
+	StorageClass           string
+	ReplicaID              int64
+	Datas3tName            string
+	KeyPrefix              string
+	Endpoint               string
+	Bucket                 string
+	AccessKey              string
+	SecretKey              string
+	Region                 string
+	AddressingStyle        string
+	SessionToken           string
+	CredentialMode         string
+	SseMode                string
+	SseKmsKeyID            string
+	SseCustomerKey         string
+	ReplicaKeyPrefix       string
+	ReplicaEndpoint        string
+	ReplicaBucket          string
+	ReplicaAccessKey       string
+	ReplicaSecretKey       string
+	ReplicaRegion          string
+	ReplicaAddressingStyle string
+	ReplicaSessionToken    string
+	ReplicaCredentialMode  string
+	ReplicaSseMode         string
+	ReplicaSseKmsKeyID     string
+	ReplicaSseCustomerKey  string
+}
+
+// Returns dataranges not yet copied to the replica of their datas3t. Failed copies and
+// copies abandoned by a stopped worker are returned again once their last attempt is
+// older than retry_before.
+func (q *Queries) GetDatarangesToReplicate(ctx context.Context, arg GetDatarangesToReplicateParams) ([]GetDatarangesToReplicateRow, error) {
+	rows, err := q.db.Query(ctx, getDatarangesToReplicate, arg.RetryBefore, arg.MaxDataranges)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetDatarangesToReplicateRow
+	for rows.Next() {
+		var i GetDatarangesToReplicateRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.DataObjectKey,
+			&i.IndexObjectKey,
+			&i.SizeBytes,
+			&i.StorageClass,
+			&i.ReplicaID,
+			&i.Datas3tName,
+			&i.KeyPrefix,
+			&i.Endpoint,
+			&i.Bucket,
+			&i.AccessKey,
+			&i.SecretKey,
+			&i.Region,
+			&i.AddressingStyle,
+			&i.SessionToken,
+			&i.CredentialMode,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKey,
+			&i.ReplicaKeyPrefix,
+			&i.ReplicaEndpoint,
+			&i.ReplicaBucket,
+			&i.ReplicaAccessKey,
+			&i.ReplicaSecretKey,
+			&i.ReplicaRegion,
+			&i.ReplicaAddressingStyle,
+			&i.ReplicaSessionToken,
+			&i.ReplicaCredentialMode,
+			&i.ReplicaSseMode,
+			&i.ReplicaSseKmsKeyID,
+			&i.ReplicaSseCustomerKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getDatas3tIDByName = `-- name: GetDatas3tIDByName :one
 SELECT id FROM datas3ts WHERE name = $1
 `
@@ -1089,23 +1820,54 @@ func (q *Queries) GetDatas3tIDByName(ctx context.Context, name string) (int64, e
 	return id, err
 }
 
+const getDatas3tReplica = `-- name: GetDatas3tReplica :one
+SELECT r.id, r.s3_bucket_id, s.name as bucket_name
+FROM datas3t_replicas r
+JOIN s3_buckets s ON r.s3_bucket_id = s.id
+WHERE r.datas3t_id = $1
+`
+
+type GetDatas3tReplicaRow struct {
+	ID         int64
+	S3BucketID int64
+	BucketName string
+}
+
+func (q *Queries) GetDatas3tReplica(ctx context.Context, datas3tID int64) (GetDatas3tReplicaRow, error) {
+	row := q.db.QueryRow(ctx, getDatas3tReplica, datas3tID)
+	var i GetDatas3tReplicaRow
+	err := row.Scan(&i.ID, &i.S3BucketID, &i.BucketName)
+	return i, err
+}
+
 const getDatas3tWithBucket = `-- name: GetDatas3tWithBucket :one
-SELECT d.id, d.name, d.s3_bucket_id, d.upload_counter,
-       s.endpoint, s.bucket, s.access_key, s.secret_key
+SELECT d.id, d.name, d.s3_bucket_id, d.upload_counter, d.encrypted,
+       s.endpoint, s.bucket, s.access_key, s.secret_key,
+       s.region, s.addressing_style, s.session_token, s.credential_mode, s.key_prefix,
+       s.sse_mode, s.sse_kms_key_id, s.sse_customer_key
 FROM datas3ts d
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
 WHERE d.name = $1
 `
 
 type GetDatas3tWithBucketRow struct {
-	ID            int64
-	Name          string
-	S3BucketID    int64
-	UploadCounter int64
-	Endpoint      string
-	Bucket        string
-	AccessKey     string
-	SecretKey     string
+	ID              int64
+	Name            string
+	S3BucketID      int64
+	UploadCounter   int64
+	Encrypted       bool
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
+	KeyPrefix       string
+	SseMode         string
+	SseKmsKeyID     string
+	SseCustomerKey  string
 }
 
 func (q *Queries) GetDatas3tWithBucket(ctx context.Context, name string) (GetDatas3tWithBucketRow, error) {
@@ -1116,10 +1878,19 @@ func (q *Queries) GetDatas3tWithBucket(ctx context.Context, name string) (GetDat
 		&i.Name,
 		&i.S3BucketID,
 		&i.UploadCounter,
+		&i.Encrypted,
 		&i.Endpoint,
 		&i.Bucket,
 		&i.AccessKey,
 		&i.SecretKey,
+		&i.Region,
+		&i.AddressingStyle,
+		&i.SessionToken,
+		&i.CredentialMode,
+		&i.KeyPrefix,
+		&i.SseMode,
+		&i.SseKmsKeyID,
+		&i.SseCustomerKey,
 	)
 	return i, err
 }
@@ -1164,7 +1935,11 @@ SELECT
     s.endpoint,
     s.bucket,
     s.access_key,
-    s.secret_key
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode
 FROM objects_to_delete otd
 JOIN s3_buckets s ON otd.s3_bucket_id = s.id
 WHERE otd.object_name IS NOT NULL
@@ -1173,12 +1948,16 @@ LIMIT $1
 `
 
 type GetObjectsToDeleteRow struct {
-	ID         int64
-	ObjectName *string
-	Endpoint   string
-	Bucket     string
-	AccessKey  string
-	SecretKey  string
+	ID              int64
+	ObjectName      *string
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
 }
 
 func (q *Queries) GetObjectsToDelete(ctx context.Context, limit int32) ([]GetObjectsToDeleteRow, error) {
@@ -1197,6 +1976,88 @@ func (q *Queries) GetObjectsToDelete(ctx context.Context, limit int32) ([]GetObj
 			&i.Bucket,
 			&i.AccessKey,
 			&i.SecretKey,
+			&i.Region,
+			&i.AddressingStyle,
+			&i.SessionToken,
+			&i.CredentialMode,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOverlappingDatarangeLease = `-- name: GetOverlappingDatarangeLease :one
+SELECT id, first_datapoint_index, number_of_datapoints, lease_expires_at
+FROM datarange_uploads
+WHERE datas3t_id = $1
+  AND id <> $2::bigint
+  AND lease_expires_at > CURRENT_TIMESTAMP
+  AND first_datapoint_index <= $3::bigint
+  AND (first_datapoint_index + number_of_datapoints - 1) >= $4::bigint
+ORDER BY first_datapoint_index
+LIMIT 1
+`
+
+type GetOverlappingDatarangeLeaseParams struct {
+	Datas3tID           int64
+	ExcludeUploadID     int64
+	LastDatapointIndex  int64
+	FirstDatapointIndex int64
+}
+
+type GetOverlappingDatarangeLeaseRow struct {
+	ID                  int64
+	FirstDatapointIndex int64
+	NumberOfDatapoints  int64
+	LeaseExpiresAt      pgtype.Timestamp
+}
+
+// Returns the active lease of another upload that overlaps the given datapoint key range
+func (q *Queries) GetOverlappingDatarangeLease(ctx context.Context, arg GetOverlappingDatarangeLeaseParams) (GetOverlappingDatarangeLeaseRow, error) {
+	row := q.db.QueryRow(ctx, getOverlappingDatarangeLease,
+		arg.Datas3tID,
+		arg.ExcludeUploadID,
+		arg.LastDatapointIndex,
+		arg.FirstDatapointIndex,
+	)
+	var i GetOverlappingDatarangeLeaseRow
+	err := row.Scan(
+		&i.ID,
+		&i.FirstDatapointIndex,
+		&i.NumberOfDatapoints,
+		&i.LeaseExpiresAt,
+	)
+	return i, err
+}
+
+const getStorageClassRules = `-- name: GetStorageClassRules :many
+SELECT id, datas3t_id, storage_class, min_age_days, min_keys_behind, created_at
+FROM storage_class_rules
+WHERE datas3t_id = $1
+ORDER BY id
+`
+
+func (q *Queries) GetStorageClassRules(ctx context.Context, datas3tID int64) ([]StorageClassRule, error) {
+	rows, err := q.db.Query(ctx, getStorageClassRules, datas3tID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []StorageClassRule
+	for rows.Next() {
+		var i StorageClassRule
+		if err := rows.Scan(
+			&i.ID,
+			&i.Datas3tID,
+			&i.StorageClass,
+			&i.MinAgeDays,
+			&i.MinKeysBehind,
+			&i.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1223,16 +2084,100 @@ func (q *Queries) IncrementUploadCounter(ctx context.Context, id int64) (int64,
 	return upload_counter, err
 }
 
+const insertDatas3tReplica = `-- name: InsertDatas3tReplica :exec
+INSERT INTO datas3t_replicas (datas3t_id, s3_bucket_id)
+VALUES ($1, $2)
+`
+
+type InsertDatas3tReplicaParams struct {
+	Datas3tID  int64
+	S3BucketID int64
+}
+
+func (q *Queries) InsertDatas3tReplica(ctx context.Context, arg InsertDatas3tReplicaParams) error {
+	_, err := q.db.Exec(ctx, insertDatas3tReplica, arg.Datas3tID, arg.S3BucketID)
+	return err
+}
+
+const insertStorageClassRule = `-- name: InsertStorageClassRule :exec
+INSERT INTO storage_class_rules (datas3t_id, storage_class, min_age_days, min_keys_behind)
+VALUES ($1, $2, $3, $4)
+`
+
+type InsertStorageClassRuleParams struct {
+	Datas3tID     int64
+	StorageClass  string
+	MinAgeDays    *int32
+	MinKeysBehind *int64
+}
+
+func (q *Queries) InsertStorageClassRule(ctx context.Context, arg InsertStorageClassRuleParams) error {
+	_, err := q.db.Exec(ctx, insertStorageClassRule,
+		arg.Datas3tID,
+		arg.StorageClass,
+		arg.MinAgeDays,
+		arg.MinKeysBehind,
+	)
+	return err
+}
+
+const listActiveDatarangeLeases = `-- name: ListActiveDatarangeLeases :many
+SELECT du.id, du.first_datapoint_index, du.number_of_datapoints, du.lease_expires_at
+FROM datarange_uploads du
+JOIN datas3ts d ON du.datas3t_id = d.id
+WHERE d.name = $1
+  AND du.lease_expires_at > CURRENT_TIMESTAMP
+ORDER BY du.first_datapoint_index, du.id
+`
+
+type ListActiveDatarangeLeasesRow struct {
+	ID                  int64
+	FirstDatapointIndex int64
+	NumberOfDatapoints  int64
+	LeaseExpiresAt      pgtype.Timestamp
+}
+
+func (q *Queries) ListActiveDatarangeLeases(ctx context.Context, datas3tName string) ([]ListActiveDatarangeLeasesRow, error) {
+	rows, err := q.db.Query(ctx, listActiveDatarangeLeases, datas3tName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListActiveDatarangeLeasesRow
+	for rows.Next() {
+		var i ListActiveDatarangeLeasesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.FirstDatapointIndex,
+			&i.NumberOfDatapoints,
+			&i.LeaseExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listAllBuckets = `-- name: ListAllBuckets :many
-SELECT name, endpoint, bucket
+SELECT name, endpoint, bucket, region, addressing_style, credential_mode, key_prefix, sse_mode, sse_kms_key_id
 FROM s3_buckets
 ORDER BY name
 `
 
 type ListAllBucketsRow struct {
-	Name     string
-	Endpoint string
-	Bucket   string
+	Name            string
+	Endpoint        string
+	Bucket          string
+	Region          string
+	AddressingStyle string
+	CredentialMode  string
+	KeyPrefix       string
+	SseMode         string
+	SseKmsKeyID     string
 }
 
 func (q *Queries) ListAllBuckets(ctx context.Context) ([]ListAllBucketsRow, error) {
@@ -1244,7 +2189,17 @@ func (q *Queries) ListAllBuckets(ctx context.Context) ([]ListAllBucketsRow, erro
 	var items []ListAllBucketsRow
 	for rows.Next() {
 		var i ListAllBucketsRow
-		if err := rows.Scan(&i.Name, &i.Endpoint, &i.Bucket); err != nil {
+		if err := rows.Scan(
+			&i.Name,
+			&i.Endpoint,
+			&i.Bucket,
+			&i.Region,
+			&i.AddressingStyle,
+			&i.CredentialMode,
+			&i.KeyPrefix,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -1255,38 +2210,214 @@ func (q *Queries) ListAllBuckets(ctx context.Context) ([]ListAllBucketsRow, erro
 	return items, nil
 }
 
-const listDatarangesForDatas3t = `-- name: ListDatarangesForDatas3t :many
-SELECT 
-    dr.id,
-    dr.data_object_key,
-    dr.index_object_key,
+const listAllBucketsWithCredentials = `-- name: ListAllBucketsWithCredentials :many
+SELECT name, endpoint, bucket, access_key, secret_key, region, addressing_style, session_token, credential_mode, key_prefix
+FROM s3_buckets
+ORDER BY name
+`
+
+type ListAllBucketsWithCredentialsRow struct {
+	Name            string
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
+	KeyPrefix       string
+}
+
+func (q *Queries) ListAllBucketsWithCredentials(ctx context.Context) ([]ListAllBucketsWithCredentialsRow, error) {
+	rows, err := q.db.Query(ctx, listAllBucketsWithCredentials)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListAllBucketsWithCredentialsRow
+	for rows.Next() {
+		var i ListAllBucketsWithCredentialsRow
+		if err := rows.Scan(
+			&i.Name,
+			&i.Endpoint,
+			&i.Bucket,
+			&i.AccessKey,
+			&i.SecretKey,
+			&i.Region,
+			&i.AddressingStyle,
+			&i.SessionToken,
+			&i.CredentialMode,
+			&i.KeyPrefix,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDatarangeReplications = `-- name: ListDatarangeReplications :many
+SELECT
+    dr.id as datarange_id,
     dr.min_datapoint_key,
     dr.max_datapoint_key,
-    dr.size_bytes
-FROM dataranges dr
-JOIN datas3ts d ON dr.datas3t_id = d.id
+    COALESCE(drr.status, 'pending')::VARCHAR as status,
+    COALESCE(drr.attempts, 0)::INT as attempts,
+    COALESCE(drr.last_error, '')::TEXT as last_error,
+    drr.replicated_at
+FROM datas3t_replicas r
+JOIN datas3ts d ON r.datas3t_id = d.id
+JOIN dataranges dr ON dr.datas3t_id = d.id
+LEFT JOIN datarange_replications drr ON drr.datarange_id = dr.id AND drr.replica_id = r.id
 WHERE d.name = $1
 ORDER BY dr.min_datapoint_key
 `
 
-type ListDatarangesForDatas3tRow struct {
+type ListDatarangeReplicationsRow struct {
+	DatarangeID     int64
+	MinDatapointKey int64
+	MaxDatapointKey int64
+	Status          string
+	Attempts        int32
+	LastError       string
+	ReplicatedAt    pgtype.Timestamp
+}
+
+// Returns the replication status of every datarange of a datas3t with a replica,
+// dataranges the worker has not picked up yet are pending
+func (q *Queries) ListDatarangeReplications(ctx context.Context, name string) ([]ListDatarangeReplicationsRow, error) {
+	rows, err := q.db.Query(ctx, listDatarangeReplications, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDatarangeReplicationsRow
+	for rows.Next() {
+		var i ListDatarangeReplicationsRow
+		if err := rows.Scan(
+			&i.DatarangeID,
+			&i.MinDatapointKey,
+			&i.MaxDatapointKey,
+			&i.Status,
+			&i.Attempts,
+			&i.LastError,
+			&i.ReplicatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDatarangesPage = `-- name: ListDatarangesPage :many
+WITH filtered AS (
+    SELECT
+        dr.id,
+        dr.data_object_key,
+        dr.index_object_key,
+        dr.min_datapoint_key,
+        dr.max_datapoint_key,
+        dr.size_bytes,
+        dr.created_at,
+        dr.storage_class,
+        (CASE $5::text
+            WHEN 'size' THEN dr.size_bytes
+            WHEN 'created_at' THEN COALESCE((EXTRACT(EPOCH FROM dr.created_at) * 1000000)::bigint, 0)
+            ELSE dr.min_datapoint_key
+        END)::bigint AS sort_value
+    FROM dataranges dr
+    JOIN datas3ts d ON dr.datas3t_id = d.id
+    WHERE d.name = $6
+      AND ($7::bigint IS NULL OR dr.max_datapoint_key >= $7::bigint)
+      AND ($8::bigint IS NULL OR dr.min_datapoint_key <= $8::bigint)
+      AND ($9::bigint IS NULL OR dr.size_bytes >= $9::bigint)
+      AND ($10::bigint IS NULL OR dr.size_bytes <= $10::bigint)
+      AND ($11::timestamp IS NULL OR dr.created_at >= $11::timestamp)
+      AND ($12::timestamp IS NULL OR dr.created_at < $12::timestamp)
+)
+SELECT
+    id,
+    data_object_key,
+    index_object_key,
+    min_datapoint_key,
+    max_datapoint_key,
+    size_bytes,
+    created_at,
+    storage_class,
+    sort_value
+FROM filtered
+WHERE $1::bigint IS NULL
+   OR ($2::boolean AND (sort_value, id) < ($1::bigint, $3::bigint))
+   OR (NOT $2::boolean AND (sort_value, id) > ($1::bigint, $3::bigint))
+ORDER BY
+    CASE WHEN $2::boolean THEN sort_value END DESC,
+    CASE WHEN $2::boolean THEN id END DESC,
+    sort_value ASC,
+    id ASC
+LIMIT $4::int
+`
+
+type ListDatarangesPageParams struct {
+	CursorSortValue  *int64
+	Descending       bool
+	CursorID         int64
+	PageLimit        int32
+	SortBy           string
+	Datas3tName      string
+	FromDatapointKey *int64
+	ToDatapointKey   *int64
+	MinSizeBytes     *int64
+	MaxSizeBytes     *int64
+	CreatedAfter     pgtype.Timestamp
+	CreatedBefore    pgtype.Timestamp
+}
+
+type ListDatarangesPageRow struct {
 	ID              int64
 	DataObjectKey   string
 	IndexObjectKey  string
 	MinDatapointKey int64
 	MaxDatapointKey int64
 	SizeBytes       int64
-}
-
-func (q *Queries) ListDatarangesForDatas3t(ctx context.Context, name string) ([]ListDatarangesForDatas3tRow, error) {
-	rows, err := q.db.Query(ctx, listDatarangesForDatas3t, name)
+	CreatedAt       pgtype.Timestamp
+	StorageClass    string
+	SortValue       int64
+}
+
+// Keyset pagination over the dataranges of a datas3t. Rows are ordered by
+// (sort_value, id), where sort_value is the min datapoint key, the size or the
+// creation time (in microseconds since epoch) depending on sort_by.
+// The cursor is the (sort_value, id) of the last row of the previous page.
+func (q *Queries) ListDatarangesPage(ctx context.Context, arg ListDatarangesPageParams) ([]ListDatarangesPageRow, error) {
+	rows, err := q.db.Query(ctx, listDatarangesPage,
+		arg.CursorSortValue,
+		arg.Descending,
+		arg.CursorID,
+		arg.PageLimit,
+		arg.SortBy,
+		arg.Datas3tName,
+		arg.FromDatapointKey,
+		arg.ToDatapointKey,
+		arg.MinSizeBytes,
+		arg.MaxSizeBytes,
+		arg.CreatedAfter,
+		arg.CreatedBefore,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []ListDatarangesForDatas3tRow
+	var items []ListDatarangesPageRow
 	for rows.Next() {
-		var i ListDatarangesForDatas3tRow
+		var i ListDatarangesPageRow
 		if err := rows.Scan(
 			&i.ID,
 			&i.DataObjectKey,
@@ -1294,6 +2425,62 @@ func (q *Queries) ListDatarangesForDatas3t(ctx context.Context, name string) ([]
 			&i.MinDatapointKey,
 			&i.MaxDatapointKey,
 			&i.SizeBytes,
+			&i.CreatedAt,
+			&i.StorageClass,
+			&i.SortValue,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDatas3tReplicas = `-- name: ListDatas3tReplicas :many
+SELECT
+    d.name as datas3t_name,
+    s.name as bucket_name,
+    r.created_at,
+    COUNT(dr.id) as total_dataranges,
+    COUNT(drr.datarange_id) FILTER (WHERE drr.status = 'replicated') as replicated_dataranges,
+    COUNT(drr.datarange_id) FILTER (WHERE drr.status = 'failed') as failed_dataranges
+FROM datas3t_replicas r
+JOIN datas3ts d ON r.datas3t_id = d.id
+JOIN s3_buckets s ON r.s3_bucket_id = s.id
+LEFT JOIN dataranges dr ON dr.datas3t_id = d.id
+LEFT JOIN datarange_replications drr ON drr.datarange_id = dr.id AND drr.replica_id = r.id
+GROUP BY r.id, d.name, s.name, r.created_at
+ORDER BY d.name
+`
+
+type ListDatas3tReplicasRow struct {
+	Datas3tName          string
+	BucketName           string
+	CreatedAt            pgtype.Timestamp
+	TotalDataranges      int64
+	ReplicatedDataranges int64
+	FailedDataranges     int64
+}
+
+func (q *Queries) ListDatas3tReplicas(ctx context.Context) ([]ListDatas3tReplicasRow, error) {
+	rows, err := q.db.Query(ctx, listDatas3tReplicas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDatas3tReplicasRow
+	for rows.Next() {
+		var i ListDatas3tReplicasRow
+		if err := rows.Scan(
+			&i.Datas3tName,
+			&i.BucketName,
+			&i.CreatedAt,
+			&i.TotalDataranges,
+			&i.ReplicatedDataranges,
+			&i.FailedDataranges,
 		); err != nil {
 			return nil, err
 		}
@@ -1309,6 +2496,7 @@ const listDatas3ts = `-- name: ListDatas3ts :many
 SELECT 
     d.name as datas3t_name,
     s.name as bucket_name,
+    d.encrypted,
     COALESCE(COUNT(dr.id), 0) as datarange_count,
     COALESCE(SUM(dr.max_datapoint_key - dr.min_datapoint_key + 1), 0) as total_datapoints,
     COALESCE(MIN(dr.min_datapoint_key), 0) as lowest_datapoint,
@@ -1317,13 +2505,15 @@ SELECT
 FROM datas3ts d
 JOIN s3_buckets s ON d.s3_bucket_id = s.id
 LEFT JOIN dataranges dr ON d.id = dr.datas3t_id
-GROUP BY d.id, d.name, s.name
+WHERE starts_with(d.name, $1::text)
+GROUP BY d.id, d.name, s.name, d.encrypted
 ORDER BY d.name
 `
 
 type ListDatas3tsRow struct {
 	Datas3tName      string
 	BucketName       string
+	Encrypted        bool
 	DatarangeCount   interface{}
 	TotalDatapoints  interface{}
 	LowestDatapoint  interface{}
@@ -1331,8 +2521,8 @@ type ListDatas3tsRow struct {
 	TotalBytes       interface{}
 }
 
-func (q *Queries) ListDatas3ts(ctx context.Context) ([]ListDatas3tsRow, error) {
-	rows, err := q.db.Query(ctx, listDatas3ts)
+func (q *Queries) ListDatas3ts(ctx context.Context, namePrefix string) ([]ListDatas3tsRow, error) {
+	rows, err := q.db.Query(ctx, listDatas3ts, namePrefix)
 	if err != nil {
 		return nil, err
 	}
@@ -1343,6 +2533,7 @@ func (q *Queries) ListDatas3ts(ctx context.Context) ([]ListDatas3tsRow, error) {
 		if err := rows.Scan(
 			&i.Datas3tName,
 			&i.BucketName,
+			&i.Encrypted,
 			&i.DatarangeCount,
 			&i.TotalDatapoints,
 			&i.LowestDatapoint,
@@ -1359,6 +2550,170 @@ func (q *Queries) ListDatas3ts(ctx context.Context) ([]ListDatas3tsRow, error) {
 	return items, nil
 }
 
+const listStorageClassRules = `-- name: ListStorageClassRules :many
+SELECT
+    r.id,
+    r.datas3t_id,
+    r.storage_class,
+    r.min_age_days,
+    r.min_keys_behind,
+    d.name as datas3t_name,
+    s.endpoint,
+    s.bucket,
+    s.access_key,
+    s.secret_key,
+    s.region,
+    s.addressing_style,
+    s.session_token,
+    s.credential_mode,
+    s.sse_mode,
+    s.sse_kms_key_id,
+    s.sse_customer_key
+FROM storage_class_rules r
+JOIN datas3ts d ON r.datas3t_id = d.id
+JOIN s3_buckets s ON d.s3_bucket_id = s.id
+ORDER BY r.datas3t_id, r.id
+`
+
+type ListStorageClassRulesRow struct {
+	ID              int64
+	Datas3tID       int64
+	StorageClass    string
+	MinAgeDays      *int32
+	MinKeysBehind   *int64
+	Datas3tName     string
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
+	SseMode         string
+	SseKmsKeyID     string
+	SseCustomerKey  string
+}
+
+func (q *Queries) ListStorageClassRules(ctx context.Context) ([]ListStorageClassRulesRow, error) {
+	rows, err := q.db.Query(ctx, listStorageClassRules)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListStorageClassRulesRow
+	for rows.Next() {
+		var i ListStorageClassRulesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Datas3tID,
+			&i.StorageClass,
+			&i.MinAgeDays,
+			&i.MinKeysBehind,
+			&i.Datas3tName,
+			&i.Endpoint,
+			&i.Bucket,
+			&i.AccessKey,
+			&i.SecretKey,
+			&i.Region,
+			&i.AddressingStyle,
+			&i.SessionToken,
+			&i.CredentialMode,
+			&i.SseMode,
+			&i.SseKmsKeyID,
+			&i.SseCustomerKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockAllBucketCredentials = `-- name: LockAllBucketCredentials :many
+SELECT id, name, access_key, secret_key, session_token, sse_customer_key
+FROM s3_buckets
+ORDER BY id
+FOR UPDATE
+`
+
+type LockAllBucketCredentialsRow struct {
+	ID             int64
+	Name           string
+	AccessKey      string
+	SecretKey      string
+	SessionToken   string
+	SseCustomerKey string
+}
+
+func (q *Queries) LockAllBucketCredentials(ctx context.Context) ([]LockAllBucketCredentialsRow, error) {
+	rows, err := q.db.Query(ctx, lockAllBucketCredentials)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LockAllBucketCredentialsRow
+	for rows.Next() {
+		var i LockAllBucketCredentialsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.AccessKey,
+			&i.SecretKey,
+			&i.SessionToken,
+			&i.SseCustomerKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockBucket = `-- name: LockBucket :one
+SELECT id
+FROM s3_buckets
+WHERE name = $1
+FOR UPDATE
+`
+
+func (q *Queries) LockBucket(ctx context.Context, name string) (int64, error) {
+	row := q.db.QueryRow(ctx, lockBucket, name)
+	var id int64
+	err := row.Scan(&id)
+	return id, err
+}
+
+const lockDatas3t = `-- name: LockDatas3t :exec
+SELECT id FROM datas3ts WHERE id = $1 FOR UPDATE
+`
+
+func (q *Queries) LockDatas3t(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, lockDatas3t, id)
+	return err
+}
+
+const scheduleDatarangeReplicasForDeletion = `-- name: ScheduleDatarangeReplicasForDeletion :exec
+INSERT INTO objects_to_delete (presigned_delete_url, s3_bucket_id, object_name)
+SELECT '', r.s3_bucket_id, unnest(ARRAY[drr.data_object_key, drr.index_object_key])
+FROM datarange_replications drr
+JOIN datas3t_replicas r ON drr.replica_id = r.id
+WHERE drr.datarange_id = ANY($1::BIGINT[])
+`
+
+// Schedules the copies of dataranges in the replicas of their datas3t for deletion,
+// copies that are still being written are included
+func (q *Queries) ScheduleDatarangeReplicasForDeletion(ctx context.Context, dollar_1 []int64) error {
+	_, err := q.db.Exec(ctx, scheduleDatarangeReplicasForDeletion, dollar_1)
+	return err
+}
+
 const scheduleKeyForDeletion = `-- name: ScheduleKeyForDeletion :exec
 INSERT INTO objects_to_delete (presigned_delete_url)
 VALUES ($1)
@@ -1399,6 +2754,231 @@ func (q *Queries) ScheduleObjectsForDeletion(ctx context.Context, arg ScheduleOb
 	return err
 }
 
+const scheduleReplicaObjectsForDeletion = `-- name: ScheduleReplicaObjectsForDeletion :exec
+INSERT INTO objects_to_delete (presigned_delete_url, s3_bucket_id, object_name)
+SELECT '', r.s3_bucket_id, unnest(ARRAY[drr.data_object_key, drr.index_object_key])
+FROM datarange_replications drr
+JOIN datas3t_replicas r ON drr.replica_id = r.id
+WHERE r.id = $1
+`
+
+// Schedules the copies of all dataranges of a replica for deletion from its bucket
+func (q *Queries) ScheduleReplicaObjectsForDeletion(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, scheduleReplicaObjectsForDeletion, id)
+	return err
+}
+
+const setDatarangeReplicated = `-- name: SetDatarangeReplicated :execrows
+UPDATE datarange_replications
+SET status = 'replicated',
+    last_error = '',
+    replicated_at = CURRENT_TIMESTAMP,
+    updated_at = CURRENT_TIMESTAMP
+WHERE datarange_id = $1 AND replica_id = $2
+`
+
+type SetDatarangeReplicatedParams struct {
+	DatarangeID int64
+	ReplicaID   int64
+}
+
+func (q *Queries) SetDatarangeReplicated(ctx context.Context, arg SetDatarangeReplicatedParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setDatarangeReplicated, arg.DatarangeID, arg.ReplicaID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setDatarangeReplicationFailed = `-- name: SetDatarangeReplicationFailed :exec
+UPDATE datarange_replications
+SET status = 'failed',
+    last_error = $1,
+    updated_at = CURRENT_TIMESTAMP
+WHERE datarange_id = $2 AND replica_id = $3
+`
+
+type SetDatarangeReplicationFailedParams struct {
+	LastError   string
+	DatarangeID int64
+	ReplicaID   int64
+}
+
+func (q *Queries) SetDatarangeReplicationFailed(ctx context.Context, arg SetDatarangeReplicationFailedParams) error {
+	_, err := q.db.Exec(ctx, setDatarangeReplicationFailed, arg.LastError, arg.DatarangeID, arg.ReplicaID)
+	return err
+}
+
+const setDatarangeRestoreExpiresAt = `-- name: SetDatarangeRestoreExpiresAt :exec
+UPDATE dataranges SET restore_expires_at = $1 WHERE id = $2
+`
+
+type SetDatarangeRestoreExpiresAtParams struct {
+	RestoreExpiresAt pgtype.Timestamp
+	ID               int64
+}
+
+func (q *Queries) SetDatarangeRestoreExpiresAt(ctx context.Context, arg SetDatarangeRestoreExpiresAtParams) error {
+	_, err := q.db.Exec(ctx, setDatarangeRestoreExpiresAt, arg.RestoreExpiresAt, arg.ID)
+	return err
+}
+
+const setDatarangeRestoreRequested = `-- name: SetDatarangeRestoreRequested :exec
+UPDATE dataranges SET restore_requested_at = CURRENT_TIMESTAMP WHERE id = $1
+`
+
+func (q *Queries) SetDatarangeRestoreRequested(ctx context.Context, id int64) error {
+	_, err := q.db.Exec(ctx, setDatarangeRestoreRequested, id)
+	return err
+}
+
+const setDatarangeStorageClass = `-- name: SetDatarangeStorageClass :exec
+UPDATE dataranges
+SET storage_class = $1,
+    restore_requested_at = NULL,
+    restore_expires_at = NULL,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $2
+`
+
+type SetDatarangeStorageClassParams struct {
+	StorageClass string
+	ID           int64
+}
+
+func (q *Queries) SetDatarangeStorageClass(ctx context.Context, arg SetDatarangeStorageClassParams) error {
+	_, err := q.db.Exec(ctx, setDatarangeStorageClass, arg.StorageClass, arg.ID)
+	return err
+}
+
+const setDatarangeUploadLease = `-- name: SetDatarangeUploadLease :one
+UPDATE datarange_uploads
+SET lease_expires_at = CURRENT_TIMESTAMP + make_interval(secs => $1::bigint),
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $2
+RETURNING lease_expires_at
+`
+
+type SetDatarangeUploadLeaseParams struct {
+	LeaseDurationSeconds int64
+	ID                   int64
+}
+
+func (q *Queries) SetDatarangeUploadLease(ctx context.Context, arg SetDatarangeUploadLeaseParams) (pgtype.Timestamp, error) {
+	row := q.db.QueryRow(ctx, setDatarangeUploadLease, arg.LeaseDurationSeconds, arg.ID)
+	var lease_expires_at pgtype.Timestamp
+	err := row.Scan(&lease_expires_at)
+	return lease_expires_at, err
+}
+
+const startDatarangeReplication = `-- name: StartDatarangeReplication :exec
+INSERT INTO datarange_replications (datarange_id, replica_id, data_object_key, index_object_key, status, attempts)
+VALUES ($1, $2, $3, $4, 'pending', 1)
+ON CONFLICT (datarange_id, replica_id) DO UPDATE
+SET status = 'pending',
+    attempts = datarange_replications.attempts + 1,
+    updated_at = CURRENT_TIMESTAMP
+`
+
+type StartDatarangeReplicationParams struct {
+	DatarangeID    int64
+	ReplicaID      int64
+	DataObjectKey  string
+	IndexObjectKey string
+}
+
+func (q *Queries) StartDatarangeReplication(ctx context.Context, arg StartDatarangeReplicationParams) error {
+	_, err := q.db.Exec(ctx, startDatarangeReplication,
+		arg.DatarangeID,
+		arg.ReplicaID,
+		arg.DataObjectKey,
+		arg.IndexObjectKey,
+	)
+	return err
+}
+
+const updateBucket = `-- name: UpdateBucket :exec
+UPDATE s3_buckets
+SET endpoint = $2,
+    bucket = $3,
+    access_key = $4,
+    secret_key = $5,
+    region = $6,
+    addressing_style = $7,
+    session_token = $8,
+    credential_mode = $9,
+    key_prefix = $10,
+    sse_mode = $11,
+    sse_kms_key_id = $12,
+    sse_customer_key = $13,
+    updated_at = CURRENT_TIMESTAMP
+WHERE name = $1
+`
+
+type UpdateBucketParams struct {
+	Name            string
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	Region          string
+	AddressingStyle string
+	SessionToken    string
+	CredentialMode  string
+	KeyPrefix       string
+	SseMode         string
+	SseKmsKeyID     string
+	SseCustomerKey  string
+}
+
+func (q *Queries) UpdateBucket(ctx context.Context, arg UpdateBucketParams) error {
+	_, err := q.db.Exec(ctx, updateBucket,
+		arg.Name,
+		arg.Endpoint,
+		arg.Bucket,
+		arg.AccessKey,
+		arg.SecretKey,
+		arg.Region,
+		arg.AddressingStyle,
+		arg.SessionToken,
+		arg.CredentialMode,
+		arg.KeyPrefix,
+		arg.SseMode,
+		arg.SseKmsKeyID,
+		arg.SseCustomerKey,
+	)
+	return err
+}
+
+const updateBucketCredentials = `-- name: UpdateBucketCredentials :exec
+UPDATE s3_buckets
+SET access_key = $2,
+    secret_key = $3,
+    session_token = $4,
+    sse_customer_key = $5,
+    updated_at = CURRENT_TIMESTAMP
+WHERE id = $1
+`
+
+type UpdateBucketCredentialsParams struct {
+	ID             int64
+	AccessKey      string
+	SecretKey      string
+	SessionToken   string
+	SseCustomerKey string
+}
+
+func (q *Queries) UpdateBucketCredentials(ctx context.Context, arg UpdateBucketCredentialsParams) error {
+	_, err := q.db.Exec(ctx, updateBucketCredentials,
+		arg.ID,
+		arg.AccessKey,
+		arg.SecretKey,
+		arg.SessionToken,
+		arg.SseCustomerKey,
+	)
+	return err
+}
+
 const updateUploadCounter = `-- name: UpdateUploadCounter :exec
 UPDATE datas3ts 
 SET upload_counter = $2,
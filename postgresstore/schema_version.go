@@ -0,0 +1,60 @@
+package postgresstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// SchemaVersion is the migration state recorded by golang-migrate in the schema_migrations table.
+type SchemaVersion struct {
+	Version int64 `json:"version"`
+	Dirty   bool  `json:"dirty"`
+}
+
+// GetSchemaVersion returns the currently applied migration version.
+// The schema_migrations table is managed by golang-migrate and is not part of the
+// sqlc schema, so this query is maintained by hand.
+func (q *Queries) GetSchemaVersion(ctx context.Context) (SchemaVersion, error) {
+	var v SchemaVersion
+	err := q.db.QueryRow(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&v.Version, &v.Dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return SchemaVersion{}, nil
+	}
+	if err != nil {
+		return SchemaVersion{}, err
+	}
+	return v, nil
+}
+
+// LatestMigrationVersion returns the highest migration version embedded in MigrationsFS.
+func LatestMigrationVersion() (int64, error) {
+	entries, err := fs.ReadDir(MigrationsFS, "migrations")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	var latest int64
+	for _, entry := range entries {
+		prefix, _, found := strings.Cut(entry.Name(), "_")
+		if !found {
+			continue
+		}
+
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if version > latest {
+			latest = version
+		}
+	}
+
+	return latest, nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
 )
 
@@ -21,7 +22,7 @@ func (s *BucketServer) AddBucket(ctx context.Context, log *slog.Logger, req *Buc
 		}
 	}()
 
-	err = req.Validate(ctx, log)
+	err = req.Validate(ctx, log, s.storage)
 	if err != nil {
 		return fmt.Errorf("failed to validate bucket info: %w", err)
 	}
@@ -35,16 +36,37 @@ func (s *BucketServer) AddBucket(ctx context.Context, log *slog.Logger, req *Buc
 		return fmt.Errorf("failed to encrypt credentials: %w", err)
 	}
 
+	encryptedSessionToken, err := s.encryptor.Encrypt(req.SessionToken)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt session token: %w", err)
+	}
+
+	encryptedCustomerKey, err := s.encryptor.Encrypt(req.SSECustomerKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt sse customer key: %w", err)
+	}
+
 	queries := postgresstore.New(s.db)
 
 	err = queries.AddBucket(ctx, postgresstore.AddBucketParams{
-		Name:      req.Name,
-		Endpoint:  req.Endpoint,
-		Bucket:    req.Bucket,
-		AccessKey: encryptedAccessKey,
-		SecretKey: encryptedSecretKey,
+		Name:            req.Name,
+		Endpoint:        req.Endpoint,
+		Bucket:          req.Bucket,
+		AccessKey:       encryptedAccessKey,
+		SecretKey:       encryptedSecretKey,
+		Region:          req.Region,
+		AddressingStyle: req.AddressingStyle,
+		SessionToken:    encryptedSessionToken,
+		CredentialMode:  req.CredentialMode,
+		KeyPrefix:       req.KeyPrefix,
+		SseMode:         req.SSEMode,
+		SseKmsKeyID:     req.SSEKMSKeyID,
+		SseCustomerKey:  encryptedCustomerKey,
 	})
 
+	if postgresstore.IsUniqueViolation(err) {
+		return apierror.New(apierror.CodeBucketAlreadyExists, "failed to add bucket: bucket configuration '%s' or %s/%s with key prefix '%s' already exists", req.Name, req.Endpoint, req.Bucket, req.KeyPrefix)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to add bucket: %w", err)
 	}
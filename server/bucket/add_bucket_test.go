@@ -1,14 +1,21 @@
 package bucket_test
 
 import (
+	"encoding/base64"
 	"log"
 	"log/slog"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/draganm/datas3t/apierror"
+	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/crypto"
 	"github.com/draganm/datas3t/postgresstore"
 	"github.com/draganm/datas3t/server/bucket"
+	"github.com/draganm/datas3t/storage"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -29,6 +36,7 @@ var _ = Describe("AddBucket", func() {
 		minioContainer *minio.MinioContainer
 		db             *pgxpool.Pool
 		srv            *bucket.BucketServer
+		opener         *storage.Opener
 		minioEndpoint  string
 		minioHost      string
 		minioAccessKey string
@@ -112,8 +120,9 @@ var _ = Describe("AddBucket", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		// Create server instances
-		srv, err = bucket.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
+		var encryptor *crypto.CredentialEncryptor
+		encryptor, opener = newOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		srv = bucket.NewServer(db, encryptor, opener)
 	})
 
 	AfterEach(func(ctx SpecContext) {
@@ -171,6 +180,88 @@ var _ = Describe("AddBucket", func() {
 			Expect(configs).To(ContainElement("test-config-tls"))
 		})
 
+		It("should store the region, addressing style and credential mode", func(ctx SpecContext) {
+			err := srv.AddBucket(ctx, logger, &bucket.BucketInfo{
+				Name:            "test-config-settings",
+				Endpoint:        minioEndpoint,
+				Bucket:          testBucketName,
+				AccessKey:       minioAccessKey,
+				SecretKey:       minioSecretKey,
+				Region:          "us-east-1",
+				AddressingStyle: "path",
+				CredentialMode:  "static",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buckets, err := srv.ListBuckets(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buckets).To(ContainElement(&bucket.BucketListInfo{
+				Name:            "test-config-settings",
+				Endpoint:        minioEndpoint,
+				Bucket:          testBucketName,
+				Region:          "us-east-1",
+				AddressingStyle: "path",
+				CredentialMode:  "static",
+			}))
+		})
+
+		It("should default to path-style addressing and static credentials", func(ctx SpecContext) {
+			err := srv.AddBucket(ctx, logger, &bucket.BucketInfo{
+				Name:      "test-config-defaults",
+				Endpoint:  minioEndpoint,
+				Bucket:    testBucketName,
+				AccessKey: minioAccessKey,
+				SecretKey: minioSecretKey,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buckets, err := srv.ListBuckets(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buckets).To(HaveLen(1))
+			Expect(buckets[0].Region).To(BeEmpty())
+			Expect(buckets[0].AddressingStyle).To(Equal("path"))
+			Expect(buckets[0].CredentialMode).To(Equal("static"))
+		})
+
+		It("should store the key prefix terminated by a slash", func(ctx SpecContext) {
+			err := srv.AddBucket(ctx, logger, &bucket.BucketInfo{
+				Name:      "test-config-prefix",
+				Endpoint:  minioEndpoint,
+				Bucket:    testBucketName,
+				AccessKey: minioAccessKey,
+				SecretKey: minioSecretKey,
+				KeyPrefix: "tenant-a/prod",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// The same bucket can be added again with another key prefix
+			err = srv.AddBucket(ctx, logger, &bucket.BucketInfo{
+				Name:      "test-config-other-prefix",
+				Endpoint:  minioEndpoint,
+				Bucket:    testBucketName,
+				AccessKey: minioAccessKey,
+				SecretKey: minioSecretKey,
+				KeyPrefix: "tenant-b/",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			buckets, err := srv.ListBuckets(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buckets).To(HaveLen(2))
+			Expect(buckets[0].KeyPrefix).To(Equal("tenant-a/prod/"))
+			Expect(buckets[1].KeyPrefix).To(Equal("tenant-b/"))
+
+			err = srv.AddBucket(ctx, logger, &bucket.BucketInfo{
+				Name:      "test-config-same-prefix",
+				Endpoint:  minioEndpoint,
+				Bucket:    testBucketName,
+				AccessKey: minioAccessKey,
+				SecretKey: minioSecretKey,
+				KeyPrefix: "tenant-b",
+			})
+			Expect(err).To(MatchError(apierror.ErrBucketAlreadyExists))
+		})
+
 		It("should handle bucket names with allowed characters", func(ctx SpecContext) {
 			validNames := []string{
 				"test-config-123",
@@ -270,6 +361,77 @@ var _ = Describe("AddBucket", func() {
 			Expect(err.Error()).To(ContainSubstring("bucket is required"))
 		})
 
+		It("should reject invalid connection settings", func(ctx SpecContext) {
+			invalid := []*bucket.BucketInfo{
+				{AddressingStyle: "dns"},
+				{CredentialMode: "anonymous"},
+				{Region: "EU Central"},
+				{CredentialMode: "ambient", AccessKey: minioAccessKey, SecretKey: minioSecretKey},
+				{CredentialMode: "static"},
+			}
+
+			for _, bucketInfo := range invalid {
+				bucketInfo.Name = "test-config"
+				bucketInfo.Endpoint = minioEndpoint
+				bucketInfo.Bucket = testBucketName
+				if bucketInfo.CredentialMode == "" {
+					bucketInfo.AccessKey = minioAccessKey
+					bucketInfo.SecretKey = minioSecretKey
+				}
+
+				err := srv.AddBucket(ctx, logger, bucketInfo)
+				Expect(err).To(MatchError(apierror.ErrValidationFailed), "Should have failed for %+v", bucketInfo)
+			}
+		})
+
+		It("should reject invalid key prefixes", func(ctx SpecContext) {
+			invalidPrefixes := []string{
+				"/tenant",
+				"tenant//prod",
+				"../tenant",
+				"tenant/./prod",
+				"tenant a",
+				"tenant\\prod",
+				strings.Repeat("a", 600),
+			}
+
+			for _, prefix := range invalidPrefixes {
+				err := srv.AddBucket(ctx, logger, &bucket.BucketInfo{
+					Name:      "test-config",
+					Endpoint:  minioEndpoint,
+					Bucket:    testBucketName,
+					AccessKey: minioAccessKey,
+					SecretKey: minioSecretKey,
+					KeyPrefix: prefix,
+				})
+				Expect(err).To(MatchError(apierror.ErrValidationFailed), "Should have failed for key prefix: %s", prefix)
+			}
+		})
+
+		It("should reject invalid server-side encryption settings", func(ctx SpecContext) {
+			customerKey := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+			invalidSettings := []bucket.BucketInfo{
+				{SSEMode: "aes"},
+				{SSEMode: "sse-s3", SSEKMSKeyID: "alias/datas3t"},
+				{SSECustomerKey: customerKey},
+				// The endpoint of the test bucket is plain HTTP
+				{SSEMode: "sse-c", SSECustomerKey: customerKey},
+			}
+
+			for _, settings := range invalidSettings {
+				bucketInfo := settings
+				bucketInfo.Name = "test-config"
+				bucketInfo.Endpoint = minioEndpoint
+				bucketInfo.Bucket = testBucketName
+				bucketInfo.AccessKey = minioAccessKey
+				bucketInfo.SecretKey = minioSecretKey
+
+				err := srv.AddBucket(ctx, logger, &bucketInfo)
+				Expect(err).To(MatchError(apierror.ErrValidationFailed), "Should have failed for sse mode %q", settings.SSEMode)
+			}
+		})
+
 		It("should reject invalid S3 credentials", func(ctx SpecContext) {
 			bucketInfo := &bucket.BucketInfo{
 				Name:      "test-config",
@@ -313,6 +475,63 @@ var _ = Describe("AddBucket", func() {
 		})
 	})
 
+	Context("when the credentials refer to files or environment variables", func() {
+		var secretKeyFile string
+
+		BeforeEach(func() {
+			secretsDir := GinkgoT().TempDir()
+			secretKeyFile = filepath.Join(secretsDir, "secret-key")
+
+			err := os.WriteFile(secretKeyFile, []byte(minioSecretKey+"\n"), 0o600)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = os.Setenv("DATAS3T_TEST_ACCESS_KEY", minioAccessKey)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(os.Unsetenv, "DATAS3T_TEST_ACCESS_KEY")
+
+			opener.SetCredentialSources(awsutil.CredentialSources{
+				FilesDir:  secretsDir,
+				EnvPrefix: "DATAS3T_TEST_",
+			})
+		})
+
+		It("should read the credentials whenever the bucket is opened", func(ctx SpecContext) {
+			err := srv.AddBucket(ctx, logger, &bucket.BucketInfo{
+				Name:      "test-config",
+				Endpoint:  minioEndpoint,
+				Bucket:    testBucketName,
+				AccessKey: "env:DATAS3T_TEST_ACCESS_KEY",
+				SecretKey: "file://" + secretKeyFile,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := srv.TestBucket(ctx, logger, &bucket.TestBucketRequest{Name: "test-config"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.OK).To(BeTrue())
+
+			// Rotated secrets are picked up without updating the bucket
+			err = os.WriteFile(secretKeyFile, []byte("invalid-secret-key"), 0o600)
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err = srv.TestBucket(ctx, logger, &bucket.TestBucketRequest{Name: "test-config"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.OK).To(BeFalse())
+		})
+
+		It("should reject references the server does not resolve", func(ctx SpecContext) {
+			for _, accessKey := range []string{"env:OTHER_ACCESS_KEY", "file:///etc/hostname", "file://relative/path", "env:INVALID-NAME"} {
+				err := srv.AddBucket(ctx, logger, &bucket.BucketInfo{
+					Name:      "test-config",
+					Endpoint:  minioEndpoint,
+					Bucket:    testBucketName,
+					AccessKey: accessKey,
+					SecretKey: "file://" + secretKeyFile,
+				})
+				Expect(err).To(MatchError(apierror.ErrValidationFailed), "access key %s", accessKey)
+			}
+		})
+	})
+
 	Context("when handling database constraints", func() {
 		It("should reject duplicate bucket names", func(ctx SpecContext) {
 			bucketInfo := &bucket.BucketInfo{
@@ -2,41 +2,66 @@ package bucket
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"regexp"
 	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/datas3t/apierror"
 	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/storage"
 )
 
 type BucketInfo struct {
-	Name      string `json:"name"`
-	Endpoint  string `json:"endpoint"`
-	Bucket    string `json:"bucket"`
-	AccessKey string `json:"access_key"`
-	SecretKey string `json:"secret_key"`
+	Name            string `json:"name"`
+	Endpoint        string `json:"endpoint"`
+	Bucket          string `json:"bucket"`
+	AccessKey       string `json:"access_key"`
+	SecretKey       string `json:"secret_key"`
+	SessionToken    string `json:"session_token,omitempty"`
+	Region          string `json:"region,omitempty"`
+	AddressingStyle string `json:"addressing_style,omitempty"` // "path" (default) or "virtual"
+	CredentialMode  string `json:"credential_mode,omitempty"`  // "static" (default) or "ambient"
+	KeyPrefix       string `json:"key_prefix,omitempty"`       // prefix of every object key datas3t stores in the bucket
+	SSEMode         string `json:"sse_mode,omitempty"`         // "sse-s3", "sse-kms" or "sse-c", empty leaves it to the bucket
+	SSEKMSKeyID     string `json:"sse_kms_key_id,omitempty"`   // KMS key of "sse-kms", the default key of the account if empty
+	SSECustomerKey  string `json:"sse_customer_key,omitempty"` // base64-encoded 256-bit key of "sse-c"
 }
 
 // BucketListInfo represents bucket information for listing (without sensitive credentials)
 type BucketListInfo struct {
-	Name     string `json:"name"`
-	Endpoint string `json:"endpoint"`
-	Bucket   string `json:"bucket"`
+	Name            string `json:"name"`
+	Endpoint        string `json:"endpoint"`
+	Bucket          string `json:"bucket"`
+	Region          string `json:"region"`
+	AddressingStyle string `json:"addressing_style"`
+	CredentialMode  string `json:"credential_mode"`
+	KeyPrefix       string `json:"key_prefix"`
+	SSEMode         string `json:"sse_mode"`
+	SSEKMSKeyID     string `json:"sse_kms_key_id"`
 }
 
 var bucketNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 
-type ValidationError error
+var regionRegex = regexp.MustCompile(`^[a-z0-9-]*$`)
+
+// keyPrefixRegex matches key prefixes of slash terminated path segments
+var keyPrefixRegex = regexp.MustCompile(`^([a-zA-Z0-9_.-]+/)*$`)
+
+// ValidationError marks err as a validation failure of the request
+func ValidationError(err error) error {
+	return apierror.Wrap(apierror.CodeValidationFailed, err)
+}
 
 // IsEndpointTLS determines if an endpoint uses TLS based on its protocol
 func IsEndpointTLS(endpoint string) bool {
 	return strings.HasPrefix(endpoint, "https://")
 }
 
-func (r *BucketInfo) Validate(ctx context.Context, log *slog.Logger) error {
+// Validate checks the bucket configuration and tests the connection to the bucket with
+// stores opened by opener
+func (r *BucketInfo) Validate(ctx context.Context, log *slog.Logger, opener *storage.Opener) error {
 	if !bucketNameRegex.MatchString(r.Name) {
 		return ValidationError(fmt.Errorf("invalid bucket name: %s", r.Name))
 	}
@@ -49,7 +74,22 @@ func (r *BucketInfo) Validate(ctx context.Context, log *slog.Logger) error {
 		return ValidationError(fmt.Errorf("bucket is required"))
 	}
 
-	err := r.testConnection(ctx, log)
+	err := r.validateConnectionSettings()
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	err = r.validateKeyPrefix()
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	err = r.serverSideEncryption().Validate(r.Endpoint)
+	if err != nil {
+		return ValidationError(err)
+	}
+
+	err = r.TestConnection(ctx, log, opener)
 	if err != nil {
 		return ValidationError(fmt.Errorf("failed to test connection: %w", err))
 	}
@@ -57,28 +97,126 @@ func (r *BucketInfo) Validate(ctx context.Context, log *slog.Logger) error {
 	return nil
 }
 
-func (r *BucketInfo) testConnection(ctx context.Context, log *slog.Logger) error {
-	// Create S3 client using shared utility
-	s3Client, err := awsutil.CreateS3Client(ctx, awsutil.S3ClientConfig{
-		AccessKey: r.AccessKey,
-		SecretKey: r.SecretKey,
-		Endpoint:  r.Endpoint,
-		Logger:    log,
-		// Note: No logger provided for validation to keep it silent
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create S3 client: %w", err)
+// validateConnectionSettings checks the region, addressing style and credentials, filling
+// in the defaults of the addressing style and credential mode
+func (r *BucketInfo) validateConnectionSettings() error {
+	if r.AddressingStyle == "" {
+		r.AddressingStyle = awsutil.AddressingStylePath
+	}
+
+	if r.CredentialMode == "" {
+		r.CredentialMode = awsutil.CredentialModeStatic
+	}
+
+	if !regionRegex.MatchString(r.Region) {
+		return fmt.Errorf("invalid region: %s", r.Region)
 	}
 
-	// Test connection by listing objects (with max 1 object to minimize data transfer)
-	input := &s3.ListObjectsV2Input{
-		Bucket:  aws.String(r.Bucket),
-		MaxKeys: aws.Int32(1),
+	switch r.AddressingStyle {
+	case awsutil.AddressingStylePath, awsutil.AddressingStyleVirtual:
+	default:
+		return fmt.Errorf("invalid addressing_style %q, must be %q or %q", r.AddressingStyle, awsutil.AddressingStylePath, awsutil.AddressingStyleVirtual)
 	}
 
-	_, err = s3Client.ListObjectsV2(ctx, input)
+	switch r.CredentialMode {
+	case awsutil.CredentialModeStatic:
+		if storage.IsLocalEndpoint(r.Endpoint) {
+			return nil
+		}
+
+		if r.AccessKey == "" || r.SecretKey == "" {
+			return fmt.Errorf("access_key and secret_key are required with the %q credential mode", awsutil.CredentialModeStatic)
+		}
+
+		for _, credential := range []string{r.AccessKey, r.SecretKey, r.SessionToken} {
+			err := awsutil.ValidateCredentialReference(credential)
+			if err != nil {
+				return err
+			}
+		}
+	case awsutil.CredentialModeAmbient:
+		if r.AccessKey != "" || r.SecretKey != "" || r.SessionToken != "" {
+			return fmt.Errorf("access_key, secret_key and session_token must be empty with the %q credential mode", awsutil.CredentialModeAmbient)
+		}
+	default:
+		return fmt.Errorf("invalid credential_mode %q, must be %q or %q", r.CredentialMode, awsutil.CredentialModeStatic, awsutil.CredentialModeAmbient)
+	}
+
+	return nil
+}
+
+// validateKeyPrefix checks the key prefix, terminating it with a slash so the prefix
+// "tenant-a" stores the objects below "tenant-a/datas3t/"
+func (r *BucketInfo) validateKeyPrefix() error {
+	if r.KeyPrefix != "" && !strings.HasSuffix(r.KeyPrefix, "/") {
+		r.KeyPrefix += "/"
+	}
+
+	if len(r.KeyPrefix) > 512 {
+		return fmt.Errorf("key_prefix must be at most 512 characters long")
+	}
+
+	if !keyPrefixRegex.MatchString(r.KeyPrefix) {
+		return fmt.Errorf("invalid key_prefix %q, must be path segments of letters, digits, '_', '.' and '-' separated by '/'", r.KeyPrefix)
+	}
+
+	for _, segment := range strings.Split(strings.TrimSuffix(r.KeyPrefix, "/"), "/") {
+		if segment == "." || segment == ".." {
+			return fmt.Errorf("invalid key_prefix %q, must not contain '.' or '..' segments", r.KeyPrefix)
+		}
+	}
+
+	return nil
+}
+
+// serverSideEncryption returns the encryption S3 applies to the objects of the bucket
+func (r *BucketInfo) serverSideEncryption() storage.ServerSideEncryption {
+	return storage.ServerSideEncryption{
+		Mode:        r.SSEMode,
+		KMSKeyID:    r.SSEKMSKeyID,
+		CustomerKey: r.SSECustomerKey,
+	}
+}
+
+// errStopListing stops listing the objects of a bucket after the first one
+var errStopListing = errors.New("stop listing")
+
+// openStore opens the object store of the bucket
+func (r *BucketInfo) openStore(ctx context.Context, log *slog.Logger, opener *storage.Opener) (storage.ObjectStore, error) {
+	return opener.OpenDecrypted(ctx, log, storage.Config{
+		Endpoint:        r.Endpoint,
+		Bucket:          r.Bucket,
+		AccessKey:       r.AccessKey,
+		SecretKey:       r.SecretKey,
+		SessionToken:    r.SessionToken,
+		Region:          r.Region,
+		AddressingStyle: r.AddressingStyle,
+		CredentialMode:  r.CredentialMode,
+
+		ServerSideEncryption: r.serverSideEncryption(),
+	})
+}
+
+// TestConnection verifies that the objects below the key prefix of the bucket can be
+// listed with the configured credentials
+func (r *BucketInfo) TestConnection(ctx context.Context, log *slog.Logger, opener *storage.Opener) error {
+	store, err := r.openStore(ctx, log, opener)
 	if err != nil {
-		return fmt.Errorf("failed to connect to S3 bucket %s at %s: %w", r.Bucket, r.Endpoint, err)
+		return fmt.Errorf("failed to open object store: %w", err)
+	}
+
+	return TestStore(ctx, store, r.Bucket, r.Endpoint, r.KeyPrefix)
+}
+
+// TestStore verifies that the objects below the key prefix of an opened bucket can be
+// listed
+func TestStore(ctx context.Context, store storage.ObjectStore, bucket, endpoint, keyPrefix string) error {
+	// Test connection by listing objects, stopping after the first one to minimize data transfer
+	err := store.ListObjects(ctx, keyPrefix, func(storage.ObjectInfo) error {
+		return errStopListing
+	})
+	if err != nil && !errors.Is(err, errStopListing) {
+		return fmt.Errorf("failed to connect to bucket %s at %s: %w", bucket, endpoint, err)
 	}
 
 	return nil
@@ -0,0 +1,415 @@
+package bucket_test
+
+import (
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/bucket"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgxpool"
+	miniogo "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/minio"
+	tc_postgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var _ = Describe("Bucket lifecycle", func() {
+	var (
+		pgContainer    *tc_postgres.PostgresContainer
+		minioContainer *minio.MinioContainer
+		db             *pgxpool.Pool
+		srv            *bucket.BucketServer
+		minioEndpoint  string
+		minioHost      string
+		minioAccessKey string
+		minioSecretKey string
+		testBucketName string
+		logger         *slog.Logger
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+
+		var err error
+		logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+
+		// Start PostgreSQL container
+		pgContainer, err = tc_postgres.Run(ctx,
+			"postgres:16-alpine",
+			tc_postgres.WithDatabase("testdb"),
+			tc_postgres.WithUsername("testuser"),
+			tc_postgres.WithPassword("testpass"),
+			testcontainers.WithWaitStrategy(
+				wait.ForLog("database system is ready to accept connections").
+					WithOccurrence(2).
+					WithStartupTimeout(30*time.Second),
+			),
+			testcontainers.WithLogger(log.New(GinkgoWriter, "", 0)),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Get PostgreSQL connection string
+		connStr, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Connect to PostgreSQL
+		db, err = pgxpool.New(ctx, connStr)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Run migrations
+		// Create connection string for migrations
+		connStrForMigration, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
+		Expect(err).NotTo(HaveOccurred())
+
+		m, err := migrate.New(
+			"file://../../postgresstore/migrations",
+			connStrForMigration)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = m.Up()
+		if err != nil && err != migrate.ErrNoChange {
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// Start MinIO container
+		minioContainer, err = minio.Run(ctx,
+			"minio/minio:RELEASE.2024-01-16T16-07-38Z",
+			minio.WithUsername("minioadmin"),
+			minio.WithPassword("minioadmin"),
+			testcontainers.WithLogger(log.New(GinkgoWriter, "", 0)),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Get MinIO connection details
+		minioEndpoint, err = minioContainer.ConnectionString(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Extract host:port from the full URL (e.g., "http://localhost:12345" -> "localhost:12345")
+		minioHost = strings.TrimPrefix(minioEndpoint, "http://")
+		minioHost = strings.TrimPrefix(minioHost, "https://")
+
+		minioAccessKey = "minioadmin"
+		minioSecretKey = "minioadmin"
+		testBucketName = "test-bucket"
+
+		// Create test bucket in MinIO using the MinIO Go client
+		minioClient, err := miniogo.New(minioHost, &miniogo.Options{
+			Creds:  credentials.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+			Secure: false,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = minioClient.MakeBucket(ctx, testBucketName, miniogo.MakeBucketOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Create server instances
+		encryptor, opener := newOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		srv = bucket.NewServer(db, encryptor, opener)
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		if db != nil {
+			db.Close()
+		}
+		if pgContainer != nil {
+			err := pgContainer.Terminate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		if minioContainer != nil {
+			err := minioContainer.Terminate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	BeforeEach(func(ctx SpecContext) {
+		err := srv.AddBucket(ctx, logger, &bucket.BucketInfo{
+			Name:      "test-config",
+			Endpoint:  minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	Context("when updating a bucket", func() {
+		It("should change the given settings and keep the others", func(ctx SpecContext) {
+			region := "us-east-1"
+			addressingStyle := "path"
+
+			updated, err := srv.UpdateBucket(ctx, logger, &bucket.UpdateBucketRequest{
+				Name:            "test-config",
+				Region:          &region,
+				AddressingStyle: &addressingStyle,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			expected := &bucket.BucketListInfo{
+				Name:            "test-config",
+				Endpoint:        minioEndpoint,
+				Bucket:          testBucketName,
+				Region:          "us-east-1",
+				AddressingStyle: "path",
+				CredentialMode:  "static",
+			}
+			Expect(updated).To(Equal(expected))
+
+			buckets, err := srv.ListBuckets(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buckets).To(ConsistOf(expected))
+		})
+
+		It("should rotate the credentials", func(ctx SpecContext) {
+			accessKey := minioAccessKey
+			secretKey := minioSecretKey
+
+			_, err := srv.UpdateBucket(ctx, logger, &bucket.UpdateBucketRequest{
+				Name:      "test-config",
+				AccessKey: &accessKey,
+				SecretKey: &secretKey,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := srv.TestBucket(ctx, logger, &bucket.TestBucketRequest{Name: "test-config"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.OK).To(BeTrue())
+		})
+
+		It("should not store settings that fail the connection test", func(ctx SpecContext) {
+			secretKey := "invalid-secret-key"
+
+			_, err := srv.UpdateBucket(ctx, logger, &bucket.UpdateBucketRequest{
+				Name:      "test-config",
+				SecretKey: &secretKey,
+			})
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+			Expect(err.Error()).To(ContainSubstring("failed to test connection"))
+
+			result, err := srv.TestBucket(ctx, logger, &bucket.TestBucketRequest{Name: "test-config"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.OK).To(BeTrue())
+		})
+
+		It("should change the key prefix only while no datas3t uses the bucket", func(ctx SpecContext) {
+			keyPrefix := "tenant-a"
+
+			updated, err := srv.UpdateBucket(ctx, logger, &bucket.UpdateBucketRequest{
+				Name:      "test-config",
+				KeyPrefix: &keyPrefix,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.KeyPrefix).To(Equal("tenant-a/"))
+
+			queries := postgresstore.New(db)
+			err = queries.AddDatas3t(ctx, postgresstore.AddDatas3tParams{
+				Datas3tName: "test-datas3t",
+				BucketName:  "test-config",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			keyPrefix = "tenant-b/"
+			_, err = srv.UpdateBucket(ctx, logger, &bucket.UpdateBucketRequest{
+				Name:      "test-config",
+				KeyPrefix: &keyPrefix,
+			})
+			Expect(err).To(MatchError(apierror.ErrBucketInUse))
+
+			// Other settings can still change
+			region := "us-east-1"
+			updated, err = srv.UpdateBucket(ctx, logger, &bucket.UpdateBucketRequest{
+				Name:   "test-config",
+				Region: &region,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.KeyPrefix).To(Equal("tenant-a/"))
+		})
+
+		It("should reject invalid settings", func(ctx SpecContext) {
+			addressingStyle := "dns"
+
+			_, err := srv.UpdateBucket(ctx, logger, &bucket.UpdateBucketRequest{
+				Name:            "test-config",
+				AddressingStyle: &addressingStyle,
+			})
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		})
+
+		It("should reject unknown buckets", func(ctx SpecContext) {
+			region := "us-east-1"
+
+			_, err := srv.UpdateBucket(ctx, logger, &bucket.UpdateBucketRequest{
+				Name:   "unknown-config",
+				Region: &region,
+			})
+			Expect(err).To(MatchError(apierror.ErrBucketNotFound))
+		})
+	})
+
+	Context("when deleting a bucket", func() {
+		It("should delete a bucket no datas3t uses", func(ctx SpecContext) {
+			_, err := srv.DeleteBucket(ctx, logger, &bucket.DeleteBucketRequest{Name: "test-config"})
+			Expect(err).NotTo(HaveOccurred())
+
+			buckets, err := srv.ListBuckets(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buckets).To(BeEmpty())
+		})
+
+		It("should refuse deleting a bucket used by datas3ts", func(ctx SpecContext) {
+			queries := postgresstore.New(db)
+			err := queries.AddDatas3t(ctx, postgresstore.AddDatas3tParams{
+				Datas3tName: "test-datas3t",
+				BucketName:  "test-config",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = srv.DeleteBucket(ctx, logger, &bucket.DeleteBucketRequest{Name: "test-config"})
+			Expect(err).To(MatchError(apierror.ErrBucketInUse))
+
+			buckets, err := srv.ListBuckets(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buckets).To(HaveLen(1))
+		})
+
+		It("should refuse deleting a bucket with objects waiting for deletion", func(ctx SpecContext) {
+			var bucketID int64
+			err := db.QueryRow(ctx, "SELECT id FROM s3_buckets WHERE name = $1", "test-config").Scan(&bucketID)
+			Expect(err).NotTo(HaveOccurred())
+
+			objectName := "datas3t/test-datas3t/dataranges/deleted.tar"
+			err = postgresstore.New(db).ScheduleObjectForDeletion(ctx, postgresstore.ScheduleObjectForDeletionParams{
+				S3BucketID: &bucketID,
+				ObjectName: &objectName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = srv.DeleteBucket(ctx, logger, &bucket.DeleteBucketRequest{Name: "test-config"})
+			Expect(err).To(MatchError(apierror.ErrBucketInUse))
+			Expect(err.Error()).To(ContainSubstring("1 objects are waiting for deletion"))
+
+			buckets, err := srv.ListBuckets(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(buckets).To(HaveLen(1))
+		})
+
+		It("should reject unknown buckets", func(ctx SpecContext) {
+			_, err := srv.DeleteBucket(ctx, logger, &bucket.DeleteBucketRequest{Name: "unknown-config"})
+			Expect(err).To(MatchError(apierror.ErrBucketNotFound))
+		})
+	})
+
+	Context("when testing a bucket", func() {
+		It("should report every permission and leave no probe object behind", func(ctx SpecContext) {
+			result, err := srv.TestBucket(ctx, logger, &bucket.TestBucketRequest{Name: "test-config"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.OK).To(BeTrue())
+			Expect(result.Checks).To(Equal([]bucket.PermissionCheck{
+				{Permission: bucket.PermissionList, OK: true},
+				{Permission: bucket.PermissionWrite, OK: true},
+				{Permission: bucket.PermissionRead, OK: true},
+				{Permission: bucket.PermissionDelete, OK: true},
+			}))
+
+			minioClient, err := miniogo.New(minioHost, &miniogo.Options{
+				Creds:  credentials.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+				Secure: false,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			for object := range minioClient.ListObjects(ctx, testBucketName, miniogo.ListObjectsOptions{Recursive: true}) {
+				Expect(object.Err).NotTo(HaveOccurred())
+				Fail("probe object was left in the bucket: " + object.Key)
+			}
+		})
+
+		It("should report failed permissions", func(ctx SpecContext) {
+			minioClient, err := miniogo.New(minioHost, &miniogo.Options{
+				Creds:  credentials.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+				Secure: false,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			// Removing the bucket behind the configuration fails every check
+			err = minioClient.RemoveBucket(ctx, testBucketName)
+			Expect(err).NotTo(HaveOccurred())
+
+			result, err := srv.TestBucket(ctx, logger, &bucket.TestBucketRequest{Name: "test-config"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.OK).To(BeFalse())
+			Expect(result.Checks).To(HaveLen(4))
+			for _, check := range result.Checks {
+				Expect(check.OK).To(BeFalse(), "permission %s", check.Permission)
+				Expect(check.Error).NotTo(BeEmpty())
+			}
+		})
+
+		It("should reject unknown buckets", func(ctx SpecContext) {
+			_, err := srv.TestBucket(ctx, logger, &bucket.TestBucketRequest{Name: "unknown-config"})
+			Expect(err).To(MatchError(apierror.ErrBucketNotFound))
+		})
+	})
+
+	Context("when rotating the encryption key", func() {
+		const (
+			oldKey = "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ=="
+			newKey = "bmV3LWtleS0zMi1ieXRlcy1mb3ItdGVzdGluZyEhISE="
+		)
+
+		It("should re-encrypt the credentials with the new key", func(ctx SpecContext) {
+			encryptor, opener := newOpener(newKey)
+			err := encryptor.AddDecryptionKeys(oldKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			rotatingSrv := bucket.NewServer(db, encryptor, opener)
+			result, err := rotatingSrv.RotateEncryptionKey(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Buckets).To(Equal(1))
+			Expect(result.Reencrypted).To(Equal(1))
+
+			var accessKey string
+			err = db.QueryRow(ctx, "SELECT access_key FROM s3_buckets WHERE name = 'test-config'").Scan(&accessKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(accessKey).To(HavePrefix(result.KeyID + ":"))
+
+			// Only the new key is needed once the credentials are re-encrypted
+			newSrv := bucket.NewServer(db, encryptor, opener)
+
+			tested, err := newSrv.TestBucket(ctx, logger, &bucket.TestBucketRequest{Name: "test-config"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tested.OK).To(BeTrue())
+
+			_, err = srv.TestBucket(ctx, logger, &bucket.TestBucketRequest{Name: "test-config"})
+			Expect(err).To(HaveOccurred())
+
+			// Rotating again finds nothing to re-encrypt
+			result, err = newSrv.RotateEncryptionKey(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Reencrypted).To(Equal(0))
+		})
+
+		It("should change nothing when a bucket cannot be decrypted", func(ctx SpecContext) {
+			var accessKey string
+			err := db.QueryRow(ctx, "SELECT access_key FROM s3_buckets WHERE name = 'test-config'").Scan(&accessKey)
+			Expect(err).NotTo(HaveOccurred())
+
+			encryptor, opener := newOpener(newKey)
+			rotatingSrv := bucket.NewServer(db, encryptor, opener)
+			_, err = rotatingSrv.RotateEncryptionKey(ctx, logger)
+			Expect(err).To(MatchError(ContainSubstring("test-config")))
+
+			var storedAccessKey string
+			err = db.QueryRow(ctx, "SELECT access_key FROM s3_buckets WHERE name = 'test-config'").Scan(&storedAccessKey)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(storedAccessKey).To(Equal(accessKey))
+		})
+	})
+})
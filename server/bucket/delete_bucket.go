@@ -0,0 +1,97 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/jackc/pgx/v5"
+)
+
+type DeleteBucketRequest struct {
+	Name string `json:"name"`
+}
+
+type DeleteBucketResponse struct{}
+
+func (r *DeleteBucketRequest) Validate(ctx context.Context) error {
+	if !bucketNameRegex.MatchString(r.Name) {
+		return ValidationError(fmt.Errorf("invalid bucket name: %s", r.Name))
+	}
+	return nil
+}
+
+// DeleteBucket removes the configuration of a bucket. It is refused while datas3ts use
+// the bucket or objects of the bucket wait for deletion, the other objects stored in the
+// bucket are left untouched.
+func (s *BucketServer) DeleteBucket(ctx context.Context, log *slog.Logger, req *DeleteBucketRequest) (_ *DeleteBucketResponse, err error) {
+	log = log.With("bucket_name", req.Name)
+	log.Info("Deleting bucket")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to delete bucket", "error", err)
+		} else {
+			log.Info("Bucket deleted")
+		}
+	}()
+
+	err = req.Validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := postgresstore.New(tx)
+
+	// 1. Lock the bucket, datas3ts added concurrently wait for the transaction to finish
+	bucketID, err := txQueries.LockBucket(ctx, req.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeBucketNotFound, "bucket '%s' does not exist", req.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock bucket: %w", err)
+	}
+
+	// 2. Refuse deleting a bucket datas3ts still use
+	datas3tCount, err := txQueries.CountDatas3tsForBucket(ctx, bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count datas3ts for bucket: %w", err)
+	}
+
+	if datas3tCount > 0 {
+		return nil, apierror.New(apierror.CodeBucketInUse, "cannot delete bucket '%s': it is used by %d datas3ts. Delete them first", req.Name, datas3tCount)
+	}
+
+	// 3. Refuse deleting a bucket with objects waiting for deletion, nothing would delete
+	// them afterwards
+	pendingDeletions, err := txQueries.CountObjectsToDeleteForBucket(ctx, &bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count objects to delete for bucket: %w", err)
+	}
+
+	if pendingDeletions > 0 {
+		return nil, apierror.New(apierror.CodeBucketInUse, "cannot delete bucket '%s': %d objects are waiting for deletion. Retry once they are deleted", req.Name, pendingDeletions)
+	}
+
+	// 4. Delete the bucket record
+	err = txQueries.DeleteBucket(ctx, bucketID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete bucket: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &DeleteBucketResponse{}, nil
+}
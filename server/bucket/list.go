@@ -22,9 +22,15 @@ func (s *BucketServer) ListBuckets(ctx context.Context, log *slog.Logger) ([]*Bu
 	result := make([]*BucketListInfo, len(buckets))
 	for i, bucket := range buckets {
 		result[i] = &BucketListInfo{
-			Name:     bucket.Name,
-			Endpoint: bucket.Endpoint,
-			Bucket:   bucket.Bucket,
+			Name:            bucket.Name,
+			Endpoint:        bucket.Endpoint,
+			Bucket:          bucket.Bucket,
+			Region:          bucket.Region,
+			AddressingStyle: bucket.AddressingStyle,
+			CredentialMode:  bucket.CredentialMode,
+			KeyPrefix:       bucket.KeyPrefix,
+			SSEMode:         bucket.SseMode,
+			SSEKMSKeyID:     bucket.SseKmsKeyID,
 		}
 	}
 
@@ -109,8 +109,8 @@ var _ = Describe("ListBuckets", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		// Create server instances
-		srv, err = bucket.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
+		encryptor, opener := newOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		srv = bucket.NewServer(db, encryptor, opener)
 	})
 
 	AfterEach(func(ctx SpecContext) {
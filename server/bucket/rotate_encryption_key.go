@@ -0,0 +1,117 @@
+package bucket
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/draganm/datas3t/postgresstore"
+)
+
+type RotateEncryptionKeyResponse struct {
+	// KeyID is the ID of the key the credentials are encrypted with now
+	KeyID string `json:"key_id"`
+	// Buckets is the number of bucket configurations
+	Buckets int `json:"buckets"`
+	// Reencrypted is the number of bucket configurations whose credentials were re-encrypted
+	Reencrypted int `json:"reencrypted"`
+}
+
+// RotateEncryptionKey re-encrypts the stored credentials of every bucket with the
+// encryption key of the server. Credentials are decrypted with the encryption key or one
+// of the decryption keys, bucket configurations already encrypted with the encryption key
+// are left as they are. All buckets are re-encrypted in one transaction, if any of them
+// cannot be decrypted none is changed.
+func (s *BucketServer) RotateEncryptionKey(ctx context.Context, log *slog.Logger) (_ *RotateEncryptionKeyResponse, err error) {
+	log = log.With("key_id", s.encryptor.KeyID())
+	log.Info("Rotating encryption key")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to rotate encryption key", "error", err)
+		} else {
+			log.Info("Encryption key rotated")
+		}
+	}()
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := postgresstore.New(tx)
+
+	// 1. Lock all buckets, credentials updated concurrently wait for the transaction to finish
+	buckets, err := txQueries.LockAllBucketCredentials(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock buckets: %w", err)
+	}
+
+	response := &RotateEncryptionKeyResponse{
+		KeyID:   s.encryptor.KeyID(),
+		Buckets: len(buckets),
+	}
+
+	// 2. Re-encrypt the credentials not encrypted with the encryption key yet
+	for _, bucket := range buckets {
+		if s.encryptor.EncryptedWithActiveKey(bucket.AccessKey) &&
+			s.encryptor.EncryptedWithActiveKey(bucket.SecretKey) &&
+			s.encryptor.EncryptedWithActiveKey(bucket.SessionToken) &&
+			s.encryptor.EncryptedWithActiveKey(bucket.SseCustomerKey) {
+			continue
+		}
+
+		accessKey, secretKey, err := s.encryptor.DecryptCredentials(bucket.AccessKey, bucket.SecretKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt credentials of bucket '%s': %w", bucket.Name, err)
+		}
+
+		sessionToken, err := s.encryptor.Decrypt(bucket.SessionToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt session token of bucket '%s': %w", bucket.Name, err)
+		}
+
+		customerKey, err := s.encryptor.Decrypt(bucket.SseCustomerKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt sse customer key of bucket '%s': %w", bucket.Name, err)
+		}
+
+		encryptedAccessKey, encryptedSecretKey, err := s.encryptor.EncryptCredentials(accessKey, secretKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt credentials of bucket '%s': %w", bucket.Name, err)
+		}
+
+		encryptedSessionToken, err := s.encryptor.Encrypt(sessionToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt session token of bucket '%s': %w", bucket.Name, err)
+		}
+
+		encryptedCustomerKey, err := s.encryptor.Encrypt(customerKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt sse customer key of bucket '%s': %w", bucket.Name, err)
+		}
+
+		err = txQueries.UpdateBucketCredentials(ctx, postgresstore.UpdateBucketCredentialsParams{
+			ID:             bucket.ID,
+			AccessKey:      encryptedAccessKey,
+			SecretKey:      encryptedSecretKey,
+			SessionToken:   encryptedSessionToken,
+			SseCustomerKey: encryptedCustomerKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update credentials of bucket '%s': %w", bucket.Name, err)
+		}
+
+		log.Info("Re-encrypted bucket credentials", "bucket_name", bucket.Name)
+		response.Reencrypted++
+	}
+
+	// 3. Commit, the credentials of all buckets change at once
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return response, nil
+}
@@ -1,23 +1,71 @@
 package bucket
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/crypto"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type BucketServer struct {
 	db        *pgxpool.Pool
 	encryptor *crypto.CredentialEncryptor
+	// storage opens the stores of tested buckets
+	storage *storage.Opener
 }
 
-func NewServer(db *pgxpool.Pool, encryptionKey string) (*BucketServer, error) {
-	encryptor, err := crypto.NewCredentialEncryptor(encryptionKey)
-	if err != nil {
-		return nil, err
-	}
-
+func NewServer(db *pgxpool.Pool, encryptor *crypto.CredentialEncryptor, opener *storage.Opener) *BucketServer {
 	return &BucketServer{
 		db:        db,
 		encryptor: encryptor,
+		storage:   opener,
+	}
+}
+
+// getBucketInfo loads the configuration of a bucket with its credentials decrypted
+func (s *BucketServer) getBucketInfo(ctx context.Context, queries *postgresstore.Queries, name string) (*BucketInfo, error) {
+	bucket, err := queries.GetBucketCredentials(ctx, name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeBucketNotFound, "bucket '%s' does not exist", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bucket: %w", err)
+	}
+
+	accessKey, secretKey, err := s.encryptor.DecryptCredentials(bucket.AccessKey, bucket.SecretKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+	}
+
+	sessionToken, err := s.encryptor.Decrypt(bucket.SessionToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt session token: %w", err)
+	}
+
+	customerKey, err := s.encryptor.Decrypt(bucket.SseCustomerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt sse customer key: %w", err)
+	}
+
+	return &BucketInfo{
+		Name:            bucket.Name,
+		Endpoint:        bucket.Endpoint,
+		Bucket:          bucket.Bucket,
+		AccessKey:       accessKey,
+		SecretKey:       secretKey,
+		SessionToken:    sessionToken,
+		Region:          bucket.Region,
+		AddressingStyle: bucket.AddressingStyle,
+		CredentialMode:  bucket.CredentialMode,
+		KeyPrefix:       bucket.KeyPrefix,
+		SSEMode:         bucket.SseMode,
+		SSEKMSKeyID:     bucket.SseKmsKeyID,
+		SSECustomerKey:  customerKey,
 	}, nil
 }
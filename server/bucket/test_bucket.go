@@ -0,0 +1,162 @@
+package bucket
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+)
+
+// Permissions checked by TestBucket, in the order they are checked
+const (
+	PermissionList   = "list"
+	PermissionWrite  = "write"
+	PermissionRead   = "read"
+	PermissionDelete = "delete"
+)
+
+// testObjectPrefix is the prefix of the probe objects written by TestBucket, below the key
+// prefix of the bucket
+const testObjectPrefix = "datas3t-bucket-test/"
+
+type TestBucketRequest struct {
+	Name string `json:"name"`
+}
+
+// PermissionCheck reports whether the bucket granted one permission
+type PermissionCheck struct {
+	Permission string `json:"permission"`
+	OK         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+}
+
+type TestBucketResponse struct {
+	Checks []PermissionCheck `json:"checks"`
+	// OK is true when every check passed
+	OK bool `json:"ok"`
+}
+
+func (r *TestBucketRequest) Validate(ctx context.Context) error {
+	if !bucketNameRegex.MatchString(r.Name) {
+		return ValidationError(fmt.Errorf("invalid bucket name: %s", r.Name))
+	}
+	return nil
+}
+
+// TestBucket checks the list, write, read and delete permissions of a bucket by listing
+// the objects below its key prefix and writing, reading back and deleting a probe object. Failed checks are reported
+// in the response rather than as an error.
+func (s *BucketServer) TestBucket(ctx context.Context, log *slog.Logger, req *TestBucketRequest) (_ *TestBucketResponse, err error) {
+	log = log.With("bucket_name", req.Name)
+	log.Info("Testing bucket")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to test bucket", "error", err)
+		} else {
+			log.Info("Bucket tested")
+		}
+	}()
+
+	err = req.Validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.getBucketInfo(ctx, postgresstore.New(s.db), req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &TestBucketResponse{}
+
+	check := func(permission string, err error) bool {
+		result := PermissionCheck{Permission: permission, OK: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+			log.Warn("Bucket permission check failed", "permission", permission, "error", err)
+		}
+		response.Checks = append(response.Checks, result)
+		return err == nil
+	}
+
+	store, err := info.openStore(ctx, log, s.storage)
+	if err != nil {
+		openErr := fmt.Errorf("failed to open object store: %w", err)
+		for _, permission := range []string{PermissionList, PermissionWrite, PermissionRead, PermissionDelete} {
+			check(permission, openErr)
+		}
+		return response, nil
+	}
+
+	err = store.ListObjects(ctx, info.KeyPrefix, func(storage.ObjectInfo) error {
+		return errStopListing
+	})
+	if errors.Is(err, errStopListing) {
+		err = nil
+	}
+	check(PermissionList, err)
+
+	key, err := testObjectKey(info.KeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	content := []byte("datas3t bucket test")
+
+	written := check(PermissionWrite, store.PutObject(ctx, key, bytes.NewReader(content), int64(len(content))))
+	if !written {
+		skipped := errors.New("skipped, the probe object could not be written")
+		check(PermissionRead, skipped)
+		check(PermissionDelete, skipped)
+		return response, nil
+	}
+
+	check(PermissionRead, readTestObject(ctx, store, key, content))
+	check(PermissionDelete, store.DeleteObject(ctx, key))
+
+	response.OK = true
+	for _, c := range response.Checks {
+		response.OK = response.OK && c.OK
+	}
+
+	return response, nil
+}
+
+// testObjectKey returns a random key for the probe object
+func testObjectKey(keyPrefix string) (string, error) {
+	suffix := make([]byte, 16)
+	_, err := rand.Read(suffix)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate test object key: %w", err)
+	}
+
+	return keyPrefix + testObjectPrefix + hex.EncodeToString(suffix), nil
+}
+
+// readTestObject reads the probe object back and compares it to what was written
+func readTestObject(ctx context.Context, store storage.ObjectStore, key string, content []byte) error {
+	body, err := store.GetObject(ctx, key, 0, -1)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	read, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(read, content) {
+		return fmt.Errorf("probe object was read back with different content")
+	}
+
+	return nil
+}
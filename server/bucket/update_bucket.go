@@ -0,0 +1,233 @@
+package bucket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/draganm/datas3t/apierror"
+	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// UpdateBucketRequest changes the configuration of an existing bucket. Fields left nil
+// keep their stored value.
+type UpdateBucketRequest struct {
+	Name            string  `json:"name"`
+	Endpoint        *string `json:"endpoint,omitempty"`
+	Bucket          *string `json:"bucket,omitempty"`
+	AccessKey       *string `json:"access_key,omitempty"`
+	SecretKey       *string `json:"secret_key,omitempty"`
+	SessionToken    *string `json:"session_token,omitempty"`
+	Region          *string `json:"region,omitempty"`
+	AddressingStyle *string `json:"addressing_style,omitempty"`
+	CredentialMode  *string `json:"credential_mode,omitempty"`
+	KeyPrefix       *string `json:"key_prefix,omitempty"`
+	SSEMode         *string `json:"sse_mode,omitempty"`
+	SSEKMSKeyID     *string `json:"sse_kms_key_id,omitempty"`
+	SSECustomerKey  *string `json:"sse_customer_key,omitempty"`
+}
+
+// apply merges the requested changes into the stored configuration of the bucket
+func (r *UpdateBucketRequest) apply(info *BucketInfo) {
+	if r.Endpoint != nil {
+		info.Endpoint = *r.Endpoint
+	}
+
+	if r.Bucket != nil {
+		info.Bucket = *r.Bucket
+	}
+
+	// A session token belongs to the access key it was issued for, so rotating the
+	// keys drops the stored token unless a new one is given
+	if r.AccessKey != nil || r.SecretKey != nil {
+		info.SessionToken = ""
+	}
+
+	if r.AccessKey != nil {
+		info.AccessKey = *r.AccessKey
+	}
+
+	if r.SecretKey != nil {
+		info.SecretKey = *r.SecretKey
+	}
+
+	if r.SessionToken != nil {
+		info.SessionToken = *r.SessionToken
+	}
+
+	if r.Region != nil {
+		info.Region = *r.Region
+	}
+
+	if r.AddressingStyle != nil {
+		info.AddressingStyle = *r.AddressingStyle
+	}
+
+	if r.KeyPrefix != nil {
+		info.KeyPrefix = *r.KeyPrefix
+	}
+
+	if r.SSEMode != nil {
+		info.SSEMode = *r.SSEMode
+
+		// The KMS key ID and the customer key only apply to their own mode
+		if info.SSEMode != storage.SSEModeKMS && r.SSEKMSKeyID == nil {
+			info.SSEKMSKeyID = ""
+		}
+		if info.SSEMode != storage.SSEModeCustomer && r.SSECustomerKey == nil {
+			info.SSECustomerKey = ""
+		}
+	}
+
+	if r.SSEKMSKeyID != nil {
+		info.SSEKMSKeyID = *r.SSEKMSKeyID
+	}
+
+	if r.SSECustomerKey != nil {
+		info.SSECustomerKey = *r.SSECustomerKey
+	}
+
+	if r.CredentialMode != nil {
+		info.CredentialMode = *r.CredentialMode
+
+		// Switching to ambient credentials drops the stored static ones
+		if info.CredentialMode == awsutil.CredentialModeAmbient && r.AccessKey == nil && r.SecretKey == nil && r.SessionToken == nil {
+			info.AccessKey = ""
+			info.SecretKey = ""
+			info.SessionToken = ""
+		}
+	}
+}
+
+// UpdateBucket changes the configuration of a bucket. The connection to the updated
+// configuration is tested before it is stored. The key prefix cannot change while datas3ts
+// use the bucket, as their objects would no longer be found below it, and neither can the
+// SSE-C customer key, as their objects could no longer be read. Concurrent updates of a
+// bucket are applied one after the other.
+func (s *BucketServer) UpdateBucket(ctx context.Context, log *slog.Logger, req *UpdateBucketRequest) (_ *BucketListInfo, err error) {
+	log = log.With("bucket_name", req.Name)
+	log.Info("Updating bucket")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to update bucket", "error", err)
+		} else {
+			log.Info("Bucket updated")
+		}
+	}()
+
+	if !bucketNameRegex.MatchString(req.Name) {
+		return nil, ValidationError(fmt.Errorf("invalid bucket name: %s", req.Name))
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := postgresstore.New(tx)
+
+	// Lock the bucket, datas3ts added and updates of the bucket made concurrently wait for
+	// the transaction to finish
+	bucketID, err := txQueries.LockBucket(ctx, req.Name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeBucketNotFound, "bucket '%s' does not exist", req.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock bucket: %w", err)
+	}
+
+	// The stored configuration is read under the lock, so that concurrent updates
+	// do not drop each other's changes
+	info, err := s.getBucketInfo(ctx, txQueries, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	storedKeyPrefix := info.KeyPrefix
+	storedCustomerKey := info.SSECustomerKey
+
+	req.apply(info)
+
+	err = info.Validate(ctx, log, s.storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate bucket info: %w", err)
+	}
+
+	encryptedAccessKey, encryptedSecretKey, err := s.encryptor.EncryptCredentials(
+		info.AccessKey,
+		info.SecretKey,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+
+	encryptedSessionToken, err := s.encryptor.Encrypt(info.SessionToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt session token: %w", err)
+	}
+
+	encryptedCustomerKey, err := s.encryptor.Encrypt(info.SSECustomerKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt sse customer key: %w", err)
+	}
+
+	if info.KeyPrefix != storedKeyPrefix || info.SSECustomerKey != storedCustomerKey {
+		datas3tCount, err := txQueries.CountDatas3tsForBucket(ctx, bucketID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count datas3ts for bucket: %w", err)
+		}
+
+		if datas3tCount > 0 {
+			setting := "key prefix"
+			if info.KeyPrefix == storedKeyPrefix {
+				setting = "sse customer key"
+			}
+			return nil, apierror.New(apierror.CodeBucketInUse, "cannot change the %s of bucket '%s': it is used by %d datas3ts", setting, req.Name, datas3tCount)
+		}
+	}
+
+	err = txQueries.UpdateBucket(ctx, postgresstore.UpdateBucketParams{
+		Name:            info.Name,
+		Endpoint:        info.Endpoint,
+		Bucket:          info.Bucket,
+		AccessKey:       encryptedAccessKey,
+		SecretKey:       encryptedSecretKey,
+		Region:          info.Region,
+		AddressingStyle: info.AddressingStyle,
+		SessionToken:    encryptedSessionToken,
+		CredentialMode:  info.CredentialMode,
+		KeyPrefix:       info.KeyPrefix,
+		SseMode:         info.SSEMode,
+		SseKmsKeyID:     info.SSEKMSKeyID,
+		SseCustomerKey:  encryptedCustomerKey,
+	})
+	if postgresstore.IsUniqueViolation(err) {
+		return nil, apierror.New(apierror.CodeBucketAlreadyExists, "failed to update bucket: bucket configuration for %s/%s with key prefix '%s' already exists", info.Endpoint, info.Bucket, info.KeyPrefix)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update bucket: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &BucketListInfo{
+		Name:            info.Name,
+		Endpoint:        info.Endpoint,
+		Bucket:          info.Bucket,
+		Region:          info.Region,
+		AddressingStyle: info.AddressingStyle,
+		CredentialMode:  info.CredentialMode,
+		KeyPrefix:       info.KeyPrefix,
+		SSEMode:         info.SSEMode,
+		SSEKMSKeyID:     info.SSEKMSKeyID,
+	}, nil
+}
@@ -2,13 +2,15 @@ package dataranges
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5"
 )
 
 type CancelAggregateRequest struct {
@@ -40,13 +42,16 @@ func (s *UploadDatarangeServer) CancelAggregate(
 
 	queries := postgresstore.New(tx)
 	uploadDetails, err := queries.GetAggregateUploadWithDetails(ctx, req.AggregateUploadID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apierror.New(apierror.CodeUploadNotFound, "failed to get aggregate upload details: %w", err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get aggregate upload details: %w", err)
 	}
 
-	s3Client, err := s.createS3ClientFromAggregateUploadDetails(ctx, log, uploadDetails)
+	store, err := s.openStore(ctx, log, aggregateStorageConfig(uploadDetails))
 	if err != nil {
-		return fmt.Errorf("failed to create S3 client: %w", err)
+		return err
 	}
 
 	// Create a timeout context for S3 operations (separate from main context)
@@ -54,7 +59,7 @@ func (s *UploadDatarangeServer) CancelAggregate(
 	defer s3Cancel()
 
 	// Perform comprehensive cleanup based on upload type
-	err = s.performAggregateComprehensiveCleanup(s3Ctx, log, s3Client, uploadDetails, queries)
+	err = s.performAggregateComprehensiveCleanup(s3Ctx, log, store, uploadDetails, queries)
 	if err != nil {
 		log.Warn("Some cleanup operations failed, but continuing with database cleanup", "error", err)
 		// Don't return error here - we want to continue with database cleanup
@@ -82,7 +87,7 @@ func (s *UploadDatarangeServer) CancelAggregate(
 func (s *UploadDatarangeServer) performAggregateComprehensiveCleanup(
 	ctx context.Context,
 	log *slog.Logger,
-	s3Client *s3.Client,
+	store storage.ObjectStore,
 	uploadDetails postgresstore.GetAggregateUploadWithDetailsRow,
 	queries *postgresstore.Queries,
 ) error {
@@ -92,7 +97,7 @@ func (s *UploadDatarangeServer) performAggregateComprehensiveCleanup(
 		log.Info("Cleaning up direct PUT aggregate upload")
 
 		// For direct PUT uploads, try immediate deletion first, then schedule if needed
-		err := s.cleanupAggregateDirectPutUpload(ctx, log, s3Client, uploadDetails, queries)
+		err := s.cleanupAggregateDirectPutUpload(ctx, log, store, uploadDetails, queries)
 		if err != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("direct PUT cleanup failed: %w", err))
 		}
@@ -100,7 +105,7 @@ func (s *UploadDatarangeServer) performAggregateComprehensiveCleanup(
 		log.Info("Cleaning up multipart aggregate upload", "upload_id", uploadDetails.UploadID)
 
 		// For multipart uploads, abort the upload and clean up any objects
-		err := s.cleanupAggregateMultipartUpload(ctx, log, s3Client, uploadDetails, queries)
+		err := s.cleanupAggregateMultipartUpload(ctx, log, store, uploadDetails, queries)
 		if err != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("multipart cleanup failed: %w", err))
 		}
@@ -121,18 +126,18 @@ func (s *UploadDatarangeServer) performAggregateComprehensiveCleanup(
 func (s *UploadDatarangeServer) cleanupAggregateDirectPutUpload(
 	ctx context.Context,
 	log *slog.Logger,
-	s3Client *s3.Client,
+	store storage.ObjectStore,
 	uploadDetails postgresstore.GetAggregateUploadWithDetailsRow,
 	queries *postgresstore.Queries,
 ) error {
 	var cleanupErrors []error
 
 	// Try to delete data object immediately
-	err := s.attemptImmediateObjectDeletion(ctx, log, s3Client, uploadDetails.Bucket, uploadDetails.DataObjectKey, "data")
+	err := s.attemptImmediateObjectDeletion(ctx, log, store, uploadDetails.Bucket, uploadDetails.DataObjectKey, "data")
 	if err != nil {
 		log.Warn("Immediate data object deletion failed, scheduling for later", "error", err)
 		// Schedule for deletion if immediate deletion fails
-		scheduleErr := s.scheduleAggregateObjectForDeletion(ctx, queries, s3Client, uploadDetails.Bucket, uploadDetails.DataObjectKey)
+		scheduleErr := s.scheduleAggregateObjectForDeletion(ctx, queries, store, uploadDetails.DataObjectKey)
 		if scheduleErr != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("failed to schedule data object deletion: %w", scheduleErr))
 		}
@@ -141,11 +146,11 @@ func (s *UploadDatarangeServer) cleanupAggregateDirectPutUpload(
 	}
 
 	// Try to delete index object immediately
-	err = s.attemptImmediateObjectDeletion(ctx, log, s3Client, uploadDetails.Bucket, uploadDetails.IndexObjectKey, "index")
+	err = s.attemptImmediateObjectDeletion(ctx, log, store, uploadDetails.Bucket, uploadDetails.IndexObjectKey, "index")
 	if err != nil {
 		log.Warn("Immediate index object deletion failed, scheduling for later", "error", err)
 		// Schedule for deletion if immediate deletion fails
-		scheduleErr := s.scheduleAggregateObjectForDeletion(ctx, queries, s3Client, uploadDetails.Bucket, uploadDetails.IndexObjectKey)
+		scheduleErr := s.scheduleAggregateObjectForDeletion(ctx, queries, store, uploadDetails.IndexObjectKey)
 		if scheduleErr != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("failed to schedule index object deletion: %w", scheduleErr))
 		}
@@ -163,7 +168,7 @@ func (s *UploadDatarangeServer) cleanupAggregateDirectPutUpload(
 func (s *UploadDatarangeServer) cleanupAggregateMultipartUpload(
 	ctx context.Context,
 	log *slog.Logger,
-	s3Client *s3.Client,
+	store storage.ObjectStore,
 	uploadDetails postgresstore.GetAggregateUploadWithDetailsRow,
 	queries *postgresstore.Queries,
 ) error {
@@ -171,11 +176,7 @@ func (s *UploadDatarangeServer) cleanupAggregateMultipartUpload(
 
 	// First, abort the multipart upload to clean up any uploaded parts
 	log.Info("Aborting multipart upload", "upload_id", uploadDetails.UploadID, "key", uploadDetails.DataObjectKey)
-	_, err := s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
-		Bucket:   aws.String(uploadDetails.Bucket),
-		Key:      aws.String(uploadDetails.DataObjectKey),
-		UploadId: aws.String(uploadDetails.UploadID),
-	})
+	err := store.AbortMultipartUpload(ctx, uploadDetails.DataObjectKey, uploadDetails.UploadID)
 	if err != nil {
 		log.Error("Failed to abort multipart upload", "error", err)
 		cleanupErrors = append(cleanupErrors, fmt.Errorf("failed to abort multipart upload: %w", err))
@@ -184,7 +185,7 @@ func (s *UploadDatarangeServer) cleanupAggregateMultipartUpload(
 	}
 
 	// Try to delete any potentially existing data object (in case the upload was completed but failed validation)
-	err = s.attemptImmediateObjectDeletion(ctx, log, s3Client, uploadDetails.Bucket, uploadDetails.DataObjectKey, "data")
+	err = s.attemptImmediateObjectDeletion(ctx, log, store, uploadDetails.Bucket, uploadDetails.DataObjectKey, "data")
 	if err != nil {
 		log.Debug("Data object deletion failed (expected if object doesn't exist)", "error", err)
 		// For multipart uploads, we don't schedule deletion of the data object since
@@ -194,11 +195,11 @@ func (s *UploadDatarangeServer) cleanupAggregateMultipartUpload(
 	}
 
 	// Try to delete index object immediately
-	err = s.attemptImmediateObjectDeletion(ctx, log, s3Client, uploadDetails.Bucket, uploadDetails.IndexObjectKey, "index")
+	err = s.attemptImmediateObjectDeletion(ctx, log, store, uploadDetails.Bucket, uploadDetails.IndexObjectKey, "index")
 	if err != nil {
 		log.Warn("Immediate index object deletion failed, scheduling for later", "error", err)
 		// Schedule for deletion if immediate deletion fails
-		scheduleErr := s.scheduleAggregateObjectForDeletion(ctx, queries, s3Client, uploadDetails.Bucket, uploadDetails.IndexObjectKey)
+		scheduleErr := s.scheduleAggregateObjectForDeletion(ctx, queries, store, uploadDetails.IndexObjectKey)
 		if scheduleErr != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("failed to schedule index object deletion: %w", scheduleErr))
 		}
@@ -216,17 +217,10 @@ func (s *UploadDatarangeServer) cleanupAggregateMultipartUpload(
 func (s *UploadDatarangeServer) scheduleAggregateObjectForDeletion(
 	ctx context.Context,
 	queries *postgresstore.Queries,
-	s3Client *s3.Client,
-	bucket, key string,
+	store storage.ObjectStore,
+	key string,
 ) error {
-	presigner := s3.NewPresignClient(s3Client)
-
-	deleteReq, err := presigner.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 24 * time.Hour
-	})
+	deleteURL, err := store.PresignDeleteObject(ctx, key, 24*time.Hour)
 	if err != nil {
 		return fmt.Errorf("failed to presign delete object: %w", err)
 	}
@@ -240,7 +234,7 @@ func (s *UploadDatarangeServer) scheduleAggregateObjectForDeletion(
 		originalCtx = dbCtx
 	}
 
-	err = queries.ScheduleKeyForDeletion(originalCtx, deleteReq.URL)
+	err = queries.ScheduleKeyForDeletion(originalCtx, deleteURL)
 	if err != nil {
 		return fmt.Errorf("failed to schedule object deletion: %w", err)
 	}
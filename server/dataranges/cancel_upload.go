@@ -2,13 +2,15 @@ package dataranges
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5"
 )
 
 type CancelUploadRequest struct {
@@ -40,13 +42,16 @@ func (s *UploadDatarangeServer) CancelDatarangeUpload(
 
 	queries := postgresstore.New(tx)
 	uploadDetails, err := queries.GetDatarangeUploadWithDetails(ctx, req.DatarangeUploadID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apierror.New(apierror.CodeUploadNotFound, "failed to get datarange upload details: %w", err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get datarange upload details: %w", err)
 	}
 
-	s3Client, err := s.createS3ClientFromUploadDetails(ctx, log, uploadDetails)
+	store, err := s.openStore(ctx, log, uploadStorageConfig(uploadDetails))
 	if err != nil {
-		return fmt.Errorf("failed to create S3 client: %w", err)
+		return err
 	}
 
 	// Create a timeout context for S3 operations (separate from main context)
@@ -54,7 +59,7 @@ func (s *UploadDatarangeServer) CancelDatarangeUpload(
 	defer s3Cancel()
 
 	// Perform comprehensive cleanup based on upload type
-	err = s.performComprehensiveCleanup(s3Ctx, log, s3Client, uploadDetails, queries)
+	err = s.performComprehensiveCleanup(s3Ctx, log, store, uploadDetails, queries)
 	if err != nil {
 		log.Warn("Some cleanup operations failed, but continuing with database cleanup", "error", err)
 		// Don't return error here - we want to continue with database cleanup
@@ -81,7 +86,7 @@ func (s *UploadDatarangeServer) CancelDatarangeUpload(
 func (s *UploadDatarangeServer) performComprehensiveCleanup(
 	ctx context.Context,
 	log *slog.Logger,
-	s3Client *s3.Client,
+	store storage.ObjectStore,
 	uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow,
 	queries *postgresstore.Queries,
 ) error {
@@ -91,7 +96,7 @@ func (s *UploadDatarangeServer) performComprehensiveCleanup(
 		log.Info("Cleaning up direct PUT upload")
 
 		// For direct PUT uploads, try immediate deletion first, then schedule if needed
-		err := s.cleanupDirectPutUpload(ctx, log, s3Client, uploadDetails, queries)
+		err := s.cleanupDirectPutUpload(ctx, log, store, uploadDetails, queries)
 		if err != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("direct PUT cleanup failed: %w", err))
 		}
@@ -99,7 +104,7 @@ func (s *UploadDatarangeServer) performComprehensiveCleanup(
 		log.Info("Cleaning up multipart upload", "upload_id", uploadDetails.UploadID)
 
 		// For multipart uploads, abort the upload and clean up any objects
-		err := s.cleanupMultipartUpload(ctx, log, s3Client, uploadDetails, queries)
+		err := s.cleanupMultipartUpload(ctx, log, store, uploadDetails, queries)
 		if err != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("multipart cleanup failed: %w", err))
 		}
@@ -120,18 +125,18 @@ func (s *UploadDatarangeServer) performComprehensiveCleanup(
 func (s *UploadDatarangeServer) cleanupDirectPutUpload(
 	ctx context.Context,
 	log *slog.Logger,
-	s3Client *s3.Client,
+	store storage.ObjectStore,
 	uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow,
 	queries *postgresstore.Queries,
 ) error {
 	var cleanupErrors []error
 
 	// Try to delete data object immediately
-	err := s.attemptImmediateObjectDeletion(ctx, log, s3Client, uploadDetails.Bucket, uploadDetails.DataObjectKey, "data")
+	err := s.attemptImmediateObjectDeletion(ctx, log, store, uploadDetails.Bucket, uploadDetails.DataObjectKey, "data")
 	if err != nil {
 		log.Warn("Immediate data object deletion failed, scheduling for later", "error", err)
 		// Schedule for deletion if immediate deletion fails
-		scheduleErr := s.scheduleObjectForDeletion(ctx, queries, s3Client, uploadDetails.Bucket, uploadDetails.DataObjectKey)
+		scheduleErr := s.scheduleObjectForDeletion(ctx, queries, store, uploadDetails.DataObjectKey)
 		if scheduleErr != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("failed to schedule data object deletion: %w", scheduleErr))
 		}
@@ -140,11 +145,11 @@ func (s *UploadDatarangeServer) cleanupDirectPutUpload(
 	}
 
 	// Try to delete index object immediately
-	err = s.attemptImmediateObjectDeletion(ctx, log, s3Client, uploadDetails.Bucket, uploadDetails.IndexObjectKey, "index")
+	err = s.attemptImmediateObjectDeletion(ctx, log, store, uploadDetails.Bucket, uploadDetails.IndexObjectKey, "index")
 	if err != nil {
 		log.Warn("Immediate index object deletion failed, scheduling for later", "error", err)
 		// Schedule for deletion if immediate deletion fails
-		scheduleErr := s.scheduleObjectForDeletion(ctx, queries, s3Client, uploadDetails.Bucket, uploadDetails.IndexObjectKey)
+		scheduleErr := s.scheduleObjectForDeletion(ctx, queries, store, uploadDetails.IndexObjectKey)
 		if scheduleErr != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("failed to schedule index object deletion: %w", scheduleErr))
 		}
@@ -162,7 +167,7 @@ func (s *UploadDatarangeServer) cleanupDirectPutUpload(
 func (s *UploadDatarangeServer) cleanupMultipartUpload(
 	ctx context.Context,
 	log *slog.Logger,
-	s3Client *s3.Client,
+	store storage.ObjectStore,
 	uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow,
 	queries *postgresstore.Queries,
 ) error {
@@ -170,11 +175,7 @@ func (s *UploadDatarangeServer) cleanupMultipartUpload(
 
 	// First, abort the multipart upload to clean up any uploaded parts
 	log.Info("Aborting multipart upload", "upload_id", uploadDetails.UploadID, "key", uploadDetails.DataObjectKey)
-	_, err := s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
-		Bucket:   aws.String(uploadDetails.Bucket),
-		Key:      aws.String(uploadDetails.DataObjectKey),
-		UploadId: aws.String(uploadDetails.UploadID),
-	})
+	err := store.AbortMultipartUpload(ctx, uploadDetails.DataObjectKey, uploadDetails.UploadID)
 	if err != nil {
 		log.Error("Failed to abort multipart upload", "error", err)
 		cleanupErrors = append(cleanupErrors, fmt.Errorf("failed to abort multipart upload: %w", err))
@@ -183,7 +184,7 @@ func (s *UploadDatarangeServer) cleanupMultipartUpload(
 	}
 
 	// Try to delete any potentially existing data object (in case the upload was completed but failed validation)
-	err = s.attemptImmediateObjectDeletion(ctx, log, s3Client, uploadDetails.Bucket, uploadDetails.DataObjectKey, "data")
+	err = s.attemptImmediateObjectDeletion(ctx, log, store, uploadDetails.Bucket, uploadDetails.DataObjectKey, "data")
 	if err != nil {
 		log.Debug("Data object deletion failed (expected if object doesn't exist)", "error", err)
 		// For multipart uploads, we don't schedule deletion of the data object since
@@ -193,11 +194,11 @@ func (s *UploadDatarangeServer) cleanupMultipartUpload(
 	}
 
 	// Try to delete index object immediately
-	err = s.attemptImmediateObjectDeletion(ctx, log, s3Client, uploadDetails.Bucket, uploadDetails.IndexObjectKey, "index")
+	err = s.attemptImmediateObjectDeletion(ctx, log, store, uploadDetails.Bucket, uploadDetails.IndexObjectKey, "index")
 	if err != nil {
 		log.Warn("Immediate index object deletion failed, scheduling for later", "error", err)
 		// Schedule for deletion if immediate deletion fails
-		scheduleErr := s.scheduleObjectForDeletion(ctx, queries, s3Client, uploadDetails.Bucket, uploadDetails.IndexObjectKey)
+		scheduleErr := s.scheduleObjectForDeletion(ctx, queries, store, uploadDetails.IndexObjectKey)
 		if scheduleErr != nil {
 			cleanupErrors = append(cleanupErrors, fmt.Errorf("failed to schedule index object deletion: %w", scheduleErr))
 		}
@@ -215,26 +216,20 @@ func (s *UploadDatarangeServer) cleanupMultipartUpload(
 func (s *UploadDatarangeServer) attemptImmediateObjectDeletion(
 	ctx context.Context,
 	log *slog.Logger,
-	s3Client *s3.Client,
+	store storage.ObjectStore,
 	bucket, key, objectType string,
 ) error {
 	log = log.With("bucket", bucket, "key", key, "object_type", objectType)
 
 	// First check if the object exists
-	_, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
+	_, err := store.HeadObject(ctx, key)
 	if err != nil {
 		log.Debug("Object does not exist, skipping deletion", "error", err)
 		return nil // Object doesn't exist, nothing to delete
 	}
 
 	// Object exists, attempt deletion
-	_, err = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
+	err = store.DeleteObject(ctx, key)
 	if err != nil {
 		return fmt.Errorf("failed to delete %s object: %w", objectType, err)
 	}
@@ -247,17 +242,10 @@ func (s *UploadDatarangeServer) attemptImmediateObjectDeletion(
 func (s *UploadDatarangeServer) scheduleObjectForDeletion(
 	ctx context.Context,
 	queries *postgresstore.Queries,
-	s3Client *s3.Client,
-	bucket, key string,
+	store storage.ObjectStore,
+	key string,
 ) error {
-	presigner := s3.NewPresignClient(s3Client)
-
-	deleteReq, err := presigner.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 24 * time.Hour
-	})
+	deleteURL, err := store.PresignDeleteObject(ctx, key, 24*time.Hour)
 	if err != nil {
 		return fmt.Errorf("failed to presign delete object: %w", err)
 	}
@@ -271,7 +259,7 @@ func (s *UploadDatarangeServer) scheduleObjectForDeletion(
 		originalCtx = dbCtx
 	}
 
-	err = queries.ScheduleKeyForDeletion(originalCtx, deleteReq.URL)
+	err = queries.ScheduleKeyForDeletion(originalCtx, deleteURL)
 	if err != nil {
 		return fmt.Errorf("failed to schedule object deletion: %w", err)
 	}
@@ -280,15 +268,15 @@ func (s *UploadDatarangeServer) scheduleObjectForDeletion(
 }
 
 // scheduleObjectsForDeletion schedules multiple objects for deletion (legacy function for backward compatibility)
-func (s *UploadDatarangeServer) scheduleObjectsForDeletion(ctx context.Context, queries *postgresstore.Queries, s3Client *s3.Client, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, indexObjectKey string) error {
+func (s *UploadDatarangeServer) scheduleObjectsForDeletion(ctx context.Context, queries *postgresstore.Queries, store storage.ObjectStore, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, indexObjectKey string) error {
 	// Schedule data object for deletion
-	err := s.scheduleObjectForDeletion(ctx, queries, s3Client, uploadDetails.Bucket, uploadDetails.DataObjectKey)
+	err := s.scheduleObjectForDeletion(ctx, queries, store, uploadDetails.DataObjectKey)
 	if err != nil {
 		return fmt.Errorf("failed to schedule data object deletion: %w", err)
 	}
 
 	// Schedule index object for deletion
-	err = s.scheduleObjectForDeletion(ctx, queries, s3Client, uploadDetails.Bucket, indexObjectKey)
+	err = s.scheduleObjectForDeletion(ctx, queries, store, indexObjectKey)
 	if err != nil {
 		return fmt.Errorf("failed to schedule index object deletion: %w", err)
 	}
@@ -4,23 +4,27 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"math/rand"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
 	"github.com/draganm/datas3t/tarindex"
+	"github.com/jackc/pgx/v5"
 )
 
 type CompleteAggregateRequest struct {
 	AggregateUploadID int64    `json:"aggregate_upload_id"`
 	UploadIDs         []string `json:"upload_ids,omitempty"` // Only used for multipart uploads
+
+	// WrappedDataKey is the data key the aggregate is encrypted with, required when the
+	// datas3t is encrypted. The content of the source dataranges is re-encrypted with it.
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
 }
 
 func (s *UploadDatarangeServer) CompleteAggregate(ctx context.Context, log *slog.Logger, req *CompleteAggregateRequest) (err error) {
@@ -38,64 +42,63 @@ func (s *UploadDatarangeServer) CompleteAggregate(ctx context.Context, log *slog
 	// 1. Get aggregate upload details (read-only operation)
 	queries := postgresstore.New(s.db)
 	uploadDetails, err := queries.GetAggregateUploadWithDetails(ctx, req.AggregateUploadID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apierror.New(apierror.CodeUploadNotFound, "failed to get aggregate upload details: %w", err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get aggregate upload details: %w", err)
 	}
 
-	// 2. Create S3 client
-	s3Client, err := s.createS3ClientFromAggregateUploadDetails(ctx, log, uploadDetails)
+	if len(req.WrappedDataKey) > maxWrappedDataKeyLength {
+		return ValidationError(fmt.Errorf("wrapped_data_key must be at most %d characters", maxWrappedDataKeyLength))
+	}
+
+	err = checkWrappedDataKey(uploadDetails.Encrypted, uploadDetails.Datas3tName, req.WrappedDataKey)
 	if err != nil {
-		return fmt.Errorf("failed to create S3 client: %w", err)
+		return err
+	}
+
+	// 2. Open the object store
+	store, err := s.openStore(ctx, log, aggregateStorageConfig(uploadDetails))
+	if err != nil {
+		return err
 	}
 
 	// 3. Perform all S3 operations first (without database changes)
-	err = s.performAggregateS3Operations(ctx, s3Client, uploadDetails, req.UploadIDs)
+	err = s.performAggregateS3Operations(ctx, store, uploadDetails, req.UploadIDs)
 	if err != nil {
 		// S3 operations failed - handle cleanup in a single transaction
-		return s.handleAggregateFailureInTransaction(ctx, queries, s3Client, uploadDetails, err)
+		return s.handleAggregateFailureInTransaction(ctx, queries, store, uploadDetails, err)
 	}
 
 	// 4. S3 operations succeeded - get actual uploaded size and complete in a single transaction
-	actualSize, err := s.getActualUploadedSize(ctx, s3Client, uploadDetails)
+	actualSize, err := s.getActualUploadedSize(ctx, store, uploadDetails)
 	if err != nil {
 		return fmt.Errorf("failed to get actual uploaded size: %w", err)
 	}
 
-	return s.handleAggregateSuccessInTransaction(ctx, queries, req.AggregateUploadID, actualSize)
+	return s.handleAggregateSuccessInTransaction(ctx, queries, req.AggregateUploadID, actualSize, req.WrappedDataKey)
 }
 
 // performAggregateS3Operations handles all S3 network calls without any database changes
-func (s *UploadDatarangeServer) performAggregateS3Operations(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, uploadIDs []string) error {
+func (s *UploadDatarangeServer) performAggregateS3Operations(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, uploadIDs []string) error {
 	// Complete upload (different logic for direct PUT vs multipart)
 	isDirectPut := uploadDetails.UploadID == "DIRECT_PUT"
 
 	if !isDirectPut {
 		// Handle multipart upload completion
-		var completedParts []types.CompletedPart
+		var completedParts []storage.Part
 		for i, uploadID := range uploadIDs {
-			completedParts = append(completedParts, types.CompletedPart{
-				ETag:       aws.String(uploadID),
-				PartNumber: aws.Int32(int32(i + 1)),
+			completedParts = append(completedParts, storage.Part{
+				ETag:       uploadID,
+				PartNumber: int32(i + 1),
 			})
 		}
 
-		completeInput := &s3.CompleteMultipartUploadInput{
-			Bucket:   aws.String(uploadDetails.Bucket),
-			Key:      aws.String(uploadDetails.DataObjectKey),
-			UploadId: aws.String(uploadDetails.UploadID),
-			MultipartUpload: &types.CompletedMultipartUpload{
-				Parts: completedParts,
-			},
-		}
-
-		_, err := s3Client.CompleteMultipartUpload(ctx, completeInput)
+		err := store.CompleteMultipartUpload(ctx, uploadDetails.DataObjectKey, uploadDetails.UploadID, completedParts)
 		if err != nil {
 			// Abort the upload if completion fails
-			s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
-				Bucket:   aws.String(uploadDetails.Bucket),
-				Key:      aws.String(uploadDetails.DataObjectKey),
-				UploadId: aws.String(uploadDetails.UploadID),
-			})
+			store.AbortMultipartUpload(ctx, uploadDetails.DataObjectKey, uploadDetails.UploadID)
 			return fmt.Errorf("failed to complete multipart upload: %w", err)
 		}
 	}
@@ -103,56 +106,37 @@ func (s *UploadDatarangeServer) performAggregateS3Operations(ctx context.Context
 
 	// Check if the index is present
 	indexObjectKey := uploadDetails.IndexObjectKey
-	_, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(indexObjectKey),
-	})
+	_, err := store.HeadObject(ctx, indexObjectKey)
 	if err != nil {
-		return fmt.Errorf("index file not found: %w", err)
+		return apierror.New(apierror.CodeUploadValidationFailed, "index file not found: %w", err)
 	}
 
 	// Get the actual size of the uploaded data
-	headResp, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.DataObjectKey),
-	})
+	actualUploadedSize, err := store.HeadObject(ctx, uploadDetails.DataObjectKey)
 	if err != nil {
 		return fmt.Errorf("failed to get uploaded object info: %w", err)
 	}
 
-	if headResp.ContentLength == nil {
-		return fmt.Errorf("uploaded object has no size information")
-	}
-
-	actualUploadedSize := aws.ToInt64(headResp.ContentLength)
 	if actualUploadedSize <= 0 {
 		return fmt.Errorf("uploaded object has invalid size: %d", actualUploadedSize)
 	}
 
 	// Perform tar index validation using actual uploaded size
-	err = s.validateAggregateTarIndex(ctx, s3Client, uploadDetails, actualUploadedSize)
+	err = s.validateAggregateTarIndex(ctx, store, uploadDetails, actualUploadedSize)
 	if err != nil {
-		return fmt.Errorf("aggregate tar index validation failed: %w", err)
+		return apierror.New(apierror.CodeUploadValidationFailed, "aggregate tar index validation failed: %w", err)
 	}
 
 	return nil
 }
 
 // getActualUploadedSize gets the actual uploaded size from S3
-func (s *UploadDatarangeServer) getActualUploadedSize(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow) (int64, error) {
-	headResp, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.DataObjectKey),
-	})
+func (s *UploadDatarangeServer) getActualUploadedSize(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow) (int64, error) {
+	actualUploadedSize, err := store.HeadObject(ctx, uploadDetails.DataObjectKey)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get uploaded object info: %w", err)
 	}
 
-	if headResp.ContentLength == nil {
-		return 0, fmt.Errorf("uploaded object has no size information")
-	}
-
-	actualUploadedSize := aws.ToInt64(headResp.ContentLength)
 	if actualUploadedSize <= 0 {
 		return 0, fmt.Errorf("uploaded object has invalid size: %d", actualUploadedSize)
 	}
@@ -161,7 +145,7 @@ func (s *UploadDatarangeServer) getActualUploadedSize(ctx context.Context, s3Cli
 }
 
 // handleAggregateSuccessInTransaction performs all success-case database operations in a single transaction
-func (s *UploadDatarangeServer) handleAggregateSuccessInTransaction(ctx context.Context, queries *postgresstore.Queries, aggregateUploadID int64, actualDataSize int64) error {
+func (s *UploadDatarangeServer) handleAggregateSuccessInTransaction(ctx context.Context, queries *postgresstore.Queries, aggregateUploadID int64, actualDataSize int64, wrappedDataKey string) error {
 	// Begin transaction
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
@@ -192,6 +176,7 @@ func (s *UploadDatarangeServer) handleAggregateSuccessInTransaction(ctx context.
 		MinDatapointKey: uploadDetails.FirstDatapointIndex,
 		MaxDatapointKey: uploadDetails.LastDatapointIndex,
 		SizeBytes:       actualDataSize,
+		WrappedDataKey:  wrappedDataKey,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create aggregate datarange: %w", err)
@@ -219,7 +204,7 @@ func (s *UploadDatarangeServer) handleAggregateSuccessInTransaction(ctx context.
 }
 
 // handleAggregateFailureInTransaction performs all failure-case database operations in a single transaction
-func (s *UploadDatarangeServer) handleAggregateFailureInTransaction(ctx context.Context, queries *postgresstore.Queries, s3Client *s3.Client, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, originalErr error) error {
+func (s *UploadDatarangeServer) handleAggregateFailureInTransaction(ctx context.Context, queries *postgresstore.Queries, store storage.ObjectStore, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, originalErr error) error {
 	// Begin transaction
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
@@ -268,61 +253,39 @@ func (s *UploadDatarangeServer) scheduleOriginalDatarangesForDeletion(ctx contex
 		return fmt.Errorf("failed to get original dataranges for deletion: %w", err)
 	}
 
-	if len(originalDataranges) == 0 {
-		return nil
-	}
-
-	// Group objects by bucket for efficient batch operations
-	bucketObjects := make(map[int64][]string)
-	for _, dr := range originalDataranges {
-		// Add both data and index objects to the bucket group
-		bucketObjects[dr.S3BucketID] = append(bucketObjects[dr.S3BucketID], dr.DataObjectKey, dr.IndexObjectKey)
-	}
-
-	// Schedule objects for deletion in batches per bucket
-	for bucketID, objectNames := range bucketObjects {
-		err := queries.ScheduleObjectsForDeletion(ctx, postgresstore.ScheduleObjectsForDeletionParams{
-			S3BucketID: &bucketID,
-			Column2:    objectNames,
-		})
-		if err != nil {
-			return fmt.Errorf("failed to schedule objects for deletion (bucket %d): %w", bucketID, err)
-		}
-	}
-
-	return nil
+	return scheduleDatarangesForDeletion(ctx, queries, originalDataranges)
 }
 
-func (s *UploadDatarangeServer) createS3ClientFromAggregateUploadDetails(ctx context.Context, log *slog.Logger, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow) (*s3.Client, error) {
-	// Decrypt credentials
-	accessKey, secretKey, err := s.encryptor.DecryptCredentials(uploadDetails.AccessKey, uploadDetails.SecretKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+// aggregateStorageConfig returns the bucket an aggregate upload is stored in
+func aggregateStorageConfig(uploadDetails postgresstore.GetAggregateUploadWithDetailsRow) storage.Config {
+	return storage.Config{
+		Endpoint:        uploadDetails.Endpoint,
+		Bucket:          uploadDetails.Bucket,
+		AccessKey:       uploadDetails.AccessKey,
+		SecretKey:       uploadDetails.SecretKey,
+		SessionToken:    uploadDetails.SessionToken,
+		Region:          uploadDetails.Region,
+		AddressingStyle: uploadDetails.AddressingStyle,
+		CredentialMode:  uploadDetails.CredentialMode,
+		ServerSideEncryption: storage.ServerSideEncryption{
+			Mode:        uploadDetails.SseMode,
+			KMSKeyID:    uploadDetails.SseKmsKeyID,
+			CustomerKey: uploadDetails.SseCustomerKey,
+		},
 	}
-
-	// Use shared AWS utility for S3 client creation with logging
-	return awsutil.CreateS3Client(ctx, awsutil.S3ClientConfig{
-		AccessKey: accessKey,
-		SecretKey: secretKey,
-		Endpoint:  uploadDetails.Endpoint,
-		Logger:    log,
-	})
 }
 
 // validateAggregateTarIndex performs validation of the aggregate tar index
-func (s *UploadDatarangeServer) validateAggregateTarIndex(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, actualUploadedSize int64) error {
+func (s *UploadDatarangeServer) validateAggregateTarIndex(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, actualUploadedSize int64) error {
 	// Download the index file
-	indexResp, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.IndexObjectKey),
-	})
+	indexBody, err := store.GetObject(ctx, uploadDetails.IndexObjectKey, 0, -1)
 	if err != nil {
 		return fmt.Errorf("failed to download index file: %w", err)
 	}
-	defer indexResp.Body.Close()
+	defer indexBody.Close()
 
 	// Read the index into memory
-	indexData, err := io.ReadAll(indexResp.Body)
+	indexData, err := io.ReadAll(indexBody)
 	if err != nil {
 		return fmt.Errorf("failed to read index data: %w", err)
 	}
@@ -350,13 +313,13 @@ func (s *UploadDatarangeServer) validateAggregateTarIndex(ctx context.Context, s
 	}
 
 	// Validate tar file size against actual uploaded size
-	err = s.validateAggregateTarFileSize(ctx, s3Client, uploadDetails, fakeIndex, actualUploadedSize)
+	err = s.validateAggregateTarFileSize(ctx, store, uploadDetails, fakeIndex, actualUploadedSize)
 	if err != nil {
 		return fmt.Errorf("aggregate tar file size validation failed: %w", err)
 	}
 
 	// Validate a few random entries
-	err = s.validateAggregateRandomEntries(ctx, s3Client, uploadDetails, fakeIndex, numEntries)
+	err = s.validateAggregateRandomEntries(ctx, store, uploadDetails, fakeIndex, numEntries)
 	if err != nil {
 		return fmt.Errorf("aggregate entry validation failed: %w", err)
 	}
@@ -365,7 +328,7 @@ func (s *UploadDatarangeServer) validateAggregateTarIndex(ctx context.Context, s
 }
 
 // validateAggregateTarFileSize validates the actual tar file size against the uploaded size
-func (s *UploadDatarangeServer) validateAggregateTarFileSize(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, index *tarindex.Index, actualUploadedSize int64) error {
+func (s *UploadDatarangeServer) validateAggregateTarFileSize(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, index *tarindex.Index, actualUploadedSize int64) error {
 
 	// Calculate expected size from the tar index
 	numFiles := index.NumFiles()
@@ -380,7 +343,7 @@ func (s *UploadDatarangeServer) validateAggregateTarFileSize(ctx context.Context
 	}
 
 	// Calculate expected tar file size
-	headerSize := int64(512)
+	headerSize := int64(lastFileMetadata.HeaderBlocks) * 512
 	paddedContentSize := ((lastFileMetadata.Size + 511) / 512) * 512
 	endOfArchiveSize := int64(1024)
 
@@ -396,7 +359,7 @@ func (s *UploadDatarangeServer) validateAggregateTarFileSize(ctx context.Context
 }
 
 // validateAggregateRandomEntries validates a few random entries in the aggregate
-func (s *UploadDatarangeServer) validateAggregateRandomEntries(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, index *tarindex.Index, numEntries int) error {
+func (s *UploadDatarangeServer) validateAggregateRandomEntries(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, index *tarindex.Index, numEntries int) error {
 	// Validate first, last, and a few random entries
 	var indicesToCheck []int
 
@@ -425,7 +388,7 @@ func (s *UploadDatarangeServer) validateAggregateRandomEntries(ctx context.Conte
 
 	// Validate each selected entry
 	for _, entryIdx := range indicesToCheck {
-		err := s.validateAggregateTarEntry(ctx, s3Client, uploadDetails, index, uint64(entryIdx))
+		err := s.validateAggregateTarEntry(ctx, store, uploadDetails, index, uint64(entryIdx))
 		if err != nil {
 			return fmt.Errorf("validation failed for entry %d: %w", entryIdx, err)
 		}
@@ -435,30 +398,30 @@ func (s *UploadDatarangeServer) validateAggregateRandomEntries(ctx context.Conte
 }
 
 // validateAggregateTarEntry validates a single tar entry in the aggregate
-func (s *UploadDatarangeServer) validateAggregateTarEntry(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, index *tarindex.Index, entryIdx uint64) error {
+func (s *UploadDatarangeServer) validateAggregateTarEntry(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetAggregateUploadWithDetailsRow, index *tarindex.Index, entryIdx uint64) error {
 	// Get file metadata from index
 	metadata, err := index.GetFileMetadata(entryIdx)
 	if err != nil {
 		return fmt.Errorf("failed to get file metadata: %w", err)
 	}
 
-	// Calculate the range to download (header + some content to read the full header)
-	headerSize := int64(512)
+	if metadata.HeaderBlocks == 0 {
+		return fmt.Errorf("index entry has no header blocks")
+	}
+
+	// Download all header blocks, extended headers (e.g. PAX records) precede the header
+	// of the file
+	headerSize := int64(metadata.HeaderBlocks) * 512
 	rangeStart := metadata.Start
-	rangeEnd := metadata.Start + headerSize - 1
 
 	// Download the tar header portion
-	headerResp, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.DataObjectKey),
-		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", rangeStart, rangeEnd)),
-	})
+	headerBody, err := store.GetObject(ctx, uploadDetails.DataObjectKey, rangeStart, headerSize)
 	if err != nil {
 		return fmt.Errorf("failed to download tar header: %w", err)
 	}
-	defer headerResp.Body.Close()
+	defer headerBody.Close()
 
-	headerData, err := io.ReadAll(headerResp.Body)
+	headerData, err := io.ReadAll(headerBody)
 	if err != nil {
 		return fmt.Errorf("failed to read header data: %w", err)
 	}
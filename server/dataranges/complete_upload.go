@@ -4,6 +4,7 @@ import (
 	"archive/tar"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -12,17 +13,22 @@ import (
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
 	"github.com/draganm/datas3t/tarindex"
+	"github.com/jackc/pgx/v5"
 )
 
 type CompleteUploadRequest struct {
 	DatarangeUploadID int64    `json:"datarange_upload_id"`
 	UploadIDs         []string `json:"upload_ids,omitempty"` // Only used for multipart uploads
+
+	// Declared when completing a streamed upload, whose size and datapoint range are
+	// only known once the whole stream was read
+	DataSize            uint64 `json:"data_size,omitempty"`
+	FirstDatapointIndex uint64 `json:"first_datapoint_index,omitempty"`
+	NumberOfDatapoints  uint64 `json:"number_of_datapoints,omitempty"`
 }
 
 func (s *UploadDatarangeServer) CompleteDatarangeUpload(ctx context.Context, log *slog.Logger, req *CompleteUploadRequest) (err error) {
@@ -40,59 +46,83 @@ func (s *UploadDatarangeServer) CompleteDatarangeUpload(ctx context.Context, log
 	// 1. Get datarange upload details (read-only operation)
 	queries := postgresstore.New(s.db)
 	uploadDetails, err := queries.GetDatarangeUploadWithDetails(ctx, req.DatarangeUploadID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apierror.New(apierror.CodeUploadNotFound, "failed to get datarange upload details: %w", err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get datarange upload details: %w", err)
 	}
 
-	// 2. Create S3 client
-	s3Client, err := s.createS3ClientFromUploadDetails(ctx, log, uploadDetails)
+	uploadDetails, err = declareStreamedUpload(req, uploadDetails)
 	if err != nil {
-		return fmt.Errorf("failed to create S3 client: %w", err)
+		return err
+	}
+
+	// Fail fast when another upload holds a lease on the range, before completing the
+	// objects. The lease is checked again under the lock on the datas3t.
+	err = checkLeaseConflict(
+		ctx,
+		queries,
+		uploadDetails.Datas3tID,
+		uploadDetails.ID,
+		uploadDetails.FirstDatapointIndex,
+		uploadDetails.FirstDatapointIndex+uploadDetails.NumberOfDatapoints-1,
+	)
+	if err != nil {
+		return err
+	}
+
+	// 2. Open the object store
+	store, err := s.openStore(ctx, log, uploadStorageConfig(uploadDetails))
+	if err != nil {
+		return err
 	}
 
 	// 3. Perform all S3 operations first (without database changes)
-	err = s.performS3Operations(ctx, s3Client, uploadDetails, req.UploadIDs)
+	err = s.performS3Operations(ctx, store, uploadDetails, req.UploadIDs)
 	if err != nil {
 		// S3 operations failed - handle cleanup in a single transaction
-		return s.handleFailureInTransaction(ctx, queries, s3Client, uploadDetails, err)
+		return s.handleFailureInTransaction(ctx, queries, store, uploadDetails, err)
+	}
+
+	if uploadDetails.Streamed {
+		moved, err := s.moveStreamedUpload(ctx, queries, store, uploadDetails)
+		if err != nil {
+			return s.handleFailureInTransaction(ctx, queries, store, uploadDetails, err)
+		}
+		uploadDetails = moved
 	}
 
 	// 4. S3 operations succeeded - complete in a single transaction
-	return s.handleSuccessInTransaction(ctx, queries, req.DatarangeUploadID)
+	err = s.handleSuccessInTransaction(ctx, queries, req.DatarangeUploadID)
+	if errors.Is(err, ErrDatarangeOverlap) {
+		// Another upload of the range completed first, or the dataranges a replacing upload
+		// swaps out changed, it can never complete
+		return s.handleFailureInTransaction(ctx, queries, store, uploadDetails, err)
+	}
+
+	return err
 }
 
 // performS3Operations handles all S3 network calls without any database changes
-func (s *UploadDatarangeServer) performS3Operations(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, uploadIDs []string) error {
+func (s *UploadDatarangeServer) performS3Operations(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, uploadIDs []string) error {
 	// Complete upload (different logic for direct PUT vs multipart)
 	isDirectPut := uploadDetails.UploadID == "DIRECT_PUT"
 
 	if !isDirectPut {
 		// Handle multipart upload completion
-		var completedParts []types.CompletedPart
+		var completedParts []storage.Part
 		for i, uploadID := range uploadIDs {
-			completedParts = append(completedParts, types.CompletedPart{
-				ETag:       aws.String(uploadID),
-				PartNumber: aws.Int32(int32(i + 1)),
+			completedParts = append(completedParts, storage.Part{
+				ETag:       uploadID,
+				PartNumber: int32(i + 1),
 			})
 		}
 
-		completeInput := &s3.CompleteMultipartUploadInput{
-			Bucket:   aws.String(uploadDetails.Bucket),
-			Key:      aws.String(uploadDetails.DataObjectKey),
-			UploadId: aws.String(uploadDetails.UploadID),
-			MultipartUpload: &types.CompletedMultipartUpload{
-				Parts: completedParts,
-			},
-		}
-
-		_, err := s3Client.CompleteMultipartUpload(ctx, completeInput)
+		err := store.CompleteMultipartUpload(ctx, uploadDetails.DataObjectKey, uploadDetails.UploadID, completedParts)
 		if err != nil {
 			// Abort the upload if completion fails
-			s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
-				Bucket:   aws.String(uploadDetails.Bucket),
-				Key:      aws.String(uploadDetails.DataObjectKey),
-				UploadId: aws.String(uploadDetails.UploadID),
-			})
+			store.AbortMultipartUpload(ctx, uploadDetails.DataObjectKey, uploadDetails.UploadID)
 			return fmt.Errorf("failed to complete multipart upload: %w", err)
 		}
 	}
@@ -100,32 +130,26 @@ func (s *UploadDatarangeServer) performS3Operations(ctx context.Context, s3Clien
 
 	// Check if the index is present
 	indexObjectKey := uploadDetails.IndexObjectKey
-	_, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(indexObjectKey),
-	})
+	_, err := store.HeadObject(ctx, indexObjectKey)
 	if err != nil {
-		return fmt.Errorf("index file not found: %w", err)
+		return apierror.New(apierror.CodeUploadValidationFailed, "index file not found: %w", err)
 	}
 
 	// Check the size of the uploaded data
-	headResp, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.DataObjectKey),
-	})
+	uploadedSize, err := store.HeadObject(ctx, uploadDetails.DataObjectKey)
 	if err != nil {
 		return fmt.Errorf("failed to get uploaded object info: %w", err)
 	}
 
-	if headResp.ContentLength == nil || *headResp.ContentLength != uploadDetails.DataSize {
-		return fmt.Errorf("uploaded size mismatch: expected %d, got %d",
-			uploadDetails.DataSize, aws.ToInt64(headResp.ContentLength))
+	if uploadedSize != uploadDetails.DataSize {
+		return apierror.New(apierror.CodeUploadValidationFailed, "uploaded size mismatch: expected %d, got %d",
+			uploadDetails.DataSize, uploadedSize)
 	}
 
 	// Perform tar index validation
-	err = s.validateTarIndex(ctx, s3Client, uploadDetails)
+	err = s.validateTarIndex(ctx, store, uploadDetails)
 	if err != nil {
-		return fmt.Errorf("tar index validation failed: %w", err)
+		return apierror.New(apierror.CodeUploadValidationFailed, "tar index validation failed: %w", err)
 	}
 
 	return nil
@@ -149,6 +173,53 @@ func (s *UploadDatarangeServer) handleSuccessInTransaction(ctx context.Context,
 		return fmt.Errorf("failed to get upload details: %w", err)
 	}
 
+	// Concurrent completions of uploads of the same datas3t are serialized by the lock on
+	// the datas3t, so that only the first of overlapping uploads creates its datarange
+	err = txQueries.LockDatas3t(ctx, uploadDetails.Datas3tID)
+	if err != nil {
+		return fmt.Errorf("failed to lock datas3t: %w", err)
+	}
+
+	// An upload that overlaps the active lease of another upload cannot complete, it may
+	// be retried once the lease has been released or has expired. Leases are taken and
+	// renewed under the same lock.
+	err = checkLeaseConflict(
+		ctx,
+		txQueries,
+		uploadDetails.Datas3tID,
+		uploadDetails.ID,
+		uploadDetails.FirstDatapointIndex,
+		uploadDetails.FirstDatapointIndex+uploadDetails.NumberOfDatapoints-1,
+	)
+	if err != nil {
+		return err
+	}
+
+	if uploadDetails.ReplacedDatarangeIds == nil {
+		err = checkCompletedUploadOverlap(ctx, txQueries, uploadDetails)
+		if err != nil {
+			return err
+		}
+	}
+
+	// A replacing upload swaps out the dataranges of its range
+	if uploadDetails.ReplacedDatarangeIds != nil {
+		replaced, err := checkReplacedDataranges(ctx, txQueries, uploadDetails)
+		if err != nil {
+			return err
+		}
+
+		err = scheduleDatarangesForDeletion(ctx, txQueries, replaced)
+		if err != nil {
+			return fmt.Errorf("failed to schedule replaced dataranges for deletion: %w", err)
+		}
+
+		err = txQueries.DeleteDatarangesByIDs(ctx, uploadDetails.ReplacedDatarangeIds)
+		if err != nil {
+			return fmt.Errorf("failed to delete replaced dataranges: %w", err)
+		}
+	}
+
 	// Create the datarange record now that upload is successful
 	lastDatapointIndex := uploadDetails.FirstDatapointIndex + uploadDetails.NumberOfDatapoints - 1
 	_, err = txQueries.CreateDatarange(ctx, postgresstore.CreateDatarangeParams{
@@ -158,6 +229,7 @@ func (s *UploadDatarangeServer) handleSuccessInTransaction(ctx context.Context,
 		MinDatapointKey: uploadDetails.FirstDatapointIndex,
 		MaxDatapointKey: lastDatapointIndex,
 		SizeBytes:       uploadDetails.DataSize,
+		WrappedDataKey:  uploadDetails.WrappedDataKey,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create datarange: %w", err)
@@ -178,8 +250,28 @@ func (s *UploadDatarangeServer) handleSuccessInTransaction(ctx context.Context,
 	return nil
 }
 
+// checkCompletedUploadOverlap fails with ErrDatarangeOverlap if the range of a completing
+// upload overlaps existing dataranges. Overlapping uploads may be started, only the first
+// one to complete creates its datarange.
+func checkCompletedUploadOverlap(ctx context.Context, queries *postgresstore.Queries, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow) error {
+	hasOverlap, err := queries.CheckDatarangeOverlap(ctx, postgresstore.CheckDatarangeOverlapParams{
+		Datas3tID:       uploadDetails.Datas3tID,
+		MinDatapointKey: uploadDetails.FirstDatapointIndex + uploadDetails.NumberOfDatapoints, // Check if existing max >= our min
+		MaxDatapointKey: uploadDetails.FirstDatapointIndex,                                    // Check if existing min < our max
+	})
+	if err != nil {
+		return fmt.Errorf("failed to check datarange overlap: %w", err)
+	}
+
+	if hasOverlap {
+		return fmt.Errorf("%w: datarange overlaps with existing dataranges", ErrDatarangeOverlap)
+	}
+
+	return nil
+}
+
 // handleFailureInTransaction performs all failure-case database operations in a single transaction
-func (s *UploadDatarangeServer) handleFailureInTransaction(ctx context.Context, queries *postgresstore.Queries, s3Client *s3.Client, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, originalErr error) error {
+func (s *UploadDatarangeServer) handleFailureInTransaction(ctx context.Context, queries *postgresstore.Queries, store storage.ObjectStore, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, originalErr error) error {
 	// Begin transaction
 	tx, err := s.db.Begin(ctx)
 	if err != nil {
@@ -191,38 +283,27 @@ func (s *UploadDatarangeServer) handleFailureInTransaction(ctx context.Context,
 	txQueries := queries.WithTx(tx)
 
 	// Generate presigned delete URLs for both data and index objects
-	presigner := s3.NewPresignClient(s3Client)
 
 	// Schedule data object for deletion
-	dataDeleteReq, err := presigner.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.DataObjectKey),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 24 * time.Hour
-	})
+	dataDeleteURL, err := store.PresignDeleteObject(ctx, uploadDetails.DataObjectKey, 24*time.Hour)
 	if err != nil {
 		return fmt.Errorf("failed to presign data object delete: %w", err)
 	}
 
 	// Schedule index object for deletion
-	indexDeleteReq, err := presigner.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.IndexObjectKey),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 24 * time.Hour
-	})
+	indexDeleteURL, err := store.PresignDeleteObject(ctx, uploadDetails.IndexObjectKey, 24*time.Hour)
 	if err != nil {
 		return fmt.Errorf("failed to presign index object delete: %w", err)
 	}
 
 	// Schedule both objects for deletion
 
-	err = txQueries.ScheduleKeyForDeletion(ctx, dataDeleteReq.URL)
+	err = txQueries.ScheduleKeyForDeletion(ctx, dataDeleteURL)
 	if err != nil {
 		return fmt.Errorf("failed to schedule data object deletion: %w", err)
 	}
 
-	err = txQueries.ScheduleKeyForDeletion(ctx, indexDeleteReq.URL)
+	err = txQueries.ScheduleKeyForDeletion(ctx, indexDeleteURL)
 	if err != nil {
 		return fmt.Errorf("failed to schedule index object deletion: %w", err)
 	}
@@ -243,36 +324,36 @@ func (s *UploadDatarangeServer) handleFailureInTransaction(ctx context.Context,
 	return originalErr
 }
 
-func (s *UploadDatarangeServer) createS3ClientFromUploadDetails(ctx context.Context, log *slog.Logger, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow) (*s3.Client, error) {
-	// Decrypt credentials
-	accessKey, secretKey, err := s.encryptor.DecryptCredentials(uploadDetails.AccessKey, uploadDetails.SecretKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+// uploadStorageConfig returns the bucket a datarange upload is stored in
+func uploadStorageConfig(uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow) storage.Config {
+	return storage.Config{
+		Endpoint:        uploadDetails.Endpoint,
+		Bucket:          uploadDetails.Bucket,
+		AccessKey:       uploadDetails.AccessKey,
+		SecretKey:       uploadDetails.SecretKey,
+		SessionToken:    uploadDetails.SessionToken,
+		Region:          uploadDetails.Region,
+		AddressingStyle: uploadDetails.AddressingStyle,
+		CredentialMode:  uploadDetails.CredentialMode,
+		ServerSideEncryption: storage.ServerSideEncryption{
+			Mode:        uploadDetails.SseMode,
+			KMSKeyID:    uploadDetails.SseKmsKeyID,
+			CustomerKey: uploadDetails.SseCustomerKey,
+		},
 	}
-
-	// Use shared AWS utility for S3 client creation with logging
-	return awsutil.CreateS3Client(ctx, awsutil.S3ClientConfig{
-		AccessKey: accessKey,
-		SecretKey: secretKey,
-		Endpoint:  uploadDetails.Endpoint,
-		Logger:    log,
-	})
 }
 
 // validateTarIndex performs random sampling validation of tar entries
-func (s *UploadDatarangeServer) validateTarIndex(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow) error {
+func (s *UploadDatarangeServer) validateTarIndex(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow) error {
 	// Download the index file
-	indexResp, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.IndexObjectKey),
-	})
+	indexBody, err := store.GetObject(ctx, uploadDetails.IndexObjectKey, 0, -1)
 	if err != nil {
 		return fmt.Errorf("failed to download index file: %w", err)
 	}
-	defer indexResp.Body.Close()
+	defer indexBody.Close()
 
 	// Read the index into memory
-	indexData, err := io.ReadAll(indexResp.Body)
+	indexData, err := io.ReadAll(indexBody)
 	if err != nil {
 		return fmt.Errorf("failed to read index data: %w", err)
 	}
@@ -295,7 +376,7 @@ func (s *UploadDatarangeServer) validateTarIndex(ctx context.Context, s3Client *
 	}
 
 	// Validate tar file size against expected size
-	err = s.validateTarFileSize(ctx, s3Client, uploadDetails, fakeIndex)
+	err = s.validateTarFileSize(ctx, store, uploadDetails, fakeIndex)
 	if err != nil {
 		return fmt.Errorf("tar file size validation failed: %w", err)
 	}
@@ -329,7 +410,7 @@ func (s *UploadDatarangeServer) validateTarIndex(ctx context.Context, s3Client *
 
 	// Validate each selected entry
 	for _, entryIdx := range indicesToCheck {
-		err = s.validateTarEntry(ctx, s3Client, uploadDetails, fakeIndex, uint64(entryIdx))
+		err = s.validateTarEntry(ctx, store, uploadDetails, fakeIndex, uint64(entryIdx))
 		if err != nil {
 			return fmt.Errorf("validation failed for entry %d: %w", entryIdx, err)
 		}
@@ -339,7 +420,7 @@ func (s *UploadDatarangeServer) validateTarIndex(ctx context.Context, s3Client *
 }
 
 // validateTarFileSize validates the actual tar file size against the expected size calculated from the index
-func (s *UploadDatarangeServer) validateTarFileSize(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, index *tarindex.Index) error {
+func (s *UploadDatarangeServer) validateTarFileSize(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, index *tarindex.Index) error {
 	// Get the actual file size from the database
 	expectedSizeFromDB := uploadDetails.DataSize
 
@@ -357,10 +438,10 @@ func (s *UploadDatarangeServer) validateTarFileSize(ctx context.Context, s3Clien
 
 	// Calculate expected tar file size:
 	// - Start position of last file
-	// - + Header size (512 bytes)
+	// - + Header size (512 bytes per header block)
 	// - + Content size padded to 512-byte boundary
 	// - + End-of-archive marker (1024 bytes of zeroes)
-	headerSize := int64(512)
+	headerSize := int64(lastFileMetadata.HeaderBlocks) * 512
 	paddedContentSize := ((lastFileMetadata.Size + 511) / 512) * 512 // Round up to 512-byte boundary
 	endOfArchiveSize := int64(1024)                                  // Two 512-byte blocks of zeroes
 
@@ -373,15 +454,11 @@ func (s *UploadDatarangeServer) validateTarFileSize(ctx context.Context, s3Clien
 	}
 
 	// Double-check against actual S3 object size
-	headResp, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.DataObjectKey),
-	})
+	actualSize, err := store.HeadObject(ctx, uploadDetails.DataObjectKey)
 	if err != nil {
 		return fmt.Errorf("failed to get actual object size: %w", err)
 	}
 
-	actualSize := aws.ToInt64(headResp.ContentLength)
 	if actualSize != calculatedSize {
 		return fmt.Errorf("tar size mismatch: actual S3 object is %d bytes, calculated from index %d bytes",
 			actualSize, calculatedSize)
@@ -391,31 +468,30 @@ func (s *UploadDatarangeServer) validateTarFileSize(ctx context.Context, s3Clien
 }
 
 // validateTarEntry validates a single tar entry
-func (s *UploadDatarangeServer) validateTarEntry(ctx context.Context, s3Client *s3.Client, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, index *tarindex.Index, entryIdx uint64) error {
+func (s *UploadDatarangeServer) validateTarEntry(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, index *tarindex.Index, entryIdx uint64) error {
 	// Get file metadata from index
 	metadata, err := index.GetFileMetadata(entryIdx)
 	if err != nil {
 		return fmt.Errorf("failed to get file metadata: %w", err)
 	}
 
-	// Calculate the range to download (header + some content to read the full header)
-	// TAR header is always 512 bytes
-	headerSize := int64(512)
+	if metadata.HeaderBlocks == 0 {
+		return fmt.Errorf("index entry has no header blocks")
+	}
+
+	// Download all header blocks, extended headers (e.g. PAX records) precede the header
+	// of the file
+	headerSize := int64(metadata.HeaderBlocks) * 512
 	rangeStart := metadata.Start
-	rangeEnd := metadata.Start + headerSize - 1
 
 	// Download the tar header portion
-	headerResp, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(uploadDetails.Bucket),
-		Key:    aws.String(uploadDetails.DataObjectKey),
-		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", rangeStart, rangeEnd)),
-	})
+	headerBody, err := store.GetObject(ctx, uploadDetails.DataObjectKey, rangeStart, headerSize)
 	if err != nil {
 		return fmt.Errorf("failed to download tar header: %w", err)
 	}
-	defer headerResp.Body.Close()
+	defer headerBody.Close()
 
-	headerData, err := io.ReadAll(headerResp.Body)
+	headerData, err := io.ReadAll(headerBody)
 	if err != nil {
 		return fmt.Errorf("failed to read header data: %w", err)
 	}
@@ -2,14 +2,15 @@ package dataranges
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5"
 )
 
 type DeleteDatarangeRequest struct {
@@ -20,11 +21,11 @@ type DeleteDatarangeRequest struct {
 
 func (r *DeleteDatarangeRequest) Validate(ctx context.Context) error {
 	if r.Datas3tName == "" {
-		return fmt.Errorf("datas3t_name is required")
+		return ValidationError(fmt.Errorf("datas3t_name is required"))
 	}
 
 	if r.LastDatapointKey < r.FirstDatapointKey {
-		return fmt.Errorf("last_datapoint_key must be greater than or equal to first_datapoint_key")
+		return ValidationError(fmt.Errorf("last_datapoint_key must be greater than or equal to first_datapoint_key"))
 	}
 
 	return nil
@@ -58,22 +59,25 @@ func (s *UploadDatarangeServer) DeleteDatarange(ctx context.Context, log *slog.L
 		MinDatapointKey: int64(req.FirstDatapointKey),
 		MaxDatapointKey: int64(req.LastDatapointKey),
 	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apierror.New(apierror.CodeDatarangeNotFound, "failed to find datarange: %w", err)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to find datarange: %w", err)
 	}
 
-	// 2. Create S3 client
-	s3Client, err := s.createS3ClientFromDatarangeDetails(ctx, log, datarangeDetails)
+	// 2. Open the object store
+	store, err := s.openStore(ctx, log, datarangeStorageConfig(datarangeDetails))
 	if err != nil {
-		return fmt.Errorf("failed to create S3 client: %w", err)
+		return err
 	}
 
 	// 3. Delete S3 objects immediately
-	err = s.deleteS3Objects(ctx, log, s3Client, datarangeDetails)
+	err = s.deleteS3Objects(ctx, log, store, datarangeDetails)
 	if err != nil {
 		// S3 deletion failed - schedule for later deletion and continue with database cleanup
 		log.Warn("Immediate S3 deletion failed, scheduling for later", "error", err)
-		scheduleErr := s.scheduleDatarangeObjectsForDeletion(ctx, queries, s3Client, datarangeDetails)
+		scheduleErr := s.scheduleDatarangeObjectsForDeletion(ctx, queries, store, datarangeDetails)
 		if scheduleErr != nil {
 			log.Error("Failed to schedule objects for deletion", "error", scheduleErr)
 			// Continue with database cleanup even if scheduling fails
@@ -84,35 +88,32 @@ func (s *UploadDatarangeServer) DeleteDatarange(ctx context.Context, log *slog.L
 	return s.deleteDatarangeFromDatabase(ctx, queries, datarangeDetails.ID)
 }
 
-// createS3ClientFromDatarangeDetails creates an S3 client from datarange details
-func (s *UploadDatarangeServer) createS3ClientFromDatarangeDetails(ctx context.Context, log *slog.Logger, datarangeDetails postgresstore.GetDatarangeByExactRangeRow) (*s3.Client, error) {
-	// Decrypt credentials
-	accessKey, secretKey, err := s.encryptor.DecryptCredentials(datarangeDetails.AccessKey, datarangeDetails.SecretKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+// datarangeStorageConfig returns the bucket a datarange is stored in
+func datarangeStorageConfig(datarangeDetails postgresstore.GetDatarangeByExactRangeRow) storage.Config {
+	return storage.Config{
+		Endpoint:        datarangeDetails.Endpoint,
+		Bucket:          datarangeDetails.Bucket,
+		AccessKey:       datarangeDetails.AccessKey,
+		SecretKey:       datarangeDetails.SecretKey,
+		SessionToken:    datarangeDetails.SessionToken,
+		Region:          datarangeDetails.Region,
+		AddressingStyle: datarangeDetails.AddressingStyle,
+		CredentialMode:  datarangeDetails.CredentialMode,
 	}
-
-	// Use shared AWS utility for S3 client creation with logging
-	return awsutil.CreateS3Client(ctx, awsutil.S3ClientConfig{
-		AccessKey: accessKey,
-		SecretKey: secretKey,
-		Endpoint:  datarangeDetails.Endpoint,
-		Logger:    log,
-	})
 }
 
 // deleteS3Objects attempts to delete both data and index objects immediately
-func (s *UploadDatarangeServer) deleteS3Objects(ctx context.Context, log *slog.Logger, s3Client *s3.Client, datarangeDetails postgresstore.GetDatarangeByExactRangeRow) error {
+func (s *UploadDatarangeServer) deleteS3Objects(ctx context.Context, log *slog.Logger, store storage.ObjectStore, datarangeDetails postgresstore.GetDatarangeByExactRangeRow) error {
 	var deletionErrors []error
 
 	// Delete data object
-	err := s.attemptImmediateObjectDeletion(ctx, log, s3Client, datarangeDetails.Bucket, datarangeDetails.DataObjectKey, "data")
+	err := s.attemptImmediateObjectDeletion(ctx, log, store, datarangeDetails.Bucket, datarangeDetails.DataObjectKey, "data")
 	if err != nil {
 		deletionErrors = append(deletionErrors, fmt.Errorf("failed to delete data object: %w", err))
 	}
 
 	// Delete index object
-	err = s.attemptImmediateObjectDeletion(ctx, log, s3Client, datarangeDetails.Bucket, datarangeDetails.IndexObjectKey, "index")
+	err = s.attemptImmediateObjectDeletion(ctx, log, store, datarangeDetails.Bucket, datarangeDetails.IndexObjectKey, "index")
 	if err != nil {
 		deletionErrors = append(deletionErrors, fmt.Errorf("failed to delete index object: %w", err))
 	}
@@ -129,39 +130,27 @@ func (s *UploadDatarangeServer) deleteS3Objects(ctx context.Context, log *slog.L
 }
 
 // scheduleDatarangeObjectsForDeletion schedules both data and index objects for later deletion
-func (s *UploadDatarangeServer) scheduleDatarangeObjectsForDeletion(ctx context.Context, queries *postgresstore.Queries, s3Client *s3.Client, datarangeDetails postgresstore.GetDatarangeByExactRangeRow) error {
-	presigner := s3.NewPresignClient(s3Client)
-
+func (s *UploadDatarangeServer) scheduleDatarangeObjectsForDeletion(ctx context.Context, queries *postgresstore.Queries, store storage.ObjectStore, datarangeDetails postgresstore.GetDatarangeByExactRangeRow) error {
 	// Schedule data object for deletion
-	dataDeleteReq, err := presigner.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(datarangeDetails.Bucket),
-		Key:    aws.String(datarangeDetails.DataObjectKey),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 24 * time.Hour
-	})
+	dataDeleteURL, err := store.PresignDeleteObject(ctx, datarangeDetails.DataObjectKey, 24*time.Hour)
 	if err != nil {
 		return fmt.Errorf("failed to presign data object delete: %w", err)
 	}
 
 	// Schedule index object for deletion
-	indexDeleteReq, err := presigner.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(datarangeDetails.Bucket),
-		Key:    aws.String(datarangeDetails.IndexObjectKey),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 24 * time.Hour
-	})
+	indexDeleteURL, err := store.PresignDeleteObject(ctx, datarangeDetails.IndexObjectKey, 24*time.Hour)
 	if err != nil {
 		return fmt.Errorf("failed to presign index object delete: %w", err)
 	}
 
 	// Schedule both objects for deletion
 
-	err = queries.ScheduleKeyForDeletion(ctx, dataDeleteReq.URL)
+	err = queries.ScheduleKeyForDeletion(ctx, dataDeleteURL)
 	if err != nil {
 		return fmt.Errorf("failed to schedule data object deletion: %w", err)
 	}
 
-	err = queries.ScheduleKeyForDeletion(ctx, indexDeleteReq.URL)
+	err = queries.ScheduleKeyForDeletion(ctx, indexDeleteURL)
 	if err != nil {
 		return fmt.Errorf("failed to schedule index object deletion: %w", err)
 	}
@@ -181,6 +170,12 @@ func (s *UploadDatarangeServer) deleteDatarangeFromDatabase(ctx context.Context,
 	// Create queries with transaction
 	txQueries := queries.WithTx(tx)
 
+	// The copies of the datarange in the replica of the datas3t are deleted later
+	err = txQueries.ScheduleDatarangeReplicasForDeletion(ctx, []int64{datarangeID})
+	if err != nil {
+		return fmt.Errorf("failed to schedule replicated objects for deletion: %w", err)
+	}
+
 	// Delete the datarange record
 	err = txQueries.DeleteDatarange(ctx, datarangeID)
 	if err != nil {
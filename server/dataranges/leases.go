@@ -0,0 +1,200 @@
+package dataranges
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/jackc/pgx/v5"
+)
+
+// MaxLeaseDurationSeconds is the longest lease an upload can take at once. It matches
+// the default lifetime of the presigned upload URLs.
+const MaxLeaseDurationSeconds = 24 * 60 * 60
+
+var ErrDatarangeLeased = apierror.ErrDatarangeLeased
+
+type RenewLeaseRequest struct {
+	DatarangeUploadID    int64 `json:"datarange_upload_id"`
+	LeaseDurationSeconds int64 `json:"lease_duration_seconds"`
+}
+
+type RenewLeaseResponse struct {
+	DatarangeUploadID int64     `json:"datarange_upload_id"`
+	LeaseExpiresAt    time.Time `json:"lease_expires_at"`
+}
+
+type ListLeasesRequest struct {
+	Datas3tName string `json:"datas3t_name"`
+}
+
+type ListLeasesResponse struct {
+	Leases []LeaseInfo `json:"leases"`
+}
+
+type LeaseInfo struct {
+	DatarangeUploadID   int64     `json:"datarange_upload_id"`
+	FirstDatapointIndex int64     `json:"first_datapoint_index"`
+	LastDatapointIndex  int64     `json:"last_datapoint_index"`
+	LeaseExpiresAt      time.Time `json:"lease_expires_at"`
+}
+
+// validateLeaseDuration checks the lease duration of an upload start, 0 takes no lease
+func validateLeaseDuration(seconds int64) error {
+	if seconds < 0 || seconds > MaxLeaseDurationSeconds {
+		return ValidationError(fmt.Errorf("lease_duration_seconds must be between 0 and %d (0 disables the lease)", MaxLeaseDurationSeconds))
+	}
+	return nil
+}
+
+func (r *RenewLeaseRequest) Validate(ctx context.Context) error {
+	if r.LeaseDurationSeconds == 0 {
+		return ValidationError(fmt.Errorf("lease_duration_seconds is required"))
+	}
+	if r.LeaseDurationSeconds < 0 || r.LeaseDurationSeconds > MaxLeaseDurationSeconds {
+		return ValidationError(fmt.Errorf("lease_duration_seconds must be between 1 and %d", MaxLeaseDurationSeconds))
+	}
+	return nil
+}
+
+func (r *ListLeasesRequest) Validate(ctx context.Context) error {
+	if r.Datas3tName == "" {
+		return ValidationError(fmt.Errorf("datas3t_name is required"))
+	}
+	return nil
+}
+
+// checkLeaseConflict fails with ErrDatarangeLeased when an upload other than
+// excludeUploadID holds an active lease overlapping [first, last].
+func checkLeaseConflict(ctx context.Context, queries *postgresstore.Queries, datas3tID, excludeUploadID, first, last int64) error {
+	lease, err := queries.GetOverlappingDatarangeLease(ctx, postgresstore.GetOverlappingDatarangeLeaseParams{
+		Datas3tID:           datas3tID,
+		ExcludeUploadID:     excludeUploadID,
+		FirstDatapointIndex: first,
+		LastDatapointIndex:  last,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check datarange leases: %w", err)
+	}
+
+	return apierror.New(
+		apierror.CodeDatarangeLeased,
+		"datapoints %d-%d are leased by upload %d until %s",
+		lease.FirstDatapointIndex,
+		lease.FirstDatapointIndex+lease.NumberOfDatapoints-1,
+		lease.ID,
+		lease.LeaseExpiresAt.Time.Format(time.RFC3339),
+	)
+}
+
+// RenewDatarangeUploadLease extends the lease of a pending upload. An upload that was
+// started without a lease, or whose lease has expired, takes a new lease as long as no
+// other upload holds an overlapping one.
+func (s *UploadDatarangeServer) RenewDatarangeUploadLease(ctx context.Context, log *slog.Logger, req *RenewLeaseRequest) (_ *RenewLeaseResponse, err error) {
+	log = log.With("datarange_upload_id", req.DatarangeUploadID, "lease_duration_seconds", req.LeaseDurationSeconds)
+	log.Info("Renewing datarange upload lease")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to renew datarange upload lease", "error", err)
+		} else {
+			log.Info("Datarange upload lease renewed")
+		}
+	}()
+
+	err = req.Validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := postgresstore.New(tx)
+
+	upload, err := queries.GetDatarangeUploadWithDetails(ctx, req.DatarangeUploadID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeUploadNotFound, "failed to get datarange upload details: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datarange upload details: %w", err)
+	}
+
+	// Serialize with uploads starting on the same datas3t
+	err = queries.LockDatas3t(ctx, upload.Datas3tID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock datas3t: %w", err)
+	}
+
+	err = checkLeaseConflict(
+		ctx,
+		queries,
+		upload.Datas3tID,
+		upload.ID,
+		upload.FirstDatapointIndex,
+		upload.FirstDatapointIndex+upload.NumberOfDatapoints-1,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt, err := queries.SetDatarangeUploadLease(ctx, postgresstore.SetDatarangeUploadLeaseParams{
+		ID:                   upload.ID,
+		LeaseDurationSeconds: req.LeaseDurationSeconds,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to set lease: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &RenewLeaseResponse{
+		DatarangeUploadID: upload.ID,
+		LeaseExpiresAt:    expiresAt.Time,
+	}, nil
+}
+
+// ListDatarangeLeases returns the active leases of the pending uploads of a datas3t
+func (s *UploadDatarangeServer) ListDatarangeLeases(ctx context.Context, log *slog.Logger, req *ListLeasesRequest) (*ListLeasesResponse, error) {
+	log = log.With("datas3t_name", req.Datas3tName)
+
+	err := req.Validate(ctx)
+	if err != nil {
+		log.Error("Invalid request", "error", err)
+		return nil, err
+	}
+
+	queries := postgresstore.New(s.db)
+	leases, err := queries.ListActiveDatarangeLeases(ctx, req.Datas3tName)
+	if err != nil {
+		log.Error("Failed to list datarange leases", "error", err)
+		return nil, fmt.Errorf("failed to list datarange leases: %w", err)
+	}
+
+	response := &ListLeasesResponse{
+		Leases: make([]LeaseInfo, len(leases)),
+	}
+	for i, lease := range leases {
+		response.Leases[i] = LeaseInfo{
+			DatarangeUploadID:   lease.ID,
+			FirstDatapointIndex: lease.FirstDatapointIndex,
+			LastDatapointIndex:  lease.FirstDatapointIndex + lease.NumberOfDatapoints - 1,
+			LeaseExpiresAt:      lease.LeaseExpiresAt.Time,
+		}
+	}
+
+	return response, nil
+}
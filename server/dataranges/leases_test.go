@@ -0,0 +1,258 @@
+package dataranges_test
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/dataranges"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Datarange upload leases", func() {
+	var env *TestEnvironment
+
+	BeforeEach(func(ctx SpecContext) {
+		env = SetupTestEnvironment(ctx)
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		env.TeardownTestEnvironment(ctx)
+	})
+
+	startUpload := func(ctx SpecContext, first, count uint64, leaseSeconds int64) (*dataranges.UploadDatarangeResponse, error) {
+		return env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+			Datas3tName:          env.TestDatas3tName,
+			DataSize:             1024,
+			NumberOfDatapoints:   count,
+			FirstDatapointIndex:  first,
+			LeaseDurationSeconds: leaseSeconds,
+		})
+	}
+
+	listLeases := func(ctx SpecContext) []dataranges.LeaseInfo {
+		resp, err := env.UploadSrv.ListDatarangeLeases(ctx, env.Logger, &dataranges.ListLeasesRequest{
+			Datas3tName: env.TestDatas3tName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return resp.Leases
+	}
+
+	Context("when an upload holds a lease", func() {
+		var leased *dataranges.UploadDatarangeResponse
+
+		BeforeEach(func(ctx SpecContext) {
+			var err error
+			leased, err = startUpload(ctx, 100, 100, 600)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(leased.LeaseExpiresAt).NotTo(BeNil())
+			Expect(*leased.LeaseExpiresAt).To(BeTemporally("~", time.Now().Add(10*time.Minute), time.Minute))
+		})
+
+		It("should reject overlapping uploads", func(ctx SpecContext) {
+			_, err := startUpload(ctx, 150, 100, 0)
+			Expect(err).To(MatchError(apierror.ErrDatarangeLeased))
+			Expect(err.Error()).To(ContainSubstring("datapoints 100-199 are leased"))
+
+			_, err = startUpload(ctx, 0, 101, 600)
+			Expect(err).To(MatchError(apierror.ErrDatarangeLeased))
+
+			uploadCount, err := env.Queries.CountDatarangeUploads(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploadCount).To(Equal(int64(1)))
+		})
+
+		It("should allow uploads of adjacent ranges", func(ctx SpecContext) {
+			_, err := startUpload(ctx, 0, 100, 600)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = startUpload(ctx, 200, 100, 0)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should list the active leases", func(ctx SpecContext) {
+			_, err := startUpload(ctx, 0, 50, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			leases := listLeases(ctx)
+			Expect(leases).To(HaveLen(1))
+			Expect(leases[0].DatarangeUploadID).To(Equal(leased.DatarangeID))
+			Expect(leases[0].FirstDatapointIndex).To(Equal(int64(100)))
+			Expect(leases[0].LastDatapointIndex).To(Equal(int64(199)))
+			Expect(leases[0].LeaseExpiresAt).To(BeTemporally("==", *leased.LeaseExpiresAt))
+		})
+
+		It("should extend the lease when renewed", func(ctx SpecContext) {
+			resp, err := env.UploadSrv.RenewDatarangeUploadLease(ctx, env.Logger, &dataranges.RenewLeaseRequest{
+				DatarangeUploadID:    leased.DatarangeID,
+				LeaseDurationSeconds: 3600,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.LeaseExpiresAt).To(BeTemporally("~", time.Now().Add(time.Hour), time.Minute))
+			Expect(listLeases(ctx)[0].LeaseExpiresAt).To(BeTemporally("==", resp.LeaseExpiresAt))
+		})
+
+		It("should not grant a lease to an overlapping upload started before the lease", func(ctx SpecContext) {
+			_, err := env.DB.Exec(ctx, "UPDATE datarange_uploads SET lease_expires_at = NULL WHERE id = $1", leased.DatarangeID)
+			Expect(err).NotTo(HaveOccurred())
+
+			unleased, err := startUpload(ctx, 150, 100, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = env.UploadSrv.RenewDatarangeUploadLease(ctx, env.Logger, &dataranges.RenewLeaseRequest{
+				DatarangeUploadID:    leased.DatarangeID,
+				LeaseDurationSeconds: 600,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = env.UploadSrv.RenewDatarangeUploadLease(ctx, env.Logger, &dataranges.RenewLeaseRequest{
+				DatarangeUploadID:    unleased.DatarangeID,
+				LeaseDurationSeconds: 600,
+			})
+			Expect(err).To(MatchError(apierror.ErrDatarangeLeased))
+		})
+
+		It("should not complete an overlapping upload while the lease is active", func(ctx SpecContext) {
+			_, err := env.DB.Exec(ctx, "UPDATE datarange_uploads SET lease_expires_at = NULL WHERE id = $1", leased.DatarangeID)
+			Expect(err).NotTo(HaveOccurred())
+
+			unleased, err := startUpload(ctx, 150, 100, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = env.DB.Exec(ctx, "UPDATE datarange_uploads SET lease_expires_at = CURRENT_TIMESTAMP + interval '10 minutes' WHERE id = $1", leased.DatarangeID)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, &dataranges.CompleteUploadRequest{
+				DatarangeUploadID: unleased.DatarangeID,
+			})
+			Expect(err).To(MatchError(apierror.ErrDatarangeLeased))
+
+			// The upload is kept so that it can be completed or cancelled later
+			uploadCount, err := env.Queries.CountDatarangeUploads(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploadCount).To(Equal(int64(2)))
+		})
+
+		It("should not complete an overlapping upload when the lease is taken while completing", func(ctx SpecContext) {
+			_, err := env.DB.Exec(ctx, "UPDATE datarange_uploads SET lease_expires_at = NULL WHERE id = $1", leased.DatarangeID)
+			Expect(err).NotTo(HaveOccurred())
+
+			tarData, indexData := CreateProperTarWithIndex(10, 150)
+			unleased, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:         env.TestDatas3tName,
+				DataSize:            uint64(len(tarData)),
+				NumberOfDatapoints:  10,
+				FirstDatapointIndex: 150,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			for url, data := range map[string][]byte{unleased.PresignedDataPutURL: tarData, unleased.PresignedIndexPutURL: indexData} {
+				resp, err := HttpPut(url, bytes.NewReader(data))
+				Expect(err).NotTo(HaveOccurred())
+				resp.Body.Close()
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			}
+
+			// The lease is renewed while the completion waits for the lock on the datas3t
+			tx, err := env.DB.Begin(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			defer tx.Rollback(ctx)
+
+			_, err = tx.Exec(ctx, "SELECT id FROM datas3ts WHERE name = $1 FOR UPDATE", env.TestDatas3tName)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = tx.Exec(ctx, "UPDATE datarange_uploads SET lease_expires_at = CURRENT_TIMESTAMP + interval '10 minutes' WHERE id = $1", leased.DatarangeID)
+			Expect(err).NotTo(HaveOccurred())
+
+			completed := make(chan error, 1)
+			go func() {
+				completed <- env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, &dataranges.CompleteUploadRequest{
+					DatarangeUploadID: unleased.DatarangeID,
+				})
+			}()
+
+			Eventually(func() (int, error) {
+				var waiting int
+				err := env.DB.QueryRow(ctx, "SELECT count(*) FROM pg_stat_activity WHERE wait_event_type = 'Lock'").Scan(&waiting)
+				return waiting, err
+			}).Should(Equal(1))
+
+			Expect(tx.Commit(ctx)).To(Succeed())
+
+			Expect(<-completed).To(MatchError(apierror.ErrDatarangeLeased))
+
+			count, err := env.Queries.CountDataranges(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(count).To(Equal(int64(0)))
+		})
+
+		It("should release the lease when the upload is cancelled", func(ctx SpecContext) {
+			err := env.UploadSrv.CancelDatarangeUpload(ctx, env.Logger, &dataranges.CancelUploadRequest{
+				DatarangeUploadID: leased.DatarangeID,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(listLeases(ctx)).To(BeEmpty())
+
+			_, err = startUpload(ctx, 150, 100, 600)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should not block uploads once the lease has expired", func(ctx SpecContext) {
+			_, err := env.DB.Exec(ctx, "UPDATE datarange_uploads SET lease_expires_at = CURRENT_TIMESTAMP - interval '1 second' WHERE id = $1", leased.DatarangeID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(listLeases(ctx)).To(BeEmpty())
+
+			_, err = startUpload(ctx, 150, 100, 600)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The expired upload cannot take its lease back
+			_, err = env.UploadSrv.RenewDatarangeUploadLease(ctx, env.Logger, &dataranges.RenewLeaseRequest{
+				DatarangeUploadID:    leased.DatarangeID,
+				LeaseDurationSeconds: 600,
+			})
+			Expect(err).To(MatchError(apierror.ErrDatarangeLeased))
+		})
+	})
+
+	It("should not lease the same range to concurrent uploads", func(ctx SpecContext) {
+		results := make(chan error, 5)
+		for i := 0; i < 5; i++ {
+			go func() {
+				defer GinkgoRecover()
+				_, err := startUpload(ctx, 0, 100, 600)
+				results <- err
+			}()
+		}
+
+		var succeeded int
+		for i := 0; i < 5; i++ {
+			err := <-results
+			if err == nil {
+				succeeded++
+				continue
+			}
+			Expect(err).To(MatchError(apierror.ErrDatarangeLeased))
+		}
+		Expect(succeeded).To(Equal(1))
+	})
+
+	It("should fail to renew the lease of an unknown upload", func(ctx SpecContext) {
+		_, err := env.UploadSrv.RenewDatarangeUploadLease(ctx, env.Logger, &dataranges.RenewLeaseRequest{
+			DatarangeUploadID:    12345,
+			LeaseDurationSeconds: 600,
+		})
+		Expect(err).To(MatchError(apierror.ErrUploadNotFound))
+	})
+
+	DescribeTable("should reject invalid lease durations",
+		func(ctx SpecContext, seconds int64) {
+			_, err := startUpload(ctx, 0, 10, seconds)
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		},
+		Entry("negative", int64(-1)),
+		Entry("longer than the maximum", int64(dataranges.MaxLeaseDurationSeconds+1)),
+	)
+})
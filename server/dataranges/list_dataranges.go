@@ -2,37 +2,176 @@ package dataranges
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// DefaultListDatarangesLimit is the page size used when the request does not specify a limit
+	DefaultListDatarangesLimit = 1000
+	// MaxListDatarangesLimit is the largest page size a request may ask for
+	MaxListDatarangesLimit = 10000
+)
+
+const (
+	SortByKey       = "key"
+	SortBySize      = "size"
+	SortByCreatedAt = "created_at"
+
+	SortOrderAsc  = "asc"
+	SortOrderDesc = "desc"
 )
 
 type ListDatarangesRequest struct {
 	Datas3tName string `json:"datas3t_name"`
+
+	// Only return dataranges overlapping [FromDatapointKey, ToDatapointKey]
+	FromDatapointKey *int64 `json:"from_datapoint_key,omitempty"`
+	ToDatapointKey   *int64 `json:"to_datapoint_key,omitempty"`
+
+	// Only return dataranges with a size within [MinSizeBytes, MaxSizeBytes]
+	MinSizeBytes *int64 `json:"min_size_bytes,omitempty"`
+	MaxSizeBytes *int64 `json:"max_size_bytes,omitempty"`
+
+	// Only return dataranges created in [CreatedAfter, CreatedBefore)
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+
+	SortBy    string `json:"sort_by,omitempty"`    // key (default), size or created_at
+	SortOrder string `json:"sort_order,omitempty"` // asc (default) or desc
+
+	Limit  int    `json:"limit,omitempty"`  // page size, defaults to DefaultListDatarangesLimit
+	Cursor string `json:"cursor,omitempty"` // next_cursor of the previous page
 }
 
 type ListDatarangesResponse struct {
 	Dataranges []DatarangeInfo `json:"dataranges"`
+	// NextCursor is set when more dataranges are available
+	NextCursor string `json:"next_cursor,omitempty"`
 }
 
 type DatarangeInfo struct {
-	DatarangeID     int64  `json:"datarange_id"`
-	DataObjectKey   string `json:"data_object_key"`
-	IndexObjectKey  string `json:"index_object_key"`
-	MinDatapointKey int64  `json:"min_datapoint_key"`
-	MaxDatapointKey int64  `json:"max_datapoint_key"`
-	SizeBytes       int64  `json:"size_bytes"`
+	DatarangeID     int64     `json:"datarange_id"`
+	DataObjectKey   string    `json:"data_object_key"`
+	IndexObjectKey  string    `json:"index_object_key"`
+	MinDatapointKey int64     `json:"min_datapoint_key"`
+	MaxDatapointKey int64     `json:"max_datapoint_key"`
+	SizeBytes       int64     `json:"size_bytes"`
+	CreatedAt       time.Time `json:"created_at"`
+
+	// StorageClass is the storage class of the data object, e.g. GLACIER once a
+	// storage class rule moved it
+	StorageClass string `json:"storage_class,omitempty"`
+}
+
+// listCursor is the position after the last datarange of a page. It is
+// handed out to clients as an opaque base64 string.
+type listCursor struct {
+	SortBy    string `json:"s"`
+	SortOrder string `json:"o"`
+	SortValue int64  `json:"v"`
+	ID        int64  `json:"i"`
+}
+
+func (c listCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeListCursor(s string) (listCursor, error) {
+	var c listCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	err = json.Unmarshal(data, &c)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor: %w", err)
+	}
+
+	return c, nil
+}
+
+func (r *ListDatarangesRequest) sortBy() string {
+	if r.SortBy == "" {
+		return SortByKey
+	}
+	return r.SortBy
+}
+
+func (r *ListDatarangesRequest) sortOrder() string {
+	if r.SortOrder == "" {
+		return SortOrderAsc
+	}
+	return r.SortOrder
 }
 
 func (r *ListDatarangesRequest) Validate(ctx context.Context) error {
 	if r.Datas3tName == "" {
-		return fmt.Errorf("datas3t_name is required")
+		return ValidationError(fmt.Errorf("datas3t_name is required"))
+	}
+
+	if r.FromDatapointKey != nil && r.ToDatapointKey != nil && *r.FromDatapointKey > *r.ToDatapointKey {
+		return ValidationError(fmt.Errorf("from_datapoint_key (%d) cannot be greater than to_datapoint_key (%d)", *r.FromDatapointKey, *r.ToDatapointKey))
+	}
+
+	if r.MinSizeBytes != nil && r.MaxSizeBytes != nil && *r.MinSizeBytes > *r.MaxSizeBytes {
+		return ValidationError(fmt.Errorf("min_size_bytes (%d) cannot be greater than max_size_bytes (%d)", *r.MinSizeBytes, *r.MaxSizeBytes))
+	}
+
+	if r.CreatedAfter != nil && r.CreatedBefore != nil && !r.CreatedAfter.Before(*r.CreatedBefore) {
+		return ValidationError(fmt.Errorf("created_after must be before created_before"))
+	}
+
+	switch r.sortBy() {
+	case SortByKey, SortBySize, SortByCreatedAt:
+	default:
+		return ValidationError(fmt.Errorf("sort_by must be one of %q, %q or %q", SortByKey, SortBySize, SortByCreatedAt))
+	}
+
+	switch r.sortOrder() {
+	case SortOrderAsc, SortOrderDesc:
+	default:
+		return ValidationError(fmt.Errorf("sort_order must be %q or %q", SortOrderAsc, SortOrderDesc))
+	}
+
+	if r.Limit < 0 || r.Limit > MaxListDatarangesLimit {
+		return ValidationError(fmt.Errorf("limit must be between 1 and %d, or 0 for the default of %d", MaxListDatarangesLimit, DefaultListDatarangesLimit))
+	}
+
+	if r.Cursor != "" {
+		cursor, err := decodeListCursor(r.Cursor)
+		if err != nil {
+			return ValidationError(err)
+		}
+
+		if cursor.SortBy != r.sortBy() {
+			return ValidationError(fmt.Errorf("cursor was issued for sort_by %q", cursor.SortBy))
+		}
+
+		if cursor.SortOrder != r.sortOrder() {
+			return ValidationError(fmt.Errorf("cursor was issued for sort_order %q", cursor.SortOrder))
+		}
 	}
 
 	return nil
 }
 
+func toTimestamp(t *time.Time) pgtype.Timestamp {
+	if t == nil {
+		return pgtype.Timestamp{}
+	}
+	return pgtype.Timestamp{Time: t.UTC(), Valid: true}
+}
+
 func (s *UploadDatarangeServer) ListDataranges(ctx context.Context, log *slog.Logger, req *ListDatarangesRequest) (*ListDatarangesResponse, error) {
 	log = log.With("datas3t_name", req.Datas3tName)
 	log.Info("Listing dataranges")
@@ -43,29 +182,70 @@ func (s *UploadDatarangeServer) ListDataranges(ctx context.Context, log *slog.Lo
 		return nil, err
 	}
 
+	limit := req.Limit
+	if limit == 0 {
+		limit = DefaultListDatarangesLimit
+	}
+
+	params := postgresstore.ListDatarangesPageParams{
+		Datas3tName:      req.Datas3tName,
+		SortBy:           req.sortBy(),
+		Descending:       req.sortOrder() == SortOrderDesc,
+		FromDatapointKey: req.FromDatapointKey,
+		ToDatapointKey:   req.ToDatapointKey,
+		MinSizeBytes:     req.MinSizeBytes,
+		MaxSizeBytes:     req.MaxSizeBytes,
+		CreatedAfter:     toTimestamp(req.CreatedAfter),
+		CreatedBefore:    toTimestamp(req.CreatedBefore),
+		// Fetch one extra row to find out whether there is a next page
+		PageLimit: int32(limit + 1),
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeListCursor(req.Cursor)
+		if err != nil {
+			return nil, ValidationError(err)
+		}
+		params.CursorSortValue = &cursor.SortValue
+		params.CursorID = cursor.ID
+	}
+
 	queries := postgresstore.New(s.db)
-	dbDataranges, err := queries.ListDatarangesForDatas3t(ctx, req.Datas3tName)
+	dbDataranges, err := queries.ListDatarangesPage(ctx, params)
 	if err != nil {
 		log.Error("Failed to list dataranges", "error", err)
 		return nil, fmt.Errorf("failed to list dataranges: %w", err)
 	}
 
+	response := &ListDatarangesResponse{}
+
+	if len(dbDataranges) > limit {
+		dbDataranges = dbDataranges[:limit]
+		last := dbDataranges[limit-1]
+		response.NextCursor = listCursor{
+			SortBy:    params.SortBy,
+			SortOrder: req.sortOrder(),
+			SortValue: last.SortValue,
+			ID:        last.ID,
+		}.encode()
+	}
+
 	// Convert database rows to response format
-	dataranges := make([]DatarangeInfo, len(dbDataranges))
+	response.Dataranges = make([]DatarangeInfo, len(dbDataranges))
 	for i, dbDatarange := range dbDataranges {
-		dataranges[i] = DatarangeInfo{
+		response.Dataranges[i] = DatarangeInfo{
 			DatarangeID:     dbDatarange.ID,
 			DataObjectKey:   dbDatarange.DataObjectKey,
 			IndexObjectKey:  dbDatarange.IndexObjectKey,
 			MinDatapointKey: dbDatarange.MinDatapointKey,
 			MaxDatapointKey: dbDatarange.MaxDatapointKey,
 			SizeBytes:       dbDatarange.SizeBytes,
+			CreatedAt:       dbDatarange.CreatedAt.Time,
+			StorageClass:    dbDatarange.StorageClass,
 		}
 	}
 
-	log.Info("Successfully listed dataranges", "count", len(dataranges))
+	log.Info("Successfully listed dataranges", "count", len(response.Dataranges), "has_more", response.NextCursor != "")
 
-	return &ListDatarangesResponse{
-		Dataranges: dataranges,
-	}, nil
-}
\ No newline at end of file
+	return response, nil
+}
@@ -0,0 +1,240 @@
+package dataranges_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/dataranges"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ListDataranges", func() {
+	var env *TestEnvironment
+	var baseTime time.Time
+
+	BeforeEach(func(ctx SpecContext) {
+		env = SetupTestEnvironment(ctx)
+
+		datas3tID, err := env.Queries.GetDatas3tIDByName(ctx, env.TestDatas3tName)
+		Expect(err).NotTo(HaveOccurred())
+
+		baseTime = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		// Create 25 dataranges of 10 datapoints each: 0-9, 10-19, ..., 240-249.
+		// Sizes decrease with the key and creation times are one hour apart.
+		for i := int64(0); i < 25; i++ {
+			id, err := env.Queries.CreateDatarange(ctx, postgresstore.CreateDatarangeParams{
+				Datas3tID:       datas3tID,
+				DataObjectKey:   fmt.Sprintf("data-%d.tar", i),
+				IndexObjectKey:  fmt.Sprintf("data-%d.index", i),
+				MinDatapointKey: i * 10,
+				MaxDatapointKey: i*10 + 9,
+				SizeBytes:       1000 - i,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = env.DB.Exec(ctx, "UPDATE dataranges SET created_at = $1 WHERE id = $2", baseTime.Add(time.Duration(i)*time.Hour), id)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		env.TeardownTestEnvironment(ctx)
+	})
+
+	minKeys := func(infos []dataranges.DatarangeInfo) []int64 {
+		keys := make([]int64, len(infos))
+		for i, info := range infos {
+			keys[i] = info.MinDatapointKey
+		}
+		return keys
+	}
+
+	listAll := func(ctx SpecContext, req *dataranges.ListDatarangesRequest) []dataranges.DatarangeInfo {
+		var all []dataranges.DatarangeInfo
+		for {
+			resp, err := env.UploadSrv.ListDataranges(ctx, env.Logger, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(len(resp.Dataranges)).To(BeNumerically("<=", req.Limit))
+			all = append(all, resp.Dataranges...)
+			if resp.NextCursor == "" {
+				return all
+			}
+			req.Cursor = resp.NextCursor
+		}
+	}
+
+	int64Ptr := func(v int64) *int64 { return &v }
+
+	It("should return all dataranges ordered by key when no limit is given", func(ctx SpecContext) {
+		resp, err := env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Dataranges).To(HaveLen(25))
+		Expect(resp.NextCursor).To(BeEmpty())
+		Expect(resp.Dataranges[0].MinDatapointKey).To(Equal(int64(0)))
+		Expect(resp.Dataranges[24].MinDatapointKey).To(Equal(int64(240)))
+		Expect(resp.Dataranges[3].CreatedAt).To(BeTemporally("==", baseTime.Add(3*time.Hour)))
+	})
+
+	It("should page through all dataranges with a cursor", func(ctx SpecContext) {
+		all := listAll(ctx, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+			Limit:       7,
+		})
+		Expect(all).To(HaveLen(25))
+
+		for i, info := range all {
+			Expect(info.MinDatapointKey).To(Equal(int64(i * 10)))
+		}
+	})
+
+	It("should not return a cursor when the last page is exactly full", func(ctx SpecContext) {
+		resp, err := env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+			Limit:       25,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Dataranges).To(HaveLen(25))
+		Expect(resp.NextCursor).To(BeEmpty())
+	})
+
+	It("should page in descending order", func(ctx SpecContext) {
+		all := listAll(ctx, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+			SortOrder:   dataranges.SortOrderDesc,
+			Limit:       10,
+		})
+		Expect(all).To(HaveLen(25))
+		Expect(all[0].MinDatapointKey).To(Equal(int64(240)))
+		Expect(all[24].MinDatapointKey).To(Equal(int64(0)))
+	})
+
+	It("should sort and page by size", func(ctx SpecContext) {
+		all := listAll(ctx, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+			SortBy:      dataranges.SortBySize,
+			Limit:       4,
+		})
+		Expect(all).To(HaveLen(25))
+		Expect(all[0].SizeBytes).To(Equal(int64(976)))
+		Expect(all[0].MinDatapointKey).To(Equal(int64(240)))
+		Expect(all[24].SizeBytes).To(Equal(int64(1000)))
+	})
+
+	It("should sort and page by creation time", func(ctx SpecContext) {
+		all := listAll(ctx, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+			SortBy:      dataranges.SortByCreatedAt,
+			SortOrder:   dataranges.SortOrderDesc,
+			Limit:       6,
+		})
+		Expect(all).To(HaveLen(25))
+		Expect(all[0].MinDatapointKey).To(Equal(int64(240)))
+		Expect(all[24].MinDatapointKey).To(Equal(int64(0)))
+	})
+
+	It("should filter by overlapping datapoint key range", func(ctx SpecContext) {
+		resp, err := env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName:      env.TestDatas3tName,
+			FromDatapointKey: int64Ptr(15),
+			ToDatapointKey:   int64Ptr(30),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(minKeys(resp.Dataranges)).To(Equal([]int64{10, 20, 30}))
+	})
+
+	It("should filter by size range", func(ctx SpecContext) {
+		resp, err := env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName:  env.TestDatas3tName,
+			MinSizeBytes: int64Ptr(990),
+			MaxSizeBytes: int64Ptr(992),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(minKeys(resp.Dataranges)).To(Equal([]int64{80, 90, 100}))
+	})
+
+	It("should filter by creation time", func(ctx SpecContext) {
+		after := baseTime.Add(20 * time.Hour)
+		before := baseTime.Add(22 * time.Hour)
+
+		resp, err := env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName:   env.TestDatas3tName,
+			CreatedAfter:  &after,
+			CreatedBefore: &before,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(minKeys(resp.Dataranges)).To(Equal([]int64{200, 210}))
+	})
+
+	It("should combine filters with pagination", func(ctx SpecContext) {
+		all := listAll(ctx, &dataranges.ListDatarangesRequest{
+			Datas3tName:      env.TestDatas3tName,
+			FromDatapointKey: int64Ptr(50),
+			MaxSizeBytes:     int64Ptr(985),
+			Limit:            3,
+		})
+		Expect(minKeys(all)).To(Equal([]int64{150, 160, 170, 180, 190, 200, 210, 220, 230, 240}))
+	})
+
+	It("should return an empty page for an unknown datas3t", func(ctx SpecContext) {
+		resp, err := env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName: "non-existent-datas3t",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Dataranges).To(BeEmpty())
+		Expect(resp.NextCursor).To(BeEmpty())
+	})
+
+	DescribeTable("should reject invalid requests",
+		func(ctx SpecContext, req *dataranges.ListDatarangesRequest) {
+			_, err := env.UploadSrv.ListDataranges(ctx, env.Logger, req)
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		},
+		Entry("missing datas3t name", &dataranges.ListDatarangesRequest{}),
+		Entry("inverted key range", &dataranges.ListDatarangesRequest{Datas3tName: "test-datas3t", FromDatapointKey: int64Ptr(10), ToDatapointKey: int64Ptr(5)}),
+		Entry("inverted size range", &dataranges.ListDatarangesRequest{Datas3tName: "test-datas3t", MinSizeBytes: int64Ptr(10), MaxSizeBytes: int64Ptr(5)}),
+		Entry("unknown sort key", &dataranges.ListDatarangesRequest{Datas3tName: "test-datas3t", SortBy: "name"}),
+		Entry("unknown sort order", &dataranges.ListDatarangesRequest{Datas3tName: "test-datas3t", SortOrder: "up"}),
+		Entry("negative limit", &dataranges.ListDatarangesRequest{Datas3tName: "test-datas3t", Limit: -1}),
+		Entry("limit too large", &dataranges.ListDatarangesRequest{Datas3tName: "test-datas3t", Limit: dataranges.MaxListDatarangesLimit + 1}),
+		Entry("malformed cursor", &dataranges.ListDatarangesRequest{Datas3tName: "test-datas3t", Cursor: "not a cursor"}),
+	)
+
+	It("should reject a cursor issued for a different sort key", func(ctx SpecContext) {
+		resp, err := env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+			Limit:       5,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.NextCursor).NotTo(BeEmpty())
+
+		_, err = env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+			SortBy:      dataranges.SortBySize,
+			Cursor:      resp.NextCursor,
+		})
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+
+	It("should reject a cursor issued for a different sort order", func(ctx SpecContext) {
+		resp, err := env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+			Limit:       5,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.NextCursor).NotTo(BeEmpty())
+
+		_, err = env.UploadSrv.ListDataranges(ctx, env.Logger, &dataranges.ListDatarangesRequest{
+			Datas3tName: env.TestDatas3tName,
+			SortOrder:   dataranges.SortOrderDesc,
+			Cursor:      resp.NextCursor,
+		})
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		Expect(err.Error()).To(ContainSubstring(`cursor was issued for sort_order "asc"`))
+	})
+})
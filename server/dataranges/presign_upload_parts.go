@@ -0,0 +1,110 @@
+package dataranges
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/jackc/pgx/v5"
+)
+
+// MaxPresignedPartsPerRequest limits how many part URLs a single request presigns
+const MaxPresignedPartsPerRequest = 1000
+
+type PresignUploadPartsRequest struct {
+	DatarangeUploadID int64 `json:"datarange_upload_id"`
+	FirstPartNumber   int32 `json:"first_part_number"`
+	NumberOfParts     int32 `json:"number_of_parts"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+}
+
+type PresignUploadPartsResponse struct {
+	PresignedPartURLs     []PartUploadURL `json:"presigned_part_urls"`
+	PresignedURLsExpireAt time.Time       `json:"presigned_urls_expire_at"`
+
+	// PartHeaders must be sent with the requests to the part URLs
+	PartHeaders map[string]string `json:"part_headers,omitempty"`
+}
+
+func (r *PresignUploadPartsRequest) Validate(ctx context.Context) error {
+	if r.DatarangeUploadID <= 0 {
+		return ValidationError(fmt.Errorf("datarange_upload_id is required"))
+	}
+
+	if r.FirstPartNumber < 1 {
+		return ValidationError(fmt.Errorf("first_part_number must be at least 1"))
+	}
+
+	if r.NumberOfParts < 1 || r.NumberOfParts > MaxPresignedPartsPerRequest {
+		return ValidationError(fmt.Errorf("number_of_parts must be between 1 and %d", MaxPresignedPartsPerRequest))
+	}
+
+	if int64(r.FirstPartNumber)+int64(r.NumberOfParts)-1 > MaxParts {
+		return ValidationError(fmt.Errorf("a multipart upload has at most %d parts", MaxParts))
+	}
+
+	return validatePresignExpiry(r.PresignExpirySeconds)
+}
+
+// PresignUploadParts presigns URLs for a range of parts of a multipart upload. Streamed
+// uploads, whose number of parts is not known when they are started, request the URLs
+// of their parts as they read the stream.
+func (s *UploadDatarangeServer) PresignUploadParts(ctx context.Context, log *slog.Logger, req *PresignUploadPartsRequest) (_ *PresignUploadPartsResponse, err error) {
+	log = log.With("datarange_upload_id", req.DatarangeUploadID)
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to presign upload parts", "error", err)
+		}
+	}()
+
+	err = req.Validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := postgresstore.New(s.db)
+	uploadDetails, err := queries.GetDatarangeUploadWithDetails(ctx, req.DatarangeUploadID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeUploadNotFound, "failed to get datarange upload details: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datarange upload details: %w", err)
+	}
+
+	if uploadDetails.UploadID == "DIRECT_PUT" {
+		return nil, ValidationError(fmt.Errorf("datarange upload %d is not a multipart upload", req.DatarangeUploadID))
+	}
+
+	store, err := s.openStore(ctx, log, uploadStorageConfig(uploadDetails))
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := s.presignExpiryFor(req.PresignExpirySeconds)
+	response := &PresignUploadPartsResponse{
+		PresignedPartURLs:     make([]PartUploadURL, 0, req.NumberOfParts),
+		PresignedURLsExpireAt: time.Now().Add(expiry),
+	}
+
+	for partNumber := req.FirstPartNumber; partNumber < req.FirstPartNumber+req.NumberOfParts; partNumber++ {
+		part, err := s.presignUploadPart(ctx, store, uploadDetails.DataObjectKey, uploadDetails.UploadID, partNumber, expiry)
+		if err != nil {
+			return nil, err
+		}
+
+		response.PresignedPartURLs = append(response.PresignedPartURLs, PartUploadURL{
+			PartNumber: partNumber,
+			URL:        part.URL,
+		})
+		response.PartHeaders = part.Headers
+	}
+
+	return response, nil
+}
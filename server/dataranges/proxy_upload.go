@@ -0,0 +1,396 @@
+package dataranges
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/draganm/datas3t/tarindex"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// Largest TAR archive accepted by ProxyUploadDatarange unless configured otherwise
+	DefaultMaxProxyUploadSize = 5 * 1024 * 1024 * 1024
+	// Number of proxied uploads running at the same time unless configured otherwise
+	DefaultMaxProxyUploads = 4
+	// Number of parts of a proxied upload that are uploaded to S3 at the same time.
+	// Together with the part size it bounds the memory used by a proxied upload.
+	proxyUploadParallelism = 2
+	// Largest header of the first file, including extended headers, the proxy reads the
+	// first datapoint key from
+	maxProxyFirstHeaderSize = 64 * 1024
+)
+
+type ProxyUploadRequest struct {
+	Datas3tName string `json:"datas3t_name"`
+
+	// WrappedDataKey is the data key the content of the archive is encrypted with,
+	// required when the datas3t is encrypted
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
+}
+
+type ProxyUploadResponse struct {
+	FirstDatapointIndex uint64 `json:"first_datapoint_index"`
+	NumberOfDatapoints  uint64 `json:"number_of_datapoints"`
+	DataSize            uint64 `json:"data_size"`
+}
+
+func (r *ProxyUploadRequest) Validate(ctx context.Context) error {
+	if r.Datas3tName == "" {
+		return ValidationError(fmt.Errorf("datas3t_name is required"))
+	}
+
+	return nil
+}
+
+// ProxyUploadDatarange uploads the TAR archive read from body for clients that cannot
+// reach S3. The archive is indexed while it is uploaded as a streamed upload, and the
+// datarange is registered once the archive has been read. The body is only read as fast
+// as its parts are uploaded to S3, and uploads beyond the configured number of proxied
+// uploads wait until a running one finishes.
+func (s *UploadDatarangeServer) ProxyUploadDatarange(ctx context.Context, log *slog.Logger, req *ProxyUploadRequest, body io.Reader) (_ *ProxyUploadResponse, err error) {
+	log = log.With("datas3t_name", req.Datas3tName)
+	log.Info("Proxying datarange upload")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to proxy datarange upload", "error", err)
+		} else {
+			log.Info("Proxied datarange upload completed successfully")
+		}
+	}()
+
+	err = req.Validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	slots := s.proxyUploads
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("failed to wait for a proxied upload slot: %w", ctx.Err())
+	}
+	defer func() { <-slots }()
+
+	uploadResp, err := s.StartDatarangeUpload(ctx, log, &UploadDatarangeRequest{
+		Datas3tName:    req.Datas3tName,
+		Stream:         true,
+		WrappedDataKey: req.WrappedDataKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Once completion starts, a failed upload is cleaned up by CompleteDatarangeUpload
+	cancelOnError := true
+	defer func() {
+		if err != nil && cancelOnError {
+			s.CancelDatarangeUpload(context.WithoutCancel(ctx), log, &CancelUploadRequest{
+				DatarangeUploadID: uploadResp.DatarangeID,
+			})
+		}
+	}()
+
+	uploadDetails, err := postgresstore.New(s.db).GetDatarangeUploadWithDetails(ctx, uploadResp.DatarangeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datarange upload details: %w", err)
+	}
+
+	store, err := s.openStore(ctx, log, uploadStorageConfig(uploadDetails))
+	if err != nil {
+		return nil, err
+	}
+
+	partsCtx, cancelParts := context.WithCancel(ctx)
+	uploader := newProxyPartUploader(partsCtx, store, uploadDetails, s.proxyPartSize())
+	defer func() {
+		cancelParts()
+		uploader.group.Wait()
+	}()
+
+	limited := &sizeLimitedReader{r: body, remaining: s.maxProxyUploadSize}
+	index, err := tarindex.IndexTar(io.TeeReader(limited, uploader))
+	if err != nil {
+		return nil, s.proxyReadError(limited, uploader, fmt.Errorf("failed to index tar archive: %w", err))
+	}
+
+	firstDatapointKey, err := s.proxyFirstDatapointKey(uploader.head, index, uploader.size)
+	if err != nil {
+		return nil, err
+	}
+
+	// Archives may be padded with zeros beyond their end marker, the padding is not uploaded
+	err = drainZeroPadding(limited)
+	if err != nil {
+		return nil, s.proxyReadError(limited, uploader, err)
+	}
+
+	etags, err := uploader.finish()
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.PutObject(ctx, uploadDetails.IndexObjectKey, bytes.NewReader(index), int64(len(index)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload index: %w", err)
+	}
+
+	resp := &ProxyUploadResponse{
+		FirstDatapointIndex: uint64(firstDatapointKey),
+		NumberOfDatapoints:  uint64(len(index) / 16),
+		DataSize:            uint64(uploader.size),
+	}
+
+	cancelOnError = false
+	err = s.CompleteDatarangeUpload(ctx, log, &CompleteUploadRequest{
+		DatarangeUploadID:   uploadResp.DatarangeID,
+		UploadIDs:           etags,
+		DataSize:            resp.DataSize,
+		FirstDatapointIndex: resp.FirstDatapointIndex,
+		NumberOfDatapoints:  resp.NumberOfDatapoints,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// proxyPartSize returns the part size that fits the largest accepted archive into the
+// maximum number of parts
+func (s *UploadDatarangeServer) proxyPartSize() int {
+	partSize := int64(MinPartSize)
+	if s.maxProxyUploadSize/MaxParts+1 > partSize {
+		partSize = s.maxProxyUploadSize/MaxParts + 1
+	}
+
+	return int(partSize)
+}
+
+// proxyReadError picks the error reported for a body that could not be read: an
+// exceeded size limit, a failed part upload, a failed read of the body or an invalid
+// archive, in this order
+func (s *UploadDatarangeServer) proxyReadError(limited *sizeLimitedReader, uploader *proxyPartUploader, err error) error {
+	if limited.exceeded {
+		return apierror.New(apierror.CodeRequestTooLarge, "tar archive is larger than the maximum of %d bytes", s.maxProxyUploadSize)
+	}
+
+	if uploader.ctx.Err() != nil {
+		uploadErr := uploader.group.Wait()
+		if uploadErr != nil {
+			return uploadErr
+		}
+	}
+
+	if limited.err != nil {
+		return fmt.Errorf("failed to read request body: %w", limited.err)
+	}
+
+	return ValidationError(err)
+}
+
+// proxyFirstDatapointKey checks that the archive read by the proxy is complete and
+// returns the datapoint key of its first file, taken from the first header
+func (s *UploadDatarangeServer) proxyFirstDatapointKey(head []byte, index []byte, size int64) (int64, error) {
+	numFiles := uint64(len(index) / 16)
+	if numFiles == 0 {
+		return 0, ValidationError(fmt.Errorf("tar archive contains no files"))
+	}
+
+	lastFile, err := (&tarindex.Index{Bytes: index}).GetFileMetadata(numFiles - 1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last file metadata: %w", err)
+	}
+
+	expectedSize := lastFile.Start + int64(lastFile.HeaderBlocks)*512 + ((lastFile.Size+511)/512)*512 + 1024
+	if size != expectedSize {
+		return 0, ValidationError(fmt.Errorf("tar archive is %d bytes, expected %d bytes from its index: the archive needs an end marker", size, expectedSize))
+	}
+
+	firstFile, err := (&tarindex.Index{Bytes: index}).GetFileMetadata(0)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get first file metadata: %w", err)
+	}
+
+	firstHeaderSize := int(firstFile.HeaderBlocks) * 512
+	if firstHeaderSize > len(head) {
+		return 0, ValidationError(fmt.Errorf("header of the first file is larger than %d bytes", maxProxyFirstHeaderSize))
+	}
+
+	header, err := tar.NewReader(bytes.NewReader(head[:firstHeaderSize])).Next()
+	if err != nil {
+		return 0, ValidationError(fmt.Errorf("failed to read first tar header: %w", err))
+	}
+
+	if !s.isValidFileName(header.Name) {
+		return 0, ValidationError(fmt.Errorf("invalid file name format: %s", header.Name))
+	}
+
+	key, err := s.extractDatapointKeyFromFileName(header.Name)
+	if err != nil {
+		return 0, ValidationError(fmt.Errorf("invalid datapoint key in file name %s: %w", header.Name, err))
+	}
+
+	return key, nil
+}
+
+// drainZeroPadding reads r to the end, it may only contain zeros
+func drainZeroPadding(r io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if !allZeros(buf[:n]) {
+			return fmt.Errorf("unexpected data after the end of the tar archive")
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func allZeros(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+var errSizeLimitExceeded = errors.New("size limit exceeded")
+
+// sizeLimitedReader fails once more than remaining bytes are read and records why
+// reading stopped
+type sizeLimitedReader struct {
+	r         io.Reader
+	remaining int64
+	exceeded  bool
+	err       error
+}
+
+func (l *sizeLimitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		l.exceeded = true
+		return n, errSizeLimitExceeded
+	}
+
+	if err != nil && err != io.EOF {
+		l.err = err
+	}
+
+	return n, err
+}
+
+// proxyPartUploader is the io.Writer a proxied archive is written to. It cuts the
+// archive into parts of the streamed upload and uploads them in the background, a
+// Write blocks while the maximum number of parts is being uploaded.
+type proxyPartUploader struct {
+	ctx           context.Context
+	group         *errgroup.Group
+	store         storage.ObjectStore
+	uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow
+	partSize      int
+
+	part []byte
+	// head holds the beginning of the archive, up to maxProxyFirstHeaderSize bytes
+	head []byte
+	size int64
+
+	mu    sync.Mutex
+	etags []string
+}
+
+func newProxyPartUploader(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow, partSize int) *proxyPartUploader {
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(proxyUploadParallelism)
+
+	return &proxyPartUploader{
+		ctx:           ctx,
+		group:         group,
+		store:         store,
+		uploadDetails: uploadDetails,
+		partSize:      partSize,
+		part:          make([]byte, 0, partSize),
+	}
+}
+
+func (u *proxyPartUploader) Write(p []byte) (int, error) {
+	if u.ctx.Err() != nil {
+		return 0, fmt.Errorf("upload of a part failed: %w", u.ctx.Err())
+	}
+
+	written := len(p)
+	if len(u.head) < maxProxyFirstHeaderSize {
+		u.head = append(u.head, p[:min(len(p), maxProxyFirstHeaderSize-len(u.head))]...)
+	}
+	u.size += int64(len(p))
+
+	for len(p) > 0 {
+		n := min(len(p), u.partSize-len(u.part))
+		u.part = append(u.part, p[:n]...)
+		p = p[n:]
+
+		if len(u.part) == u.partSize {
+			u.uploadPart()
+		}
+	}
+
+	return written, nil
+}
+
+func (u *proxyPartUploader) uploadPart() {
+	part := u.part
+	u.part = make([]byte, 0, u.partSize)
+
+	u.mu.Lock()
+	u.etags = append(u.etags, "")
+	partNumber := int32(len(u.etags))
+	u.mu.Unlock()
+
+	u.group.Go(func() error {
+		etag, err := u.store.UploadPart(u.ctx, u.uploadDetails.DataObjectKey, u.uploadDetails.UploadID, partNumber, bytes.NewReader(part), int64(len(part)))
+		if err != nil {
+			return fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+		}
+
+		u.mu.Lock()
+		u.etags[partNumber-1] = etag
+		u.mu.Unlock()
+
+		return nil
+	})
+}
+
+// finish uploads the last part and returns the ETags of all parts once they are uploaded
+func (u *proxyPartUploader) finish() ([]string, error) {
+	if len(u.part) > 0 {
+		u.uploadPart()
+	}
+
+	err := u.group.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	return u.etags, nil
+}
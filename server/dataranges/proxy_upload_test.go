@@ -0,0 +1,125 @@
+package dataranges_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/dataranges"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Proxied datarange uploads", func() {
+	var env *TestEnvironment
+
+	BeforeEach(func(ctx SpecContext) {
+		env = SetupTestEnvironment(ctx)
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		env.TeardownTestEnvironment(ctx)
+	})
+
+	proxyUpload := func(ctx SpecContext, tarData []byte) (*dataranges.ProxyUploadResponse, error) {
+		return env.UploadSrv.ProxyUploadDatarange(ctx, env.Logger, &dataranges.ProxyUploadRequest{
+			Datas3tName: env.TestDatas3tName,
+		}, bytes.NewReader(tarData))
+	}
+
+	It("should index, upload and register the archive", func(ctx SpecContext) {
+		tarData, _ := CreateProperTarWithIndex(10, 100)
+
+		resp, err := proxyUpload(ctx, tarData)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.FirstDatapointIndex).To(Equal(uint64(100)))
+		Expect(resp.NumberOfDatapoints).To(Equal(uint64(10)))
+		Expect(resp.DataSize).To(Equal(uint64(len(tarData))))
+
+		all, err := env.Queries.GetAllDataranges(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(HaveLen(1))
+		Expect(all[0].MinDatapointKey).To(Equal(int64(100)))
+		Expect(all[0].MaxDatapointKey).To(Equal(int64(109)))
+		Expect(all[0].SizeBytes).To(Equal(int64(len(tarData))))
+	})
+
+	It("should ignore zero padding after the end of the archive", func(ctx SpecContext) {
+		tarData, _ := CreateProperTarWithIndex(10, 100)
+		padded := append(bytes.Clone(tarData), make([]byte, 10240)...)
+
+		resp, err := proxyUpload(ctx, padded)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.DataSize).To(Equal(uint64(len(tarData))))
+	})
+
+	It("should accept archives with extended headers", func(ctx SpecContext) {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for i := range 3 {
+			content := []byte(fmt.Sprintf("content %d", i))
+			Expect(tw.WriteHeader(&tar.Header{
+				Name:       fmt.Sprintf("%020d.txt", 100+i),
+				Size:       int64(len(content)),
+				Mode:       0644,
+				Typeflag:   tar.TypeReg,
+				PAXRecords: map[string]string{"DATAS3T.original_name": strings.Repeat("name/", 50)},
+				Format:     tar.FormatPAX,
+			})).To(Succeed())
+			_, err := tw.Write(content)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(tw.Close()).To(Succeed())
+
+		resp, err := proxyUpload(ctx, buf.Bytes())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.FirstDatapointIndex).To(Equal(uint64(100)))
+		Expect(resp.NumberOfDatapoints).To(Equal(uint64(3)))
+	})
+
+	It("should reject archives larger than the size limit", func(ctx SpecContext) {
+		tarData, _ := CreateProperTarWithIndex(10, 100)
+		env.UploadSrv.SetMaxProxyUploadSize(int64(len(tarData)) - 1)
+
+		_, err := proxyUpload(ctx, tarData)
+		Expect(err).To(MatchError(apierror.ErrRequestTooLarge))
+
+		count, err := env.Queries.CountDataranges(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(int64(0)))
+	})
+
+	It("should reject data that is not a tar archive", func(ctx SpecContext) {
+		_, err := proxyUpload(ctx, bytes.Repeat([]byte("x"), 2048))
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+
+	It("should reject a truncated archive", func(ctx SpecContext) {
+		tarData, _ := CreateProperTarWithIndex(10, 100)
+
+		_, err := proxyUpload(ctx, tarData[:len(tarData)-1024])
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+
+	It("should reject data after the end of the archive", func(ctx SpecContext) {
+		tarData, _ := CreateProperTarWithIndex(10, 100)
+
+		_, err := proxyUpload(ctx, append(bytes.Clone(tarData), []byte("trailing")...))
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+
+	It("should reject an archive overlapping an existing datarange", func(ctx SpecContext) {
+		env.CreateCompletedDatarange(ctx, 105, 10)
+		tarData, _ := CreateProperTarWithIndex(10, 100)
+
+		_, err := proxyUpload(ctx, tarData)
+		Expect(err).To(MatchError(apierror.ErrDatarangeOverlap))
+	})
+
+	It("should require a datas3t name", func(ctx SpecContext) {
+		_, err := env.UploadSrv.ProxyUploadDatarange(ctx, env.Logger, &dataranges.ProxyUploadRequest{}, bytes.NewReader(nil))
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+})
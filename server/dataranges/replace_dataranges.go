@@ -0,0 +1,95 @@
+package dataranges
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/draganm/datas3t/postgresstore"
+)
+
+// replacedDataranges returns the dataranges an upload of the datapoint range first-last
+// replaces. They must lie within the range and cover every datapoint of it, so that no
+// datapoint goes missing or is stored twice when they are swapped for the upload.
+func replacedDataranges(ctx context.Context, queries *postgresstore.Queries, datas3tName string, first, last int64) ([]postgresstore.GetDatarangesInRangeRow, error) {
+	existing, err := queries.GetDatarangesInRange(ctx, postgresstore.GetDatarangesInRangeParams{
+		Name:            datas3tName,
+		MinDatapointKey: first,
+		MaxDatapointKey: last,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dataranges in range: %w", err)
+	}
+
+	next := first
+	for _, dr := range existing {
+		if dr.MinDatapointKey != next || dr.MaxDatapointKey > last {
+			break
+		}
+		next = dr.MaxDatapointKey + 1
+	}
+
+	if next != last+1 {
+		return nil, fmt.Errorf("%w: datapoints %d-%d are not exactly covered by existing dataranges",
+			ErrRangeNotFullyCovered, first, last)
+	}
+
+	return existing, nil
+}
+
+// checkReplacedDataranges returns the dataranges a replacing upload swaps out. It fails
+// with ErrDatarangeOverlap if they changed since the upload was started, e.g. because
+// another upload replaced them or they were aggregated.
+func checkReplacedDataranges(ctx context.Context, queries *postgresstore.Queries, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow) ([]postgresstore.GetDatarangesInRangeRow, error) {
+	current, err := queries.GetDatarangesInRange(ctx, postgresstore.GetDatarangesInRangeParams{
+		Name:            uploadDetails.Datas3tName,
+		MinDatapointKey: uploadDetails.FirstDatapointIndex,
+		MaxDatapointKey: uploadDetails.FirstDatapointIndex + uploadDetails.NumberOfDatapoints - 1,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replaced dataranges: %w", err)
+	}
+
+	if !slices.Equal(datarangeIDs(current), uploadDetails.ReplacedDatarangeIds) {
+		return nil, fmt.Errorf("%w: the replaced dataranges changed while uploading", ErrDatarangeOverlap)
+	}
+
+	return current, nil
+}
+
+func datarangeIDs(dataranges []postgresstore.GetDatarangesInRangeRow) []int64 {
+	ids := make([]int64, len(dataranges))
+	for i, dr := range dataranges {
+		ids[i] = dr.ID
+	}
+	return ids
+}
+
+// scheduleDatarangesForDeletion schedules the data and index objects of dataranges and of
+// their copies in replicas for deletion from S3
+func scheduleDatarangesForDeletion(ctx context.Context, queries *postgresstore.Queries, dataranges []postgresstore.GetDatarangesInRangeRow) error {
+	// Group objects by bucket for efficient batch operations
+	bucketObjects := make(map[int64][]string)
+	for _, dr := range dataranges {
+		// Add both data and index objects to the bucket group
+		bucketObjects[dr.S3BucketID] = append(bucketObjects[dr.S3BucketID], dr.DataObjectKey, dr.IndexObjectKey)
+	}
+
+	// Schedule objects for deletion in batches per bucket
+	for bucketID, objectNames := range bucketObjects {
+		err := queries.ScheduleObjectsForDeletion(ctx, postgresstore.ScheduleObjectsForDeletionParams{
+			S3BucketID: &bucketID,
+			Column2:    objectNames,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to schedule objects for deletion (bucket %d): %w", bucketID, err)
+		}
+	}
+
+	err := queries.ScheduleDatarangeReplicasForDeletion(ctx, datarangeIDs(dataranges))
+	if err != nil {
+		return fmt.Errorf("failed to schedule replicated objects for deletion: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package dataranges_test
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/dataranges"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Replacing datarange uploads", func() {
+	var env *TestEnvironment
+
+	BeforeEach(func(ctx SpecContext) {
+		env = SetupTestEnvironment(ctx)
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		env.TeardownTestEnvironment(ctx)
+	})
+
+	startReplace := func(ctx SpecContext, firstDatapoint, numDatapoints uint64) (*dataranges.UploadDatarangeResponse, error) {
+		tarData, _ := CreateProperTarWithIndex(int(numDatapoints), int64(firstDatapoint))
+
+		return env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+			Datas3tName:         env.TestDatas3tName,
+			DataSize:            uint64(len(tarData)),
+			NumberOfDatapoints:  numDatapoints,
+			FirstDatapointIndex: firstDatapoint,
+			Replace:             true,
+		})
+	}
+
+	completeReplace := func(ctx SpecContext, uploadResp *dataranges.UploadDatarangeResponse, firstDatapoint, numDatapoints uint64) error {
+		tarData, tarIndex := CreateProperTarWithIndex(int(numDatapoints), int64(firstDatapoint))
+
+		dataResp, err := HttpPut(uploadResp.PresignedDataPutURL, bytes.NewReader(tarData))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(dataResp.StatusCode).To(Equal(http.StatusOK))
+		dataResp.Body.Close()
+
+		indexResp, err := HttpPut(uploadResp.PresignedIndexPutURL, bytes.NewReader(tarIndex))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(indexResp.StatusCode).To(Equal(http.StatusOK))
+		indexResp.Body.Close()
+
+		return env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, &dataranges.CompleteUploadRequest{
+			DatarangeUploadID: uploadResp.DatarangeID,
+		})
+	}
+
+	storedObjectKey := func(ctx SpecContext, minKey, maxKey int64) string {
+		dr, err := env.Queries.GetDatarangeByExactRange(ctx, postgresstore.GetDatarangeByExactRangeParams{
+			Name:            env.TestDatas3tName,
+			MinDatapointKey: minKey,
+			MaxDatapointKey: maxKey,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return dr.DataObjectKey
+	}
+
+	It("should replace a datarange with the exact range", func(ctx SpecContext) {
+		oldDataKey, oldIndexKey := env.CreateCompletedDatarange(ctx, 0, 10)
+
+		uploadResp, err := startReplace(ctx, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(completeReplace(ctx, uploadResp, 0, 10)).To(Succeed())
+
+		count, err := env.Queries.CountDataranges(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(int64(1)))
+		Expect(storedObjectKey(ctx, 0, 9)).To(Equal(uploadResp.ObjectKey))
+
+		toDelete, err := env.Queries.GetObjectsToDelete(ctx, 10)
+		Expect(err).NotTo(HaveOccurred())
+		var names []string
+		for _, obj := range toDelete {
+			names = append(names, *obj.ObjectName)
+		}
+		Expect(names).To(ConsistOf(oldDataKey, oldIndexKey))
+	})
+
+	It("should replace several dataranges covering the range", func(ctx SpecContext) {
+		env.CreateCompletedDatarange(ctx, 0, 5)
+		env.CreateCompletedDatarange(ctx, 5, 5)
+
+		uploadResp, err := startReplace(ctx, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(completeReplace(ctx, uploadResp, 0, 10)).To(Succeed())
+
+		all, err := env.Queries.GetAllDataranges(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(HaveLen(1))
+		Expect(all[0].MinDatapointKey).To(Equal(int64(0)))
+		Expect(all[0].MaxDatapointKey).To(Equal(int64(9)))
+
+		count, err := env.Queries.CountObjectsToDelete(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(int64(4)))
+	})
+
+	It("should reject a range that is not fully covered", func(ctx SpecContext) {
+		env.CreateCompletedDatarange(ctx, 0, 5)
+
+		_, err := startReplace(ctx, 0, 10)
+		Expect(err).To(MatchError(apierror.ErrRangeNotFullyCovered))
+	})
+
+	It("should reject a range that covers only part of a datarange", func(ctx SpecContext) {
+		env.CreateCompletedDatarange(ctx, 0, 20)
+
+		_, err := startReplace(ctx, 0, 10)
+		Expect(err).To(MatchError(apierror.ErrRangeNotFullyCovered))
+	})
+
+	It("should fail and clean up when the replaced dataranges changed while uploading", func(ctx SpecContext) {
+		env.CreateCompletedDatarange(ctx, 0, 10)
+
+		first, err := startReplace(ctx, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		second, err := startReplace(ctx, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(completeReplace(ctx, first, 0, 10)).To(Succeed())
+
+		err = completeReplace(ctx, second, 0, 10)
+		Expect(err).To(MatchError(apierror.ErrDatarangeOverlap))
+
+		count, err := env.Queries.CountDataranges(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(int64(1)))
+		Expect(storedObjectKey(ctx, 0, 9)).To(Equal(first.ObjectKey))
+
+		uploadCount, err := env.Queries.CountDatarangeUploads(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(uploadCount).To(Equal(int64(0)))
+	})
+
+	It("should not combine replace with append", func(ctx SpecContext) {
+		_, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+			Datas3tName:        env.TestDatas3tName,
+			DataSize:           1024,
+			NumberOfDatapoints: 10,
+			Append:             true,
+			Replace:            true,
+		})
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+})
@@ -0,0 +1,188 @@
+package dataranges
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+type ResumeUploadRequest struct {
+	DatarangeUploadID int64 `json:"datarange_upload_id"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+}
+
+type UploadedPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
+}
+
+type PartUploadURL struct {
+	PartNumber int32  `json:"part_number"`
+	URL        string `json:"url"`
+}
+
+type ResumeUploadResponse struct {
+	DatarangeID         int64  `json:"datarange_id"`
+	ObjectKey           string `json:"object_key"`
+	FirstDatapointIndex uint64 `json:"first_datapoint_index"`
+	NumberOfDatapoints  uint64 `json:"number_of_datapoints"`
+	DataSize            uint64 `json:"data_size"`
+	UseDirectPut        bool   `json:"use_direct_put"`
+
+	// Streamed uploads have no known size, their part URLs are presigned on demand
+	Streamed bool `json:"streamed,omitempty"`
+
+	// WrappedDataKey is the data key the upload was started with, the remaining parts
+	// must be encrypted with it
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
+
+	// For multipart upload: the parts already stored in S3 and fresh URLs for the others
+	NumberOfParts     int             `json:"number_of_parts,omitempty"`
+	UploadedParts     []UploadedPart  `json:"uploaded_parts"`
+	PresignedPartURLs []PartUploadURL `json:"presigned_part_urls,omitempty"`
+
+	// For direct PUT the whole object is uploaded again
+	PresignedDataPutURL string `json:"presigned_data_put_url,omitempty"`
+
+	PresignedIndexPutURL  string    `json:"presigned_index_put_url"`
+	PresignedURLsExpireAt time.Time `json:"presigned_urls_expire_at"`
+
+	// Headers the requests to the data and index put URLs and to the part URLs must send
+	PutHeaders  map[string]string `json:"put_headers,omitempty"`
+	PartHeaders map[string]string `json:"part_headers,omitempty"`
+}
+
+func (r *ResumeUploadRequest) Validate(ctx context.Context) error {
+	if r.DatarangeUploadID <= 0 {
+		return ValidationError(fmt.Errorf("datarange_upload_id is required"))
+	}
+	return validatePresignExpiry(r.PresignExpirySeconds)
+}
+
+// ResumeDatarangeUpload lets a client continue a pending upload after a restart or once
+// its presigned URLs have expired. It lists the parts that are already stored in S3 and
+// presigns new URLs for the missing parts and the index.
+func (s *UploadDatarangeServer) ResumeDatarangeUpload(ctx context.Context, log *slog.Logger, req *ResumeUploadRequest) (_ *ResumeUploadResponse, err error) {
+	log = log.With("datarange_upload_id", req.DatarangeUploadID)
+	log.Info("Resuming datarange upload")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to resume datarange upload", "error", err)
+		} else {
+			log.Info("Datarange upload resumed")
+		}
+	}()
+
+	err = req.Validate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queries := postgresstore.New(s.db)
+	uploadDetails, err := queries.GetDatarangeUploadWithDetails(ctx, req.DatarangeUploadID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeUploadNotFound, "failed to get datarange upload details: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datarange upload details: %w", err)
+	}
+
+	store, err := s.openStore(ctx, log, uploadStorageConfig(uploadDetails))
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := s.presignExpiryFor(req.PresignExpirySeconds)
+
+	response := &ResumeUploadResponse{
+		DatarangeID:         uploadDetails.ID,
+		ObjectKey:           uploadDetails.DataObjectKey,
+		FirstDatapointIndex: uint64(uploadDetails.FirstDatapointIndex),
+		NumberOfDatapoints:  uint64(uploadDetails.NumberOfDatapoints),
+		DataSize:            uint64(uploadDetails.DataSize),
+		UseDirectPut:        uploadDetails.UploadID == "DIRECT_PUT",
+		Streamed:            uploadDetails.Streamed,
+		WrappedDataKey:      uploadDetails.WrappedDataKey,
+		UploadedParts:       []UploadedPart{},
+
+		PresignedURLsExpireAt: time.Now().Add(expiry),
+	}
+
+	if response.UseDirectPut {
+		dataPut, err := s.generatePresignedPutURL(ctx, store, uploadDetails.DataObjectKey, expiry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate data upload URL: %w", err)
+		}
+		response.PresignedDataPutURL = dataPut.URL
+	} else {
+		partSize := s.calculatePartSize(response.DataSize)
+		response.NumberOfParts = s.calculateNumberOfParts(response.DataSize, partSize)
+
+		response.UploadedParts, err = s.listUploadedParts(ctx, store, uploadDetails)
+		if err != nil {
+			return nil, err
+		}
+
+		uploaded := make(map[int32]bool, len(response.UploadedParts))
+		for _, part := range response.UploadedParts {
+			uploaded[part.PartNumber] = true
+		}
+
+		for partNumber := int32(1); partNumber <= int32(response.NumberOfParts); partNumber++ {
+			if uploaded[partNumber] {
+				continue
+			}
+
+			part, err := s.presignUploadPart(ctx, store, uploadDetails.DataObjectKey, uploadDetails.UploadID, partNumber, expiry)
+			if err != nil {
+				return nil, err
+			}
+
+			response.PresignedPartURLs = append(response.PresignedPartURLs, PartUploadURL{
+				PartNumber: partNumber,
+				URL:        part.URL,
+			})
+			response.PartHeaders = part.Headers
+		}
+	}
+
+	indexPut, err := s.generatePresignedPutURL(ctx, store, uploadDetails.IndexObjectKey, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate index upload URL: %w", err)
+	}
+	response.PresignedIndexPutURL = indexPut.URL
+	response.PutHeaders = indexPut.Headers
+
+	return response, nil
+}
+
+// listUploadedParts returns the parts of the multipart upload that are stored in S3
+func (s *UploadDatarangeServer) listUploadedParts(ctx context.Context, store storage.ObjectStore, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow) ([]UploadedPart, error) {
+	parts := []UploadedPart{}
+
+	stored, err := store.ListParts(ctx, uploadDetails.DataObjectKey, uploadDetails.UploadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list uploaded parts: %w", err)
+	}
+
+	for _, part := range stored {
+		parts = append(parts, UploadedPart{
+			PartNumber: part.PartNumber,
+			ETag:       part.ETag,
+			Size:       part.Size,
+		})
+	}
+
+	return parts, nil
+}
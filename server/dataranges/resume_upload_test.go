@@ -0,0 +1,159 @@
+package dataranges_test
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/dataranges"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ResumeDatarangeUpload", func() {
+	var env *TestEnvironment
+
+	BeforeEach(func(ctx SpecContext) {
+		env = SetupTestEnvironment(ctx)
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		env.TeardownTestEnvironment(ctx)
+	})
+
+	resume := func(ctx SpecContext, id int64) (*dataranges.ResumeUploadResponse, error) {
+		return env.UploadSrv.ResumeDatarangeUpload(ctx, env.Logger, &dataranges.ResumeUploadRequest{
+			DatarangeUploadID: id,
+		})
+	}
+
+	Context("when resuming a multipart upload", func() {
+		var uploadResp *dataranges.UploadDatarangeResponse
+		var testData []byte
+
+		const partSize = 20 * 1024 * 1024
+
+		BeforeEach(func(ctx SpecContext) {
+			var err error
+			uploadResp, err = env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:         env.TestDatas3tName,
+				DataSize:            45 * 1024 * 1024, // 3 parts
+				NumberOfDatapoints:  1000,
+				FirstDatapointIndex: 0,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploadResp.PresignedMultipartUploadPutURLs).To(HaveLen(3))
+
+			testData = make([]byte, 45*1024*1024)
+			for i := range testData {
+				testData[i] = byte(i % 256)
+			}
+		})
+
+		uploadPart := func(url string, partNumber int) string {
+			end := min(partNumber*partSize, len(testData))
+			resp, err := HttpPut(url, bytes.NewReader(testData[(partNumber-1)*partSize:end]))
+			Expect(err).NotTo(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			return resp.Header.Get("ETag")
+		}
+
+		It("should presign all parts when nothing was uploaded yet", func(ctx SpecContext) {
+			resp, err := resume(ctx, uploadResp.DatarangeID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(resp.DatarangeID).To(Equal(uploadResp.DatarangeID))
+			Expect(resp.ObjectKey).To(Equal(uploadResp.ObjectKey))
+			Expect(resp.UseDirectPut).To(BeFalse())
+			Expect(resp.NumberOfParts).To(Equal(3))
+			Expect(resp.UploadedParts).To(BeEmpty())
+			Expect(resp.PresignedPartURLs).To(HaveLen(3))
+			Expect(resp.PresignedIndexPutURL).NotTo(BeEmpty())
+		})
+
+		It("should list the uploaded parts and presign the missing ones", func(ctx SpecContext) {
+			etag1 := uploadPart(uploadResp.PresignedMultipartUploadPutURLs[0], 1)
+			etag3 := uploadPart(uploadResp.PresignedMultipartUploadPutURLs[2], 3)
+
+			resp, err := resume(ctx, uploadResp.DatarangeID)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(resp.UploadedParts).To(ConsistOf(
+				dataranges.UploadedPart{PartNumber: 1, ETag: etag1, Size: partSize},
+				dataranges.UploadedPart{PartNumber: 3, ETag: etag3, Size: int64(len(testData) - 2*partSize)},
+			))
+			Expect(resp.PresignedPartURLs).To(HaveLen(1))
+			Expect(resp.PresignedPartURLs[0].PartNumber).To(Equal(int32(2)))
+
+			// The upload can be completed with the re-presigned URLs
+			etag2 := uploadPart(resp.PresignedPartURLs[0].URL, 2)
+
+			_, indexData := CreateProperTarWithIndex(1000, 0)
+			indexResp, err := HttpPut(resp.PresignedIndexPutURL, bytes.NewReader(indexData))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(indexResp.StatusCode).To(Equal(http.StatusOK))
+			indexResp.Body.Close()
+
+			err = env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, &dataranges.CompleteUploadRequest{
+				DatarangeUploadID: uploadResp.DatarangeID,
+				UploadIDs:         []string{etag1, etag2, etag3},
+			})
+			// The data is not a valid tar archive, but all parts were assembled
+			Expect(err).To(MatchError(apierror.ErrUploadValidationFailed))
+			Expect(err.Error()).NotTo(ContainSubstring("size mismatch"))
+		})
+	})
+
+	It("should presign a new data URL for a direct PUT upload", func(ctx SpecContext) {
+		uploadResp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+			Datas3tName:         env.TestDatas3tName,
+			DataSize:            1024,
+			NumberOfDatapoints:  10,
+			FirstDatapointIndex: 0,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := resume(ctx, uploadResp.DatarangeID)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.UseDirectPut).To(BeTrue())
+		Expect(resp.PresignedDataPutURL).NotTo(BeEmpty())
+		Expect(resp.PresignedPartURLs).To(BeEmpty())
+		Expect(resp.UploadedParts).To(BeEmpty())
+		Expect(resp.FirstDatapointIndex).To(Equal(uint64(0)))
+		Expect(resp.NumberOfDatapoints).To(Equal(uint64(10)))
+		Expect(resp.DataSize).To(Equal(uint64(1024)))
+	})
+
+	It("should presign the URLs with the requested expiry", func(ctx SpecContext) {
+		uploadResp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+			Datas3tName:         env.TestDatas3tName,
+			DataSize:            1024,
+			NumberOfDatapoints:  10,
+			FirstDatapointIndex: 0,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := env.UploadSrv.ResumeDatarangeUpload(ctx, env.Logger, &dataranges.ResumeUploadRequest{
+			DatarangeUploadID:    uploadResp.DatarangeID,
+			PresignExpirySeconds: 120,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.PresignedDataPutURL).To(ContainSubstring("X-Amz-Expires=120"))
+		Expect(resp.PresignedIndexPutURL).To(ContainSubstring("X-Amz-Expires=120"))
+		Expect(resp.PresignedURLsExpireAt).To(BeTemporally("~", time.Now().Add(2*time.Minute), time.Minute))
+	})
+
+	It("should fail to resume an unknown upload", func(ctx SpecContext) {
+		_, err := resume(ctx, 12345)
+		Expect(err).To(MatchError(apierror.ErrUploadNotFound))
+	})
+
+	It("should reject a request without an upload ID", func(ctx SpecContext) {
+		_, err := resume(ctx, 0)
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+})
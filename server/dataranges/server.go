@@ -1,23 +1,68 @@
 package dataranges
 
 import (
-	"github.com/draganm/datas3t/crypto"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/server/tiering"
+	"github.com/draganm/datas3t/storage"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type UploadDatarangeServer struct {
-	db        *pgxpool.Pool
-	encryptor *crypto.CredentialEncryptor
+	db            *pgxpool.Pool
+	storage       *storage.Opener
+	presignExpiry time.Duration
+	restoreDays   int32
+
+	maxProxyUploadSize int64
+	// proxyUploads holds a slot for every proxied upload in progress
+	proxyUploads chan struct{}
+}
+
+func NewServer(db *pgxpool.Pool, opener *storage.Opener) *UploadDatarangeServer {
+	return &UploadDatarangeServer{
+		db:                 db,
+		storage:            opener,
+		presignExpiry:      awsutil.DefaultPresignExpiry,
+		restoreDays:        tiering.DefaultRestoreDays,
+		maxProxyUploadSize: DefaultMaxProxyUploadSize,
+		proxyUploads:       make(chan struct{}, DefaultMaxProxyUploads),
+	}
+}
+
+// SetPresignExpiry sets how long presigned URLs stay valid when a request does not ask
+// for a different expiry
+func (s *UploadDatarangeServer) SetPresignExpiry(expiry time.Duration) {
+	s.presignExpiry = expiry
 }
 
-func NewServer(db *pgxpool.Pool, encryptionKey string) (*UploadDatarangeServer, error) {
-	encryptor, err := crypto.NewCredentialEncryptor(encryptionKey)
+// SetRestoreDays sets how many days the copies of archived data objects restored for
+// aggregations are kept
+func (s *UploadDatarangeServer) SetRestoreDays(days int32) {
+	s.restoreDays = days
+}
+
+// SetMaxProxyUploadSize sets the largest TAR archive accepted by ProxyUploadDatarange
+func (s *UploadDatarangeServer) SetMaxProxyUploadSize(size int64) {
+	s.maxProxyUploadSize = size
+}
+
+// SetMaxProxyUploads sets how many proxied uploads run at the same time, further uploads
+// wait for a slot. It must be called before the server handles requests.
+func (s *UploadDatarangeServer) SetMaxProxyUploads(n int) {
+	s.proxyUploads = make(chan struct{}, n)
+}
+
+// openStore opens the object store of a bucket, cfg holds the encrypted credentials
+func (s *UploadDatarangeServer) openStore(ctx context.Context, log *slog.Logger, cfg storage.Config) (storage.ObjectStore, error) {
+	store, err := s.storage.Open(ctx, log, cfg)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to open object store: %w", err)
 	}
 
-	return &UploadDatarangeServer{
-		db:        db,
-		encryptor: encryptor,
-	}, nil
+	return store, nil
 }
@@ -2,13 +2,16 @@ package dataranges
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/tiering"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5"
 )
 
 type StartAggregateRequest struct {
@@ -29,6 +32,11 @@ type StartAggregateResponse struct {
 	PresignedMultipartUploadPutURLs []string `json:"presigned_multipart_upload_urls,omitempty"`
 	PresignedDataPutURL             string   `json:"presigned_data_put_url,omitempty"`
 	PresignedIndexPutURL            string   `json:"presigned_index_put_url"`
+
+	// Headers the requests to the data and index put URLs and to the multipart upload URLs
+	// must send
+	PutHeaders  map[string]string `json:"put_headers,omitempty"`
+	PartHeaders map[string]string `json:"part_headers,omitempty"`
 }
 
 type DatarangeDownloadURL struct {
@@ -40,10 +48,16 @@ type DatarangeDownloadURL struct {
 	SizeBytes         int64  `json:"size_bytes"`
 	PresignedDataURL  string `json:"presigned_data_url"`
 	PresignedIndexURL string `json:"presigned_index_url"`
+
+	// Headers must be sent with the requests to the presigned URLs
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// WrappedDataKey is the data key the content of an encrypted datarange is encrypted with
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
 }
 
-var ErrInsufficientDataranges = fmt.Errorf("range must contain at least two dataranges")
-var ErrRangeNotFullyCovered = fmt.Errorf("range is not fully covered by existing dataranges")
+var ErrInsufficientDataranges = apierror.ErrInsufficientDataranges
+var ErrRangeNotFullyCovered = apierror.ErrRangeNotFullyCovered
 
 func (r *StartAggregateRequest) Validate(ctx context.Context) error {
 	if r.Datas3tName == "" {
@@ -81,6 +95,9 @@ func (s *UploadDatarangeServer) StartAggregate(ctx context.Context, log *slog.Lo
 	// Get datas3t with bucket information
 	noTxQueries := postgresstore.New(s.db)
 	datas3t, err := noTxQueries.GetDatas3tWithBucket(ctx, req.Datas3tName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeDatas3tNotFound, "failed to find datas3t '%s': %w", req.Datas3tName, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to find datas3t '%s': %w", req.Datas3tName, err)
 	}
@@ -114,10 +131,24 @@ func (s *UploadDatarangeServer) StartAggregate(ctx context.Context, log *slog.Lo
 		return nil, fmt.Errorf("%w: found %d dataranges, need at least 2", ErrInsufficientDataranges, len(sourceDataranges))
 	}
 
-	// Create S3 client
-	s3Client, err := s.createS3Client(ctx, log, datas3t)
+	store, err := s.openStore(ctx, log, datas3tStorageConfig(datas3t))
+	if err != nil {
+		return nil, err
+	}
+
+	// The aggregate is assembled from the source data objects, archived ones have to be
+	// restored first
+	restorer := tiering.NewRestorer(noTxQueries, s.restoreDays, time.Now().Add(s.presignExpiry))
+	for _, dr := range sourceDataranges {
+		err = restorer.Check(ctx, log, store, dr.ID, dr.DataObjectKey, dr.StorageClass, dr.RestoreExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = restorer.Err()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+		return nil, err
 	}
 
 	// Start transaction for atomic operations
@@ -137,7 +168,8 @@ func (s *UploadDatarangeServer) StartAggregate(ctx context.Context, log *slog.Lo
 
 	// Generate object keys for the aggregate
 	objectKey := fmt.Sprintf(
-		"datas3t/%s/dataranges/%020d-%020d-%012d.tar",
+		"%sdatas3t/%s/dataranges/%020d-%020d-%012d.tar",
+		datas3t.KeyPrefix,
 		req.Datas3tName,
 		req.FirstDatapointIndex,
 		req.LastDatapointIndex,
@@ -145,7 +177,8 @@ func (s *UploadDatarangeServer) StartAggregate(ctx context.Context, log *slog.Lo
 	)
 
 	indexObjectKey := fmt.Sprintf(
-		"datas3t/%s/dataranges/%020d-%020d-%012d.index",
+		"%sdatas3t/%s/dataranges/%020d-%020d-%012d.index",
+		datas3t.KeyPrefix,
 		req.Datas3tName,
 		req.FirstDatapointIndex,
 		req.LastDatapointIndex,
@@ -178,34 +211,26 @@ func (s *UploadDatarangeServer) StartAggregate(ctx context.Context, log *slog.Lo
 	useDirectPut := uint64(estimatedDataSize) < MinPartSize
 	var uploadID string
 	var presignedPutURLs []string
-	var presignedDataPutURL string
+	var partHeaders map[string]string
+	var presignedDataPut storage.PresignedRequest
 
 	if useDirectPut {
 		// For small aggregates, use direct PUT
 		uploadID = "DIRECT_PUT"
-		presignedDataPutURL, err = s.generatePresignedPutURL(ctx, s3Client, datas3t.Bucket, objectKey)
+		presignedDataPut, err = s.generatePresignedPutURL(ctx, store, objectKey, s.presignExpiry)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate data upload URL: %w", err)
 		}
 	} else {
 		// For large aggregates, use multipart upload
-		createResp, err := s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-			Bucket: aws.String(datas3t.Bucket),
-			Key:    aws.String(objectKey),
-		})
+		uploadID, err = store.CreateMultipartUpload(ctx, objectKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create multipart upload: %w", err)
 		}
 
-		uploadID = *createResp.UploadId
-
 		defer func() {
 			if err != nil {
-				s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
-					Bucket:   aws.String(datas3t.Bucket),
-					Key:      aws.String(objectKey),
-					UploadId: aws.String(uploadID),
-				})
+				store.AbortMultipartUpload(ctx, objectKey, uploadID)
 			}
 		}()
 
@@ -214,14 +239,14 @@ func (s *UploadDatarangeServer) StartAggregate(ctx context.Context, log *slog.Lo
 		numParts := s.calculateNumberOfParts(uint64(estimatedDataSize), partSize)
 
 		// Generate presigned URLs for multipart upload parts
-		presignedPutURLs, err = s.generateMultipartUploadURLs(ctx, s3Client, datas3t.Bucket, objectKey, uploadID, numParts)
+		presignedPutURLs, partHeaders, err = s.generateMultipartUploadURLs(ctx, store, objectKey, uploadID, numParts, s.presignExpiry)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate multipart upload URLs: %w", err)
 		}
 	}
 
 	// Generate presigned URL for index upload
-	presignedIndexURL, err := s.generatePresignedPutURL(ctx, s3Client, datas3t.Bucket, indexObjectKey)
+	presignedIndex, err := s.generatePresignedPutURL(ctx, store, indexObjectKey, s.presignExpiry)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate index upload URL: %w", err)
 	}
@@ -229,12 +254,12 @@ func (s *UploadDatarangeServer) StartAggregate(ctx context.Context, log *slog.Lo
 	// Generate presigned download URLs for source dataranges
 	var sourceDownloadURLs []DatarangeDownloadURL
 	for _, dr := range sourceDataranges {
-		dataDownloadURL, err := s.generatePresignedGetURL(ctx, s3Client, dr.Bucket, dr.DataObjectKey)
+		dataDownload, err := s.generatePresignedGetURL(ctx, store, dr.DataObjectKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate data download URL for datarange %d: %w", dr.ID, err)
 		}
 
-		indexDownloadURL, err := s.generatePresignedGetURL(ctx, s3Client, dr.Bucket, dr.IndexObjectKey)
+		indexDownload, err := s.generatePresignedGetURL(ctx, store, dr.IndexObjectKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate index download URL for datarange %d: %w", dr.ID, err)
 		}
@@ -246,8 +271,10 @@ func (s *UploadDatarangeServer) StartAggregate(ctx context.Context, log *slog.Lo
 			MinDatapointKey:   dr.MinDatapointKey,
 			MaxDatapointKey:   dr.MaxDatapointKey,
 			SizeBytes:         dr.SizeBytes,
-			PresignedDataURL:  dataDownloadURL,
-			PresignedIndexURL: indexDownloadURL,
+			PresignedDataURL:  dataDownload.URL,
+			PresignedIndexURL: indexDownload.URL,
+			Headers:           dataDownload.Headers,
+			WrappedDataKey:    dr.WrappedDataKey,
 		})
 	}
 
@@ -285,23 +312,18 @@ func (s *UploadDatarangeServer) StartAggregate(ctx context.Context, log *slog.Lo
 		SourceDatarangeDownloadURLs:     sourceDownloadURLs,
 		UseDirectPut:                    useDirectPut,
 		PresignedMultipartUploadPutURLs: presignedPutURLs,
-		PresignedDataPutURL:             presignedDataPutURL,
-		PresignedIndexPutURL:            presignedIndexURL,
+		PresignedDataPutURL:             presignedDataPut.URL,
+		PresignedIndexPutURL:            presignedIndex.URL,
+		PutHeaders:                      presignedIndex.Headers,
+		PartHeaders:                     partHeaders,
 	}, nil
 }
 
-func (s *UploadDatarangeServer) generatePresignedGetURL(ctx context.Context, s3Client *s3.Client, bucket, objectKey string) (string, error) {
-	presigner := s3.NewPresignClient(s3Client)
-
-	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(objectKey),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 24 * time.Hour // URL expires in 24 hours
-	})
+func (s *UploadDatarangeServer) generatePresignedGetURL(ctx context.Context, store storage.ObjectStore, objectKey string) (storage.PresignedRequest, error) {
+	get, err := store.PresignGetObject(ctx, objectKey, s.presignExpiry)
 	if err != nil {
-		return "", fmt.Errorf("failed to presign get object: %w", err)
+		return storage.PresignedRequest{}, fmt.Errorf("failed to presign get object: %w", err)
 	}
 
-	return req.URL, nil
+	return get, nil
 }
@@ -2,14 +2,16 @@ package dataranges
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/datas3t/apierror"
 	awsutil "github.com/draganm/datas3t/aws"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5"
 )
 
 type UploadDatarangeRequest struct {
@@ -17,6 +19,32 @@ type UploadDatarangeRequest struct {
 	DataSize            uint64 `json:"data_size"`
 	NumberOfDatapoints  uint64 `json:"number_of_datapoints"`
 	FirstDatapointIndex uint64 `json:"first_datapoint_index"`
+
+	// Append lets the server allocate the next NumberOfDatapoints keys of the datas3t
+	// instead of using FirstDatapointIndex. The allocated keys are returned in the response.
+	Append bool `json:"append,omitempty"`
+
+	// LeaseDurationSeconds takes an exclusive lease on the datapoint key range. While the lease
+	// is active, starting another upload of an overlapping range fails with ErrDatarangeLeased.
+	LeaseDurationSeconds int64 `json:"lease_duration_seconds,omitempty"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+
+	// Stream starts a multipart upload of unknown size. DataSize, NumberOfDatapoints and
+	// FirstDatapointIndex are declared when completing the upload, the part URLs are
+	// presigned on demand with PresignUploadParts.
+	Stream bool `json:"stream,omitempty"`
+
+	// Replace swaps the upload in for the existing dataranges of its datapoint range when it
+	// completes, in a single transaction. The existing dataranges must lie within the range
+	// and cover every datapoint of it, their objects are scheduled for deletion.
+	Replace bool `json:"replace,omitempty"`
+
+	// WrappedDataKey is the data key the client encrypted the content of the datapoints
+	// with, wrapped with a key only the clients hold. It is required by encrypted datas3ts
+	// and refused by others, and handed out again with the download URLs of the datarange.
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
 }
 
 type UploadDatarangeResponse struct {
@@ -34,10 +62,22 @@ type UploadDatarangeResponse struct {
 	PresignedDataPutURL string `json:"presigned_data_put_url,omitempty"`
 
 	// Common fields
-	PresignedIndexPutURL string `json:"presigned_index_put_url"`
+	PresignedIndexPutURL  string    `json:"presigned_index_put_url"`
+	PresignedURLsExpireAt time.Time `json:"presigned_urls_expire_at"`
+
+	// Headers the requests to the data and index put URLs and to the multipart upload URLs
+	// must send, e.g. the server-side encryption settings of the bucket
+	PutHeaders  map[string]string `json:"put_headers,omitempty"`
+	PartHeaders map[string]string `json:"part_headers,omitempty"`
+
+	// Set when the upload took a lease
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
 }
 
-type ValidationError error
+// ValidationError marks err as a validation failure of the request
+func ValidationError(err error) error {
+	return apierror.Wrap(apierror.CodeValidationFailed, err)
+}
 
 const (
 	// 20MB minimum part size for S3 multipart upload
@@ -46,6 +86,8 @@ const (
 	MaxPartSize = 100 * 1024 * 1024
 	// Maximum number of parts allowed by S3
 	MaxParts = 10000
+	// Longest wrapped data key accepted with an upload
+	maxWrappedDataKeyLength = 1024
 )
 
 func (r *UploadDatarangeRequest) Validate(ctx context.Context) error {
@@ -53,6 +95,18 @@ func (r *UploadDatarangeRequest) Validate(ctx context.Context) error {
 		return ValidationError(fmt.Errorf("datas3t_name is required"))
 	}
 
+	if len(r.WrappedDataKey) > maxWrappedDataKeyLength {
+		return ValidationError(fmt.Errorf("wrapped_data_key must be at most %d characters", maxWrappedDataKeyLength))
+	}
+
+	if r.Replace && (r.Append || r.Stream) {
+		return ValidationError(fmt.Errorf("replace requires the datapoint range upfront and cannot be combined with append or stream"))
+	}
+
+	if r.Stream {
+		return r.validateStream()
+	}
+
 	if r.DataSize == 0 {
 		return ValidationError(fmt.Errorf("data_size must be greater than 0"))
 	}
@@ -61,10 +115,50 @@ func (r *UploadDatarangeRequest) Validate(ctx context.Context) error {
 		return ValidationError(fmt.Errorf("number_of_datapoints must be greater than 0"))
 	}
 
+	if r.Append && r.FirstDatapointIndex != 0 {
+		return ValidationError(fmt.Errorf("first_datapoint_index cannot be set in append mode"))
+	}
+
+	err := validateLeaseDuration(r.LeaseDurationSeconds)
+	if err != nil {
+		return err
+	}
+
+	return validatePresignExpiry(r.PresignExpirySeconds)
+}
+
+// validatePresignExpiry checks the presign expiry of a request, 0 selects the server default
+func validatePresignExpiry(seconds int64) error {
+	maxSeconds := int64(awsutil.MaxPresignExpiry / time.Second)
+	if seconds < 0 || seconds > maxSeconds {
+		return ValidationError(fmt.Errorf("presign_expiry_seconds must be between 1 and %d", maxSeconds))
+	}
+	return nil
+}
+
+// checkWrappedDataKey requires the uploads of encrypted datas3ts to carry the wrapped data
+// key their content is encrypted with, and refuses it for other datas3ts
+func checkWrappedDataKey(encrypted bool, datas3tName, wrappedDataKey string) error {
+	if encrypted && wrappedDataKey == "" {
+		return ValidationError(fmt.Errorf("datas3t '%s' is encrypted, the upload requires wrapped_data_key", datas3tName))
+	}
+
+	if !encrypted && wrappedDataKey != "" {
+		return ValidationError(fmt.Errorf("datas3t '%s' is not encrypted, the upload cannot carry wrapped_data_key", datas3tName))
+	}
+
 	return nil
 }
 
-var ErrDatarangeOverlap = fmt.Errorf("datarange overlaps with existing dataranges")
+// presignExpiryFor returns how long the URLs presigned for a request stay valid
+func (s *UploadDatarangeServer) presignExpiryFor(seconds int64) time.Duration {
+	if seconds == 0 {
+		return s.presignExpiry
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+var ErrDatarangeOverlap = apierror.ErrDatarangeOverlap
 
 func (s *UploadDatarangeServer) StartDatarangeUpload(ctx context.Context, log *slog.Logger, req *UploadDatarangeRequest) (_ *UploadDatarangeResponse, err error) {
 	log = log.With(
@@ -72,6 +166,10 @@ func (s *UploadDatarangeServer) StartDatarangeUpload(ctx context.Context, log *s
 		"data_size", req.DataSize,
 		"number_of_datapoints", req.NumberOfDatapoints,
 		"first_datapoint_index", req.FirstDatapointIndex,
+		"append", req.Append,
+		"lease_duration_seconds", req.LeaseDurationSeconds,
+		"replace", req.Replace,
+		"encrypted", req.WrappedDataKey != "",
 	)
 	log.Info("Starting datarange upload")
 
@@ -88,45 +186,53 @@ func (s *UploadDatarangeServer) StartDatarangeUpload(ctx context.Context, log *s
 		return nil, err
 	}
 
-	var s3Client *s3.Client
-
 	// Check for overlapping dataranges without starting a transaction first
 
 	noTxQueries := postgresstore.New(s.db)
 	// Get datas3t with bucket information
 	datas3t, err := noTxQueries.GetDatas3tWithBucket(ctx, req.Datas3tName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeDatas3tNotFound, "failed to find datas3t '%s': %w", req.Datas3tName, err)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to find datas3t '%s': %w", req.Datas3tName, err)
 	}
 
-	{
+	err = checkWrappedDataKey(datas3t.Encrypted, req.Datas3tName, req.WrappedDataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// In append mode the keys are only known once they are allocated in the transaction,
+	// streamed uploads declare them on completion
+	if !req.Append && !req.Stream {
 		// Calculate datapoint range
 		firstDatapointIndex := int64(req.FirstDatapointIndex)
 		lastDatapointIndex := firstDatapointIndex + int64(req.NumberOfDatapoints) - 1
 
-		// Check for overlapping dataranges (completed uploads)
-		hasDatarangeOverlap, err := noTxQueries.CheckDatarangeOverlap(ctx, postgresstore.CheckDatarangeOverlapParams{
-			Datas3tID:       datas3t.ID,
-			MinDatapointKey: lastDatapointIndex + 1, // Check if existing max >= our min
-			MaxDatapointKey: firstDatapointIndex,    // Check if existing min < our max
-		})
+		// Check for overlapping dataranges (completed uploads), unless they are replaced
+		_, err = checkExistingDataranges(ctx, noTxQueries, datas3t, req, firstDatapointIndex, lastDatapointIndex)
 		if err != nil {
-			return nil, fmt.Errorf("failed to check datarange overlap: %w", err)
+			return nil, err
 		}
 
-		if hasDatarangeOverlap {
-			return nil, fmt.Errorf("%w: datarange overlaps with existing dataranges", ErrDatarangeOverlap)
+		// Fail fast when another upload holds a lease on the range
+		err = checkLeaseConflict(ctx, noTxQueries, datas3t.ID, 0, firstDatapointIndex, lastDatapointIndex)
+		if err != nil {
+			return nil, err
 		}
 
 		// Allow overlapping uploads - they will be disambiguated at completion time
 		// Only the first one to complete will succeed
+	}
 
-		// Create S3 client
-		s3Client, err = s.createS3Client(ctx, log, datas3t)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create S3 client: %w", err)
-		}
+	store, err := s.openStore(ctx, log, datas3tStorageConfig(datas3t))
+	if err != nil {
+		return nil, err
+	}
 
+	if req.Stream {
+		return s.startStreamedUpload(ctx, store, datas3t, req)
 	}
 
 	// Start a transaction for atomic operations
@@ -144,56 +250,51 @@ func (s *UploadDatarangeServer) StartDatarangeUpload(ctx context.Context, log *s
 		return nil, fmt.Errorf("failed to increment upload counter: %w", err)
 	}
 
-	// Generate object key for the data using upload counter
-	objectKey := fmt.Sprintf(
-		"datas3t/%s/dataranges/%020d-%020d-%012d.tar",
-		req.Datas3tName,
-		req.FirstDatapointIndex,
-		req.FirstDatapointIndex+req.NumberOfDatapoints-1,
-		uploadCounter,
-	)
+	firstDatapointKey := req.FirstDatapointIndex
+	if req.Append {
+		// Allocate the next contiguous block of keys, concurrent appends wait for the row lock
+		firstKey, err := queries.AllocateDatapointKeys(ctx, postgresstore.AllocateDatapointKeysParams{
+			ID:                 datas3t.ID,
+			NumberOfDatapoints: int64(req.NumberOfDatapoints),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to allocate datapoint keys: %w", err)
+		}
 
-	// Generate presigned URL for index using upload counter
-	indexObjectKey := fmt.Sprintf(
-		"datas3t/%s/dataranges/%020d-%020d-%012d.index",
-		req.Datas3tName,
-		req.FirstDatapointIndex,
-		req.FirstDatapointIndex+req.NumberOfDatapoints-1,
-		uploadCounter,
-	)
+		firstDatapointKey = uint64(firstKey)
+		log = log.With("allocated_first_datapoint_index", firstDatapointKey)
+	}
+
+	// Generate object keys for the data and the index using upload counter
+	objectKey, indexObjectKey := datarangeObjectKeys(datas3t.KeyPrefix, req.Datas3tName, firstDatapointKey, req.NumberOfDatapoints, uploadCounter)
+
+	expiry := s.presignExpiryFor(req.PresignExpirySeconds)
+	expiresAt := time.Now().Add(expiry)
 
 	// Determine upload method based on data size
 	useDirectPut := req.DataSize < MinPartSize
 	var uploadID string
 	var presignedPutURLs []string
-	var presignedDataPutURL string
+	var partHeaders map[string]string
+	var presignedDataPut storage.PresignedRequest
 
 	if useDirectPut {
 		// For small objects, use direct PUT
 		uploadID = "DIRECT_PUT"
-		presignedDataPutURL, err = s.generatePresignedPutURL(ctx, s3Client, datas3t.Bucket, objectKey)
+		presignedDataPut, err = s.generatePresignedPutURL(ctx, store, objectKey, expiry)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate data upload URL: %w", err)
 		}
 	} else {
 		// For large objects, use multipart upload
-		createResp, err := s3Client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
-			Bucket: aws.String(datas3t.Bucket),
-			Key:    aws.String(objectKey),
-		})
+		uploadID, err = store.CreateMultipartUpload(ctx, objectKey)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create multipart upload: %w", err)
 		}
 
-		uploadID = *createResp.UploadId
-
 		defer func() {
 			if err != nil {
-				s3Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
-					Bucket:   aws.String(datas3t.Bucket),
-					Key:      aws.String(objectKey),
-					UploadId: aws.String(uploadID),
-				})
+				store.AbortMultipartUpload(ctx, objectKey, uploadID)
 			}
 		}()
 
@@ -202,48 +303,62 @@ func (s *UploadDatarangeServer) StartDatarangeUpload(ctx context.Context, log *s
 		numParts := s.calculateNumberOfParts(req.DataSize, partSize)
 
 		// Generate presigned URLs for multipart upload parts
-		presignedPutURLs, err = s.generateMultipartUploadURLs(ctx, s3Client, datas3t.Bucket, objectKey, uploadID, numParts)
+		presignedPutURLs, partHeaders, err = s.generateMultipartUploadURLs(ctx, store, objectKey, uploadID, numParts, expiry)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate multipart upload URLs: %w", err)
 		}
 	}
-	presignedIndexURL, err := s.generatePresignedPutURL(ctx, s3Client, datas3t.Bucket, indexObjectKey)
+	presignedIndex, err := s.generatePresignedPutURL(ctx, store, indexObjectKey, expiry)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate index upload URL: %w", err)
 	}
 
 	// Calculate datapoint range for upload record creation
-	firstDatapointIndex := int64(req.FirstDatapointIndex)
+	firstDatapointIndex := int64(firstDatapointKey)
 	lastDatapointIndex := firstDatapointIndex + int64(req.NumberOfDatapoints) - 1
 
-	// Check for overlapping dataranges (completed uploads) within transaction
-	hasDatarangeOverlap, err := queries.CheckDatarangeOverlap(ctx, postgresstore.CheckDatarangeOverlapParams{
-		Datas3tID:       datas3t.ID,
-		MinDatapointKey: lastDatapointIndex + 1, // Check if existing max >= our min
-		MaxDatapointKey: firstDatapointIndex,    // Check if existing min < our max
-	})
+	// Check for overlapping dataranges (completed uploads) within transaction. The
+	// dataranges replaced on completion must not change until then.
+	replacedIDs, err := checkExistingDataranges(ctx, queries, datas3t, req, firstDatapointIndex, lastDatapointIndex)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check datarange overlap: %w", err)
+		return nil, err
 	}
 
-	if hasDatarangeOverlap {
-		return nil, fmt.Errorf("%w: datarange overlaps with existing dataranges", ErrDatarangeOverlap)
+	// Concurrent starts are serialized by the upload counter update, so a lease taken
+	// by another upload is visible here
+	err = checkLeaseConflict(ctx, queries, datas3t.ID, 0, firstDatapointIndex, lastDatapointIndex)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create datarange upload record
 	uploadRecordID, err := queries.CreateDatarangeUpload(ctx, postgresstore.CreateDatarangeUploadParams{
-		Datas3tID:           datas3t.ID,
-		UploadID:            uploadID,
-		DataObjectKey:       objectKey,
-		IndexObjectKey:      indexObjectKey,
-		FirstDatapointIndex: firstDatapointIndex,
-		NumberOfDatapoints:  int64(req.NumberOfDatapoints),
-		DataSize:            int64(req.DataSize),
+		Datas3tID:            datas3t.ID,
+		UploadID:             uploadID,
+		DataObjectKey:        objectKey,
+		IndexObjectKey:       indexObjectKey,
+		FirstDatapointIndex:  firstDatapointIndex,
+		NumberOfDatapoints:   int64(req.NumberOfDatapoints),
+		DataSize:             int64(req.DataSize),
+		ReplacedDatarangeIds: replacedIDs,
+		WrappedDataKey:       req.WrappedDataKey,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create datarange upload: %w", err)
 	}
 
+	var leaseExpiresAt *time.Time
+	if req.LeaseDurationSeconds > 0 {
+		expiresAt, err := queries.SetDatarangeUploadLease(ctx, postgresstore.SetDatarangeUploadLeaseParams{
+			ID:                   uploadRecordID,
+			LeaseDurationSeconds: req.LeaseDurationSeconds,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to take lease: %w", err)
+		}
+		leaseExpiresAt = &expiresAt.Time
+	}
+
 	// Commit transaction
 	err = tx.Commit(ctx)
 	if err != nil {
@@ -253,14 +368,61 @@ func (s *UploadDatarangeServer) StartDatarangeUpload(ctx context.Context, log *s
 	return &UploadDatarangeResponse{
 		DatarangeID:                     uploadRecordID, // Return upload record ID for completion
 		ObjectKey:                       objectKey,
-		FirstDatapointIndex:             req.FirstDatapointIndex,
+		FirstDatapointIndex:             firstDatapointKey,
 		UseDirectPut:                    useDirectPut,
 		PresignedMultipartUploadPutURLs: presignedPutURLs,
-		PresignedDataPutURL:             presignedDataPutURL,
-		PresignedIndexPutURL:            presignedIndexURL,
+		PresignedDataPutURL:             presignedDataPut.URL,
+		PresignedIndexPutURL:            presignedIndex.URL,
+		PresignedURLsExpireAt:           expiresAt,
+		PutHeaders:                      presignedIndex.Headers,
+		PartHeaders:                     partHeaders,
+		LeaseExpiresAt:                  leaseExpiresAt,
 	}, nil
 }
 
+// checkExistingDataranges fails with ErrDatarangeOverlap if the datapoint range overlaps
+// existing dataranges. When the upload replaces them, they must cover the range instead
+// and their IDs are returned.
+func checkExistingDataranges(ctx context.Context, queries *postgresstore.Queries, datas3t postgresstore.GetDatas3tWithBucketRow, req *UploadDatarangeRequest, firstDatapointIndex, lastDatapointIndex int64) ([]int64, error) {
+	if req.Replace {
+		replaced, err := replacedDataranges(ctx, queries, req.Datas3tName, firstDatapointIndex, lastDatapointIndex)
+		if err != nil {
+			return nil, err
+		}
+		return datarangeIDs(replaced), nil
+	}
+
+	hasDatarangeOverlap, err := queries.CheckDatarangeOverlap(ctx, postgresstore.CheckDatarangeOverlapParams{
+		Datas3tID:       datas3t.ID,
+		MinDatapointKey: lastDatapointIndex + 1, // Check if existing max >= our min
+		MaxDatapointKey: firstDatapointIndex,    // Check if existing min < our max
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to check datarange overlap: %w", err)
+	}
+
+	if hasDatarangeOverlap {
+		return nil, fmt.Errorf("%w: datarange overlaps with existing dataranges", ErrDatarangeOverlap)
+	}
+
+	return nil, nil
+}
+
+// datarangeObjectKeys returns the keys of the data and index objects of a datarange below
+// the key prefix of its bucket. The upload counter keeps the keys of overlapping uploads apart.
+func datarangeObjectKeys(keyPrefix, datas3tName string, firstDatapointKey, numberOfDatapoints uint64, uploadCounter int64) (string, string) {
+	prefix := fmt.Sprintf(
+		"%sdatas3t/%s/dataranges/%020d-%020d-%012d",
+		keyPrefix,
+		datas3tName,
+		firstDatapointKey,
+		firstDatapointKey+numberOfDatapoints-1,
+		uploadCounter,
+	)
+
+	return prefix + ".tar", prefix + ".index"
+}
+
 func (s *UploadDatarangeServer) calculatePartSize(dataSize uint64) uint64 {
 	// Calculate optimal part size
 	// Start with a reasonable default and adjust based on data size
@@ -282,59 +444,58 @@ func (s *UploadDatarangeServer) calculateNumberOfParts(dataSize, partSize uint64
 	return numParts
 }
 
-func (s *UploadDatarangeServer) createS3Client(ctx context.Context, log *slog.Logger, datas3t postgresstore.GetDatas3tWithBucketRow) (*s3.Client, error) {
-	// Decrypt credentials
-	accessKey, secretKey, err := s.encryptor.DecryptCredentials(datas3t.AccessKey, datas3t.SecretKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+// datas3tStorageConfig returns the bucket of a datas3t
+func datas3tStorageConfig(datas3t postgresstore.GetDatas3tWithBucketRow) storage.Config {
+	return storage.Config{
+		Endpoint:        datas3t.Endpoint,
+		Bucket:          datas3t.Bucket,
+		AccessKey:       datas3t.AccessKey,
+		SecretKey:       datas3t.SecretKey,
+		SessionToken:    datas3t.SessionToken,
+		Region:          datas3t.Region,
+		AddressingStyle: datas3t.AddressingStyle,
+		CredentialMode:  datas3t.CredentialMode,
+		ServerSideEncryption: storage.ServerSideEncryption{
+			Mode:        datas3t.SseMode,
+			KMSKeyID:    datas3t.SseKmsKeyID,
+			CustomerKey: datas3t.SseCustomerKey,
+		},
 	}
-
-	// Use shared AWS utility for S3 client creation with logging
-	return awsutil.CreateS3Client(ctx, awsutil.S3ClientConfig{
-		AccessKey: accessKey,
-		SecretKey: secretKey,
-		Endpoint:  datas3t.Endpoint,
-		Logger:    log,
-	})
 }
 
-func (s *UploadDatarangeServer) generateMultipartUploadURLs(ctx context.Context, s3Client *s3.Client, bucket, objectKey, uploadID string, numParts int) ([]string, error) {
-	presigner := s3.NewPresignClient(s3Client)
+// generateMultipartUploadURLs presigns the URLs of the parts of a multipart upload and
+// returns them with the headers requests to them must send
+func (s *UploadDatarangeServer) generateMultipartUploadURLs(ctx context.Context, store storage.ObjectStore, objectKey, uploadID string, numParts int, expiry time.Duration) ([]string, map[string]string, error) {
 	urls := make([]string, numParts)
+	var headers map[string]string
 
 	for i := 0; i < numParts; i++ {
-		partNumber := int32(i + 1)
-
-		req, err := presigner.PresignUploadPart(ctx, &s3.UploadPartInput{
-			Bucket:     aws.String(bucket),
-			Key:        aws.String(objectKey),
-			UploadId:   aws.String(uploadID),
-			PartNumber: aws.Int32(partNumber),
-		}, func(opts *s3.PresignOptions) {
-			opts.Expires = 24 * time.Hour // URL expires in 24 hours
-		})
+		part, err := s.presignUploadPart(ctx, store, objectKey, uploadID, int32(i+1), expiry)
 		if err != nil {
-			return nil, fmt.Errorf("failed to presign part %d: %w", partNumber, err)
+			return nil, nil, err
 		}
 
-		urls[i] = req.URL
+		urls[i] = part.URL
+		headers = part.Headers
 	}
 
-	return urls, nil
+	return urls, headers, nil
 }
 
-func (s *UploadDatarangeServer) generatePresignedPutURL(ctx context.Context, s3Client *s3.Client, bucket, objectKey string) (string, error) {
-	presigner := s3.NewPresignClient(s3Client)
+func (s *UploadDatarangeServer) presignUploadPart(ctx context.Context, store storage.ObjectStore, objectKey, uploadID string, partNumber int32, expiry time.Duration) (storage.PresignedRequest, error) {
+	part, err := store.PresignUploadPart(ctx, objectKey, uploadID, partNumber, expiry)
+	if err != nil {
+		return storage.PresignedRequest{}, fmt.Errorf("failed to presign part %d: %w", partNumber, err)
+	}
+
+	return part, nil
+}
 
-	req, err := presigner.PresignPutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(objectKey),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 24 * time.Hour // URL expires in 24 hours
-	})
+func (s *UploadDatarangeServer) generatePresignedPutURL(ctx context.Context, store storage.ObjectStore, objectKey string, expiry time.Duration) (storage.PresignedRequest, error) {
+	put, err := store.PresignPutObject(ctx, objectKey, expiry)
 	if err != nil {
-		return "", fmt.Errorf("failed to presign put object: %w", err)
+		return storage.PresignedRequest{}, fmt.Errorf("failed to presign put object: %w", err)
 	}
 
-	return req.URL, nil
+	return put, nil
 }
@@ -1,7 +1,16 @@
 package dataranges_test
 
 import (
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/bucket"
 	"github.com/draganm/datas3t/server/dataranges"
+	"github.com/draganm/datas3t/server/datas3t"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -220,4 +229,263 @@ var _ = Describe("StartDatarangeUpload", func() {
 			Expect(uploadCount).To(Equal(int64(2)))
 		})
 	})
+
+	Context("when appending", func() {
+		appendReq := func(numberOfDatapoints uint64) *dataranges.UploadDatarangeRequest {
+			return &dataranges.UploadDatarangeRequest{
+				Datas3tName:        env.TestDatas3tName,
+				DataSize:           1024,
+				NumberOfDatapoints: numberOfDatapoints,
+				Append:             true,
+			}
+		}
+
+		It("should allocate contiguous key blocks", func(ctx SpecContext) {
+			resp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, appendReq(10))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.FirstDatapointIndex).To(Equal(uint64(0)))
+			Expect(resp.ObjectKey).To(ContainSubstring("00000000000000000000-00000000000000000009"))
+
+			resp, err = env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, appendReq(5))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.FirstDatapointIndex).To(Equal(uint64(10)))
+
+			uploads, err := env.Queries.GetAllDatarangeUploads(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(uploads).To(HaveLen(2))
+		})
+
+		It("should append after existing dataranges and pending uploads", func(ctx SpecContext) {
+			datas3tID, err := env.Queries.GetDatas3tIDByName(ctx, env.TestDatas3tName)
+			Expect(err).NotTo(HaveOccurred())
+
+			_, err = env.Queries.CreateDatarange(ctx, postgresstore.CreateDatarangeParams{
+				Datas3tID:       datas3tID,
+				DataObjectKey:   "existing.tar",
+				IndexObjectKey:  "existing.index",
+				MinDatapointKey: 0,
+				MaxDatapointKey: 99,
+				SizeBytes:       1024,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, appendReq(10))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.FirstDatapointIndex).To(Equal(uint64(100)))
+
+			_, err = env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:         env.TestDatas3tName,
+				DataSize:            1024,
+				NumberOfDatapoints:  50,
+				FirstDatapointIndex: 200,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resp, err = env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, appendReq(10))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.FirstDatapointIndex).To(Equal(uint64(250)))
+		})
+
+		It("should not hand out the same keys to concurrent appends", func(ctx SpecContext) {
+			const appenders = 8
+
+			firstKeys := make(chan uint64, appenders)
+			var wg sync.WaitGroup
+			for i := 0; i < appenders; i++ {
+				wg.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					defer wg.Done()
+
+					resp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, appendReq(10))
+					Expect(err).NotTo(HaveOccurred())
+					firstKeys <- resp.FirstDatapointIndex
+				}()
+			}
+			wg.Wait()
+			close(firstKeys)
+
+			var keys []uint64
+			for key := range firstKeys {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+
+			Expect(keys).To(HaveLen(appenders))
+			for i, key := range keys {
+				Expect(key).To(Equal(uint64(i * 10)))
+			}
+		})
+
+		It("should reject a first datapoint index", func(ctx SpecContext) {
+			req := appendReq(10)
+			req.FirstDatapointIndex = 5
+
+			_, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, req)
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		})
+	})
+
+	Context("when the bucket has a key prefix", func() {
+		BeforeEach(func(ctx SpecContext) {
+			err := env.BucketSrv.AddBucket(ctx, env.Logger, &bucket.BucketInfo{
+				Name:      "prefixed-bucket-config",
+				Endpoint:  env.MinioEndpoint,
+				Bucket:    env.TestBucketName,
+				AccessKey: env.MinioAccessKey,
+				SecretKey: env.MinioSecretKey,
+				KeyPrefix: "tenant-a",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = env.Datas3tSrv.AddDatas3t(ctx, env.Logger, &datas3t.AddDatas3tRequest{
+				Bucket: "prefixed-bucket-config",
+				Name:   "prefixed-datas3t",
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should place the objects below the key prefix", func(ctx SpecContext) {
+			resp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:         "prefixed-datas3t",
+				DataSize:            1024,
+				NumberOfDatapoints:  10,
+				FirstDatapointIndex: 0,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.ObjectKey).To(Equal("tenant-a/datas3t/prefixed-datas3t/dataranges/00000000000000000000-00000000000000000009-000000000001.tar"))
+
+			streamed, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName: "prefixed-datas3t",
+				Stream:      true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(streamed.ObjectKey).To(HavePrefix("tenant-a/datas3t/prefixed-datas3t/uploads/"))
+		})
+	})
+
+	Context("when the datas3t is encrypted", func() {
+		BeforeEach(func(ctx SpecContext) {
+			err := env.Datas3tSrv.AddDatas3t(ctx, env.Logger, &datas3t.AddDatas3tRequest{
+				Bucket:    env.TestBucketConfigName,
+				Name:      "encrypted-datas3t",
+				Encrypted: true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should store the wrapped data key with the upload", func(ctx SpecContext) {
+			resp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:         "encrypted-datas3t",
+				DataSize:            1024,
+				NumberOfDatapoints:  10,
+				FirstDatapointIndex: 0,
+				WrappedDataKey:      "wrapped-key",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			resumed, err := env.UploadSrv.ResumeDatarangeUpload(ctx, env.Logger, &dataranges.ResumeUploadRequest{
+				DatarangeUploadID: resp.DatarangeID,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resumed.WrappedDataKey).To(Equal("wrapped-key"))
+		})
+
+		It("should reject an upload without a wrapped data key", func(ctx SpecContext) {
+			_, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:         "encrypted-datas3t",
+				DataSize:            1024,
+				NumberOfDatapoints:  10,
+				FirstDatapointIndex: 0,
+			})
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+			Expect(err.Error()).To(ContainSubstring("requires wrapped_data_key"))
+		})
+
+		It("should reject a wrapped data key for a datas3t that is not encrypted", func(ctx SpecContext) {
+			_, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:         env.TestDatas3tName,
+				DataSize:            1024,
+				NumberOfDatapoints:  10,
+				FirstDatapointIndex: 0,
+				WrappedDataKey:      "wrapped-key",
+			})
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		})
+	})
+
+	Context("when setting the presign expiry", func() {
+		presignedExpiry := func(presignedURL string) string {
+			parsed, err := url.Parse(presignedURL)
+			Expect(err).NotTo(HaveOccurred())
+			return parsed.Query().Get("X-Amz-Expires")
+		}
+
+		It("should presign the URLs with the server default", func(ctx SpecContext) {
+			before := time.Now()
+			resp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:         env.TestDatas3tName,
+				DataSize:            1024,
+				NumberOfDatapoints:  10,
+				FirstDatapointIndex: 0,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(presignedExpiry(resp.PresignedDataPutURL)).To(Equal("86400"))
+			Expect(presignedExpiry(resp.PresignedIndexPutURL)).To(Equal("86400"))
+			Expect(resp.PresignedURLsExpireAt).To(BeTemporally("~", before.Add(24*time.Hour), time.Minute))
+		})
+
+		It("should use the expiry requested by the client", func(ctx SpecContext) {
+			resp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:          env.TestDatas3tName,
+				DataSize:             45 * 1024 * 1024,
+				NumberOfDatapoints:   1000,
+				FirstDatapointIndex:  0,
+				PresignExpirySeconds: 600,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, partURL := range resp.PresignedMultipartUploadPutURLs {
+				Expect(presignedExpiry(partURL)).To(Equal("600"))
+			}
+			Expect(presignedExpiry(resp.PresignedIndexPutURL)).To(Equal("600"))
+			Expect(resp.PresignedURLsExpireAt).To(BeTemporally("~", time.Now().Add(10*time.Minute), time.Minute))
+		})
+
+		It("should use the configured server default", func(ctx SpecContext) {
+			env.UploadSrv.SetPresignExpiry(time.Hour)
+
+			resp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:         env.TestDatas3tName,
+				DataSize:            1024,
+				NumberOfDatapoints:  10,
+				FirstDatapointIndex: 0,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(presignedExpiry(resp.PresignedDataPutURL)).To(Equal("3600"))
+		})
+
+		It("should reject an expiry longer than seven days", func(ctx SpecContext) {
+			_, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:          env.TestDatas3tName,
+				DataSize:             1024,
+				NumberOfDatapoints:   10,
+				FirstDatapointIndex:  0,
+				PresignExpirySeconds: 7*24*60*60 + 1,
+			})
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		})
+
+		It("should reject a negative expiry", func(ctx SpecContext) {
+			_, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+				Datas3tName:          env.TestDatas3tName,
+				DataSize:             1024,
+				NumberOfDatapoints:   10,
+				FirstDatapointIndex:  0,
+				PresignExpirySeconds: -1,
+			})
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		})
+	})
 })
@@ -0,0 +1,192 @@
+package dataranges
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+)
+
+func (r *UploadDatarangeRequest) validateStream() error {
+	switch {
+	case r.DataSize != 0:
+		return ValidationError(fmt.Errorf("data_size is declared when completing a streamed upload"))
+	case r.NumberOfDatapoints != 0:
+		return ValidationError(fmt.Errorf("number_of_datapoints is declared when completing a streamed upload"))
+	case r.FirstDatapointIndex != 0:
+		return ValidationError(fmt.Errorf("first_datapoint_index is declared when completing a streamed upload"))
+	case r.Append:
+		return ValidationError(fmt.Errorf("streamed uploads cannot be appended"))
+	case r.LeaseDurationSeconds != 0:
+		return ValidationError(fmt.Errorf("streamed uploads cannot take a lease, their datapoint range is not known upfront"))
+	}
+
+	return validatePresignExpiry(r.PresignExpirySeconds)
+}
+
+// streamedObjectKeys returns the keys the objects of a streamed upload are uploaded to
+// until the datapoint range is known
+func streamedObjectKeys(keyPrefix, datas3tName string, uploadCounter int64) (string, string) {
+	prefix := fmt.Sprintf("%sdatas3t/%s/uploads/%012d", keyPrefix, datas3tName, uploadCounter)
+	return prefix + ".tar", prefix + ".index"
+}
+
+// startStreamedUpload creates a multipart upload of unknown size. The data and index are
+// uploaded to staging keys and moved to the keys of the datarange on completion.
+func (s *UploadDatarangeServer) startStreamedUpload(ctx context.Context, store storage.ObjectStore, datas3t postgresstore.GetDatas3tWithBucketRow, req *UploadDatarangeRequest) (_ *UploadDatarangeResponse, err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := postgresstore.New(tx)
+
+	uploadCounter, err := queries.IncrementUploadCounter(ctx, datas3t.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to increment upload counter: %w", err)
+	}
+
+	objectKey, indexObjectKey := streamedObjectKeys(datas3t.KeyPrefix, req.Datas3tName, uploadCounter)
+
+	uploadID, err := store.CreateMultipartUpload(ctx, objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			store.AbortMultipartUpload(ctx, objectKey, uploadID)
+		}
+	}()
+
+	expiry := s.presignExpiryFor(req.PresignExpirySeconds)
+	expiresAt := time.Now().Add(expiry)
+
+	presignedIndex, err := s.generatePresignedPutURL(ctx, store, indexObjectKey, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate index upload URL: %w", err)
+	}
+
+	uploadRecordID, err := queries.CreateDatarangeUpload(ctx, postgresstore.CreateDatarangeUploadParams{
+		Datas3tID:      datas3t.ID,
+		UploadID:       uploadID,
+		DataObjectKey:  objectKey,
+		IndexObjectKey: indexObjectKey,
+		Streamed:       true,
+		WrappedDataKey: req.WrappedDataKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create datarange upload: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &UploadDatarangeResponse{
+		DatarangeID:           uploadRecordID,
+		ObjectKey:             objectKey,
+		PresignedIndexPutURL:  presignedIndex.URL,
+		PresignedURLsExpireAt: expiresAt,
+		PutHeaders:            presignedIndex.Headers,
+	}, nil
+}
+
+// declareStreamedUpload takes the size and datapoint range of a streamed upload from the
+// completion request. Other uploads cannot declare them.
+func declareStreamedUpload(req *CompleteUploadRequest, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow) (postgresstore.GetDatarangeUploadWithDetailsRow, error) {
+	if !uploadDetails.Streamed {
+		if req.DataSize != 0 || req.NumberOfDatapoints != 0 || req.FirstDatapointIndex != 0 {
+			return uploadDetails, ValidationError(fmt.Errorf("data_size, number_of_datapoints and first_datapoint_index can only be declared for streamed uploads"))
+		}
+		return uploadDetails, nil
+	}
+
+	if req.DataSize == 0 {
+		return uploadDetails, ValidationError(fmt.Errorf("data_size is required to complete a streamed upload"))
+	}
+
+	if req.NumberOfDatapoints == 0 {
+		return uploadDetails, ValidationError(fmt.Errorf("number_of_datapoints is required to complete a streamed upload"))
+	}
+
+	uploadDetails.DataSize = int64(req.DataSize)
+	uploadDetails.NumberOfDatapoints = int64(req.NumberOfDatapoints)
+	uploadDetails.FirstDatapointIndex = int64(req.FirstDatapointIndex)
+
+	return uploadDetails, nil
+}
+
+// moveStreamedUpload copies the completed objects of a streamed upload to the keys of its
+// datarange, records the declared range and schedules the staging objects for deletion.
+// It returns the upload with the keys of the moved objects.
+func (s *UploadDatarangeServer) moveStreamedUpload(ctx context.Context, queries *postgresstore.Queries, store storage.ObjectStore, uploadDetails postgresstore.GetDatarangeUploadWithDetailsRow) (postgresstore.GetDatarangeUploadWithDetailsRow, error) {
+	uploadCounter, err := queries.IncrementUploadCounter(ctx, uploadDetails.Datas3tID)
+	if err != nil {
+		return uploadDetails, fmt.Errorf("failed to increment upload counter: %w", err)
+	}
+
+	objectKey, indexObjectKey := datarangeObjectKeys(
+		uploadDetails.KeyPrefix,
+		uploadDetails.Datas3tName,
+		uint64(uploadDetails.FirstDatapointIndex),
+		uint64(uploadDetails.NumberOfDatapoints),
+		uploadCounter,
+	)
+
+	err = store.CopyObject(ctx, uploadDetails.DataObjectKey, objectKey, uploadDetails.DataSize)
+	if err != nil {
+		return uploadDetails, fmt.Errorf("failed to copy data object: %w", err)
+	}
+
+	err = store.CopyObject(ctx, uploadDetails.IndexObjectKey, indexObjectKey, 0)
+	if err != nil {
+		return uploadDetails, fmt.Errorf("failed to copy index object: %w", err)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return uploadDetails, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txQueries := queries.WithTx(tx)
+
+	err = txQueries.DeclareStreamedDatarangeUpload(ctx, postgresstore.DeclareStreamedDatarangeUploadParams{
+		ID:                  uploadDetails.ID,
+		FirstDatapointIndex: uploadDetails.FirstDatapointIndex,
+		NumberOfDatapoints:  uploadDetails.NumberOfDatapoints,
+		DataSize:            uploadDetails.DataSize,
+		DataObjectKey:       objectKey,
+		IndexObjectKey:      indexObjectKey,
+	})
+	if err != nil {
+		return uploadDetails, fmt.Errorf("failed to record streamed upload: %w", err)
+	}
+
+	for _, key := range []string{uploadDetails.DataObjectKey, uploadDetails.IndexObjectKey} {
+		deleteURL, err := store.PresignDeleteObject(ctx, key, 24*time.Hour)
+		if err != nil {
+			return uploadDetails, fmt.Errorf("failed to presign staging object delete: %w", err)
+		}
+
+		err = txQueries.ScheduleKeyForDeletion(ctx, deleteURL)
+		if err != nil {
+			return uploadDetails, fmt.Errorf("failed to schedule staging object deletion: %w", err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return uploadDetails, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	uploadDetails.DataObjectKey = objectKey
+	uploadDetails.IndexObjectKey = indexObjectKey
+
+	return uploadDetails, nil
+}
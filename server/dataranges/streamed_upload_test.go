@@ -0,0 +1,273 @@
+package dataranges_test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/server/dataranges"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Streamed datarange uploads", func() {
+	var env *TestEnvironment
+
+	BeforeEach(func(ctx SpecContext) {
+		env = SetupTestEnvironment(ctx)
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		env.TeardownTestEnvironment(ctx)
+	})
+
+	startStream := func(ctx SpecContext) *dataranges.UploadDatarangeResponse {
+		resp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+			Datas3tName: env.TestDatas3tName,
+			Stream:      true,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return resp
+	}
+
+	// uploadStream uploads tarData as a single part and the index of the archive
+	uploadStream := func(ctx SpecContext, uploadResp *dataranges.UploadDatarangeResponse, tarData, indexData []byte) string {
+		partsResp, err := env.UploadSrv.PresignUploadParts(ctx, env.Logger, &dataranges.PresignUploadPartsRequest{
+			DatarangeUploadID: uploadResp.DatarangeID,
+			FirstPartNumber:   1,
+			NumberOfParts:     1,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := HttpPut(partsResp.PresignedPartURLs[0].URL, bytes.NewReader(tarData))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		etag := resp.Header.Get("ETag")
+
+		resp, err = HttpPut(uploadResp.PresignedIndexPutURL, bytes.NewReader(indexData))
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+
+		return etag
+	}
+
+	listObjectKeys := func(ctx SpecContext, prefix string) []string {
+		resp, err := env.S3Client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(env.TestBucketName),
+			Prefix: aws.String(prefix),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		var keys []string
+		for _, object := range resp.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+		return keys
+	}
+
+	It("should start a multipart upload without part URLs", func(ctx SpecContext) {
+		resp := startStream(ctx)
+
+		Expect(resp.UseDirectPut).To(BeFalse())
+		Expect(resp.PresignedMultipartUploadPutURLs).To(BeEmpty())
+		Expect(resp.PresignedIndexPutURL).NotTo(BeEmpty())
+		Expect(resp.ObjectKey).To(HavePrefix(fmt.Sprintf("datas3t/%s/uploads/", env.TestDatas3tName)))
+	})
+
+	It("should presign part URLs on demand", func(ctx SpecContext) {
+		uploadResp := startStream(ctx)
+
+		resp, err := env.UploadSrv.PresignUploadParts(ctx, env.Logger, &dataranges.PresignUploadPartsRequest{
+			DatarangeUploadID: uploadResp.DatarangeID,
+			FirstPartNumber:   3,
+			NumberOfParts:     5,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(resp.PresignedPartURLs).To(HaveLen(5))
+		for i, part := range resp.PresignedPartURLs {
+			Expect(part.PartNumber).To(Equal(int32(3 + i)))
+			Expect(part.URL).To(ContainSubstring(fmt.Sprintf("partNumber=%d", 3+i)))
+		}
+	})
+
+	It("should reject part numbers beyond the multipart upload limit", func(ctx SpecContext) {
+		uploadResp := startStream(ctx)
+
+		_, err := env.UploadSrv.PresignUploadParts(ctx, env.Logger, &dataranges.PresignUploadPartsRequest{
+			DatarangeUploadID: uploadResp.DatarangeID,
+			FirstPartNumber:   dataranges.MaxParts,
+			NumberOfParts:     2,
+		})
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+
+	It("should not presign parts of a direct PUT upload", func(ctx SpecContext) {
+		uploadResp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+			Datas3tName:        env.TestDatas3tName,
+			DataSize:           1024,
+			NumberOfDatapoints: 10,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = env.UploadSrv.PresignUploadParts(ctx, env.Logger, &dataranges.PresignUploadPartsRequest{
+			DatarangeUploadID: uploadResp.DatarangeID,
+			FirstPartNumber:   1,
+			NumberOfParts:     1,
+		})
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+
+	It("should reject a streamed upload that declares its size upfront", func(ctx SpecContext) {
+		_, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+			Datas3tName:        env.TestDatas3tName,
+			DataSize:           1024,
+			NumberOfDatapoints: 10,
+			Stream:             true,
+		})
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+
+	It("should complete with the declared size and move the objects to the datarange keys", func(ctx SpecContext) {
+		uploadResp := startStream(ctx)
+		tarData, indexData := CreateProperTarWithIndex(10, 100)
+		etag := uploadStream(ctx, uploadResp, tarData, indexData)
+
+		err := env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, &dataranges.CompleteUploadRequest{
+			DatarangeUploadID:   uploadResp.DatarangeID,
+			UploadIDs:           []string{etag},
+			DataSize:            uint64(len(tarData)),
+			FirstDatapointIndex: 100,
+			NumberOfDatapoints:  10,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		all, err := env.Queries.GetAllDataranges(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(HaveLen(1))
+		Expect(all[0].MinDatapointKey).To(Equal(int64(100)))
+		Expect(all[0].MaxDatapointKey).To(Equal(int64(109)))
+		Expect(all[0].SizeBytes).To(Equal(int64(len(tarData))))
+
+		keys := listObjectKeys(ctx, fmt.Sprintf("datas3t/%s/dataranges/", env.TestDatas3tName))
+		Expect(keys).To(HaveLen(2))
+		for _, key := range keys {
+			Expect(key).To(ContainSubstring(fmt.Sprintf("%020d-%020d-", 100, 109)))
+		}
+
+		object, err := env.S3Client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(env.TestBucketName),
+			Key:    aws.String(keys[slices.IndexFunc(keys, func(key string) bool { return strings.HasSuffix(key, ".tar") })]),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer object.Body.Close()
+
+		var downloaded bytes.Buffer
+		_, err = downloaded.ReadFrom(object.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(downloaded.Bytes()).To(Equal(tarData))
+	})
+
+	It("should require the size and datapoint range to complete", func(ctx SpecContext) {
+		uploadResp := startStream(ctx)
+
+		err := env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, &dataranges.CompleteUploadRequest{
+			DatarangeUploadID: uploadResp.DatarangeID,
+		})
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+
+	It("should reject a declared range that overlaps an existing datarange", func(ctx SpecContext) {
+		env.CreateCompletedDatarange(ctx, 105, 10)
+
+		uploadResp := startStream(ctx)
+		tarData, indexData := CreateProperTarWithIndex(10, 100)
+		etag := uploadStream(ctx, uploadResp, tarData, indexData)
+
+		err := env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, &dataranges.CompleteUploadRequest{
+			DatarangeUploadID:   uploadResp.DatarangeID,
+			UploadIDs:           []string{etag},
+			DataSize:            uint64(len(tarData)),
+			FirstDatapointIndex: 100,
+			NumberOfDatapoints:  10,
+		})
+		Expect(err).To(MatchError(apierror.ErrDatarangeOverlap))
+	})
+
+	It("should only complete the first of concurrent streamed uploads of the same range", func(ctx SpecContext) {
+		tarData, indexData := CreateProperTarWithIndex(10, 100)
+
+		requests := make([]*dataranges.CompleteUploadRequest, 2)
+		for i := range requests {
+			uploadResp := startStream(ctx)
+			etag := uploadStream(ctx, uploadResp, tarData, indexData)
+			requests[i] = &dataranges.CompleteUploadRequest{
+				DatarangeUploadID:   uploadResp.DatarangeID,
+				UploadIDs:           []string{etag},
+				DataSize:            uint64(len(tarData)),
+				FirstDatapointIndex: 100,
+				NumberOfDatapoints:  10,
+			}
+		}
+
+		errs := make([]error, len(requests))
+		var wg sync.WaitGroup
+		for i, req := range requests {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, req)
+			}()
+		}
+		wg.Wait()
+
+		Expect(errs).To(ContainElement(BeNil()))
+		Expect(errs).To(ContainElement(MatchError(apierror.ErrDatarangeOverlap)))
+
+		count, err := env.Queries.CountDataranges(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(int64(1)))
+	})
+
+	It("should fail when the declared size does not match the uploaded data", func(ctx SpecContext) {
+		uploadResp := startStream(ctx)
+		tarData, indexData := CreateProperTarWithIndex(10, 100)
+		etag := uploadStream(ctx, uploadResp, tarData, indexData)
+
+		err := env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, &dataranges.CompleteUploadRequest{
+			DatarangeUploadID:   uploadResp.DatarangeID,
+			UploadIDs:           []string{etag},
+			DataSize:            uint64(len(tarData)) + 512,
+			FirstDatapointIndex: 100,
+			NumberOfDatapoints:  10,
+		})
+		Expect(err).To(MatchError(apierror.ErrUploadValidationFailed))
+
+		count, err := env.Queries.CountDataranges(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(count).To(Equal(int64(0)))
+	})
+
+	It("should reject declared values when completing an upload that is not streamed", func(ctx SpecContext) {
+		uploadResp, err := env.UploadSrv.StartDatarangeUpload(ctx, env.Logger, &dataranges.UploadDatarangeRequest{
+			Datas3tName:        env.TestDatas3tName,
+			DataSize:           1024,
+			NumberOfDatapoints: 10,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = env.UploadSrv.CompleteDatarangeUpload(ctx, env.Logger, &dataranges.CompleteUploadRequest{
+			DatarangeUploadID: uploadResp.DatarangeID,
+			DataSize:          1024,
+		})
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+})
@@ -13,10 +13,12 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/crypto"
 	"github.com/draganm/datas3t/postgresstore"
 	"github.com/draganm/datas3t/server/bucket"
 	"github.com/draganm/datas3t/server/dataranges"
 	"github.com/draganm/datas3t/server/datas3t"
+	"github.com/draganm/datas3t/storage"
 	"github.com/draganm/datas3t/tarindex"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -150,13 +152,15 @@ func SetupTestEnvironment(ctx SpecContext) *TestEnvironment {
 	Expect(err).NotTo(HaveOccurred())
 
 	// Create server instances
-	env.UploadSrv, err = dataranges.NewServer(env.DB, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+	encryptor, err := crypto.NewCredentialEncryptor("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
 	Expect(err).NotTo(HaveOccurred())
-	env.BucketSrv, err = bucket.NewServer(env.DB, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-	Expect(err).NotTo(HaveOccurred())
-	env.Datas3tSrv, err = datas3t.NewServer(env.DB, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+	opener, err := storage.NewOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==", encryptor)
 	Expect(err).NotTo(HaveOccurred())
 
+	env.UploadSrv = dataranges.NewServer(env.DB, opener)
+	env.BucketSrv = bucket.NewServer(env.DB, encryptor, opener)
+	env.Datas3tSrv = datas3t.NewServer(env.DB, opener)
+
 	// Add test bucket configuration
 	bucketInfo := &bucket.BucketInfo{
 		Name:      env.TestBucketConfigName,
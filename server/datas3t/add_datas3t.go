@@ -6,17 +6,26 @@ import (
 	"log/slog"
 	"regexp"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
 )
 
 type AddDatas3tRequest struct {
 	Name   string `json:"name"`
 	Bucket string `json:"bucket"`
+
+	// Encrypted requires the content of every datapoint to be encrypted by the clients
+	// with a data key of its datarange, see WrappedDataKey of the upload requests. It
+	// cannot be changed once the datas3t exists.
+	Encrypted bool `json:"encrypted,omitempty"`
 }
 
 var datas3tNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 
-type ValidationError error
+// ValidationError marks err as a validation failure of the request
+func ValidationError(err error) error {
+	return apierror.Wrap(apierror.CodeValidationFailed, err)
+}
 
 func (r *AddDatas3tRequest) Validate(ctx context.Context) error {
 	if r.Bucket == "" {
@@ -35,7 +44,7 @@ func (r *AddDatas3tRequest) Validate(ctx context.Context) error {
 
 func (s *Datas3tServer) AddDatas3t(ctx context.Context, log *slog.Logger, req *AddDatas3tRequest) (err error) {
 
-	log = log.With("bucket", req.Bucket, "name", req.Name)
+	log = log.With("bucket", req.Bucket, "name", req.Name, "encrypted", req.Encrypted)
 	log.Info("Adding datas3t")
 
 	defer func() {
@@ -60,14 +69,18 @@ func (s *Datas3tServer) AddDatas3t(ctx context.Context, log *slog.Logger, req *A
 	}
 
 	if !bucketExists {
-		return fmt.Errorf("bucket '%s' does not exist", req.Bucket)
+		return apierror.New(apierror.CodeBucketNotFound, "bucket '%s' does not exist", req.Bucket)
 	}
 
 	err = queries.AddDatas3t(ctx, postgresstore.AddDatas3tParams{
 		Datas3tName: req.Name,
 		BucketName:  req.Bucket,
+		Encrypted:   req.Encrypted,
 	})
 
+	if postgresstore.IsUniqueViolation(err) {
+		return apierror.New(apierror.CodeDatas3tAlreadyExists, "failed to add datas3t: datas3t '%s' already exists", req.Name)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to add datas3t: %w", err)
 	}
@@ -115,10 +115,9 @@ var _ = Describe("AddDatas3t", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		// Create server instances
-		srv, err = datas3t.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
-		bucketSrv, err = bucket.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
+		encryptor, opener := newOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		srv = datas3t.NewServer(db, opener)
+		bucketSrv = bucket.NewServer(db, encryptor, opener)
 
 		// Add a test bucket configuration that datasets can use
 		bucketInfo := &bucket.BucketInfo{
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"slices"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
 )
 
@@ -60,7 +61,7 @@ func (s *Datas3tServer) ClearDatas3t(ctx context.Context, log *slog.Logger, req
 		return nil, fmt.Errorf("failed to check if datas3t exists: %w", err)
 	}
 	if !datas3tExists {
-		return nil, fmt.Errorf("datas3t '%s' does not exist", req.Name)
+		return nil, apierror.New(apierror.CodeDatas3tNotFound, "datas3t '%s' does not exist", req.Name)
 	}
 
 	// 2. Get all dataranges for this datas3t
@@ -158,8 +159,14 @@ func (s *Datas3tServer) deleteDatarangesFromDatabase(ctx context.Context, querie
 		datarangeIDs[i] = datarange.ID
 	}
 
+	// Their copies in the replica of the datas3t go with them
+	err := queries.ScheduleDatarangeReplicasForDeletion(ctx, datarangeIDs)
+	if err != nil {
+		return fmt.Errorf("failed to schedule replicated objects for deletion: %w", err)
+	}
+
 	// Delete all dataranges in a single operation
-	err := queries.DeleteDatarangesByIDs(ctx, datarangeIDs)
+	err = queries.DeleteDatarangesByIDs(ctx, datarangeIDs)
 	if err != nil {
 		return fmt.Errorf("failed to delete dataranges: %w", err)
 	}
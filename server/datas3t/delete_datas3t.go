@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
 )
 
@@ -56,7 +57,7 @@ func (s *Datas3tServer) DeleteDatas3t(ctx context.Context, log *slog.Logger, req
 		return nil, fmt.Errorf("failed to check if datas3t exists: %w", err)
 	}
 	if !datas3tExists {
-		return nil, fmt.Errorf("datas3t '%s' does not exist", req.Name)
+		return nil, apierror.New(apierror.CodeDatas3tNotFound, "datas3t '%s' does not exist", req.Name)
 	}
 
 	// 2. Check if datas3t has any dataranges
@@ -67,7 +68,7 @@ func (s *Datas3tServer) DeleteDatas3t(ctx context.Context, log *slog.Logger, req
 
 	if datarangeCount > 0 {
 		log.Info("Cannot delete datas3t with existing dataranges", "datarange_count", datarangeCount)
-		return nil, fmt.Errorf("cannot delete datas3t '%s': it contains %d dataranges. Use 'clear' command first to remove all dataranges", req.Name, datarangeCount)
+		return nil, apierror.New(apierror.CodeDatas3tNotEmpty, "cannot delete datas3t '%s': it contains %d dataranges. Use 'clear' command first to remove all dataranges", req.Name, datarangeCount)
 	}
 
 	// 3. Delete the datas3t record
@@ -116,10 +116,9 @@ var _ = Describe("DeleteDatas3t", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		// Create server instances
-		srv, err = datas3t.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
-		bucketSrv, err = bucket.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
+		encryptor, opener := newOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		srv = datas3t.NewServer(db, opener)
+		bucketSrv = bucket.NewServer(db, encryptor, opener)
 
 		// Add a test bucket configuration
 		bucketInfo := &bucket.BucketInfo{
@@ -166,7 +165,7 @@ var _ = Describe("DeleteDatas3t", func() {
 			Expect(resp).NotTo(BeNil())
 
 			// Verify datas3t no longer exists
-			listResp, err := srv.ListDatas3ts(ctx, logger)
+			listResp, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			found := false
 			for _, d := range listResp {
@@ -229,7 +228,7 @@ var _ = Describe("DeleteDatas3t", func() {
 			Expect(deleteResp).NotTo(BeNil())
 
 			// Verify datas3t no longer exists
-			listResp, err := srv.ListDatas3ts(ctx, logger)
+			listResp, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			found := false
 			for _, d := range listResp {
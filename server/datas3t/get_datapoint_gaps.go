@@ -0,0 +1,89 @@
+package datas3t
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/jackc/pgx/v5"
+)
+
+type DatapointGap struct {
+	FirstDatapointKey int64 `json:"first_datapoint_key"`
+	LastDatapointKey  int64 `json:"last_datapoint_key"`
+	MissingDatapoints int64 `json:"missing_datapoints"`
+}
+
+type GetDatapointGapsResponse struct {
+	Datas3tName       string         `json:"datas3t_name"`
+	DatarangeCount    int64          `json:"datarange_count"`
+	LowestDatapoint   int64          `json:"lowest_datapoint"`
+	HighestDatapoint  int64          `json:"highest_datapoint"`
+	MissingDatapoints int64          `json:"missing_datapoints"`
+	Gaps              []DatapointGap `json:"gaps"`
+}
+
+// GetDatapointGaps returns the intervals of datapoint keys between the lowest and
+// the highest stored datapoint that are not covered by any datarange.
+func (s *Datas3tServer) GetDatapointGaps(ctx context.Context, log *slog.Logger, datas3tName string) (*GetDatapointGapsResponse, error) {
+	log = log.With("datas3t_name", datas3tName)
+	log.Info("Getting datapoint gaps")
+
+	if datas3tName == "" {
+		return nil, ValidationError(fmt.Errorf("datas3t_name is required"))
+	}
+
+	// Read the key range and the gaps from the same snapshot
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly, IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := postgresstore.New(tx)
+
+	_, err = queries.GetDatas3tIDByName(ctx, datas3tName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeDatas3tNotFound, "datas3t '%s' does not exist", datas3tName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datas3t: %w", err)
+	}
+
+	keyRange, err := queries.GetDatapointKeyRange(ctx, datas3tName)
+	if err != nil {
+		log.Error("Failed to get datapoint key range", "error", err)
+		return nil, fmt.Errorf("failed to get datapoint key range: %w", err)
+	}
+
+	rows, err := queries.GetDatapointGaps(ctx, datas3tName)
+	if err != nil {
+		log.Error("Failed to get datapoint gaps", "error", err)
+		return nil, fmt.Errorf("failed to get datapoint gaps: %w", err)
+	}
+
+	response := &GetDatapointGapsResponse{
+		Datas3tName:      datas3tName,
+		DatarangeCount:   keyRange.DatarangeCount,
+		LowestDatapoint:  keyRange.LowestDatapoint,
+		HighestDatapoint: keyRange.HighestDatapoint,
+		Gaps:             make([]DatapointGap, 0, len(rows)),
+	}
+
+	for _, row := range rows {
+		gap := DatapointGap{
+			FirstDatapointKey: row.FirstMissingKey,
+			LastDatapointKey:  row.LastMissingKey,
+			MissingDatapoints: row.LastMissingKey - row.FirstMissingKey + 1,
+		}
+		response.MissingDatapoints += gap.MissingDatapoints
+		response.Gaps = append(response.Gaps, gap)
+	}
+
+	log.Info("Datapoint gaps computed", "gap_count", len(response.Gaps), "missing_datapoints", response.MissingDatapoints)
+
+	return response, nil
+}
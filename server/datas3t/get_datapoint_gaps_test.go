@@ -0,0 +1,259 @@
+package datas3t_test
+
+import (
+	"log"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/bucket"
+	"github.com/draganm/datas3t/server/datas3t"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgxpool"
+	miniogo "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/minio"
+	tc_postgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var _ = Describe("GetDatapointGaps", func() {
+	var (
+		pgContainer          *tc_postgres.PostgresContainer
+		minioContainer       *minio.MinioContainer
+		db                   *pgxpool.Pool
+		srv                  *datas3t.Datas3tServer
+		bucketSrv            *bucket.BucketServer
+		minioEndpoint        string
+		minioHost            string
+		minioAccessKey       string
+		minioSecretKey       string
+		testBucketName       string
+		testBucketConfigName string
+		logger               *slog.Logger
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+
+		logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+
+		// Start PostgreSQL container
+		pgContainer, err = tc_postgres.Run(ctx,
+			"postgres:16-alpine",
+			tc_postgres.WithDatabase("testdb"),
+			tc_postgres.WithUsername("testuser"),
+			tc_postgres.WithPassword("testpass"),
+			testcontainers.WithWaitStrategy(
+				wait.ForLog("database system is ready to accept connections").
+					WithOccurrence(2).
+					WithStartupTimeout(30*time.Second),
+			),
+			testcontainers.WithLogger(log.New(GinkgoWriter, "", 0)),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Get PostgreSQL connection string
+		connStr, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Connect to PostgreSQL
+		db, err = pgxpool.New(ctx, connStr)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Run migrations
+		connStrForMigration, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
+		Expect(err).NotTo(HaveOccurred())
+
+		m, err := migrate.New(
+			"file://../../postgresstore/migrations",
+			connStrForMigration)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = m.Up()
+		if err != nil && err != migrate.ErrNoChange {
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// Start MinIO container
+		minioContainer, err = minio.Run(ctx,
+			"minio/minio:RELEASE.2024-01-16T16-07-38Z",
+			minio.WithUsername("minioadmin"),
+			minio.WithPassword("minioadmin"),
+			testcontainers.WithLogger(log.New(GinkgoWriter, "", 0)),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Get MinIO connection details
+		minioEndpoint, err = minioContainer.ConnectionString(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Extract host:port from the full URL
+		minioHost = strings.TrimPrefix(minioEndpoint, "http://")
+		minioHost = strings.TrimPrefix(minioHost, "https://")
+
+		minioAccessKey = "minioadmin"
+		minioSecretKey = "minioadmin"
+		testBucketName = "test-bucket"
+		testBucketConfigName = "test-bucket-config"
+
+		// Create test bucket in MinIO
+		minioClient, err := miniogo.New(minioHost, &miniogo.Options{
+			Creds:  credentials.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+			Secure: false,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = minioClient.MakeBucket(ctx, testBucketName, miniogo.MakeBucketOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Create server instances
+		encryptor, opener := newOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		srv = datas3t.NewServer(db, opener)
+		bucketSrv = bucket.NewServer(db, encryptor, opener)
+
+		// Add a test bucket configuration that datasets can use
+		bucketInfo := &bucket.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		}
+
+		err = bucketSrv.AddBucket(ctx, logger, bucketInfo)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		if db != nil {
+			db.Close()
+		}
+		if pgContainer != nil {
+			err := pgContainer.Terminate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		if minioContainer != nil {
+			err := minioContainer.Terminate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	addDatarange := func(ctx SpecContext, datas3tName string, minKey, maxKey int64) {
+		queries := postgresstore.New(db)
+		dataset, err := queries.GetDatas3tWithBucket(ctx, datas3tName)
+		Expect(err).NotTo(HaveOccurred())
+
+		_, err = queries.CreateDatarange(ctx, postgresstore.CreateDatarangeParams{
+			Datas3tID:       dataset.ID,
+			DataObjectKey:   "data",
+			IndexObjectKey:  "index",
+			MinDatapointKey: minKey,
+			MaxDatapointKey: maxKey,
+			SizeBytes:       1000,
+		})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func(ctx SpecContext) {
+		err := srv.AddDatas3t(ctx, logger, &datas3t.AddDatas3tRequest{
+			Bucket: testBucketConfigName,
+			Name:   "test-dataset",
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should report no gaps for a datas3t without dataranges", func(ctx SpecContext) {
+		resp, err := srv.GetDatapointGaps(ctx, logger, "test-dataset")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.DatarangeCount).To(Equal(int64(0)))
+		Expect(resp.Gaps).To(BeEmpty())
+		Expect(resp.MissingDatapoints).To(Equal(int64(0)))
+	})
+
+	It("should report no gaps for contiguous dataranges", func(ctx SpecContext) {
+		addDatarange(ctx, "test-dataset", 0, 99)
+		addDatarange(ctx, "test-dataset", 100, 199)
+
+		resp, err := srv.GetDatapointGaps(ctx, logger, "test-dataset")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.LowestDatapoint).To(Equal(int64(0)))
+		Expect(resp.HighestDatapoint).To(Equal(int64(199)))
+		Expect(resp.Gaps).To(BeEmpty())
+	})
+
+	It("should report the missing intervals between the lowest and highest datapoint", func(ctx SpecContext) {
+		addDatarange(ctx, "test-dataset", 10, 19)
+		addDatarange(ctx, "test-dataset", 50, 59)
+		addDatarange(ctx, "test-dataset", 20, 29)
+		addDatarange(ctx, "test-dataset", 61, 61)
+
+		resp, err := srv.GetDatapointGaps(ctx, logger, "test-dataset")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.DatarangeCount).To(Equal(int64(4)))
+		Expect(resp.LowestDatapoint).To(Equal(int64(10)))
+		Expect(resp.HighestDatapoint).To(Equal(int64(61)))
+		Expect(resp.Gaps).To(Equal([]datas3t.DatapointGap{
+			{FirstDatapointKey: 30, LastDatapointKey: 49, MissingDatapoints: 20},
+			{FirstDatapointKey: 60, LastDatapointKey: 60, MissingDatapoints: 1},
+		}))
+		Expect(resp.MissingDatapoints).To(Equal(int64(21)))
+	})
+
+	It("should not report gaps covered by an earlier, longer datarange", func(ctx SpecContext) {
+		addDatarange(ctx, "test-dataset", 0, 100)
+		addDatarange(ctx, "test-dataset", 10, 20)
+		addDatarange(ctx, "test-dataset", 50, 60)
+		addDatarange(ctx, "test-dataset", 105, 110)
+
+		resp, err := srv.GetDatapointGaps(ctx, logger, "test-dataset")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Gaps).To(Equal([]datas3t.DatapointGap{
+			{FirstDatapointKey: 101, LastDatapointKey: 104, MissingDatapoints: 4},
+		}))
+	})
+
+	It("should return datas3t_not_found for an unknown datas3t", func(ctx SpecContext) {
+		_, err := srv.GetDatapointGaps(ctx, logger, "non-existent")
+		Expect(err).To(MatchError(apierror.ErrDatas3tNotFound))
+	})
+
+	It("should reject an empty datas3t name", func(ctx SpecContext) {
+		_, err := srv.GetDatapointGaps(ctx, logger, "")
+		Expect(err).To(MatchError(apierror.ErrValidationFailed))
+	})
+
+	Context("GetDatapointsBitmap", func() {
+		It("should contain exactly the datapoints of all dataranges", func(ctx SpecContext) {
+			addDatarange(ctx, "test-dataset", 10, 19)
+			addDatarange(ctx, "test-dataset", 30, 30)
+
+			bitmap, err := srv.GetDatapointsBitmap(ctx, logger, "test-dataset")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bitmap.GetCardinality()).To(Equal(uint64(11)))
+			Expect(bitmap.Contains(9)).To(BeFalse())
+			Expect(bitmap.Contains(10)).To(BeTrue())
+			Expect(bitmap.Contains(19)).To(BeTrue())
+			Expect(bitmap.Contains(20)).To(BeFalse())
+			Expect(bitmap.Contains(30)).To(BeTrue())
+		})
+
+		It("should handle dataranges with billions of datapoints", func(ctx SpecContext) {
+			addDatarange(ctx, "test-dataset", 0, 4_999_999_999)
+			addDatarange(ctx, "test-dataset", math.MaxInt64-9, math.MaxInt64)
+
+			bitmap, err := srv.GetDatapointsBitmap(ctx, logger, "test-dataset")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bitmap.GetCardinality()).To(Equal(uint64(5_000_000_010)))
+			Expect(bitmap.Contains(math.MaxInt64)).To(BeTrue())
+		}, SpecTimeout(time.Minute))
+	})
+})
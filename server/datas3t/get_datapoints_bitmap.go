@@ -18,7 +18,7 @@ func (s *Datas3tServer) GetDatapointsBitmap(ctx context.Context, log *slog.Logge
 	}()
 
 	if datas3tName == "" {
-		return nil, fmt.Errorf("datas3t_name is required")
+		return nil, ValidationError(fmt.Errorf("datas3t_name is required"))
 	}
 
 	queries := postgresstore.New(s.db)
@@ -33,12 +33,10 @@ func (s *Datas3tServer) GetDatapointsBitmap(ctx context.Context, log *slog.Logge
 	// Create a new roaring bitmap
 	bitmap := roaring64.New()
 
-	// Add all datapoints from each datarange to the bitmap
+	// Add the key range of each datarange to the bitmap. AddRange takes an
+	// exclusive end and works on whole containers instead of single keys.
 	for _, datarange := range dataranges {
-		// Add all datapoints from min_datapoint_key to max_datapoint_key (inclusive)
-		for datapoint := datarange.MinDatapointKey; datapoint <= datarange.MaxDatapointKey; datapoint++ {
-			bitmap.Add(uint64(datapoint))
-		}
+		bitmap.AddRange(uint64(datarange.MinDatapointKey), uint64(datarange.MaxDatapointKey)+1)
 	}
 
 	log.Info("Datapoints bitmap created",
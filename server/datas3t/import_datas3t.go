@@ -8,10 +8,9 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/apierror"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
 )
 
 type ImportDatas3tRequest struct {
@@ -23,7 +22,7 @@ type ImportDatas3tResponse struct {
 	ImportedCount    int      `json:"imported_count"`
 }
 
-// Regular expression to match datas3t datarange object keys
+// Regular expression to match datas3t datarange object keys below the key prefix of a bucket
 // Pattern: datas3t/{datas3t_name}/dataranges/{first_datapoint}-{last_datapoint}-{upload_counter}.tar
 var datarangeObjectKeyRegex = regexp.MustCompile(`^datas3t/([^/]+)/dataranges/(\d{20})-(\d{20})-(\d{12})\.tar$`)
 
@@ -60,22 +59,16 @@ func (s *Datas3tServer) ImportDatas3t(ctx context.Context, log *slog.Logger, req
 	}
 
 	if !bucketExists {
-		return nil, fmt.Errorf("bucket '%s' does not exist", req.BucketName)
+		return nil, apierror.New(apierror.CodeBucketNotFound, "bucket '%s' does not exist", req.BucketName)
 	}
 
-	// Get bucket credentials and create S3 client
-	bucketCredentials, err := queries.GetBucketCredentials(ctx, req.BucketName)
+	store, keyPrefix, err := s.openStoreForBucket(ctx, log, req.BucketName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get bucket credentials: %w", err)
-	}
-
-	s3Client, err := s.createS3ClientForBucket(ctx, log, req.BucketName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+		return nil, err
 	}
 
 	// Scan bucket for datas3t objects
-	discoveredDatas3ts, err := s.scanBucketForDatas3ts(ctx, log, s3Client, bucketCredentials.Bucket)
+	discoveredDatas3ts, err := s.scanBucketForDatas3ts(ctx, log, store, keyPrefix)
 	if err != nil {
 		return nil, fmt.Errorf("failed to scan bucket: %w", err)
 	}
@@ -103,98 +96,84 @@ type DatarangeInfo struct {
 	Size             int64
 }
 
-func (s *Datas3tServer) createS3ClientForBucket(ctx context.Context, log *slog.Logger, bucketName string) (*s3.Client, error) {
+// openStoreForBucket opens the object store of a bucket and returns it with the key prefix
+// of the bucket
+func (s *Datas3tServer) openStoreForBucket(ctx context.Context, log *slog.Logger, bucketName string) (storage.ObjectStore, string, error) {
 	queries := postgresstore.New(s.db)
 	
 	// Get bucket credentials directly
 	bucketCredentials, err := queries.GetBucketCredentials(ctx, bucketName)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get bucket credentials: %w", err)
+		return nil, "", fmt.Errorf("failed to get bucket credentials: %w", err)
 	}
 
-	// Decrypt credentials and create S3 client
-	accessKey, secretKey, err := s.encryptor.DecryptCredentials(bucketCredentials.AccessKey, bucketCredentials.SecretKey)
+	store, err := s.storage.Open(ctx, log, storage.Config{
+		Endpoint:        bucketCredentials.Endpoint,
+		Bucket:          bucketCredentials.Bucket,
+		AccessKey:       bucketCredentials.AccessKey,
+		SecretKey:       bucketCredentials.SecretKey,
+		SessionToken:    bucketCredentials.SessionToken,
+		Region:          bucketCredentials.Region,
+		AddressingStyle: bucketCredentials.AddressingStyle,
+		CredentialMode:  bucketCredentials.CredentialMode,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+		return nil, "", fmt.Errorf("failed to open object store: %w", err)
 	}
 
-	return awsutil.CreateS3Client(ctx, awsutil.S3ClientConfig{
-		AccessKey: accessKey,
-		SecretKey: secretKey,
-		Endpoint:  bucketCredentials.Endpoint,
-		Logger:    log,
-	})
+	return store, bucketCredentials.KeyPrefix, nil
 }
 
-func (s *Datas3tServer) scanBucketForDatas3ts(ctx context.Context, log *slog.Logger, s3Client *s3.Client, bucketName string) (map[string][]DatarangeInfo, error) {
+func (s *Datas3tServer) scanBucketForDatas3ts(ctx context.Context, log *slog.Logger, store storage.ObjectStore, keyPrefix string) (map[string][]DatarangeInfo, error) {
 	discoveredDatas3ts := make(map[string][]DatarangeInfo)
 
-	// List all objects in the bucket with the datas3t prefix
-	listObjectsInput := &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucketName),
-		Prefix: aws.String("datas3t/"),
-	}
+	// List all objects in the bucket with the datas3t prefix below the key prefix
+	err := store.ListObjects(ctx, keyPrefix+"datas3t/", func(obj storage.ObjectInfo) error {
+		objectKey := obj.Key
 
-	paginator := s3.NewListObjectsV2Paginator(s3Client, listObjectsInput)
+		// Check if this is a datarange TAR file
+		matches := datarangeObjectKeyRegex.FindStringSubmatch(strings.TrimPrefix(objectKey, keyPrefix))
+		if matches == nil {
+			return nil // Not a datarange file
+		}
 
-	for paginator.HasMorePages() {
-		page, err := paginator.NextPage(ctx)
+		datas3tName := matches[1]
+		firstDatapoint, err := strconv.ParseInt(matches[2], 10, 64)
 		if err != nil {
-			return nil, fmt.Errorf("failed to list objects: %w", err)
+			log.Warn("Failed to parse first datapoint", "object_key", objectKey, "error", err)
+			return nil
 		}
 
-		for _, obj := range page.Contents {
-			if obj.Key == nil {
-				continue
-			}
-
-			objectKey := *obj.Key
-			
-			// Check if this is a datarange TAR file
-			matches := datarangeObjectKeyRegex.FindStringSubmatch(objectKey)
-			if matches == nil {
-				continue // Not a datarange file
-			}
-
-			datas3tName := matches[1]
-			firstDatapoint, err := strconv.ParseInt(matches[2], 10, 64)
-			if err != nil {
-				log.Warn("Failed to parse first datapoint", "object_key", objectKey, "error", err)
-				continue
-			}
-
-			lastDatapoint, err := strconv.ParseInt(matches[3], 10, 64)
-			if err != nil {
-				log.Warn("Failed to parse last datapoint", "object_key", objectKey, "error", err)
-				continue
-			}
-
-			uploadCounter, err := strconv.ParseInt(matches[4], 10, 64)
-			if err != nil {
-				log.Warn("Failed to parse upload counter", "object_key", objectKey, "error", err)
-				continue
-			}
-
-			// Generate the corresponding index object key
-			indexObjectKey := strings.Replace(objectKey, ".tar", ".index", 1)
-
-			var size int64
-			if obj.Size != nil {
-				size = *obj.Size
-			}
-
-			datarangeInfo := DatarangeInfo{
-				Datas3tName:      datas3tName,
-				DataObjectKey:    objectKey,
-				IndexObjectKey:   indexObjectKey,
-				FirstDatapoint:   firstDatapoint,
-				LastDatapoint:    lastDatapoint,
-				UploadCounter:    uploadCounter,
-				Size:             size,
-			}
-
-			discoveredDatas3ts[datas3tName] = append(discoveredDatas3ts[datas3tName], datarangeInfo)
+		lastDatapoint, err := strconv.ParseInt(matches[3], 10, 64)
+		if err != nil {
+			log.Warn("Failed to parse last datapoint", "object_key", objectKey, "error", err)
+			return nil
 		}
+
+		uploadCounter, err := strconv.ParseInt(matches[4], 10, 64)
+		if err != nil {
+			log.Warn("Failed to parse upload counter", "object_key", objectKey, "error", err)
+			return nil
+		}
+
+		// Generate the corresponding index object key
+		indexObjectKey := strings.TrimSuffix(objectKey, ".tar") + ".index"
+
+		datarangeInfo := DatarangeInfo{
+			Datas3tName:      datas3tName,
+			DataObjectKey:    objectKey,
+			IndexObjectKey:   indexObjectKey,
+			FirstDatapoint:   firstDatapoint,
+			LastDatapoint:    lastDatapoint,
+			UploadCounter:    uploadCounter,
+			Size:             obj.Size,
+		}
+
+		discoveredDatas3ts[datas3tName] = append(discoveredDatas3ts[datas3tName], datarangeInfo)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %w", err)
 	}
 
 	log.Info("Discovered datas3ts", "count", len(discoveredDatas3ts))
@@ -265,6 +244,13 @@ func (s *Datas3tServer) importSingleDatas3tInTransaction(ctx context.Context, lo
 		return false, fmt.Errorf("failed to get datas3t with bucket: %w", err)
 	}
 
+	// The wrapped data keys of encrypted dataranges are only stored in the database, the
+	// dataranges found in the bucket could not be decrypted
+	if datas3tWithBucket.Encrypted {
+		log.Warn("Skipping encrypted datas3t, the data keys of its dataranges cannot be recovered from the bucket")
+		return false, nil
+	}
+
 	// Track the maximum upload counter found in this datas3t
 	maxUploadCounter := int64(0)
 	for _, datarange := range dataranges {
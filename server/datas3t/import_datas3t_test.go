@@ -116,10 +116,9 @@ var _ = Describe("ImportDatas3t", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		// Create server instances
-		srv, err = datas3t.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
-		bucketSrv, err = bucket.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
+		encryptor, opener := newOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		srv = datas3t.NewServer(db, opener)
+		bucketSrv = bucket.NewServer(db, encryptor, opener)
 
 		// Add a test bucket configuration
 		bucketInfo := &bucket.BucketInfo{
@@ -227,7 +226,7 @@ var _ = Describe("ImportDatas3t", func() {
 			Expect(response.ImportedDatas3ts).To(ContainElements("test-dataset-1", "test-dataset-2"))
 
 			// Verify that the datas3ts were created in the database
-			datas3ts, err := srv.ListDatas3ts(ctx, logger)
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(datas3ts).To(HaveLen(2))
 
@@ -277,12 +276,60 @@ var _ = Describe("ImportDatas3t", func() {
 			Expect(response2.ImportedDatas3ts).To(BeEmpty())
 
 			// Verify database still has only 2 datasets
-			datas3ts, err := srv.ListDatas3ts(ctx, logger)
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(datas3ts).To(HaveLen(2))
 		})
 	})
 
+	Context("when the bucket has a key prefix", func() {
+		BeforeEach(func(ctx SpecContext) {
+			err := bucketSrv.AddBucket(ctx, logger, &bucket.BucketInfo{
+				Name:      "prefixed-bucket-config",
+				Endpoint:  minioEndpoint,
+				Bucket:    testBucketName,
+				AccessKey: minioAccessKey,
+				SecretKey: minioSecretKey,
+				KeyPrefix: "tenant-a/",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, key := range []string{
+				"tenant-a/datas3t/prefixed-dataset/dataranges/00000000000000000000-00000000000000000099-000000000001.tar",
+				"tenant-a/datas3t/prefixed-dataset/dataranges/00000000000000000000-00000000000000000099-000000000001.index",
+				"datas3t/unprefixed-dataset/dataranges/00000000000000000000-00000000000000000099-000000000001.tar",
+				"datas3t/unprefixed-dataset/dataranges/00000000000000000000-00000000000000000099-000000000001.index",
+			} {
+				_, err = minioClient.PutObject(ctx, testBucketName, key,
+					bytes.NewReader([]byte("test data")), 9, miniogo.PutObjectOptions{})
+				Expect(err).NotTo(HaveOccurred())
+			}
+		})
+
+		It("should only import the datas3ts below the key prefix", func(ctx SpecContext) {
+			response, err := srv.ImportDatas3t(ctx, logger, &datas3t.ImportDatas3tRequest{
+				BucketName: "prefixed-bucket-config",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.ImportedDatas3ts).To(ConsistOf("prefixed-dataset"))
+
+			response, err = srv.ImportDatas3t(ctx, logger, &datas3t.ImportDatas3tRequest{
+				BucketName: testBucketConfigName,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(response.ImportedDatas3ts).To(ConsistOf("unprefixed-dataset"))
+
+			// The keys of imported dataranges include the key prefix
+			queries := postgresstore.New(db)
+			dataranges, err := queries.GetDatarangesByDataObjectKeys(ctx, postgresstore.GetDatarangesByDataObjectKeysParams{
+				Datas3tName:    "prefixed-dataset",
+				DataObjectKeys: []string{"tenant-a/datas3t/prefixed-dataset/dataranges/00000000000000000000-00000000000000000099-000000000001.tar"},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(dataranges).To(HaveLen(1))
+		})
+	})
+
 	Context("when bucket doesn't exist", func() {
 		It("should return an error", func(ctx SpecContext) {
 			req := &datas3t.ImportDatas3tRequest{
@@ -344,7 +391,7 @@ var _ = Describe("ImportDatas3t", func() {
 			Expect(response.ImportedDatas3ts).To(ContainElement("valid-dataset"))
 
 			// Verify only valid dataset was imported
-			datas3ts, err := srv.ListDatas3ts(ctx, logger)
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(datas3ts).To(HaveLen(1))
 			Expect(datas3ts[0].Datas3tName).To(Equal("valid-dataset"))
@@ -456,7 +503,7 @@ var _ = Describe("ImportDatas3t", func() {
 			Expect(response.ImportedDatas3ts).To(ContainElement("transaction-test"))
 
 			// Verify all dataranges were imported atomically
-			datas3ts, err := srv.ListDatas3ts(ctx, logger)
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			
 			var transactionTestDataset *datas3t.Datas3tInfo
@@ -9,6 +9,11 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type ListDatas3tsRequest struct {
+	// NamePrefix restricts the result to datas3ts whose name starts with it
+	NamePrefix string `json:"name_prefix,omitempty"`
+}
+
 type Datas3tInfo struct {
 	Datas3tName      string `json:"datas3t_name"`
 	BucketName       string `json:"bucket_name"`
@@ -17,6 +22,7 @@ type Datas3tInfo struct {
 	LowestDatapoint  int64  `json:"lowest_datapoint"`
 	HighestDatapoint int64  `json:"highest_datapoint"`
 	TotalBytes       int64  `json:"total_bytes"`
+	Encrypted        bool   `json:"encrypted"`
 }
 
 // Helper function to convert interface{} to int64
@@ -52,12 +58,12 @@ func toInt64(v interface{}) int64 {
 	}
 }
 
-func (s *Datas3tServer) ListDatas3ts(ctx context.Context, log *slog.Logger) ([]Datas3tInfo, error) {
-	log.Info("Listing datas3ts")
+func (s *Datas3tServer) ListDatas3ts(ctx context.Context, log *slog.Logger, req *ListDatas3tsRequest) ([]Datas3tInfo, error) {
+	log.Info("Listing datas3ts", "name_prefix", req.NamePrefix)
 
 	queries := postgresstore.New(s.db)
 
-	rows, err := queries.ListDatas3ts(ctx)
+	rows, err := queries.ListDatas3ts(ctx, req.NamePrefix)
 	if err != nil {
 		log.Error("Failed to list datas3ts", "error", err)
 		return nil, fmt.Errorf("failed to list datas3ts: %w", err)
@@ -74,6 +80,7 @@ func (s *Datas3tServer) ListDatas3ts(ctx context.Context, log *slog.Logger) ([]D
 			LowestDatapoint:  toInt64(row.LowestDatapoint),
 			HighestDatapoint: toInt64(row.HighestDatapoint),
 			TotalBytes:       toInt64(row.TotalBytes),
+			Encrypted:        row.Encrypted,
 		}
 
 		datas3ts = append(datas3ts, datas3tInfo)
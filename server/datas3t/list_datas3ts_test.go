@@ -114,10 +114,9 @@ var _ = Describe("ListDatas3ts", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		// Create server instances
-		srv, err = datas3t.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
-		bucketSrv, err = bucket.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
+		encryptor, opener := newOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		srv = datas3t.NewServer(db, opener)
+		bucketSrv = bucket.NewServer(db, encryptor, opener)
 
 		// Add a test bucket configuration that datasets can use
 		bucketInfo := &bucket.BucketInfo{
@@ -148,7 +147,7 @@ var _ = Describe("ListDatas3ts", func() {
 
 	Context("when no datasets exist", func() {
 		It("should return an empty list", func(ctx SpecContext) {
-			datas3ts, err := srv.ListDatas3ts(ctx, logger)
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(datas3ts).To(BeEmpty())
 		})
@@ -175,7 +174,7 @@ var _ = Describe("ListDatas3ts", func() {
 		})
 
 		It("should return datasets with zero stats", func(ctx SpecContext) {
-			datas3ts, err := srv.ListDatas3ts(ctx, logger)
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(datas3ts).To(HaveLen(2))
 
@@ -198,7 +197,7 @@ var _ = Describe("ListDatas3ts", func() {
 		})
 
 		It("should return datasets ordered by name", func(ctx SpecContext) {
-			datas3ts, err := srv.ListDatas3ts(ctx, logger)
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(datas3ts).To(HaveLen(2))
 
@@ -206,6 +205,22 @@ var _ = Describe("ListDatas3ts", func() {
 			Expect(datas3ts[0].Datas3tName).To(Equal("test-dataset-1"))
 			Expect(datas3ts[1].Datas3tName).To(Equal("test-dataset-2"))
 		})
+
+		It("should only return datasets matching the name prefix", func(ctx SpecContext) {
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{NamePrefix: "test-dataset-2"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(datas3ts).To(HaveLen(1))
+			Expect(datas3ts[0].Datas3tName).To(Equal("test-dataset-2"))
+
+			datas3ts, err = srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{NamePrefix: "test-"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(datas3ts).To(HaveLen(2))
+
+			// LIKE wildcards in the prefix are matched literally
+			datas3ts, err = srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{NamePrefix: "test%"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(datas3ts).To(BeEmpty())
+		})
 	})
 
 	Context("when datasets exist with dataranges", func() {
@@ -257,7 +272,7 @@ var _ = Describe("ListDatas3ts", func() {
 		})
 
 		It("should return correct aggregated statistics", func(ctx SpecContext) {
-			datas3ts, err := srv.ListDatas3ts(ctx, logger)
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(datas3ts).To(HaveLen(1))
 
@@ -336,7 +351,7 @@ var _ = Describe("ListDatas3ts", func() {
 		})
 
 		It("should return correct data for each dataset", func(ctx SpecContext) {
-			datas3ts, err := srv.ListDatas3ts(ctx, logger)
+			datas3ts, err := srv.ListDatas3ts(ctx, logger, &datas3t.ListDatas3tsRequest{})
 			Expect(err).NotTo(HaveOccurred())
 			Expect(datas3ts).To(HaveLen(3))
 
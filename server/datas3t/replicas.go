@@ -0,0 +1,302 @@
+package datas3t
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/jackc/pgx/v5"
+)
+
+// SetReplicaRequest mirrors a datas3t into a second bucket configuration, possibly of
+// another provider. The replication worker copies its dataranges to the bucket.
+type SetReplicaRequest struct {
+	Datas3tName string `json:"datas3t_name"`
+	Bucket      string `json:"bucket"`
+}
+
+type RemoveReplicaRequest struct {
+	Datas3tName string `json:"datas3t_name"`
+}
+
+// ReplicaInfo summarizes the replica of a datas3t. Dataranges neither replicated nor
+// failed are pending.
+type ReplicaInfo struct {
+	Datas3tName          string    `json:"datas3t_name"`
+	Bucket               string    `json:"bucket"`
+	CreatedAt            time.Time `json:"created_at"`
+	TotalDataranges      int64     `json:"total_dataranges"`
+	ReplicatedDataranges int64     `json:"replicated_dataranges"`
+	FailedDataranges     int64     `json:"failed_dataranges"`
+}
+
+// DatarangeReplication is the replication status of a datarange
+type DatarangeReplication struct {
+	MinDatapointKey int64 `json:"min_datapoint_key"`
+	MaxDatapointKey int64 `json:"max_datapoint_key"`
+
+	// Status is pending until the worker copied the datarange, replicated once it did and
+	// failed when its last attempt failed, failed copies are retried
+	Status string `json:"status"`
+
+	Attempts     int32      `json:"attempts"`
+	LastError    string     `json:"last_error,omitempty"`
+	ReplicatedAt *time.Time `json:"replicated_at,omitempty"`
+}
+
+type ReplicationStatusResponse struct {
+	Datas3tName string                 `json:"datas3t_name"`
+	Bucket      string                 `json:"bucket"`
+	Dataranges  []DatarangeReplication `json:"dataranges"`
+}
+
+func (r *SetReplicaRequest) Validate(ctx context.Context) error {
+	if r.Datas3tName == "" {
+		return ValidationError(fmt.Errorf("datas3t_name is required"))
+	}
+
+	if r.Bucket == "" {
+		return ValidationError(fmt.Errorf("bucket is required"))
+	}
+
+	return nil
+}
+
+func (r *RemoveReplicaRequest) Validate(ctx context.Context) error {
+	if r.Datas3tName == "" {
+		return ValidationError(fmt.Errorf("datas3t_name is required"))
+	}
+
+	return nil
+}
+
+// SetReplica sets the bucket a datas3t is replicated to. Replacing the bucket of an
+// existing replica schedules the copies in the previous bucket for deletion and starts
+// the replication over.
+func (s *Datas3tServer) SetReplica(ctx context.Context, log *slog.Logger, req *SetReplicaRequest) (err error) {
+	log = log.With("datas3t_name", req.Datas3tName, "bucket", req.Bucket)
+	log.Info("Setting replica")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to set replica", "error", err)
+		} else {
+			log.Info("Replica set")
+		}
+	}()
+
+	err = req.Validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := postgresstore.New(tx)
+
+	datas3t, err := queries.GetDatas3tWithBucket(ctx, req.Datas3tName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apierror.New(apierror.CodeDatas3tNotFound, "datas3t '%s' does not exist", req.Datas3tName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get datas3t: %w", err)
+	}
+
+	// Lock the bucket, deleting it waits for the transaction to finish
+	bucketID, err := queries.LockBucket(ctx, req.Bucket)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apierror.New(apierror.CodeBucketNotFound, "bucket '%s' does not exist", req.Bucket)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock bucket: %w", err)
+	}
+
+	if bucketID == datas3t.S3BucketID {
+		return ValidationError(fmt.Errorf("datas3t '%s' is stored in bucket '%s', its replica needs a different bucket", req.Datas3tName, req.Bucket))
+	}
+
+	replica, err := queries.GetDatas3tReplica(ctx, datas3t.ID)
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("failed to get replica: %w", err)
+	case replica.S3BucketID == bucketID:
+		return nil
+	default:
+		log.Info("Replacing replica", "previous_bucket", replica.BucketName)
+		err = removeReplica(ctx, queries, replica.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = queries.InsertDatas3tReplica(ctx, postgresstore.InsertDatas3tReplicaParams{
+		Datas3tID:  datas3t.ID,
+		S3BucketID: bucketID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to insert replica: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// RemoveReplica stops replicating a datas3t and schedules the copies of its dataranges
+// for deletion from the bucket of the replica
+func (s *Datas3tServer) RemoveReplica(ctx context.Context, log *slog.Logger, req *RemoveReplicaRequest) (err error) {
+	log = log.With("datas3t_name", req.Datas3tName)
+	log.Info("Removing replica")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to remove replica", "error", err)
+		} else {
+			log.Info("Replica removed")
+		}
+	}()
+
+	err = req.Validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := postgresstore.New(tx)
+
+	replica, err := getReplica(ctx, queries, req.Datas3tName)
+	if err != nil {
+		return err
+	}
+
+	err = removeReplica(ctx, queries, replica.ID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListReplicas returns the replicas of all datas3ts
+func (s *Datas3tServer) ListReplicas(ctx context.Context, log *slog.Logger) ([]ReplicaInfo, error) {
+	queries := postgresstore.New(s.db)
+
+	replicas, err := queries.ListDatas3tReplicas(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replicas: %w", err)
+	}
+
+	result := make([]ReplicaInfo, len(replicas))
+	for i, replica := range replicas {
+		result[i] = ReplicaInfo{
+			Datas3tName:          replica.Datas3tName,
+			Bucket:               replica.BucketName,
+			CreatedAt:            replica.CreatedAt.Time,
+			TotalDataranges:      replica.TotalDataranges,
+			ReplicatedDataranges: replica.ReplicatedDataranges,
+			FailedDataranges:     replica.FailedDataranges,
+		}
+	}
+
+	return result, nil
+}
+
+// GetReplicationStatus returns the replication status of every datarange of a datas3t
+func (s *Datas3tServer) GetReplicationStatus(ctx context.Context, log *slog.Logger, datas3tName string) (*ReplicationStatusResponse, error) {
+	if datas3tName == "" {
+		return nil, ValidationError(fmt.Errorf("datas3t_name is required"))
+	}
+
+	queries := postgresstore.New(s.db)
+
+	replica, err := getReplica(ctx, queries, datas3tName)
+	if err != nil {
+		return nil, err
+	}
+
+	replications, err := queries.ListDatarangeReplications(ctx, datas3tName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list datarange replications: %w", err)
+	}
+
+	response := &ReplicationStatusResponse{
+		Datas3tName: datas3tName,
+		Bucket:      replica.BucketName,
+		Dataranges:  make([]DatarangeReplication, len(replications)),
+	}
+	for i, replication := range replications {
+		response.Dataranges[i] = DatarangeReplication{
+			MinDatapointKey: replication.MinDatapointKey,
+			MaxDatapointKey: replication.MaxDatapointKey,
+			Status:          replication.Status,
+			Attempts:        replication.Attempts,
+			LastError:       replication.LastError,
+		}
+		if replication.ReplicatedAt.Valid {
+			replicatedAt := replication.ReplicatedAt.Time
+			response.Dataranges[i].ReplicatedAt = &replicatedAt
+		}
+	}
+
+	return response, nil
+}
+
+// getReplica returns the replica of a datas3t, failing with ErrReplicaNotFound when the
+// datas3t is not replicated
+func getReplica(ctx context.Context, queries *postgresstore.Queries, datas3tName string) (postgresstore.GetDatas3tReplicaRow, error) {
+	datas3tID, err := queries.GetDatas3tIDByName(ctx, datas3tName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return postgresstore.GetDatas3tReplicaRow{}, apierror.New(apierror.CodeDatas3tNotFound, "datas3t '%s' does not exist", datas3tName)
+	}
+	if err != nil {
+		return postgresstore.GetDatas3tReplicaRow{}, fmt.Errorf("failed to get datas3t: %w", err)
+	}
+
+	replica, err := queries.GetDatas3tReplica(ctx, datas3tID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return postgresstore.GetDatas3tReplicaRow{}, apierror.New(apierror.CodeReplicaNotFound, "datas3t '%s' has no replica", datas3tName)
+	}
+	if err != nil {
+		return postgresstore.GetDatas3tReplicaRow{}, fmt.Errorf("failed to get replica: %w", err)
+	}
+
+	return replica, nil
+}
+
+// removeReplica schedules the copies of a replica for deletion and deletes it along with
+// the replication status of its dataranges
+func removeReplica(ctx context.Context, queries *postgresstore.Queries, replicaID int64) error {
+	err := queries.ScheduleReplicaObjectsForDeletion(ctx, replicaID)
+	if err != nil {
+		return fmt.Errorf("failed to schedule replicated objects for deletion: %w", err)
+	}
+
+	err = queries.DeleteDatas3tReplica(ctx, replicaID)
+	if err != nil {
+		return fmt.Errorf("failed to delete replica: %w", err)
+	}
+
+	return nil
+}
@@ -1,27 +1,19 @@
 package datas3t
 
 import (
-	"github.com/draganm/datas3t/crypto"
+	"github.com/draganm/datas3t/storage"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type Datas3tServer struct {
-	db        *pgxpool.Pool
-	encryptor *crypto.CredentialEncryptor
+	db *pgxpool.Pool
+	// storage opens the stores of imported buckets
+	storage *storage.Opener
 }
 
-func NewServer(db *pgxpool.Pool, encryptionKey string) (*Datas3tServer, error) {
-	encryptor, err := crypto.NewCredentialEncryptor(encryptionKey)
-	if err != nil {
-		return nil, err
-	}
-
+func NewServer(db *pgxpool.Pool, opener *storage.Opener) *Datas3tServer {
 	return &Datas3tServer{
-		db:        db,
-		encryptor: encryptor,
-	}, nil
-}
-
-func (s *Datas3tServer) GetEncryptor() *crypto.CredentialEncryptor {
-	return s.encryptor
+		db:      db,
+		storage: opener,
+	}
 }
@@ -3,6 +3,8 @@ package datas3t_test
 import (
 	"testing"
 
+	"github.com/draganm/datas3t/crypto"
+	"github.com/draganm/datas3t/storage"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -11,3 +13,15 @@ func TestServer(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "AddDatas3t Server Suite")
 }
+
+// newOpener creates the credential encryptor and the store opener shared by the servers
+// under test
+func newOpener(encryptionKey string) (*crypto.CredentialEncryptor, *storage.Opener) {
+	encryptor, err := crypto.NewCredentialEncryptor(encryptionKey)
+	Expect(err).NotTo(HaveOccurred())
+
+	opener, err := storage.NewOpener(encryptionKey, encryptor)
+	Expect(err).NotTo(HaveOccurred())
+
+	return encryptor, opener
+}
@@ -0,0 +1,174 @@
+package datas3t
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5"
+)
+
+// StorageClassRule moves the dataranges of a datas3t to a colder storage class once they
+// match all of its conditions. Dataranges in archived classes (GLACIER, DEEP_ARCHIVE) are
+// restored when they are downloaded or aggregated.
+type StorageClassRule struct {
+	StorageClass string `json:"storage_class"`
+
+	// MinAgeDays matches dataranges created at least this many days ago
+	MinAgeDays *int32 `json:"min_age_days,omitempty"`
+
+	// MinKeysBehind matches dataranges whose max datapoint key is at least this many keys
+	// behind the newest datapoint of the datas3t
+	MinKeysBehind *int64 `json:"min_keys_behind,omitempty"`
+}
+
+type SetStorageClassRulesRequest struct {
+	Datas3tName string             `json:"datas3t_name"`
+	Rules       []StorageClassRule `json:"rules"`
+}
+
+type StorageClassRulesResponse struct {
+	Datas3tName string             `json:"datas3t_name"`
+	Rules       []StorageClassRule `json:"rules"`
+}
+
+func (r *SetStorageClassRulesRequest) Validate(ctx context.Context) error {
+	if r.Datas3tName == "" {
+		return ValidationError(fmt.Errorf("datas3t_name is required"))
+	}
+
+	storageClasses := map[string]bool{}
+	for i, rule := range r.Rules {
+		err := storage.ValidateStorageClass(rule.StorageClass)
+		if err != nil {
+			return ValidationError(fmt.Errorf("rule %d: %w", i, err))
+		}
+
+		if rule.StorageClass == storage.StorageClassStandard {
+			return ValidationError(fmt.Errorf("rule %d: dataranges cannot be moved to the %s storage class", i, storage.StorageClassStandard))
+		}
+
+		if storageClasses[rule.StorageClass] {
+			return ValidationError(fmt.Errorf("rule %d: storage class %s is used by more than one rule", i, rule.StorageClass))
+		}
+		storageClasses[rule.StorageClass] = true
+
+		if rule.MinAgeDays == nil && rule.MinKeysBehind == nil {
+			return ValidationError(fmt.Errorf("rule %d: min_age_days or min_keys_behind is required", i))
+		}
+
+		if rule.MinAgeDays != nil && *rule.MinAgeDays < 1 {
+			return ValidationError(fmt.Errorf("rule %d: min_age_days must be at least 1", i))
+		}
+
+		if rule.MinKeysBehind != nil && *rule.MinKeysBehind < 1 {
+			return ValidationError(fmt.Errorf("rule %d: min_keys_behind must be at least 1", i))
+		}
+	}
+
+	return nil
+}
+
+// SetStorageClassRules replaces the storage class rules of a datas3t. Removing rules does
+// not move dataranges back to warmer storage classes.
+func (s *Datas3tServer) SetStorageClassRules(ctx context.Context, log *slog.Logger, req *SetStorageClassRulesRequest) (err error) {
+	log = log.With("datas3t_name", req.Datas3tName, "rules", len(req.Rules))
+	log.Info("Setting storage class rules")
+
+	defer func() {
+		if err != nil {
+			log.Error("Failed to set storage class rules", "error", err)
+		} else {
+			log.Info("Storage class rules set")
+		}
+	}()
+
+	err = req.Validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	queries := postgresstore.New(tx)
+
+	datas3t, err := queries.GetDatas3tWithBucket(ctx, req.Datas3tName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return apierror.New(apierror.CodeDatas3tNotFound, "datas3t '%s' does not exist", req.Datas3tName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get datas3t: %w", err)
+	}
+
+	if len(req.Rules) > 0 && storage.IsLocalEndpoint(datas3t.Endpoint) {
+		return ValidationError(fmt.Errorf("datas3t '%s': %w", req.Datas3tName, storage.ErrStorageClassesNotSupported))
+	}
+
+	err = queries.DeleteStorageClassRules(ctx, datas3t.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete storage class rules: %w", err)
+	}
+
+	for _, rule := range req.Rules {
+		err = queries.InsertStorageClassRule(ctx, postgresstore.InsertStorageClassRuleParams{
+			Datas3tID:     datas3t.ID,
+			StorageClass:  rule.StorageClass,
+			MinAgeDays:    rule.MinAgeDays,
+			MinKeysBehind: rule.MinKeysBehind,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to insert storage class rule: %w", err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// GetStorageClassRules returns the storage class rules of a datas3t
+func (s *Datas3tServer) GetStorageClassRules(ctx context.Context, log *slog.Logger, datas3tName string) (*StorageClassRulesResponse, error) {
+	if datas3tName == "" {
+		return nil, ValidationError(fmt.Errorf("datas3t_name is required"))
+	}
+
+	queries := postgresstore.New(s.db)
+
+	datas3tID, err := queries.GetDatas3tIDByName(ctx, datas3tName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, apierror.New(apierror.CodeDatas3tNotFound, "datas3t '%s' does not exist", datas3tName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datas3t: %w", err)
+	}
+
+	rules, err := queries.GetStorageClassRules(ctx, datas3tID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get storage class rules: %w", err)
+	}
+
+	response := &StorageClassRulesResponse{
+		Datas3tName: datas3tName,
+		Rules:       make([]StorageClassRule, len(rules)),
+	}
+	for i, rule := range rules {
+		response.Rules[i] = StorageClassRule{
+			StorageClass:  rule.StorageClass,
+			MinAgeDays:    rule.MinAgeDays,
+			MinKeysBehind: rule.MinKeysBehind,
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,290 @@
+package datas3t_test
+
+import (
+	"fmt"
+	"log"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/bucket"
+	"github.com/draganm/datas3t/server/datas3t"
+	"github.com/draganm/datas3t/storage"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	miniogo "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/minio"
+	tc_postgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var _ = Describe("StorageClassRules", func() {
+	var (
+		pgContainer          *tc_postgres.PostgresContainer
+		minioContainer       *minio.MinioContainer
+		db                   *pgxpool.Pool
+		srv                  *datas3t.Datas3tServer
+		bucketSrv            *bucket.BucketServer
+		minioEndpoint        string
+		minioHost            string
+		minioAccessKey       string
+		minioSecretKey       string
+		testBucketName       string
+		testBucketConfigName string
+		logger               *slog.Logger
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+
+		logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+
+		// Start PostgreSQL container
+		pgContainer, err = tc_postgres.Run(ctx,
+			"postgres:16-alpine",
+			tc_postgres.WithDatabase("testdb"),
+			tc_postgres.WithUsername("testuser"),
+			tc_postgres.WithPassword("testpass"),
+			testcontainers.WithWaitStrategy(
+				wait.ForLog("database system is ready to accept connections").
+					WithOccurrence(2).
+					WithStartupTimeout(30*time.Second),
+			),
+			testcontainers.WithLogger(log.New(GinkgoWriter, "", 0)),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Get PostgreSQL connection string
+		connStr, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
+		Expect(err).NotTo(HaveOccurred())
+
+		// Connect to PostgreSQL
+		db, err = pgxpool.New(ctx, connStr)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Run migrations
+		connStrForMigration, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
+		Expect(err).NotTo(HaveOccurred())
+
+		m, err := migrate.New(
+			"file://../../postgresstore/migrations",
+			connStrForMigration)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = m.Up()
+		if err != nil && err != migrate.ErrNoChange {
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// Start MinIO container
+		minioContainer, err = minio.Run(ctx,
+			"minio/minio:RELEASE.2024-01-16T16-07-38Z",
+			minio.WithUsername("minioadmin"),
+			minio.WithPassword("minioadmin"),
+			testcontainers.WithLogger(log.New(GinkgoWriter, "", 0)),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Get MinIO connection details
+		minioEndpoint, err = minioContainer.ConnectionString(ctx)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Extract host:port from the full URL
+		minioHost = strings.TrimPrefix(minioEndpoint, "http://")
+		minioHost = strings.TrimPrefix(minioHost, "https://")
+
+		minioAccessKey = "minioadmin"
+		minioSecretKey = "minioadmin"
+		testBucketName = "test-bucket"
+		testBucketConfigName = "test-bucket-config"
+
+		// Create test bucket in MinIO
+		minioClient, err := miniogo.New(minioHost, &miniogo.Options{
+			Creds:  credentials.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+			Secure: false,
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = minioClient.MakeBucket(ctx, testBucketName, miniogo.MakeBucketOptions{})
+		Expect(err).NotTo(HaveOccurred())
+
+		// Create server instances
+		encryptor, opener := newOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		srv = datas3t.NewServer(db, opener)
+		bucketSrv = bucket.NewServer(db, encryptor, opener)
+
+		// Add a test bucket configuration that datasets can use
+		bucketInfo := &bucket.BucketInfo{
+			Name:      testBucketConfigName,
+			Endpoint:  minioEndpoint,
+			Bucket:    testBucketName,
+			AccessKey: minioAccessKey,
+			SecretKey: minioSecretKey,
+		}
+
+		err = bucketSrv.AddBucket(ctx, logger, bucketInfo)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		if db != nil {
+			db.Close()
+		}
+		if pgContainer != nil {
+			err := pgContainer.Terminate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		if minioContainer != nil {
+			err := minioContainer.Terminate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	int32Ptr := func(v int32) *int32 { return &v }
+	int64Ptr := func(v int64) *int64 { return &v }
+
+	BeforeEach(func(ctx SpecContext) {
+		err := srv.AddDatas3t(ctx, logger, &datas3t.AddDatas3tRequest{
+			Bucket: testBucketConfigName,
+			Name:   "test-dataset",
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("should return no rules for a datas3t without rules", func(ctx SpecContext) {
+		resp, err := srv.GetStorageClassRules(ctx, logger, "test-dataset")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Datas3tName).To(Equal("test-dataset"))
+		Expect(resp.Rules).To(BeEmpty())
+	})
+
+	It("should replace the rules of a datas3t", func(ctx SpecContext) {
+		err := srv.SetStorageClassRules(ctx, logger, &datas3t.SetStorageClassRulesRequest{
+			Datas3tName: "test-dataset",
+			Rules: []datas3t.StorageClassRule{
+				{StorageClass: storage.StorageClassStandardIA, MinKeysBehind: int64Ptr(1000)},
+				{StorageClass: storage.StorageClassGlacier, MinAgeDays: int32Ptr(90), MinKeysBehind: int64Ptr(5000)},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err := srv.GetStorageClassRules(ctx, logger, "test-dataset")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Rules).To(Equal([]datas3t.StorageClassRule{
+			{StorageClass: storage.StorageClassStandardIA, MinKeysBehind: int64Ptr(1000)},
+			{StorageClass: storage.StorageClassGlacier, MinAgeDays: int32Ptr(90), MinKeysBehind: int64Ptr(5000)},
+		}))
+
+		err = srv.SetStorageClassRules(ctx, logger, &datas3t.SetStorageClassRulesRequest{
+			Datas3tName: "test-dataset",
+			Rules: []datas3t.StorageClassRule{
+				{StorageClass: storage.StorageClassDeepArchive, MinAgeDays: int32Ptr(365)},
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err = srv.GetStorageClassRules(ctx, logger, "test-dataset")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Rules).To(Equal([]datas3t.StorageClassRule{
+			{StorageClass: storage.StorageClassDeepArchive, MinAgeDays: int32Ptr(365)},
+		}))
+
+		err = srv.SetStorageClassRules(ctx, logger, &datas3t.SetStorageClassRulesRequest{
+			Datas3tName: "test-dataset",
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		resp, err = srv.GetStorageClassRules(ctx, logger, "test-dataset")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Rules).To(BeEmpty())
+	})
+
+	DescribeTable("should reject invalid rules",
+		func(ctx SpecContext, rules []datas3t.StorageClassRule) {
+			err := srv.SetStorageClassRules(ctx, logger, &datas3t.SetStorageClassRulesRequest{
+				Datas3tName: "test-dataset",
+				Rules:       rules,
+			})
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		},
+		Entry("unknown storage class", []datas3t.StorageClassRule{{StorageClass: "COLD", MinAgeDays: int32Ptr(1)}}),
+		Entry("standard storage class", []datas3t.StorageClassRule{{StorageClass: storage.StorageClassStandard, MinAgeDays: int32Ptr(1)}}),
+		Entry("no condition", []datas3t.StorageClassRule{{StorageClass: storage.StorageClassGlacier}}),
+		Entry("zero min age", []datas3t.StorageClassRule{{StorageClass: storage.StorageClassGlacier, MinAgeDays: int32Ptr(0)}}),
+		Entry("negative min keys behind", []datas3t.StorageClassRule{{StorageClass: storage.StorageClassGlacier, MinKeysBehind: int64Ptr(-1)}}),
+		Entry("duplicate storage class", []datas3t.StorageClassRule{
+			{StorageClass: storage.StorageClassGlacier, MinAgeDays: int32Ptr(30)},
+			{StorageClass: storage.StorageClassGlacier, MinAgeDays: int32Ptr(60)},
+		}),
+	)
+
+	It("should fail for a datas3t that does not exist", func(ctx SpecContext) {
+		err := srv.SetStorageClassRules(ctx, logger, &datas3t.SetStorageClassRulesRequest{
+			Datas3tName: "missing",
+			Rules:       []datas3t.StorageClassRule{{StorageClass: storage.StorageClassGlacier, MinAgeDays: int32Ptr(1)}},
+		})
+		Expect(err).To(MatchError(apierror.ErrDatas3tNotFound))
+
+		_, err = srv.GetStorageClassRules(ctx, logger, "missing")
+		Expect(err).To(MatchError(apierror.ErrDatas3tNotFound))
+	})
+
+	It("should select the dataranges far enough behind the newest datapoint", func(ctx SpecContext) {
+		queries := postgresstore.New(db)
+		dataset, err := queries.GetDatas3tWithBucket(ctx, "test-dataset")
+		Expect(err).NotTo(HaveOccurred())
+
+		var ids []int64
+		for i, keys := range [][2]int64{{0, 99}, {100, 199}, {200, 299}} {
+			id, err := queries.CreateDatarange(ctx, postgresstore.CreateDatarangeParams{
+				Datas3tID:       dataset.ID,
+				DataObjectKey:   fmt.Sprintf("data-%d", i),
+				IndexObjectKey:  fmt.Sprintf("index-%d", i),
+				MinDatapointKey: keys[0],
+				MaxDatapointKey: keys[1],
+				SizeBytes:       1000,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			ids = append(ids, id)
+		}
+
+		selected := func(minKeysBehind *int64, createdBefore pgtype.Timestamp) []int64 {
+			dataranges, err := queries.GetDatarangesForStorageClassRule(ctx, postgresstore.GetDatarangesForStorageClassRuleParams{
+				Datas3tID:            dataset.ID,
+				WarmerStorageClasses: storage.WarmerStorageClasses(storage.StorageClassGlacier),
+				CreatedBefore:        createdBefore,
+				MinKeysBehind:        minKeysBehind,
+				MaxDataranges:        100,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			var selectedIDs []int64
+			for _, datarange := range dataranges {
+				selectedIDs = append(selectedIDs, datarange.ID)
+			}
+			return selectedIDs
+		}
+
+		Expect(selected(int64Ptr(100), pgtype.Timestamp{})).To(Equal(ids[:2]))
+		Expect(selected(int64Ptr(200), pgtype.Timestamp{})).To(Equal(ids[:1]))
+		Expect(selected(nil, pgtype.Timestamp{Time: time.Now().UTC().Add(-time.Hour), Valid: true})).To(BeEmpty())
+
+		// Dataranges already in the class or a colder one are not selected again
+		err = queries.SetDatarangeStorageClass(ctx, postgresstore.SetDatarangeStorageClassParams{
+			StorageClass: storage.StorageClassDeepArchive,
+			ID:           ids[0],
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(selected(int64Ptr(100), pgtype.Timestamp{})).To(Equal(ids[1:2]))
+	})
+})
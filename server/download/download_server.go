@@ -1,35 +1,71 @@
 package download
 
 import (
-	"github.com/draganm/datas3t/crypto"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/server/tiering"
+	"github.com/draganm/datas3t/storage"
 	"github.com/draganm/datas3t/tarindex/diskcache"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type DownloadServer struct {
-	pgxPool   *pgxpool.Pool
-	diskCache *diskcache.IndexDiskCache
-	encryptor *crypto.CredentialEncryptor
+	pgxPool       *pgxpool.Pool
+	diskCache     *diskcache.IndexDiskCache
+	storage       *storage.Opener
+	presignExpiry time.Duration
+	restoreDays   int32
 }
 
-func NewServer(pgxPool *pgxpool.Pool, cacheDir string, maxCacheSize int64, encryptionKey string) (*DownloadServer, error) {
-	encryptor, err := crypto.NewCredentialEncryptor(encryptionKey)
-	if err != nil {
-		return nil, err
-	}
-
+func NewServer(pgxPool *pgxpool.Pool, cacheDir string, maxCacheSize int64, opener *storage.Opener) (*DownloadServer, error) {
 	diskCache, err := diskcache.NewIndexDiskCache(cacheDir, maxCacheSize)
 	if err != nil {
 		return nil, err
 	}
 
 	return &DownloadServer{
-		pgxPool:   pgxPool,
-		diskCache: diskCache,
-		encryptor: encryptor,
+		pgxPool:       pgxPool,
+		diskCache:     diskCache,
+		storage:       opener,
+		presignExpiry: awsutil.DefaultPresignExpiry,
+		restoreDays:   tiering.DefaultRestoreDays,
 	}, nil
 }
 
+// SetPresignExpiry sets how long presigned download URLs stay valid when a request does
+// not ask for a different expiry
+func (s *DownloadServer) SetPresignExpiry(expiry time.Duration) {
+	s.presignExpiry = expiry
+}
+
+// SetRestoreDays sets how many days the copies of archived data objects restored for
+// downloads are kept
+func (s *DownloadServer) SetRestoreDays(days int32) {
+	s.restoreDays = days
+}
+
+// presignExpiryFor returns how long the URLs presigned for a request stay valid
+func (s *DownloadServer) presignExpiryFor(seconds int64) time.Duration {
+	if seconds == 0 {
+		return s.presignExpiry
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// openStore opens the object store of a bucket, cfg holds the encrypted credentials
+func (s *DownloadServer) openStore(ctx context.Context, log *slog.Logger, cfg storage.Config) (storage.ObjectStore, error) {
+	store, err := s.storage.Open(ctx, log, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object store: %w", err)
+	}
+
+	return store, nil
+}
+
 func (s *DownloadServer) Close() error {
 	if s.diskCache != nil {
 		return s.diskCache.Close()
@@ -7,16 +7,21 @@ import (
 	"log"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
 	"archive/tar"
 	"path/filepath"
 
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/crypto"
 	"github.com/draganm/datas3t/server/bucket"
 	"github.com/draganm/datas3t/server/dataranges"
 	"github.com/draganm/datas3t/server/datas3t"
 	"github.com/draganm/datas3t/server/download"
+	"github.com/draganm/datas3t/server/replication"
+	"github.com/draganm/datas3t/storage"
 	"github.com/draganm/datas3t/tarindex"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -107,6 +112,7 @@ var _ = Describe("PresignDownloadForDatapoints", func() {
 		uploadSrv            *dataranges.UploadDatarangeServer
 		bucketSrv            *bucket.BucketServer
 		datas3tSrv           *datas3t.Datas3tServer
+		opener               *storage.Opener
 		minioEndpoint        string
 		minioHost            string
 		minioAccessKey       string
@@ -200,16 +206,18 @@ var _ = Describe("PresignDownloadForDatapoints", func() {
 		Expect(err).NotTo(HaveOccurred())
 
 		// Create server instances
-		uploadSrv, err = dataranges.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		encryptor, err := crypto.NewCredentialEncryptor("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
 		Expect(err).NotTo(HaveOccurred())
-		bucketSrv, err = bucket.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
-		Expect(err).NotTo(HaveOccurred())
-		datas3tSrv, err = datas3t.NewServer(db, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		opener, err = storage.NewOpener("dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==", encryptor)
 		Expect(err).NotTo(HaveOccurred())
 
+		uploadSrv = dataranges.NewServer(db, opener)
+		bucketSrv = bucket.NewServer(db, encryptor, opener)
+		datas3tSrv = datas3t.NewServer(db, opener)
+
 		// Create download server with cache
 		cacheDir := filepath.Join(GinkgoT().TempDir(), "cache")
-		downloadSrv, err = download.NewServer(db, cacheDir, 1024*1024*1024, "dGVzdC1rZXktMzItYnl0ZXMtZm9yLXRlc3RpbmchIQ==")
+		downloadSrv, err = download.NewServer(db, cacheDir, 1024*1024*1024, opener)
 		Expect(err).NotTo(HaveOccurred())
 
 		// Add test bucket configuration
@@ -433,8 +441,8 @@ var _ = Describe("PresignDownloadForDatapoints", func() {
 			}
 
 			_, err := downloadSrv.PreSignDownloadForDatapoints(ctx, logger, req)
-			Expect(err).To(HaveOccurred())
-			Expect(err.Error()).To(ContainSubstring("no dataranges found"))
+			Expect(err).To(MatchError(apierror.ErrDatas3tNotFound))
+			Expect(err.Error()).To(ContainSubstring("datas3t 'non-existent-datas3t' does not exist"))
 		})
 
 		It("should reject datapoints with no overlapping dataranges", func(ctx SpecContext) {
@@ -517,4 +525,183 @@ var _ = Describe("PresignDownloadForDatapoints", func() {
 			}
 		})
 	})
+
+	Context("when refreshing download segments", func() {
+		var presigned download.PreSignDownloadForDatapointsResponse
+
+		BeforeEach(func(ctx SpecContext) {
+			uploadCompleteDatarange(ctx, 0, 10)
+			uploadCompleteDatarange(ctx, 10, 10)
+
+			var err error
+			presigned, err = downloadSrv.PreSignDownloadForDatapoints(ctx, logger, download.PreSignDownloadForDatapointsRequest{
+				Datas3tName:          testDatas3tName,
+				FirstDatapoint:       5,
+				LastDatapoint:        15,
+				PresignExpirySeconds: 60,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(presigned.DownloadSegments).To(HaveLen(2))
+		})
+
+		It("should presign the segments with the requested expiry", func(ctx SpecContext) {
+			for _, segment := range presigned.DownloadSegments {
+				Expect(segment.PresignedURL).To(ContainSubstring("X-Amz-Expires=60"))
+				Expect(segment.ObjectKey).NotTo(BeEmpty())
+			}
+			Expect(presigned.PresignedURLsExpireAt).To(BeTemporally("~", time.Now().Add(time.Minute), 30*time.Second))
+		})
+
+		It("should presign new URLs for the same byte ranges", func(ctx SpecContext) {
+			resp, err := downloadSrv.RefreshDownloadSegments(ctx, logger, download.RefreshDownloadSegmentsRequest{
+				Datas3tName:          testDatas3tName,
+				Segments:             presigned.DownloadSegments,
+				PresignExpirySeconds: 3600,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.DownloadSegments).To(HaveLen(2))
+
+			for i, segment := range resp.DownloadSegments {
+				Expect(segment.ObjectKey).To(Equal(presigned.DownloadSegments[i].ObjectKey))
+				Expect(segment.Range).To(Equal(presigned.DownloadSegments[i].Range))
+				Expect(segment.PresignedURL).To(ContainSubstring("X-Amz-Expires=3600"))
+
+				getResp, err := httpGetWithRange(segment.PresignedURL, segment.Range)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(getResp.StatusCode).To(Equal(http.StatusPartialContent))
+				getResp.Body.Close()
+			}
+		})
+
+		It("should reject segments of objects that do not belong to the datas3t", func(ctx SpecContext) {
+			segments := slices.Clone(presigned.DownloadSegments)
+			segments[1].ObjectKey = "datas3t/unknown/dataranges/00000000000000000000-00000000000000000009.tar"
+
+			_, err := downloadSrv.RefreshDownloadSegments(ctx, logger, download.RefreshDownloadSegmentsRequest{
+				Datas3tName: testDatas3tName,
+				Segments:    segments,
+			})
+			Expect(err).To(MatchError(apierror.ErrDatarangeNotFound))
+		})
+
+		It("should reject segments without an object key", func(ctx SpecContext) {
+			_, err := downloadSrv.RefreshDownloadSegments(ctx, logger, download.RefreshDownloadSegmentsRequest{
+				Datas3tName: testDatas3tName,
+				Segments:    []download.DownloadSegment{{Range: "bytes=0-10"}},
+			})
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		})
+
+		It("should reject an expiry longer than seven days", func(ctx SpecContext) {
+			_, err := downloadSrv.PreSignDownloadForDatapoints(ctx, logger, download.PreSignDownloadForDatapointsRequest{
+				Datas3tName:          testDatas3tName,
+				FirstDatapoint:       5,
+				LastDatapoint:        15,
+				PresignExpirySeconds: 8 * 24 * 60 * 60,
+			})
+			Expect(err).To(MatchError(apierror.ErrValidationFailed))
+		})
+	})
+
+	Context("when the datas3t is replicated", func() {
+		var minioClient *miniogo.Client
+
+		BeforeEach(func(ctx SpecContext) {
+			var err error
+			minioClient, err = miniogo.New(minioHost, &miniogo.Options{
+				Creds:  miniocreds.NewStaticV4(minioAccessKey, minioSecretKey, ""),
+				Secure: false,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = minioClient.MakeBucket(ctx, "replica-bucket", miniogo.MakeBucketOptions{})
+			Expect(err).NotTo(HaveOccurred())
+
+			err = bucketSrv.AddBucket(ctx, logger, &bucket.BucketInfo{
+				Name:      "replica-bucket-config",
+				Endpoint:  minioEndpoint,
+				Bucket:    "replica-bucket",
+				AccessKey: minioAccessKey,
+				SecretKey: minioSecretKey,
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			uploadCompleteDatarange(ctx, 0, 10)
+
+			err = datas3tSrv.SetReplica(ctx, logger, &datas3t.SetReplicaRequest{
+				Datas3tName: testDatas3tName,
+				Bucket:      "replica-bucket-config",
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			replicated, err := replication.NewServer(db, opener).ReplicateDataranges(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicated).To(Equal(1))
+		})
+
+		It("should serve the segments from the replica when asked to", func(ctx SpecContext) {
+			resp, err := downloadSrv.PreSignDownloadForDatapoints(ctx, logger, download.PreSignDownloadForDatapointsRequest{
+				Datas3tName:    testDatas3tName,
+				FirstDatapoint: 2,
+				LastDatapoint:  5,
+				UseReplica:     true,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.DownloadSegments).To(HaveLen(1))
+
+			segment := resp.DownloadSegments[0]
+			Expect(segment.Replica).To(BeTrue())
+			Expect(segment.PresignedURL).To(ContainSubstring("replica-bucket"))
+
+			getResp, err := httpGetWithRange(segment.PresignedURL, segment.Range)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getResp.StatusCode).To(Equal(http.StatusPartialContent))
+			getResp.Body.Close()
+
+			// Refreshed segments stay on the replica
+			refreshed, err := downloadSrv.RefreshDownloadSegments(ctx, logger, download.RefreshDownloadSegmentsRequest{
+				Datas3tName: testDatas3tName,
+				Segments:    resp.DownloadSegments,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(refreshed.DownloadSegments[0].Replica).To(BeTrue())
+			Expect(refreshed.DownloadSegments[0].PresignedURL).To(ContainSubstring("replica-bucket"))
+		})
+
+		It("should fail over to the replica when the bucket of the datas3t fails", func(ctx SpecContext) {
+			for object := range minioClient.ListObjects(ctx, testBucketName, miniogo.ListObjectsOptions{Recursive: true}) {
+				Expect(object.Err).NotTo(HaveOccurred())
+				if strings.HasSuffix(object.Key, ".index") {
+					err := minioClient.RemoveObject(ctx, testBucketName, object.Key, miniogo.RemoveObjectOptions{})
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+
+			resp, err := downloadSrv.PreSignDownloadForDatapoints(ctx, logger, download.PreSignDownloadForDatapointsRequest{
+				Datas3tName:    testDatas3tName,
+				FirstDatapoint: 2,
+				LastDatapoint:  5,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.DownloadSegments).To(HaveLen(1))
+			Expect(resp.DownloadSegments[0].Replica).To(BeTrue())
+
+			getResp, err := httpGetWithRange(resp.DownloadSegments[0].PresignedURL, resp.DownloadSegments[0].Range)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(getResp.StatusCode).To(Equal(http.StatusPartialContent))
+			getResp.Body.Close()
+		})
+
+		It("should reject serving dataranges that are not replicated from the replica", func(ctx SpecContext) {
+			uploadCompleteDatarange(ctx, 10, 10)
+
+			_, err := downloadSrv.PreSignDownloadForDatapoints(ctx, logger, download.PreSignDownloadForDatapointsRequest{
+				Datas3tName:    testDatas3tName,
+				FirstDatapoint: 5,
+				LastDatapoint:  15,
+				UseReplica:     true,
+			})
+			Expect(err).To(MatchError(apierror.ErrReplicaNotFound))
+		})
+	})
 })
@@ -7,10 +7,11 @@ import (
 	"log/slog"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/draganm/datas3t/apierror"
 	awsutil "github.com/draganm/datas3t/aws"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/tiering"
+	"github.com/draganm/datas3t/storage"
 	"github.com/draganm/datas3t/tarindex"
 )
 
@@ -18,15 +19,43 @@ type PreSignDownloadForDatapointsRequest struct {
 	Datas3tName    string `json:"datas3t_name"`
 	FirstDatapoint uint64 `json:"first_datapoint"`
 	LastDatapoint  uint64 `json:"last_datapoint"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+
+	// UseReplica serves all segments from the replica of the datas3t, e.g. while its
+	// bucket is unavailable. Without it only dataranges the bucket fails for are served
+	// from the replica.
+	UseReplica bool `json:"use_replica,omitempty"`
 }
 
 type DownloadSegment struct {
 	PresignedURL string `json:"presigned_url"`
 	Range        string `json:"range"`
+
+	// Headers must be sent with the request to the presigned URL, e.g. the SSE-C key of
+	// the bucket
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// ObjectKey identifies the datarange object when the URL has to be refreshed
+	ObjectKey string `json:"object_key"`
+
+	// DatarangeMinDatapointKey is the first datapoint key of the datarange of the segment
+	DatarangeMinDatapointKey int64 `json:"datarange_min_datapoint_key,omitempty"`
+
+	// WrappedDataKey is set for the segments of encrypted dataranges: the data key the
+	// content of the files is encrypted with, at positions counted from the first
+	// datapoint key of the datarange
+	WrappedDataKey string `json:"wrapped_data_key,omitempty"`
+
+	// Replica is set for segments served from the replica of the datas3t, they are
+	// refreshed from the replica as well
+	Replica bool `json:"replica,omitempty"`
 }
 
 type PreSignDownloadForDatapointsResponse struct {
-	DownloadSegments []DownloadSegment `json:"download_segments"`
+	DownloadSegments      []DownloadSegment `json:"download_segments"`
+	PresignedURLsExpireAt time.Time         `json:"presigned_urls_expire_at"`
 }
 
 func (s *DownloadServer) PreSignDownloadForDatapoints(ctx context.Context, log *slog.Logger, request PreSignDownloadForDatapointsRequest) (PreSignDownloadForDatapointsResponse, error) {
@@ -64,7 +93,7 @@ func (s *DownloadServer) PreSignDownloadForDatapoints(ctx context.Context, log *
 		}
 		
 		if !datas3tExists {
-			return PreSignDownloadForDatapointsResponse{}, fmt.Errorf("no dataranges found for datapoints %d-%d in datas3t %s", request.FirstDatapoint, request.LastDatapoint, request.Datas3tName)
+			return PreSignDownloadForDatapointsResponse{}, apierror.New(apierror.CodeDatas3tNotFound, "datas3t '%s' does not exist", request.Datas3tName)
 		}
 		
 		// Datas3t exists but no dataranges found - check if datas3t has ANY dataranges
@@ -81,87 +110,129 @@ func (s *DownloadServer) PreSignDownloadForDatapoints(ctx context.Context, log *
 		}
 		
 		// Datas3t has dataranges but none overlap with the requested range
-		return PreSignDownloadForDatapointsResponse{}, fmt.Errorf("no dataranges found for datapoints %d-%d in datas3t %s", request.FirstDatapoint, request.LastDatapoint, request.Datas3tName)
+		return PreSignDownloadForDatapointsResponse{}, apierror.New(apierror.CodeDatapointsNotFound, "no dataranges found for datapoints %d-%d in datas3t %s", request.FirstDatapoint, request.LastDatapoint, request.Datas3tName)
+	}
+
+	datarangeIDs := make([]int64, len(dataranges))
+	for i, datarange := range dataranges {
+		datarangeIDs[i] = datarange.ID
+	}
+
+	replicas, err := datarangeReplicas(ctx, queries, datarangeIDs)
+	if err != nil {
+		return PreSignDownloadForDatapointsResponse{}, err
 	}
 
 	var downloadSegments []DownloadSegment
+	expiry := s.presignExpiryFor(request.PresignExpirySeconds)
+	expiresAt := time.Now().Add(expiry)
+	restorer := tiering.NewRestorer(queries, s.restoreDays, expiresAt)
 
 	// 3. For each datarange, get the index from the disk cache and create download segments
 	for _, datarange := range dataranges {
-		// Create S3 client for this datarange
-		s3Client, err := s.createS3Client(ctx, log, datarange)
-		if err != nil {
-			return PreSignDownloadForDatapointsResponse{}, fmt.Errorf("failed to create S3 client: %w", err)
-		}
+		replica, replicated := replicas[datarange.ID]
 
-		// Create disk cache key by concatenating datas3t name and index object key
-		cacheKey := datarange.Datas3tName + datarange.IndexObjectKey
+		if request.UseReplica {
+			if !replicated {
+				return PreSignDownloadForDatapointsResponse{}, apierror.New(apierror.CodeReplicaNotFound, "datarange %d-%d of datas3t %s is not replicated", datarange.MinDatapointKey, datarange.MaxDatapointKey, request.Datas3tName)
+			}
 
-		// Get the tar index from disk cache
-		err = s.diskCache.OnIndex(cacheKey, func(index *tarindex.Index) error {
-			// Create download segments for the files we need
-			segments, err := s.createDownloadSegments(ctx, s3Client, datarange, index, request.FirstDatapoint, request.LastDatapoint)
+			segments, err := s.replicaDownloadSegments(ctx, log, replica, datarange, request.FirstDatapoint, request.LastDatapoint, expiry)
 			if err != nil {
-				return fmt.Errorf("failed to create download segments: %w", err)
+				return PreSignDownloadForDatapointsResponse{}, err
 			}
 			downloadSegments = append(downloadSegments, segments...)
-			return nil
-		}, func() ([]byte, error) {
-			// Index generator: download the index from S3 if not cached
-			return s.downloadIndexFromS3(ctx, s3Client, datarange.Bucket, datarange.IndexObjectKey)
-		})
+			continue
+		}
 
+		segments, err := s.primaryDownloadSegments(ctx, log, restorer, datarange, request.FirstDatapoint, request.LastDatapoint, expiry)
+		if err != nil && replicated {
+			log.Warn("Bucket of datas3t failed, failing over to the replica", "datarange_id", datarange.ID, "error", err)
+			segments, err = s.replicaDownloadSegments(ctx, log, replica, datarange, request.FirstDatapoint, request.LastDatapoint, expiry)
+		}
 		if err != nil {
-			return PreSignDownloadForDatapointsResponse{}, fmt.Errorf("failed to get index for datarange %d: %w", datarange.ID, err)
+			return PreSignDownloadForDatapointsResponse{}, err
 		}
+		downloadSegments = append(downloadSegments, segments...)
+	}
+
+	err = restorer.Err()
+	if err != nil {
+		return PreSignDownloadForDatapointsResponse{}, err
 	}
 
 	return PreSignDownloadForDatapointsResponse{
-		DownloadSegments: downloadSegments,
+		DownloadSegments:      downloadSegments,
+		PresignedURLsExpireAt: expiresAt,
 	}, nil
 }
 
 func (r *PreSignDownloadForDatapointsRequest) Validate() error {
 	if r.Datas3tName == "" {
-		return fmt.Errorf("datas3t_name is required")
+		return apierror.New(apierror.CodeValidationFailed, "datas3t_name is required")
 	}
 
 	if r.FirstDatapoint > r.LastDatapoint {
-		return fmt.Errorf("first_datapoint (%d) cannot be greater than last_datapoint (%d)", r.FirstDatapoint, r.LastDatapoint)
+		return apierror.New(apierror.CodeValidationFailed, "first_datapoint (%d) cannot be greater than last_datapoint (%d)", r.FirstDatapoint, r.LastDatapoint)
 	}
 
+	return validatePresignExpiry(r.PresignExpirySeconds)
+}
+
+// validatePresignExpiry checks the presign expiry of a request, 0 selects the server default
+func validatePresignExpiry(seconds int64) error {
+	maxSeconds := int64(awsutil.MaxPresignExpiry / time.Second)
+	if seconds < 0 || seconds > maxSeconds {
+		return apierror.New(apierror.CodeValidationFailed, "presign_expiry_seconds must be between 1 and %d", maxSeconds)
+	}
 	return nil
 }
 
-func (s *DownloadServer) createS3Client(ctx context.Context, log *slog.Logger, datarange postgresstore.GetDatarangesForDatapointsRow) (*s3.Client, error) {
-	// Decrypt credentials
-	accessKey, secretKey, err := s.encryptor.DecryptCredentials(datarange.AccessKey, datarange.SecretKey)
+// primaryDownloadSegments creates the download segments of a datarange from the bucket
+// of its datas3t. Archived data objects are restored before URLs to them are handed out,
+// no segments are returned while any checked datarange is being restored.
+func (s *DownloadServer) primaryDownloadSegments(ctx context.Context, log *slog.Logger, restorer *tiering.Restorer, datarange postgresstore.GetDatarangesForDatapointsRow, firstDatapoint, lastDatapoint uint64, expiry time.Duration) ([]DownloadSegment, error) {
+	// Open the object store of this datarange
+	store, err := s.openStore(ctx, log, storage.Config{
+		Endpoint:        datarange.Endpoint,
+		Bucket:          datarange.Bucket,
+		AccessKey:       datarange.AccessKey,
+		SecretKey:       datarange.SecretKey,
+		SessionToken:    datarange.SessionToken,
+		Region:          datarange.Region,
+		AddressingStyle: datarange.AddressingStyle,
+		CredentialMode:  datarange.CredentialMode,
+		ServerSideEncryption: storage.ServerSideEncryption{
+			Mode:        datarange.SseMode,
+			KMSKeyID:    datarange.SseKmsKeyID,
+			CustomerKey: datarange.SseCustomerKey,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The restores of all dataranges are requested before the download fails
+	err = restorer.Check(ctx, log, store, datarange.ID, datarange.DataObjectKey, datarange.StorageClass, datarange.RestoreExpiresAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+		return nil, err
+	}
+	if restorer.Restoring() {
+		return nil, nil
 	}
 
-	// Use shared AWS utility for S3 client creation with logging
-	return awsutil.CreateS3Client(ctx, awsutil.S3ClientConfig{
-		AccessKey: accessKey,
-		SecretKey: secretKey,
-		Endpoint:  datarange.Endpoint,
-		Logger:    log,
-		// Note: Could add a logger here if needed for debugging download operations
-	})
+	return s.indexDownloadSegments(ctx, store, datarange.DataObjectKey, datarange.IndexObjectKey, datarange, firstDatapoint, lastDatapoint, expiry)
 }
 
-func (s *DownloadServer) downloadIndexFromS3(ctx context.Context, s3Client *s3.Client, bucket, indexObjectKey string) ([]byte, error) {
-	resp, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(indexObjectKey),
-	})
+func (s *DownloadServer) downloadIndex(ctx context.Context, store storage.ObjectStore, indexObjectKey string) ([]byte, error) {
+	body, err := store.GetObject(ctx, indexObjectKey, 0, -1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get index object from S3: %w", err)
+		return nil, fmt.Errorf("failed to get index object: %w", err)
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
 	// Read the entire index file using io.ReadAll
-	indexData, err := io.ReadAll(resp.Body)
+	indexData, err := io.ReadAll(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read index data: %w", err)
 	}
@@ -169,7 +240,7 @@ func (s *DownloadServer) downloadIndexFromS3(ctx context.Context, s3Client *s3.C
 	return indexData, nil
 }
 
-func (s *DownloadServer) createDownloadSegments(ctx context.Context, s3Client *s3.Client, datarange postgresstore.GetDatarangesForDatapointsRow, index *tarindex.Index, firstDatapoint, lastDatapoint uint64) ([]DownloadSegment, error) {
+func (s *DownloadServer) createDownloadSegments(ctx context.Context, store storage.ObjectStore, dataObjectKey string, datarange postgresstore.GetDatarangesForDatapointsRow, index *tarindex.Index, firstDatapoint, lastDatapoint uint64, expiry time.Duration) ([]DownloadSegment, error) {
 	var segments []DownloadSegment
 
 	// Calculate the range of files we need to download
@@ -217,25 +288,34 @@ func (s *DownloadServer) createDownloadSegments(ctx context.Context, s3Client *s
 	endByte := lastFileMetadata.Start + lastFileHeaderSize + lastFileContentPaddedSize - 1
 
 	// Create presigned URL for the data object with byte range
-	presigner := s3.NewPresignClient(s3Client)
-	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(datarange.Bucket),
-		Key:    aws.String(datarange.DataObjectKey),
-	}, func(opts *s3.PresignOptions) {
-		opts.Expires = 24 * time.Hour // URL expires in 24 hours
-	})
+	get, err := presignGetObject(ctx, store, dataObjectKey, expiry)
 	if err != nil {
-		return nil, fmt.Errorf("failed to presign get object: %w", err)
+		return nil, err
 	}
 
-	segments = append(segments, DownloadSegment{
-		PresignedURL: req.URL,
-		Range:        fmt.Sprintf("bytes=%d-%d", startByte, endByte),
-	})
+	segment := DownloadSegment{
+		PresignedURL:             get.URL,
+		Range:                    fmt.Sprintf("bytes=%d-%d", startByte, endByte),
+		Headers:                  get.Headers,
+		ObjectKey:                datarange.DataObjectKey,
+		DatarangeMinDatapointKey: datarange.MinDatapointKey,
+		WrappedDataKey:           datarange.WrappedDataKey,
+	}
+
+	segments = append(segments, segment)
 
 	return segments, nil
 }
 
+func presignGetObject(ctx context.Context, store storage.ObjectStore, objectKey string, expiry time.Duration) (storage.PresignedRequest, error) {
+	get, err := store.PresignGetObject(ctx, objectKey, expiry)
+	if err != nil {
+		return storage.PresignedRequest{}, fmt.Errorf("failed to presign get object: %w", err)
+	}
+
+	return get, nil
+}
+
 func max(a, b uint64) uint64 {
 	if a > b {
 		return a
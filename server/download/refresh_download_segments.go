@@ -0,0 +1,176 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/tiering"
+	"github.com/draganm/datas3t/storage"
+)
+
+type RefreshDownloadSegmentsRequest struct {
+	Datas3tName string            `json:"datas3t_name"`
+	Segments    []DownloadSegment `json:"segments"`
+
+	// PresignExpirySeconds overrides how long the returned URLs stay valid
+	PresignExpirySeconds int64 `json:"presign_expiry_seconds,omitempty"`
+
+	// UseReplica refreshes all segments from the replica of the datas3t
+	UseReplica bool `json:"use_replica,omitempty"`
+}
+
+func (r *RefreshDownloadSegmentsRequest) Validate() error {
+	if r.Datas3tName == "" {
+		return apierror.New(apierror.CodeValidationFailed, "datas3t_name is required")
+	}
+
+	for i, segment := range r.Segments {
+		if segment.ObjectKey == "" {
+			return apierror.New(apierror.CodeValidationFailed, "object_key of segment %d is required", i)
+		}
+	}
+
+	return validatePresignExpiry(r.PresignExpirySeconds)
+}
+
+// RefreshDownloadSegments presigns new URLs for previously returned download segments,
+// keeping their byte ranges. It fails with ErrDatarangeNotFound when the datarange of a
+// segment no longer exists, e.g. because it was aggregated or deleted in the meantime.
+// Segments served from the replica are refreshed from it, others fail over to it when the
+// bucket of the datas3t fails.
+func (s *DownloadServer) RefreshDownloadSegments(ctx context.Context, log *slog.Logger, request RefreshDownloadSegmentsRequest) (PreSignDownloadForDatapointsResponse, error) {
+	err := request.Validate()
+	if err != nil {
+		return PreSignDownloadForDatapointsResponse{}, err
+	}
+
+	objectKeys := make([]string, len(request.Segments))
+	for i, segment := range request.Segments {
+		objectKeys[i] = segment.ObjectKey
+	}
+
+	queries := postgresstore.New(s.pgxPool)
+	dataranges, err := queries.GetDatarangesByDataObjectKeys(ctx, postgresstore.GetDatarangesByDataObjectKeysParams{
+		Datas3tName:    request.Datas3tName,
+		DataObjectKeys: objectKeys,
+	})
+	if err != nil {
+		return PreSignDownloadForDatapointsResponse{}, fmt.Errorf("failed to get dataranges: %w", err)
+	}
+
+	byObjectKey := make(map[string]postgresstore.GetDatarangesByDataObjectKeysRow, len(dataranges))
+	datarangeIDs := make([]int64, len(dataranges))
+	for i, datarange := range dataranges {
+		byObjectKey[datarange.DataObjectKey] = datarange
+		datarangeIDs[i] = datarange.ID
+	}
+
+	replicas, err := datarangeReplicas(ctx, queries, datarangeIDs)
+	if err != nil {
+		return PreSignDownloadForDatapointsResponse{}, err
+	}
+
+	expiry := s.presignExpiryFor(request.PresignExpirySeconds)
+	response := PreSignDownloadForDatapointsResponse{
+		DownloadSegments:      make([]DownloadSegment, len(request.Segments)),
+		PresignedURLsExpireAt: time.Now().Add(expiry),
+	}
+	restorer := tiering.NewRestorer(queries, s.restoreDays, response.PresignedURLsExpireAt)
+
+	for i, segment := range request.Segments {
+		datarange, found := byObjectKey[segment.ObjectKey]
+		if !found {
+			return PreSignDownloadForDatapointsResponse{}, apierror.New(apierror.CodeDatarangeNotFound, "datarange of object %s not found in datas3t %s", segment.ObjectKey, request.Datas3tName)
+		}
+
+		replica, replicated := replicas[datarange.ID]
+		useReplica := request.UseReplica || segment.Replica
+		if useReplica && !replicated {
+			return PreSignDownloadForDatapointsResponse{}, apierror.New(apierror.CodeReplicaNotFound, "datarange of object %s of datas3t %s is not replicated", segment.ObjectKey, request.Datas3tName)
+		}
+
+		var get storage.PresignedRequest
+		if !useReplica {
+			get, err = s.presignPrimaryDataObject(ctx, log, restorer, datarange, expiry)
+			if err != nil && replicated {
+				log.Warn("Bucket of datas3t failed, failing over to the replica", "datarange_id", datarange.ID, "error", err)
+				useReplica = true
+			}
+		}
+		if useReplica {
+			get, err = s.presignReplicaDataObject(ctx, log, replica, expiry)
+		}
+		if err != nil {
+			return PreSignDownloadForDatapointsResponse{}, err
+		}
+		if restorer.Restoring() {
+			continue
+		}
+
+		response.DownloadSegments[i] = DownloadSegment{
+			PresignedURL:             get.URL,
+			Range:                    segment.Range,
+			Headers:                  get.Headers,
+			ObjectKey:                segment.ObjectKey,
+			DatarangeMinDatapointKey: datarange.MinDatapointKey,
+			WrappedDataKey:           datarange.WrappedDataKey,
+			Replica:                  useReplica,
+		}
+	}
+
+	err = restorer.Err()
+	if err != nil {
+		return PreSignDownloadForDatapointsResponse{}, err
+	}
+
+	return response, nil
+}
+
+// presignPrimaryDataObject presigns the data object of a datarange in the bucket of its
+// datas3t, nothing is presigned while any checked datarange is being restored
+func (s *DownloadServer) presignPrimaryDataObject(ctx context.Context, log *slog.Logger, restorer *tiering.Restorer, datarange postgresstore.GetDatarangesByDataObjectKeysRow, expiry time.Duration) (storage.PresignedRequest, error) {
+	store, err := s.openStore(ctx, log, storage.Config{
+		Endpoint:        datarange.Endpoint,
+		Bucket:          datarange.Bucket,
+		AccessKey:       datarange.AccessKey,
+		SecretKey:       datarange.SecretKey,
+		SessionToken:    datarange.SessionToken,
+		Region:          datarange.Region,
+		AddressingStyle: datarange.AddressingStyle,
+		CredentialMode:  datarange.CredentialMode,
+		ServerSideEncryption: storage.ServerSideEncryption{
+			Mode:        datarange.SseMode,
+			KMSKeyID:    datarange.SseKmsKeyID,
+			CustomerKey: datarange.SseCustomerKey,
+		},
+	})
+	if err != nil {
+		return storage.PresignedRequest{}, err
+	}
+
+	// The datarange may have been archived since the segments were presigned
+	err = restorer.Check(ctx, log, store, datarange.ID, datarange.DataObjectKey, datarange.StorageClass, datarange.RestoreExpiresAt)
+	if err != nil {
+		return storage.PresignedRequest{}, err
+	}
+	if restorer.Restoring() {
+		return storage.PresignedRequest{}, nil
+	}
+
+	return presignGetObject(ctx, store, datarange.DataObjectKey, expiry)
+}
+
+// presignReplicaDataObject presigns the copy of a data object in the replica of its
+// datas3t
+func (s *DownloadServer) presignReplicaDataObject(ctx context.Context, log *slog.Logger, replica postgresstore.GetDatarangeReplicasRow, expiry time.Duration) (storage.PresignedRequest, error) {
+	store, err := s.openReplicaStore(ctx, log, replica)
+	if err != nil {
+		return storage.PresignedRequest{}, err
+	}
+
+	return presignGetObject(ctx, store, replica.DataObjectKey, expiry)
+}
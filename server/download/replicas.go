@@ -0,0 +1,98 @@
+package download
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/draganm/datas3t/tarindex"
+)
+
+// datarangeReplicas returns the copies of dataranges in the replicas of their datas3t by
+// datarange ID, dataranges that are not replicated yet are missing
+func datarangeReplicas(ctx context.Context, queries *postgresstore.Queries, datarangeIDs []int64) (map[int64]postgresstore.GetDatarangeReplicasRow, error) {
+	replicas, err := queries.GetDatarangeReplicas(ctx, datarangeIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get datarange replicas: %w", err)
+	}
+
+	byDatarangeID := make(map[int64]postgresstore.GetDatarangeReplicasRow, len(replicas))
+	for _, replica := range replicas {
+		byDatarangeID[replica.DatarangeID] = replica
+	}
+
+	return byDatarangeID, nil
+}
+
+// openReplicaStore opens the bucket of the replica a datarange was copied to
+func (s *DownloadServer) openReplicaStore(ctx context.Context, log *slog.Logger, replica postgresstore.GetDatarangeReplicasRow) (storage.ObjectStore, error) {
+	store, err := s.openStore(ctx, log, storage.Config{
+		Endpoint:        replica.Endpoint,
+		Bucket:          replica.Bucket,
+		AccessKey:       replica.AccessKey,
+		SecretKey:       replica.SecretKey,
+		SessionToken:    replica.SessionToken,
+		Region:          replica.Region,
+		AddressingStyle: replica.AddressingStyle,
+		CredentialMode:  replica.CredentialMode,
+		ServerSideEncryption: storage.ServerSideEncryption{
+			Mode:        replica.SseMode,
+			KMSKeyID:    replica.SseKmsKeyID,
+			CustomerKey: replica.SseCustomerKey,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bucket of replica: %w", err)
+	}
+
+	return store, nil
+}
+
+// replicaDownloadSegments creates the download segments of a datarange from its copy in
+// the replica of the datas3t
+func (s *DownloadServer) replicaDownloadSegments(ctx context.Context, log *slog.Logger, replica postgresstore.GetDatarangeReplicasRow, datarange postgresstore.GetDatarangesForDatapointsRow, firstDatapoint, lastDatapoint uint64, expiry time.Duration) ([]DownloadSegment, error) {
+	store, err := s.openReplicaStore(ctx, log, replica)
+	if err != nil {
+		return nil, err
+	}
+
+	segments, err := s.indexDownloadSegments(ctx, store, replica.DataObjectKey, replica.IndexObjectKey, datarange, firstDatapoint, lastDatapoint, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download from replica: %w", err)
+	}
+
+	for i := range segments {
+		segments[i].Replica = true
+	}
+
+	return segments, nil
+}
+
+// indexDownloadSegments creates the download segments of a datarange from the given
+// copy of its data and index objects. The index is cached under the key of the datarange,
+// both copies of it are the same.
+func (s *DownloadServer) indexDownloadSegments(ctx context.Context, store storage.ObjectStore, dataObjectKey, indexObjectKey string, datarange postgresstore.GetDatarangesForDatapointsRow, firstDatapoint, lastDatapoint uint64, expiry time.Duration) ([]DownloadSegment, error) {
+	// Create disk cache key by concatenating datas3t name and index object key
+	cacheKey := datarange.Datas3tName + datarange.IndexObjectKey
+
+	var segments []DownloadSegment
+	err := s.diskCache.OnIndex(cacheKey, func(index *tarindex.Index) error {
+		var err error
+		segments, err = s.createDownloadSegments(ctx, store, dataObjectKey, datarange, index, firstDatapoint, lastDatapoint, expiry)
+		if err != nil {
+			return fmt.Errorf("failed to create download segments: %w", err)
+		}
+		return nil
+	}, func() ([]byte, error) {
+		// Index generator: download the index from the object store if not cached
+		return s.downloadIndex(ctx, store, indexObjectKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get index for datarange %d: %w", datarange.ID, err)
+	}
+
+	return segments, nil
+}
@@ -0,0 +1,144 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/bucket"
+	"github.com/draganm/datas3t/storage"
+)
+
+const checkTimeout = 5 * time.Second
+
+// CheckResult is the outcome of a single readiness check
+type CheckResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// ReadinessReport aggregates all readiness checks; Ready is true only if every check passed
+type ReadinessReport struct {
+	Ready  bool          `json:"ready"`
+	Checks []CheckResult `json:"checks"`
+}
+
+type ReadinessRequest struct {
+	CheckBuckets bool `json:"check_buckets"`
+}
+
+func (s *HealthServer) CheckReadiness(ctx context.Context, log *slog.Logger, req *ReadinessRequest) *ReadinessReport {
+	report := &ReadinessReport{Ready: true}
+
+	add := func(name string, err error) {
+		result := CheckResult{Name: name, OK: err == nil}
+		if err != nil {
+			log.Warn("Readiness check failed", "check", name, "error", err)
+			result.Error = err.Error()
+			report.Ready = false
+		}
+		report.Checks = append(report.Checks, result)
+	}
+
+	add("database", s.checkDatabase(ctx))
+	add("migrations", s.checkMigrations(ctx))
+	add("cache_dir", s.checkCacheDir())
+
+	if req.CheckBuckets {
+		s.checkBuckets(ctx, log, add)
+	}
+
+	return report
+}
+
+func (s *HealthServer) checkDatabase(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	return s.db.Ping(ctx)
+}
+
+func (s *HealthServer) checkMigrations(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	current, err := postgresstore.New(s.db).GetSchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	if current.Dirty {
+		return fmt.Errorf("schema version %d is dirty", current.Version)
+	}
+
+	latest, err := postgresstore.LatestMigrationVersion()
+	if err != nil {
+		return err
+	}
+
+	if current.Version < latest {
+		return fmt.Errorf("schema version %d is behind latest migration %d", current.Version, latest)
+	}
+
+	return nil
+}
+
+func (s *HealthServer) checkCacheDir() error {
+	f, err := os.CreateTemp(s.cacheDir, ".readyz-*")
+	if err != nil {
+		return fmt.Errorf("cache dir is not writable: %w", err)
+	}
+
+	name := f.Name()
+	err = f.Close()
+	if err != nil {
+		os.Remove(name)
+		return fmt.Errorf("failed to close probe file: %w", err)
+	}
+
+	err = os.Remove(name)
+	if err != nil {
+		return fmt.Errorf("failed to remove probe file: %w", err)
+	}
+
+	return nil
+}
+
+func (s *HealthServer) checkBuckets(ctx context.Context, log *slog.Logger, add func(name string, err error)) {
+	queries := postgresstore.New(s.db)
+
+	buckets, err := queries.ListAllBucketsWithCredentials(ctx)
+	if err != nil {
+		add("buckets", fmt.Errorf("failed to list buckets: %w", err))
+		return
+	}
+
+	for _, b := range buckets {
+		add("bucket:"+b.Name, s.checkBucket(ctx, log, b))
+	}
+}
+
+func (s *HealthServer) checkBucket(ctx context.Context, log *slog.Logger, b postgresstore.ListAllBucketsWithCredentialsRow) error {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	store, err := s.storage.Open(ctx, log, storage.Config{
+		Endpoint:        b.Endpoint,
+		Bucket:          b.Bucket,
+		AccessKey:       b.AccessKey,
+		SecretKey:       b.SecretKey,
+		SessionToken:    b.SessionToken,
+		Region:          b.Region,
+		AddressingStyle: b.AddressingStyle,
+		CredentialMode:  b.CredentialMode,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to open object store: %w", err)
+	}
+
+	return bucket.TestStore(ctx, store, b.Bucket, b.Endpoint, b.KeyPrefix)
+}
@@ -0,0 +1,137 @@
+package health_test
+
+import (
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/health"
+	"github.com/draganm/datas3t/storage"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/testcontainers/testcontainers-go"
+	tc_postgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+var _ = Describe("HealthServer", func() {
+	var (
+		pgContainer *tc_postgres.PostgresContainer
+		db          *pgxpool.Pool
+		connStr     string
+		cacheDir    string
+		logger      *slog.Logger
+	)
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+
+		logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+		cacheDir = GinkgoT().TempDir()
+
+		pgContainer, err = tc_postgres.Run(ctx,
+			"postgres:16-alpine",
+			tc_postgres.WithDatabase("testdb"),
+			tc_postgres.WithUsername("testuser"),
+			tc_postgres.WithPassword("testpass"),
+			testcontainers.WithWaitStrategy(
+				wait.ForLog("database system is ready to accept connections").
+					WithOccurrence(2).
+					WithStartupTimeout(30*time.Second),
+			),
+			testcontainers.WithLogger(log.New(GinkgoWriter, "", 0)),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		connStr, err = pgContainer.ConnectionString(ctx, "sslmode=disable")
+		Expect(err).NotTo(HaveOccurred())
+
+		db, err = pgxpool.New(ctx, connStr)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		if db != nil {
+			db.Close()
+		}
+		if pgContainer != nil {
+			err := pgContainer.Terminate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	migrateUp := func() {
+		m, err := migrate.New("file://../../postgresstore/migrations", connStr)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = m.Up()
+		if err != nil && err != migrate.ErrNoChange {
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	checkByName := func(report *health.ReadinessReport, name string) health.CheckResult {
+		for _, c := range report.Checks {
+			if c.Name == name {
+				return c
+			}
+		}
+		Fail("check not found: " + name)
+		return health.CheckResult{}
+	}
+
+	It("should report ready when migrations are applied and cache dir is writable", func(ctx SpecContext) {
+		migrateUp()
+
+		srv := health.NewServer(db, cacheDir, &storage.Opener{})
+
+		report := srv.CheckReadiness(ctx, logger, &health.ReadinessRequest{})
+		Expect(report.Ready).To(BeTrue())
+		Expect(report.Checks).To(HaveLen(3))
+
+		entries, err := os.ReadDir(cacheDir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("should report not ready when migrations have not been applied", func(ctx SpecContext) {
+		srv := health.NewServer(db, cacheDir, &storage.Opener{})
+
+		report := srv.CheckReadiness(ctx, logger, &health.ReadinessRequest{})
+		Expect(report.Ready).To(BeFalse())
+		Expect(checkByName(report, "database").OK).To(BeTrue())
+		Expect(checkByName(report, "migrations").OK).To(BeFalse())
+	})
+
+	It("should report not ready when the cache dir is missing", func(ctx SpecContext) {
+		migrateUp()
+
+		srv := health.NewServer(db, filepath.Join(cacheDir, "missing"), &storage.Opener{})
+
+		report := srv.CheckReadiness(ctx, logger, &health.ReadinessRequest{})
+		Expect(report.Ready).To(BeFalse())
+		Expect(checkByName(report, "cache_dir").OK).To(BeFalse())
+	})
+
+	It("should report the schema migration version", func(ctx SpecContext) {
+		migrateUp()
+
+		srv := health.NewServer(db, cacheDir, &storage.Opener{})
+
+		latest, err := postgresstore.LatestMigrationVersion()
+		Expect(err).NotTo(HaveOccurred())
+
+		info, err := srv.GetVersion(ctx, logger)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(info.Version).NotTo(BeEmpty())
+		Expect(info.SchemaVersion).To(Equal(latest))
+		Expect(info.SchemaDirty).To(BeFalse())
+	})
+})
@@ -0,0 +1,21 @@
+package health
+
+import (
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type HealthServer struct {
+	db       *pgxpool.Pool
+	cacheDir string
+	// storage opens the stores of checked buckets
+	storage *storage.Opener
+}
+
+func NewServer(db *pgxpool.Pool, cacheDir string, opener *storage.Opener) *HealthServer {
+	return &HealthServer{
+		db:       db,
+		cacheDir: cacheDir,
+		storage:  opener,
+	}
+}
@@ -0,0 +1,36 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/version"
+)
+
+type VersionInfo struct {
+	Version             string `json:"version"`
+	SchemaVersion       int64  `json:"schema_version"`
+	SchemaDirty         bool   `json:"schema_dirty"`
+	LatestSchemaVersion int64  `json:"latest_schema_version"`
+}
+
+func (s *HealthServer) GetVersion(ctx context.Context, log *slog.Logger) (*VersionInfo, error) {
+	current, err := postgresstore.New(s.db).GetSchemaVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	latest, err := postgresstore.LatestMigrationVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	return &VersionInfo{
+		Version:             version.Get(),
+		SchemaVersion:       current.Version,
+		SchemaDirty:         current.Dirty,
+		LatestSchemaVersion: latest,
+	}, nil
+}
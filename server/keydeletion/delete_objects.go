@@ -8,11 +8,8 @@ import (
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	awsutil "github.com/draganm/datas3t/aws"
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
 )
 
 // deletionJob represents work to be done by a deletion worker
@@ -39,7 +36,7 @@ func (s *KeyDeletionServer) DeleteObjects(ctx context.Context, log *slog.Logger)
 
 	log.Info("Processing objects for deletion", "count", len(objects))
 
-	// Group objects by bucket to optimize S3 client creation
+	// Group objects by bucket to open each object store once
 	bucketGroups := make(map[string][]postgresstore.GetObjectsToDeleteRow)
 	for _, obj := range objects {
 		key := fmt.Sprintf("%s|%s", obj.Endpoint, obj.Bucket)
@@ -108,42 +105,39 @@ func (s *KeyDeletionServer) batchDeletionWorker(ctx context.Context, jobs <-chan
 			continue
 		}
 
-		// Create S3 client for this bucket group
+		// Open the object store for this bucket group
 		firstObj := job.bucketObjects[0]
-		s3Client, err := s.createS3Client(ctx, log, firstObj)
+		store, err := s.openStore(ctx, log, firstObj)
 		if err != nil {
-			result.err = fmt.Errorf("failed to create S3 client for %s/%s: %w", firstObj.Endpoint, firstObj.Bucket, err)
+			result.err = fmt.Errorf("failed to open object store for %s/%s: %w", firstObj.Endpoint, firstObj.Bucket, err)
 			results <- result
 			continue
 		}
 
 		// Delete objects in this bucket using batch operations
-		successfulIDs := s.batchDeleteObjects(ctx, s3Client, job.bucketObjects, log)
+		successfulIDs := s.batchDeleteObjects(ctx, store, job.bucketObjects, log)
 		result.successfulIDs = successfulIDs
 
 		results <- result
 	}
 }
 
-// createS3Client creates an S3 client using the object's bucket credentials
-func (s *KeyDeletionServer) createS3Client(ctx context.Context, log *slog.Logger, obj postgresstore.GetObjectsToDeleteRow) (*s3.Client, error) {
-	// Decrypt credentials
-	accessKey, secretKey, err := s.encryptor.DecryptCredentials(obj.AccessKey, obj.SecretKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
-	}
-
-	// Use shared AWS utility for S3 client creation with logging
-	return awsutil.CreateS3Client(ctx, awsutil.S3ClientConfig{
-		AccessKey: accessKey,
-		SecretKey: secretKey,
-		Endpoint:  obj.Endpoint,
-		Logger:    log,
+// openStore opens the object store of the object's bucket
+func (s *KeyDeletionServer) openStore(ctx context.Context, log *slog.Logger, obj postgresstore.GetObjectsToDeleteRow) (storage.ObjectStore, error) {
+	return s.storage.Open(ctx, log, storage.Config{
+		Endpoint:        obj.Endpoint,
+		Bucket:          obj.Bucket,
+		AccessKey:       obj.AccessKey,
+		SecretKey:       obj.SecretKey,
+		SessionToken:    obj.SessionToken,
+		Region:          obj.Region,
+		AddressingStyle: obj.AddressingStyle,
+		CredentialMode:  obj.CredentialMode,
 	})
 }
 
-// batchDeleteObjects deletes multiple objects from S3 using the batch DeleteObjects API
-func (s *KeyDeletionServer) batchDeleteObjects(ctx context.Context, s3Client *s3.Client, objects []postgresstore.GetObjectsToDeleteRow, log *slog.Logger) []int64 {
+// batchDeleteObjects deletes multiple objects from the object store in batches
+func (s *KeyDeletionServer) batchDeleteObjects(ctx context.Context, store storage.ObjectStore, objects []postgresstore.GetObjectsToDeleteRow, log *slog.Logger) []int64 {
 	if len(objects) == 0 {
 		return nil
 	}
@@ -160,21 +154,21 @@ func (s *KeyDeletionServer) batchDeleteObjects(ctx context.Context, s3Client *s3
 		}
 
 		batch := objects[i:end]
-		batchSuccesses := s.deleteBatch(ctx, s3Client, bucket, batch, log)
+		batchSuccesses := s.deleteBatch(ctx, store, bucket, batch, log)
 		successfulDeletions = append(successfulDeletions, batchSuccesses...)
 	}
 
 	return successfulDeletions
 }
 
-// deleteBatch deletes a single batch of objects using AWS DeleteObjects API
-func (s *KeyDeletionServer) deleteBatch(ctx context.Context, s3Client *s3.Client, bucket string, objects []postgresstore.GetObjectsToDeleteRow, log *slog.Logger) []int64 {
+// deleteBatch deletes a single batch of objects using the DeleteObjects API of the store
+func (s *KeyDeletionServer) deleteBatch(ctx context.Context, store storage.ObjectStore, bucket string, objects []postgresstore.GetObjectsToDeleteRow, log *slog.Logger) []int64 {
 	if len(objects) == 0 {
 		return nil
 	}
 
 	// Build delete request
-	var deleteObjects []types.ObjectIdentifier
+	var deleteObjects []string
 	var objectIDMap = make(map[string]int64) // Map object key to database ID
 
 	for _, obj := range objects {
@@ -183,9 +177,7 @@ func (s *KeyDeletionServer) deleteBatch(ctx context.Context, s3Client *s3.Client
 			continue
 		}
 
-		deleteObjects = append(deleteObjects, types.ObjectIdentifier{
-			Key: obj.ObjectName,
-		})
+		deleteObjects = append(deleteObjects, *obj.ObjectName)
 		objectIDMap[*obj.ObjectName] = obj.ID
 	}
 
@@ -196,14 +188,8 @@ func (s *KeyDeletionServer) deleteBatch(ctx context.Context, s3Client *s3.Client
 	log.Debug("Deleting batch of objects", "bucket", bucket, "count", len(deleteObjects))
 
 	// Execute batch delete with retry logic
-	result, err := s.executeWithRetry(ctx, func() (*s3.DeleteObjectsOutput, error) {
-		return s3Client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
-			Bucket: aws.String(bucket),
-			Delete: &types.Delete{
-				Objects: deleteObjects,
-				Quiet:   aws.Bool(false), // Return info about deleted objects
-			},
-		})
+	result, err := s.executeWithRetry(ctx, func() (*storage.DeleteResult, error) {
+		return store.DeleteObjects(ctx, deleteObjects)
 	}, log)
 
 	var successfulDeletions []int64
@@ -215,22 +201,18 @@ func (s *KeyDeletionServer) deleteBatch(ctx context.Context, s3Client *s3.Client
 
 	// Process successful deletions
 	for _, deleted := range result.Deleted {
-		if deleted.Key != nil {
-			if objectID, exists := objectIDMap[*deleted.Key]; exists {
-				successfulDeletions = append(successfulDeletions, objectID)
-				log.Debug("Successfully deleted object", "object_id", objectID, "key", *deleted.Key)
-			}
+		if objectID, exists := objectIDMap[deleted]; exists {
+			successfulDeletions = append(successfulDeletions, objectID)
+			log.Debug("Successfully deleted object", "object_id", objectID, "key", deleted)
 		}
 	}
 
 	// Log any errors from the batch operation
 	for _, deleteError := range result.Errors {
-		if deleteError.Key != nil {
-			log.Error("Failed to delete object in batch",
-				"key", *deleteError.Key,
-				"code", aws.ToString(deleteError.Code),
-				"message", aws.ToString(deleteError.Message))
-		}
+		log.Error("Failed to delete object in batch",
+			"key", deleteError.Key,
+			"code", deleteError.Code,
+			"message", deleteError.Message)
 	}
 
 	log.Info("Batch delete completed",
@@ -243,7 +225,7 @@ func (s *KeyDeletionServer) deleteBatch(ctx context.Context, s3Client *s3.Client
 }
 
 // executeWithRetry executes a function with exponential backoff retry logic
-func (s *KeyDeletionServer) executeWithRetry(ctx context.Context, operation func() (*s3.DeleteObjectsOutput, error), log *slog.Logger) (*s3.DeleteObjectsOutput, error) {
+func (s *KeyDeletionServer) executeWithRetry(ctx context.Context, operation func() (*storage.DeleteResult, error), log *slog.Logger) (*storage.DeleteResult, error) {
 	const maxRetries = 3
 	const baseDelay = 100 * time.Millisecond
 	const maxDelay = 5 * time.Second
@@ -6,26 +6,24 @@ import (
 	"time"
 
 	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type KeyDeletionServer struct {
-	db        *pgxpool.Pool
-	queries   *postgresstore.Queries
-	encryptor interface {
-		DecryptCredentials(accessKey, secretKey string) (string, string, error)
-	}
+	db          *pgxpool.Pool
+	queries     *postgresstore.Queries
 	concurrency int // Number of concurrent deletion workers
+	// storage opens the stores objects are deleted from
+	storage *storage.Opener
 }
 
-func NewServer(db *pgxpool.Pool, encryptor interface {
-	DecryptCredentials(accessKey, secretKey string) (string, string, error)
-}) *KeyDeletionServer {
+func NewServer(db *pgxpool.Pool, opener *storage.Opener) *KeyDeletionServer {
 	return &KeyDeletionServer{
 		db:          db,
 		queries:     postgresstore.New(db),
-		encryptor:   encryptor,
 		concurrency: 5, // Default to 5 concurrent workers
+		storage:     opener,
 	}
 }
 
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/draganm/datas3t/server/keydeletion"
+	"github.com/draganm/datas3t/storage"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
@@ -20,14 +21,6 @@ import (
 	"github.com/testcontainers/testcontainers-go/wait"
 )
 
-// mockCredentialEncryptor is a simple mock for testing
-type mockCredentialEncryptor struct{}
-
-func (m *mockCredentialEncryptor) DecryptCredentials(accessKey, secretKey string) (string, string, error) {
-	// For testing purposes, just return the credentials as-is
-	return accessKey, secretKey, nil
-}
-
 func TestKeyDeletion(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "KeyDeletion Suite")
@@ -82,9 +75,8 @@ var _ = Describe("KeyDeletionServer", func() {
 			Expect(err).NotTo(HaveOccurred())
 		}
 
-		// Create server instance with mock encryptor
-		mockEncryptor := &mockCredentialEncryptor{}
-		server = keydeletion.NewServer(db, mockEncryptor)
+		// The zero opener uses the credentials as they are stored
+		server = keydeletion.NewServer(db, &storage.Opener{})
 	})
 
 	AfterEach(func(ctx SpecContext) {
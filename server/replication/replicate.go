@@ -0,0 +1,209 @@
+package replication
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// maxDatarangesPerRun limits how many dataranges are copied per run
+	maxDatarangesPerRun = 100
+
+	// retryAfter is how long failed copies, and copies a stopped worker abandoned, wait
+	// before they are attempted again
+	retryAfter = 15 * time.Minute
+)
+
+// replicaStores are the opened buckets of a datas3t and of its replica
+type replicaStores struct {
+	source      storage.ObjectStore
+	destination storage.ObjectStore
+	err         error
+}
+
+// ReplicateDataranges copies the data and index objects of dataranges missing in the
+// replicas of their datas3ts and returns how many were copied. Objects are copied by S3
+// when both buckets share the endpoint and streamed through the server otherwise. The
+// outcome is recorded per datarange, failed copies are retried after a while.
+func (s *ReplicationServer) ReplicateDataranges(ctx context.Context, log *slog.Logger) (int, error) {
+	dataranges, err := s.queries.GetDatarangesToReplicate(ctx, postgresstore.GetDatarangesToReplicateParams{
+		RetryBefore: pgtype.Timestamp{
+			Time:  time.Now().UTC().Add(-retryAfter),
+			Valid: true,
+		},
+		MaxDataranges: maxDatarangesPerRun,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get dataranges to replicate: %w", err)
+	}
+
+	stores := map[int64]*replicaStores{}
+	replicated := 0
+	for _, datarange := range dataranges {
+		replicaLog := log.With("datas3t", datarange.Datas3tName, "datarange_id", datarange.ID)
+
+		rs, found := stores[datarange.ReplicaID]
+		if !found {
+			rs = s.openReplicaStores(ctx, replicaLog, datarange)
+			stores[datarange.ReplicaID] = rs
+		}
+
+		err = s.replicateDatarange(ctx, replicaLog, rs, datarange)
+		if err != nil {
+			replicaLog.Error("Failed to replicate datarange", "error", err)
+			continue
+		}
+
+		replicated++
+	}
+
+	return replicated, nil
+}
+
+// replicateDatarange copies a datarange and records the outcome
+func (s *ReplicationServer) replicateDatarange(ctx context.Context, log *slog.Logger, rs *replicaStores, datarange postgresstore.GetDatarangesToReplicateRow) error {
+	dataObjectKey := replicaObjectKey(datarange.DataObjectKey, datarange.KeyPrefix, datarange.ReplicaKeyPrefix)
+	indexObjectKey := replicaObjectKey(datarange.IndexObjectKey, datarange.KeyPrefix, datarange.ReplicaKeyPrefix)
+
+	// Recording the attempt first schedules the copies for deletion along with the
+	// datarange, should it be deleted or aggregated while they are written. Dataranges
+	// deleted in the meantime fail here.
+	err := s.queries.StartDatarangeReplication(ctx, postgresstore.StartDatarangeReplicationParams{
+		DatarangeID:    datarange.ID,
+		ReplicaID:      datarange.ReplicaID,
+		DataObjectKey:  dataObjectKey,
+		IndexObjectKey: indexObjectKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record replication start: %w", err)
+	}
+
+	serverSide, err := copyDatarange(ctx, rs, datarange, dataObjectKey, indexObjectKey)
+	if err != nil {
+		recordErr := s.queries.SetDatarangeReplicationFailed(ctx, postgresstore.SetDatarangeReplicationFailedParams{
+			LastError:   err.Error(),
+			DatarangeID: datarange.ID,
+			ReplicaID:   datarange.ReplicaID,
+		})
+		if recordErr != nil {
+			return fmt.Errorf("%w (recording the failure failed: %w)", err, recordErr)
+		}
+		return err
+	}
+
+	updated, err := s.queries.SetDatarangeReplicated(ctx, postgresstore.SetDatarangeReplicatedParams{
+		DatarangeID: datarange.ID,
+		ReplicaID:   datarange.ReplicaID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record replication: %w", err)
+	}
+
+	// The datarange or the replica was deleted while copying, after the copies were
+	// scheduled for deletion
+	if updated == 0 {
+		log.Info("Datarange or replica deleted while replicating, deleting the copies")
+		for _, key := range []string{dataObjectKey, indexObjectKey} {
+			err = rs.destination.DeleteObject(ctx, key)
+			if err != nil {
+				log.Warn("Failed to delete copy", "key", key, "error", err)
+			}
+		}
+		return nil
+	}
+
+	log.Info("Replicated datarange", "data_object_key", dataObjectKey, "server_side_copy", serverSide)
+
+	return nil
+}
+
+// copyDatarange copies the data and index objects of a datarange to the replica and
+// reports whether they were copied server-side
+func copyDatarange(ctx context.Context, rs *replicaStores, datarange postgresstore.GetDatarangesToReplicateRow, dataObjectKey, indexObjectKey string) (bool, error) {
+	if rs.err != nil {
+		return false, rs.err
+	}
+
+	// Archived objects cannot be read until they are restored
+	if storage.IsArchivedStorageClass(datarange.StorageClass) {
+		return false, fmt.Errorf("data object is archived in the %s storage class", datarange.StorageClass)
+	}
+
+	serverSide, err := storage.CopyBetweenStores(ctx, rs.source, datarange.DataObjectKey, rs.destination, dataObjectKey, datarange.SizeBytes)
+	if err != nil {
+		return false, fmt.Errorf("failed to copy data object: %w", err)
+	}
+
+	// The size of index objects is not recorded
+	indexSize, err := rs.source.HeadObject(ctx, datarange.IndexObjectKey)
+	if err != nil {
+		return false, fmt.Errorf("failed to get size of index object: %w", err)
+	}
+
+	_, err = storage.CopyBetweenStores(ctx, rs.source, datarange.IndexObjectKey, rs.destination, indexObjectKey, indexSize)
+	if err != nil {
+		return false, fmt.Errorf("failed to copy index object: %w", err)
+	}
+
+	return serverSide, nil
+}
+
+// replicaObjectKey returns the key of the copy of an object in the replica, the key
+// prefix of the bucket of the datas3t is swapped for the key prefix of the replica's
+func replicaObjectKey(key, keyPrefix, replicaKeyPrefix string) string {
+	return replicaKeyPrefix + strings.TrimPrefix(key, keyPrefix)
+}
+
+// openReplicaStores opens the bucket of a datarange's datas3t and of its replica, an
+// error is recorded as the failure of every datarange of the replica
+func (s *ReplicationServer) openReplicaStores(ctx context.Context, log *slog.Logger, datarange postgresstore.GetDatarangesToReplicateRow) *replicaStores {
+	source, err := s.storage.Open(ctx, log, storage.Config{
+		Endpoint:        datarange.Endpoint,
+		Bucket:          datarange.Bucket,
+		AccessKey:       datarange.AccessKey,
+		SecretKey:       datarange.SecretKey,
+		SessionToken:    datarange.SessionToken,
+		Region:          datarange.Region,
+		AddressingStyle: datarange.AddressingStyle,
+		CredentialMode:  datarange.CredentialMode,
+		ServerSideEncryption: storage.ServerSideEncryption{
+			Mode:        datarange.SseMode,
+			KMSKeyID:    datarange.SseKmsKeyID,
+			CustomerKey: datarange.SseCustomerKey,
+		},
+	})
+	if err != nil {
+		return &replicaStores{err: fmt.Errorf("failed to open bucket of datas3t: %w", err)}
+	}
+
+	destination, err := s.storage.Open(ctx, log, storage.Config{
+		Endpoint:        datarange.ReplicaEndpoint,
+		Bucket:          datarange.ReplicaBucket,
+		AccessKey:       datarange.ReplicaAccessKey,
+		SecretKey:       datarange.ReplicaSecretKey,
+		SessionToken:    datarange.ReplicaSessionToken,
+		Region:          datarange.ReplicaRegion,
+		AddressingStyle: datarange.ReplicaAddressingStyle,
+		CredentialMode:  datarange.ReplicaCredentialMode,
+		ServerSideEncryption: storage.ServerSideEncryption{
+			Mode:        datarange.ReplicaSseMode,
+			KMSKeyID:    datarange.ReplicaSseKmsKeyID,
+			CustomerKey: datarange.ReplicaSseCustomerKey,
+		},
+	})
+	if err != nil {
+		return &replicaStores{err: fmt.Errorf("failed to open bucket of replica: %w", err)}
+	}
+
+	return &replicaStores{
+		source:      source,
+		destination: destination,
+	}
+}
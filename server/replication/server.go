@@ -0,0 +1,66 @@
+package replication
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultInterval is how often new dataranges are copied to the replicas of their datas3ts
+const DefaultInterval = time.Minute
+
+// ReplicationServer copies the dataranges of datas3ts with a replica to the bucket of the
+// replica, including the dataranges aggregations replace others with
+type ReplicationServer struct {
+	db       *pgxpool.Pool
+	queries  *postgresstore.Queries
+	interval time.Duration
+	// storage opens the buckets of datas3ts and of their replicas
+	storage *storage.Opener
+}
+
+func NewServer(db *pgxpool.Pool, opener *storage.Opener) *ReplicationServer {
+	return &ReplicationServer{
+		db:       db,
+		queries:  postgresstore.New(db),
+		interval: DefaultInterval,
+		storage:  opener,
+	}
+}
+
+// SetInterval sets how often new dataranges are copied to the replicas
+func (s *ReplicationServer) SetInterval(interval time.Duration) {
+	s.interval = interval
+}
+
+func (s *ReplicationServer) Start(ctx context.Context, log *slog.Logger) {
+	go s.replicationWorker(ctx, log)
+}
+
+func (s *ReplicationServer) replicationWorker(ctx context.Context, log *slog.Logger) {
+	log.Info("Replication worker started", "interval", s.interval)
+
+	for {
+		replicated, err := s.ReplicateDataranges(ctx, log)
+		if err != nil {
+			log.Error("Error replicating dataranges", "error", err)
+		}
+
+		// A full batch was copied, more dataranges are likely waiting
+		interval := s.interval
+		if replicated >= maxDatarangesPerRun {
+			interval = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info("Replication worker shutting down")
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package replication_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/server/replication"
+	"github.com/draganm/datas3t/storage"
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/jackc/pgx/v5/pgxpool"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/testcontainers/testcontainers-go"
+	tc_postgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	"github.com/testcontainers/testcontainers-go/wait"
+)
+
+func TestReplication(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Replication Suite")
+}
+
+var _ = Describe("ReplicationServer", func() {
+	var (
+		server      *replication.ReplicationServer
+		pgContainer *tc_postgres.PostgresContainer
+		db          *pgxpool.Pool
+		logger      *slog.Logger
+		source      storage.ObjectStore
+		destination storage.ObjectStore
+		datas3tID   int64
+		replicaID   int64
+	)
+
+	openLocalBucket := func(ctx context.Context, endpoint string) storage.ObjectStore {
+		store, err := (&storage.Opener{}).Open(ctx, logger, storage.Config{
+			Endpoint: endpoint,
+			Bucket:   "bucket",
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return store
+	}
+
+	readObject := func(ctx context.Context, store storage.ObjectStore, key string) string {
+		body, err := store.GetObject(ctx, key, 0, -1)
+		Expect(err).NotTo(HaveOccurred())
+		defer body.Close()
+
+		data, err := io.ReadAll(body)
+		Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	addDatarange := func(ctx context.Context, minKey, maxKey int64, data, index string) int64 {
+		dataKey := fmt.Sprintf("primary/datas3t/test-datas3t/dataranges/%d-%d.tar", minKey, maxKey)
+		indexKey := strings.TrimSuffix(dataKey, ".tar") + ".index"
+
+		if data != "" {
+			err := source.PutObject(ctx, dataKey, strings.NewReader(data), int64(len(data)))
+			Expect(err).NotTo(HaveOccurred())
+			err = source.PutObject(ctx, indexKey, strings.NewReader(index), int64(len(index)))
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		var id int64
+		err := db.QueryRow(ctx,
+			`INSERT INTO dataranges (datas3t_id, data_object_key, index_object_key, min_datapoint_key, max_datapoint_key, size_bytes)
+			 VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			datas3tID, dataKey, indexKey, minKey, maxKey, max(len(data), 1)).Scan(&id)
+		Expect(err).NotTo(HaveOccurred())
+		return id
+	}
+
+	replicationStatus := func(ctx context.Context, datarangeID int64) (string, string) {
+		var status, lastError string
+		err := db.QueryRow(ctx,
+			"SELECT status, last_error FROM datarange_replications WHERE datarange_id = $1 AND replica_id = $2",
+			datarangeID, replicaID).Scan(&status, &lastError)
+		Expect(err).NotTo(HaveOccurred())
+		return status, lastError
+	}
+
+	BeforeEach(func(ctx SpecContext) {
+		var err error
+		logger = slog.New(slog.NewTextHandler(GinkgoWriter, nil))
+
+		pgContainer, err = tc_postgres.Run(ctx,
+			"postgres:16-alpine",
+			tc_postgres.WithDatabase("testdb"),
+			tc_postgres.WithUsername("testuser"),
+			tc_postgres.WithPassword("testpass"),
+			testcontainers.WithWaitStrategy(
+				wait.ForLog("database system is ready to accept connections").
+					WithOccurrence(2).
+					WithStartupTimeout(30*time.Second),
+			),
+			testcontainers.WithLogger(log.New(GinkgoWriter, "", 0)),
+		)
+		Expect(err).NotTo(HaveOccurred())
+
+		connStr, err := pgContainer.ConnectionString(ctx, "sslmode=disable")
+		Expect(err).NotTo(HaveOccurred())
+
+		db, err = pgxpool.New(ctx, connStr)
+		Expect(err).NotTo(HaveOccurred())
+
+		m, err := migrate.New("file://../../postgresstore/migrations", connStr)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = m.Up()
+		if err != nil && err != migrate.ErrNoChange {
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		// The datas3t and its replica are stored in local buckets with different key
+		// prefixes
+		primaryEndpoint := "file://" + GinkgoT().TempDir()
+		replicaEndpoint := "file://" + GinkgoT().TempDir()
+		source = openLocalBucket(ctx, primaryEndpoint)
+		destination = openLocalBucket(ctx, replicaEndpoint)
+
+		var primaryBucketID, replicaBucketID int64
+		err = db.QueryRow(ctx,
+			`INSERT INTO s3_buckets (name, endpoint, bucket, access_key, secret_key, key_prefix)
+			 VALUES ('primary', $1, 'bucket', '', '', 'primary/') RETURNING id`,
+			primaryEndpoint).Scan(&primaryBucketID)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = db.QueryRow(ctx,
+			`INSERT INTO s3_buckets (name, endpoint, bucket, access_key, secret_key, key_prefix)
+			 VALUES ('replica', $1, 'bucket', '', '', 'dr/') RETURNING id`,
+			replicaEndpoint).Scan(&replicaBucketID)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = db.QueryRow(ctx,
+			"INSERT INTO datas3ts (name, s3_bucket_id) VALUES ('test-datas3t', $1) RETURNING id",
+			primaryBucketID).Scan(&datas3tID)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = db.QueryRow(ctx,
+			"INSERT INTO datas3t_replicas (datas3t_id, s3_bucket_id) VALUES ($1, $2) RETURNING id",
+			datas3tID, replicaBucketID).Scan(&replicaID)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Local buckets need no credentials, so the zero opener is enough
+		server = replication.NewServer(db, &storage.Opener{})
+	})
+
+	AfterEach(func(ctx SpecContext) {
+		if db != nil {
+			db.Close()
+		}
+		if pgContainer != nil {
+			err := pgContainer.Terminate(ctx)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	Describe("ReplicateDataranges", func() {
+		It("should copy dataranges under the key prefix of the replica", func(ctx SpecContext) {
+			datarangeID := addDatarange(ctx, 0, 9, "data of the datarange", "index")
+
+			replicated, err := server.ReplicateDataranges(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicated).To(Equal(1))
+
+			status, lastError := replicationStatus(ctx, datarangeID)
+			Expect(status).To(Equal("replicated"))
+			Expect(lastError).To(BeEmpty())
+
+			Expect(readObject(ctx, destination, "dr/datas3t/test-datas3t/dataranges/0-9.tar")).To(Equal("data of the datarange"))
+			Expect(readObject(ctx, destination, "dr/datas3t/test-datas3t/dataranges/0-9.index")).To(Equal("index"))
+
+			// Replicated dataranges are not copied again
+			replicated, err = server.ReplicateDataranges(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicated).To(Equal(0))
+		})
+
+		It("should record failed copies", func(ctx SpecContext) {
+			datarangeID := addDatarange(ctx, 0, 9, "", "")
+
+			replicated, err := server.ReplicateDataranges(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicated).To(Equal(0))
+
+			status, lastError := replicationStatus(ctx, datarangeID)
+			Expect(status).To(Equal("failed"))
+			Expect(lastError).To(ContainSubstring("failed to copy data object"))
+
+			// Failed copies wait before they are retried
+			replicated, err = server.ReplicateDataranges(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(replicated).To(Equal(0))
+
+			var attempts int
+			err = db.QueryRow(ctx, "SELECT attempts FROM datarange_replications WHERE datarange_id = $1", datarangeID).Scan(&attempts)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(attempts).To(Equal(1))
+		})
+
+		It("should schedule the copies of deleted dataranges for deletion", func(ctx SpecContext) {
+			datarangeID := addDatarange(ctx, 0, 9, "data of the datarange", "index")
+
+			_, err := server.ReplicateDataranges(ctx, logger)
+			Expect(err).NotTo(HaveOccurred())
+
+			queries := postgresstore.New(db)
+			err = queries.ScheduleDatarangeReplicasForDeletion(ctx, []int64{datarangeID})
+			Expect(err).NotTo(HaveOccurred())
+
+			var scheduled []string
+			rows, err := db.Query(ctx, "SELECT object_name FROM objects_to_delete ORDER BY object_name")
+			Expect(err).NotTo(HaveOccurred())
+			for rows.Next() {
+				var name string
+				Expect(rows.Scan(&name)).To(Succeed())
+				scheduled = append(scheduled, name)
+			}
+			Expect(rows.Err()).NotTo(HaveOccurred())
+
+			Expect(scheduled).To(Equal([]string{
+				"dr/datas3t/test-datas3t/dataranges/0-9.index",
+				"dr/datas3t/test-datas3t/dataranges/0-9.tar",
+			}))
+		})
+	})
+})
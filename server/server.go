@@ -3,12 +3,20 @@ package server
 import (
 	"context"
 	"log/slog"
+	"net/http"
+	"time"
 
+	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/crypto"
 	"github.com/draganm/datas3t/server/bucket"
 	"github.com/draganm/datas3t/server/dataranges"
 	"github.com/draganm/datas3t/server/datas3t"
 	"github.com/draganm/datas3t/server/download"
+	"github.com/draganm/datas3t/server/health"
 	"github.com/draganm/datas3t/server/keydeletion"
+	"github.com/draganm/datas3t/server/replication"
+	"github.com/draganm/datas3t/server/tiering"
+	"github.com/draganm/datas3t/storage"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -18,40 +26,113 @@ type Server struct {
 	*dataranges.UploadDatarangeServer
 	*download.DownloadServer
 	*keydeletion.KeyDeletionServer
+	*tiering.TieringServer
+	*replication.ReplicationServer
+	*health.HealthServer
+
+	// encryptor and storage are shared by all servers, so that they decrypt credentials
+	// and open stores the same way
+	encryptor *crypto.CredentialEncryptor
+	storage   *storage.Opener
 }
 
 func NewServer(db *pgxpool.Pool, cacheDir string, maxCacheSize int64, encryptionKey string) (*Server, error) {
-	bucketServer, err := bucket.NewServer(db, encryptionKey)
+	encryptor, err := crypto.NewCredentialEncryptor(encryptionKey)
 	if err != nil {
 		return nil, err
 	}
 
-	datas3tServer, err := datas3t.NewServer(db, encryptionKey)
+	opener, err := storage.NewOpener(encryptionKey, encryptor)
 	if err != nil {
 		return nil, err
 	}
 
-	datarangesServer, err := dataranges.NewServer(db, encryptionKey)
+	downloadServer, err := download.NewServer(db, cacheDir, maxCacheSize, opener)
 	if err != nil {
 		return nil, err
 	}
 
-	downloadServer, err := download.NewServer(db, cacheDir, maxCacheSize, encryptionKey)
-	if err != nil {
-		return nil, err
-	}
-
-	keyDeletionServer := keydeletion.NewServer(db, datas3tServer.GetEncryptor())
-
 	return &Server{
-		BucketServer:          bucketServer,
-		Datas3tServer:         datas3tServer,
-		UploadDatarangeServer: datarangesServer,
+		BucketServer:          bucket.NewServer(db, encryptor, opener),
+		Datas3tServer:         datas3t.NewServer(db, opener),
+		UploadDatarangeServer: dataranges.NewServer(db, opener),
 		DownloadServer:        downloadServer,
-		KeyDeletionServer:     keyDeletionServer,
+		KeyDeletionServer:     keydeletion.NewServer(db, opener),
+		TieringServer:         tiering.NewServer(db, opener),
+		ReplicationServer:     replication.NewServer(db, opener),
+		HealthServer:          health.NewServer(db, cacheDir, opener),
+		encryptor:             encryptor,
+		storage:               opener,
 	}, nil
 }
 
+// SetPresignExpiry sets how long presigned upload and download URLs stay valid when a
+// request does not ask for a different expiry
+func (s *Server) SetPresignExpiry(expiry time.Duration) {
+	s.UploadDatarangeServer.SetPresignExpiry(expiry)
+	s.DownloadServer.SetPresignExpiry(expiry)
+}
+
+// SetRestoreDays sets how many days the copies of archived data objects restored for
+// downloads and aggregations are kept
+func (s *Server) SetRestoreDays(days int32) {
+	s.UploadDatarangeServer.SetRestoreDays(days)
+	s.DownloadServer.SetRestoreDays(days)
+}
+
+// SetTieringInterval sets how often dataranges are moved to colder storage classes
+func (s *Server) SetTieringInterval(interval time.Duration) {
+	s.TieringServer.SetInterval(interval)
+}
+
+// SetReplicationInterval sets how often new dataranges are copied to the replicas of
+// their datas3ts
+func (s *Server) SetReplicationInterval(interval time.Duration) {
+	s.ReplicationServer.SetInterval(interval)
+}
+
+// AddDecryptionKeys adds keys stored credentials encrypted before a key rotation can be
+// decrypted with. New credentials are always encrypted with the encryption key.
+func (s *Server) AddDecryptionKeys(base64Keys ...string) error {
+	return s.encryptor.AddDecryptionKeys(base64Keys...)
+}
+
+// SetCredentialSources sets where bucket credentials referring to files or environment
+// variables are read from
+func (s *Server) SetCredentialSources(sources awsutil.CredentialSources) {
+	s.storage.SetCredentialSources(sources)
+}
+
+// SetPublicURL sets the URL clients reach the server at, presigned URLs of local buckets
+// point to it
+func (s *Server) SetPublicURL(publicURL string) {
+	s.storage.SetPublicURL(publicURL)
+}
+
+// SetLocalStorageSigningKey sets the base64-encoded key the presigned URLs of local buckets
+// are signed with instead of a key derived from the encryption key, so that rotating the
+// encryption key keeps them valid
+func (s *Server) SetLocalStorageSigningKey(key string) error {
+	return s.storage.SetSigningKey(key)
+}
+
+// ServeLocalStorage serves the presigned URLs of local buckets
+func (s *Server) ServeLocalStorage(log *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	s.storage.ServeLocalStorage(log, w, r)
+}
+
 func (s *Server) StartKeyDeletionWorker(ctx context.Context, log *slog.Logger) {
 	s.KeyDeletionServer.Start(ctx, log)
 }
+
+// StartTieringWorker starts moving dataranges to colder storage classes according to
+// the storage class rules of their datas3ts
+func (s *Server) StartTieringWorker(ctx context.Context, log *slog.Logger) {
+	s.TieringServer.Start(ctx, log)
+}
+
+// StartReplicationWorker starts copying the dataranges of datas3ts with a replica to the
+// bucket of the replica
+func (s *Server) StartReplicationWorker(ctx context.Context, log *slog.Logger) {
+	s.ReplicationServer.Start(ctx, log)
+}
@@ -0,0 +1,133 @@
+package tiering
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// maxDatarangesPerRule limits how many dataranges a rule moves per run
+const maxDatarangesPerRule = 100
+
+// ApplyStorageClassRules moves the dataranges matching the storage class rules of all
+// datas3ts to the storage classes of the rules and returns how many were moved. The rules
+// of a datas3t are applied from the coldest class on, so a datarange matching several
+// rules is moved once. Dataranges are never moved to warmer classes.
+func (s *TieringServer) ApplyStorageClassRules(ctx context.Context, log *slog.Logger) (int, error) {
+	rules, err := s.queries.ListStorageClassRules(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list storage class rules: %w", err)
+	}
+
+	rulesByDatas3t := map[int64][]postgresstore.ListStorageClassRulesRow{}
+	var datas3tIDs []int64
+	for _, rule := range rules {
+		if _, found := rulesByDatas3t[rule.Datas3tID]; !found {
+			datas3tIDs = append(datas3tIDs, rule.Datas3tID)
+		}
+		rulesByDatas3t[rule.Datas3tID] = append(rulesByDatas3t[rule.Datas3tID], rule)
+	}
+
+	moved := 0
+	for _, datas3tID := range datas3tIDs {
+		datas3tRules := rulesByDatas3t[datas3tID]
+		slices.SortFunc(datas3tRules, func(a, b postgresstore.ListStorageClassRulesRow) int {
+			switch {
+			case storage.IsColderStorageClass(a.StorageClass, b.StorageClass):
+				return -1
+			case storage.IsColderStorageClass(b.StorageClass, a.StorageClass):
+				return 1
+			default:
+				return 0
+			}
+		})
+
+		// The rules of a datas3t share the bucket of the datas3t
+		store, err := s.openStore(ctx, log, datas3tRules[0])
+		if err != nil {
+			log.Error("Failed to open object store of datas3t", "datas3t", datas3tRules[0].Datas3tName, "error", err)
+			continue
+		}
+
+		for _, rule := range datas3tRules {
+			n, err := s.applyRule(ctx, log, store, rule)
+			moved += n
+			if err != nil {
+				log.Error("Failed to apply storage class rule", "datas3t", rule.Datas3tName, "storage_class", rule.StorageClass, "error", err)
+			}
+		}
+	}
+
+	return moved, nil
+}
+
+// applyRule moves the dataranges matching a rule and returns how many were moved
+func (s *TieringServer) applyRule(ctx context.Context, log *slog.Logger, store storage.ObjectStore, rule postgresstore.ListStorageClassRulesRow) (int, error) {
+	var createdBefore pgtype.Timestamp
+	if rule.MinAgeDays != nil {
+		createdBefore = pgtype.Timestamp{
+			Time:  time.Now().UTC().Add(-time.Duration(*rule.MinAgeDays) * 24 * time.Hour),
+			Valid: true,
+		}
+	}
+
+	dataranges, err := s.queries.GetDatarangesForStorageClassRule(ctx, postgresstore.GetDatarangesForStorageClassRuleParams{
+		Datas3tID:            rule.Datas3tID,
+		WarmerStorageClasses: storage.WarmerStorageClasses(rule.StorageClass),
+		CreatedBefore:        createdBefore,
+		MinKeysBehind:        rule.MinKeysBehind,
+		MaxDataranges:        maxDatarangesPerRule,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get dataranges: %w", err)
+	}
+
+	moved := 0
+	for _, datarange := range dataranges {
+		// Index objects stay in the standard class, download segments are computed from
+		// them without restoring anything
+		err = store.SetStorageClass(ctx, datarange.DataObjectKey, datarange.SizeBytes, rule.StorageClass)
+		if err != nil {
+			log.Error("Failed to move datarange to storage class", "datarange_id", datarange.ID, "storage_class", rule.StorageClass, "error", err)
+			continue
+		}
+
+		err = s.queries.SetDatarangeStorageClass(ctx, postgresstore.SetDatarangeStorageClassParams{
+			StorageClass: rule.StorageClass,
+			ID:           datarange.ID,
+		})
+		if err != nil {
+			return moved, fmt.Errorf("failed to record storage class of datarange %d: %w", datarange.ID, err)
+		}
+
+		log.Info("Moved datarange to storage class", "datas3t", rule.Datas3tName, "datarange_id", datarange.ID, "from", datarange.StorageClass, "to", rule.StorageClass)
+		moved++
+	}
+
+	return moved, nil
+}
+
+// openStore opens the object store of the bucket of a rule's datas3t
+func (s *TieringServer) openStore(ctx context.Context, log *slog.Logger, rule postgresstore.ListStorageClassRulesRow) (storage.ObjectStore, error) {
+	return s.storage.Open(ctx, log, storage.Config{
+		Endpoint:        rule.Endpoint,
+		Bucket:          rule.Bucket,
+		AccessKey:       rule.AccessKey,
+		SecretKey:       rule.SecretKey,
+		SessionToken:    rule.SessionToken,
+		Region:          rule.Region,
+		AddressingStyle: rule.AddressingStyle,
+		CredentialMode:  rule.CredentialMode,
+		ServerSideEncryption: storage.ServerSideEncryption{
+			Mode:        rule.SseMode,
+			KMSKeyID:    rule.SseKmsKeyID,
+			CustomerKey: rule.SseCustomerKey,
+		},
+	})
+}
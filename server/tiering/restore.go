@@ -0,0 +1,111 @@
+package tiering
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/draganm/datas3t/apierror"
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// DefaultRestoreDays is how many days restored copies of archived data objects are kept
+const DefaultRestoreDays = 7
+
+// Restorer makes sure the data objects of archived dataranges are restored before URLs
+// to them are handed out. Restores of all checked dataranges are requested before Err
+// reports the ones that are not readable yet, so a single request starts every restore
+// a download needs.
+type Restorer struct {
+	queries     *postgresstore.Queries
+	restoreDays int32
+	until       time.Time
+
+	checked   map[int64]bool
+	restoring []int64
+}
+
+// NewRestorer returns a Restorer for data objects that have to stay readable until the
+// given time, e.g. when presigned URLs to them expire
+func NewRestorer(queries *postgresstore.Queries, restoreDays int32, until time.Time) *Restorer {
+	return &Restorer{
+		queries:     queries,
+		restoreDays: restoreDays,
+		until:       until,
+		checked:     map[int64]bool{},
+	}
+}
+
+// Check checks whether the data object of a datarange can be read. Objects of archived
+// storage classes that are not restored long enough get a restore requested and are
+// reported by Err.
+func (r *Restorer) Check(ctx context.Context, log *slog.Logger, store storage.ObjectStore, datarangeID int64, dataObjectKey, storageClass string, restoreExpiresAt pgtype.Timestamp) error {
+	if !storage.IsArchivedStorageClass(storageClass) || r.checked[datarangeID] {
+		return nil
+	}
+	r.checked[datarangeID] = true
+
+	if restoreExpiresAt.Valid && restoreExpiresAt.Time.After(r.until) {
+		return nil
+	}
+
+	status, err := store.RestoreStatus(ctx, dataObjectKey)
+	if err != nil {
+		return fmt.Errorf("failed to get restore status of datarange %d: %w", datarangeID, err)
+	}
+
+	if status.Restored(r.until) {
+		err = r.queries.SetDatarangeRestoreExpiresAt(ctx, postgresstore.SetDatarangeRestoreExpiresAtParams{
+			RestoreExpiresAt: pgtype.Timestamp{Time: status.ExpiresAt.UTC(), Valid: true},
+			ID:               datarangeID,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record restore expiry of datarange %d: %w", datarangeID, err)
+		}
+		return nil
+	}
+
+	// A copy that expires too soon is extended by another restore request, which takes
+	// effect right away
+	readable := status.Restored(time.Now())
+	if !readable {
+		r.restoring = append(r.restoring, datarangeID)
+	}
+	if status.Ongoing {
+		return nil
+	}
+
+	err = store.RestoreObject(ctx, dataObjectKey, r.restoreDays)
+	if err != nil {
+		return fmt.Errorf("failed to restore datarange %d: %w", datarangeID, err)
+	}
+
+	err = r.queries.SetDatarangeRestoreRequested(ctx, datarangeID)
+	if err != nil {
+		return fmt.Errorf("failed to record restore of datarange %d: %w", datarangeID, err)
+	}
+
+	log.Info("Requested restore of archived datarange", "datarange_id", datarangeID, "storage_class", storageClass, "days", r.restoreDays)
+
+	return nil
+}
+
+// Restoring reports whether any checked datarange is not readable yet
+func (r *Restorer) Restoring() bool {
+	return len(r.restoring) > 0
+}
+
+// Err returns an ErrDatarangeRestoring error when any checked datarange is not readable
+// yet
+func (r *Restorer) Err() error {
+	if !r.Restoring() {
+		return nil
+	}
+
+	slices.Sort(r.restoring)
+	return apierror.New(apierror.CodeDatarangeRestoring, "%d archived dataranges are being restored, retry later: %v", len(r.restoring), r.restoring)
+}
@@ -0,0 +1,66 @@
+package tiering
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/draganm/datas3t/postgresstore"
+	"github.com/draganm/datas3t/storage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// DefaultInterval is how often the storage class rules are applied
+const DefaultInterval = time.Hour
+
+// TieringServer moves the data objects of dataranges to colder storage classes according
+// to the storage class rules of their datas3ts
+type TieringServer struct {
+	db       *pgxpool.Pool
+	queries  *postgresstore.Queries
+	interval time.Duration
+	// storage opens the stores of the datas3ts with rules
+	storage *storage.Opener
+}
+
+func NewServer(db *pgxpool.Pool, opener *storage.Opener) *TieringServer {
+	return &TieringServer{
+		db:       db,
+		queries:  postgresstore.New(db),
+		interval: DefaultInterval,
+		storage:  opener,
+	}
+}
+
+// SetInterval sets how often the storage class rules are applied
+func (s *TieringServer) SetInterval(interval time.Duration) {
+	s.interval = interval
+}
+
+func (s *TieringServer) Start(ctx context.Context, log *slog.Logger) {
+	go s.tieringWorker(ctx, log)
+}
+
+func (s *TieringServer) tieringWorker(ctx context.Context, log *slog.Logger) {
+	log.Info("Storage class tiering worker started", "interval", s.interval)
+
+	for {
+		moved, err := s.ApplyStorageClassRules(ctx, log)
+		if err != nil {
+			log.Error("Error applying storage class rules", "error", err)
+		}
+
+		// A full batch was moved, more dataranges are likely waiting
+		interval := s.interval
+		if moved >= maxDatarangesPerRule {
+			interval = time.Second
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Info("Storage class tiering worker shutting down")
+			return
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+const (
+	// Part size of the multipart uploads objects streamed between stores are written with
+	minStreamedCopyPartSize = 64 * 1024 * 1024
+	// Most parts S3 accepts in a multipart upload
+	maxMultipartUploadParts = 10000
+)
+
+// CopyBetweenStores copies an object of the given size from one store to another, e.g.
+// from the bucket of a datas3t to the bucket of its replica. When both stores are S3
+// buckets at the same endpoint the object is copied by S3 without passing through the
+// server, otherwise or when S3 refuses the copy it is streamed through the server. It
+// reports whether the object was copied server-side.
+func CopyBetweenStores(ctx context.Context, source ObjectStore, sourceKey string, destination ObjectStore, destinationKey string, size int64) (bool, error) {
+	sourceS3, sourceIsS3 := source.(*s3Store)
+	destinationS3, destinationIsS3 := destination.(*s3Store)
+
+	// The credentials of the destination have to be allowed to read the source, which
+	// is not the case for buckets of different accounts
+	if sourceIsS3 && destinationIsS3 && sourceS3.endpoint == destinationS3.endpoint {
+		err := destinationS3.copyObject(ctx, sourceS3, sourceKey, destinationKey, size, "")
+		if err == nil {
+			return true, nil
+		}
+	}
+
+	return false, streamBetweenStores(ctx, source, sourceKey, destination, destinationKey, size, minStreamedCopyPartSize)
+}
+
+// streamBetweenStores reads an object from the source and writes it to the destination,
+// objects larger than partSize with a multipart upload. Every object or part is streamed
+// within a deadline that grows with its size.
+func streamBetweenStores(ctx context.Context, source ObjectStore, sourceKey string, destination ObjectStore, destinationKey string, size, partSize int64) (err error) {
+	if size <= partSize {
+		ctx, cancel := transferDeadline(ctx, size)
+		defer cancel()
+
+		body, err := source.GetObject(ctx, sourceKey, 0, -1)
+		if err != nil {
+			return fmt.Errorf("failed to get object %s: %w", sourceKey, err)
+		}
+		defer body.Close()
+
+		err = destination.PutObject(ctx, destinationKey, body, size)
+		if err != nil {
+			return fmt.Errorf("failed to put object %s: %w", destinationKey, err)
+		}
+
+		return nil
+	}
+
+	partSize = max(partSize, (size+maxMultipartUploadParts-1)/maxMultipartUploadParts)
+
+	uploadID, err := destination.CreateMultipartUpload(ctx, destinationKey)
+	if err != nil {
+		return fmt.Errorf("failed to create multipart upload of %s: %w", destinationKey, err)
+	}
+
+	defer func() {
+		if err != nil {
+			destination.AbortMultipartUpload(ctx, destinationKey, uploadID)
+		}
+	}()
+
+	var parts []Part
+	for offset := int64(0); offset < size; offset += partSize {
+		partNumber := int32(len(parts) + 1)
+		length := min(partSize, size-offset)
+
+		etag, err := copyPart(ctx, source, sourceKey, destination, destinationKey, uploadID, partNumber, offset, length)
+		if err != nil {
+			return err
+		}
+
+		parts = append(parts, Part{
+			PartNumber: partNumber,
+			ETag:       etag,
+		})
+	}
+
+	err = destination.CompleteMultipartUpload(ctx, destinationKey, uploadID, parts)
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload of %s: %w", destinationKey, err)
+	}
+
+	return nil
+}
+
+// copyPart streams a byte range of the source object as a part of a multipart upload
+func copyPart(ctx context.Context, source ObjectStore, sourceKey string, destination ObjectStore, destinationKey, uploadID string, partNumber int32, offset, length int64) (string, error) {
+	ctx, cancel := transferDeadline(ctx, length)
+	defer cancel()
+
+	body, err := source.GetObject(ctx, sourceKey, offset, length)
+	if err != nil {
+		return "", fmt.Errorf("failed to get part %d of object %s: %w", partNumber, sourceKey, err)
+	}
+	defer body.Close()
+
+	etag, err := destination.UploadPart(ctx, destinationKey, uploadID, partNumber, &exactReader{r: body, remaining: length}, length)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload part %d of %s: %w", partNumber, destinationKey, err)
+	}
+
+	return etag, nil
+}
+
+// exactReader reads exactly remaining bytes, a source ending early fails with
+// io.ErrUnexpectedEOF instead of writing a short part
+type exactReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > e.remaining {
+		p = p[:e.remaining]
+	}
+
+	n, err := e.r.Read(p)
+	e.remaining -= int64(n)
+	if err == io.EOF && e.remaining > 0 {
+		return n, io.ErrUnexpectedEOF
+	}
+	if e.remaining == 0 && err == nil {
+		return n, io.EOF
+	}
+
+	return n, err
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCopyBetweenLocalStores(t *testing.T) {
+	ctx := context.Background()
+	opener := newTestOpener(t)
+	source := openTestStore(t, opener)
+	destination := openTestStore(t, opener)
+
+	content := "0123456789abcdefghij"
+	err := source.PutObject(ctx, "datas3t/a/dataranges/1.tar", strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	serverSide, err := CopyBetweenStores(ctx, source, "datas3t/a/dataranges/1.tar", destination, "replica/datas3t/a/dataranges/1.tar", int64(len(content)))
+	if err != nil {
+		t.Fatalf("CopyBetweenStores failed: %v", err)
+	}
+	if serverSide {
+		t.Errorf("expected local stores to be copied by streaming")
+	}
+
+	if got := readObject(t, destination, "replica/datas3t/a/dataranges/1.tar", 0, -1); got != content {
+		t.Errorf("unexpected copy content %q", got)
+	}
+
+	_, err = CopyBetweenStores(ctx, source, "missing", destination, "missing", 1)
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound copying a missing object, got %v", err)
+	}
+}
+
+func TestStreamBetweenStoresInParts(t *testing.T) {
+	ctx := context.Background()
+	opener := newTestOpener(t)
+	source := openTestStore(t, opener)
+	destination := openTestStore(t, opener)
+
+	content := "0123456789abcdefghij"
+	err := source.PutObject(ctx, "object", strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	// 3 full parts of 6 bytes and a last one of 2
+	err = streamBetweenStores(ctx, source, "object", destination, "copy", int64(len(content)), 6)
+	if err != nil {
+		t.Fatalf("streamBetweenStores failed: %v", err)
+	}
+
+	if got := readObject(t, destination, "copy", 0, -1); got != content {
+		t.Errorf("unexpected copy content %q", got)
+	}
+
+	// A failed part aborts the upload instead of leaving a partial object
+	err = streamBetweenStores(ctx, source, "object", destination, "truncated", int64(len(content))+6, 6)
+	if err == nil {
+		t.Fatalf("expected copying past the end of the object to fail")
+	}
+
+	if keys := listKeys(t, destination, "truncated"); len(keys) != 0 {
+		t.Errorf("expected no partial object, got %v", keys)
+	}
+}
@@ -0,0 +1,497 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	localEndpointScheme = "file://"
+
+	// multipartDir holds the parts of multipart uploads and partially written objects.
+	// It is skipped when listing objects.
+	multipartDir = ".multipart"
+)
+
+// localStore stores the objects of a bucket as files in a directory of the local
+// filesystem. Its presigned URLs point to the datas3t server, which serves them with
+// the opener that presigned them.
+type localStore struct {
+	dir    string
+	opener *Opener
+}
+
+// localDir returns the directory a local endpoint refers to
+func localDir(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid local endpoint %s: %w", endpoint, err)
+	}
+
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("local endpoint %s must not name a host", endpoint)
+	}
+
+	if !filepath.IsAbs(u.Path) {
+		return "", fmt.Errorf("local endpoint %s must be an absolute path like file:///var/lib/datas3t", endpoint)
+	}
+
+	return filepath.Clean(u.Path), nil
+}
+
+func openLocal(opener *Opener, cfg Config) (*localStore, error) {
+	root, err := localDir(cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Bucket == "" || cfg.Bucket != filepath.Base(cfg.Bucket) || strings.HasPrefix(cfg.Bucket, ".") {
+		return nil, fmt.Errorf("invalid local bucket name %q, it must be a directory name", cfg.Bucket)
+	}
+
+	return &localStore{
+		dir:    filepath.Join(root, cfg.Bucket),
+		opener: opener,
+	}, nil
+}
+
+// objectPath returns the file an object is stored in
+func (s *localStore) objectPath(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") || strings.HasPrefix(key, multipartDir) {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+// uploadDir returns the directory holding the parts of a multipart upload
+func (s *localStore) uploadDir(uploadID string) (string, error) {
+	_, err := hex.DecodeString(uploadID)
+	if err != nil || uploadID == "" {
+		return "", fmt.Errorf("invalid upload ID %q", uploadID)
+	}
+
+	return filepath.Join(s.dir, multipartDir, uploadID), nil
+}
+
+// writeFile writes the content of r to a temporary file and moves it to target once it is
+// complete, so that readers never see partially written objects
+func (s *localStore) writeFile(target string, r io.Reader) (_ string, err error) {
+	tmpDir := filepath.Join(s.dir, multipartDir)
+	err = os.MkdirAll(tmpDir, 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(tmpDir, "object-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		tmp.Close()
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	hash := md5.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		return "", err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.Rename(tmp.Name(), target)
+	if err != nil {
+		return "", err
+	}
+
+	return `"` + hex.EncodeToString(hash.Sum(nil)) + `"`, nil
+}
+
+func (s *localStore) PutObject(ctx context.Context, key string, body io.Reader, size int64) error {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	if size >= 0 {
+		body = io.LimitReader(body, size)
+	}
+
+	_, err = s.writeFile(p, body)
+	return err
+}
+
+func (s *localStore) open(key string) (*os.File, error) {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (s *localStore) GetObject(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	f, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if length < 0 {
+		_, err = f.Seek(offset, io.SeekStart)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+func (s *localStore) HeadObject(ctx context.Context, key string) (int64, error) {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return info.Size(), nil
+}
+
+func (s *localStore) ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	// A bucket directory is created with its first object, the directory of the endpoint
+	// must exist
+	_, err := os.Stat(filepath.Dir(s.dir))
+	if err != nil {
+		return err
+	}
+
+	var objects []ObjectInfo
+	err = filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && p == s.dir:
+			return fs.SkipAll
+		case err != nil:
+			return err
+		case d.IsDir() && p == filepath.Join(s.dir, multipartDir):
+			return fs.SkipDir
+		case d.IsDir():
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		objects = append(objects, ObjectInfo{Key: key, Size: info.Size()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	slices.SortFunc(objects, func(a, b ObjectInfo) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+
+	for _, obj := range objects {
+		err = fn(obj)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *localStore) DeleteObject(ctx context.Context, key string) error {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(p)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Remove directories left empty, like S3 does not keep empty prefixes
+	for dir := filepath.Dir(p); dir != s.dir && strings.HasPrefix(dir, s.dir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+func (s *localStore) DeleteObjects(ctx context.Context, keys []string) (*DeleteResult, error) {
+	result := &DeleteResult{}
+	for _, key := range keys {
+		err := s.DeleteObject(ctx, key)
+		if err != nil {
+			result.Errors = append(result.Errors, DeleteError{Key: key, Code: "InternalError", Message: err.Error()})
+			continue
+		}
+		result.Deleted = append(result.Deleted, key)
+	}
+
+	return result, nil
+}
+
+func (s *localStore) CopyObject(ctx context.Context, sourceKey, destinationKey string, size int64) error {
+	source, err := s.open(sourceKey)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	destination, err := s.objectPath(destinationKey)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.writeFile(destination, source)
+	return err
+}
+
+func (s *localStore) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	_, err := s.objectPath(key)
+	if err != nil {
+		return "", err
+	}
+
+	id := make([]byte, 16)
+	_, err = rand.Read(id)
+	if err != nil {
+		return "", err
+	}
+
+	uploadID := hex.EncodeToString(id)
+	err = os.MkdirAll(filepath.Join(s.dir, multipartDir, uploadID), 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	return uploadID, nil
+}
+
+// partPath returns the file a part of a multipart upload is stored in, its ETag is
+// stored next to it
+func (s *localStore) partPath(uploadID string, partNumber int32) (string, error) {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("multipart upload %s not found: %w", uploadID, err)
+	}
+
+	if partNumber < 1 || partNumber > 10000 {
+		return "", fmt.Errorf("part number %d must be between 1 and 10000", partNumber)
+	}
+
+	return filepath.Join(dir, strconv.Itoa(int(partNumber))), nil
+}
+
+func (s *localStore) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.Reader, size int64) (string, error) {
+	p, err := s.partPath(uploadID, partNumber)
+	if err != nil {
+		return "", err
+	}
+
+	if size >= 0 {
+		body = io.LimitReader(body, size)
+	}
+
+	etag, err := s.writeFile(p, body)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.WriteFile(p+".etag", []byte(etag), 0o644)
+	if err != nil {
+		return "", err
+	}
+
+	return etag, nil
+}
+
+func (s *localStore) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("multipart upload %s not found: %w", uploadID, err)
+	}
+
+	var parts []Part
+	for _, entry := range entries {
+		partNumber, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		etag, err := os.ReadFile(filepath.Join(dir, entry.Name()+".etag"))
+		if err != nil {
+			// The part is still being written
+			continue
+		}
+
+		parts = append(parts, Part{
+			PartNumber: int32(partNumber),
+			ETag:       string(etag),
+			Size:       info.Size(),
+		})
+	}
+
+	slices.SortFunc(parts, func(a, b Part) int {
+		return int(a.PartNumber - b.PartNumber)
+	})
+
+	return parts, nil
+}
+
+func (s *localStore) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	p, err := s.objectPath(key)
+	if err != nil {
+		return err
+	}
+
+	var readers []io.Reader
+	for _, part := range parts {
+		partPath, err := s.partPath(uploadID, part.PartNumber)
+		if err != nil {
+			return err
+		}
+
+		etag, err := os.ReadFile(partPath + ".etag")
+		if err != nil {
+			return fmt.Errorf("part %d was not uploaded", part.PartNumber)
+		}
+
+		if strings.Trim(string(etag), `"`) != strings.Trim(part.ETag, `"`) {
+			return fmt.Errorf("ETag of part %d does not match", part.PartNumber)
+		}
+
+		f, err := os.Open(partPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		readers = append(readers, f)
+	}
+
+	_, err = s.writeFile(p, io.MultiReader(readers...))
+	if err != nil {
+		return err
+	}
+
+	return s.AbortMultipartUpload(ctx, key, uploadID)
+}
+
+func (s *localStore) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
+
+func (s *localStore) PresignPutObject(ctx context.Context, key string, expiry time.Duration) (PresignedRequest, error) {
+	url, err := s.opener.presign(presignedRequest{method: "PUT", dir: s.dir, key: key}, expiry)
+	return PresignedRequest{URL: url}, err
+}
+
+func (s *localStore) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expiry time.Duration) (PresignedRequest, error) {
+	url, err := s.opener.presign(presignedRequest{method: "PUT", dir: s.dir, key: key, uploadID: uploadID, partNumber: partNumber}, expiry)
+	return PresignedRequest{URL: url}, err
+}
+
+func (s *localStore) PresignGetObject(ctx context.Context, key string, expiry time.Duration) (PresignedRequest, error) {
+	url, err := s.opener.presign(presignedRequest{method: "GET", dir: s.dir, key: key}, expiry)
+	return PresignedRequest{URL: url}, err
+}
+
+func (s *localStore) PresignDeleteObject(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	return s.opener.presign(presignedRequest{method: "DELETE", dir: s.dir, key: key}, expiry)
+}
+
+func (s *localStore) SetStorageClass(ctx context.Context, key string, size int64, storageClass string) error {
+	return ErrStorageClassesNotSupported
+}
+
+func (s *localStore) RestoreObject(ctx context.Context, key string, days int32) error {
+	return ErrStorageClassesNotSupported
+}
+
+// RestoreStatus reports the zero status, the objects of local buckets are never archived
+func (s *localStore) RestoreStatus(ctx context.Context, key string) (RestoreStatus, error) {
+	return RestoreStatus{}, nil
+}
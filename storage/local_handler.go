@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// ServeLocalStorage serves a URL presigned for a local bucket. Like S3 it answers GET
+// and HEAD requests with the object, honouring the Range header, stores the body of PUT
+// requests as the object or a part of a multipart upload and deletes the object on
+// DELETE requests.
+func (o *Opener) ServeLocalStorage(log *slog.Logger, w http.ResponseWriter, r *http.Request) {
+	req, err := o.verify(r.Method, r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	store := &localStore{dir: filepath.Clean(req.dir), opener: o}
+	ctx := r.Context()
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		f, err := store.open(req.key)
+		if errors.Is(err, ErrObjectNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Error("Failed to open local object", "key", req.key, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		http.ServeContent(w, r, "", time.Time{}, f)
+
+	case http.MethodPut:
+		if req.uploadID != "" {
+			etag, err := store.UploadPart(ctx, req.key, req.uploadID, req.partNumber, r.Body, r.ContentLength)
+			if err != nil {
+				log.Error("Failed to store part of local object", "key", req.key, "part_number", req.partNumber, "error", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			return
+		}
+
+		err = store.PutObject(ctx, req.key, r.Body, r.ContentLength)
+		if err != nil {
+			log.Error("Failed to store local object", "key", req.key, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+	case http.MethodDelete:
+		err = store.DeleteObject(ctx, req.key)
+		if err != nil {
+			log.Error("Failed to delete local object", "key", req.key, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
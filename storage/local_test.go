@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestOpener(t *testing.T) *Opener {
+	t.Helper()
+
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opener, err := NewOpener(base64.StdEncoding.EncodeToString(key), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return opener
+}
+
+func openTestStore(t *testing.T, opener *Opener) ObjectStore {
+	t.Helper()
+
+	store, err := opener.Open(context.Background(), slog.Default(), Config{
+		Endpoint: "file://" + t.TempDir(),
+		Bucket:   "bucket",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func readObject(t *testing.T, store ObjectStore, key string, offset, length int64) string {
+	t.Helper()
+
+	body, err := store.GetObject(context.Background(), key, offset, length)
+	if err != nil {
+		t.Fatalf("GetObject failed: %v", err)
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func listKeys(t *testing.T, store ObjectStore, prefix string) []string {
+	t.Helper()
+
+	var keys []string
+	err := store.ListObjects(context.Background(), prefix, func(obj ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ListObjects failed: %v", err)
+	}
+
+	return keys
+}
+
+func TestLocalStoreObjects(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t, newTestOpener(t))
+
+	if keys := listKeys(t, store, ""); len(keys) != 0 {
+		t.Fatalf("expected an empty bucket, got %v", keys)
+	}
+
+	err := store.PutObject(ctx, "datas3t/a/dataranges/1.tar", strings.NewReader("0123456789"), 10)
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	err = store.PutObject(ctx, "datas3t/b/dataranges/1.tar", strings.NewReader("abc"), -1)
+	if err != nil {
+		t.Fatalf("PutObject failed: %v", err)
+	}
+
+	size, err := store.HeadObject(ctx, "datas3t/a/dataranges/1.tar")
+	if err != nil {
+		t.Fatalf("HeadObject failed: %v", err)
+	}
+	if size != 10 {
+		t.Errorf("expected size 10, got %d", size)
+	}
+
+	if got := readObject(t, store, "datas3t/a/dataranges/1.tar", 0, -1); got != "0123456789" {
+		t.Errorf("unexpected object content %q", got)
+	}
+
+	if got := readObject(t, store, "datas3t/a/dataranges/1.tar", 3, 4); got != "3456" {
+		t.Errorf("unexpected range content %q", got)
+	}
+
+	if got := readObject(t, store, "datas3t/a/dataranges/1.tar", 7, -1); got != "789" {
+		t.Errorf("unexpected range content %q", got)
+	}
+
+	keys := listKeys(t, store, "datas3t/")
+	if strings.Join(keys, ",") != "datas3t/a/dataranges/1.tar,datas3t/b/dataranges/1.tar" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	keys = listKeys(t, store, "datas3t/b/")
+	if strings.Join(keys, ",") != "datas3t/b/dataranges/1.tar" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+
+	err = store.CopyObject(ctx, "datas3t/b/dataranges/1.tar", "datas3t/b/dataranges/2.tar", 3)
+	if err != nil {
+		t.Fatalf("CopyObject failed: %v", err)
+	}
+
+	if got := readObject(t, store, "datas3t/b/dataranges/2.tar", 0, -1); got != "abc" {
+		t.Errorf("unexpected copied content %q", got)
+	}
+
+	result, err := store.DeleteObjects(ctx, []string{"datas3t/b/dataranges/1.tar", "datas3t/b/dataranges/2.tar"})
+	if err != nil {
+		t.Fatalf("DeleteObjects failed: %v", err)
+	}
+	if len(result.Deleted) != 2 || len(result.Errors) != 0 {
+		t.Errorf("unexpected delete result %+v", result)
+	}
+
+	_, err = store.HeadObject(ctx, "datas3t/b/dataranges/1.tar")
+	if !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+
+	// Deleting a missing object succeeds like with S3
+	err = store.DeleteObject(ctx, "datas3t/b/dataranges/1.tar")
+	if err != nil {
+		t.Errorf("DeleteObject of a missing object failed: %v", err)
+	}
+
+	keys = listKeys(t, store, "")
+	if strings.Join(keys, ",") != "datas3t/a/dataranges/1.tar" {
+		t.Errorf("unexpected keys %v", keys)
+	}
+}
+
+func TestLocalStoreRejectsUnsafeKeys(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t, newTestOpener(t))
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "a/../../outside", "a//b", ".multipart/x"} {
+		err := store.PutObject(ctx, key, strings.NewReader("x"), 1)
+		if err == nil {
+			t.Errorf("expected PutObject of %q to fail", key)
+		}
+	}
+}
+
+func TestLocalStoreRejectsInvalidEndpoints(t *testing.T) {
+	opener := newTestOpener(t)
+
+	for _, cfg := range []Config{
+		{Endpoint: "file://relative/path", Bucket: "bucket"},
+		{Endpoint: "file://remote-host/data", Bucket: "bucket"},
+		{Endpoint: "file://" + t.TempDir(), Bucket: "../bucket"},
+		{Endpoint: "file://" + t.TempDir(), Bucket: ""},
+	} {
+		_, err := opener.Open(context.Background(), slog.Default(), cfg)
+		if err == nil {
+			t.Errorf("expected opening %+v to fail", cfg)
+		}
+	}
+}
+
+func TestLocalStoreMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	store := openTestStore(t, newTestOpener(t))
+
+	uploadID, err := store.CreateMultipartUpload(ctx, "object")
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+
+	var parts []Part
+	for i, content := range []string{"hello ", "multipart ", "world"} {
+		etag, err := store.UploadPart(ctx, "object", uploadID, int32(i+1), strings.NewReader(content), int64(len(content)))
+		if err != nil {
+			t.Fatalf("UploadPart failed: %v", err)
+		}
+		parts = append(parts, Part{PartNumber: int32(i + 1), ETag: etag})
+	}
+
+	listed, err := store.ListParts(ctx, "object", uploadID)
+	if err != nil {
+		t.Fatalf("ListParts failed: %v", err)
+	}
+	if len(listed) != 3 || listed[1].ETag != parts[1].ETag || listed[1].Size != int64(len("multipart ")) {
+		t.Errorf("unexpected parts %+v", listed)
+	}
+
+	// Parts of multipart uploads are not objects
+	if keys := listKeys(t, store, ""); len(keys) != 0 {
+		t.Errorf("expected no objects before completing the upload, got %v", keys)
+	}
+
+	err = store.CompleteMultipartUpload(ctx, "object", uploadID, []Part{{PartNumber: 1, ETag: `"wrong"`}})
+	if err == nil {
+		t.Errorf("expected completing with a wrong ETag to fail")
+	}
+
+	err = store.CompleteMultipartUpload(ctx, "object", uploadID, parts)
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload failed: %v", err)
+	}
+
+	if got := readObject(t, store, "object", 0, -1); got != "hello multipart world" {
+		t.Errorf("unexpected object content %q", got)
+	}
+
+	_, err = store.ListParts(ctx, "object", uploadID)
+	if err == nil {
+		t.Errorf("expected the completed upload to be gone")
+	}
+
+	uploadID, err = store.CreateMultipartUpload(ctx, "aborted")
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+
+	err = store.AbortMultipartUpload(ctx, "aborted", uploadID)
+	if err != nil {
+		t.Fatalf("AbortMultipartUpload failed: %v", err)
+	}
+
+	_, err = store.UploadPart(ctx, "aborted", uploadID, 1, strings.NewReader("x"), 1)
+	if err == nil {
+		t.Errorf("expected uploading a part of an aborted upload to fail")
+	}
+}
+
+func TestLocalStorePresignedURLs(t *testing.T) {
+	ctx := context.Background()
+	opener := newTestOpener(t)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		opener.ServeLocalStorage(slog.Default(), w, r)
+	}))
+	defer srv.Close()
+
+	opener.SetPublicURL(srv.URL + "/")
+	store := openTestStore(t, opener)
+
+	do := func(method, url string, body io.Reader, header http.Header) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, url, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { res.Body.Close() })
+
+		return res
+	}
+
+	put, err := store.PresignPutObject(ctx, "dir/object with spaces", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignPutObject failed: %v", err)
+	}
+	putURL := put.URL
+	if !strings.HasPrefix(putURL, srv.URL+LocalStoragePath) {
+		t.Errorf("presigned URL %s does not point to the server", putURL)
+	}
+
+	res := do(http.MethodPut, putURL, strings.NewReader("0123456789"), nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("PUT returned %s", res.Status)
+	}
+
+	get, err := store.PresignGetObject(ctx, "dir/object with spaces", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGetObject failed: %v", err)
+	}
+	getURL := get.URL
+
+	res = do(http.MethodGet, getURL, nil, http.Header{"Range": {"bytes=2-5"}})
+	data, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusPartialContent || string(data) != "2345" {
+		t.Errorf("ranged GET returned %s %q", res.Status, data)
+	}
+
+	res = do(http.MethodHead, getURL, nil, nil)
+	if res.StatusCode != http.StatusOK || res.ContentLength != 10 {
+		t.Errorf("HEAD returned %s with length %d", res.Status, res.ContentLength)
+	}
+
+	// A URL presigned for GET does not allow other methods
+	res = do(http.MethodPut, getURL, strings.NewReader("overwritten"), nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("PUT with a GET URL returned %s", res.Status)
+	}
+
+	// Tampering with the URL invalidates the signature
+	res = do(http.MethodGet, strings.Replace(getURL, "object%20with", "other%20with", 1), nil, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("GET with a tampered URL returned %s", res.Status)
+	}
+
+	expired, err := store.PresignGetObject(ctx, "dir/object with spaces", -time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGetObject failed: %v", err)
+	}
+	expiredURL := expired.URL
+
+	res = do(http.MethodGet, expiredURL, nil, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("GET with an expired URL returned %s", res.Status)
+	}
+
+	// URLs are only valid for servers with the same encryption key
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		newTestOpener(t).ServeLocalStorage(slog.Default(), w, r)
+	}))
+	defer other.Close()
+
+	res = do(http.MethodGet, strings.Replace(getURL, srv.URL, other.URL, 1), nil, nil)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("GET on a server with another key returned %s", res.Status)
+	}
+
+	uploadID, err := store.CreateMultipartUpload(ctx, "multipart")
+	if err != nil {
+		t.Fatalf("CreateMultipartUpload failed: %v", err)
+	}
+
+	part, err := store.PresignUploadPart(ctx, "multipart", uploadID, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignUploadPart failed: %v", err)
+	}
+	partURL := part.URL
+
+	res = do(http.MethodPut, partURL, bytes.NewReader([]byte("part")), nil)
+	etag := res.Header.Get("ETag")
+	if res.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("PUT of a part returned %s with ETag %q", res.Status, etag)
+	}
+
+	err = store.CompleteMultipartUpload(ctx, "multipart", uploadID, []Part{{PartNumber: 1, ETag: etag}})
+	if err != nil {
+		t.Fatalf("CompleteMultipartUpload failed: %v", err)
+	}
+
+	if got := readObject(t, store, "multipart", 0, -1); got != "part" {
+		t.Errorf("unexpected object content %q", got)
+	}
+
+	deleteURL, err := store.PresignDeleteObject(ctx, "dir/object with spaces", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignDeleteObject failed: %v", err)
+	}
+
+	res = do(http.MethodDelete, deleteURL, nil, nil)
+	if res.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE returned %s", res.Status)
+	}
+
+	res = do(http.MethodGet, getURL, nil, nil)
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("GET of a deleted object returned %s", res.Status)
+	}
+}
+
+func TestZeroOpenerCannotPresignLocalURLs(t *testing.T) {
+	store := openTestStore(t, &Opener{})
+
+	_, err := store.PresignGetObject(context.Background(), "object", time.Minute)
+	if err == nil {
+		t.Errorf("expected presigning with the zero opener to fail")
+	}
+}
+
+func TestSigningKeyIsIndependentOfEncryptionKey(t *testing.T) {
+	signingKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+	// Openers of servers before and after rotating the encryption key
+	before := newTestOpener(t)
+	after := newTestOpener(t)
+	for _, opener := range []*Opener{before, after} {
+		err := opener.SetSigningKey(signingKey)
+		if err != nil {
+			t.Fatalf("SetSigningKey failed: %v", err)
+		}
+	}
+
+	get, err := openTestStore(t, before).PresignGetObject(context.Background(), "object", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGetObject failed: %v", err)
+	}
+
+	u, err := url.Parse(get.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = after.verify(http.MethodGet, u)
+	if err != nil {
+		t.Errorf("expected an opener with the same signing key to accept the URL, got %v", err)
+	}
+
+	_, err = newTestOpener(t).verify(http.MethodGet, u)
+	if err == nil {
+		t.Errorf("expected an opener with a key derived from another encryption key to reject the URL")
+	}
+
+	err = after.SetSigningKey("not base64")
+	if err == nil {
+		t.Errorf("expected an invalid signing key to be rejected")
+	}
+}
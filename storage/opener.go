@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	awsutil "github.com/draganm/datas3t/aws"
+	"github.com/draganm/datas3t/crypto"
+)
+
+const (
+	// DefaultPublicURL is the URL clients reach the datas3t server at unless configured
+	// otherwise
+	DefaultPublicURL = "http://localhost:8765"
+
+	// LocalStoragePath is the path the datas3t server serves the presigned URLs of local
+	// buckets under
+	LocalStoragePath = "/api/v1/local-storage/"
+)
+
+// Opener opens the object stores of buckets. The URLs it presigns for local buckets point
+// to the datas3t server at the public URL, which serves them with an opener using the
+// same signing key.
+//
+// The zero Opener opens stores which cannot presign URLs for local buckets, decrypts no
+// credentials and resolves no credential references.
+type Opener struct {
+	signingKey        []byte
+	publicURL         string
+	credentialSources awsutil.CredentialSources
+	decrypter         crypto.CredentialDecrypter
+}
+
+// NewOpener creates an opener decrypting the stored credentials of buckets with the
+// decrypter and signing the URLs of local buckets with a key derived from the
+// base64-encoded encryption key of the server, unless SetSigningKey sets another one
+func NewOpener(encryptionKey string, decrypter crypto.CredentialDecrypter) (*Opener, error) {
+	signingKey, err := deriveSigningKey(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Opener{
+		signingKey: signingKey,
+		publicURL:  DefaultPublicURL,
+		decrypter:  decrypter,
+	}, nil
+}
+
+// SetSigningKey sets the base64-encoded key the URLs of local buckets are signed with.
+// Unlike the default key derived from the encryption key, it is not affected by rotating
+// the encryption key. It must be called before the server handles requests.
+func (o *Opener) SetSigningKey(key string) error {
+	signingKey, err := deriveSigningKey(key)
+	if err != nil {
+		return err
+	}
+
+	o.signingKey = signingKey
+	return nil
+}
+
+// deriveSigningKey derives the key the URLs of local buckets are signed with from a
+// base64-encoded key
+func deriveSigningKey(key string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64 key: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, decoded)
+	mac.Write([]byte("datas3t local storage"))
+
+	return mac.Sum(nil), nil
+}
+
+// SetPublicURL sets the URL clients reach the datas3t server at. It must be called before
+// the server handles requests.
+func (o *Opener) SetPublicURL(publicURL string) {
+	o.publicURL = strings.TrimSuffix(publicURL, "/")
+}
+
+// SetCredentialSources sets where the credentials of buckets referring to files or
+// environment variables are read from. It must be called before the server handles
+// requests.
+func (o *Opener) SetCredentialSources(sources awsutil.CredentialSources) {
+	o.credentialSources = sources
+}
+
+// Open opens the object store of a bucket, cfg holds the credentials of the bucket as
+// they are stored, encrypted
+func (o *Opener) Open(ctx context.Context, log *slog.Logger, cfg Config) (ObjectStore, error) {
+	if o.decrypter != nil {
+		var err error
+		cfg.AccessKey, cfg.SecretKey, err = o.decrypter.DecryptCredentials(cfg.AccessKey, cfg.SecretKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt credentials: %w", err)
+		}
+
+		cfg.SessionToken, err = o.decrypter.Decrypt(cfg.SessionToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt session token: %w", err)
+		}
+
+		cfg.ServerSideEncryption.CustomerKey, err = o.decrypter.Decrypt(cfg.ServerSideEncryption.CustomerKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt sse customer key: %w", err)
+		}
+	}
+
+	return o.OpenDecrypted(ctx, log, cfg)
+}
+
+// OpenDecrypted opens the object store of a bucket whose credentials are not encrypted,
+// e.g. of a bucket tested before it is stored
+func (o *Opener) OpenDecrypted(ctx context.Context, log *slog.Logger, cfg Config) (ObjectStore, error) {
+	if IsLocalEndpoint(cfg.Endpoint) {
+		return openLocal(o, cfg)
+	}
+
+	return openS3(ctx, log, cfg, o.credentialSources)
+}
+
+// presignedRequest is a request to a local bucket the datas3t server serves when it is
+// signed
+type presignedRequest struct {
+	method     string
+	dir        string
+	key        string
+	uploadID   string
+	partNumber int32
+	expires    int64
+}
+
+func (o *Opener) signature(r presignedRequest) string {
+	mac := hmac.New(sha256.New, o.signingKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%d\n%d", r.method, r.dir, r.key, r.uploadID, r.partNumber, r.expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (o *Opener) presign(r presignedRequest, expiry time.Duration) (string, error) {
+	if o.signingKey == nil {
+		return "", fmt.Errorf("presigning URLs of local buckets is not configured")
+	}
+
+	r.expires = time.Now().Add(expiry).Unix()
+
+	query := url.Values{}
+	query.Set("dir", r.dir)
+	query.Set("expires", strconv.FormatInt(r.expires, 10))
+	if r.uploadID != "" {
+		query.Set("upload_id", r.uploadID)
+		query.Set("part_number", strconv.Itoa(int(r.partNumber)))
+	}
+	query.Set("signature", o.signature(r))
+
+	u := url.URL{Path: LocalStoragePath + r.key}
+
+	return o.publicURL + u.EscapedPath() + "?" + query.Encode(), nil
+}
+
+// verify returns the request a presigned URL was signed for
+func (o *Opener) verify(method string, u *url.URL) (presignedRequest, error) {
+	query := u.Query()
+
+	r := presignedRequest{
+		method:   method,
+		dir:      query.Get("dir"),
+		key:      strings.TrimPrefix(u.Path, LocalStoragePath),
+		uploadID: query.Get("upload_id"),
+	}
+
+	// HEAD requests are allowed by URLs presigned for GET, like with S3
+	if method == "HEAD" {
+		r.method = "GET"
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return r, fmt.Errorf("invalid expires parameter")
+	}
+	r.expires = expires
+
+	if r.uploadID != "" {
+		partNumber, err := strconv.ParseInt(query.Get("part_number"), 10, 32)
+		if err != nil {
+			return r, fmt.Errorf("invalid part_number parameter")
+		}
+		r.partNumber = int32(partNumber)
+	}
+
+	if o.signingKey == nil || !hmac.Equal([]byte(o.signature(r)), []byte(query.Get("signature"))) {
+		return r, fmt.Errorf("signature does not match")
+	}
+
+	if time.Now().Unix() > r.expires {
+		return r, fmt.Errorf("URL expired")
+	}
+
+	return r, nil
+}
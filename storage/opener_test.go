@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log/slog"
+	"testing"
+
+	"github.com/draganm/datas3t/crypto"
+)
+
+func TestOpenerDecryptsCredentials(t *testing.T) {
+	newKey := func() string {
+		key := make([]byte, 32)
+		_, err := rand.Read(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.StdEncoding.EncodeToString(key)
+	}
+
+	key := newKey()
+	encryptor, err := crypto.NewCredentialEncryptor(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opener, err := NewOpener(key, encryptor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessKey, secretKey, err := encryptor.EncryptCredentials("access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = opener.Open(context.Background(), slog.Default(), Config{
+		Endpoint:  "file://" + t.TempDir(),
+		Bucket:    "bucket",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	// Credentials encrypted with another key cannot be decrypted
+	otherEncryptor, err := crypto.NewCredentialEncryptor(newKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessKey, secretKey, err = otherEncryptor.EncryptCredentials("access", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = opener.Open(context.Background(), slog.Default(), Config{
+		Endpoint:  "file://" + t.TempDir(),
+		Bucket:    "bucket",
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+	})
+	if err == nil {
+		t.Fatal("expected opening a bucket with credentials of another key to fail")
+	}
+}
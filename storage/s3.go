@@ -0,0 +1,501 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	awsutil "github.com/draganm/datas3t/aws"
+)
+
+const (
+	// Largest object copied with a single CopyObject call and the part size used to copy
+	// larger objects with UploadPartCopy, so that every copy request finishes in bounded time
+	copyPartSize = 256 * 1024 * 1024
+	// Slowest transfer or copy of object data that does not time out, in bytes per second
+	minTransferRate = 1024 * 1024
+)
+
+// transferDeadline bounds a request transferring or copying size bytes of object data.
+// Such requests are not bounded by the request timeout of the S3 client.
+func transferDeadline(ctx context.Context, size int64) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, awsutil.RequestTimeout+time.Duration(size/minTransferRate)*time.Second)
+}
+
+// s3Store stores the objects of a bucket in S3 compatible object storage
+type s3Store struct {
+	client    *s3.Client
+	presigner *s3.PresignClient
+	endpoint  string
+	bucket    string
+	sse       sseParams
+}
+
+func openS3(ctx context.Context, log *slog.Logger, cfg Config, credentialSources awsutil.CredentialSources) (*s3Store, error) {
+	client, err := awsutil.CreateS3Client(ctx, awsutil.S3ClientConfig{
+		AccessKey:         cfg.AccessKey,
+		SecretKey:         cfg.SecretKey,
+		SessionToken:      cfg.SessionToken,
+		Endpoint:          cfg.Endpoint,
+		Region:            cfg.Region,
+		AddressingStyle:   cfg.AddressingStyle,
+		CredentialMode:    cfg.CredentialMode,
+		CredentialSources: credentialSources,
+		Logger:            log,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sse, err := newSSEParams(cfg.ServerSideEncryption, credentialSources)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Store{
+		client:    client,
+		presigner: s3.NewPresignClient(client),
+		endpoint:  cfg.Endpoint,
+		bucket:    cfg.Bucket,
+		sse:       sse,
+	}, nil
+}
+
+// notFound translates the errors S3 reports for missing objects to ErrObjectNotFound
+func notFound(err error, key string) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return fmt.Errorf("%w: %s", ErrObjectNotFound, key)
+	}
+	return err
+}
+
+func (s *s3Store) PutObject(ctx context.Context, key string, body io.Reader, size int64) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		Body:                 body,
+		ContentLength:        aws.Int64(size),
+		ServerSideEncryption: s.sse.mode,
+		SSEKMSKeyId:          s.sse.kmsKeyID,
+		SSECustomerAlgorithm: s.sse.customerAlgorithm,
+		SSECustomerKey:       s.sse.customerKey,
+		SSECustomerKeyMD5:    s.sse.customerKeyMD5,
+	}, awsutil.WithoutRequestTimeout)
+	return err
+}
+
+func (s *s3Store) GetObject(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	input := &s3.GetObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		SSECustomerAlgorithm: s.sse.customerAlgorithm,
+		SSECustomerKey:       s.sse.customerKey,
+		SSECustomerKeyMD5:    s.sse.customerKeyMD5,
+	}
+
+	switch {
+	case length >= 0:
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	case offset > 0:
+		input.Range = aws.String(fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := s.client.GetObject(ctx, input, awsutil.WithoutRequestTimeout)
+	if err != nil {
+		return nil, notFound(err, key)
+	}
+
+	return resp.Body, nil
+}
+
+func (s *s3Store) HeadObject(ctx context.Context, key string) (int64, error) {
+	resp, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		SSECustomerAlgorithm: s.sse.customerAlgorithm,
+		SSECustomerKey:       s.sse.customerKey,
+		SSECustomerKeyMD5:    s.sse.customerKeyMD5,
+	})
+	if err != nil {
+		return 0, notFound(err, key)
+	}
+
+	return aws.ToInt64(resp.ContentLength), nil
+}
+
+func (s *s3Store) ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error {
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range page.Contents {
+			if obj.Key == nil {
+				continue
+			}
+
+			err = fn(ObjectInfo{Key: *obj.Key, Size: aws.ToInt64(obj.Size)})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *s3Store) DeleteObject(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s *s3Store) DeleteObjects(ctx context.Context, keys []string) (*DeleteResult, error) {
+	objects := make([]types.ObjectIdentifier, len(keys))
+	for i, key := range keys {
+		objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+	}
+
+	resp, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Delete: &types.Delete{
+			Objects: objects,
+			Quiet:   aws.Bool(false), // Return info about deleted objects
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DeleteResult{}
+	for _, deleted := range resp.Deleted {
+		if deleted.Key != nil {
+			result.Deleted = append(result.Deleted, *deleted.Key)
+		}
+	}
+
+	for _, deleteError := range resp.Errors {
+		result.Errors = append(result.Errors, DeleteError{
+			Key:     aws.ToString(deleteError.Key),
+			Code:    aws.ToString(deleteError.Code),
+			Message: aws.ToString(deleteError.Message),
+		})
+	}
+
+	return result, nil
+}
+
+// CopyObject copies objects larger than S3 copies in a single request in parts. The copy
+// is encrypted like the source.
+func (s *s3Store) CopyObject(ctx context.Context, sourceKey, destinationKey string, size int64) error {
+	return s.copyObject(ctx, s, sourceKey, destinationKey, size, "")
+}
+
+// copySourcePath returns the URL-encoded copy source of an object. Every segment of the
+// key is escaped, "+" included as S3 decodes it to a space.
+func copySourcePath(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+
+	return bucket + "/" + strings.Join(segments, "/")
+}
+
+// copyObject copies an object of the source store, which may be s itself, to another
+// storage class unless storageClass is empty. The source is read with its own
+// server-side encryption and the copy is encrypted with the encryption of s.
+func (s *s3Store) copyObject(ctx context.Context, source *s3Store, sourceKey, destinationKey string, size int64, storageClass types.StorageClass) (err error) {
+	copySource := copySourcePath(source.bucket, sourceKey)
+
+	if size <= copyPartSize {
+		copyCtx, cancel := transferDeadline(ctx, size)
+		defer cancel()
+
+		_, err = s.client.CopyObject(copyCtx, &s3.CopyObjectInput{
+			Bucket:                         aws.String(s.bucket),
+			Key:                            aws.String(destinationKey),
+			CopySource:                     aws.String(copySource),
+			StorageClass:                   storageClass,
+			ServerSideEncryption:           s.sse.mode,
+			SSEKMSKeyId:                    s.sse.kmsKeyID,
+			SSECustomerAlgorithm:           s.sse.customerAlgorithm,
+			SSECustomerKey:                 s.sse.customerKey,
+			SSECustomerKeyMD5:              s.sse.customerKeyMD5,
+			CopySourceSSECustomerAlgorithm: source.sse.customerAlgorithm,
+			CopySourceSSECustomerKey:       source.sse.customerKey,
+			CopySourceSSECustomerKeyMD5:    source.sse.customerKeyMD5,
+		}, awsutil.WithoutRequestTimeout)
+		return err
+	}
+
+	uploadID, err := s.createMultipartUpload(ctx, destinationKey, storageClass)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			s.AbortMultipartUpload(ctx, destinationKey, uploadID)
+		}
+	}()
+
+	partSize := max(copyPartSize, (size+maxMultipartUploadParts-1)/maxMultipartUploadParts)
+
+	var parts []Part
+	for offset := int64(0); offset < size; offset += partSize {
+		partNumber := int32(len(parts) + 1)
+		end := min(offset+partSize, size) - 1
+
+		partCtx, cancel := transferDeadline(ctx, end-offset+1)
+		partResp, err := s.client.UploadPartCopy(partCtx, &s3.UploadPartCopyInput{
+			Bucket:                         aws.String(s.bucket),
+			Key:                            aws.String(destinationKey),
+			UploadId:                       aws.String(uploadID),
+			PartNumber:                     aws.Int32(partNumber),
+			CopySource:                     aws.String(copySource),
+			CopySourceRange:                aws.String(fmt.Sprintf("bytes=%d-%d", offset, end)),
+			SSECustomerAlgorithm:           s.sse.customerAlgorithm,
+			SSECustomerKey:                 s.sse.customerKey,
+			SSECustomerKeyMD5:              s.sse.customerKeyMD5,
+			CopySourceSSECustomerAlgorithm: source.sse.customerAlgorithm,
+			CopySourceSSECustomerKey:       source.sse.customerKey,
+			CopySourceSSECustomerKeyMD5:    source.sse.customerKeyMD5,
+		}, awsutil.WithoutRequestTimeout)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to copy part %d: %w", partNumber, err)
+		}
+
+		parts = append(parts, Part{
+			PartNumber: partNumber,
+			ETag:       aws.ToString(partResp.CopyPartResult.ETag),
+		})
+	}
+
+	return s.CompleteMultipartUpload(ctx, destinationKey, uploadID, parts)
+}
+
+func (s *s3Store) CreateMultipartUpload(ctx context.Context, key string) (string, error) {
+	return s.createMultipartUpload(ctx, key, "")
+}
+
+func (s *s3Store) createMultipartUpload(ctx context.Context, key string, storageClass types.StorageClass) (string, error) {
+	resp, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		StorageClass:         storageClass,
+		ServerSideEncryption: s.sse.mode,
+		SSEKMSKeyId:          s.sse.kmsKeyID,
+		SSECustomerAlgorithm: s.sse.customerAlgorithm,
+		SSECustomerKey:       s.sse.customerKey,
+		SSECustomerKeyMD5:    s.sse.customerKeyMD5,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(resp.UploadId), nil
+}
+
+func (s *s3Store) UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.Reader, size int64) (string, error) {
+	resp, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		UploadId:             aws.String(uploadID),
+		PartNumber:           aws.Int32(partNumber),
+		Body:                 body,
+		ContentLength:        aws.Int64(size),
+		SSECustomerAlgorithm: s.sse.customerAlgorithm,
+		SSECustomerKey:       s.sse.customerKey,
+		SSECustomerKeyMD5:    s.sse.customerKeyMD5,
+	}, awsutil.WithoutRequestTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	return aws.ToString(resp.ETag), nil
+}
+
+func (s *s3Store) ListParts(ctx context.Context, key, uploadID string) ([]Part, error) {
+	paginator := s3.NewListPartsPaginator(s.client, &s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+
+	var parts []Part
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, part := range page.Parts {
+			parts = append(parts, Part{
+				PartNumber: aws.ToInt32(part.PartNumber),
+				ETag:       aws.ToString(part.ETag),
+				Size:       aws.ToInt64(part.Size),
+			})
+		}
+	}
+
+	return parts, nil
+}
+
+func (s *s3Store) CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error {
+	completedParts := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completedParts[i] = types.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int32(part.PartNumber),
+		}
+	}
+
+	_, err := s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: completedParts,
+		},
+	})
+	return err
+}
+
+func (s *s3Store) AbortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	_, err := s.client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	return err
+}
+
+// PresignPutObject signs the server-side encryption headers into the URL, the client has
+// to send them with the upload
+func (s *s3Store) PresignPutObject(ctx context.Context, key string, expiry time.Duration) (PresignedRequest, error) {
+	req, err := s.presigner.PresignPutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		ServerSideEncryption: s.sse.mode,
+		SSEKMSKeyId:          s.sse.kmsKeyID,
+		SSECustomerAlgorithm: s.sse.customerAlgorithm,
+		SSECustomerKey:       s.sse.customerKey,
+		SSECustomerKeyMD5:    s.sse.customerKeyMD5,
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	return PresignedRequest{URL: req.URL, Headers: presignedRequestHeaders(req.SignedHeader)}, nil
+}
+
+func (s *s3Store) PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expiry time.Duration) (PresignedRequest, error) {
+	req, err := s.presigner.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		UploadId:             aws.String(uploadID),
+		PartNumber:           aws.Int32(partNumber),
+		SSECustomerAlgorithm: s.sse.customerAlgorithm,
+		SSECustomerKey:       s.sse.customerKey,
+		SSECustomerKeyMD5:    s.sse.customerKeyMD5,
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	return PresignedRequest{URL: req.URL, Headers: presignedRequestHeaders(req.SignedHeader)}, nil
+}
+
+func (s *s3Store) PresignGetObject(ctx context.Context, key string, expiry time.Duration) (PresignedRequest, error) {
+	req, err := s.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		SSECustomerAlgorithm: s.sse.customerAlgorithm,
+		SSECustomerKey:       s.sse.customerKey,
+		SSECustomerKeyMD5:    s.sse.customerKeyMD5,
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return PresignedRequest{}, err
+	}
+
+	return PresignedRequest{URL: req.URL, Headers: presignedRequestHeaders(req.SignedHeader)}, nil
+}
+
+func (s *s3Store) PresignDeleteObject(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	req, err := s.presigner.PresignDeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL, nil
+}
+
+// SetStorageClass copies the object onto itself in the new storage class, which S3 allows
+// since the copy differs from the source
+func (s *s3Store) SetStorageClass(ctx context.Context, key string, size int64, storageClass string) error {
+	err := ValidateStorageClass(storageClass)
+	if err != nil {
+		return err
+	}
+
+	return s.copyObject(ctx, s, key, key, size, types.StorageClass(storageClass))
+}
+
+func (s *s3Store) RestoreObject(ctx context.Context, key string, days int32) error {
+	_, err := s.client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		RestoreRequest: &types.RestoreRequest{
+			Days: aws.Int32(days),
+			GlacierJobParameters: &types.GlacierJobParameters{
+				Tier: types.TierStandard,
+			},
+		},
+	})
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && apiErr.ErrorCode() == "RestoreAlreadyInProgress" {
+		return nil
+	}
+
+	return notFound(err, key)
+}
+
+func (s *s3Store) RestoreStatus(ctx context.Context, key string) (RestoreStatus, error) {
+	resp, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		SSECustomerAlgorithm: s.sse.customerAlgorithm,
+		SSECustomerKey:       s.sse.customerKey,
+		SSECustomerKeyMD5:    s.sse.customerKeyMD5,
+	})
+	if err != nil {
+		return RestoreStatus{}, notFound(err, key)
+	}
+
+	return parseRestoreHeader(aws.ToString(resp.Restore))
+}
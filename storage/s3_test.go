@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	awsutil "github.com/draganm/datas3t/aws"
+)
+
+func TestCopySourcePath(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+		want string
+	}{
+		{name: "plain key", key: "datas3t/dataranges/0001.tar", want: "bucket/datas3t/dataranges/0001.tar"},
+		{name: "reserved characters", key: "dir/a+b c%d.tar", want: "bucket/dir/a%2Bb%20c%25d.tar"},
+		{name: "escaped slash", key: "a%2Fb/c", want: "bucket/a%252Fb/c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := copySourcePath("bucket", tt.key)
+			if got != tt.want {
+				t.Errorf("copySourcePath(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransferDeadline(t *testing.T) {
+	tests := []struct {
+		name string
+		size int64
+		want time.Duration
+	}{
+		{name: "empty", size: 0, want: awsutil.RequestTimeout},
+		{name: "copy part", size: copyPartSize, want: awsutil.RequestTimeout + 256*time.Second},
+		{name: "streamed part", size: minStreamedCopyPartSize, want: awsutil.RequestTimeout + 64*time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := transferDeadline(context.Background(), tt.size)
+			defer cancel()
+
+			deadline, ok := ctx.Deadline()
+			if !ok {
+				t.Fatal("expected a deadline")
+			}
+
+			if remaining := time.Until(deadline); remaining > tt.want || remaining < tt.want-time.Second {
+				t.Errorf("transferDeadline(%d) leaves %s, want %s", tt.size, remaining, tt.want)
+			}
+		})
+	}
+}
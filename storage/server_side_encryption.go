@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	awsutil "github.com/draganm/datas3t/aws"
+)
+
+// sseCustomerKeySize is the size of the AES-256 keys of SSEModeCustomer
+const sseCustomerKeySize = 32
+
+// Validate checks the settings of the server-side encryption of a bucket at endpoint
+func (sse ServerSideEncryption) Validate(endpoint string) error {
+	switch sse.Mode {
+	case "":
+	case SSEModeS3, SSEModeKMS, SSEModeCustomer:
+		if IsLocalEndpoint(endpoint) {
+			return fmt.Errorf("server-side encryption is not supported by local buckets")
+		}
+	default:
+		return fmt.Errorf("invalid sse_mode %q, must be empty, %q, %q or %q", sse.Mode, SSEModeS3, SSEModeKMS, SSEModeCustomer)
+	}
+
+	if sse.KMSKeyID != "" && sse.Mode != SSEModeKMS {
+		return fmt.Errorf("sse_kms_key_id is only used with the %q sse_mode", SSEModeKMS)
+	}
+
+	if sse.Mode != SSEModeCustomer {
+		if sse.CustomerKey != "" {
+			return fmt.Errorf("sse_customer_key is only used with the %q sse_mode", SSEModeCustomer)
+		}
+		return nil
+	}
+
+	// S3 refuses customer keys sent over plain HTTP
+	if !strings.HasPrefix(endpoint, "https://") {
+		return fmt.Errorf("the %q sse_mode requires an https endpoint", SSEModeCustomer)
+	}
+
+	if sse.CustomerKey == "" {
+		return fmt.Errorf("sse_customer_key is required with the %q sse_mode", SSEModeCustomer)
+	}
+
+	if awsutil.IsCredentialReference(sse.CustomerKey) {
+		return awsutil.ValidateCredentialReference(sse.CustomerKey)
+	}
+
+	_, err := decodeCustomerKey(sse.CustomerKey)
+	return err
+}
+
+func decodeCustomerKey(customerKey string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(customerKey)
+	if err != nil {
+		return nil, fmt.Errorf("sse_customer_key must be base64-encoded: %w", err)
+	}
+
+	if len(key) != sseCustomerKeySize {
+		return nil, fmt.Errorf("sse_customer_key must be %d bytes long, got %d", sseCustomerKeySize, len(key))
+	}
+
+	return key, nil
+}
+
+// sseParams holds the server-side encryption of a bucket in the form the requests of the
+// S3 API take it. Requests writing objects carry all parameters, requests reading objects
+// or uploading parts only the customer key.
+type sseParams struct {
+	mode     types.ServerSideEncryption
+	kmsKeyID *string
+
+	customerAlgorithm *string
+	customerKey       *string
+	customerKeyMD5    *string
+}
+
+// newSSEParams resolves the customer key of sse when it refers to a file or an
+// environment variable
+func newSSEParams(sse ServerSideEncryption, credentialSources awsutil.CredentialSources) (sseParams, error) {
+	switch sse.Mode {
+	case "":
+		return sseParams{}, nil
+	case SSEModeS3:
+		return sseParams{mode: types.ServerSideEncryptionAes256}, nil
+	case SSEModeKMS:
+		p := sseParams{mode: types.ServerSideEncryptionAwsKms}
+		if sse.KMSKeyID != "" {
+			p.kmsKeyID = aws.String(sse.KMSKeyID)
+		}
+		return p, nil
+	case SSEModeCustomer:
+		customerKey, err := credentialSources.Resolve(sse.CustomerKey)
+		if err != nil {
+			return sseParams{}, fmt.Errorf("failed to resolve sse customer key: %w", err)
+		}
+
+		key, err := decodeCustomerKey(customerKey)
+		if err != nil {
+			return sseParams{}, err
+		}
+
+		keyMD5 := md5.Sum(key)
+
+		return sseParams{
+			customerAlgorithm: aws.String(string(types.ServerSideEncryptionAes256)),
+			customerKey:       aws.String(customerKey),
+			customerKeyMD5:    aws.String(base64.StdEncoding.EncodeToString(keyMD5[:])),
+		}, nil
+	default:
+		return sseParams{}, fmt.Errorf("invalid sse mode %q", sse.Mode)
+	}
+}
+
+// presignedRequestHeaders returns the headers a presigned request was signed with, which
+// the client has to send along. The host is taken from the URL.
+func presignedRequestHeaders(signed http.Header) map[string]string {
+	var headers map[string]string
+	for name, values := range signed {
+		if strings.EqualFold(name, "Host") || len(values) == 0 {
+			continue
+		}
+
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		headers[name] = values[0]
+	}
+
+	return headers
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testCustomerKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestServerSideEncryptionValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint string
+		sse      ServerSideEncryption
+		wantErr  string
+	}{
+		{name: "no encryption", endpoint: "http://minio:9000"},
+		{name: "no encryption of a local bucket", endpoint: "file:///data"},
+		{name: "sse-s3", endpoint: "http://minio:9000", sse: ServerSideEncryption{Mode: SSEModeS3}},
+		{name: "sse-kms with the default key", endpoint: "https://s3.amazonaws.com", sse: ServerSideEncryption{Mode: SSEModeKMS}},
+		{name: "sse-kms with a key", endpoint: "https://s3.amazonaws.com", sse: ServerSideEncryption{Mode: SSEModeKMS, KMSKeyID: "alias/datas3t"}},
+		{name: "sse-c", endpoint: "https://s3.amazonaws.com", sse: ServerSideEncryption{Mode: SSEModeCustomer, CustomerKey: testCustomerKey}},
+		{name: "sse-c with a key reference", endpoint: "https://s3.amazonaws.com", sse: ServerSideEncryption{Mode: SSEModeCustomer, CustomerKey: "env:SSE_KEY"}},
+		{
+			name:     "unknown mode",
+			endpoint: "https://s3.amazonaws.com",
+			sse:      ServerSideEncryption{Mode: "aes"},
+			wantErr:  "invalid sse_mode",
+		},
+		{
+			name:     "local bucket",
+			endpoint: "file:///data",
+			sse:      ServerSideEncryption{Mode: SSEModeS3},
+			wantErr:  "not supported by local buckets",
+		},
+		{
+			name:     "kms key without sse-kms",
+			endpoint: "https://s3.amazonaws.com",
+			sse:      ServerSideEncryption{Mode: SSEModeS3, KMSKeyID: "alias/datas3t"},
+			wantErr:  "sse_kms_key_id is only used",
+		},
+		{
+			name:     "customer key without sse-c",
+			endpoint: "https://s3.amazonaws.com",
+			sse:      ServerSideEncryption{CustomerKey: testCustomerKey},
+			wantErr:  "sse_customer_key is only used",
+		},
+		{
+			name:     "sse-c over http",
+			endpoint: "http://minio:9000",
+			sse:      ServerSideEncryption{Mode: SSEModeCustomer, CustomerKey: testCustomerKey},
+			wantErr:  "requires an https endpoint",
+		},
+		{
+			name:     "sse-c without a key",
+			endpoint: "https://s3.amazonaws.com",
+			sse:      ServerSideEncryption{Mode: SSEModeCustomer},
+			wantErr:  "sse_customer_key is required",
+		},
+		{
+			name:     "sse-c with a short key",
+			endpoint: "https://s3.amazonaws.com",
+			sse:      ServerSideEncryption{Mode: SSEModeCustomer, CustomerKey: base64.StdEncoding.EncodeToString([]byte("short"))},
+			wantErr:  "must be 32 bytes long",
+		},
+		{
+			name:     "sse-c with a key that is not base64",
+			endpoint: "https://s3.amazonaws.com",
+			sse:      ServerSideEncryption{Mode: SSEModeCustomer, CustomerKey: "not base64!"},
+			wantErr:  "must be base64-encoded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sse.Validate(tt.endpoint)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func openTestS3Store(t *testing.T, sse ServerSideEncryption) ObjectStore {
+	t.Helper()
+
+	// A CA bundle cannot be applied to the HTTP client of S3 stores, presigning needs none
+	t.Setenv("AWS_CA_BUNDLE", "")
+
+	store, err := (&Opener{}).Open(context.Background(), slog.Default(), Config{
+		Endpoint:             "https://s3.example.com",
+		Bucket:               "bucket",
+		AccessKey:            "access",
+		SecretKey:            "secret",
+		ServerSideEncryption: sse,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestPresignedPutCarriesSSEKMSHeaders(t *testing.T) {
+	ctx := context.Background()
+	store := openTestS3Store(t, ServerSideEncryption{Mode: SSEModeKMS, KMSKeyID: "alias/datas3t"})
+
+	put, err := store.PresignPutObject(ctx, "object", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignPutObject failed: %v", err)
+	}
+
+	if put.Headers["X-Amz-Server-Side-Encryption"] != "aws:kms" {
+		t.Errorf("expected the PUT to request sse-kms, got headers %v", put.Headers)
+	}
+	if put.Headers["X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"] != "alias/datas3t" {
+		t.Errorf("expected the PUT to name the KMS key, got headers %v", put.Headers)
+	}
+
+	// S3 rejects the encryption headers on requests that do not create objects
+	get, err := store.PresignGetObject(ctx, "object", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGetObject failed: %v", err)
+	}
+	if len(get.Headers) != 0 {
+		t.Errorf("expected no headers for the GET, got %v", get.Headers)
+	}
+
+	part, err := store.PresignUploadPart(ctx, "object", "upload", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignUploadPart failed: %v", err)
+	}
+	if len(part.Headers) != 0 {
+		t.Errorf("expected no headers for the part upload, got %v", part.Headers)
+	}
+}
+
+func TestPresignedRequestsCarrySSECustomerKey(t *testing.T) {
+	ctx := context.Background()
+	store := openTestS3Store(t, ServerSideEncryption{Mode: SSEModeCustomer, CustomerKey: testCustomerKey})
+
+	keyMD5 := md5.Sum([]byte("0123456789abcdef0123456789abcdef"))
+	want := map[string]string{
+		"X-Amz-Server-Side-Encryption-Customer-Algorithm": "AES256",
+		"X-Amz-Server-Side-Encryption-Customer-Key":       testCustomerKey,
+		"X-Amz-Server-Side-Encryption-Customer-Key-Md5":   base64.StdEncoding.EncodeToString(keyMD5[:]),
+	}
+
+	put, err := store.PresignPutObject(ctx, "object", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignPutObject failed: %v", err)
+	}
+
+	part, err := store.PresignUploadPart(ctx, "object", "upload", 1, time.Minute)
+	if err != nil {
+		t.Fatalf("PresignUploadPart failed: %v", err)
+	}
+
+	get, err := store.PresignGetObject(ctx, "object", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignGetObject failed: %v", err)
+	}
+
+	for name, request := range map[string]PresignedRequest{"PUT": put, "part upload": part, "GET": get} {
+		for header, value := range want {
+			if request.Headers[header] != value {
+				t.Errorf("expected the %s to send %s: %s, got headers %v", name, header, value, request.Headers)
+			}
+		}
+	}
+}
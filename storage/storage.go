@@ -0,0 +1,161 @@
+// Package storage abstracts the object storage datas3t keeps the data and index objects
+// of dataranges in. Buckets are stored in S3 compatible object storage, or in a directory
+// of the local filesystem when their endpoint is a file:// URL.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrObjectNotFound is returned when an object does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore stores the objects of a single bucket
+type ObjectStore interface {
+	// PutObject stores an object of the given size
+	PutObject(ctx context.Context, key string, body io.Reader, size int64) error
+
+	// GetObject reads length bytes of an object starting at offset, a negative length
+	// reads to the end of the object
+	GetObject(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+
+	// HeadObject returns the size of an object
+	HeadObject(ctx context.Context, key string) (int64, error)
+
+	// ListObjects calls fn for every object whose key starts with prefix, in key order
+	ListObjects(ctx context.Context, prefix string, fn func(ObjectInfo) error) error
+
+	// DeleteObject deletes an object, deleting a missing object succeeds
+	DeleteObject(ctx context.Context, key string) error
+
+	// DeleteObjects deletes a batch of at most 1000 objects and reports the outcome for
+	// every key
+	DeleteObjects(ctx context.Context, keys []string) (*DeleteResult, error)
+
+	// CopyObject copies an object within the bucket. A size of 0 means that the object is
+	// known to be small.
+	CopyObject(ctx context.Context, sourceKey, destinationKey string, size int64) error
+
+	// CreateMultipartUpload starts a multipart upload and returns its ID
+	CreateMultipartUpload(ctx context.Context, key string) (string, error)
+
+	// UploadPart uploads a part of a multipart upload and returns its ETag
+	UploadPart(ctx context.Context, key, uploadID string, partNumber int32, body io.Reader, size int64) (string, error)
+
+	// ListParts returns the uploaded parts of a multipart upload ordered by part number
+	ListParts(ctx context.Context, key, uploadID string) ([]Part, error)
+
+	// CompleteMultipartUpload assembles the object from the given parts
+	CompleteMultipartUpload(ctx context.Context, key, uploadID string, parts []Part) error
+
+	// AbortMultipartUpload discards a multipart upload and its parts
+	AbortMultipartUpload(ctx context.Context, key, uploadID string) error
+
+	// PresignPutObject returns a URL uploading an object with a PUT request
+	PresignPutObject(ctx context.Context, key string, expiry time.Duration) (PresignedRequest, error)
+
+	// PresignUploadPart returns a URL uploading a part of a multipart upload with a PUT
+	// request, the ETag header of the response identifies the part
+	PresignUploadPart(ctx context.Context, key, uploadID string, partNumber int32, expiry time.Duration) (PresignedRequest, error)
+
+	// PresignGetObject returns a URL downloading an object, byte ranges are requested
+	// with the Range header
+	PresignGetObject(ctx context.Context, key string, expiry time.Duration) (PresignedRequest, error)
+
+	// PresignDeleteObject returns a URL deleting an object with a DELETE request
+	PresignDeleteObject(ctx context.Context, key string, expiry time.Duration) (string, error)
+
+	// SetStorageClass moves an object of the given size to another storage class
+	SetStorageClass(ctx context.Context, key string, size int64, storageClass string) error
+
+	// RestoreObject requests a temporary copy of an archived object that can be read for
+	// the given number of days. Requesting a restore that is already ongoing succeeds.
+	RestoreObject(ctx context.Context, key string, days int32) error
+
+	// RestoreStatus reports whether the restore of an archived object was requested and
+	// until when its restored copy can be read
+	RestoreStatus(ctx context.Context, key string) (RestoreStatus, error)
+}
+
+// PresignedRequest is a presigned URL and the headers requests to it must send, e.g. the
+// server-side encryption settings of the bucket
+type PresignedRequest struct {
+	URL     string
+	Headers map[string]string
+}
+
+// ObjectInfo describes a listed object
+type ObjectInfo struct {
+	Key  string
+	Size int64
+}
+
+// Part is a part of a multipart upload. Size is only set by ListParts.
+type Part struct {
+	PartNumber int32
+	ETag       string
+	Size       int64
+}
+
+// DeleteResult reports which objects of a batch were deleted
+type DeleteResult struct {
+	Deleted []string
+	Errors  []DeleteError
+}
+
+// DeleteError describes why an object of a batch was not deleted
+type DeleteError struct {
+	Key     string
+	Code    string
+	Message string
+}
+
+// Config locates a bucket and holds the plain credentials to access it. Local buckets
+// ignore everything but the endpoint and the bucket.
+type Config struct {
+	Endpoint        string
+	Bucket          string
+	AccessKey       string
+	SecretKey       string
+	SessionToken    string
+	Region          string
+	AddressingStyle string
+	CredentialMode  string
+
+	// ServerSideEncryption is applied to the objects of S3 buckets, local buckets do not
+	// support it
+	ServerSideEncryption ServerSideEncryption
+}
+
+const (
+	// SSEModeS3 encrypts objects with keys managed by S3
+	SSEModeS3 = "sse-s3"
+
+	// SSEModeKMS encrypts objects with a KMS key, the default key of the account unless a
+	// key ID is configured
+	SSEModeKMS = "sse-kms"
+
+	// SSEModeCustomer encrypts objects with a key provided with every request, which S3
+	// does not store
+	SSEModeCustomer = "sse-c"
+)
+
+// ServerSideEncryption configures the encryption S3 applies to the objects it stores. The
+// zero value leaves it to the default encryption of the bucket.
+type ServerSideEncryption struct {
+	Mode     string
+	KMSKeyID string
+	// CustomerKey is the base64-encoded 256-bit key of SSEModeCustomer, or a reference to
+	// a file or environment variable holding it
+	CustomerKey string
+}
+
+// IsLocalEndpoint reports whether an endpoint refers to a directory of the local
+// filesystem instead of S3
+func IsLocalEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, localEndpointScheme)
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// ErrStorageClassesNotSupported is returned by stores that keep all objects in one class
+var ErrStorageClassesNotSupported = errors.New("storage classes are not supported by local buckets")
+
+// S3 storage classes, from the warmest to the coldest
+const (
+	StorageClassStandard           = "STANDARD"
+	StorageClassIntelligentTiering = "INTELLIGENT_TIERING"
+	StorageClassStandardIA         = "STANDARD_IA"
+	StorageClassOneZoneIA          = "ONEZONE_IA"
+	StorageClassGlacierIR          = "GLACIER_IR"
+	StorageClassGlacier            = "GLACIER"
+	StorageClassDeepArchive        = "DEEP_ARCHIVE"
+)
+
+// storageClassTiers orders the storage classes by how cold they are. Classes of the same
+// tier are not moved between.
+var storageClassTiers = map[string]int{
+	StorageClassStandard:           0,
+	StorageClassIntelligentTiering: 1,
+	StorageClassStandardIA:         1,
+	StorageClassOneZoneIA:          1,
+	StorageClassGlacierIR:          2,
+	StorageClassGlacier:            3,
+	StorageClassDeepArchive:        4,
+}
+
+// ValidateStorageClass checks that objects can be moved to storageClass
+func ValidateStorageClass(storageClass string) error {
+	_, found := storageClassTiers[storageClass]
+	if !found {
+		return fmt.Errorf("unsupported storage class %q", storageClass)
+	}
+	return nil
+}
+
+// IsColderStorageClass reports whether objects of storage class a are colder than objects
+// of storage class b. Unknown classes are treated like the standard class.
+func IsColderStorageClass(a, b string) bool {
+	return storageClassTiers[a] > storageClassTiers[b]
+}
+
+// WarmerStorageClasses returns the storage classes objects are moved from to storageClass
+func WarmerStorageClasses(storageClass string) []string {
+	var warmer []string
+	for class := range storageClassTiers {
+		if IsColderStorageClass(storageClass, class) {
+			warmer = append(warmer, class)
+		}
+	}
+	slices.Sort(warmer)
+	return warmer
+}
+
+// IsArchivedStorageClass reports whether objects of a storage class have to be restored
+// before they can be read
+func IsArchivedStorageClass(storageClass string) bool {
+	return storageClass == StorageClassGlacier || storageClass == StorageClassDeepArchive
+}
+
+// RestoreStatus describes the temporary copy of an archived object
+type RestoreStatus struct {
+	// Ongoing is set while the copy is being restored
+	Ongoing bool
+
+	// ExpiresAt is when a restored copy is removed again, it is zero unless the object
+	// is restored
+	ExpiresAt time.Time
+}
+
+// Restored reports whether the object can be read until at least the given time
+func (r RestoreStatus) Restored(until time.Time) bool {
+	return !r.Ongoing && r.ExpiresAt.After(until)
+}
+
+var restoreHeaderRegex = regexp.MustCompile(`ongoing-request="(true|false)"(?:,\s*expiry-date="([^"]+)")?`)
+
+// parseRestoreHeader parses the x-amz-restore header S3 returns for archived objects
+// whose restore was requested, e.g.
+// ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"
+func parseRestoreHeader(header string) (RestoreStatus, error) {
+	if header == "" {
+		return RestoreStatus{}, nil
+	}
+
+	match := restoreHeaderRegex.FindStringSubmatch(header)
+	if match == nil {
+		return RestoreStatus{}, fmt.Errorf("invalid restore header %q", header)
+	}
+
+	status := RestoreStatus{Ongoing: match[1] == "true"}
+	if match[2] != "" {
+		expiresAt, err := time.Parse(time.RFC1123, match[2])
+		if err != nil {
+			return RestoreStatus{}, fmt.Errorf("invalid expiry date of restore header %q: %w", header, err)
+		}
+		status.ExpiresAt = expiresAt
+	}
+
+	return status, nil
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseRestoreHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		want    RestoreStatus
+		wantErr bool
+	}{
+		{name: "no restore requested"},
+		{name: "ongoing restore", header: `ongoing-request="true"`, want: RestoreStatus{Ongoing: true}},
+		{
+			name:   "restored copy",
+			header: `ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`,
+			want:   RestoreStatus{ExpiresAt: time.Date(2012, 12, 21, 0, 0, 0, 0, time.UTC)},
+		},
+		{name: "invalid header", header: "restored", wantErr: true},
+		{name: "invalid expiry date", header: `ongoing-request="false", expiry-date="tomorrow"`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRestoreHeader(tt.header)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got.Ongoing != tt.want.Ongoing || !got.ExpiresAt.Equal(tt.want.ExpiresAt) {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRestoreStatusRestored(t *testing.T) {
+	now := time.Now()
+
+	if (RestoreStatus{}).Restored(now) {
+		t.Error("expected an object without a restored copy not to be restored")
+	}
+	if (RestoreStatus{Ongoing: true, ExpiresAt: now.Add(time.Hour)}).Restored(now) {
+		t.Error("expected an ongoing restore not to be restored")
+	}
+	if (RestoreStatus{ExpiresAt: now.Add(-time.Hour)}).Restored(now) {
+		t.Error("expected an expired copy not to be restored")
+	}
+	if !(RestoreStatus{ExpiresAt: now.Add(time.Hour)}).Restored(now) {
+		t.Error("expected a copy expiring later to be restored")
+	}
+}
+
+func TestWarmerStorageClasses(t *testing.T) {
+	tests := map[string][]string{
+		StorageClassStandard:   nil,
+		StorageClassStandardIA: {StorageClassStandard},
+		StorageClassGlacier: {
+			StorageClassGlacierIR,
+			StorageClassIntelligentTiering,
+			StorageClassOneZoneIA,
+			StorageClassStandard,
+			StorageClassStandardIA,
+		},
+	}
+
+	for storageClass, want := range tests {
+		got := WarmerStorageClasses(storageClass)
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: expected %v, got %v", storageClass, want, got)
+		}
+	}
+
+	if !IsColderStorageClass(StorageClassDeepArchive, StorageClassGlacier) {
+		t.Error("expected DEEP_ARCHIVE to be colder than GLACIER")
+	}
+	if IsColderStorageClass(StorageClassStandardIA, StorageClassIntelligentTiering) {
+		t.Error("expected STANDARD_IA not to be colder than INTELLIGENT_TIERING")
+	}
+	if !IsArchivedStorageClass(StorageClassGlacier) || IsArchivedStorageClass(StorageClassGlacierIR) {
+		t.Error("expected only GLACIER of GLACIER and GLACIER_IR to be archived")
+	}
+}
@@ -8,7 +8,8 @@ import (
 
 func IndexTar(r io.Reader) ([]byte, error) {
 	var index []byte
-	tr := tar.NewReader(r)
+	counter := &countingReader{r: r}
+	tr := tar.NewReader(counter)
 	var position int64 = 0
 
 	for {
@@ -23,33 +24,20 @@ func IndexTar(r io.Reader) ([]byte, error) {
 			return nil, err
 		}
 
-		// Calculate header blocks (standard TAR header is always 1 block = 512 bytes)
-		headerBlocks := uint16(1)
+		// The reader has consumed the header blocks, including PAX and GNU extension
+		// headers, and the padding of the previous file. The content starts here.
+		contentPosition := counter.n
+		headerBlocks := uint16((contentPosition - headerPosition) / 512)
 
 		// Get file size
 		fileSize := header.Size
 
-		// Create index entry (8 + 2 + 6 = 16 bytes per entry)
-		entry := make([]byte, 16)
-
-		// Header Position (8 bytes, big-endian)
-		binary.BigEndian.PutUint64(entry[0:8], uint64(headerPosition))
-
-		// Header Blocks (2 bytes, big-endian)
-		binary.BigEndian.PutUint16(entry[8:10], headerBlocks)
-
-		// File Size (6 bytes, big-endian)
-		// We need to store a 64-bit value in 6 bytes, so we take the lower 48 bits
-		fileSizeBytes := make([]byte, 8)
-		binary.BigEndian.PutUint64(fileSizeBytes, uint64(fileSize))
-		copy(entry[10:16], fileSizeBytes[2:8]) // Take bytes 2-7 (6 bytes total)
-
-		index = append(index, entry...)
+		index = AppendIndexEntry(index, headerPosition, headerBlocks, fileSize)
 
 		// Calculate next position
-		// TAR format: header (512 bytes) + file content (rounded up to 512-byte boundary)
+		// TAR format: header blocks + file content (rounded up to 512-byte boundary)
 		contentBlocks := (fileSize + 511) / 512 // Round up to nearest 512-byte block
-		position = headerPosition + 512 + (contentBlocks * 512)
+		position = contentPosition + (contentBlocks * 512)
 
 		// Skip the file content in the reader
 		_, err = io.CopyN(io.Discard, tr, header.Size)
@@ -60,3 +48,36 @@ func IndexTar(r io.Reader) ([]byte, error) {
 
 	return index, nil
 }
+
+// countingReader counts the bytes read from r
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// AppendIndexEntry appends the 16 byte index entry of a single tar file to index.
+// It allows building an index incrementally while writing a tar archive.
+func AppendIndexEntry(index []byte, headerPosition int64, headerBlocks uint16, fileSize int64) []byte {
+	// Create index entry (8 + 2 + 6 = 16 bytes per entry)
+	entry := make([]byte, 16)
+
+	// Header Position (8 bytes, big-endian)
+	binary.BigEndian.PutUint64(entry[0:8], uint64(headerPosition))
+
+	// Header Blocks (2 bytes, big-endian)
+	binary.BigEndian.PutUint16(entry[8:10], headerBlocks)
+
+	// File Size (6 bytes, big-endian)
+	// We need to store a 64-bit value in 6 bytes, so we take the lower 48 bits
+	fileSizeBytes := make([]byte, 8)
+	binary.BigEndian.PutUint64(fileSizeBytes, uint64(fileSize))
+	copy(entry[10:16], fileSizeBytes[2:8]) // Take bytes 2-7 (6 bytes total)
+
+	return append(index, entry...)
+}
@@ -228,6 +228,71 @@ func TestIndexTar_PAXFormat(t *testing.T) {
 	}
 }
 
+func TestIndexTar_PAXHeaderBlocks(t *testing.T) {
+	// A PAX extended header precedes the header of the file, the index entry must
+	// start at the extended header and count all of its blocks
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	headers := []*tar.Header{
+		{
+			Name:       "00000000000000000000.txt",
+			Size:       600,
+			Mode:       0644,
+			ModTime:    time.Unix(1577836800, 0),
+			Format:     tar.FormatPAX,
+			PAXRecords: map[string]string{"DATAS3T.original_name": "images/cat_001.txt"},
+		},
+		{
+			Name:    "00000000000000000001.txt",
+			Size:    10,
+			Mode:    0644,
+			ModTime: time.Unix(1577836800, 0),
+			Format:  tar.FormatUSTAR,
+		},
+	}
+
+	for _, header := range headers {
+		err := tw.WriteHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = tw.Write(make([]byte, header.Size))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := tw.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := IndexTar(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(index) != 32 {
+		t.Fatalf("Expected 32 bytes (2 entries), got %d", len(index))
+	}
+
+	// Extended header, its records and the header of the file
+	if blocks := binary.BigEndian.Uint16(index[8:10]); blocks != 3 {
+		t.Errorf("Expected 3 header blocks for the first entry, got %d", blocks)
+	}
+
+	// 3 header blocks + 2 content blocks
+	if position := binary.BigEndian.Uint64(index[16:24]); position != 5*512 {
+		t.Errorf("Expected the second entry at %d, got %d", 5*512, position)
+	}
+
+	if blocks := binary.BigEndian.Uint16(index[24:26]); blocks != 1 {
+		t.Errorf("Expected 1 header block for the second entry, got %d", blocks)
+	}
+}
+
 func TestIndexTar_USTARFormat(t *testing.T) {
 	// Create TAR with USTAR format
 	var buf bytes.Buffer
@@ -0,0 +1,23 @@
+package version
+
+import "runtime/debug"
+
+// Version is the build version of datas3t. It is set at build time with
+//
+//	go build -ldflags "-X github.com/draganm/datas3t/version.Version=v1.2.3"
+var Version = ""
+
+// Get returns the build version, falling back to the module version recorded
+// by the Go toolchain and finally to "dev".
+func Get() string {
+	if Version != "" {
+		return Version
+	}
+
+	info, ok := debug.ReadBuildInfo()
+	if ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+
+	return "dev"
+}